@@ -0,0 +1,1660 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: adminrpc/admin.proto
+
+package adminrpc
+
+/*
+The admin service of the extension update server offers the operations of the REST admin and stats APIs
+to internal release tooling with typed clients. Calls are authorized like the REST API, with a bearer token
+in the authorization metadata, and recorded in the same audit log.
+
+Regenerate admin.pb.go with protoc-gen-go v1.1.0 after changing this file:
+
+	protoc --go_out=plugins=grpc:. adminrpc/admin.proto
+*/
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+
+// Extension is the catalog entry of an extension
+type Extension struct {
+	Id          string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Version     string `protobuf:"bytes,2,opt,name=version" json:"version,omitempty"`
+	Sha256      string `protobuf:"bytes,3,opt,name=sha256" json:"sha256,omitempty"`
+	Title       string `protobuf:"bytes,4,opt,name=title" json:"title,omitempty"`
+	Url         string `protobuf:"bytes,5,opt,name=url" json:"url,omitempty"`
+	Blacklisted bool   `protobuf:"varint,6,opt,name=blacklisted" json:"blacklisted,omitempty"`
+	// size of the CRX in bytes, or 0 if unknown
+	Size         int64    `protobuf:"varint,7,opt,name=size" json:"size,omitempty"`
+	Dependencies []string `protobuf:"bytes,8,rep,name=dependencies" json:"dependencies,omitempty"`
+	// scheduled is the next version, which replaces this one at its publish_at
+	Scheduled *Extension `protobuf:"bytes,9,opt,name=scheduled" json:"scheduled,omitempty"`
+	// publish_at is an RFC 3339 time, only set on scheduled versions
+	PublishAt            string   `protobuf:"bytes,10,opt,name=publish_at,json=publishAt" json:"publish_at,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Extension) Reset()         { *m = Extension{} }
+func (m *Extension) String() string { return proto.CompactTextString(m) }
+func (*Extension) ProtoMessage()    {}
+func (*Extension) Descriptor() ([]byte, []int) {
+	return fileDescriptor_admin_655012fc55a6269c, []int{0}
+}
+func (m *Extension) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Extension.Unmarshal(m, b)
+}
+func (m *Extension) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Extension.Marshal(b, m, deterministic)
+}
+func (dst *Extension) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Extension.Merge(dst, src)
+}
+func (m *Extension) XXX_Size() int {
+	return xxx_messageInfo_Extension.Size(m)
+}
+func (m *Extension) XXX_DiscardUnknown() {
+	xxx_messageInfo_Extension.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Extension proto.InternalMessageInfo
+
+func (m *Extension) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *Extension) GetVersion() string {
+	if m != nil {
+		return m.Version
+	}
+	return ""
+}
+
+func (m *Extension) GetSha256() string {
+	if m != nil {
+		return m.Sha256
+	}
+	return ""
+}
+
+func (m *Extension) GetTitle() string {
+	if m != nil {
+		return m.Title
+	}
+	return ""
+}
+
+func (m *Extension) GetUrl() string {
+	if m != nil {
+		return m.Url
+	}
+	return ""
+}
+
+func (m *Extension) GetBlacklisted() bool {
+	if m != nil {
+		return m.Blacklisted
+	}
+	return false
+}
+
+func (m *Extension) GetSize() int64 {
+	if m != nil {
+		return m.Size
+	}
+	return 0
+}
+
+func (m *Extension) GetDependencies() []string {
+	if m != nil {
+		return m.Dependencies
+	}
+	return nil
+}
+
+func (m *Extension) GetScheduled() *Extension {
+	if m != nil {
+		return m.Scheduled
+	}
+	return nil
+}
+
+func (m *Extension) GetPublishAt() string {
+	if m != nil {
+		return m.PublishAt
+	}
+	return ""
+}
+
+type ListExtensionsRequest struct {
+	Tenant               string   `protobuf:"bytes,1,opt,name=tenant" json:"tenant,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListExtensionsRequest) Reset()         { *m = ListExtensionsRequest{} }
+func (m *ListExtensionsRequest) String() string { return proto.CompactTextString(m) }
+func (*ListExtensionsRequest) ProtoMessage()    {}
+func (*ListExtensionsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_admin_655012fc55a6269c, []int{1}
+}
+func (m *ListExtensionsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListExtensionsRequest.Unmarshal(m, b)
+}
+func (m *ListExtensionsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListExtensionsRequest.Marshal(b, m, deterministic)
+}
+func (dst *ListExtensionsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListExtensionsRequest.Merge(dst, src)
+}
+func (m *ListExtensionsRequest) XXX_Size() int {
+	return xxx_messageInfo_ListExtensionsRequest.Size(m)
+}
+func (m *ListExtensionsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListExtensionsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListExtensionsRequest proto.InternalMessageInfo
+
+func (m *ListExtensionsRequest) GetTenant() string {
+	if m != nil {
+		return m.Tenant
+	}
+	return ""
+}
+
+type ListExtensionsResponse struct {
+	Extensions           []*Extension `protobuf:"bytes,1,rep,name=extensions" json:"extensions,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}     `json:"-"`
+	XXX_unrecognized     []byte       `json:"-"`
+	XXX_sizecache        int32        `json:"-"`
+}
+
+func (m *ListExtensionsResponse) Reset()         { *m = ListExtensionsResponse{} }
+func (m *ListExtensionsResponse) String() string { return proto.CompactTextString(m) }
+func (*ListExtensionsResponse) ProtoMessage()    {}
+func (*ListExtensionsResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_admin_655012fc55a6269c, []int{2}
+}
+func (m *ListExtensionsResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListExtensionsResponse.Unmarshal(m, b)
+}
+func (m *ListExtensionsResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListExtensionsResponse.Marshal(b, m, deterministic)
+}
+func (dst *ListExtensionsResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListExtensionsResponse.Merge(dst, src)
+}
+func (m *ListExtensionsResponse) XXX_Size() int {
+	return xxx_messageInfo_ListExtensionsResponse.Size(m)
+}
+func (m *ListExtensionsResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListExtensionsResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListExtensionsResponse proto.InternalMessageInfo
+
+func (m *ListExtensionsResponse) GetExtensions() []*Extension {
+	if m != nil {
+		return m.Extensions
+	}
+	return nil
+}
+
+type GetExtensionRequest struct {
+	Tenant               string   `protobuf:"bytes,1,opt,name=tenant" json:"tenant,omitempty"`
+	Id                   string   `protobuf:"bytes,2,opt,name=id" json:"id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetExtensionRequest) Reset()         { *m = GetExtensionRequest{} }
+func (m *GetExtensionRequest) String() string { return proto.CompactTextString(m) }
+func (*GetExtensionRequest) ProtoMessage()    {}
+func (*GetExtensionRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_admin_655012fc55a6269c, []int{3}
+}
+func (m *GetExtensionRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetExtensionRequest.Unmarshal(m, b)
+}
+func (m *GetExtensionRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetExtensionRequest.Marshal(b, m, deterministic)
+}
+func (dst *GetExtensionRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetExtensionRequest.Merge(dst, src)
+}
+func (m *GetExtensionRequest) XXX_Size() int {
+	return xxx_messageInfo_GetExtensionRequest.Size(m)
+}
+func (m *GetExtensionRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetExtensionRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetExtensionRequest proto.InternalMessageInfo
+
+func (m *GetExtensionRequest) GetTenant() string {
+	if m != nil {
+		return m.Tenant
+	}
+	return ""
+}
+
+func (m *GetExtensionRequest) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+type UploadExtensionRequest struct {
+	Tenant  string `protobuf:"bytes,1,opt,name=tenant" json:"tenant,omitempty"`
+	Id      string `protobuf:"bytes,2,opt,name=id" json:"id,omitempty"`
+	Version string `protobuf:"bytes,3,opt,name=version" json:"version,omitempty"`
+	// crx is the signed CRX3 package
+	Crx []byte `protobuf:"bytes,4,opt,name=crx,proto3" json:"crx,omitempty"`
+	// publish_at is an RFC 3339 time to publish the version at instead of now
+	PublishAt string `protobuf:"bytes,5,opt,name=publish_at,json=publishAt" json:"publish_at,omitempty"`
+	// title is the title of an extension which isn't in the catalog yet
+	Title string `protobuf:"bytes,6,opt,name=title" json:"title,omitempty"`
+	// dependencies replace the dependencies of the extension when there are any
+	Dependencies         []string `protobuf:"bytes,7,rep,name=dependencies" json:"dependencies,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *UploadExtensionRequest) Reset()         { *m = UploadExtensionRequest{} }
+func (m *UploadExtensionRequest) String() string { return proto.CompactTextString(m) }
+func (*UploadExtensionRequest) ProtoMessage()    {}
+func (*UploadExtensionRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_admin_655012fc55a6269c, []int{4}
+}
+func (m *UploadExtensionRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_UploadExtensionRequest.Unmarshal(m, b)
+}
+func (m *UploadExtensionRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_UploadExtensionRequest.Marshal(b, m, deterministic)
+}
+func (dst *UploadExtensionRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_UploadExtensionRequest.Merge(dst, src)
+}
+func (m *UploadExtensionRequest) XXX_Size() int {
+	return xxx_messageInfo_UploadExtensionRequest.Size(m)
+}
+func (m *UploadExtensionRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_UploadExtensionRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_UploadExtensionRequest proto.InternalMessageInfo
+
+func (m *UploadExtensionRequest) GetTenant() string {
+	if m != nil {
+		return m.Tenant
+	}
+	return ""
+}
+
+func (m *UploadExtensionRequest) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *UploadExtensionRequest) GetVersion() string {
+	if m != nil {
+		return m.Version
+	}
+	return ""
+}
+
+func (m *UploadExtensionRequest) GetCrx() []byte {
+	if m != nil {
+		return m.Crx
+	}
+	return nil
+}
+
+func (m *UploadExtensionRequest) GetPublishAt() string {
+	if m != nil {
+		return m.PublishAt
+	}
+	return ""
+}
+
+func (m *UploadExtensionRequest) GetTitle() string {
+	if m != nil {
+		return m.Title
+	}
+	return ""
+}
+
+func (m *UploadExtensionRequest) GetDependencies() []string {
+	if m != nil {
+		return m.Dependencies
+	}
+	return nil
+}
+
+type DeleteExtensionRequest struct {
+	Tenant               string   `protobuf:"bytes,1,opt,name=tenant" json:"tenant,omitempty"`
+	Id                   string   `protobuf:"bytes,2,opt,name=id" json:"id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DeleteExtensionRequest) Reset()         { *m = DeleteExtensionRequest{} }
+func (m *DeleteExtensionRequest) String() string { return proto.CompactTextString(m) }
+func (*DeleteExtensionRequest) ProtoMessage()    {}
+func (*DeleteExtensionRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_admin_655012fc55a6269c, []int{5}
+}
+func (m *DeleteExtensionRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DeleteExtensionRequest.Unmarshal(m, b)
+}
+func (m *DeleteExtensionRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DeleteExtensionRequest.Marshal(b, m, deterministic)
+}
+func (dst *DeleteExtensionRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DeleteExtensionRequest.Merge(dst, src)
+}
+func (m *DeleteExtensionRequest) XXX_Size() int {
+	return xxx_messageInfo_DeleteExtensionRequest.Size(m)
+}
+func (m *DeleteExtensionRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_DeleteExtensionRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DeleteExtensionRequest proto.InternalMessageInfo
+
+func (m *DeleteExtensionRequest) GetTenant() string {
+	if m != nil {
+		return m.Tenant
+	}
+	return ""
+}
+
+func (m *DeleteExtensionRequest) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+type DeleteExtensionResponse struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DeleteExtensionResponse) Reset()         { *m = DeleteExtensionResponse{} }
+func (m *DeleteExtensionResponse) String() string { return proto.CompactTextString(m) }
+func (*DeleteExtensionResponse) ProtoMessage()    {}
+func (*DeleteExtensionResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_admin_655012fc55a6269c, []int{6}
+}
+func (m *DeleteExtensionResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DeleteExtensionResponse.Unmarshal(m, b)
+}
+func (m *DeleteExtensionResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DeleteExtensionResponse.Marshal(b, m, deterministic)
+}
+func (dst *DeleteExtensionResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DeleteExtensionResponse.Merge(dst, src)
+}
+func (m *DeleteExtensionResponse) XXX_Size() int {
+	return xxx_messageInfo_DeleteExtensionResponse.Size(m)
+}
+func (m *DeleteExtensionResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_DeleteExtensionResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DeleteExtensionResponse proto.InternalMessageInfo
+
+type BlacklistExtensionRequest struct {
+	Tenant string `protobuf:"bytes,1,opt,name=tenant" json:"tenant,omitempty"`
+	Id     string `protobuf:"bytes,2,opt,name=id" json:"id,omitempty"`
+	// blacklisted is false to offer updates for a blacklisted extension again
+	Blacklisted          bool     `protobuf:"varint,3,opt,name=blacklisted" json:"blacklisted,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *BlacklistExtensionRequest) Reset()         { *m = BlacklistExtensionRequest{} }
+func (m *BlacklistExtensionRequest) String() string { return proto.CompactTextString(m) }
+func (*BlacklistExtensionRequest) ProtoMessage()    {}
+func (*BlacklistExtensionRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_admin_655012fc55a6269c, []int{7}
+}
+func (m *BlacklistExtensionRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_BlacklistExtensionRequest.Unmarshal(m, b)
+}
+func (m *BlacklistExtensionRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_BlacklistExtensionRequest.Marshal(b, m, deterministic)
+}
+func (dst *BlacklistExtensionRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_BlacklistExtensionRequest.Merge(dst, src)
+}
+func (m *BlacklistExtensionRequest) XXX_Size() int {
+	return xxx_messageInfo_BlacklistExtensionRequest.Size(m)
+}
+func (m *BlacklistExtensionRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_BlacklistExtensionRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_BlacklistExtensionRequest proto.InternalMessageInfo
+
+func (m *BlacklistExtensionRequest) GetTenant() string {
+	if m != nil {
+		return m.Tenant
+	}
+	return ""
+}
+
+func (m *BlacklistExtensionRequest) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *BlacklistExtensionRequest) GetBlacklisted() bool {
+	if m != nil {
+		return m.Blacklisted
+	}
+	return false
+}
+
+type RefreshCatalogRequest struct {
+	Tenant               string   `protobuf:"bytes,1,opt,name=tenant" json:"tenant,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RefreshCatalogRequest) Reset()         { *m = RefreshCatalogRequest{} }
+func (m *RefreshCatalogRequest) String() string { return proto.CompactTextString(m) }
+func (*RefreshCatalogRequest) ProtoMessage()    {}
+func (*RefreshCatalogRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_admin_655012fc55a6269c, []int{8}
+}
+func (m *RefreshCatalogRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RefreshCatalogRequest.Unmarshal(m, b)
+}
+func (m *RefreshCatalogRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RefreshCatalogRequest.Marshal(b, m, deterministic)
+}
+func (dst *RefreshCatalogRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RefreshCatalogRequest.Merge(dst, src)
+}
+func (m *RefreshCatalogRequest) XXX_Size() int {
+	return xxx_messageInfo_RefreshCatalogRequest.Size(m)
+}
+func (m *RefreshCatalogRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_RefreshCatalogRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RefreshCatalogRequest proto.InternalMessageInfo
+
+func (m *RefreshCatalogRequest) GetTenant() string {
+	if m != nil {
+		return m.Tenant
+	}
+	return ""
+}
+
+type RefreshCatalogResponse struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RefreshCatalogResponse) Reset()         { *m = RefreshCatalogResponse{} }
+func (m *RefreshCatalogResponse) String() string { return proto.CompactTextString(m) }
+func (*RefreshCatalogResponse) ProtoMessage()    {}
+func (*RefreshCatalogResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_admin_655012fc55a6269c, []int{9}
+}
+func (m *RefreshCatalogResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RefreshCatalogResponse.Unmarshal(m, b)
+}
+func (m *RefreshCatalogResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RefreshCatalogResponse.Marshal(b, m, deterministic)
+}
+func (dst *RefreshCatalogResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RefreshCatalogResponse.Merge(dst, src)
+}
+func (m *RefreshCatalogResponse) XXX_Size() int {
+	return xxx_messageInfo_RefreshCatalogResponse.Size(m)
+}
+func (m *RefreshCatalogResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_RefreshCatalogResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RefreshCatalogResponse proto.InternalMessageInfo
+
+type ReloadConfigRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ReloadConfigRequest) Reset()         { *m = ReloadConfigRequest{} }
+func (m *ReloadConfigRequest) String() string { return proto.CompactTextString(m) }
+func (*ReloadConfigRequest) ProtoMessage()    {}
+func (*ReloadConfigRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_admin_655012fc55a6269c, []int{10}
+}
+func (m *ReloadConfigRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ReloadConfigRequest.Unmarshal(m, b)
+}
+func (m *ReloadConfigRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ReloadConfigRequest.Marshal(b, m, deterministic)
+}
+func (dst *ReloadConfigRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ReloadConfigRequest.Merge(dst, src)
+}
+func (m *ReloadConfigRequest) XXX_Size() int {
+	return xxx_messageInfo_ReloadConfigRequest.Size(m)
+}
+func (m *ReloadConfigRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ReloadConfigRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ReloadConfigRequest proto.InternalMessageInfo
+
+type ReloadConfigResponse struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ReloadConfigResponse) Reset()         { *m = ReloadConfigResponse{} }
+func (m *ReloadConfigResponse) String() string { return proto.CompactTextString(m) }
+func (*ReloadConfigResponse) ProtoMessage()    {}
+func (*ReloadConfigResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_admin_655012fc55a6269c, []int{11}
+}
+func (m *ReloadConfigResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ReloadConfigResponse.Unmarshal(m, b)
+}
+func (m *ReloadConfigResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ReloadConfigResponse.Marshal(b, m, deterministic)
+}
+func (dst *ReloadConfigResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ReloadConfigResponse.Merge(dst, src)
+}
+func (m *ReloadConfigResponse) XXX_Size() int {
+	return xxx_messageInfo_ReloadConfigResponse.Size(m)
+}
+func (m *ReloadConfigResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ReloadConfigResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ReloadConfigResponse proto.InternalMessageInfo
+
+type MaintenanceStatus struct {
+	Enabled bool `protobuf:"varint,1,opt,name=enabled" json:"enabled,omitempty"`
+	// retry_after is how many seconds clients are asked to wait during maintenance
+	RetryAfter           int32    `protobuf:"varint,2,opt,name=retry_after,json=retryAfter" json:"retry_after,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *MaintenanceStatus) Reset()         { *m = MaintenanceStatus{} }
+func (m *MaintenanceStatus) String() string { return proto.CompactTextString(m) }
+func (*MaintenanceStatus) ProtoMessage()    {}
+func (*MaintenanceStatus) Descriptor() ([]byte, []int) {
+	return fileDescriptor_admin_655012fc55a6269c, []int{12}
+}
+func (m *MaintenanceStatus) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_MaintenanceStatus.Unmarshal(m, b)
+}
+func (m *MaintenanceStatus) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_MaintenanceStatus.Marshal(b, m, deterministic)
+}
+func (dst *MaintenanceStatus) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_MaintenanceStatus.Merge(dst, src)
+}
+func (m *MaintenanceStatus) XXX_Size() int {
+	return xxx_messageInfo_MaintenanceStatus.Size(m)
+}
+func (m *MaintenanceStatus) XXX_DiscardUnknown() {
+	xxx_messageInfo_MaintenanceStatus.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_MaintenanceStatus proto.InternalMessageInfo
+
+func (m *MaintenanceStatus) GetEnabled() bool {
+	if m != nil {
+		return m.Enabled
+	}
+	return false
+}
+
+func (m *MaintenanceStatus) GetRetryAfter() int32 {
+	if m != nil {
+		return m.RetryAfter
+	}
+	return 0
+}
+
+type GetMaintenanceRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetMaintenanceRequest) Reset()         { *m = GetMaintenanceRequest{} }
+func (m *GetMaintenanceRequest) String() string { return proto.CompactTextString(m) }
+func (*GetMaintenanceRequest) ProtoMessage()    {}
+func (*GetMaintenanceRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_admin_655012fc55a6269c, []int{13}
+}
+func (m *GetMaintenanceRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetMaintenanceRequest.Unmarshal(m, b)
+}
+func (m *GetMaintenanceRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetMaintenanceRequest.Marshal(b, m, deterministic)
+}
+func (dst *GetMaintenanceRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetMaintenanceRequest.Merge(dst, src)
+}
+func (m *GetMaintenanceRequest) XXX_Size() int {
+	return xxx_messageInfo_GetMaintenanceRequest.Size(m)
+}
+func (m *GetMaintenanceRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetMaintenanceRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetMaintenanceRequest proto.InternalMessageInfo
+
+type SetMaintenanceRequest struct {
+	Enabled              bool     `protobuf:"varint,1,opt,name=enabled" json:"enabled,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SetMaintenanceRequest) Reset()         { *m = SetMaintenanceRequest{} }
+func (m *SetMaintenanceRequest) String() string { return proto.CompactTextString(m) }
+func (*SetMaintenanceRequest) ProtoMessage()    {}
+func (*SetMaintenanceRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_admin_655012fc55a6269c, []int{14}
+}
+func (m *SetMaintenanceRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SetMaintenanceRequest.Unmarshal(m, b)
+}
+func (m *SetMaintenanceRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SetMaintenanceRequest.Marshal(b, m, deterministic)
+}
+func (dst *SetMaintenanceRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SetMaintenanceRequest.Merge(dst, src)
+}
+func (m *SetMaintenanceRequest) XXX_Size() int {
+	return xxx_messageInfo_SetMaintenanceRequest.Size(m)
+}
+func (m *SetMaintenanceRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_SetMaintenanceRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SetMaintenanceRequest proto.InternalMessageInfo
+
+func (m *SetMaintenanceRequest) GetEnabled() bool {
+	if m != nil {
+		return m.Enabled
+	}
+	return false
+}
+
+// ServingWindow limits when updates for an extension are offered
+type ServingWindow struct {
+	Id string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	// start and end are times of day like "22:00", windows where end is before start span midnight
+	Start string `protobuf:"bytes,2,opt,name=start" json:"start,omitempty"`
+	End   string `protobuf:"bytes,3,opt,name=end" json:"end,omitempty"`
+	// time_zone is an IANA time zone like "America/New_York", UTC if empty
+	TimeZone             string   `protobuf:"bytes,4,opt,name=time_zone,json=timeZone" json:"time_zone,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ServingWindow) Reset()         { *m = ServingWindow{} }
+func (m *ServingWindow) String() string { return proto.CompactTextString(m) }
+func (*ServingWindow) ProtoMessage()    {}
+func (*ServingWindow) Descriptor() ([]byte, []int) {
+	return fileDescriptor_admin_655012fc55a6269c, []int{15}
+}
+func (m *ServingWindow) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ServingWindow.Unmarshal(m, b)
+}
+func (m *ServingWindow) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ServingWindow.Marshal(b, m, deterministic)
+}
+func (dst *ServingWindow) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ServingWindow.Merge(dst, src)
+}
+func (m *ServingWindow) XXX_Size() int {
+	return xxx_messageInfo_ServingWindow.Size(m)
+}
+func (m *ServingWindow) XXX_DiscardUnknown() {
+	xxx_messageInfo_ServingWindow.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ServingWindow proto.InternalMessageInfo
+
+func (m *ServingWindow) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *ServingWindow) GetStart() string {
+	if m != nil {
+		return m.Start
+	}
+	return ""
+}
+
+func (m *ServingWindow) GetEnd() string {
+	if m != nil {
+		return m.End
+	}
+	return ""
+}
+
+func (m *ServingWindow) GetTimeZone() string {
+	if m != nil {
+		return m.TimeZone
+	}
+	return ""
+}
+
+type ListServingWindowsRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListServingWindowsRequest) Reset()         { *m = ListServingWindowsRequest{} }
+func (m *ListServingWindowsRequest) String() string { return proto.CompactTextString(m) }
+func (*ListServingWindowsRequest) ProtoMessage()    {}
+func (*ListServingWindowsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_admin_655012fc55a6269c, []int{16}
+}
+func (m *ListServingWindowsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListServingWindowsRequest.Unmarshal(m, b)
+}
+func (m *ListServingWindowsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListServingWindowsRequest.Marshal(b, m, deterministic)
+}
+func (dst *ListServingWindowsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListServingWindowsRequest.Merge(dst, src)
+}
+func (m *ListServingWindowsRequest) XXX_Size() int {
+	return xxx_messageInfo_ListServingWindowsRequest.Size(m)
+}
+func (m *ListServingWindowsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListServingWindowsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListServingWindowsRequest proto.InternalMessageInfo
+
+type ListServingWindowsResponse struct {
+	Windows              []*ServingWindow `protobuf:"bytes,1,rep,name=windows" json:"windows,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}         `json:"-"`
+	XXX_unrecognized     []byte           `json:"-"`
+	XXX_sizecache        int32            `json:"-"`
+}
+
+func (m *ListServingWindowsResponse) Reset()         { *m = ListServingWindowsResponse{} }
+func (m *ListServingWindowsResponse) String() string { return proto.CompactTextString(m) }
+func (*ListServingWindowsResponse) ProtoMessage()    {}
+func (*ListServingWindowsResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_admin_655012fc55a6269c, []int{17}
+}
+func (m *ListServingWindowsResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListServingWindowsResponse.Unmarshal(m, b)
+}
+func (m *ListServingWindowsResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListServingWindowsResponse.Marshal(b, m, deterministic)
+}
+func (dst *ListServingWindowsResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListServingWindowsResponse.Merge(dst, src)
+}
+func (m *ListServingWindowsResponse) XXX_Size() int {
+	return xxx_messageInfo_ListServingWindowsResponse.Size(m)
+}
+func (m *ListServingWindowsResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListServingWindowsResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListServingWindowsResponse proto.InternalMessageInfo
+
+func (m *ListServingWindowsResponse) GetWindows() []*ServingWindow {
+	if m != nil {
+		return m.Windows
+	}
+	return nil
+}
+
+type DeleteServingWindowRequest struct {
+	Id                   string   `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DeleteServingWindowRequest) Reset()         { *m = DeleteServingWindowRequest{} }
+func (m *DeleteServingWindowRequest) String() string { return proto.CompactTextString(m) }
+func (*DeleteServingWindowRequest) ProtoMessage()    {}
+func (*DeleteServingWindowRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_admin_655012fc55a6269c, []int{18}
+}
+func (m *DeleteServingWindowRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DeleteServingWindowRequest.Unmarshal(m, b)
+}
+func (m *DeleteServingWindowRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DeleteServingWindowRequest.Marshal(b, m, deterministic)
+}
+func (dst *DeleteServingWindowRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DeleteServingWindowRequest.Merge(dst, src)
+}
+func (m *DeleteServingWindowRequest) XXX_Size() int {
+	return xxx_messageInfo_DeleteServingWindowRequest.Size(m)
+}
+func (m *DeleteServingWindowRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_DeleteServingWindowRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DeleteServingWindowRequest proto.InternalMessageInfo
+
+func (m *DeleteServingWindowRequest) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+type DeleteServingWindowResponse struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DeleteServingWindowResponse) Reset()         { *m = DeleteServingWindowResponse{} }
+func (m *DeleteServingWindowResponse) String() string { return proto.CompactTextString(m) }
+func (*DeleteServingWindowResponse) ProtoMessage()    {}
+func (*DeleteServingWindowResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_admin_655012fc55a6269c, []int{19}
+}
+func (m *DeleteServingWindowResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DeleteServingWindowResponse.Unmarshal(m, b)
+}
+func (m *DeleteServingWindowResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DeleteServingWindowResponse.Marshal(b, m, deterministic)
+}
+func (dst *DeleteServingWindowResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DeleteServingWindowResponse.Merge(dst, src)
+}
+func (m *DeleteServingWindowResponse) XXX_Size() int {
+	return xxx_messageInfo_DeleteServingWindowResponse.Size(m)
+}
+func (m *DeleteServingWindowResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_DeleteServingWindowResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DeleteServingWindowResponse proto.InternalMessageInfo
+
+type ExtensionStats struct {
+	Id                   string   `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Version              string   `protobuf:"bytes,2,opt,name=version" json:"version,omitempty"`
+	UpdatesServed        int64    `protobuf:"varint,3,opt,name=updates_served,json=updatesServed" json:"updates_served,omitempty"`
+	Downloads            int64    `protobuf:"varint,4,opt,name=downloads" json:"downloads,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ExtensionStats) Reset()         { *m = ExtensionStats{} }
+func (m *ExtensionStats) String() string { return proto.CompactTextString(m) }
+func (*ExtensionStats) ProtoMessage()    {}
+func (*ExtensionStats) Descriptor() ([]byte, []int) {
+	return fileDescriptor_admin_655012fc55a6269c, []int{20}
+}
+func (m *ExtensionStats) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ExtensionStats.Unmarshal(m, b)
+}
+func (m *ExtensionStats) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ExtensionStats.Marshal(b, m, deterministic)
+}
+func (dst *ExtensionStats) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ExtensionStats.Merge(dst, src)
+}
+func (m *ExtensionStats) XXX_Size() int {
+	return xxx_messageInfo_ExtensionStats.Size(m)
+}
+func (m *ExtensionStats) XXX_DiscardUnknown() {
+	xxx_messageInfo_ExtensionStats.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ExtensionStats proto.InternalMessageInfo
+
+func (m *ExtensionStats) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *ExtensionStats) GetVersion() string {
+	if m != nil {
+		return m.Version
+	}
+	return ""
+}
+
+func (m *ExtensionStats) GetUpdatesServed() int64 {
+	if m != nil {
+		return m.UpdatesServed
+	}
+	return 0
+}
+
+func (m *ExtensionStats) GetDownloads() int64 {
+	if m != nil {
+		return m.Downloads
+	}
+	return 0
+}
+
+type GetExtensionStatsRequest struct {
+	// id limits the counts to versions of one extension
+	Id                   string   `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetExtensionStatsRequest) Reset()         { *m = GetExtensionStatsRequest{} }
+func (m *GetExtensionStatsRequest) String() string { return proto.CompactTextString(m) }
+func (*GetExtensionStatsRequest) ProtoMessage()    {}
+func (*GetExtensionStatsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_admin_655012fc55a6269c, []int{21}
+}
+func (m *GetExtensionStatsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetExtensionStatsRequest.Unmarshal(m, b)
+}
+func (m *GetExtensionStatsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetExtensionStatsRequest.Marshal(b, m, deterministic)
+}
+func (dst *GetExtensionStatsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetExtensionStatsRequest.Merge(dst, src)
+}
+func (m *GetExtensionStatsRequest) XXX_Size() int {
+	return xxx_messageInfo_GetExtensionStatsRequest.Size(m)
+}
+func (m *GetExtensionStatsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetExtensionStatsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetExtensionStatsRequest proto.InternalMessageInfo
+
+func (m *GetExtensionStatsRequest) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+type ExtensionStatsReport struct {
+	// since is the RFC 3339 time the server started counting
+	Since                string            `protobuf:"bytes,1,opt,name=since" json:"since,omitempty"`
+	Extensions           []*ExtensionStats `protobuf:"bytes,2,rep,name=extensions" json:"extensions,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
+}
+
+func (m *ExtensionStatsReport) Reset()         { *m = ExtensionStatsReport{} }
+func (m *ExtensionStatsReport) String() string { return proto.CompactTextString(m) }
+func (*ExtensionStatsReport) ProtoMessage()    {}
+func (*ExtensionStatsReport) Descriptor() ([]byte, []int) {
+	return fileDescriptor_admin_655012fc55a6269c, []int{22}
+}
+func (m *ExtensionStatsReport) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ExtensionStatsReport.Unmarshal(m, b)
+}
+func (m *ExtensionStatsReport) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ExtensionStatsReport.Marshal(b, m, deterministic)
+}
+func (dst *ExtensionStatsReport) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ExtensionStatsReport.Merge(dst, src)
+}
+func (m *ExtensionStatsReport) XXX_Size() int {
+	return xxx_messageInfo_ExtensionStatsReport.Size(m)
+}
+func (m *ExtensionStatsReport) XXX_DiscardUnknown() {
+	xxx_messageInfo_ExtensionStatsReport.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ExtensionStatsReport proto.InternalMessageInfo
+
+func (m *ExtensionStatsReport) GetSince() string {
+	if m != nil {
+		return m.Since
+	}
+	return ""
+}
+
+func (m *ExtensionStatsReport) GetExtensions() []*ExtensionStats {
+	if m != nil {
+		return m.Extensions
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*Extension)(nil), "goupdate.admin.Extension")
+	proto.RegisterType((*ListExtensionsRequest)(nil), "goupdate.admin.ListExtensionsRequest")
+	proto.RegisterType((*ListExtensionsResponse)(nil), "goupdate.admin.ListExtensionsResponse")
+	proto.RegisterType((*GetExtensionRequest)(nil), "goupdate.admin.GetExtensionRequest")
+	proto.RegisterType((*UploadExtensionRequest)(nil), "goupdate.admin.UploadExtensionRequest")
+	proto.RegisterType((*DeleteExtensionRequest)(nil), "goupdate.admin.DeleteExtensionRequest")
+	proto.RegisterType((*DeleteExtensionResponse)(nil), "goupdate.admin.DeleteExtensionResponse")
+	proto.RegisterType((*BlacklistExtensionRequest)(nil), "goupdate.admin.BlacklistExtensionRequest")
+	proto.RegisterType((*RefreshCatalogRequest)(nil), "goupdate.admin.RefreshCatalogRequest")
+	proto.RegisterType((*RefreshCatalogResponse)(nil), "goupdate.admin.RefreshCatalogResponse")
+	proto.RegisterType((*ReloadConfigRequest)(nil), "goupdate.admin.ReloadConfigRequest")
+	proto.RegisterType((*ReloadConfigResponse)(nil), "goupdate.admin.ReloadConfigResponse")
+	proto.RegisterType((*MaintenanceStatus)(nil), "goupdate.admin.MaintenanceStatus")
+	proto.RegisterType((*GetMaintenanceRequest)(nil), "goupdate.admin.GetMaintenanceRequest")
+	proto.RegisterType((*SetMaintenanceRequest)(nil), "goupdate.admin.SetMaintenanceRequest")
+	proto.RegisterType((*ServingWindow)(nil), "goupdate.admin.ServingWindow")
+	proto.RegisterType((*ListServingWindowsRequest)(nil), "goupdate.admin.ListServingWindowsRequest")
+	proto.RegisterType((*ListServingWindowsResponse)(nil), "goupdate.admin.ListServingWindowsResponse")
+	proto.RegisterType((*DeleteServingWindowRequest)(nil), "goupdate.admin.DeleteServingWindowRequest")
+	proto.RegisterType((*DeleteServingWindowResponse)(nil), "goupdate.admin.DeleteServingWindowResponse")
+	proto.RegisterType((*ExtensionStats)(nil), "goupdate.admin.ExtensionStats")
+	proto.RegisterType((*GetExtensionStatsRequest)(nil), "goupdate.admin.GetExtensionStatsRequest")
+	proto.RegisterType((*ExtensionStatsReport)(nil), "goupdate.admin.ExtensionStatsReport")
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// Client API for Admin service
+
+type AdminClient interface {
+	// ListExtensions returns the catalog sorted by ID
+	ListExtensions(ctx context.Context, in *ListExtensionsRequest, opts ...grpc.CallOption) (*ListExtensionsResponse, error)
+	// GetExtension returns the catalog entry of one extension
+	GetExtension(ctx context.Context, in *GetExtensionRequest, opts ...grpc.CallOption) (*Extension, error)
+	// UploadExtension publishes a CRX as a new version of an extension
+	UploadExtension(ctx context.Context, in *UploadExtensionRequest, opts ...grpc.CallOption) (*Extension, error)
+	// DeleteExtension removes an extension from the catalog
+	DeleteExtension(ctx context.Context, in *DeleteExtensionRequest, opts ...grpc.CallOption) (*DeleteExtensionResponse, error)
+	// BlacklistExtension stops or resumes offering updates for an extension
+	BlacklistExtension(ctx context.Context, in *BlacklistExtensionRequest, opts ...grpc.CallOption) (*Extension, error)
+	// RefreshCatalog reloads the catalog from its store now rather than at the next refresh interval
+	RefreshCatalog(ctx context.Context, in *RefreshCatalogRequest, opts ...grpc.CallOption) (*RefreshCatalogResponse, error)
+	// ReloadConfig reloads the configuration of the server
+	ReloadConfig(ctx context.Context, in *ReloadConfigRequest, opts ...grpc.CallOption) (*ReloadConfigResponse, error)
+	// GetMaintenance and SetMaintenance control maintenance mode, which holds back every update
+	GetMaintenance(ctx context.Context, in *GetMaintenanceRequest, opts ...grpc.CallOption) (*MaintenanceStatus, error)
+	SetMaintenance(ctx context.Context, in *SetMaintenanceRequest, opts ...grpc.CallOption) (*MaintenanceStatus, error)
+	// ListServingWindows, PutServingWindow and DeleteServingWindow control when updates for each extension are offered
+	ListServingWindows(ctx context.Context, in *ListServingWindowsRequest, opts ...grpc.CallOption) (*ListServingWindowsResponse, error)
+	PutServingWindow(ctx context.Context, in *ServingWindow, opts ...grpc.CallOption) (*ServingWindow, error)
+	DeleteServingWindow(ctx context.Context, in *DeleteServingWindowRequest, opts ...grpc.CallOption) (*DeleteServingWindowResponse, error)
+	// GetExtensionStats counts the updates served and downloads of every extension version since the server started
+	GetExtensionStats(ctx context.Context, in *GetExtensionStatsRequest, opts ...grpc.CallOption) (*ExtensionStatsReport, error)
+}
+
+type adminClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewAdminClient(cc *grpc.ClientConn) AdminClient {
+	return &adminClient{cc}
+}
+
+func (c *adminClient) ListExtensions(ctx context.Context, in *ListExtensionsRequest, opts ...grpc.CallOption) (*ListExtensionsResponse, error) {
+	out := new(ListExtensionsResponse)
+	err := grpc.Invoke(ctx, "/goupdate.admin.Admin/ListExtensions", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) GetExtension(ctx context.Context, in *GetExtensionRequest, opts ...grpc.CallOption) (*Extension, error) {
+	out := new(Extension)
+	err := grpc.Invoke(ctx, "/goupdate.admin.Admin/GetExtension", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) UploadExtension(ctx context.Context, in *UploadExtensionRequest, opts ...grpc.CallOption) (*Extension, error) {
+	out := new(Extension)
+	err := grpc.Invoke(ctx, "/goupdate.admin.Admin/UploadExtension", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) DeleteExtension(ctx context.Context, in *DeleteExtensionRequest, opts ...grpc.CallOption) (*DeleteExtensionResponse, error) {
+	out := new(DeleteExtensionResponse)
+	err := grpc.Invoke(ctx, "/goupdate.admin.Admin/DeleteExtension", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) BlacklistExtension(ctx context.Context, in *BlacklistExtensionRequest, opts ...grpc.CallOption) (*Extension, error) {
+	out := new(Extension)
+	err := grpc.Invoke(ctx, "/goupdate.admin.Admin/BlacklistExtension", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) RefreshCatalog(ctx context.Context, in *RefreshCatalogRequest, opts ...grpc.CallOption) (*RefreshCatalogResponse, error) {
+	out := new(RefreshCatalogResponse)
+	err := grpc.Invoke(ctx, "/goupdate.admin.Admin/RefreshCatalog", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ReloadConfig(ctx context.Context, in *ReloadConfigRequest, opts ...grpc.CallOption) (*ReloadConfigResponse, error) {
+	out := new(ReloadConfigResponse)
+	err := grpc.Invoke(ctx, "/goupdate.admin.Admin/ReloadConfig", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) GetMaintenance(ctx context.Context, in *GetMaintenanceRequest, opts ...grpc.CallOption) (*MaintenanceStatus, error) {
+	out := new(MaintenanceStatus)
+	err := grpc.Invoke(ctx, "/goupdate.admin.Admin/GetMaintenance", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) SetMaintenance(ctx context.Context, in *SetMaintenanceRequest, opts ...grpc.CallOption) (*MaintenanceStatus, error) {
+	out := new(MaintenanceStatus)
+	err := grpc.Invoke(ctx, "/goupdate.admin.Admin/SetMaintenance", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ListServingWindows(ctx context.Context, in *ListServingWindowsRequest, opts ...grpc.CallOption) (*ListServingWindowsResponse, error) {
+	out := new(ListServingWindowsResponse)
+	err := grpc.Invoke(ctx, "/goupdate.admin.Admin/ListServingWindows", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) PutServingWindow(ctx context.Context, in *ServingWindow, opts ...grpc.CallOption) (*ServingWindow, error) {
+	out := new(ServingWindow)
+	err := grpc.Invoke(ctx, "/goupdate.admin.Admin/PutServingWindow", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) DeleteServingWindow(ctx context.Context, in *DeleteServingWindowRequest, opts ...grpc.CallOption) (*DeleteServingWindowResponse, error) {
+	out := new(DeleteServingWindowResponse)
+	err := grpc.Invoke(ctx, "/goupdate.admin.Admin/DeleteServingWindow", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) GetExtensionStats(ctx context.Context, in *GetExtensionStatsRequest, opts ...grpc.CallOption) (*ExtensionStatsReport, error) {
+	out := new(ExtensionStatsReport)
+	err := grpc.Invoke(ctx, "/goupdate.admin.Admin/GetExtensionStats", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for Admin service
+
+type AdminServer interface {
+	// ListExtensions returns the catalog sorted by ID
+	ListExtensions(context.Context, *ListExtensionsRequest) (*ListExtensionsResponse, error)
+	// GetExtension returns the catalog entry of one extension
+	GetExtension(context.Context, *GetExtensionRequest) (*Extension, error)
+	// UploadExtension publishes a CRX as a new version of an extension
+	UploadExtension(context.Context, *UploadExtensionRequest) (*Extension, error)
+	// DeleteExtension removes an extension from the catalog
+	DeleteExtension(context.Context, *DeleteExtensionRequest) (*DeleteExtensionResponse, error)
+	// BlacklistExtension stops or resumes offering updates for an extension
+	BlacklistExtension(context.Context, *BlacklistExtensionRequest) (*Extension, error)
+	// RefreshCatalog reloads the catalog from its store now rather than at the next refresh interval
+	RefreshCatalog(context.Context, *RefreshCatalogRequest) (*RefreshCatalogResponse, error)
+	// ReloadConfig reloads the configuration of the server
+	ReloadConfig(context.Context, *ReloadConfigRequest) (*ReloadConfigResponse, error)
+	// GetMaintenance and SetMaintenance control maintenance mode, which holds back every update
+	GetMaintenance(context.Context, *GetMaintenanceRequest) (*MaintenanceStatus, error)
+	SetMaintenance(context.Context, *SetMaintenanceRequest) (*MaintenanceStatus, error)
+	// ListServingWindows, PutServingWindow and DeleteServingWindow control when updates for each extension are offered
+	ListServingWindows(context.Context, *ListServingWindowsRequest) (*ListServingWindowsResponse, error)
+	PutServingWindow(context.Context, *ServingWindow) (*ServingWindow, error)
+	DeleteServingWindow(context.Context, *DeleteServingWindowRequest) (*DeleteServingWindowResponse, error)
+	// GetExtensionStats counts the updates served and downloads of every extension version since the server started
+	GetExtensionStats(context.Context, *GetExtensionStatsRequest) (*ExtensionStatsReport, error)
+}
+
+func RegisterAdminServer(s *grpc.Server, srv AdminServer) {
+	s.RegisterService(&_Admin_serviceDesc, srv)
+}
+
+func _Admin_ListExtensions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListExtensionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ListExtensions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/goupdate.admin.Admin/ListExtensions",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ListExtensions(ctx, req.(*ListExtensionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_GetExtension_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetExtensionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).GetExtension(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/goupdate.admin.Admin/GetExtension",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).GetExtension(ctx, req.(*GetExtensionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_UploadExtension_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UploadExtensionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).UploadExtension(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/goupdate.admin.Admin/UploadExtension",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).UploadExtension(ctx, req.(*UploadExtensionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_DeleteExtension_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteExtensionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).DeleteExtension(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/goupdate.admin.Admin/DeleteExtension",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).DeleteExtension(ctx, req.(*DeleteExtensionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_BlacklistExtension_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BlacklistExtensionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).BlacklistExtension(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/goupdate.admin.Admin/BlacklistExtension",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).BlacklistExtension(ctx, req.(*BlacklistExtensionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_RefreshCatalog_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RefreshCatalogRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).RefreshCatalog(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/goupdate.admin.Admin/RefreshCatalog",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).RefreshCatalog(ctx, req.(*RefreshCatalogRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ReloadConfig_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReloadConfigRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ReloadConfig(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/goupdate.admin.Admin/ReloadConfig",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ReloadConfig(ctx, req.(*ReloadConfigRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_GetMaintenance_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetMaintenanceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).GetMaintenance(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/goupdate.admin.Admin/GetMaintenance",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).GetMaintenance(ctx, req.(*GetMaintenanceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_SetMaintenance_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetMaintenanceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).SetMaintenance(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/goupdate.admin.Admin/SetMaintenance",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).SetMaintenance(ctx, req.(*SetMaintenanceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ListServingWindows_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListServingWindowsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ListServingWindows(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/goupdate.admin.Admin/ListServingWindows",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ListServingWindows(ctx, req.(*ListServingWindowsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_PutServingWindow_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ServingWindow)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).PutServingWindow(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/goupdate.admin.Admin/PutServingWindow",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).PutServingWindow(ctx, req.(*ServingWindow))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_DeleteServingWindow_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteServingWindowRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).DeleteServingWindow(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/goupdate.admin.Admin/DeleteServingWindow",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).DeleteServingWindow(ctx, req.(*DeleteServingWindowRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_GetExtensionStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetExtensionStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).GetExtensionStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/goupdate.admin.Admin/GetExtensionStats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).GetExtensionStats(ctx, req.(*GetExtensionStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Admin_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "goupdate.admin.Admin",
+	HandlerType: (*AdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListExtensions",
+			Handler:    _Admin_ListExtensions_Handler,
+		},
+		{
+			MethodName: "GetExtension",
+			Handler:    _Admin_GetExtension_Handler,
+		},
+		{
+			MethodName: "UploadExtension",
+			Handler:    _Admin_UploadExtension_Handler,
+		},
+		{
+			MethodName: "DeleteExtension",
+			Handler:    _Admin_DeleteExtension_Handler,
+		},
+		{
+			MethodName: "BlacklistExtension",
+			Handler:    _Admin_BlacklistExtension_Handler,
+		},
+		{
+			MethodName: "RefreshCatalog",
+			Handler:    _Admin_RefreshCatalog_Handler,
+		},
+		{
+			MethodName: "ReloadConfig",
+			Handler:    _Admin_ReloadConfig_Handler,
+		},
+		{
+			MethodName: "GetMaintenance",
+			Handler:    _Admin_GetMaintenance_Handler,
+		},
+		{
+			MethodName: "SetMaintenance",
+			Handler:    _Admin_SetMaintenance_Handler,
+		},
+		{
+			MethodName: "ListServingWindows",
+			Handler:    _Admin_ListServingWindows_Handler,
+		},
+		{
+			MethodName: "PutServingWindow",
+			Handler:    _Admin_PutServingWindow_Handler,
+		},
+		{
+			MethodName: "DeleteServingWindow",
+			Handler:    _Admin_DeleteServingWindow_Handler,
+		},
+		{
+			MethodName: "GetExtensionStats",
+			Handler:    _Admin_GetExtensionStats_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "adminrpc/admin.proto",
+}
+
+func init() { proto.RegisterFile("adminrpc/admin.proto", fileDescriptor_admin_655012fc55a6269c) }
+
+var fileDescriptor_admin_655012fc55a6269c = []byte{
+	// 908 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x96, 0xdf, 0x72, 0xdb, 0x44,
+	0x14, 0xc6, 0xc7, 0x56, 0x9d, 0x44, 0x27, 0xa9, 0x9a, 0x6e, 0x1c, 0x57, 0x51, 0x08, 0x98, 0x85,
+	0x16, 0x13, 0x98, 0x74, 0x08, 0x03, 0x1d, 0x2e, 0x60, 0x48, 0x0b, 0xd3, 0x1b, 0xe8, 0x74, 0x64,
+	0x3a, 0x0c, 0xb9, 0xf1, 0xc8, 0xd2, 0x49, 0xb2, 0x53, 0x75, 0x25, 0xb4, 0xeb, 0xa4, 0xf4, 0x86,
+	0xc7, 0xe1, 0x49, 0x78, 0x05, 0x9e, 0x87, 0xd9, 0xd5, 0xca, 0xd1, 0x3f, 0xdb, 0x69, 0xee, 0xb4,
+	0xdf, 0x9e, 0x3d, 0x3e, 0x7b, 0xce, 0xb7, 0xbf, 0x31, 0xf4, 0x83, 0xe8, 0x0d, 0xe3, 0x59, 0x1a,
+	0x3e, 0xd6, 0x1f, 0x47, 0x69, 0x96, 0xc8, 0x84, 0x38, 0xe7, 0xc9, 0x2c, 0x8d, 0x02, 0x89, 0x47,
+	0x5a, 0xa5, 0xff, 0x74, 0xc1, 0xfe, 0xf9, 0xad, 0x44, 0x2e, 0x58, 0xc2, 0x89, 0x03, 0x5d, 0x16,
+	0xb9, 0x9d, 0x61, 0x67, 0x64, 0xfb, 0x5d, 0x16, 0x11, 0x17, 0xd6, 0x2f, 0x31, 0x53, 0x5b, 0x6e,
+	0x57, 0x8b, 0xc5, 0x92, 0x0c, 0x60, 0x4d, 0x5c, 0x04, 0xc7, 0xdf, 0x7c, 0xeb, 0x5a, 0x7a, 0xc3,
+	0xac, 0x48, 0x1f, 0x7a, 0x92, 0xc9, 0x18, 0xdd, 0x3b, 0x5a, 0xce, 0x17, 0x64, 0x1b, 0xac, 0x59,
+	0x16, 0xbb, 0x3d, 0xad, 0xa9, 0x4f, 0x32, 0x84, 0xcd, 0x69, 0x1c, 0x84, 0xaf, 0x63, 0x26, 0x24,
+	0x46, 0xee, 0xda, 0xb0, 0x33, 0xda, 0xf0, 0xcb, 0x12, 0x21, 0x70, 0x47, 0xb0, 0x77, 0xe8, 0xae,
+	0x0f, 0x3b, 0x23, 0xcb, 0xd7, 0xdf, 0x84, 0xc2, 0x56, 0x84, 0x29, 0xf2, 0x08, 0x79, 0xc8, 0x50,
+	0xb8, 0x1b, 0x43, 0x6b, 0x64, 0xfb, 0x15, 0x8d, 0x3c, 0x01, 0x5b, 0x84, 0x17, 0x18, 0xcd, 0x62,
+	0x8c, 0x5c, 0x7b, 0xd8, 0x19, 0x6d, 0x1e, 0xef, 0x1d, 0x55, 0x6f, 0x7d, 0x34, 0xbf, 0xb1, 0x7f,
+	0x1d, 0x4b, 0x0e, 0x00, 0xd2, 0xd9, 0x34, 0x66, 0xe2, 0x62, 0x12, 0x48, 0x17, 0x74, 0xad, 0xb6,
+	0x51, 0x4e, 0x24, 0x7d, 0x0c, 0xbb, 0xbf, 0x30, 0x21, 0xe7, 0x47, 0x85, 0x8f, 0x7f, 0xce, 0x50,
+	0x48, 0xd5, 0x0a, 0x89, 0x3c, 0xe0, 0xd2, 0x34, 0xce, 0xac, 0xe8, 0x18, 0x06, 0xf5, 0x03, 0x22,
+	0x4d, 0xb8, 0x40, 0xf2, 0x1d, 0x00, 0xce, 0x55, 0xb7, 0x33, 0xb4, 0x96, 0xd7, 0x58, 0x0a, 0xa6,
+	0xdf, 0xc3, 0xce, 0x73, 0xbc, 0xce, 0xb9, 0xa2, 0x06, 0x33, 0xd0, 0x6e, 0x31, 0x50, 0xfa, 0x6f,
+	0x07, 0x06, 0xaf, 0xd2, 0x38, 0x09, 0xa2, 0xdb, 0xa6, 0x28, 0x7b, 0xc2, 0xaa, 0x7a, 0x62, 0x1b,
+	0xac, 0x30, 0x7b, 0xab, 0x27, 0xbf, 0xe5, 0xab, 0xcf, 0x5a, 0x4b, 0x7b, 0xb5, 0x96, 0x5e, 0x9b,
+	0x65, 0xad, 0x6c, 0x96, 0xfa, 0x90, 0xd7, 0x9b, 0x43, 0xa6, 0x3f, 0xc2, 0xe0, 0x27, 0x8c, 0x51,
+	0xe2, 0xad, 0x3b, 0xb1, 0x07, 0x0f, 0x1a, 0x19, 0xf2, 0xf1, 0x50, 0x84, 0xbd, 0xa7, 0x85, 0x11,
+	0x6f, 0xdd, 0xa6, 0x9a, 0xc1, 0xad, 0x86, 0xc1, 0x95, 0xa1, 0x7c, 0x3c, 0xcb, 0x50, 0x5c, 0x3c,
+	0x0b, 0x64, 0x10, 0x27, 0xe7, 0xab, 0x0c, 0xe5, 0xc2, 0xa0, 0x7e, 0xc0, 0x54, 0xbc, 0x0b, 0x3b,
+	0x3e, 0xaa, 0xa9, 0x3e, 0x4b, 0xf8, 0x19, 0x2b, 0x12, 0xd1, 0x01, 0xf4, 0xab, 0xb2, 0x09, 0x7f,
+	0x01, 0xf7, 0x7f, 0x0d, 0x18, 0xd7, 0x69, 0x43, 0x1c, 0xcb, 0x40, 0xce, 0x84, 0x9a, 0x2b, 0xf2,
+	0x60, 0xaa, 0x5e, 0x4d, 0x47, 0x17, 0x5b, 0x2c, 0xc9, 0x47, 0xb0, 0x99, 0xa1, 0xcc, 0xfe, 0x9a,
+	0x04, 0x67, 0x12, 0x33, 0x7d, 0xc7, 0x9e, 0x0f, 0x5a, 0x3a, 0x51, 0x0a, 0x7d, 0x00, 0xbb, 0xcf,
+	0x51, 0x96, 0x52, 0x16, 0x05, 0x7c, 0x05, 0xbb, 0xe3, 0xb6, 0x8d, 0xc5, 0x3f, 0x46, 0x23, 0xb8,
+	0x3b, 0xc6, 0xec, 0x92, 0xf1, 0xf3, 0xdf, 0x19, 0x8f, 0x92, 0xab, 0x06, 0x93, 0xfa, 0xd0, 0x13,
+	0x32, 0xc8, 0xa4, 0xe9, 0x75, 0xbe, 0x50, 0xde, 0x43, 0x1e, 0x19, 0x47, 0xaa, 0x4f, 0xb2, 0x0f,
+	0xb6, 0x64, 0x6f, 0x70, 0xf2, 0x2e, 0xe1, 0x05, 0x8d, 0x36, 0x94, 0x70, 0x9a, 0x70, 0xa4, 0xfb,
+	0xb0, 0xa7, 0xde, 0x66, 0xe5, 0x97, 0x8a, 0x07, 0x4d, 0x5f, 0x81, 0xd7, 0xb6, 0x69, 0x1e, 0xef,
+	0x13, 0x58, 0xbf, 0xca, 0x25, 0xf3, 0x72, 0x0f, 0xea, 0x2f, 0xb7, 0x72, 0xd0, 0x2f, 0xa2, 0xe9,
+	0x97, 0xe0, 0xe5, 0x8e, 0xab, 0xee, 0x9b, 0x8e, 0xd4, 0xae, 0x49, 0x0f, 0x60, 0xbf, 0x35, 0xda,
+	0x8c, 0xf0, 0x6f, 0x70, 0xe6, 0xd6, 0x54, 0x03, 0x14, 0xef, 0xc1, 0xee, 0x87, 0xe0, 0xe4, 0xf5,
+	0x8a, 0x89, 0xc0, 0xec, 0xd2, 0xb8, 0xd3, 0xf2, 0xef, 0x1a, 0x75, 0xac, 0x45, 0xf2, 0x01, 0xd8,
+	0x51, 0x72, 0xc5, 0x95, 0x7f, 0x84, 0x6e, 0xa0, 0xe5, 0x5f, 0x0b, 0xf4, 0x10, 0xdc, 0x32, 0x88,
+	0x74, 0x0d, 0x8b, 0xee, 0x12, 0x43, 0xbf, 0x1e, 0x98, 0x26, 0x99, 0x7e, 0xff, 0x82, 0xf1, 0x10,
+	0x4d, 0x68, 0xbe, 0x20, 0x3f, 0x54, 0xe8, 0xd8, 0xd5, 0x3d, 0xfe, 0x70, 0x21, 0x1d, 0xf3, 0x7c,
+	0xa5, 0x13, 0xc7, 0xff, 0xd9, 0xd0, 0x3b, 0x51, 0x41, 0x64, 0x02, 0x4e, 0x95, 0xc0, 0xe4, 0x61,
+	0x3d, 0x4f, 0x2b, 0xd2, 0xbd, 0x47, 0xab, 0xc2, 0x8c, 0x17, 0x5e, 0xc0, 0x56, 0xb9, 0x09, 0xe4,
+	0x93, 0xfa, 0xb9, 0x16, 0x56, 0x7b, 0x8b, 0x49, 0x4f, 0x7e, 0x83, 0x7b, 0x35, 0x3a, 0x93, 0x46,
+	0x29, 0xed, 0xf8, 0x5e, 0x96, 0x75, 0x0a, 0xf7, 0x6a, 0xa8, 0x6b, 0x66, 0x6d, 0xa7, 0xa9, 0xf7,
+	0xd9, 0xca, 0x38, 0xd3, 0x89, 0x53, 0x20, 0x4d, 0x66, 0x92, 0xcf, 0xeb, 0xc7, 0x17, 0x72, 0x75,
+	0x59, 0xfd, 0x13, 0x70, 0xaa, 0xdc, 0x6b, 0x8e, 0xb1, 0x15, 0xa4, 0xde, 0xa3, 0x55, 0x61, 0xa6,
+	0xf8, 0x3f, 0x60, 0xab, 0xcc, 0xc9, 0xe6, 0x18, 0x5b, 0xe0, 0xea, 0x7d, 0xba, 0x3c, 0x68, 0xde,
+	0x17, 0xa7, 0x8a, 0xc6, 0x66, 0xed, 0xad, 0xe8, 0xf4, 0x3e, 0xae, 0x87, 0x35, 0x89, 0x7d, 0x0a,
+	0xce, 0x78, 0x45, 0xee, 0xf1, 0x6d, 0x73, 0xbf, 0x06, 0xd2, 0x64, 0x60, 0x73, 0x9e, 0x0b, 0x21,
+	0xea, 0x1d, 0xde, 0x24, 0xd4, 0x34, 0xe9, 0x25, 0x6c, 0xbf, 0x9c, 0x55, 0x37, 0xc9, 0x72, 0xaa,
+	0x7a, 0xcb, 0xb7, 0x09, 0x87, 0x9d, 0x16, 0x7a, 0x92, 0xc3, 0x76, 0x3b, 0xb7, 0x01, 0xd9, 0xfb,
+	0xe2, 0x46, 0xb1, 0xe6, 0x06, 0x21, 0xdc, 0x6f, 0xd0, 0x90, 0x8c, 0x96, 0xd1, 0xa0, 0x0c, 0xcc,
+	0xa6, 0x97, 0xda, 0x70, 0xf9, 0x14, 0x4e, 0x37, 0x8a, 0xff, 0xf4, 0xd3, 0x35, 0xfd, 0x77, 0xfe,
+	0xeb, 0xff, 0x07, 0x00, 0xec, 0x83, 0x07, 0xdf, 0xe6, 0x0b, 0x00, 0x00,
+}
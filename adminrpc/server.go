@@ -0,0 +1,288 @@
+// Package adminrpc serves the admin and stats APIs over gRPC, as described by admin.proto.
+// Calls are authorized with controller.AuthorizeAdmin and served by controller.AdminService, like the REST handlers,
+// so authorization, auditing and validation are the same for both.
+package adminrpc
+
+import (
+	"bytes"
+	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/extension"
+	"github.com/pressly/lg"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Server implements AdminServer with the admin operations of the controller
+type Server struct {
+	logger  *logrus.Logger
+	options *controller.Options
+	admin   controller.AdminService
+}
+
+// NewServer creates a Server logging to logger, which serves the catalogs of opts like the routers given them,
+// or the package's catalogs if opts is nil
+func NewServer(logger *logrus.Logger, opts *controller.Options) *Server {
+	return &Server{logger: logger, options: opts}
+}
+
+// authorize authorizes a call with the bearer token in its authorization metadata for the catalog of tenant,
+// or the default catalog if it is empty. Calls which change anything need write to be true.
+// It returns the context the call is served with.
+func (s *Server) authorize(ctx context.Context, tenant string, write bool) (context.Context, error) {
+	ctx = controller.WithOptionsContext(lg.WithLoggerContext(ctx, s.logger), s.options)
+	token := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if authorization := md.Get("authorization"); len(authorization) != 0 {
+			if len(authorization[0]) > 7 && strings.EqualFold(authorization[0][:7], "bearer ") {
+				token = authorization[0][7:]
+			}
+		}
+	}
+	var t *controller.Tenant
+	if len(tenant) != 0 {
+		t = s.options.TenantNamed(tenant)
+		if t == nil {
+			return ctx, status.Errorf(codes.NotFound, "Tenant %s doesn't exist", tenant)
+		}
+	}
+	ctx, err := controller.AuthorizeAdmin(ctx, t, token, write)
+	if err != nil {
+		return ctx, grpcError(err)
+	}
+	return ctx, nil
+}
+
+// grpcError is the gRPC status of an admin operation which failed with err
+func grpcError(err error) error {
+	return status.Error(statusCode(controller.AdminErrorStatus(err)), err.Error())
+}
+
+// statusCode is the gRPC code of an HTTP error status
+func statusCode(code int) codes.Code {
+	switch code {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusRequestEntityTooLarge, http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	default:
+		return codes.Internal
+	}
+}
+
+func fromExtension(ext extension.Extension) *Extension {
+	converted := &Extension{
+		Id:           ext.ID,
+		Version:      ext.Version,
+		Sha256:       ext.SHA256,
+		Title:        ext.Title,
+		Url:          ext.URL,
+		Blacklisted:  ext.Blacklisted,
+		Size:         ext.Size,
+		Dependencies: ext.Dependencies,
+	}
+	if ext.Scheduled != nil {
+		converted.Scheduled = fromExtension(*ext.Scheduled)
+	}
+	if ext.PublishAt != nil {
+		converted.PublishAt = ext.PublishAt.Format(time.RFC3339)
+	}
+	return converted
+}
+
+func fromServingWindow(window controller.ServingWindow) *ServingWindow {
+	return &ServingWindow{Id: window.ID, Start: window.Start, End: window.End, TimeZone: window.TimeZone}
+}
+
+func fromMaintenanceStatus(maintenance controller.MaintenanceStatus) *MaintenanceStatus {
+	return &MaintenanceStatus{Enabled: maintenance.Enabled, RetryAfter: int32(maintenance.RetryAfter)}
+}
+
+// ListExtensions returns the catalog sorted by ID
+func (s *Server) ListExtensions(ctx context.Context, req *ListExtensionsRequest) (*ListExtensionsResponse, error) {
+	ctx, err := s.authorize(ctx, req.Tenant, false)
+	if err != nil {
+		return nil, err
+	}
+	response := &ListExtensionsResponse{}
+	for _, ext := range s.admin.ListExtensions(ctx) {
+		response.Extensions = append(response.Extensions, fromExtension(ext))
+	}
+	return response, nil
+}
+
+// GetExtension returns the catalog entry of one extension
+func (s *Server) GetExtension(ctx context.Context, req *GetExtensionRequest) (*Extension, error) {
+	ctx, err := s.authorize(ctx, req.Tenant, false)
+	if err != nil {
+		return nil, err
+	}
+	ext, err := s.admin.GetExtension(ctx, req.Id)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return fromExtension(ext), nil
+}
+
+// UploadExtension publishes a CRX as a new version of an extension
+func (s *Server) UploadExtension(ctx context.Context, req *UploadExtensionRequest) (*Extension, error) {
+	ctx, err := s.authorize(ctx, req.Tenant, true)
+	if err != nil {
+		return nil, err
+	}
+	upload := controller.Upload{ID: req.Id, Version: req.Version, PublishAt: req.PublishAt, Title: req.Title}
+	if len(req.Dependencies) != 0 {
+		upload.Dependencies = req.Dependencies
+	}
+	ext, err := s.admin.UploadExtension(ctx, upload, bytes.NewReader(req.Crx))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return fromExtension(ext), nil
+}
+
+// DeleteExtension removes an extension from the catalog
+func (s *Server) DeleteExtension(ctx context.Context, req *DeleteExtensionRequest) (*DeleteExtensionResponse, error) {
+	ctx, err := s.authorize(ctx, req.Tenant, true)
+	if err != nil {
+		return nil, err
+	}
+	err = s.admin.DeleteExtension(ctx, req.Id)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &DeleteExtensionResponse{}, nil
+}
+
+// BlacklistExtension stops or resumes offering updates for an extension
+func (s *Server) BlacklistExtension(ctx context.Context, req *BlacklistExtensionRequest) (*Extension, error) {
+	ctx, err := s.authorize(ctx, req.Tenant, true)
+	if err != nil {
+		return nil, err
+	}
+	ext, err := s.admin.BlacklistExtension(ctx, req.Id, req.Blacklisted)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return fromExtension(ext), nil
+}
+
+// RefreshCatalog reloads the catalog from its store
+func (s *Server) RefreshCatalog(ctx context.Context, req *RefreshCatalogRequest) (*RefreshCatalogResponse, error) {
+	ctx, err := s.authorize(ctx, req.Tenant, true)
+	if err != nil {
+		return nil, err
+	}
+	err = s.admin.RefreshCatalog(ctx)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &RefreshCatalogResponse{}, nil
+}
+
+// ReloadConfig reloads the configuration of the server
+func (s *Server) ReloadConfig(ctx context.Context, req *ReloadConfigRequest) (*ReloadConfigResponse, error) {
+	ctx, err := s.authorize(ctx, "", true)
+	if err != nil {
+		return nil, err
+	}
+	err = s.admin.ReloadConfig(ctx)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &ReloadConfigResponse{}, nil
+}
+
+// GetMaintenance checks whether maintenance mode is enabled
+func (s *Server) GetMaintenance(ctx context.Context, req *GetMaintenanceRequest) (*MaintenanceStatus, error) {
+	ctx, err := s.authorize(ctx, "", false)
+	if err != nil {
+		return nil, err
+	}
+	return fromMaintenanceStatus(s.admin.Maintenance(ctx)), nil
+}
+
+// SetMaintenance enables or disables maintenance mode
+func (s *Server) SetMaintenance(ctx context.Context, req *SetMaintenanceRequest) (*MaintenanceStatus, error) {
+	ctx, err := s.authorize(ctx, "", true)
+	if err != nil {
+		return nil, err
+	}
+	maintenance, err := s.admin.SetMaintenance(ctx, req.Enabled)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return fromMaintenanceStatus(maintenance), nil
+}
+
+// ListServingWindows lists the serving windows
+func (s *Server) ListServingWindows(ctx context.Context, req *ListServingWindowsRequest) (*ListServingWindowsResponse, error) {
+	ctx, err := s.authorize(ctx, "", false)
+	if err != nil {
+		return nil, err
+	}
+	response := &ListServingWindowsResponse{}
+	for _, window := range s.admin.ServingWindows(ctx) {
+		response.Windows = append(response.Windows, fromServingWindow(window))
+	}
+	return response, nil
+}
+
+// PutServingWindow only offers updates for an extension within a window
+func (s *Server) PutServingWindow(ctx context.Context, req *ServingWindow) (*ServingWindow, error) {
+	ctx, err := s.authorize(ctx, "", true)
+	if err != nil {
+		return nil, err
+	}
+	window, err := s.admin.PutServingWindow(ctx, controller.ServingWindow{ID: req.Id, Start: req.Start, End: req.End, TimeZone: req.TimeZone})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return fromServingWindow(window), nil
+}
+
+// DeleteServingWindow offers updates for an extension at any time
+func (s *Server) DeleteServingWindow(ctx context.Context, req *DeleteServingWindowRequest) (*DeleteServingWindowResponse, error) {
+	ctx, err := s.authorize(ctx, "", true)
+	if err != nil {
+		return nil, err
+	}
+	err = s.admin.DeleteServingWindow(ctx, req.Id)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &DeleteServingWindowResponse{}, nil
+}
+
+// GetExtensionStats counts the updates served and downloads of every extension version
+func (s *Server) GetExtensionStats(ctx context.Context, req *GetExtensionStatsRequest) (*ExtensionStatsReport, error) {
+	ctx, err := s.authorize(ctx, "", false)
+	if err != nil {
+		return nil, err
+	}
+	stats := s.admin.ExtensionStats(ctx, req.Id)
+	report := &ExtensionStatsReport{Since: stats.Since.Format(time.RFC3339)}
+	for _, counts := range stats.Extensions {
+		report.Extensions = append(report.Extensions, &ExtensionStats{
+			Id: counts.ID, Version: counts.Version, UpdatesServed: counts.UpdatesServed, Downloads: counts.Downloads,
+		})
+	}
+	return report, nil
+}
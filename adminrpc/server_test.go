@@ -0,0 +1,180 @@
+package adminrpc
+
+import (
+	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/crx"
+	"github.com/brave/go-update/crx/crxtest"
+	"github.com/brave/go-update/extension"
+	"github.com/brave/go-update/memstore"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+var rpc *Server
+
+// rpcOptions are the options rpc serves calls with
+var rpcOptions *controller.Options
+
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "adminrpc")
+	if err != nil {
+		panic(err)
+	}
+	controller.ExtensionStore = memstore.New(extension.Extensions{})
+	settings := controller.DefaultSettings()
+	settings.AdminTokens = []string{"test-token"}
+	settings.ViewerTokens = []string{"viewer-token"}
+	settings.TenantAdminTokens = map[string][]string{"acme": {"acme-token"}}
+	controller.RegisterTenants(&controller.Tenant{Name: "acme", Store: memstore.New(extension.Extensions{})})
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	rpcOptions = &controller.Options{Settings: &settings, Audit: &controller.MemoryAuditLog{}, CRXDirectory: dir}
+	rpc = NewServer(logger, rpcOptions)
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func withToken(token string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+}
+
+func TestAuthorization(t *testing.T) {
+	_, err := rpc.ListExtensions(context.Background(), &ListExtensionsRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = rpc.ListExtensions(withToken("wrong-token"), &ListExtensionsRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// Viewers can only read
+	_, err = rpc.ListExtensions(withToken("viewer-token"), &ListExtensionsRequest{})
+	assert.Nil(t, err)
+	_, err = rpc.SetMaintenance(withToken("viewer-token"), &SetMaintenanceRequest{Enabled: true})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Contains(t, err.Error(), "The viewer role can only read")
+
+	// Tenants with their own tokens don't accept the global ones
+	_, err = rpc.ListExtensions(withToken("test-token"), &ListExtensionsRequest{Tenant: "acme"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = rpc.ListExtensions(withToken("acme-token"), &ListExtensionsRequest{Tenant: "acme"})
+	assert.Nil(t, err)
+	_, err = rpc.ListExtensions(withToken("acme-token"), &ListExtensionsRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = rpc.ListExtensions(withToken("test-token"), &ListExtensionsRequest{Tenant: "nobody"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestExtensions(t *testing.T) {
+	authorized := withToken("test-token")
+	key := crxtest.NewKey()
+	id := crx.IDFromPublicKey(crxtest.PublicKey(key))
+	payload := crxtest.BuildSignedCRX(key, []byte("PK archive"))
+	_, err := rpc.UploadExtension(authorized, &UploadExtensionRequest{Id: id, Version: "1.0.0", Crx: []byte("For the horde!")})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	uploaded, err := rpc.UploadExtension(authorized, &UploadExtensionRequest{
+		Id: id, Version: "1.0.0", Crx: payload, Title: "Over gRPC", Dependencies: []string{"ldimlcelhnjgpjjemdjokpgeeikdinbm"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "Over gRPC", uploaded.Title)
+	assert.Equal(t, []string{"ldimlcelhnjgpjjemdjokpgeeikdinbm"}, uploaded.Dependencies)
+	_, err = rpc.UploadExtension(authorized, &UploadExtensionRequest{Id: id, Version: "1.0.0", Crx: payload})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	catalog, err := rpc.ListExtensions(authorized, &ListExtensionsRequest{})
+	assert.Nil(t, err)
+	assert.Equal(t, controller.CurrentCatalog().Len(), len(catalog.Extensions))
+	ext, err := rpc.GetExtension(authorized, &GetExtensionRequest{Id: id})
+	assert.Nil(t, err)
+	assert.Equal(t, "1.0.0", ext.Version)
+	assert.Equal(t, uploaded.Sha256, ext.Sha256)
+	_, err = rpc.GetExtension(authorized, &GetExtensionRequest{Id: "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	// Blacklisting is saved to the store, so it survives a refresh
+	ext, err = rpc.BlacklistExtension(authorized, &BlacklistExtensionRequest{Id: id, Blacklisted: true})
+	assert.Nil(t, err)
+	assert.True(t, ext.Blacklisted)
+	_, err = rpc.RefreshCatalog(authorized, &RefreshCatalogRequest{})
+	assert.Nil(t, err)
+	ext, err = rpc.GetExtension(authorized, &GetExtensionRequest{Id: id})
+	assert.Nil(t, err)
+	assert.True(t, ext.Blacklisted)
+	ext, err = rpc.BlacklistExtension(authorized, &BlacklistExtensionRequest{Id: id, Blacklisted: false})
+	assert.Nil(t, err)
+	assert.False(t, ext.Blacklisted)
+	records, err := rpcOptions.Audit.Query(context.Background(), controller.AuditFilter{Action: controller.AuditBlacklist, Target: "extensions/" + id})
+	assert.Nil(t, err)
+	assert.Len(t, records, 1)
+
+	_, err = rpc.DeleteExtension(authorized, &DeleteExtensionRequest{Id: id})
+	assert.Nil(t, err)
+	_, err = rpc.GetExtension(authorized, &GetExtensionRequest{Id: id})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = rpc.RefreshCatalog(authorized, &RefreshCatalogRequest{})
+	assert.Nil(t, err)
+	_, err = rpc.GetExtension(authorized, &GetExtensionRequest{Id: id})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = rpc.DeleteExtension(authorized, &DeleteExtensionRequest{Id: id})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = rpc.BlacklistExtension(authorized, &BlacklistExtensionRequest{Id: id, Blacklisted: true})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestTenantExtensions(t *testing.T) {
+	authorized := withToken("acme-token")
+	key := crxtest.NewKey()
+	id := crx.IDFromPublicKey(crxtest.PublicKey(key))
+	_, err := rpc.UploadExtension(authorized, &UploadExtensionRequest{Tenant: "acme", Id: id, Version: "1.0.0", Crx: crxtest.BuildSignedCRX(key, []byte("PK archive"))})
+	assert.Nil(t, err)
+
+	// The tenant's catalog is separate from the default one
+	_, err = rpc.GetExtension(withToken("test-token"), &GetExtensionRequest{Id: id})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = rpc.BlacklistExtension(authorized, &BlacklistExtensionRequest{Tenant: "acme", Id: id, Blacklisted: true})
+	assert.Nil(t, err)
+	_, err = rpc.DeleteExtension(authorized, &DeleteExtensionRequest{Tenant: "acme", Id: id})
+	assert.Nil(t, err)
+	catalog, err := rpc.ListExtensions(authorized, &ListExtensionsRequest{Tenant: "acme"})
+	assert.Nil(t, err)
+	assert.Empty(t, catalog.Extensions)
+}
+
+func TestSettings(t *testing.T) {
+	authorized := withToken("test-token")
+	maintenance, err := rpc.SetMaintenance(authorized, &SetMaintenanceRequest{Enabled: true})
+	assert.Nil(t, err)
+	assert.True(t, maintenance.Enabled)
+	maintenance, err = rpc.GetMaintenance(authorized, &GetMaintenanceRequest{})
+	assert.Nil(t, err)
+	assert.True(t, maintenance.Enabled)
+	maintenance, err = rpc.SetMaintenance(authorized, &SetMaintenanceRequest{Enabled: false})
+	assert.Nil(t, err)
+	assert.False(t, maintenance.Enabled)
+
+	id := "aomjjhallfgjeglblehebfpbcfeobpgk"
+	window, err := rpc.PutServingWindow(authorized, &ServingWindow{Id: id, Start: "22:00", End: "06:00"})
+	assert.Nil(t, err)
+	assert.Equal(t, "22:00", window.Start)
+	_, err = rpc.PutServingWindow(authorized, &ServingWindow{Id: id, Start: "noon", End: "06:00"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	windows, err := rpc.ListServingWindows(authorized, &ListServingWindowsRequest{})
+	assert.Nil(t, err)
+	assert.Contains(t, windows.Windows, window)
+	_, err = rpc.DeleteServingWindow(authorized, &DeleteServingWindowRequest{Id: id})
+	assert.Nil(t, err)
+	_, err = rpc.DeleteServingWindow(authorized, &DeleteServingWindowRequest{Id: id})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = rpc.ReloadConfig(authorized, &ReloadConfigRequest{})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+
+	stats, err := rpc.GetExtensionStats(authorized, &GetExtensionStatsRequest{Id: id})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, stats.Since)
+}
@@ -0,0 +1,359 @@
+package cli
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/brave/go-update/config"
+	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/extension"
+	"github.com/brave/go-update/server"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// catalogCSVColumns are the columns of a CSV catalog. Scheduled versions aren't included, and are kept on import.
+var catalogCSVColumns = []string{"id", "version", "sha256", "title", "url", "blacklisted", "size", "dependencies"}
+
+// Catalog exports the catalog to a JSON or CSV file which can be reviewed, and imports a file back into the catalog:
+//
+//	go-update catalog export [-format json|csv] [-o file] [-tenant name] [server flags]
+//	go-update catalog import [-format json|csv] [-dry-run] [-tenant name] <file> [server flags]
+//
+// The store is the one the server would use with the same environment and server flags, like -store or -config.
+// Import creates and replaces records, printing the difference with the catalog, but never deletes any.
+func Catalog(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("usage: go-update catalog export|import [flags]")
+	}
+	switch args[0] {
+	case "export":
+		return catalogExport(args[1:], out)
+	case "import":
+		return catalogImport(args[1:], out)
+	default:
+		return fmt.Errorf("unknown catalog command %q, must be export or import", args[0])
+	}
+}
+
+// catalogStore creates the store of tenant as configured by the server flags in args
+func catalogStore(args []string, tenant string) (controller.Store, error) {
+	cfg, err := config.Load(args)
+	if err != nil {
+		return nil, err
+	}
+	return server.NewStore(cfg, tenant)
+}
+
+// catalogFormat returns format, or the format of path from its extension when it is empty
+func catalogFormat(format string, path string) (string, error) {
+	if len(format) == 0 {
+		format = "json"
+		if strings.EqualFold(filepath.Ext(path), ".csv") {
+			format = "csv"
+		}
+	}
+	if format != "json" && format != "csv" {
+		return "", fmt.Errorf("-format %q must be json or csv", format)
+	}
+	return format, nil
+}
+
+func catalogExport(args []string, out io.Writer) error {
+	fs := newFlagSet("catalog export", out)
+	format := fs.String("format", "", "json or csv, from the extension of -o by default")
+	path := fs.String("o", "", "file to write, standard output by default")
+	tenant := fs.String("tenant", "", "tenant whose catalog to export rather than the default catalog")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	*format, err = catalogFormat(*format, *path)
+	if err != nil {
+		return err
+	}
+	store, err := catalogStore(fs.Args(), *tenant)
+	if err != nil {
+		return err
+	}
+	// Invalid records are exported too, so they can be fixed and imported
+	extensions, err := store.LoadExtensions(context.Background())
+	if err != nil && !controller.IsValidationError(err) {
+		return err
+	}
+	if len(*path) == 0 {
+		return writeCatalog(out, extensions, *format)
+	}
+	f, err := os.Create(*path)
+	if err != nil {
+		return err
+	}
+	err = writeCatalog(f, extensions, *format)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeCatalog writes extensions sorted by ID, so exports of the same catalog are identical
+func writeCatalog(w io.Writer, extensions extension.Extensions, format string) error {
+	sorted := append(extension.Extensions{}, extensions...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].ID < sorted[j].ID
+	})
+	if format == "json" {
+		data, err := json.MarshalIndent(sorted, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(data, '\n'))
+		return err
+	}
+	writer := csv.NewWriter(w)
+	err := writer.Write(catalogCSVColumns)
+	if err != nil {
+		return err
+	}
+	for _, ext := range sorted {
+		err = writer.Write([]string{
+			ext.ID, ext.Version, ext.SHA256, ext.Title, ext.URL, strconv.FormatBool(ext.Blacklisted),
+			strconv.FormatInt(ext.Size, 10), strings.Join(ext.Dependencies, " "),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// readCatalogFile reads a JSON or CSV catalog, see readCatalogCSV for the columns returned
+func readCatalogFile(path string, format string) (extension.Extensions, []map[string]bool, error) {
+	if format == "json" {
+		// Both the v1 list and the v2 catalog object, like exports from the admin API, are read
+		extensions, err := controller.ManifestStore{Path: path}.LoadExtensions(context.Background())
+		return extensions, nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	return readCatalogCSV(f)
+}
+
+// readCatalogCSV reads a CSV catalog, returning the columns each record has. They are applied
+// on top of the current records, see mergeCSVRecord.
+func readCatalogCSV(r io.Reader) (extension.Extensions, []map[string]bool, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil, errors.New("the CSV file has no header")
+	}
+	header := rows[0]
+	for _, column := range header {
+		known := false
+		for _, name := range catalogCSVColumns {
+			known = known || column == name
+		}
+		if !known {
+			return nil, nil, fmt.Errorf("unknown CSV column %q", column)
+		}
+	}
+	extensions := extension.Extensions{}
+	columns := []map[string]bool{}
+	for i, row := range rows[1:] {
+		ext := extension.Extension{}
+		present := map[string]bool{}
+		for j, value := range row {
+			present[header[j]] = true
+			switch header[j] {
+			case "id":
+				ext.ID = value
+			case "version":
+				ext.Version = value
+			case "sha256":
+				ext.SHA256 = value
+			case "title":
+				ext.Title = value
+			case "url":
+				ext.URL = value
+			case "blacklisted":
+				ext.Blacklisted, err = strconv.ParseBool(value)
+			case "size":
+				if len(value) != 0 {
+					ext.Size, err = strconv.ParseInt(value, 10, 64)
+				}
+			case "dependencies":
+				ext.Dependencies = strings.Fields(value)
+			}
+			if err != nil {
+				return nil, nil, fmt.Errorf("line %d: invalid %s %q", i+2, header[j], value)
+			}
+		}
+		extensions = append(extensions, ext)
+		columns = append(columns, present)
+	}
+	return extensions, columns, nil
+}
+
+// mergeCSVRecord applies the columns of a CSV record to the current record of the extension,
+// so the fields a CSV file can't hold, like scheduled versions, are kept
+func mergeCSVRecord(current extension.Extension, record extension.Extension, columns map[string]bool) extension.Extension {
+	merged := current
+	merged.ID = record.ID
+	for column := range columns {
+		switch column {
+		case "version":
+			merged.Version = record.Version
+		case "sha256":
+			merged.SHA256 = record.SHA256
+		case "title":
+			merged.Title = record.Title
+		case "url":
+			merged.URL = record.URL
+		case "blacklisted":
+			merged.Blacklisted = record.Blacklisted
+		case "size":
+			merged.Size = record.Size
+		case "dependencies":
+			merged.Dependencies = record.Dependencies
+		}
+	}
+	return merged
+}
+
+func catalogImport(args []string, out io.Writer) error {
+	fs := newFlagSet("catalog import", out)
+	format := fs.String("format", "", "json or csv, from the extension of the file by default")
+	dryRun := fs.Bool("dry-run", false, "only print the difference with the catalog")
+	tenant := fs.String("tenant", "", "tenant whose catalog to import into rather than the default catalog")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("the file to import is required")
+	}
+	path := fs.Arg(0)
+	*format, err = catalogFormat(*format, path)
+	if err != nil {
+		return err
+	}
+	records, columns, err := readCatalogFile(path, *format)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %v", path, err)
+	}
+	store, err := catalogStore(fs.Args()[1:], *tenant)
+	if err != nil {
+		return err
+	}
+	return importCatalog(context.Background(), store, records, columns, *dryRun, out)
+}
+
+// importCatalog saves each record which differs from the catalog in store, printing the differences.
+// columns are those each record has when it was read from a CSV file, or nil for complete records.
+func importCatalog(ctx context.Context, store controller.Store, records extension.Extensions, columns []map[string]bool, dryRun bool, out io.Writer) error {
+	current, err := store.LoadExtensions(ctx)
+	if err != nil && !controller.IsValidationError(err) {
+		return err
+	}
+	catalog := extension.LoadExtensionsIntoMap(&current)
+	seen := map[string]bool{}
+	for i, record := range records {
+		if len(record.ID) == 0 || len(record.Version) == 0 {
+			return fmt.Errorf("record %d has no id or version", i+1)
+		}
+		if seen[record.ID] {
+			return fmt.Errorf("%s is in the file more than once", record.ID)
+		}
+		seen[record.ID] = true
+	}
+
+	added, changed, unchanged := 0, 0, 0
+	for i, record := range records {
+		existing, ok := catalog[record.ID]
+		if ok && columns != nil {
+			record = mergeCSVRecord(existing, record, columns[i])
+		}
+		switch {
+		case !ok:
+			added++
+			fmt.Fprintf(out, "+ %s %s %s\n", record.ID, record.Version, record.Title)
+		case reflect.DeepEqual(normalizeRecord(existing), normalizeRecord(record)):
+			unchanged++
+			continue
+		default:
+			changed++
+			fmt.Fprintf(out, "~ %s\n", record.ID)
+			for _, difference := range recordDifferences(existing, record) {
+				fmt.Fprintf(out, "    %s\n", difference)
+			}
+		}
+		if dryRun {
+			continue
+		}
+		err = store.SaveExtension(ctx, record)
+		if controller.IsValidationError(err) {
+			return fmt.Errorf("%s is invalid, stopping the import: %v", record.ID, err)
+		}
+		if err != nil {
+			return fmt.Errorf("error saving %s: %v", record.ID, err)
+		}
+	}
+	for _, ext := range current {
+		if !seen[ext.ID] {
+			fmt.Fprintf(out, "  %s is only in the catalog and is left alone\n", ext.ID)
+		}
+	}
+	verb := "imported"
+	if dryRun {
+		verb = "would be imported"
+	}
+	fmt.Fprintf(out, "%d added, %d changed and %d unchanged extensions %s\n", added, changed, unchanged, verb)
+	return nil
+}
+
+// normalizeRecord returns the JSON fields of a record, which is how records are compared
+func normalizeRecord(ext extension.Extension) map[string]interface{} {
+	data, _ := json.Marshal(ext)
+	fields := map[string]interface{}{}
+	_ = json.Unmarshal(data, &fields)
+	return fields
+}
+
+// recordDifferences describes each JSON field which differs between two records of an extension
+func recordDifferences(before extension.Extension, after extension.Extension) []string {
+	beforeFields, afterFields := normalizeRecord(before), normalizeRecord(after)
+	names := []string{}
+	for name := range beforeFields {
+		names = append(names, name)
+	}
+	for name := range afterFields {
+		if _, ok := beforeFields[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	differences := []string{}
+	for _, name := range names {
+		if reflect.DeepEqual(beforeFields[name], afterFields[name]) {
+			continue
+		}
+		beforeValue, _ := json.Marshal(beforeFields[name])
+		afterValue, _ := json.Marshal(afterFields[name])
+		differences = append(differences, fmt.Sprintf("%s: %s -> %s", name, beforeValue, afterValue))
+	}
+	return differences
+}
@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"github.com/brave/go-update/extension"
+	"github.com/brave/go-update/memstore"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCatalogExportAndImport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-update-catalog")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+	publishAt := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	theme := extension.Extension{
+		ID: "bfdgpgibhagkpdlnjonhkabjoijopoge", Version: "1.0.0", SHA256: strings.Repeat("a", 64), Title: "Theme",
+		Dependencies: []string{"aomjjhallfgjeglblehebfpbcfeobpgk"},
+		Scheduled:    &extension.Extension{ID: "bfdgpgibhagkpdlnjonhkabjoijopoge", Version: "1.1.0", SHA256: strings.Repeat("b", 64), PublishAt: &publishAt},
+	}
+	base := extension.Extension{ID: "aomjjhallfgjeglblehebfpbcfeobpgk", Version: "2.0.0", SHA256: strings.Repeat("c", 64), Title: "Base"}
+	store := memstore.New(extension.Extensions{theme, base})
+
+	// Exports are sorted, and JSON exports can be imported without changes
+	extensions, err := store.LoadExtensions(ctx)
+	assert.Nil(t, err)
+	var out bytes.Buffer
+	assert.Nil(t, writeCatalog(&out, extensions, "json"))
+	assert.True(t, strings.Index(out.String(), base.ID) < strings.Index(out.String(), `"Theme"`))
+	path := filepath.Join(dir, "catalog.json")
+	assert.Nil(t, ioutil.WriteFile(path, out.Bytes(), 0600))
+
+	out.Reset()
+	assert.Nil(t, Catalog([]string{"import", "-dry-run", path, "-store", "memory", "-memory-store-seed", path}, &out))
+	assert.Contains(t, out.String(), "0 added, 0 changed and 2 unchanged extensions would be imported")
+
+	// CSV records replace their columns and keep scheduled versions
+	out.Reset()
+	assert.Nil(t, writeCatalog(&out, extensions, "csv"))
+	assert.Contains(t, out.String(), "id,version,sha256,title,url,blacklisted,size,dependencies\n")
+	csvData := strings.Replace(out.String(), "Theme", "Renamed theme", 1) + "ldimlcelhnjgpjjemdjokpgeeikdinbm,0.1.0," + strings.Repeat("d", 64) + ",New,,false,0,\n"
+	records, columns, err := readCatalogCSV(strings.NewReader(csvData))
+	assert.Nil(t, err)
+	assert.Len(t, records, 3)
+
+	out.Reset()
+	assert.Nil(t, importCatalog(ctx, store, records, columns, true, &out))
+	assert.Contains(t, out.String(), "+ ldimlcelhnjgpjjemdjokpgeeikdinbm 0.1.0 New\n")
+	assert.Contains(t, out.String(), `title: "Theme" -> "Renamed theme"`)
+	assert.Contains(t, out.String(), "1 added, 1 changed and 1 unchanged extensions would be imported")
+	extensions, err = store.LoadExtensions(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, extensions, 2)
+
+	out.Reset()
+	assert.Nil(t, importCatalog(ctx, store, records, columns, false, &out))
+	assert.Contains(t, out.String(), "1 added, 1 changed and 1 unchanged extensions imported")
+	extensions, err = store.LoadExtensions(ctx)
+	assert.Nil(t, err)
+	catalog := extension.LoadExtensionsIntoMap(&extensions)
+	assert.Len(t, catalog, 3)
+	assert.Equal(t, "Renamed theme", catalog[theme.ID].Title)
+	assert.Equal(t, theme.Scheduled, catalog[theme.ID].Scheduled)
+	assert.Equal(t, theme.Dependencies, catalog[theme.ID].Dependencies)
+
+	// Records missing from the file are left alone, and duplicates are refused
+	out.Reset()
+	assert.Nil(t, importCatalog(ctx, store, extension.Extensions{base}, nil, true, &out))
+	assert.Contains(t, out.String(), theme.ID+" is only in the catalog and is left alone")
+	assert.NotNil(t, importCatalog(ctx, store, extension.Extensions{base, base}, nil, true, &out))
+
+	_, _, err = readCatalogCSV(strings.NewReader("id,color\n"))
+	assert.NotNil(t, err)
+	assert.NotNil(t, Catalog([]string{"delete"}, &out))
+}
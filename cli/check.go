@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/brave/go-update/client"
+	"io"
+	"time"
+)
+
+// Check sends a real update check for an extension and prints the update offered, for release verification and support:
+//
+//	go-update check -id <appid> -version <installed version> -server <update URL> [-expect <version>] [-download]
+//
+// It fails when the check fails, when -expect is set and a different version or no update is offered,
+// and with -download when the package offered isn't signed for the extension or doesn't match its SHA256.
+func Check(args []string, out io.Writer) error {
+	fs := newFlagSet("check", out)
+	id := fs.String("id", "", "ID of the extension to check")
+	version := fs.String("version", "0.0.0.0", "installed version to check from")
+	server := fs.String("server", "https://go-updater.brave.com/extensions", "update check URL of the server")
+	format := fs.String("format", "xml", "protocol to check with, xml for 3.1 or json for 4")
+	channel := fs.String("channel", "stable", "release channel of the browser")
+	os := fs.String("os", "linux", "operating system of the browser, like win, mac or linux")
+	expect := fs.String("expect", "", "version which must be offered")
+	download := fs.Bool("download", false, "download the package offered and verify it")
+	timeout := fs.Duration("timeout", 30*time.Second, "deadline for the check and download")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if len(*id) == 0 {
+		fs.Usage()
+		return errors.New("-id is required")
+	}
+
+	c := client.New(*server)
+	c.Request.Channel = *channel
+	c.Request.OS = *os
+	switch *format {
+	case "xml":
+	case "json":
+		c.Format = client.JSON
+	default:
+		return fmt.Errorf("-format %q must be xml or json", *format)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	updates, err := c.Check(ctx, client.App{ID: *id, Version: *version})
+	if err != nil {
+		return err
+	}
+	// go-update leaves extensions without an update out of the response rather than answering noupdate
+	update := client.Update{ID: *id, Status: "noupdate"}
+	for _, answer := range updates {
+		if answer.ID == *id {
+			update = answer
+		}
+	}
+	if !update.Available() {
+		fmt.Fprintf(out, "%s: no update from %s (%s)\n", *id, *version, update.Status)
+		if len(*expect) != 0 {
+			return fmt.Errorf("version %s was expected", *expect)
+		}
+		return nil
+	}
+	fmt.Fprintf(out, "%s: update available from %s to %s\n", *id, *version, update.Version)
+	fmt.Fprintf(out, "sha256: %s\n", update.SHA256)
+	if update.Size != 0 {
+		fmt.Fprintf(out, "size: %d\n", update.Size)
+	}
+	for _, url := range update.URLs {
+		fmt.Fprintf(out, "url: %s\n", url)
+	}
+	if len(*expect) != 0 && update.Version != *expect {
+		return fmt.Errorf("version %s was expected", *expect)
+	}
+	if *download {
+		data, err := c.Download(ctx, update)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "downloaded and verified %d bytes\n", len(data))
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package cli
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/brave/go-update/crx"
+	"github.com/brave/go-update/crx/crxtest"
+	"github.com/brave/go-update/extension"
+	"github.com/brave/go-update/memstore"
+	"github.com/brave/go-update/server"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	key := crxtest.NewKey()
+	id := crx.IDFromPublicKey(crxtest.PublicKey(key))
+	payload := crxtest.BuildSignedCRX(key, []byte("PK archive"))
+	sum := sha256.Sum256(payload)
+	packages := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(payload)
+	}))
+	defer packages.Close()
+	ext := extension.Extension{ID: id, Version: "1.2.0", SHA256: hex.EncodeToString(sum[:]), Title: "Checked", URL: packages.URL + "/extension.crx"}
+	updates := httptest.NewServer(server.New(server.WithStore(memstore.New(extension.Extensions{ext}))))
+	defer updates.Close()
+
+	var out bytes.Buffer
+	err := Check([]string{"-id", id, "-version", "1.0.0", "-server", updates.URL + "/extensions", "-expect", "1.2.0", "-download"}, &out)
+	assert.Nil(t, err)
+	assert.Contains(t, out.String(), "update available from 1.0.0 to 1.2.0")
+	assert.Contains(t, out.String(), "sha256: "+ext.SHA256)
+	assert.Contains(t, out.String(), "url: "+ext.URL)
+	assert.Contains(t, out.String(), "downloaded and verified")
+
+	out.Reset()
+	err = Check([]string{"--id", id, "--version", "1.2.0", "--server", updates.URL + "/extensions", "--format", "json"}, &out)
+	assert.Nil(t, err)
+	assert.Contains(t, out.String(), "no update from 1.2.0")
+
+	// The expected version must be offered
+	err = Check([]string{"-id", id, "-version", "1.0.0", "-server", updates.URL + "/extensions", "-expect", "1.3.0"}, &out)
+	assert.NotNil(t, err)
+	err = Check([]string{"-id", id, "-version", "1.2.0", "-server", updates.URL + "/extensions", "-expect", "1.2.0"}, &out)
+	assert.NotNil(t, err)
+
+	err = Check([]string{"-version", "1.0.0"}, &out)
+	assert.NotNil(t, err)
+}
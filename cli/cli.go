@@ -0,0 +1,42 @@
+// Package cli implements the subcommands of go-update, which run instead of the server when the first argument names one:
+//
+//	go-update check -id aomjjhallfgjeglblehebfpbcfeobpgk -version 1.0.0 -server https://go-updater.brave.com/extensions
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Command runs a subcommand with the arguments after its name, writing its results to out
+type Command func(args []string, out io.Writer) error
+
+// Commands are the subcommands by name
+var Commands = map[string]Command{
+	"catalog":  Catalog,
+	"check":    Check,
+	"pack":     Pack,
+	"validate": Validate,
+}
+
+// Usage writes the list of subcommands to out
+func Usage(out io.Writer) {
+	names := []string{}
+	for name := range Commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(out, "usage: go-update [server flags]\n       go-update <command> [flags], where command is one of:\n")
+	for _, name := range names {
+		fmt.Fprintf(out, "  %s\n", name)
+	}
+}
+
+// newFlagSet creates the flags of a subcommand, which report errors rather than exiting
+func newFlagSet(name string, out io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet("go-update "+name, flag.ContinueOnError)
+	fs.SetOutput(out)
+	return fs
+}
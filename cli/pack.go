@@ -0,0 +1,141 @@
+package cli
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/crx"
+	"github.com/brave/go-update/extension"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Pack builds a CRX3 from an unpacked extension directory signed with its private key, prints its ID and SHA256,
+// and optionally uploads it to a server as a new version of the extension:
+//
+//	go-update pack -key key.pem [-o extension.crx] [-upload https://go-updater.brave.com -token <admin token>] <dir>
+//
+// The version and title come from the manifest.json of the extension.
+func Pack(args []string, out io.Writer) error {
+	fs := newFlagSet("pack", out)
+	keyPath := fs.String("key", "", "PEM private key of the extension")
+	output := fs.String("o", "", "file to write the CRX to, <dir>.crx by default")
+	upload := fs.String("upload", "", "base URL of the server to upload the CRX to, like https://go-updater.brave.com")
+	token := fs.String("token", os.Getenv("GO_UPDATE_ADMIN_TOKEN"), "admin token for -upload, GO_UPDATE_ADMIN_TOKEN by default")
+	tenant := fs.String("tenant", "", "tenant to upload to rather than the default catalog")
+	publishAt := fs.String("publish-at", "", "RFC 3339 time to publish the uploaded version at instead of now")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || len(*keyPath) == 0 {
+		fs.Usage()
+		return errors.New("-key and one extension directory are required")
+	}
+	dir := filepath.Clean(fs.Arg(0))
+	if len(*output) == 0 {
+		*output = dir + ".crx"
+	}
+
+	manifest := struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}{}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(data, &manifest)
+	if err != nil {
+		return fmt.Errorf("error parsing manifest.json: %v", err)
+	}
+	data, err = ioutil.ReadFile(*keyPath)
+	if err != nil {
+		return err
+	}
+	key, err := crx.ParsePrivateKey(data)
+	if err != nil {
+		return err
+	}
+	archive, err := crx.ZipDirectory(dir)
+	if err != nil {
+		return err
+	}
+	payload, id, err := crx.Build(key, archive)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(payload)
+	packed := extension.Extension{ID: id, Version: manifest.Version, SHA256: hex.EncodeToString(sum[:]), Size: int64(len(payload))}
+	// Localized names like __MSG_name__ are resolved by the browser and make poor titles
+	if !strings.HasPrefix(manifest.Name, "__MSG_") {
+		packed.Title = manifest.Name
+	}
+	if problems := controller.ValidateExtension(packed); len(problems) != 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	err = ioutil.WriteFile(*output, payload, 0644)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "id: %s\nversion: %s\nsha256: %s\nsize: %d\ncrx: %s\n", packed.ID, packed.Version, packed.SHA256, packed.Size, *output)
+
+	if len(*upload) == 0 {
+		return nil
+	}
+	if len(*publishAt) != 0 {
+		if _, err := time.Parse(time.RFC3339, *publishAt); err != nil {
+			return fmt.Errorf("-publish-at must be an RFC 3339 time: %v", err)
+		}
+	}
+	return uploadCRX(*upload, *tenant, *token, packed, *publishAt, payload, out)
+}
+
+// uploadCRX uploads payload as the version of packed with the admin API of the server at base
+func uploadCRX(base string, tenant string, token string, packed extension.Extension, publishAt string, payload []byte, out io.Writer) error {
+	prefix := strings.TrimSuffix(base, "/")
+	if len(tenant) != 0 {
+		prefix += "/t/" + url.PathEscape(tenant)
+	}
+	query := url.Values{}
+	if len(packed.Title) != 0 {
+		query.Set("title", packed.Title)
+	}
+	if len(publishAt) != 0 {
+		query.Set("publishAt", publishAt)
+	}
+	uploadURL := fmt.Sprintf("%s/api/%s/admin/extensions/%s/versions/%s", prefix, controller.APIVersion2, url.PathEscape(packed.ID), url.PathEscape(packed.Version))
+	if len(query) != 0 {
+		uploadURL += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(http.MethodPut, uploadURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-chrome-extension")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("upload answered %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	fmt.Fprintf(out, "uploaded %s %s to %s\n", packed.ID, packed.Version, base)
+	return nil
+}
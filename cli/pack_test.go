@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"github.com/brave/go-update/crx"
+	"github.com/brave/go-update/crx/crxtest"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPack(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-update-pack")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	unpacked := filepath.Join(dir, "theme")
+	assert.Nil(t, os.Mkdir(unpacked, 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(unpacked, "manifest.json"), []byte(`{"name": "Packed theme", "version": "1.2.3", "manifest_version": 2}`), 0644))
+	key := crxtest.NewKey()
+	keyPath := filepath.Join(dir, "key.pem")
+	assert.Nil(t, ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0600))
+	id := crx.IDFromPublicKey(crxtest.PublicKey(key))
+
+	var uploaded []byte
+	var uploadURL string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		uploadURL = r.URL.String()
+		uploaded, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	var out bytes.Buffer
+	err = Pack([]string{"-key", keyPath, "-upload", server.URL, "-token", "test-token", unpacked}, &out)
+	assert.Nil(t, err)
+	payload, err := ioutil.ReadFile(unpacked + ".crx")
+	assert.Nil(t, err)
+	header, err := crx.Verify(bytes.NewReader(payload))
+	assert.Nil(t, err)
+	assert.Equal(t, id, header.ID())
+	sum := sha256.Sum256(payload)
+	assert.Contains(t, out.String(), "id: "+id)
+	assert.Contains(t, out.String(), "version: 1.2.3")
+	assert.Contains(t, out.String(), "sha256: "+hex.EncodeToString(sum[:]))
+	assert.Equal(t, payload, uploaded)
+	assert.Equal(t, "/api/v2/admin/extensions/"+id+"/versions/1.2.3?title=Packed+theme", uploadURL)
+
+	// Failed uploads fail the command
+	err = Pack([]string{"-key", keyPath, "-o", filepath.Join(dir, "out.crx"), "-upload", server.URL, "-token", "wrong-token", unpacked}, &out)
+	assert.NotNil(t, err)
+	_, err = os.Stat(filepath.Join(dir, "out.crx"))
+	assert.Nil(t, err)
+
+	assert.NotNil(t, Pack([]string{unpacked}, &out))
+}
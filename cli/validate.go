@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/brave/go-update/client"
+	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/extension"
+	"io"
+	"time"
+)
+
+// Validate checks an extensions manifest before it is deployed, failing with every problem found:
+//
+//	go-update validate [-format json|csv] [-verify] <file>
+//
+// Each record must have a valid ID, version and SHA256, and no ID may be listed twice.
+// With -verify the CRX of every version is also downloaded and checked against its record.
+func Validate(args []string, out io.Writer) error {
+	fs := newFlagSet("validate", out)
+	format := fs.String("format", "", "json or csv, from the extension of the file by default")
+	verify := fs.Bool("verify", false, "download the CRX of every version and verify its signature and SHA256")
+	codebase := fs.String("codebase-url-template", extension.CodebaseURLTemplate, "download URL of records without a url")
+	timeout := fs.Duration("timeout", time.Minute, "deadline for each download with -verify")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("one manifest file is required")
+	}
+	path := fs.Arg(0)
+	*format, err = catalogFormat(*format, path)
+	if err != nil {
+		return err
+	}
+	extensions, _, err := readCatalogFile(path, *format)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %v", path, err)
+	}
+
+	problems := controller.ValidateCatalog(extensions)
+	if *verify {
+		extension.CodebaseURLTemplate = *codebase
+		c := client.New("")
+		for _, ext := range extensions {
+			versions := []extension.Extension{ext}
+			if ext.Scheduled != nil {
+				versions = append(versions, *ext.Scheduled)
+			}
+			for _, version := range versions {
+				if version.Blacklisted {
+					continue
+				}
+				update := client.Update{ID: version.ID, Status: "ok", Version: version.Version, SHA256: version.SHA256, URLs: []string{version.GetURL()}}
+				ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+				_, err := c.Download(ctx, update)
+				cancel()
+				if err != nil {
+					problems = append(problems, fmt.Sprintf("%s %s: %v", version.ID, version.Version, err))
+				}
+			}
+		}
+	}
+	for _, problem := range problems {
+		fmt.Fprintln(out, problem)
+	}
+	if len(problems) != 0 {
+		return fmt.Errorf("%d problems found in %s", len(problems), path)
+	}
+	fmt.Fprintf(out, "%d extensions are valid\n", len(extensions))
+	return nil
+}
@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/crx"
+	"github.com/brave/go-update/crx/crxtest"
+	"github.com/brave/go-update/extension"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-update-validate")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	write := func(name string, extensions extension.Extensions) string {
+		data, err := json.Marshal(extensions)
+		assert.Nil(t, err)
+		path := filepath.Join(dir, name)
+		assert.Nil(t, ioutil.WriteFile(path, data, 0600))
+		return path
+	}
+
+	// The built in catalog is valid
+	assert.Empty(t, controller.ValidateCatalog(extension.OfferedExtensions))
+
+	key := crxtest.NewKey()
+	id := crx.IDFromPublicKey(crxtest.PublicKey(key))
+	payload := crxtest.BuildSignedCRX(key, []byte("PK archive"))
+	sum := sha256.Sum256(payload)
+	packages := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(payload)
+	}))
+	defer packages.Close()
+	valid := extension.Extension{ID: id, Version: "1.0.0", SHA256: hex.EncodeToString(sum[:]), URL: packages.URL + "/extension.crx"}
+
+	var out bytes.Buffer
+	path := write("valid.json", extension.Extensions{valid})
+	assert.Nil(t, Validate([]string{"-verify", path}, &out))
+	assert.Contains(t, out.String(), "1 extensions are valid")
+
+	// The package must match its record
+	mismatched := valid
+	mismatched.SHA256 = strings.Repeat("0", 64)
+	out.Reset()
+	assert.Nil(t, Validate([]string{write("mismatched.json", extension.Extensions{mismatched})}, &out))
+	assert.NotNil(t, Validate([]string{"-verify", write("mismatched.json", extension.Extensions{mismatched})}, &out))
+	assert.Contains(t, out.String(), "SHA256")
+
+	invalid := extension.Extensions{
+		valid,
+		valid,
+		{ID: "ABC", Version: "1.0.0", SHA256: valid.SHA256},
+		{ID: "aomjjhallfgjeglblehebfpbcfeobpgk", Version: "1.0.beta", SHA256: "abc", URL: "/relative.crx", Dependencies: []string{"aomjjhallfgjeglblehebfpbcfeobpgk"}},
+		{ID: "bfdgpgibhagkpdlnjonhkabjoijopoge", Version: "2.0.0", SHA256: valid.SHA256, Scheduled: &extension.Extension{ID: "bfdgpgibhagkpdlnjonhkabjoijopoge", Version: "1.0.0", SHA256: valid.SHA256}},
+	}
+	out.Reset()
+	err = Validate([]string{write("invalid.json", invalid)}, &out)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "8 problems found")
+	for _, problem := range []string{
+		id + " is listed more than once",
+		`"ABC" is not an extension ID`,
+		`"1.0.beta" is not a version`,
+		`SHA256 "abc" is not 64 lowercase hex digits`,
+		`URL "/relative.crx" is not an absolute HTTP URL`,
+		"aomjjhallfgjeglblehebfpbcfeobpgk: depends on itself",
+		"scheduled version 1.0.0 has no publishAt",
+		"scheduled version 1.0.0 is not newer than 2.0.0",
+	} {
+		assert.Contains(t, out.String(), problem)
+	}
+
+	// CSV manifests are read too
+	csvPath := filepath.Join(dir, "catalog.csv")
+	assert.Nil(t, ioutil.WriteFile(csvPath, []byte("id,version,sha256\n"+id+",1.0.0,"+valid.SHA256+"\n"), 0600))
+	out.Reset()
+	assert.Nil(t, Validate([]string{csvPath}, &out))
+}
@@ -0,0 +1,370 @@
+// Package client checks for extension updates with the Omaha protocol, the way a browser does,
+// and downloads and verifies the packages offered. It speaks both the XML protocol 3.1 and the JSON protocol 4
+// served by go-update, and works with any server implementing them.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/brave/go-update/crx"
+	"github.com/brave/go-update/extension"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// Format is the encoding of update checks and their responses
+type Format int
+
+const (
+	// XML is protocol 3.1, sent by browsers for extension updates
+	XML Format = iota
+	// JSON is protocol 4, which replaces the package of an update with a pipeline of operations
+	JSON
+)
+
+// App is an extension to check for updates, at the version which is installed
+type App struct {
+	ID      string
+	Version string
+}
+
+// Request is an update check for one or more extensions, with the attributes of the browser sending it
+type Request struct {
+	Apps []App
+	// ProdVersion is the version of the browser, and Channel, OS and Arch are its release channel and platform,
+	// like stable, linux and x64. Empty attributes are left out.
+	ProdVersion string
+	Channel     string
+	OS          string
+	Arch        string
+}
+
+// Update is the answer to an update check for one extension
+type Update struct {
+	ID string
+	// Status is ok when an update is offered, or noupdate or an error like error-unknownApplication otherwise
+	Status  string
+	Version string
+	SHA256  string
+	// Size is the size of the package in bytes, or 0 if the server didn't say
+	Size int64
+	// URLs are where the package can be downloaded from, in order of preference
+	URLs []string
+}
+
+// Available returns true if update offers a package to download
+func (update Update) Available() bool {
+	return update.Status == "ok" && len(update.URLs) != 0
+}
+
+// Encode returns the body of the update check for request in format, and its content type
+func Encode(request Request, format Format) ([]byte, string, error) {
+	requestID, err := newRequestID()
+	if err != nil {
+		return nil, "", err
+	}
+	if format == JSON {
+		type UpdateCheck struct{}
+		type App struct {
+			AppID       string      `json:"appid"`
+			Version     string      `json:"version"`
+			UpdateCheck UpdateCheck `json:"updatecheck"`
+		}
+		type Body struct {
+			Protocol    string `json:"protocol"`
+			RequestID   string `json:"requestid"`
+			ProdVersion string `json:"prodversion,omitempty"`
+			ProdChannel string `json:"prodchannel,omitempty"`
+			OS          string `json:"@os,omitempty"`
+			Arch        string `json:"arch,omitempty"`
+			Apps        []App  `json:"apps"`
+		}
+		body := Body{
+			Protocol: extension.Protocol4, RequestID: requestID, ProdVersion: request.ProdVersion,
+			ProdChannel: request.Channel, OS: request.OS, Arch: request.Arch, Apps: []App{},
+		}
+		for _, app := range request.Apps {
+			body.Apps = append(body.Apps, App{AppID: app.ID, Version: app.Version})
+		}
+		data, err := json.Marshal(struct {
+			Request Body `json:"request"`
+		}{body})
+		return data, "application/json", err
+	}
+
+	type UpdateCheck struct {
+		XMLName xml.Name `xml:"updatecheck"`
+	}
+	type App struct {
+		XMLName     xml.Name `xml:"app"`
+		AppID       string   `xml:"appid,attr"`
+		Version     string   `xml:"version,attr"`
+		UpdateCheck UpdateCheck
+	}
+	type Body struct {
+		XMLName     xml.Name `xml:"request"`
+		Protocol    string   `xml:"protocol,attr"`
+		RequestID   string   `xml:"requestid,attr"`
+		ProdVersion string   `xml:"prodversion,attr,omitempty"`
+		ProdChannel string   `xml:"prodchannel,attr,omitempty"`
+		OS          string   `xml:"os,attr,omitempty"`
+		Arch        string   `xml:"arch,attr,omitempty"`
+		Apps        []App
+	}
+	body := Body{
+		Protocol: extension.DefaultProtocol, RequestID: requestID, ProdVersion: request.ProdVersion,
+		ProdChannel: request.Channel, OS: request.OS, Arch: request.Arch,
+	}
+	for _, app := range request.Apps {
+		body.Apps = append(body.Apps, App{AppID: app.ID, Version: app.Version})
+	}
+	data, err := xml.Marshal(body)
+	if err != nil {
+		return nil, "", err
+	}
+	return append([]byte(xml.Header), data...), "application/xml", nil
+}
+
+// newRequestID returns a random ID for an update check, in braces like browsers send it
+func newRequestID() (string, error) {
+	id := make([]byte, 16)
+	_, err := rand.Read(id)
+	if err != nil {
+		return "", err
+	}
+	return "{" + hex.EncodeToString(id) + "}", nil
+}
+
+// Parse returns the updates in an update response in format, in the order of its apps
+func Parse(data []byte, format Format) ([]Update, error) {
+	if format == JSON {
+		return parseJSON(data)
+	}
+	response := struct {
+		Protocol string `xml:"protocol,attr"`
+		Apps     []struct {
+			AppID       string `xml:"appid,attr"`
+			Status      string `xml:"status,attr"`
+			UpdateCheck *struct {
+				Status string `xml:"status,attr"`
+				URLs   []struct {
+					Codebase string `xml:"codebase,attr"`
+				} `xml:"urls>url"`
+				Manifest struct {
+					Version  string `xml:"version,attr"`
+					Packages []struct {
+						Name   string `xml:"name,attr"`
+						SHA256 string `xml:"hash_sha256,attr"`
+						Size   int64  `xml:"size,attr"`
+					} `xml:"packages>package"`
+				} `xml:"manifest"`
+			} `xml:"updatecheck"`
+		} `xml:"app"`
+	}{}
+	err := xml.Unmarshal(data, &response)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing update response: %v", err)
+	}
+	if !strings.HasPrefix(response.Protocol, "3.") {
+		return nil, fmt.Errorf("update response has protocol %q rather than 3.x", response.Protocol)
+	}
+	updates := []Update{}
+	for _, app := range response.Apps {
+		update := Update{ID: app.AppID, Status: app.Status}
+		if updateCheck := app.UpdateCheck; updateCheck != nil {
+			update.Status = updateCheck.Status
+			update.Version = updateCheck.Manifest.Version
+			for _, url := range updateCheck.URLs {
+				update.URLs = append(update.URLs, url.Codebase)
+			}
+			if len(updateCheck.Manifest.Packages) != 0 {
+				pkg := updateCheck.Manifest.Packages[0]
+				update.SHA256 = pkg.SHA256
+				update.Size = pkg.Size
+				// Codebases ending in a slash are the directory of the package, as with Google's servers
+				for i, url := range update.URLs {
+					if strings.HasSuffix(url, "/") {
+						update.URLs[i] = url + pkg.Name
+					}
+				}
+			}
+		}
+		updates = append(updates, update)
+	}
+	return updates, nil
+}
+
+// parseJSON returns the updates in a protocol 4 response
+func parseJSON(data []byte) ([]Update, error) {
+	type Operation struct {
+		Type string `json:"type"`
+		Size int64  `json:"size"`
+		URLs []struct {
+			URL string `json:"url"`
+		} `json:"urls"`
+		Out *struct {
+			SHA256 string `json:"sha256"`
+		} `json:"out"`
+	}
+	response := struct {
+		Response *struct {
+			Protocol string `json:"protocol"`
+			Apps     []struct {
+				AppID       string `json:"appid"`
+				Status      string `json:"status"`
+				UpdateCheck *struct {
+					Status      string `json:"status"`
+					NextVersion string `json:"nextversion"`
+					Pipelines   []struct {
+						Operations []Operation `json:"operations"`
+					} `json:"pipelines"`
+				} `json:"updatecheck"`
+			} `json:"apps"`
+		} `json:"response"`
+	}{}
+	err := json.Unmarshal(bytes.TrimPrefix(data, []byte(extension.Protocol4Prefix)), &response)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing update response: %v", err)
+	}
+	if response.Response == nil || !strings.HasPrefix(response.Response.Protocol, "4.") {
+		return nil, fmt.Errorf("update response isn't protocol 4")
+	}
+	updates := []Update{}
+	for _, app := range response.Response.Apps {
+		update := Update{ID: app.AppID, Status: app.Status}
+		if updateCheck := app.UpdateCheck; updateCheck != nil {
+			update.Status = updateCheck.Status
+			update.Version = updateCheck.NextVersion
+			// Only the download of the first pipeline is used, which is the full package
+			if len(updateCheck.Pipelines) != 0 {
+				for _, operation := range updateCheck.Pipelines[0].Operations {
+					if operation.Type != "download" {
+						continue
+					}
+					update.Size = operation.Size
+					if operation.Out != nil {
+						update.SHA256 = operation.Out.SHA256
+					}
+					for _, url := range operation.URLs {
+						update.URLs = append(update.URLs, url.URL)
+					}
+					break
+				}
+			}
+		}
+		updates = append(updates, update)
+	}
+	return updates, nil
+}
+
+// Verify reads the package of update from r and checks that it is a CRX signed for the extension, with the SHA256 offered
+func Verify(update Update, r io.Reader) error {
+	hash := sha256.New()
+	header, err := crx.Verify(io.TeeReader(r, hash))
+	if err != nil {
+		return err
+	}
+	if header.ID() != update.ID {
+		return fmt.Errorf("CRX is for extension %s", header.ID())
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if sum != update.SHA256 {
+		return fmt.Errorf("SHA256 %s does not match the update's %s", sum, update.SHA256)
+	}
+	return nil
+}
+
+// Client checks a server for updates and downloads them
+type Client struct {
+	// URL is the update check endpoint, like https://go-updater.brave.com/extensions
+	URL    string
+	Format Format
+	// HTTPClient sends the requests, http.DefaultClient if nil
+	HTTPClient *http.Client
+	// Request has the browser attributes sent with every update check
+	Request Request
+}
+
+// New creates a Client for the update check endpoint at url, sending XML checks as a stable Linux browser
+func New(url string) *Client {
+	return &Client{URL: url, Format: XML, Request: Request{Channel: "stable", OS: "linux", Arch: "x64"}}
+}
+
+func (client *Client) httpClient() *http.Client {
+	if client.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return client.HTTPClient
+}
+
+// Check sends an update check for apps and returns the answer for each.
+// Servers redirect checks for extensions they don't serve to another server, which is followed.
+func (client *Client) Check(ctx context.Context, apps ...App) ([]Update, error) {
+	request := client.Request
+	request.Apps = apps
+	body, contentType, err := Encode(request, client.Format)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, client.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := client.httpClient().Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("update check answered %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return Parse(data, client.Format)
+}
+
+// Download downloads the package of update from the first of its URLs which works, verifies it and returns it
+func (client *Client) Download(ctx context.Context, update Update) ([]byte, error) {
+	if !update.Available() {
+		return nil, fmt.Errorf("no update is available for %s", update.ID)
+	}
+	var lastErr error
+	for _, url := range update.URLs {
+		data, err := client.download(ctx, url)
+		if err == nil {
+			err = Verify(update, bytes.NewReader(data))
+		}
+		if err == nil {
+			return data, nil
+		}
+		lastErr = fmt.Errorf("%s: %v", url, err)
+	}
+	return nil, lastErr
+}
+
+func (client *Client) download(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.httpClient().Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download failed with status %d", resp.StatusCode)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
@@ -0,0 +1,128 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"github.com/brave/go-update/crx"
+	"github.com/brave/go-update/crx/crxtest"
+	"github.com/brave/go-update/extension"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	request := Request{Apps: []App{{ID: "aomjjhallfgjeglblehebfpbcfeobpgk", Version: "1.0.0"}}, Channel: "beta", OS: "mac"}
+
+	body, contentType, err := Encode(request, XML)
+	assert.Nil(t, err)
+	assert.Equal(t, "application/xml", contentType)
+	protocol, err := extension.ParseRequestProtocol(body)
+	assert.Nil(t, err)
+	assert.Equal(t, "3.1", protocol)
+	xmlRequest := extension.UpdateRequest{}
+	assert.Nil(t, xml.Unmarshal(body, &xmlRequest))
+	assert.Len(t, xmlRequest, 1)
+	assert.Equal(t, "aomjjhallfgjeglblehebfpbcfeobpgk", xmlRequest[0].ID)
+	assert.Equal(t, "1.0.0", xmlRequest[0].Version)
+	assert.Equal(t, "beta", xmlRequest[0].Channel)
+	assert.False(t, xmlRequest[0].PingOnly)
+
+	body, contentType, err = Encode(request, JSON)
+	assert.Nil(t, err)
+	assert.Equal(t, "application/json", contentType)
+	jsonRequest := extension.Protocol4Request{}
+	assert.Nil(t, json.Unmarshal(body, &jsonRequest))
+	assert.Len(t, jsonRequest.UpdateRequest, 1)
+	assert.Equal(t, "mac", jsonRequest.UpdateRequest[0].Platform)
+	assert.False(t, jsonRequest.UpdateRequest[0].PingOnly)
+}
+
+func TestCheckAndDownload(t *testing.T) {
+	key := crxtest.NewKey()
+	id := crx.IDFromPublicKey(crxtest.PublicKey(key))
+	payload := crxtest.BuildSignedCRX(key, []byte("PK archive"))
+	sum := sha256.Sum256(payload)
+	latest := extension.Extension{ID: id, Version: "2.0.0", SHA256: hex.EncodeToString(sum[:]), Size: int64(len(payload))}
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	latest.URLs = []string{server.URL + "/missing.crx", server.URL + "/extension.crx"}
+	mux.HandleFunc("/extension.crx", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(payload)
+	})
+	mux.HandleFunc("/extensions", func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		assert.Nil(t, err)
+		catalog := map[string]extension.Extension{id: latest}
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			request := extension.Protocol4Request{}
+			assert.Nil(t, json.Unmarshal(body, &request))
+			response := extension.Protocol4Response{UpdateResponse: request.UpdateRequest.FilterForUpdates(&catalog)}
+			data, err := json.Marshal(&response)
+			assert.Nil(t, err)
+			_, _ = w.Write(append([]byte(extension.Protocol4Prefix), data...))
+			return
+		}
+		request := extension.UpdateRequest{}
+		assert.Nil(t, xml.Unmarshal(body, &request))
+		response := request.FilterForUpdates(&catalog)
+		data, err := xml.Marshal(&response)
+		assert.Nil(t, err)
+		_, _ = w.Write(data)
+	})
+
+	for _, format := range []Format{XML, JSON} {
+		client := New(server.URL + "/extensions")
+		client.Format = format
+		updates, err := client.Check(context.Background(), App{ID: id, Version: "1.0.0"})
+		assert.Nil(t, err)
+		assert.Len(t, updates, 1)
+		update := updates[0]
+		assert.True(t, update.Available())
+		assert.Equal(t, "2.0.0", update.Version)
+		assert.Equal(t, latest.SHA256, update.SHA256)
+		assert.Equal(t, latest.Size, update.Size)
+		assert.Equal(t, latest.URLs, update.URLs)
+
+		// The first URL which works is used
+		data, err := client.Download(context.Background(), update)
+		assert.Nil(t, err)
+		assert.Equal(t, payload, data)
+
+		// Packages which don't match the update are rejected
+		update.SHA256 = strings.Repeat("0", 64)
+		_, err = client.Download(context.Background(), update)
+		assert.NotNil(t, err)
+
+		updates, err = client.Check(context.Background(), App{ID: id, Version: "2.0.0"})
+		assert.Nil(t, err)
+		assert.Empty(t, updates)
+	}
+
+	client := New(server.URL + "/nothing")
+	_, err := client.Check(context.Background(), App{ID: id, Version: "1.0.0"})
+	assert.NotNil(t, err)
+}
+
+func TestParseCodebaseDirectory(t *testing.T) {
+	updates, err := Parse([]byte(`<response protocol="3.1"><app appid="x" status="ok"><updatecheck status="ok">
+<urls><url codebase="https://example.com/crx/"/></urls>
+<manifest version="1.2"><packages><package name="x_1_2.crx" hash_sha256="abc" size="10"/></packages></manifest>
+</updatecheck></app><app appid="y" status="error-unknownApplication"/></response>`), XML)
+	assert.Nil(t, err)
+	assert.Len(t, updates, 2)
+	assert.Equal(t, []string{"https://example.com/crx/x_1_2.crx"}, updates[0].URLs)
+	assert.Equal(t, "error-unknownApplication", updates[1].Status)
+	assert.False(t, updates[1].Available())
+
+	_, err = Parse([]byte(`<gupdate protocol="2.0"/>`), XML)
+	assert.NotNil(t, err)
+}
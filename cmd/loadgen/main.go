@@ -0,0 +1,64 @@
+// Command loadgen sends update checks to a running server at a target rate, in a configurable mix of
+// single extension, multi extension, unknown extension and web store checks, and prints the latency
+// percentiles of each kind, for capacity planning:
+//
+//	loadgen -target http://localhost:8192 -rps 500 -duration 1m -mix single=70,multi=15,unknown=5,webstore=10
+//
+// By default the extensions checked are the built in ones, which the server offers with STORE=memory.
+package main
+
+import (
+	"context"
+	"flag"
+	"github.com/brave/go-update/extension"
+	"github.com/brave/go-update/loadgen"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+func main() {
+	target := flag.String("target", "http://localhost:8192", "base URL of the server to send update checks to")
+	rps := flag.Float64("rps", 100, "update checks per second")
+	duration := flag.Duration("duration", 30*time.Second, "how long to send update checks for")
+	concurrency := flag.Int("concurrency", 64, "most update checks waiting for a response at once")
+	mixFlag := flag.String("mix", "single=70,multi=15,unknown=5,webstore=10", "relative weight of each kind of update check")
+	ids := flag.String("ids", "", "comma separated extension IDs in the catalog of the server, the built in ones by default")
+	apps := flag.Int("apps", 5, "number of extensions in multi extension checks")
+	outdated := flag.Float64("outdated", 0.1, "share of extensions checked from an old version, which are offered an update")
+	flag.Parse()
+
+	mix, err := loadgen.ParseMix(*mixFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	config := loadgen.Config{
+		Target:       strings.TrimSuffix(*target, "/"),
+		RPS:          *rps,
+		Duration:     *duration,
+		Concurrency:  *concurrency,
+		Mix:          mix,
+		AppsPerCheck: *apps,
+		Outdated:     *outdated,
+	}
+	if len(*ids) != 0 {
+		config.IDs = strings.Split(*ids, ",")
+	} else {
+		for _, ext := range extension.OfferedExtensions {
+			config.IDs = append(config.IDs, ext.ID)
+		}
+	}
+
+	report, err := loadgen.Run(context.Background(), config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = report.Write(os.Stdout)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if report.Total.Errors != 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,79 @@
+// Command replay sends update checks recorded by a server with record_sample_rate set to a build of the server,
+// and reports the responses which changed. By default the build is this one, configured in process by the
+// arguments after the replay flags like the server itself, so a change can be tested before it is deployed:
+//
+//	replay -recordings recordings.jsonl -- -store memory -memory-store-seed catalog.json
+//
+// With -target the recordings are sent to a running server instead.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/brave/go-update/config"
+	"github.com/brave/go-update/replay"
+	"github.com/brave/go-update/server"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+)
+
+func main() {
+	recordings := flag.String("recordings", "", "file of recorded update checks, - for standard input")
+	target := flag.String("target", "", "URL of a running server to replay against instead of this build")
+	verbose := flag.Bool("v", false, "print the recorded and replayed responses which differ")
+	flag.Parse()
+	if len(*recordings) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var handler http.Handler
+	if len(*target) != 0 {
+		u, err := url.Parse(*target)
+		if err != nil {
+			log.Fatalf("invalid target: %v", err)
+		}
+		handler = httputil.NewSingleHostReverseProxy(u)
+	} else {
+		cfg, err := config.Load(flag.Args())
+		if err != nil {
+			log.Fatal(err)
+		}
+		server.ApplyConfig(cfg)
+		handler = server.New(server.WithConfig(cfg))
+	}
+
+	var input io.Reader = os.Stdin
+	if *recordings != "-" {
+		f, err := os.Open(*recordings)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		input = f
+	}
+	loaded, err := replay.Load(input)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	changed := 0
+	for _, result := range replay.Replay(handler, loaded) {
+		if !result.Changed() {
+			continue
+		}
+		changed++
+		fmt.Printf("%s %s: %d was %d\n", result.Recording.Method, result.Recording.URL, result.Status, result.Recording.Status)
+		if *verbose {
+			fmt.Printf("recorded:\n%s\nreplayed:\n%s\n\n", result.Recording.Response, result.Response)
+		}
+	}
+	fmt.Printf("%d of %d responses changed\n", changed, len(loaded))
+	if changed != 0 {
+		os.Exit(1)
+	}
+}
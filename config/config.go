@@ -0,0 +1,1323 @@
+// Package config loads the server configuration from a YAML file, the environment and command line flags
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/brave/go-update/extension"
+	"github.com/brave/go-update/privacy"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds every tunable of the server.
+// Settings are applied in order from Default, the config file, the environment and then flags.
+type Config struct {
+	// Addr is the address the server listens on, a host:port, unix:PATH for a Unix socket,
+	// or systemd or systemd:NAME for a socket passed by systemd socket activation
+	Addr string `yaml:"addr"`
+	// TLSCert and TLSKey serve Addr over HTTPS with HTTP/2, for deployments which terminate TLS here rather than
+	// at a load balancer. HTTP3 also serves it over QUIC on the same UDP port, in builds with the http3 tag.
+	TLSCert string `yaml:"tls_cert"`
+	TLSKey  string `yaml:"tls_key"`
+	HTTP3   bool   `yaml:"http3"`
+	// TrustedProxies are the CIDR blocks of load balancers and proxies whose X-Forwarded-For and X-Real-IP
+	// headers are believed, by default the loopback and private ranges
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	// HSTSMaxAge is the max-age of the Strict-Transport-Security header on HTTPS responses, or 0 not to send it.
+	// HTTPSRedirect redirects update checks over plain HTTP to HTTPS, trusting X-Forwarded-Proto from TrustedProxies.
+	HSTSMaxAge    time.Duration `yaml:"hsts_max_age"`
+	HTTPSRedirect bool          `yaml:"https_redirect"`
+	// OpsAddr is the address to serve health checks, metrics, pprof and expvar on, which should only be reachable
+	// internally. Metrics move there from the public listener, and pprof and expvar are disabled when it is empty.
+	OpsAddr string `yaml:"ops_addr"`
+	// AdminAddr moves the admin and stats APIs to a separate HTTPS listener, served with AdminTLSCert and AdminTLSKey,
+	// which only accepts clients with a certificate issued by a CA in AdminClientCA.
+	AdminAddr     string `yaml:"admin_addr"`
+	AdminTLSCert  string `yaml:"admin_tls_cert"`
+	AdminTLSKey   string `yaml:"admin_tls_key"`
+	AdminClientCA string `yaml:"admin_client_ca"`
+	// CORSAllowedOrigins are the origins of dashboards which may call the admin, catalog and stats APIs from a browser,
+	// with CORSAllowedMethods. "*" allows every origin, and none are allowed when it is empty.
+	CORSAllowedOrigins []string `yaml:"cors_allowed_origins"`
+	CORSAllowedMethods []string `yaml:"cors_allowed_methods"`
+	// CompressionMinSize is the smallest update check response or catalog compressed with brotli or gzip,
+	// when the client accepts them, in bytes. 0 disables compression.
+	CompressionMinSize int `yaml:"compression_min_size"`
+	// GRPCAddr is the address to serve the gRPC admin service on, see adminrpc. It uses the certificates
+	// of the admin listener when AdminAddr is set, and is disabled when empty.
+	GRPCAddr string `yaml:"grpc_addr"`
+	// LogLevel is the lowest level of messages logged, like debug, info or warning
+	LogLevel string `yaml:"log_level"`
+	// CodebaseURLTemplate is the download URL advertised for each extension, see extension.GetCodebaseURL
+	CodebaseURLTemplate string `yaml:"codebase_url_template"`
+	// RefreshInterval is how often the extensions catalog is reloaded
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+	// FrozenCatalog loads the catalog once at startup and never refreshes or changes it
+	FrozenCatalog bool `yaml:"frozen_catalog"`
+	// ChaosMode lets faults be injected into update checks with /api/admin/chaos, for testing clients only
+	ChaosMode bool `yaml:"chaos_mode"`
+	// AWSRegion is the region of the Extensions table and the buckets
+	AWSRegion string `yaml:"aws_region"`
+	// DynamoDBFailoverRegions are replicas of the Extensions global table to use when AWSRegion fails, in order
+	DynamoDBFailoverRegions []string `yaml:"dynamodb_failover_regions"`
+	// DynamoDBEndpoint overrides the DynamoDB endpoint, for example to use DynamoDB Local
+	DynamoDBEndpoint string `yaml:"dynamodb_endpoint"`
+	// DynamoDBScanSegments is how many segments the catalog is scanned in parallel
+	DynamoDBScanSegments int `yaml:"dynamodb_scan_segments"`
+	// StoreBreakerFailures is how many DynamoDB failures in a row stop further calls for StoreBreakerTimeout
+	StoreBreakerFailures uint32        `yaml:"store_breaker_failures"`
+	StoreBreakerTimeout  time.Duration `yaml:"store_breaker_timeout"`
+	// StoreTimeout is the deadline for each DynamoDB operation including retries
+	StoreTimeout time.Duration `yaml:"store_timeout"`
+	// StoreAttempts is the most times a DynamoDB operation is tried when it fails transiently
+	StoreAttempts int `yaml:"store_attempts"`
+	// CatalogManifest is a JSON file to load the catalog from instead of DynamoDB
+	CatalogManifest string `yaml:"catalog_manifest"`
+	// Store is where the catalog is kept, "dynamodb" or "memory".
+	// The memory store is seeded from MemoryStoreSeed, or the built in extensions if it isn't set.
+	Store           string `yaml:"store"`
+	MemoryStoreSeed string `yaml:"memory_store_seed"`
+	// ShadowStore is a second store, "dynamodb" or "memory", which every catalog load and save is repeated on
+	// in the background and compared with, to try a new backend before migrating the default catalog to it.
+	// The DynamoDB shadow is ShadowDynamoDBTable at ShadowDynamoDBEndpoint, the memory shadow is seeded from ShadowMemoryStoreSeed.
+	ShadowStore            string `yaml:"shadow_store"`
+	ShadowDynamoDBTable    string `yaml:"shadow_dynamodb_table"`
+	ShadowDynamoDBEndpoint string `yaml:"shadow_dynamodb_endpoint"`
+	ShadowMemoryStoreSeed  string `yaml:"shadow_memory_store_seed"`
+	// WebStoreFallbackURL is where GET requests for a single unknown extension are redirected
+	WebStoreFallbackURL string `yaml:"webstore_fallback_url"`
+	// WebStoreCacheMaxAge is how long CDNs may cache GET update check responses, or 0 to make them revalidate every time
+	WebStoreCacheMaxAge time.Duration `yaml:"webstore_cache_max_age"`
+	// MaxAppsPerResponse is the most apps answered in one update check response, or 0 for no limit.
+	// GET checks for more link to a request for the rest with a Link header.
+	MaxAppsPerResponse int `yaml:"max_apps_per_response"`
+	// UpdateBudgets are the most updates offered per minute by extension ID, for large components.
+	// Update checks over the budget are answered with noupdate.
+	UpdateBudgets map[string]int `yaml:"update_budgets"`
+	// ComponentUpdaterFallbackURL is where POST requests for a single unknown extension are redirected
+	ComponentUpdaterFallbackURL string `yaml:"component_updater_fallback_url"`
+	// RedirectMarker is the name=value query parameter added to redirected update checks, or empty to add none
+	RedirectMarker string `yaml:"redirect_marker"`
+	// ComponentPassthrough answers update checks for third party components by ID, like the Widevine CDM,
+	// instead of redirecting them with the other extensions the catalog doesn't have
+	ComponentPassthrough map[string]ComponentPassthrough `yaml:"component_passthrough"`
+	// AppOverrides replace how update checks for an app are answered by ID: from the catalog only, redirected,
+	// proxied or blocked, instead of redirecting the checks for only an app which isn't in the catalog
+	AppOverrides map[string]AppOverride `yaml:"app_overrides"`
+
+	CRXDirectory  string `yaml:"crx_directory"`
+	CRXBucket     string `yaml:"crx_bucket"`
+	ReleaseBucket string `yaml:"release_bucket"`
+	// CDNURLPrefixes maps country codes to regional download mirrors
+	CDNURLPrefixes map[string]string `yaml:"cdn_url_prefixes"`
+	CountryHeader  string            `yaml:"country_header"`
+	// CDNPurge is the CDN told to purge cached GET update checks when the catalog changes, "fastly" or "cloudfront".
+	// Fastly purges by surrogate key from FastlyServiceID with the token in FastlyTokenSecret, and CloudFront
+	// invalidates the update check paths of CloudFrontDistributionID.
+	CDNPurge                 string `yaml:"cdn_purge"`
+	FastlyServiceID          string `yaml:"fastly_service_id"`
+	FastlyTokenSecret        string `yaml:"fastly_token_secret"`
+	FastlySoftPurge          bool   `yaml:"fastly_soft_purge"`
+	CloudFrontDistributionID string `yaml:"cloudfront_distribution_id"`
+	// ProtocolVersions are the update protocol versions requests are accepted for.
+	// MirrorProtocol answers with the version of the request rather than always 3.1.
+	ProtocolVersions []string `yaml:"protocol_versions"`
+	MirrorProtocol   bool     `yaml:"mirror_protocol"`
+	// ForceInstallFile persists the force install list served on /policy/forcelist.
+	// PolicyUpdateURL is the update URL of force installed extensions, the /extensions endpoint of this server by default.
+	ForceInstallFile string `yaml:"force_install_file"`
+	PolicyUpdateURL  string `yaml:"policy_update_url"`
+	// ServingWindowsFile persists the serving windows managed with /api/admin/serving-windows
+	ServingWindowsFile string `yaml:"serving_windows_file"`
+	// TransparencyLogFile persists the log of every extension version served, which is disabled when it is empty
+	TransparencyLogFile string `yaml:"transparency_log_file"`
+	// SignedURLBucket is a bucket to also list presigned download URLs for, valid for SignedURLExpiry.
+	// DownloadPreference is which URL is listed first, "cacheable" or "signed", unless the client sends dlpref.
+	SignedURLBucket    string        `yaml:"signed_url_bucket"`
+	SignedURLExpiry    time.Duration `yaml:"signed_url_expiry"`
+	DownloadPreference string        `yaml:"download_preference"`
+
+	// MaintenanceMode makes /extensions answer 503 with a Retry-After of MaintenanceRetryAfter
+	MaintenanceMode       bool          `yaml:"maintenance_mode"`
+	MaintenanceRetryAfter time.Duration `yaml:"maintenance_retry_after"`
+	// BackgroundShedThreshold is how many update checks can be in flight before background checks
+	// are answered with 503 and a Retry-After of BackgroundRetryAfter, or 0 to always serve them
+	BackgroundShedThreshold int           `yaml:"background_shed_threshold"`
+	BackgroundRetryAfter    time.Duration `yaml:"background_retry_after"`
+	// RequestDedupTTL is how long update check responses are kept for retries with the same requestid, or 0 not to keep them
+	RequestDedupTTL time.Duration `yaml:"request_dedup_ttl"`
+	// RetryWindow is how long update check bodies are remembered to detect identical checks sent again, or 0 not to
+	RetryWindow time.Duration `yaml:"retry_window"`
+
+	VerifyPayloads          bool `yaml:"verify_payloads"`
+	CheckLinks              bool `yaml:"check_links"`
+	SuppressMissingPackages bool `yaml:"suppress_missing_packages"`
+	// CanaryInterval is how often every extension is checked for updates through the server itself
+	// and its package downloaded and verified, or 0 not to
+	CanaryInterval time.Duration `yaml:"canary_interval"`
+	// WarmUpExtensions are the most requested extensions, whose update responses are built once at startup
+	// before the server starts listening, so the first clients after a deploy aren't slower
+	WarmUpExtensions []string `yaml:"warm_up_extensions"`
+
+	// StatsDAddr is the StatsD server or Datadog agent to send metrics to, like "127.0.0.1:8125"
+	StatsDAddr   string   `yaml:"statsd_addr"`
+	StatsDPrefix string   `yaml:"statsd_prefix"`
+	StatsDTags   []string `yaml:"statsd_tags"`
+
+	// ExtensionStatsSink is where update and download counts are flushed every ExtensionStatsFlushInterval,
+	// "cloudwatch" to ExtensionStatsNamespace, "dynamodb" to ExtensionStatsTable, or empty to only keep them in memory
+	ExtensionStatsSink          string        `yaml:"extension_stats_sink"`
+	ExtensionStatsFlushInterval time.Duration `yaml:"extension_stats_flush_interval"`
+	ExtensionStatsNamespace     string        `yaml:"extension_stats_namespace"`
+	ExtensionStatsTable         string        `yaml:"extension_stats_table"`
+
+	// AuditSink is where changes made with the admin API are recorded, "file" to AuditLogFile, "dynamodb" to AuditTable,
+	// or empty to only keep them in memory
+	AuditSink    string `yaml:"audit_sink"`
+	AuditLogFile string `yaml:"audit_log_file"`
+	AuditTable   string `yaml:"audit_table"`
+
+	// EventsSink streams the metadata of every update check to "kinesis" or "kafka" for analytics, or nowhere when empty.
+	// Kafka is reached through a Confluent compatible REST proxy at EventsKafkaRESTURL.
+	EventsSink          string `yaml:"events_sink"`
+	EventsKinesisStream string `yaml:"events_kinesis_stream"`
+	EventsKafkaRESTURL  string `yaml:"events_kafka_rest_url"`
+	EventsKafkaTopic    string `yaml:"events_kafka_topic"`
+	// EventsQueueSize is the most events waiting to be sent before new ones are dropped
+	EventsQueueSize     int           `yaml:"events_queue_size"`
+	EventsBatchSize     int           `yaml:"events_batch_size"`
+	EventsFlushInterval time.Duration `yaml:"events_flush_interval"`
+
+	// RecordSampleRate is the share of update checks recorded with their responses, anonymized, to replay against new builds.
+	// It is between 0, which records none, and 1. Recordings are appended to RecordFile for the "file" RecordSink,
+	// or put in RecordBucket under RecordPrefix for "s3".
+	RecordSampleRate float64 `yaml:"record_sample_rate"`
+	RecordSink       string  `yaml:"record_sink"`
+	RecordFile       string  `yaml:"record_file"`
+	RecordBucket     string  `yaml:"record_bucket"`
+	RecordPrefix     string  `yaml:"record_prefix"`
+
+	// PrivacyMode scrubs client IDs and IP addresses before they reach logs, error reports and events.
+	// "hash" hashes IDs with PrivacySalt and truncates IPs, "gdpr" drops them entirely and "off" keeps them.
+	PrivacyMode string `yaml:"privacy_mode"`
+	PrivacySalt string `yaml:"privacy_salt"`
+
+	// SecretsProvider is where secrets are read from, "env", "secretsmanager" or "ssm"
+	SecretsProvider string `yaml:"secrets_provider"`
+	// AdminTokensSecret names a comma separated list of admin API tokens. TOKEN_LIST is used when it is empty.
+	AdminTokensSecret string `yaml:"admin_tokens_secret"`
+	// ViewerTokensSecret names a comma separated list of tokens which can only read the admin and stats APIs
+	ViewerTokensSecret string `yaml:"viewer_tokens_secret"`
+	// S3CredentialsSecret names JSON AWS credentials to use for the buckets instead of the default credential chain
+	S3CredentialsSecret string `yaml:"s3_credentials_secret"`
+	// ResponseSigningKeysSecret names the JSON list of Ed25519 keys update responses are signed with, see controller.ParseSigningKeys.
+	// Responses aren't signed when it is empty.
+	ResponseSigningKeysSecret string `yaml:"response_signing_keys_secret"`
+	// TUFRootVersion is the version of the TUF root metadata on /tuf/root.json, to be increased by one on every key rotation
+	TUFRootVersion int `yaml:"tuf_root_version"`
+	// OIDCIssuer lets users sign in to the admin and stats APIs with JWTs from this OpenID Connect issuer, for OIDCAudience.
+	// Users in one of OIDCReleaseManagerGroups or OIDCViewerGroups, listed in the OIDCGroupsClaim of their token, get that role.
+	OIDCIssuer               string   `yaml:"oidc_issuer"`
+	OIDCAudience             string   `yaml:"oidc_audience"`
+	OIDCGroupsClaim          string   `yaml:"oidc_groups_claim"`
+	OIDCReleaseManagerGroups []string `yaml:"oidc_release_manager_groups"`
+	OIDCViewerGroups         []string `yaml:"oidc_viewer_groups"`
+	// SecretsRefreshInterval is how often secrets are read again to pick up rotated values, or 0 to read them once
+	SecretsRefreshInterval time.Duration `yaml:"secrets_refresh_interval"`
+
+	// Tenants are independent catalogs served on /t/{name}/extensions or their own hostnames
+	Tenants []Tenant `yaml:"tenants"`
+
+	// ReleaseChannels are Slack and Discord channels told about new versions uploaded to the admin API
+	ReleaseChannels []ReleaseChannel `yaml:"release_channels"`
+
+	Limits Limits `yaml:"limits"`
+}
+
+// Tenant is an independent catalog, kept in DynamoDBTable or a memory store seeded from MemoryStoreSeed
+// depending on Store. Empty fallback URLs use the global ones, and without AdminTokensSecret
+// the global admin tokens are accepted for its admin API.
+type Tenant struct {
+	Name                        string   `yaml:"name"`
+	Hosts                       []string `yaml:"hosts"`
+	DynamoDBTable               string   `yaml:"dynamodb_table"`
+	MemoryStoreSeed             string   `yaml:"memory_store_seed"`
+	WebStoreFallbackURL         string   `yaml:"webstore_fallback_url"`
+	ComponentUpdaterFallbackURL string   `yaml:"component_updater_fallback_url"`
+	AdminTokensSecret           string   `yaml:"admin_tokens_secret"`
+}
+
+// ReleaseChannel posts uploads to the catalog of Tenant, or the default catalog when it is empty,
+// to the Slack or Discord incoming webhook URL held by WebhookURLSecret
+type ReleaseChannel struct {
+	Name             string `yaml:"name"`
+	Kind             string `yaml:"kind"`
+	Tenant           string `yaml:"tenant"`
+	WebhookURLSecret string `yaml:"webhook_url_secret"`
+}
+
+// ComponentPassthrough proxies update checks for a component to UpstreamURL with Mode proxy, or with Mode mirror
+// answers them from its catalog record for the clients on Platforms and proxies the others. Mirroring copies of
+// the component must be allowed by its license, which RedistributionLicensed confirms.
+type ComponentPassthrough struct {
+	Mode                   string   `yaml:"mode"`
+	UpstreamURL            string   `yaml:"upstream_url"`
+	Platforms              []string `yaml:"platforms"`
+	RedistributionLicensed bool     `yaml:"redistribution_licensed"`
+}
+
+// AppOverride answers update checks for an app with Action: serve from the catalog and never redirect,
+// redirect checks for only the app to UpstreamURL (and GET checks to WebStoreURL) even if the catalog has it,
+// proxy them to UpstreamURL, or block them with no update. Empty redirect URLs are the fallback URLs.
+type AppOverride struct {
+	Action      string `yaml:"action"`
+	UpstreamURL string `yaml:"upstream_url"`
+	WebStoreURL string `yaml:"webstore_url"`
+}
+
+// Limits are the timeouts and limits of the HTTP server
+type Limits struct {
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+	MaxHeaderBytes    int           `yaml:"max_header_bytes"`
+	// MaxConnections is the most connections accepted at once, or 0 for no limit
+	MaxConnections int `yaml:"max_connections"`
+	// MaxInFlight is the most requests handled at once, or 0 for no limit. Up to QueueSize more wait
+	// for at most QueueTimeout for one to finish, and the others are answered with 503.
+	MaxInFlight  int           `yaml:"max_in_flight"`
+	QueueSize    int           `yaml:"queue_size"`
+	QueueTimeout time.Duration `yaml:"queue_timeout"`
+}
+
+// Default returns the configuration used when nothing is overridden
+func Default() Config {
+	return Config{
+		Addr:                        ":8192",
+		LogLevel:                    "info",
+		CodebaseURLTemplate:         extension.DefaultCodebaseURLTemplate,
+		RefreshInterval:             10 * time.Minute,
+		Store:                       "dynamodb",
+		AWSRegion:                   "us-east-2",
+		DynamoDBScanSegments:        1,
+		StoreBreakerFailures:        5,
+		StoreBreakerTimeout:         time.Minute,
+		StoreTimeout:                30 * time.Second,
+		StoreAttempts:               4,
+		WebStoreFallbackURL:         "https://clients2.google.com/service/update2/crx",
+		ComponentUpdaterFallbackURL: "https://update.googleapis.com/service/update2",
+		RedirectMarker:              "braveRedirect=true",
+		ReleaseBucket:               "brave-core-ext",
+		CDNURLPrefixes:              map[string]string{},
+		UpdateBudgets:               map[string]int{},
+		ComponentPassthrough:        map[string]ComponentPassthrough{},
+		AppOverrides:                map[string]AppOverride{},
+		CountryHeader:               "",
+		ProtocolVersions:            []string{"3.0", "3.1"},
+		CORSAllowedMethods:          []string{"GET"},
+		CompressionMinSize:          1024,
+		MaxAppsPerResponse:          250,
+		TrustedProxies:              []string{"127.0.0.0/8", "::1/128", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7"},
+		HSTSMaxAge:                  365 * 24 * time.Hour,
+		SignedURLExpiry:             time.Hour,
+		DownloadPreference:          "cacheable",
+		MaintenanceRetryAfter:       5 * time.Minute,
+		BackgroundRetryAfter:        30 * time.Minute,
+		StatsDPrefix:                "go_update.",
+		ExtensionStatsFlushInterval: time.Minute,
+		ExtensionStatsNamespace:     "GoUpdate",
+		ExtensionStatsTable:         "ExtensionStats",
+		AuditTable:                  "AuditLog",
+		EventsQueueSize:             10000,
+		EventsBatchSize:             500,
+		EventsFlushInterval:         time.Second,
+		PrivacyMode:                 "hash",
+		SecretsProvider:             "env",
+		TUFRootVersion:              1,
+		OIDCGroupsClaim:             "groups",
+		Limits: Limits{
+			ReadTimeout:       60 * time.Second,
+			ReadHeaderTimeout: 10 * time.Second,
+			WriteTimeout:      60 * time.Second,
+			IdleTimeout:       120 * time.Second,
+			MaxHeaderBytes:    http.DefaultMaxHeaderBytes,
+			QueueTimeout:      time.Second,
+		},
+	}
+}
+
+// Load builds the configuration from the file named by the -config flag or CONFIG_FILE,
+// the environment and then the rest of args, and validates the result.
+func Load(args []string) (Config, error) {
+	config := Default()
+
+	// Flags are parsed once up front only to find the config file, and again below so they take precedence
+	path := os.Getenv("CONFIG_FILE")
+	err := config.flagSet(&path).Parse(args)
+	if err != nil {
+		return config, err
+	}
+	config = Default()
+	if len(path) != 0 {
+		err = config.loadFile(path)
+		if err != nil {
+			return config, err
+		}
+	}
+	err = config.loadEnv()
+	if err != nil {
+		return config, err
+	}
+	err = config.flagSet(&path).Parse(args)
+	if err != nil {
+		return config, err
+	}
+	return config, config.Validate()
+}
+
+func (config *Config) loadFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading config file: %v", err)
+	}
+	err = yaml.UnmarshalStrict(data, config)
+	if err != nil {
+		return fmt.Errorf("error parsing config file %s: %v", path, err)
+	}
+	prefixes := map[string]string{}
+	for country, prefix := range config.CDNURLPrefixes {
+		prefixes[strings.ToUpper(country)] = strings.TrimSuffix(prefix, "/")
+	}
+	config.CDNURLPrefixes = prefixes
+	return nil
+}
+
+func (config *Config) loadEnv() error {
+	values := map[string]*string{
+		"ADDR":                           &config.Addr,
+		"TLS_CERT":                       &config.TLSCert,
+		"TLS_KEY":                        &config.TLSKey,
+		"LOG_LEVEL":                      &config.LogLevel,
+		"OPS_ADDR":                       &config.OpsAddr,
+		"ADMIN_ADDR":                     &config.AdminAddr,
+		"ADMIN_TLS_CERT":                 &config.AdminTLSCert,
+		"ADMIN_TLS_KEY":                  &config.AdminTLSKey,
+		"ADMIN_CLIENT_CA":                &config.AdminClientCA,
+		"GRPC_ADDR":                      &config.GRPCAddr,
+		"CODEBASE_URL_TEMPLATE":          &config.CodebaseURLTemplate,
+		"WEBSTORE_FALLBACK_URL":          &config.WebStoreFallbackURL,
+		"COMPONENT_UPDATER_FALLBACK_URL": &config.ComponentUpdaterFallbackURL,
+		"REDIRECT_MARKER":                &config.RedirectMarker,
+		"AWS_REGION":                     &config.AWSRegion,
+		"DYNAMODB_ENDPOINT":              &config.DynamoDBEndpoint,
+		"CATALOG_MANIFEST":               &config.CatalogManifest,
+		"STORE":                          &config.Store,
+		"MEMORY_STORE_SEED":              &config.MemoryStoreSeed,
+		"SHADOW_STORE":                   &config.ShadowStore,
+		"SHADOW_DYNAMODB_TABLE":          &config.ShadowDynamoDBTable,
+		"SHADOW_DYNAMODB_ENDPOINT":       &config.ShadowDynamoDBEndpoint,
+		"SHADOW_MEMORY_STORE_SEED":       &config.ShadowMemoryStoreSeed,
+		"CRX_DIRECTORY":                  &config.CRXDirectory,
+		"CRX_BUCKET":                     &config.CRXBucket,
+		"RELEASE_BUCKET":                 &config.ReleaseBucket,
+		"COUNTRY_HEADER":                 &config.CountryHeader,
+		"CDN_PURGE":                      &config.CDNPurge,
+		"FASTLY_SERVICE_ID":              &config.FastlyServiceID,
+		"FASTLY_TOKEN_SECRET":            &config.FastlyTokenSecret,
+		"CLOUDFRONT_DISTRIBUTION_ID":     &config.CloudFrontDistributionID,
+		"SIGNED_URL_BUCKET":              &config.SignedURLBucket,
+		"FORCE_INSTALL_FILE":             &config.ForceInstallFile,
+		"TRANSPARENCY_LOG_FILE":          &config.TransparencyLogFile,
+		"SERVING_WINDOWS_FILE":           &config.ServingWindowsFile,
+		"POLICY_UPDATE_URL":              &config.PolicyUpdateURL,
+		"DOWNLOAD_PREFERENCE":            &config.DownloadPreference,
+		"STATSD_ADDR":                    &config.StatsDAddr,
+		"STATSD_PREFIX":                  &config.StatsDPrefix,
+		"EXTENSION_STATS_SINK":           &config.ExtensionStatsSink,
+		"AUDIT_SINK":                     &config.AuditSink,
+		"AUDIT_LOG_FILE":                 &config.AuditLogFile,
+		"AUDIT_TABLE":                    &config.AuditTable,
+		"EXTENSION_STATS_NAMESPACE":      &config.ExtensionStatsNamespace,
+		"EXTENSION_STATS_TABLE":          &config.ExtensionStatsTable,
+		"EVENTS_SINK":                    &config.EventsSink,
+		"EVENTS_KINESIS_STREAM":          &config.EventsKinesisStream,
+		"EVENTS_KAFKA_REST_URL":          &config.EventsKafkaRESTURL,
+		"EVENTS_KAFKA_TOPIC":             &config.EventsKafkaTopic,
+		"RECORD_SINK":                    &config.RecordSink,
+		"RECORD_FILE":                    &config.RecordFile,
+		"RECORD_BUCKET":                  &config.RecordBucket,
+		"RECORD_PREFIX":                  &config.RecordPrefix,
+		"PRIVACY_MODE":                   &config.PrivacyMode,
+		"PRIVACY_SALT":                   &config.PrivacySalt,
+		"SECRETS_PROVIDER":               &config.SecretsProvider,
+		"ADMIN_TOKENS_SECRET":            &config.AdminTokensSecret,
+		"VIEWER_TOKENS_SECRET":           &config.ViewerTokensSecret,
+		"OIDC_ISSUER":                    &config.OIDCIssuer,
+		"OIDC_AUDIENCE":                  &config.OIDCAudience,
+		"OIDC_GROUPS_CLAIM":              &config.OIDCGroupsClaim,
+		"S3_CREDENTIALS_SECRET":          &config.S3CredentialsSecret,
+		"RESPONSE_SIGNING_KEYS_SECRET":   &config.ResponseSigningKeysSecret,
+	}
+	for key, s := range values {
+		if value, ok := os.LookupEnv(key); ok {
+			*s = value
+		}
+	}
+
+	bools := map[string]*bool{
+		"FROZEN_CATALOG":            &config.FrozenCatalog,
+		"CHAOS_MODE":                &config.ChaosMode,
+		"VERIFY_PAYLOADS":           &config.VerifyPayloads,
+		"CHECK_LINKS":               &config.CheckLinks,
+		"SUPPRESS_MISSING_PACKAGES": &config.SuppressMissingPackages,
+		"MAINTENANCE_MODE":          &config.MaintenanceMode,
+		"MIRROR_PROTOCOL":           &config.MirrorProtocol,
+		"HTTPS_REDIRECT":            &config.HTTPSRedirect,
+		"HTTP3":                     &config.HTTP3,
+		"FASTLY_SOFT_PURGE":         &config.FastlySoftPurge,
+	}
+	for key, b := range bools {
+		if value, ok := os.LookupEnv(key); ok {
+			*b = value == "true"
+		}
+	}
+
+	durations := map[string]*time.Duration{
+		"REFRESH_INTERVAL":               &config.RefreshInterval,
+		"WEBSTORE_CACHE_MAX_AGE":         &config.WebStoreCacheMaxAge,
+		"STORE_BREAKER_TIMEOUT":          &config.StoreBreakerTimeout,
+		"STORE_TIMEOUT":                  &config.StoreTimeout,
+		"MAINTENANCE_RETRY_AFTER":        &config.MaintenanceRetryAfter,
+		"BACKGROUND_RETRY_AFTER":         &config.BackgroundRetryAfter,
+		"REQUEST_DEDUP_TTL":              &config.RequestDedupTTL,
+		"RETRY_WINDOW":                   &config.RetryWindow,
+		"CANARY_INTERVAL":                &config.CanaryInterval,
+		"HSTS_MAX_AGE":                   &config.HSTSMaxAge,
+		"SIGNED_URL_EXPIRY":              &config.SignedURLExpiry,
+		"SECRETS_REFRESH_INTERVAL":       &config.SecretsRefreshInterval,
+		"EXTENSION_STATS_FLUSH_INTERVAL": &config.ExtensionStatsFlushInterval,
+		"EVENTS_FLUSH_INTERVAL":          &config.EventsFlushInterval,
+		"SERVER_READ_TIMEOUT":            &config.Limits.ReadTimeout,
+		"SERVER_READ_HEADER_TIMEOUT":     &config.Limits.ReadHeaderTimeout,
+		"SERVER_WRITE_TIMEOUT":           &config.Limits.WriteTimeout,
+		"SERVER_IDLE_TIMEOUT":            &config.Limits.IdleTimeout,
+		"SERVER_QUEUE_TIMEOUT":           &config.Limits.QueueTimeout,
+	}
+	for key, d := range durations {
+		if value, ok := os.LookupEnv(key); ok {
+			parsed, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("%s: %v", key, err)
+			}
+			*d = parsed
+		}
+	}
+
+	ints := map[string]*int{
+		"STORE_ATTEMPTS":            &config.StoreAttempts,
+		"DYNAMODB_SCAN_SEGMENTS":    &config.DynamoDBScanSegments,
+		"SERVER_MAX_HEADER_BYTES":   &config.Limits.MaxHeaderBytes,
+		"SERVER_MAX_CONNECTIONS":    &config.Limits.MaxConnections,
+		"SERVER_MAX_IN_FLIGHT":      &config.Limits.MaxInFlight,
+		"SERVER_QUEUE_SIZE":         &config.Limits.QueueSize,
+		"EVENTS_QUEUE_SIZE":         &config.EventsQueueSize,
+		"BACKGROUND_SHED_THRESHOLD": &config.BackgroundShedThreshold,
+		"EVENTS_BATCH_SIZE":         &config.EventsBatchSize,
+		"TUF_ROOT_VERSION":          &config.TUFRootVersion,
+		"COMPRESSION_MIN_SIZE":      &config.CompressionMinSize,
+		"MAX_APPS_PER_RESPONSE":     &config.MaxAppsPerResponse,
+	}
+	for key, i := range ints {
+		if value, ok := os.LookupEnv(key); ok {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("%s: %q is not a number", key, value)
+			}
+			*i = parsed
+		}
+	}
+
+	if value, ok := os.LookupEnv("RECORD_SAMPLE_RATE"); ok {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("RECORD_SAMPLE_RATE: %q is not a number", value)
+		}
+		config.RecordSampleRate = parsed
+	}
+
+	if value, ok := os.LookupEnv("STORE_BREAKER_FAILURES"); ok {
+		parsed, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return fmt.Errorf("STORE_BREAKER_FAILURES: %q is not a number", value)
+		}
+		config.StoreBreakerFailures = uint32(parsed)
+	}
+	if value, ok := os.LookupEnv("DYNAMODB_FAILOVER_REGIONS"); ok {
+		config.DynamoDBFailoverRegions = splitList(value)
+	}
+	if value, ok := os.LookupEnv("TRUSTED_PROXIES"); ok {
+		config.TrustedProxies = splitList(value)
+	}
+	if value, ok := os.LookupEnv("CORS_ALLOWED_ORIGINS"); ok {
+		config.CORSAllowedOrigins = splitList(value)
+	}
+	if value, ok := os.LookupEnv("CORS_ALLOWED_METHODS"); ok {
+		config.CORSAllowedMethods = splitList(value)
+	}
+	if value, ok := os.LookupEnv("OIDC_RELEASE_MANAGER_GROUPS"); ok {
+		config.OIDCReleaseManagerGroups = splitList(value)
+	}
+	if value, ok := os.LookupEnv("OIDC_VIEWER_GROUPS"); ok {
+		config.OIDCViewerGroups = splitList(value)
+	}
+	if value, ok := os.LookupEnv("PROTOCOL_VERSIONS"); ok {
+		config.ProtocolVersions = splitList(value)
+	}
+	if value, ok := os.LookupEnv("WARM_UP_EXTENSIONS"); ok {
+		config.WarmUpExtensions = splitList(value)
+	}
+	if value, ok := os.LookupEnv("STATSD_TAGS"); ok {
+		config.StatsDTags = splitList(value)
+	}
+	if value, ok := os.LookupEnv("CDN_URL_PREFIXES"); ok {
+		config.CDNURLPrefixes = ParseCDNURLPrefixes(value)
+	}
+	if value, ok := os.LookupEnv("UPDATE_BUDGETS"); ok {
+		budgets, err := ParseUpdateBudgets(value)
+		if err != nil {
+			return fmt.Errorf("UPDATE_BUDGETS: %v", err)
+		}
+		config.UpdateBudgets = budgets
+	}
+	return nil
+}
+
+func (config *Config) flagSet(path *string) *flag.FlagSet {
+	fs := flag.NewFlagSet("go-update", flag.ContinueOnError)
+	fs.StringVar(path, "config", *path, "YAML config file")
+	fs.StringVar(&config.Addr, "addr", config.Addr, "address to listen on, a host:port, unix:PATH, systemd or systemd:NAME")
+	fs.StringVar(&config.TLSCert, "tls-cert", config.TLSCert, "PEM certificate to serve HTTPS and HTTP/2 with")
+	fs.StringVar(&config.TLSKey, "tls-key", config.TLSKey, "PEM private key to serve HTTPS and HTTP/2 with")
+	fs.BoolVar(&config.HTTP3, "http3", config.HTTP3, "also serve HTTP/3 over QUIC, experimental")
+	fs.StringVar(&config.OpsAddr, "ops-addr", config.OpsAddr, "internal address to serve health checks, metrics, pprof and expvar on, like 127.0.0.1:6060")
+	fs.StringVar(&config.AdminAddr, "admin-addr", config.AdminAddr, "separate address to serve the admin API on to clients with a certificate, like :8443")
+	fs.StringVar(&config.AdminTLSCert, "admin-tls-cert", config.AdminTLSCert, "PEM certificate of the admin listener")
+	fs.StringVar(&config.AdminTLSKey, "admin-tls-key", config.AdminTLSKey, "PEM private key of the admin listener")
+	fs.StringVar(&config.AdminClientCA, "admin-client-ca", config.AdminClientCA, "PEM bundle of the CAs admin clients' certificates are issued by")
+	fs.Var(listValue{&config.CORSAllowedOrigins}, "cors-allowed-origins", "comma separated origins of dashboards which may call the APIs from a browser")
+	fs.Var(listValue{&config.CORSAllowedMethods}, "cors-allowed-methods", "comma separated methods those dashboards may use")
+	fs.IntVar(&config.CompressionMinSize, "compression-min-size", config.CompressionMinSize, "smallest response compressed for clients accepting brotli or gzip, in bytes, 0 to disable")
+	fs.StringVar(&config.GRPCAddr, "grpc-addr", config.GRPCAddr, "address to serve the gRPC admin service on, like :9090")
+	fs.StringVar(&config.LogLevel, "log-level", config.LogLevel, "lowest level of messages logged")
+	fs.StringVar(&config.CodebaseURLTemplate, "codebase-url-template", config.CodebaseURLTemplate, "download URL template for extensions")
+	fs.DurationVar(&config.RefreshInterval, "refresh-interval", config.RefreshInterval, "how often the extensions catalog is reloaded")
+	fs.StringVar(&config.AWSRegion, "aws-region", config.AWSRegion, "region of the Extensions table and the buckets")
+	fs.Var(listValue{&config.DynamoDBFailoverRegions}, "dynamodb-failover-regions", "comma separated regions to use when the primary region fails")
+	fs.StringVar(&config.DynamoDBEndpoint, "dynamodb-endpoint", config.DynamoDBEndpoint, "DynamoDB endpoint override, for example for DynamoDB Local")
+	fs.IntVar(&config.DynamoDBScanSegments, "dynamodb-scan-segments", config.DynamoDBScanSegments, "how many segments the catalog is scanned in parallel")
+	fs.Var(uint32Value{&config.StoreBreakerFailures}, "store-breaker-failures", "DynamoDB failures in a row which stop further calls")
+	fs.DurationVar(&config.StoreBreakerTimeout, "store-breaker-timeout", config.StoreBreakerTimeout, "how long DynamoDB calls are stopped after failures")
+	fs.DurationVar(&config.StoreTimeout, "store-timeout", config.StoreTimeout, "deadline for each DynamoDB operation including retries")
+	fs.IntVar(&config.StoreAttempts, "store-attempts", config.StoreAttempts, "most times a DynamoDB operation is tried")
+	fs.BoolVar(&config.FrozenCatalog, "frozen-catalog", config.FrozenCatalog, "never refresh or change the catalog loaded at startup")
+	fs.BoolVar(&config.ChaosMode, "chaos-mode", config.ChaosMode, "allow injecting faults into update checks, for testing clients only")
+	fs.StringVar(&config.CatalogManifest, "catalog-manifest", config.CatalogManifest, "JSON file to load the catalog from instead of DynamoDB")
+	fs.StringVar(&config.Store, "store", config.Store, "where the catalog is kept, dynamodb or memory")
+	fs.StringVar(&config.MemoryStoreSeed, "memory-store-seed", config.MemoryStoreSeed, "JSON file to seed the memory store from")
+	fs.StringVar(&config.ShadowStore, "shadow-store", config.ShadowStore, "store the catalog is compared with in the background, dynamodb or memory")
+	fs.StringVar(&config.ShadowDynamoDBTable, "shadow-dynamodb-table", config.ShadowDynamoDBTable, "DynamoDB table of the shadow store")
+	fs.StringVar(&config.ShadowDynamoDBEndpoint, "shadow-dynamodb-endpoint", config.ShadowDynamoDBEndpoint, "DynamoDB endpoint override for the shadow store")
+	fs.StringVar(&config.ShadowMemoryStoreSeed, "shadow-memory-store-seed", config.ShadowMemoryStoreSeed, "JSON file to seed the memory shadow store from")
+	fs.StringVar(&config.WebStoreFallbackURL, "webstore-fallback-url", config.WebStoreFallbackURL, "where GET requests for unknown extensions are redirected")
+	fs.DurationVar(&config.WebStoreCacheMaxAge, "webstore-cache-max-age", config.WebStoreCacheMaxAge, "how long CDNs may cache GET update check responses, 0 to revalidate every time")
+	fs.Var(updateBudgetsValue{&config.UpdateBudgets}, "update-budgets", "most updates offered per minute by extension, for example jicbkmdloagakknpihibphagfckhjdih=600")
+	fs.IntVar(&config.MaxAppsPerResponse, "max-apps-per-response", config.MaxAppsPerResponse, "most apps answered in one update check response, 0 for no limit")
+	fs.StringVar(&config.ComponentUpdaterFallbackURL, "component-updater-fallback-url", config.ComponentUpdaterFallbackURL, "where POST requests for unknown extensions are redirected")
+	fs.StringVar(&config.RedirectMarker, "redirect-marker", config.RedirectMarker, "name=value query parameter added to redirected update checks, empty to add none")
+	fs.StringVar(&config.CRXDirectory, "crx-directory", config.CRXDirectory, "local directory to serve CRX payloads from")
+	fs.StringVar(&config.CRXBucket, "crx-bucket", config.CRXBucket, "S3 bucket to proxy CRX payloads from")
+	fs.StringVar(&config.ReleaseBucket, "release-bucket", config.ReleaseBucket, "S3 bucket uploaded extensions are published to")
+	fs.StringVar(&config.CountryHeader, "country-header", config.CountryHeader, "header containing the client's country code")
+	fs.StringVar(&config.CDNPurge, "cdn-purge", config.CDNPurge, "CDN to purge cached update checks from when the catalog changes, fastly or cloudfront")
+	fs.StringVar(&config.FastlyServiceID, "fastly-service-id", config.FastlyServiceID, "Fastly service to purge")
+	fs.StringVar(&config.FastlyTokenSecret, "fastly-token-secret", config.FastlyTokenSecret, "secret holding the Fastly API token")
+	fs.BoolVar(&config.FastlySoftPurge, "fastly-soft-purge", config.FastlySoftPurge, "mark purged responses stale rather than removing them")
+	fs.StringVar(&config.CloudFrontDistributionID, "cloudfront-distribution-id", config.CloudFrontDistributionID, "CloudFront distribution to invalidate")
+	fs.Var(listValue{&config.TrustedProxies}, "trusted-proxies", "comma separated CIDR blocks of proxies whose forwarding headers are believed")
+	fs.DurationVar(&config.HSTSMaxAge, "hsts-max-age", config.HSTSMaxAge, "max-age of the Strict-Transport-Security header, 0 not to send it")
+	fs.BoolVar(&config.HTTPSRedirect, "https-redirect", config.HTTPSRedirect, "redirect update checks over plain HTTP to HTTPS")
+	fs.Var(listValue{&config.ProtocolVersions}, "protocol-versions", "comma separated update protocol versions to accept, like 3.0,3.1")
+	fs.BoolVar(&config.MirrorProtocol, "mirror-protocol", config.MirrorProtocol, "answer with the protocol version of the request")
+	fs.StringVar(&config.ForceInstallFile, "force-install-file", config.ForceInstallFile, "JSON file the force install policy list is kept in")
+	fs.StringVar(&config.ServingWindowsFile, "serving-windows-file", config.ServingWindowsFile, "JSON file the serving windows of extensions are kept in")
+	fs.StringVar(&config.TransparencyLogFile, "transparency-log-file", config.TransparencyLogFile, "file the transparency log of served versions is appended to")
+	fs.StringVar(&config.PolicyUpdateURL, "policy-update-url", config.PolicyUpdateURL, "update URL of force installed extensions")
+	fs.StringVar(&config.SignedURLBucket, "signed-url-bucket", config.SignedURLBucket, "S3 bucket to also list presigned download URLs for")
+	fs.DurationVar(&config.SignedURLExpiry, "signed-url-expiry", config.SignedURLExpiry, "how long presigned download URLs are valid for")
+	fs.StringVar(&config.DownloadPreference, "download-preference", config.DownloadPreference, "download URL listed first, cacheable or signed")
+	fs.BoolVar(&config.MaintenanceMode, "maintenance-mode", config.MaintenanceMode, "answer update checks with 503")
+	fs.DurationVar(&config.MaintenanceRetryAfter, "maintenance-retry-after", config.MaintenanceRetryAfter, "how long clients wait before checking again during maintenance")
+	fs.IntVar(&config.BackgroundShedThreshold, "background-shed-threshold", config.BackgroundShedThreshold, "update checks in flight before background checks are deferred, 0 to never defer them")
+	fs.DurationVar(&config.BackgroundRetryAfter, "background-retry-after", config.BackgroundRetryAfter, "how long deferred background checks wait before checking again")
+	fs.DurationVar(&config.CanaryInterval, "canary-interval", config.CanaryInterval, "how often every extension is checked end to end through the server, 0 not to")
+	fs.Var(listValue{&config.WarmUpExtensions}, "warm-up-extensions", "comma separated IDs of the most requested extensions, whose responses are built before listening")
+	fs.DurationVar(&config.RequestDedupTTL, "request-dedup-ttl", config.RequestDedupTTL, "how long update check responses are kept for retries, 0 not to keep them")
+	fs.DurationVar(&config.RetryWindow, "retry-window", config.RetryWindow, "how long update check bodies are remembered to detect retries, 0 not to")
+	fs.BoolVar(&config.VerifyPayloads, "verify-payloads", config.VerifyPayloads, "verify the CRX of every new extension version")
+	fs.BoolVar(&config.CheckLinks, "check-links", config.CheckLinks, "check the download URL of every extension")
+	fs.BoolVar(&config.SuppressMissingPackages, "suppress-missing-packages", config.SuppressMissingPackages, "don't offer updates whose download URL is broken")
+	fs.StringVar(&config.StatsDAddr, "statsd-addr", config.StatsDAddr, "StatsD server or Datadog agent to send metrics to")
+	fs.StringVar(&config.StatsDPrefix, "statsd-prefix", config.StatsDPrefix, "prefix for StatsD metric names")
+	fs.Var(listValue{&config.StatsDTags}, "statsd-tags", "comma separated tags for every StatsD metric, like env:prod")
+	fs.StringVar(&config.ExtensionStatsSink, "extension-stats-sink", config.ExtensionStatsSink, "where update and download counts are flushed, cloudwatch or dynamodb")
+	fs.StringVar(&config.AuditSink, "audit-sink", config.AuditSink, "where changes made with the admin API are recorded, file or dynamodb")
+	fs.StringVar(&config.AuditLogFile, "audit-log-file", config.AuditLogFile, "file the audit log is appended to")
+	fs.StringVar(&config.AuditTable, "audit-table", config.AuditTable, "DynamoDB table the audit log is kept in")
+	fs.DurationVar(&config.ExtensionStatsFlushInterval, "extension-stats-flush-interval", config.ExtensionStatsFlushInterval, "how often update and download counts are flushed")
+	fs.StringVar(&config.ExtensionStatsNamespace, "extension-stats-namespace", config.ExtensionStatsNamespace, "CloudWatch namespace for update and download counts")
+	fs.StringVar(&config.ExtensionStatsTable, "extension-stats-table", config.ExtensionStatsTable, "DynamoDB table for update and download counts")
+	fs.StringVar(&config.EventsSink, "events-sink", config.EventsSink, "where update check events are streamed, kinesis or kafka")
+	fs.StringVar(&config.EventsKinesisStream, "events-kinesis-stream", config.EventsKinesisStream, "Kinesis stream for update check events")
+	fs.StringVar(&config.EventsKafkaRESTURL, "events-kafka-rest-url", config.EventsKafkaRESTURL, "Kafka REST proxy for update check events")
+	fs.StringVar(&config.EventsKafkaTopic, "events-kafka-topic", config.EventsKafkaTopic, "Kafka topic for update check events")
+	fs.IntVar(&config.EventsQueueSize, "events-queue-size", config.EventsQueueSize, "most update check events waiting to be sent")
+	fs.IntVar(&config.EventsBatchSize, "events-batch-size", config.EventsBatchSize, "most update check events sent at once")
+	fs.DurationVar(&config.EventsFlushInterval, "events-flush-interval", config.EventsFlushInterval, "longest an update check event waits to be sent")
+	fs.Float64Var(&config.RecordSampleRate, "record-sample-rate", config.RecordSampleRate, "share of update checks recorded for replaying, between 0 and 1")
+	fs.StringVar(&config.RecordSink, "record-sink", config.RecordSink, "where recorded update checks are written, file or s3")
+	fs.StringVar(&config.RecordFile, "record-file", config.RecordFile, "file recorded update checks are appended to")
+	fs.StringVar(&config.RecordBucket, "record-bucket", config.RecordBucket, "S3 bucket recorded update checks are put in")
+	fs.StringVar(&config.RecordPrefix, "record-prefix", config.RecordPrefix, "prefix of the S3 objects of recorded update checks")
+	fs.StringVar(&config.PrivacyMode, "privacy-mode", config.PrivacyMode, "how client IDs and IPs are scrubbed, hash, gdpr or off")
+	fs.StringVar(&config.PrivacySalt, "privacy-salt", config.PrivacySalt, "salt for hashing client IDs, random if not set")
+	fs.StringVar(&config.SecretsProvider, "secrets-provider", config.SecretsProvider, "where secrets are read from, env, secretsmanager or ssm")
+	fs.StringVar(&config.AdminTokensSecret, "admin-tokens-secret", config.AdminTokensSecret, "secret holding comma separated admin API tokens")
+	fs.StringVar(&config.ViewerTokensSecret, "viewer-tokens-secret", config.ViewerTokensSecret, "secret holding comma separated read only admin API tokens")
+	fs.StringVar(&config.OIDCIssuer, "oidc-issuer", config.OIDCIssuer, "OpenID Connect issuer admin API users sign in with")
+	fs.StringVar(&config.OIDCAudience, "oidc-audience", config.OIDCAudience, "audience of OpenID Connect tokens for the admin API")
+	fs.StringVar(&config.OIDCGroupsClaim, "oidc-groups-claim", config.OIDCGroupsClaim, "claim listing the groups of an OpenID Connect user")
+	fs.Var(listValue{&config.OIDCReleaseManagerGroups}, "oidc-release-manager-groups", "comma separated groups with the release manager role")
+	fs.Var(listValue{&config.OIDCViewerGroups}, "oidc-viewer-groups", "comma separated groups with the viewer role")
+	fs.StringVar(&config.S3CredentialsSecret, "s3-credentials-secret", config.S3CredentialsSecret, "secret holding JSON AWS credentials for the buckets")
+	fs.StringVar(&config.ResponseSigningKeysSecret, "response-signing-keys-secret", config.ResponseSigningKeysSecret, "secret holding the JSON Ed25519 keys update responses are signed with")
+	fs.IntVar(&config.TUFRootVersion, "tuf-root-version", config.TUFRootVersion, "version of the TUF root metadata, increased on every key rotation")
+	fs.DurationVar(&config.SecretsRefreshInterval, "secrets-refresh-interval", config.SecretsRefreshInterval, "how often secrets are read again, 0 to read them once")
+	fs.DurationVar(&config.Limits.ReadTimeout, "read-timeout", config.Limits.ReadTimeout, "HTTP server read timeout")
+	fs.DurationVar(&config.Limits.ReadHeaderTimeout, "read-header-timeout", config.Limits.ReadHeaderTimeout, "HTTP server read header timeout")
+	fs.DurationVar(&config.Limits.WriteTimeout, "write-timeout", config.Limits.WriteTimeout, "HTTP server write timeout")
+	fs.DurationVar(&config.Limits.IdleTimeout, "idle-timeout", config.Limits.IdleTimeout, "HTTP server idle timeout")
+	fs.IntVar(&config.Limits.MaxHeaderBytes, "max-header-bytes", config.Limits.MaxHeaderBytes, "largest request header accepted")
+	fs.IntVar(&config.Limits.MaxConnections, "max-connections", config.Limits.MaxConnections, "most connections accepted at once, 0 for no limit")
+	fs.IntVar(&config.Limits.MaxInFlight, "max-in-flight", config.Limits.MaxInFlight, "most requests handled at once, 0 for no limit")
+	fs.IntVar(&config.Limits.QueueSize, "queue-size", config.Limits.QueueSize, "requests waiting for one in flight to finish before others are answered with 503")
+	fs.DurationVar(&config.Limits.QueueTimeout, "queue-timeout", config.Limits.QueueTimeout, "longest a request waits in the queue before it is answered with 503")
+	fs.Var(cdnURLPrefixesValue{&config.CDNURLPrefixes}, "cdn-url-prefixes", "regional download mirrors, for example JP=https://jp.example.com")
+	return fs
+}
+
+// Validate checks that the configuration is usable, returning every problem found
+func (config *Config) Validate() error {
+	problems := []string{}
+	switch {
+	case len(config.Addr) == 0:
+		problems = append(problems, "addr must be set")
+	case config.Addr == "unix:":
+		problems = append(problems, "addr unix: must have the path of the socket")
+	case strings.HasPrefix(config.Addr, "unix:") || config.Addr == "systemd" || strings.HasPrefix(config.Addr, "systemd:"):
+		if config.HTTP3 {
+			problems = append(problems, "http3 requires addr to be a host:port")
+		}
+	default:
+		if _, _, err := net.SplitHostPort(config.Addr); err != nil {
+			problems = append(problems, fmt.Sprintf("addr %q must be a host:port, unix:PATH, systemd or systemd:NAME", config.Addr))
+		}
+	}
+	if _, err := logrus.ParseLevel(config.LogLevel); err != nil {
+		problems = append(problems, fmt.Sprintf("log_level %q is not a valid level", config.LogLevel))
+	}
+	if !strings.Contains(config.CodebaseURLTemplate, "{id}") {
+		problems = append(problems, "codebase_url_template must contain {id}")
+	}
+	if config.RefreshInterval <= 0 {
+		problems = append(problems, "refresh_interval must be positive")
+	}
+	urls := map[string]string{
+		"webstore_fallback_url":          config.WebStoreFallbackURL,
+		"component_updater_fallback_url": config.ComponentUpdaterFallbackURL,
+	}
+	for country, prefix := range config.CDNURLPrefixes {
+		urls["cdn_url_prefixes "+country] = prefix
+	}
+	if len(config.PolicyUpdateURL) != 0 {
+		urls["policy_update_url"] = config.PolicyUpdateURL
+	}
+	if len(config.OIDCIssuer) != 0 {
+		urls["oidc_issuer"] = config.OIDCIssuer
+		if len(config.OIDCAudience) == 0 {
+			problems = append(problems, "oidc_audience must be set with oidc_issuer")
+		}
+		if len(config.OIDCReleaseManagerGroups) == 0 && len(config.OIDCViewerGroups) == 0 {
+			problems = append(problems, "oidc_release_manager_groups or oidc_viewer_groups must be set with oidc_issuer")
+		}
+	}
+	for _, tenant := range config.Tenants {
+		if len(tenant.WebStoreFallbackURL) != 0 {
+			urls["tenant "+tenant.Name+" webstore_fallback_url"] = tenant.WebStoreFallbackURL
+		}
+		if len(tenant.ComponentUpdaterFallbackURL) != 0 {
+			urls["tenant "+tenant.Name+" component_updater_fallback_url"] = tenant.ComponentUpdaterFallbackURL
+		}
+	}
+	for id, passthrough := range config.ComponentPassthrough {
+		switch passthrough.Mode {
+		case "proxy":
+			if len(passthrough.UpstreamURL) == 0 {
+				problems = append(problems, fmt.Sprintf("component_passthrough %s must set upstream_url to proxy", id))
+			}
+		case "mirror":
+			if !passthrough.RedistributionLicensed {
+				problems = append(problems, fmt.Sprintf("component_passthrough %s can only be mirrored with redistribution_licensed", id))
+			}
+			if len(passthrough.Platforms) == 0 {
+				problems = append(problems, fmt.Sprintf("component_passthrough %s must list the platforms it is mirrored for", id))
+			}
+		default:
+			problems = append(problems, fmt.Sprintf("component_passthrough %s mode %q must be proxy or mirror", id, passthrough.Mode))
+		}
+		if len(passthrough.UpstreamURL) != 0 {
+			urls["component_passthrough "+id+" upstream_url"] = passthrough.UpstreamURL
+		}
+	}
+	for id, override := range config.AppOverrides {
+		switch override.Action {
+		case "serve", "block":
+			if len(override.UpstreamURL) != 0 || len(override.WebStoreURL) != 0 {
+				problems = append(problems, fmt.Sprintf("app_overrides %s can't set URLs to %s", id, override.Action))
+			}
+		case "redirect":
+		case "proxy":
+			if len(override.UpstreamURL) == 0 {
+				problems = append(problems, fmt.Sprintf("app_overrides %s must set upstream_url to proxy", id))
+			}
+		default:
+			problems = append(problems, fmt.Sprintf("app_overrides %s action %q must be serve, redirect, proxy or block", id, override.Action))
+		}
+		if _, ok := config.ComponentPassthrough[id]; ok {
+			problems = append(problems, fmt.Sprintf("app_overrides %s is also in component_passthrough", id))
+		}
+		if len(override.UpstreamURL) != 0 {
+			urls["app_overrides "+id+" upstream_url"] = override.UpstreamURL
+		}
+		if len(override.WebStoreURL) != 0 {
+			urls["app_overrides "+id+" webstore_url"] = override.WebStoreURL
+		}
+	}
+	for name, value := range urls {
+		u, err := url.Parse(value)
+		if err != nil || u.Scheme != "https" || len(u.Host) == 0 {
+			problems = append(problems, fmt.Sprintf("%s must be an https URL, not %q", name, value))
+		}
+	}
+	if len(config.AWSRegion) == 0 {
+		problems = append(problems, "aws_region must be set")
+	}
+	for _, region := range config.DynamoDBFailoverRegions {
+		if region == config.AWSRegion {
+			problems = append(problems, fmt.Sprintf("dynamodb_failover_regions must not include aws_region %s", region))
+		}
+	}
+	if config.DynamoDBScanSegments < 1 {
+		problems = append(problems, "dynamodb_scan_segments must be at least 1")
+	}
+	if config.StoreBreakerFailures == 0 {
+		problems = append(problems, "store_breaker_failures must be positive")
+	}
+	if config.StoreBreakerTimeout <= 0 {
+		problems = append(problems, "store_breaker_timeout must be positive")
+	}
+	if config.StoreTimeout <= 0 {
+		problems = append(problems, "store_timeout must be positive")
+	}
+	if config.StoreAttempts < 1 {
+		problems = append(problems, "store_attempts must be at least 1")
+	}
+	if config.Store != "dynamodb" && config.Store != "memory" {
+		problems = append(problems, fmt.Sprintf("store %q must be dynamodb or memory", config.Store))
+	}
+	if len(config.MemoryStoreSeed) != 0 {
+		if err := checkExtensionsFile(config.MemoryStoreSeed); err != nil {
+			problems = append(problems, fmt.Sprintf("memory_store_seed: %v", err))
+		}
+	}
+	switch config.ShadowStore {
+	case "":
+	case "dynamodb":
+		if len(config.ShadowDynamoDBTable) == 0 {
+			problems = append(problems, "shadow_dynamodb_table must be set for the dynamodb shadow_store")
+		}
+	case "memory":
+		if len(config.ShadowMemoryStoreSeed) != 0 {
+			if err := checkExtensionsFile(config.ShadowMemoryStoreSeed); err != nil {
+				problems = append(problems, fmt.Sprintf("shadow_memory_store_seed: %v", err))
+			}
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("shadow_store %q must be dynamodb or memory", config.ShadowStore))
+	}
+	tenantNames := map[string]bool{}
+	tenantHosts := map[string]bool{}
+	for _, tenant := range config.Tenants {
+		if !tenantNameRegexp.MatchString(tenant.Name) {
+			problems = append(problems, fmt.Sprintf("tenant name %q must be lowercase letters, digits and dashes", tenant.Name))
+		}
+		if tenantNames[tenant.Name] {
+			problems = append(problems, fmt.Sprintf("tenant %s is listed more than once", tenant.Name))
+		}
+		tenantNames[tenant.Name] = true
+		for _, host := range tenant.Hosts {
+			if tenantHosts[strings.ToLower(host)] {
+				problems = append(problems, fmt.Sprintf("tenant host %s is listed more than once", host))
+			}
+			tenantHosts[strings.ToLower(host)] = true
+		}
+		if config.Store == "dynamodb" && len(tenant.DynamoDBTable) == 0 {
+			problems = append(problems, fmt.Sprintf("tenant %s must set dynamodb_table", tenant.Name))
+		}
+		if len(tenant.MemoryStoreSeed) != 0 {
+			if err := checkExtensionsFile(tenant.MemoryStoreSeed); err != nil {
+				problems = append(problems, fmt.Sprintf("tenant %s memory_store_seed: %v", tenant.Name, err))
+			}
+		}
+	}
+	channelNames := map[string]bool{}
+	for _, channel := range config.ReleaseChannels {
+		if len(channel.Name) == 0 || channelNames[channel.Name] {
+			problems = append(problems, fmt.Sprintf("release channel name %q must be set and unique", channel.Name))
+		}
+		channelNames[channel.Name] = true
+		if channel.Kind != "slack" && channel.Kind != "discord" {
+			problems = append(problems, fmt.Sprintf("release channel %s kind %q must be slack or discord", channel.Name, channel.Kind))
+		}
+		if len(channel.Tenant) != 0 && !tenantNames[channel.Tenant] {
+			problems = append(problems, fmt.Sprintf("release channel %s is for unknown tenant %s", channel.Name, channel.Tenant))
+		}
+		if len(channel.WebhookURLSecret) == 0 {
+			problems = append(problems, fmt.Sprintf("release channel %s must set webhook_url_secret", channel.Name))
+		}
+	}
+	if len(config.ForceInstallFile) != 0 {
+		if err := checkForceInstallFile(config.ForceInstallFile); err != nil {
+			problems = append(problems, fmt.Sprintf("force_install_file: %v", err))
+		}
+	}
+	if len(config.ServingWindowsFile) != 0 {
+		if info, err := os.Stat(filepath.Dir(config.ServingWindowsFile)); err != nil || !info.IsDir() {
+			problems = append(problems, fmt.Sprintf("serving_windows_file must be in an existing directory, not %s", filepath.Dir(config.ServingWindowsFile)))
+		}
+	}
+	if len(config.TransparencyLogFile) != 0 {
+		if info, err := os.Stat(filepath.Dir(config.TransparencyLogFile)); err != nil || !info.IsDir() {
+			problems = append(problems, fmt.Sprintf("transparency_log_file must be in an existing directory, not %s", filepath.Dir(config.TransparencyLogFile)))
+		}
+	}
+	if len(config.CatalogManifest) != 0 {
+		if _, err := os.Stat(config.CatalogManifest); err != nil {
+			problems = append(problems, fmt.Sprintf("catalog_manifest %s can't be read", config.CatalogManifest))
+		}
+	}
+	if len(config.CRXDirectory) != 0 {
+		info, err := os.Stat(config.CRXDirectory)
+		if err != nil || !info.IsDir() {
+			problems = append(problems, fmt.Sprintf("crx_directory %s is not a directory", config.CRXDirectory))
+		}
+	}
+	for _, cidr := range config.TrustedProxies {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			problems = append(problems, fmt.Sprintf("trusted_proxies %q must be a CIDR block", cidr))
+		}
+	}
+	if config.HSTSMaxAge < 0 {
+		problems = append(problems, "hsts_max_age must not be negative")
+	}
+	if len(config.RedirectMarker) != 0 && !redirectMarkerRegexp.MatchString(config.RedirectMarker) {
+		problems = append(problems, fmt.Sprintf("redirect_marker %q must be a single name=value query parameter", config.RedirectMarker))
+	}
+	if config.WebStoreCacheMaxAge < 0 {
+		problems = append(problems, "webstore_cache_max_age must not be negative")
+	}
+	if config.MaxAppsPerResponse < 0 {
+		problems = append(problems, "max_apps_per_response must not be negative")
+	}
+	for id, perMinute := range config.UpdateBudgets {
+		if perMinute <= 0 {
+			problems = append(problems, fmt.Sprintf("update_budgets of %s must be positive", id))
+		}
+	}
+	if len(config.TLSCert) == 0 != (len(config.TLSKey) == 0) {
+		problems = append(problems, "tls_cert and tls_key must be set together")
+	} else if len(config.TLSCert) != 0 {
+		for name, path := range map[string]string{"tls_cert": config.TLSCert, "tls_key": config.TLSKey} {
+			if _, err := os.Stat(path); err != nil {
+				problems = append(problems, fmt.Sprintf("%s %s can't be read", name, path))
+			}
+		}
+	} else if config.HTTP3 {
+		problems = append(problems, "http3 requires tls_cert and tls_key")
+	}
+	if len(config.OpsAddr) != 0 {
+		if _, _, err := net.SplitHostPort(config.OpsAddr); err != nil {
+			problems = append(problems, fmt.Sprintf("ops_addr %q must be a host:port", config.OpsAddr))
+		}
+	}
+	if len(config.AdminAddr) != 0 {
+		if _, _, err := net.SplitHostPort(config.AdminAddr); err != nil {
+			problems = append(problems, fmt.Sprintf("admin_addr %q must be a host:port", config.AdminAddr))
+		}
+		if config.AdminAddr == config.Addr {
+			problems = append(problems, "admin_addr must differ from addr")
+		}
+		for name, path := range map[string]string{"admin_tls_cert": config.AdminTLSCert, "admin_tls_key": config.AdminTLSKey, "admin_client_ca": config.AdminClientCA} {
+			if len(path) == 0 {
+				problems = append(problems, fmt.Sprintf("%s must be set with admin_addr", name))
+			} else if _, err := os.Stat(path); err != nil {
+				problems = append(problems, fmt.Sprintf("%s %s can't be read", name, path))
+			}
+		}
+	}
+	for _, origin := range config.CORSAllowedOrigins {
+		if parsed, err := url.Parse(origin); origin != "*" && (err != nil || len(parsed.Scheme) == 0 || len(parsed.Host) == 0 || len(strings.Trim(parsed.Path, "/")) != 0) {
+			problems = append(problems, fmt.Sprintf("cors_allowed_origins %q must be * or a scheme and host like https://dashboard.example.com", origin))
+		}
+	}
+	for _, method := range config.CORSAllowedMethods {
+		switch method {
+		case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
+			problems = append(problems, fmt.Sprintf("cors_allowed_methods %q must be GET, HEAD, POST, PUT, PATCH or DELETE", method))
+		}
+	}
+	if config.CompressionMinSize < 0 {
+		problems = append(problems, "compression_min_size must not be negative")
+	}
+	if len(config.GRPCAddr) != 0 {
+		if _, _, err := net.SplitHostPort(config.GRPCAddr); err != nil {
+			problems = append(problems, fmt.Sprintf("grpc_addr %q must be a host:port", config.GRPCAddr))
+		}
+		if config.GRPCAddr == config.Addr || config.GRPCAddr == config.AdminAddr {
+			problems = append(problems, "grpc_addr must differ from addr and admin_addr")
+		}
+	}
+	if len(config.StatsDAddr) != 0 {
+		if _, _, err := net.SplitHostPort(config.StatsDAddr); err != nil {
+			problems = append(problems, fmt.Sprintf("statsd_addr %q must be a host:port", config.StatsDAddr))
+		}
+	}
+	switch config.CDNPurge {
+	case "":
+	case "fastly":
+		if len(config.FastlyServiceID) == 0 || len(config.FastlyTokenSecret) == 0 {
+			problems = append(problems, "fastly_service_id and fastly_token_secret must be set with cdn_purge fastly")
+		}
+	case "cloudfront":
+		if len(config.CloudFrontDistributionID) == 0 {
+			problems = append(problems, "cloudfront_distribution_id must be set with cdn_purge cloudfront")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("cdn_purge %q must be fastly or cloudfront", config.CDNPurge))
+	}
+	switch config.ExtensionStatsSink {
+	case "", "cloudwatch", "dynamodb":
+	default:
+		problems = append(problems, fmt.Sprintf("extension_stats_sink %q must be cloudwatch or dynamodb", config.ExtensionStatsSink))
+	}
+	if len(config.ExtensionStatsSink) != 0 && config.ExtensionStatsFlushInterval <= 0 {
+		problems = append(problems, "extension_stats_flush_interval must be positive")
+	}
+	switch config.AuditSink {
+	case "":
+	case "file":
+		if len(config.AuditLogFile) == 0 {
+			problems = append(problems, "audit_log_file must be set for the file audit_sink")
+		} else if info, err := os.Stat(filepath.Dir(config.AuditLogFile)); err != nil || !info.IsDir() {
+			problems = append(problems, fmt.Sprintf("audit_log_file must be in an existing directory, not %s", filepath.Dir(config.AuditLogFile)))
+		}
+	case "dynamodb":
+		if len(config.AuditTable) == 0 {
+			problems = append(problems, "audit_table must be set for the dynamodb audit_sink")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("audit_sink %q must be file or dynamodb", config.AuditSink))
+	}
+	switch config.EventsSink {
+	case "":
+	case "kinesis":
+		if len(config.EventsKinesisStream) == 0 {
+			problems = append(problems, "events_kinesis_stream must be set for the kinesis events_sink")
+		}
+	case "kafka":
+		if u, err := url.Parse(config.EventsKafkaRESTURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || len(u.Host) == 0 {
+			problems = append(problems, fmt.Sprintf("events_kafka_rest_url must be an http or https URL, not %q", config.EventsKafkaRESTURL))
+		}
+		if len(config.EventsKafkaTopic) == 0 {
+			problems = append(problems, "events_kafka_topic must be set for the kafka events_sink")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("events_sink %q must be kinesis or kafka", config.EventsSink))
+	}
+	if config.EventsQueueSize < 1 || config.EventsBatchSize < 1 || config.EventsFlushInterval <= 0 {
+		problems = append(problems, "events_queue_size, events_batch_size and events_flush_interval must be positive")
+	}
+	if config.RecordSampleRate < 0 || config.RecordSampleRate > 1 {
+		problems = append(problems, "record_sample_rate must be between 0 and 1")
+	}
+	if config.RecordSampleRate > 0 {
+		switch config.RecordSink {
+		case "file":
+			if len(config.RecordFile) == 0 {
+				problems = append(problems, "record_file must be set for the file record_sink")
+			} else if info, err := os.Stat(filepath.Dir(config.RecordFile)); err != nil || !info.IsDir() {
+				problems = append(problems, fmt.Sprintf("record_file must be in an existing directory, not %s", filepath.Dir(config.RecordFile)))
+			}
+		case "s3":
+			if len(config.RecordBucket) == 0 {
+				problems = append(problems, "record_bucket must be set for the s3 record_sink")
+			}
+		default:
+			problems = append(problems, fmt.Sprintf("record_sink %q must be file or s3", config.RecordSink))
+		}
+	}
+	if config.PrivacyMode != privacy.ModeHash && config.PrivacyMode != privacy.ModeGDPR && config.PrivacyMode != privacy.ModeOff {
+		problems = append(problems, fmt.Sprintf("privacy_mode %q must be hash, gdpr or off", config.PrivacyMode))
+	}
+	if config.SecretsProvider != "env" && config.SecretsProvider != "secretsmanager" && config.SecretsProvider != "ssm" {
+		problems = append(problems, fmt.Sprintf("secrets_provider %q must be env, secretsmanager or ssm", config.SecretsProvider))
+	}
+	if config.SecretsRefreshInterval < 0 {
+		problems = append(problems, "secrets_refresh_interval must not be negative")
+	}
+	if config.TUFRootVersion < 1 {
+		problems = append(problems, "tuf_root_version must be at least 1")
+	}
+	if len(config.ProtocolVersions) == 0 {
+		problems = append(problems, "protocol_versions must not be empty")
+	}
+	for _, version := range config.ProtocolVersions {
+		if version != "3.0" && version != "3.1" {
+			problems = append(problems, fmt.Sprintf("protocol_versions %q must be 3.0 or 3.1", version))
+		}
+	}
+	if config.DownloadPreference != "cacheable" && config.DownloadPreference != "signed" {
+		problems = append(problems, fmt.Sprintf("download_preference %q must be cacheable or signed", config.DownloadPreference))
+	}
+	// S3 doesn't accept presigned URLs valid for longer than a week
+	if config.SignedURLExpiry < time.Minute || config.SignedURLExpiry > 7*24*time.Hour {
+		problems = append(problems, "signed_url_expiry must be between 1m and 168h")
+	}
+	if config.MaintenanceRetryAfter < time.Second {
+		problems = append(problems, "maintenance_retry_after must be at least 1s")
+	}
+	if config.BackgroundShedThreshold < 0 {
+		problems = append(problems, "background_shed_threshold must not be negative")
+	}
+	if config.BackgroundRetryAfter < time.Second {
+		problems = append(problems, "background_retry_after must be at least 1s")
+	}
+	if config.RequestDedupTTL < 0 {
+		problems = append(problems, "request_dedup_ttl must not be negative")
+	}
+	if config.RetryWindow < 0 {
+		problems = append(problems, "retry_window must not be negative")
+	}
+	if config.CanaryInterval != 0 && config.CanaryInterval < time.Minute {
+		problems = append(problems, "canary_interval must be 0 or at least 1m")
+	}
+	if config.Limits.ReadTimeout < 0 || config.Limits.ReadHeaderTimeout < 0 ||
+		config.Limits.WriteTimeout < 0 || config.Limits.IdleTimeout < 0 || config.Limits.QueueTimeout < 0 {
+		problems = append(problems, "limits must not be negative")
+	}
+	if config.Limits.MaxHeaderBytes < 0 || config.Limits.MaxConnections < 0 ||
+		config.Limits.MaxInFlight < 0 || config.Limits.QueueSize < 0 {
+		problems = append(problems, "limits must not be negative")
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return errors.New("invalid configuration: " + strings.Join(problems, "; "))
+}
+
+// tenantNameRegexp matches tenant names, which are used in URL paths
+var tenantNameRegexp = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+// redirectMarkerRegexp matches a query parameter which needs no escaping, with or without a value
+var redirectMarkerRegexp = regexp.MustCompile(`^[A-Za-z0-9._~-]+(=[A-Za-z0-9._~-]*)?$`)
+
+// checkExtensionsFile checks that path holds a JSON list of extensions
+func checkExtensionsFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	extensions := extension.Extensions{}
+	return json.Unmarshal(data, &extensions)
+}
+
+// checkForceInstallFile checks that the force install list at path can be read, or created if it doesn't exist yet
+func checkForceInstallFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		info, err := os.Stat(filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", filepath.Dir(path))
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	entries := []struct {
+		ID        string `json:"id"`
+		UpdateURL string `json:"updateUrl"`
+	}{}
+	return json.Unmarshal(data, &entries)
+}
+
+// ParseCDNURLPrefixes parses mirrors in the form "JP=https://jp.example.com,DE=https://eu.example.com"
+func ParseCDNURLPrefixes(value string) map[string]string {
+	prefixes := map[string]string{}
+	for _, entry := range strings.Split(value, ",") {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		prefixes[strings.ToUpper(strings.TrimSpace(parts[0]))] = strings.TrimSuffix(strings.TrimSpace(parts[1]), "/")
+	}
+	return prefixes
+}
+
+// ParseUpdateBudgets parses updates per minute by extension in the form "id1=600,id2=100"
+func ParseUpdateBudgets(value string) (map[string]int, error) {
+	budgets := map[string]int{}
+	for _, entry := range splitList(value) {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("%q is not an extension ID and updates per minute like id=600", entry)
+		}
+		perMinute, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", parts[1])
+		}
+		budgets[strings.TrimSpace(parts[0])] = perMinute
+	}
+	return budgets, nil
+}
+
+func splitList(value string) []string {
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); len(item) != 0 {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+type uint32Value struct {
+	value *uint32
+}
+
+func (v uint32Value) String() string {
+	if v.value == nil {
+		return ""
+	}
+	return strconv.FormatUint(uint64(*v.value), 10)
+}
+
+func (v uint32Value) Set(value string) error {
+	parsed, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return err
+	}
+	*v.value = uint32(parsed)
+	return nil
+}
+
+type listValue struct {
+	list *[]string
+}
+
+func (v listValue) String() string {
+	if v.list == nil {
+		return ""
+	}
+	return strings.Join(*v.list, ",")
+}
+
+func (v listValue) Set(value string) error {
+	*v.list = splitList(value)
+	return nil
+}
+
+type cdnURLPrefixesValue struct {
+	prefixes *map[string]string
+}
+
+func (v cdnURLPrefixesValue) String() string {
+	if v.prefixes == nil {
+		return ""
+	}
+	entries := []string{}
+	for country, prefix := range *v.prefixes {
+		entries = append(entries, country+"="+prefix)
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, ",")
+}
+
+func (v cdnURLPrefixesValue) Set(value string) error {
+	*v.prefixes = ParseCDNURLPrefixes(value)
+	return nil
+}
+
+type updateBudgetsValue struct {
+	budgets *map[string]int
+}
+
+func (v updateBudgetsValue) String() string {
+	if v.budgets == nil {
+		return ""
+	}
+	entries := []string{}
+	for id, perMinute := range *v.budgets {
+		entries = append(entries, id+"="+strconv.Itoa(perMinute))
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, ",")
+}
+
+func (v updateBudgetsValue) Set(value string) error {
+	budgets, err := ParseUpdateBudgets(value)
+	if err != nil {
+		return err
+	}
+	*v.budgets = budgets
+	return nil
+}
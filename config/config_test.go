@@ -0,0 +1,534 @@
+package config
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadDefaults(t *testing.T) {
+	config, err := Load(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, Default(), config)
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-update-config")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yml")
+	err = ioutil.WriteFile(path, []byte(`
+addr: ":9000"
+refresh_interval: 1m
+release_bucket: file-bucket
+verify_payloads: true
+cdn_url_prefixes:
+  jp: https://jp.example.com/
+limits:
+  write_timeout: 30s
+  max_connections: 10
+`), 0644)
+	assert.Nil(t, err)
+
+	// The environment overrides the file and flags override both
+	defer os.Unsetenv("RELEASE_BUCKET")
+	defer os.Unsetenv("SERVER_MAX_CONNECTIONS")
+	assert.Nil(t, os.Setenv("RELEASE_BUCKET", "env-bucket"))
+	assert.Nil(t, os.Setenv("SERVER_MAX_CONNECTIONS", "20"))
+	config, err := Load([]string{"-config", path, "-max-connections", "30", "-check-links"})
+	assert.Nil(t, err)
+	assert.Equal(t, ":9000", config.Addr)
+	assert.Equal(t, time.Minute, config.RefreshInterval)
+	assert.Equal(t, "env-bucket", config.ReleaseBucket)
+	assert.True(t, config.VerifyPayloads)
+	assert.True(t, config.CheckLinks)
+	assert.Equal(t, map[string]string{"JP": "https://jp.example.com"}, config.CDNURLPrefixes)
+	assert.Equal(t, 30*time.Second, config.Limits.WriteTimeout)
+	assert.Equal(t, 30, config.Limits.MaxConnections)
+	assert.Equal(t, Default().Limits.ReadTimeout, config.Limits.ReadTimeout)
+
+	// Unknown keys are rejected so typos don't go unnoticed
+	err = ioutil.WriteFile(path, []byte("refresh_intervall: 1m\n"), 0644)
+	assert.Nil(t, err)
+	_, err = Load([]string{"-config", path})
+	assert.NotNil(t, err)
+
+	_, err = Load([]string{"-config", filepath.Join(dir, "missing.yml")})
+	assert.NotNil(t, err)
+}
+
+func TestLoadEnv(t *testing.T) {
+	defer os.Unsetenv("SERVER_WRITE_TIMEOUT")
+	defer os.Unsetenv("CDN_URL_PREFIXES")
+	assert.Nil(t, os.Setenv("SERVER_WRITE_TIMEOUT", "5s"))
+	assert.Nil(t, os.Setenv("CDN_URL_PREFIXES", "jp=https://jp.example.com,DE=https://eu.example.com/"))
+	config, err := Load(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 5*time.Second, config.Limits.WriteTimeout)
+	assert.Equal(t, map[string]string{"JP": "https://jp.example.com", "DE": "https://eu.example.com"}, config.CDNURLPrefixes)
+
+	assert.Nil(t, os.Setenv("SERVER_WRITE_TIMEOUT", "soon"))
+	_, err = Load(nil)
+	assert.NotNil(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	config := Default()
+	assert.Nil(t, config.Validate())
+
+	config.RefreshInterval = 0
+	config.WebStoreFallbackURL = "http://clients2.google.com/service/update2/crx"
+	config.CRXDirectory = "/does/not/exist"
+	err := config.Validate()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "refresh_interval")
+	assert.Contains(t, err.Error(), "webstore_fallback_url")
+	assert.Contains(t, err.Error(), "crx_directory")
+}
+
+func TestUpdateBudgets(t *testing.T) {
+	defer os.Unsetenv("UPDATE_BUDGETS")
+	assert.Nil(t, os.Setenv("UPDATE_BUDGETS", "jicbkmdloagakknpihibphagfckhjdih=600, ldimlcelhnjgpjjemdjokpgeeikdinbm=10"))
+	config, err := Load(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int{"jicbkmdloagakknpihibphagfckhjdih": 600, "ldimlcelhnjgpjjemdjokpgeeikdinbm": 10}, config.UpdateBudgets)
+	assert.Nil(t, config.Validate())
+
+	config.UpdateBudgets["ldimlcelhnjgpjjemdjokpgeeikdinbm"] = 0
+	assert.NotNil(t, config.Validate())
+
+	for _, value := range []string{"jicbkmdloagakknpihibphagfckhjdih", "jicbkmdloagakknpihibphagfckhjdih=many"} {
+		assert.Nil(t, os.Setenv("UPDATE_BUDGETS", value))
+		_, err = Load(nil)
+		assert.NotNil(t, err, value)
+	}
+}
+
+func TestRedirectMarker(t *testing.T) {
+	defer os.Unsetenv("REDIRECT_MARKER")
+	config, err := Load(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "braveRedirect=true", config.RedirectMarker)
+
+	for _, marker := range []string{"", "fork=1", "redirected", "from=go-update.example"} {
+		assert.Nil(t, os.Setenv("REDIRECT_MARKER", marker))
+		config, err = Load(nil)
+		assert.Nil(t, err, marker)
+		assert.Equal(t, marker, config.RedirectMarker)
+	}
+	for _, marker := range []string{"=1", "a=1&b=2", "a b", "a=%zz", "a=1=2"} {
+		assert.Nil(t, os.Setenv("REDIRECT_MARKER", marker))
+		_, err = Load(nil)
+		assert.NotNil(t, err, marker)
+	}
+}
+
+func TestComponentPassthrough(t *testing.T) {
+	config := Default()
+	config.ComponentPassthrough = map[string]ComponentPassthrough{
+		"oimompecagnajdejgnnjijobebaeigek": {Mode: "proxy", UpstreamURL: "https://update.googleapis.com/service/update2"},
+		"jicbkmdloagakknpihibphagfckhjdih": {Mode: "mirror", Platforms: []string{"win_x64", "linux"}, RedistributionLicensed: true},
+	}
+	assert.Nil(t, config.Validate())
+
+	config.ComponentPassthrough = map[string]ComponentPassthrough{
+		"a": {Mode: "proxy"},
+		"b": {Mode: "proxy", UpstreamURL: "http://update.example.com"},
+		"c": {Mode: "mirror", Platforms: []string{"win"}},
+		"d": {Mode: "mirror", RedistributionLicensed: true},
+		"e": {Mode: "redirect"},
+	}
+	err := config.Validate()
+	assert.NotNil(t, err)
+	for _, problem := range []string{"a must set upstream_url", "b upstream_url must be an https URL", "c can only be mirrored", "d must list the platforms", "e mode"} {
+		assert.Contains(t, err.Error(), problem)
+	}
+}
+
+func TestAppOverrides(t *testing.T) {
+	config := Default()
+	config.AppOverrides = map[string]AppOverride{
+		"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa": {Action: "block"},
+		"bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb": {Action: "serve"},
+		"cccccccccccccccccccccccccccccccc": {Action: "redirect"},
+		"dddddddddddddddddddddddddddddddd": {Action: "redirect", UpstreamURL: "https://updates.example.com/update2", WebStoreURL: "https://updates.example.com/crx"},
+		"eeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee": {Action: "proxy", UpstreamURL: "https://updates.example.com/update2"},
+	}
+	assert.Nil(t, config.Validate())
+
+	config.AppOverrides = map[string]AppOverride{
+		"a": {Action: "block", UpstreamURL: "https://updates.example.com/update2"},
+		"b": {Action: "proxy"},
+		"c": {Action: "redirect", WebStoreURL: "ftp://updates.example.com"},
+		"d": {Action: "ignore"},
+		"e": {Action: "serve"},
+	}
+	config.ComponentPassthrough = map[string]ComponentPassthrough{"e": {Mode: "proxy", UpstreamURL: "https://update.googleapis.com/service/update2"}}
+	err := config.Validate()
+	assert.NotNil(t, err)
+	for _, problem := range []string{"a can't set URLs to block", "b must set upstream_url", "c webstore_url must be an https URL", "d action", "e is also in component_passthrough"} {
+		assert.Contains(t, err.Error(), problem)
+	}
+}
+
+func TestValidateStore(t *testing.T) {
+	config := Default()
+	config.Store = "memory"
+	assert.Nil(t, config.Validate())
+
+	config.Store = "postgres"
+	assert.NotNil(t, config.Validate())
+
+	dir, err := ioutil.TempDir("", "go-update-config")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	config.Store = "memory"
+	config.MemoryStoreSeed = filepath.Join(dir, "seed.json")
+	assert.Nil(t, ioutil.WriteFile(config.MemoryStoreSeed, []byte(`[{"id":"aomjjhallfgjeglblehebfpbcfeobpgk","version":"1.0.0"}]`), 0644))
+	assert.Nil(t, config.Validate())
+	assert.Nil(t, ioutil.WriteFile(config.MemoryStoreSeed, []byte(`{"id":"aomjjhallfgjeglblehebfpbcfeobpgk"}`), 0644))
+	assert.NotNil(t, config.Validate())
+}
+
+func TestValidateSecrets(t *testing.T) {
+	config := Default()
+	config.SecretsProvider = "ssm"
+	config.AdminTokensSecret = "/go-update/admin-tokens"
+	assert.Nil(t, config.Validate())
+
+	config.SecretsProvider = "vault"
+	config.SecretsRefreshInterval = -time.Minute
+	err := config.Validate()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "secrets_provider")
+	assert.Contains(t, err.Error(), "secrets_refresh_interval")
+}
+
+func TestValidateEvents(t *testing.T) {
+	config := Default()
+	config.EventsSink = "kinesis"
+	config.EventsKinesisStream = "update-checks"
+	assert.Nil(t, config.Validate())
+
+	config.EventsSink = "kafka"
+	err := config.Validate()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "events_kafka_rest_url")
+	assert.Contains(t, err.Error(), "events_kafka_topic")
+
+	config.EventsKafkaRESTURL = "http://kafka-rest.internal:8082"
+	config.EventsKafkaTopic = "update-checks"
+	assert.Nil(t, config.Validate())
+
+	config.EventsSink = "pubsub"
+	assert.NotNil(t, config.Validate())
+}
+
+func TestValidateProtocolVersions(t *testing.T) {
+	config := Default()
+	assert.Equal(t, []string{"3.0", "3.1"}, config.ProtocolVersions)
+	config.ProtocolVersions = []string{"3.1"}
+	assert.Nil(t, config.Validate())
+	config.ProtocolVersions = []string{"3.1", "4.0"}
+	assert.NotNil(t, config.Validate())
+	config.ProtocolVersions = []string{}
+	assert.NotNil(t, config.Validate())
+}
+
+func TestValidateDownloadPreference(t *testing.T) {
+	config := Default()
+	assert.Equal(t, "cacheable", config.DownloadPreference)
+	config.DownloadPreference = "signed"
+	assert.Nil(t, config.Validate())
+	config.DownloadPreference = "fastest"
+	assert.NotNil(t, config.Validate())
+
+	config = Default()
+	config.SignedURLExpiry = 8 * 24 * time.Hour
+	assert.NotNil(t, config.Validate())
+}
+
+func TestValidateTrustedProxies(t *testing.T) {
+	config := Default()
+	config.TrustedProxies = []string{"10.0.0.0/8", "2001:db8::/32"}
+	assert.Nil(t, config.Validate())
+	config.TrustedProxies = []string{"10.0.0.1"}
+	assert.NotNil(t, config.Validate())
+}
+
+func TestValidateHSTSMaxAge(t *testing.T) {
+	config := Default()
+	assert.Equal(t, 365*24*time.Hour, config.HSTSMaxAge)
+	config.HSTSMaxAge = 0
+	assert.Nil(t, config.Validate())
+	config.HSTSMaxAge = -time.Hour
+	assert.NotNil(t, config.Validate())
+}
+
+func TestValidateAddr(t *testing.T) {
+	config := Default()
+	for _, addr := range []string{":8192", "127.0.0.1:8192", "unix:/run/go-update.sock", "systemd", "systemd:http"} {
+		config.Addr = addr
+		assert.Nil(t, config.Validate(), addr)
+	}
+	for _, addr := range []string{"", "8192", "unix:"} {
+		config.Addr = addr
+		assert.NotNil(t, config.Validate(), addr)
+	}
+}
+
+func TestValidateCORS(t *testing.T) {
+	config := Default()
+	config.CORSAllowedOrigins = []string{"https://dashboard.example.com", "http://localhost:3000", "*"}
+	config.CORSAllowedMethods = []string{"GET", "PUT"}
+	assert.Nil(t, config.Validate())
+	config.CORSAllowedOrigins = []string{"dashboard.example.com"}
+	assert.NotNil(t, config.Validate())
+	config.CORSAllowedOrigins = []string{"https://dashboard.example.com/app"}
+	assert.NotNil(t, config.Validate())
+	config.CORSAllowedOrigins = nil
+	config.CORSAllowedMethods = []string{"get"}
+	assert.NotNil(t, config.Validate())
+}
+
+func TestValidateTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-update-config")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	config := Default()
+	config.HTTP3 = true
+	assert.NotNil(t, config.Validate())
+	config.TLSCert = filepath.Join(dir, "cert.pem")
+	assert.NotNil(t, config.Validate())
+	config.TLSKey = filepath.Join(dir, "key.pem")
+	assert.NotNil(t, config.Validate())
+	assert.Nil(t, ioutil.WriteFile(config.TLSCert, []byte("cert"), 0600))
+	assert.Nil(t, ioutil.WriteFile(config.TLSKey, []byte("key"), 0600))
+	assert.Nil(t, config.Validate())
+}
+
+func TestValidateTUFRootVersion(t *testing.T) {
+	config := Default()
+	assert.Equal(t, 1, config.TUFRootVersion)
+	config.TUFRootVersion = 0
+	assert.NotNil(t, config.Validate())
+}
+
+func TestValidateRequestDedupTTL(t *testing.T) {
+	config := Default()
+	assert.Equal(t, time.Duration(0), config.RequestDedupTTL)
+	config.RequestDedupTTL = 30 * time.Second
+	assert.Nil(t, config.Validate())
+	config.RequestDedupTTL = -time.Second
+	assert.NotNil(t, config.Validate())
+}
+
+func TestValidateRetryWindow(t *testing.T) {
+	config := Default()
+	assert.Equal(t, time.Duration(0), config.RetryWindow)
+	config.RetryWindow = 10 * time.Second
+	assert.Nil(t, config.Validate())
+	config.RetryWindow = -time.Second
+	assert.NotNil(t, config.Validate())
+}
+
+func TestValidateForceInstallFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-update-config")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// The file is created when the list first changes
+	config := Default()
+	config.ForceInstallFile = filepath.Join(dir, "forcelist.json")
+	assert.Nil(t, config.Validate())
+	config.ForceInstallFile = filepath.Join(dir, "missing", "forcelist.json")
+	assert.NotNil(t, config.Validate())
+
+	config.ForceInstallFile = filepath.Join(dir, "forcelist.json")
+	assert.Nil(t, ioutil.WriteFile(config.ForceInstallFile, []byte(`[{"id":"aomjjhallfgjeglblehebfpbcfeobpgk"}]`), 0600))
+	assert.Nil(t, config.Validate())
+	assert.Nil(t, ioutil.WriteFile(config.ForceInstallFile, []byte(`{`), 0600))
+	assert.NotNil(t, config.Validate())
+
+	config = Default()
+	config.PolicyUpdateURL = "http://example.com/extensions"
+	assert.NotNil(t, config.Validate())
+}
+
+func TestValidateTransparencyLogFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-update-config")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	config := Default()
+	config.TransparencyLogFile = filepath.Join(dir, "transparency.log")
+	assert.Nil(t, config.Validate())
+	config.TransparencyLogFile = filepath.Join(dir, "missing", "transparency.log")
+	assert.NotNil(t, config.Validate())
+}
+
+func TestValidateCanaryInterval(t *testing.T) {
+	config := Default()
+	config.CanaryInterval = 15 * time.Minute
+	assert.Nil(t, config.Validate())
+	config.CanaryInterval = time.Second
+	assert.NotNil(t, config.Validate())
+}
+
+func TestValidateServingWindowsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-update-config")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	config := Default()
+	config.ServingWindowsFile = filepath.Join(dir, "windows.json")
+	assert.Nil(t, config.Validate())
+	config.ServingWindowsFile = filepath.Join(dir, "missing", "windows.json")
+	assert.NotNil(t, config.Validate())
+}
+
+func TestValidateShadowStore(t *testing.T) {
+	config := Default()
+	config.ShadowStore = "memory"
+	assert.Nil(t, config.Validate())
+	config.ShadowStore = "dynamodb"
+	assert.NotNil(t, config.Validate())
+	config.ShadowDynamoDBTable = "ExtensionsNext"
+	assert.Nil(t, config.Validate())
+	config.ShadowStore = "postgres"
+	assert.NotNil(t, config.Validate())
+}
+
+func TestValidateRecording(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-update-config")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	config := Default()
+	config.RecordSampleRate = 0.01
+	config.RecordSink = "file"
+	config.RecordFile = filepath.Join(dir, "recordings.jsonl")
+	assert.Nil(t, config.Validate())
+	config.RecordFile = filepath.Join(dir, "missing", "recordings.jsonl")
+	assert.NotNil(t, config.Validate())
+	config.RecordSink = "s3"
+	assert.NotNil(t, config.Validate())
+	config.RecordBucket = "recordings"
+	assert.Nil(t, config.Validate())
+	config.RecordSampleRate = 2
+	assert.NotNil(t, config.Validate())
+}
+
+func TestValidateAuditSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-update-config")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	config := Default()
+	config.AuditSink = "file"
+	assert.NotNil(t, config.Validate())
+	config.AuditLogFile = filepath.Join(dir, "audit.log")
+	assert.Nil(t, config.Validate())
+	config.AuditSink = "dynamodb"
+	assert.Nil(t, config.Validate())
+	config.AuditSink = "syslog"
+	assert.NotNil(t, config.Validate())
+}
+
+func TestValidateOIDC(t *testing.T) {
+	config := Default()
+	config.OIDCIssuer = "https://example.okta.com"
+	assert.NotNil(t, config.Validate())
+	config.OIDCAudience = "go-update"
+	assert.NotNil(t, config.Validate())
+	config.OIDCViewerGroups = []string{"dashboards"}
+	assert.Nil(t, config.Validate())
+	config.OIDCIssuer = "http://example.okta.com"
+	assert.NotNil(t, config.Validate())
+}
+
+func TestValidateAdminAddr(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-update-config")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"cert.pem", "key.pem", "ca.pem"} {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), []byte("PEM"), 0600))
+	}
+
+	config := Default()
+	config.AdminAddr = ":8443"
+	assert.NotNil(t, config.Validate())
+	config.AdminTLSCert = filepath.Join(dir, "cert.pem")
+	config.AdminTLSKey = filepath.Join(dir, "key.pem")
+	config.AdminClientCA = filepath.Join(dir, "ca.pem")
+	assert.Nil(t, config.Validate())
+	config.AdminClientCA = filepath.Join(dir, "missing.pem")
+	assert.NotNil(t, config.Validate())
+	config.AdminClientCA = filepath.Join(dir, "ca.pem")
+	config.AdminAddr = config.Addr
+	assert.NotNil(t, config.Validate())
+}
+
+func TestValidateGRPCAddr(t *testing.T) {
+	config := Default()
+	config.GRPCAddr = ":9090"
+	assert.Nil(t, config.Validate())
+	config.GRPCAddr = "9090"
+	assert.NotNil(t, config.Validate())
+	config.GRPCAddr = config.Addr
+	assert.NotNil(t, config.Validate())
+}
+
+func TestValidateTenants(t *testing.T) {
+	config := Default()
+	config.Tenants = []Tenant{
+		{Name: "beta", Hosts: []string{"beta.example.com"}, DynamoDBTable: "ExtensionsBeta"},
+		{Name: "enterprise", WebStoreFallbackURL: "https://example.com/crx"},
+	}
+	assert.NotNil(t, config.Validate())
+	config.Store = "memory"
+	assert.Nil(t, config.Validate())
+
+	config.Tenants[1].Name = "Enterprise/1"
+	assert.NotNil(t, config.Validate())
+	config.Tenants[1].Name = "beta"
+	assert.NotNil(t, config.Validate())
+	config.Tenants[1].Name = "enterprise"
+	config.Tenants[1].Hosts = []string{"BETA.example.com"}
+	assert.NotNil(t, config.Validate())
+	config.Tenants[1].Hosts = nil
+	config.Tenants[1].WebStoreFallbackURL = "http://example.com/crx"
+	assert.NotNil(t, config.Validate())
+}
+
+func TestValidatePrivacy(t *testing.T) {
+	config := Default()
+	assert.Equal(t, "hash", config.PrivacyMode)
+	config.PrivacyMode = "gdpr"
+	assert.Nil(t, config.Validate())
+	config.PrivacyMode = "anonymous"
+	assert.NotNil(t, config.Validate())
+}
+
+func TestValidateReleaseChannels(t *testing.T) {
+	config := Default()
+	config.Tenants = []Tenant{{Name: "beta", DynamoDBTable: "ExtensionsBeta"}}
+	config.ReleaseChannels = []ReleaseChannel{{Name: "releases", Kind: "slack", WebhookURLSecret: "slack-webhook"}}
+	assert.Nil(t, config.Validate())
+	config.ReleaseChannels = append(config.ReleaseChannels, ReleaseChannel{Name: "beta", Kind: "discord", Tenant: "beta", WebhookURLSecret: "discord-webhook"})
+	assert.Nil(t, config.Validate())
+	config.ReleaseChannels[1].Tenant = "alpha"
+	assert.NotNil(t, config.Validate())
+	config.ReleaseChannels[1].Tenant = "beta"
+	config.ReleaseChannels[1].Name = "releases"
+	assert.NotNil(t, config.Validate())
+	config.ReleaseChannels[1].Name = "beta"
+	config.ReleaseChannels[1].Kind = "teams"
+	assert.NotNil(t, config.Validate())
+	config.ReleaseChannels[1].Kind = "discord"
+	config.ReleaseChannels[1].WebhookURLSecret = ""
+	assert.NotNil(t, config.Validate())
+}
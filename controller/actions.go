@@ -0,0 +1,48 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/brave/go-update/extension"
+	"github.com/go-chi/chi"
+	"github.com/pressly/lg"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// PutActions is the admin handler for replacing the actions clients run when they install an extension in the catalog,
+// which some non-extension Omaha clients need to complete installation, see extension.Action.
+// They are kept for later versions, and an empty list removes them.
+func PutActions(w http.ResponseWriter, r *http.Request) {
+	log := lg.Log(r.Context())
+	if optionsFor(r.Context()).frozen() {
+		http.Error(w, "The catalog is frozen", http.StatusForbidden)
+		return
+	}
+	id := chi.URLParam(r, "id")
+	ext, ok := catalogFor(r)[id]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	actions := []extension.Action{}
+	err := json.NewDecoder(io.LimitReader(r.Body, 1024*1024)).Decode(&actions)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if problems := validateActions(id, actions); len(problems) != 0 {
+		http.Error(w, fmt.Sprintf("Invalid actions: %s", strings.Join(problems, "; ")), http.StatusBadRequest)
+		return
+	}
+
+	before := ext
+	ext.Actions = actions
+	if len(actions) == 0 {
+		ext.Actions = nil
+	}
+	if saveCatalogEntry(w, r, before, ext) {
+		log.Infof("Replaced the actions of extension %s with %d actions", id, len(actions))
+	}
+}
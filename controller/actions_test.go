@@ -0,0 +1,50 @@
+package controller_test
+
+import (
+	"github.com/brave/go-update/extension/extensiontest"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestActions(t *testing.T) {
+	id := "ldimlcelhnjgpjjemdjokpgeeikdinbm"
+	put := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/admin/extensions/"+id+"/actions", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer test-token")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+	check := func() string {
+		req := httptest.NewRequest(http.MethodPost, "/extensions", strings.NewReader(extensiontest.ExtensionRequestFnFor(id)("0.0.0")))
+		req.Header.Set("Content-Type", "application/xml")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		return rr.Body.String()
+	}
+
+	assert.Equal(t, http.StatusBadRequest, put(`[{"event":"install"}]`).Code)
+	assert.Equal(t, http.StatusBadRequest, put(`[{"event":"uninstall","run":"setup.exe"}]`).Code)
+	assert.NotContains(t, check(), "<actions>")
+
+	rr := put(`[{"event":"install","run":"setup.exe","arguments":"--install"},{"event":"postinstall","onsuccess":"exitsilentlyonlaunchcmd"}]`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	defer put(`[]`)
+	assert.Contains(t, rr.Body.String(), `"actions":[`)
+
+	// The actions follow the packages in the manifest
+	assert.Contains(t, check(), `</packages>
+                <actions>
+                    <action event="install" run="setup.exe" arguments="--install"></action>
+                    <action event="postinstall" onsuccess="exitsilentlyonlaunchcmd"></action>
+                </actions>
+            </manifest>`)
+
+	assert.Equal(t, http.StatusOK, put(`[]`).Code)
+	assert.Nil(t, handlerOptions.CurrentCatalog().Map()[id].Actions)
+	assert.NotContains(t, check(), "<actions>")
+}
@@ -0,0 +1,203 @@
+package controller
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/brave/go-update/extension"
+	"github.com/go-chi/chi"
+	"github.com/pressly/lg"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultReleaseBucket is the S3 bucket uploaded extensions are published to by Options without a ReleaseBucket
+const DefaultReleaseBucket = "brave-core-ext"
+
+// MaxUploadSize is the largest CRX accepted by the upload endpoint.
+var MaxUploadSize = int64(1024 * 1024 * 512) // 512MiB
+
+// adminOperations are the /api/admin endpoints
+var adminOperations = []apiOperation{
+	{
+		Method: http.MethodPut, Pattern: "/extensions/{id}/versions/{version}", Handler: UploadExtension,
+		Summary: "Upload a CRX as a new version of an extension, or the package of an app",
+		Query: []apiParameter{
+			{Name: "publishAt", Description: "RFC 3339 time to publish the version at instead of now", Format: "date-time"},
+			{Name: "title", Description: "Title of an extension which isn't in the catalog yet"},
+			{Name: "dependencies", Description: "Comma separated IDs of the extensions kept up to date along with this one, replacing the current ones"},
+			{Name: "releaseNotes", Description: "What changed in the version, or a URL to its release notes"},
+			{Name: "type", Description: "app for an Omaha app which isn't in the catalog yet and whose package isn't a CRX"},
+			{Name: "packageName", Description: "File name of the packages of an app, with {version} or {version_underscored} placeholders"},
+			{Name: "optional", Description: "true if the package isn't required", Type: "boolean"},
+		},
+		BodyType: "application/x-chrome-extension", Status: http.StatusCreated, Response: extension.Extension{}, Tenant: true,
+	},
+	{Method: http.MethodDelete, Pattern: "/extensions/{id}", Handler: DeleteExtension, Summary: "Remove an extension from the catalog", Status: http.StatusNoContent, Tenant: true},
+	{Method: http.MethodPut, Pattern: "/extensions/{id}/blacklist", Handler: BlacklistExtension, Summary: "Stop offering updates for an extension", Response: extension.Extension{}, Tenant: true},
+	{Method: http.MethodDelete, Pattern: "/extensions/{id}/blacklist", Handler: UnblacklistExtension, Summary: "Offer updates for a blacklisted extension again", Response: extension.Extension{}, Tenant: true},
+	{Method: http.MethodPut, Pattern: "/extensions/{id}/release-notes", Handler: PutReleaseNotes, Summary: "Replace the release notes of the current version of an extension", BodyType: "text/plain", Response: extension.Extension{}, Tenant: true},
+	{Method: http.MethodPut, Pattern: "/extensions/{id}/actions", Handler: PutActions, Summary: "Replace the install actions of an extension", Body: []extension.Action{}, Response: extension.Extension{}, Tenant: true},
+	{Method: http.MethodPut, Pattern: "/extensions/{id}/rules", Handler: PutTargetingRules, Summary: "Replace the targeting rules of an extension", Body: []extension.Rule{}, Response: extension.Extension{}, Tenant: true},
+	{Method: http.MethodPut, Pattern: "/extensions/{id}/locales", Handler: PutLocalePackages, Summary: "Replace the packages of an extension offered by language", Body: map[string]extension.Package{}, Response: extension.Extension{}, Tenant: true},
+	{Method: http.MethodPut, Pattern: "/extensions/{id}/memory", Handler: PutMemoryRequirement, Summary: "Replace the memory requirement of an extension", Body: MemoryRequirement{}, Response: extension.Extension{}, Tenant: true},
+	{Method: http.MethodPut, Pattern: "/extensions/{id}/install-data/{index}", Handler: PutInstallData, Summary: "Store install data of an extension", BodyType: "text/plain", Response: extension.Extension{}, Tenant: true},
+	{Method: http.MethodDelete, Pattern: "/extensions/{id}/install-data/{index}", Handler: DeleteInstallData, Summary: "Remove install data of an extension", Response: extension.Extension{}, Tenant: true},
+	{Method: http.MethodGet, Pattern: "/catalog", Handler: GetCatalog, Summary: "Export the catalog", Response: []extension.Extension{}, List: "extensions", Tenant: true},
+	{Method: http.MethodPost, Pattern: "/refresh", Handler: RefreshCatalog, Summary: "Reload the catalog from its store", Status: http.StatusNoContent, Tenant: true},
+	{Method: http.MethodGet, Pattern: "/quarantine", Handler: GetQuarantinedRecords, Summary: "List the catalog records left out at the last refresh", Response: []QuarantinedRecord{}, List: "records", Tenant: true},
+	{Method: http.MethodGet, Pattern: "/health/packages", Handler: PackageHealthReport, Summary: "List the health of every package checked", Response: []PackageHealth{}, List: "packages"},
+	{Method: http.MethodGet, Pattern: "/health/canary", Handler: CanaryReport, Summary: "List the last canary result of every extension", Response: []CanaryResult{}, List: "results"},
+	{Method: http.MethodPost, Pattern: "/reload", Handler: Reload, Summary: "Reload the configuration", Status: http.StatusNoContent},
+	{Method: http.MethodGet, Pattern: "/maintenance", Handler: GetMaintenance, Summary: "Check whether maintenance mode is enabled", Response: MaintenanceStatus{}},
+	{Method: http.MethodPut, Pattern: "/maintenance", Handler: EnableMaintenance, Summary: "Enable maintenance mode", Response: MaintenanceStatus{}},
+	{Method: http.MethodDelete, Pattern: "/maintenance", Handler: DisableMaintenance, Summary: "Disable maintenance mode", Response: MaintenanceStatus{}},
+	{Method: http.MethodGet, Pattern: "/policy/forcelist", Handler: GetForceInstallList, Summary: "List the force installed extensions", Response: []ForceInstallEntry{}, List: "extensions"},
+	{Method: http.MethodPut, Pattern: "/policy/forcelist/{id}", Handler: PutForceInstallEntry, Summary: "Force install an extension", Body: ForceInstallEntry{}, Response: ForceInstallEntry{}},
+	{Method: http.MethodDelete, Pattern: "/policy/forcelist/{id}", Handler: DeleteForceInstallEntry, Summary: "Stop force installing an extension", Status: http.StatusNoContent},
+	{Method: http.MethodGet, Pattern: "/serving-windows", Handler: GetServingWindows, Summary: "List the serving windows", Response: []ServingWindow{}, List: "windows"},
+	{Method: http.MethodPut, Pattern: "/serving-windows/{id}", Handler: PutServingWindow, Summary: "Only offer updates for an extension within a window", Body: ServingWindow{}, Response: ServingWindow{}},
+	{Method: http.MethodDelete, Pattern: "/serving-windows/{id}", Handler: DeleteServingWindow, Summary: "Offer updates for an extension at any time", Status: http.StatusNoContent},
+	{Method: http.MethodGet, Pattern: "/chaos", Handler: GetChaosFaults, Middleware: []func(http.Handler) http.Handler{chaosModeOnly}, Summary: "List the faults injected in chaos mode", Response: []ChaosFault{}, List: "faults"},
+	{Method: http.MethodPut, Pattern: "/chaos/{id}", Handler: PutChaosFault, Middleware: []func(http.Handler) http.Handler{chaosModeOnly}, Summary: "Inject a fault into update checks for an extension in chaos mode", Body: ChaosFault{}, Response: ChaosFault{}},
+	{Method: http.MethodDelete, Pattern: "/chaos/{id}", Handler: DeleteChaosFault, Middleware: []func(http.Handler) http.Handler{chaosModeOnly}, Summary: "Stop injecting faults for an extension", Status: http.StatusNoContent},
+	{
+		Method: http.MethodGet, Pattern: "/audit", Handler: GetAuditRecords, Summary: "Query the audit log, newest records first",
+		Query: []apiParameter{
+			{Name: "actor"}, {Name: "action"}, {Name: "target"}, {Name: "tenant"},
+			{Name: "since", Description: "RFC 3339 time of the oldest record", Format: "date-time"},
+			{Name: "until", Description: "RFC 3339 time of the newest record", Format: "date-time"},
+			{Name: "limit", Description: "Most records returned, 100 by default", Type: "integer"},
+		},
+		Response: []AuditRecord{}, List: "records",
+	},
+}
+
+// AdminRouter is the router for /api/admin endpoints.
+// All of them require a bearer token from AdminTokens, or TOKEN_LIST if they aren't set.
+func AdminRouter(opts *Options) chi.Router {
+	r := chi.NewRouter()
+	r.Use(ServeWith(opts))
+	r.Use(adminAuthorizedOnly)
+	routeOperations(r, adminOperations)
+	return r
+}
+
+// UploadExtension is the handler for publishing a new extension version, see AdminService.UploadExtension.
+// The request body is the CRX itself, or the package of an app, which isn't validated.
+func UploadExtension(w http.ResponseWriter, r *http.Request) {
+	defer func() {
+		err := r.Body.Close()
+		if err != nil {
+			lg.Log(r.Context()).Errorf("Error closing body stream: %v", err)
+		}
+	}()
+
+	query := r.URL.Query()
+	upload := Upload{
+		ID:           chi.URLParam(r, "id"),
+		Version:      chi.URLParam(r, "version"),
+		PublishAt:    query.Get("publishAt"),
+		Title:        query.Get("title"),
+		Type:         query.Get("type"),
+		ReleaseNotes: query.Get("releaseNotes"),
+	}
+	if packageName, ok := query["packageName"]; ok {
+		upload.PackageName = &packageName[0]
+	}
+	if optional := query.Get("optional"); len(optional) != 0 {
+		upload.Optional = new(bool)
+		*upload.Optional = optional == "true"
+	}
+	if dependencies, ok := query["dependencies"]; ok {
+		upload.Dependencies = strings.Split(strings.Join(dependencies, ","), ",")
+	}
+	ext, err := adminService.UploadExtension(r.Context(), upload, r.Body)
+	if err != nil {
+		writeAdminError(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusCreated, ext)
+}
+
+// DeleteExtension is the handler for removing an extension from the catalog
+func DeleteExtension(w http.ResponseWriter, r *http.Request) {
+	err := adminService.DeleteExtension(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeAdminError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// BlacklistExtension is the handler for no longer offering updates for an extension
+func BlacklistExtension(w http.ResponseWriter, r *http.Request) {
+	setBlacklisted(w, r, true)
+}
+
+// UnblacklistExtension is the handler for offering updates for a blacklisted extension again
+func UnblacklistExtension(w http.ResponseWriter, r *http.Request) {
+	setBlacklisted(w, r, false)
+}
+
+func setBlacklisted(w http.ResponseWriter, r *http.Request, blacklisted bool) {
+	ext, err := adminService.BlacklistExtension(r.Context(), chi.URLParam(r, "id"), blacklisted)
+	if err != nil {
+		writeAdminError(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, ext)
+}
+
+// GetCatalog is the handler for exporting the current catalog as JSON.
+// The result can be pinned with a ManifestStore to reproduce what was being served, in either API version.
+func GetCatalog(w http.ResponseWriter, r *http.Request) {
+	writeList(w, r, "extensions", adminService.ListExtensions(r.Context()))
+}
+
+// RefreshCatalog is the handler for reloading the catalog from its store now rather than at the next refresh interval
+func RefreshCatalog(w http.ResponseWriter, r *http.Request) {
+	err := adminService.RefreshCatalog(r.Context())
+	if err != nil {
+		writeAdminError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func publishCRX(ctx context.Context, key string, body io.Reader) error {
+	opts := optionsFor(ctx)
+	if len(opts.crxDirectory()) != 0 {
+		path := filepath.Join(opts.crxDirectory(), filepath.FromSlash(key))
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			return err
+		}
+		out, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, body)
+		if err != nil {
+			_ = out.Close()
+			return err
+		}
+		return out.Close()
+	}
+
+	cfg, err := newAWSConfig(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = manager.NewUploader(newS3Client(cfg)).Upload(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(opts.releaseBucket()),
+		Key:         aws.String(key),
+		Body:        body,
+		ContentType: aws.String("application/x-chrome-extension"),
+	})
+	return err
+}
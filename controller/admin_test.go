@@ -0,0 +1,260 @@
+package controller_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/crx"
+	"github.com/brave/go-update/crx/crxtest"
+	"github.com/brave/go-update/extension"
+	"github.com/brave/go-update/extension/extensiontest"
+	"github.com/brave/go-update/memstore"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUploadExtension(t *testing.T) {
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	key := crxtest.NewKey()
+	id := crx.IDFromPublicKey(crxtest.PublicKey(key))
+	payload := crxtest.BuildSignedCRX(key, []byte("PK archive"))
+	upload := func(id string, version string, token string, body []byte) *http.Response {
+		uploadURL := fmt.Sprintf("%s/api/admin/extensions/%s/versions/%s?title=Uploaded", server.URL, id, version)
+		req, err := http.NewRequest(http.MethodPut, uploadURL, bytes.NewBuffer(body))
+		assert.Nil(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		return resp
+	}
+
+	// Requires a valid token
+	resp := upload(id, "1.0.0", "wrong-token", payload)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// Must be a CRX
+	resp = upload(id, "1.0.0", "test-token", []byte("For the horde!"))
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// Must be signed for the extension being uploaded
+	resp = upload("ldimlcelhnjgpjjemdjokpgeeikdinbm", "2.0.0", "test-token", payload)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// The ID is the one of the key the CRX is signed with, not only the one its header declares
+	declared := sha256.Sum256(crxtest.PublicKey(key))
+	resp = upload(id, "1.0.0", "test-token", crxtest.BuildCRX(crxtest.NewKey(), declared[:16], []byte("PK archive")))
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// A valid upload is published and registered in a new generation of the catalog
+	before := handlerOptions.CurrentCatalog()
+	resp = upload(id, "1.0.0", "test-token", payload)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	published, err := ioutil.ReadFile(filepath.Join(crxDirectory, "release", id, "extension_1_0_0.crx"))
+	assert.Nil(t, err)
+	assert.Equal(t, payload, published)
+	sum := sha256.Sum256(payload)
+	ext, ok := handlerOptions.CurrentCatalog().Lookup(id)
+	assert.True(t, ok)
+	assert.Equal(t, "1.0.0", ext.Version)
+	assert.Equal(t, "Uploaded", ext.Title)
+	assert.Equal(t, hex.EncodeToString(sum[:]), ext.SHA256)
+	assert.Equal(t, int64(len(payload)), ext.Size)
+	assert.True(t, handlerOptions.CurrentCatalog().Generation() > before.Generation())
+	// Snapshots which were taken before never change
+	_, ok = before.Lookup(id)
+	assert.False(t, ok)
+
+	// The same version can't be uploaded twice
+	resp = upload(id, "1.0.0", "test-token", payload)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	// Dependencies can be declared, and are kept for later versions unless they are given again
+	uploadURL := fmt.Sprintf("%s/api/admin/extensions/%s/versions/1.1.0?dependencies=ldimlcelhnjgpjjemdjokpgeeikdinbm,+bfdgpgibhagkpdlnjonhkabjoijopoge", server.URL, id)
+	req, err := http.NewRequest(http.MethodPut, uploadURL, bytes.NewBuffer(payload))
+	assert.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test-token")
+	resp, err = http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, []string{"ldimlcelhnjgpjjemdjokpgeeikdinbm", "bfdgpgibhagkpdlnjonhkabjoijopoge"}, handlerOptions.CurrentCatalog().Map()[id].Dependencies)
+	resp = upload(id, "1.2.0", "test-token", payload)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, []string{"ldimlcelhnjgpjjemdjokpgeeikdinbm", "bfdgpgibhagkpdlnjonhkabjoijopoge"}, handlerOptions.CurrentCatalog().Map()[id].Dependencies)
+}
+
+// slowStore takes a while to save extensions
+type slowStore struct {
+	controller.Store
+}
+
+func (store slowStore) SaveExtension(ctx context.Context, ext extension.Extension) error {
+	time.Sleep(10 * time.Millisecond)
+	return store.Store.SaveExtension(ctx, ext)
+}
+
+func TestConcurrentUploads(t *testing.T) {
+	// Uploads change the catalog while it is being served, which the race detector checks
+	keys := make([]*rsa.PrivateKey, 8)
+	for i := range keys {
+		keys[i] = crxtest.NewKey()
+	}
+	var wg sync.WaitGroup
+	for _, key := range keys {
+		id := crx.IDFromPublicKey(crxtest.PublicKey(key))
+		payload := crxtest.BuildSignedCRX(key, []byte("PK archive"))
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodPut, "/api/admin/extensions/"+id+"/versions/1.0.0", bytes.NewReader(payload))
+			req.Header.Set("Authorization", "Bearer test-token")
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			assert.Equal(t, http.StatusCreated, rr.Code)
+		}()
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodPost, "/extensions", strings.NewReader(extensiontest.ExtensionRequestFnFor(id)("0.0.0")))
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+		}()
+	}
+	wg.Wait()
+
+	// Every upload is kept, none replaces the catalog another one changed
+	for _, key := range keys {
+		_, ok := handlerOptions.CurrentCatalog().Lookup(crx.IDFromPublicKey(crxtest.PublicKey(key)))
+		assert.True(t, ok)
+	}
+
+	// Versions of the same extension uploaded at once are either published in order or refused as not newer,
+	// so the newest one is always served in the end. The store is slow to save, so the uploads overlap.
+	opts := &controller.Options{Store: slowStore{memstore.New(nil)}, Clock: testClock, CRXDirectory: crxDirectory}
+	slowHandler := newTestHandler(opts)
+	key := crxtest.NewKey()
+	id := crx.IDFromPublicKey(crxtest.PublicKey(key))
+	payload := crxtest.BuildSignedCRX(key, []byte("PK archive"))
+	start := make(chan struct{})
+	for i := 7; i >= 0; i-- {
+		wg.Add(1)
+		go func(version string) {
+			defer wg.Done()
+			<-start
+			req := httptest.NewRequest(http.MethodPut, "/api/admin/extensions/"+id+"/versions/"+version, bytes.NewReader(payload))
+			req.Header.Set("Authorization", "Bearer test-token")
+			rr := httptest.NewRecorder()
+			slowHandler.ServeHTTP(rr, req)
+			assert.Contains(t, []int{http.StatusCreated, http.StatusConflict}, rr.Code)
+		}(fmt.Sprintf("1.0.%d", i))
+	}
+	close(start)
+	wg.Wait()
+	ext, ok := opts.CurrentCatalog().Lookup(id)
+	assert.True(t, ok)
+	assert.Equal(t, "1.0.7", ext.Version)
+}
+
+func TestDeleteAndBlacklistExtension(t *testing.T) {
+	key := crxtest.NewKey()
+	id := crx.IDFromPublicKey(crxtest.PublicKey(key))
+	admin := func(method string, path string, token string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+	check := func() string {
+		req := httptest.NewRequest(http.MethodPost, "/extensions", strings.NewReader(extensiontest.ExtensionRequestFnFor(id)("0.0.0")))
+		req.Header.Set("Content-Type", "application/xml")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		return rr.Body.String()
+	}
+	rr := admin(http.MethodPut, "/api/admin/extensions/"+id+"/versions/1.0.0", "test-token", crxtest.BuildSignedCRX(key, []byte("PK archive")))
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Contains(t, check(), `<updatecheck status="ok">`)
+
+	// Blacklisted extensions aren't offered until they are unblacklisted
+	rr = admin(http.MethodPut, "/api/admin/extensions/"+id+"/blacklist", "test-token", nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"blacklisted":true`)
+	assert.True(t, handlerOptions.CurrentCatalog().Map()[id].Blacklisted)
+	assert.NotContains(t, check(), `<updatecheck status="ok">`)
+	assert.Equal(t, http.StatusOK, admin(http.MethodDelete, "/api/admin/extensions/"+id+"/blacklist", "test-token", nil).Code)
+	assert.Contains(t, check(), `<updatecheck status="ok">`)
+	assert.Equal(t, http.StatusNotFound, admin(http.MethodPut, "/api/admin/extensions/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa/blacklist", "test-token", nil).Code)
+
+	// Deleted extensions are gone from the catalog
+	assert.Equal(t, http.StatusForbidden, admin(http.MethodDelete, "/api/admin/extensions/"+id, "wrong-token", nil).Code)
+	assert.Equal(t, http.StatusNoContent, admin(http.MethodDelete, "/api/admin/extensions/"+id, "test-token", nil).Code)
+	_, ok := handlerOptions.CurrentCatalog().Lookup(id)
+	assert.False(t, ok)
+	assert.Equal(t, http.StatusNotFound, admin(http.MethodDelete, "/api/admin/extensions/"+id, "test-token", nil).Code)
+}
+
+func TestApps(t *testing.T) {
+	id := "{8A69D345-D564-463C-AFF1-A69D9E530F96}"
+	payload := []byte("MZ installer")
+	admin := func(method string, path string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer test-token")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Extensions must still be CRXs, and apps need valid package names
+	assert.Equal(t, http.StatusBadRequest, admin(http.MethodPut, "/api/admin/extensions/"+url.PathEscape(id)+"/versions/1.0.0", payload).Code)
+	assert.Equal(t, http.StatusBadRequest, admin(http.MethodPut, "/api/admin/extensions/"+url.PathEscape(id)+"/versions/1.0.0?type=app&packageName=..%2Fsetup.exe", payload).Code)
+	assert.Equal(t, http.StatusBadRequest, admin(http.MethodPut, "/api/admin/extensions/../versions/1.0.0?type=app", payload).Code)
+	_, err := os.Stat(filepath.Join(crxDirectory, "release", "setup.exe"))
+	assert.True(t, os.IsNotExist(err))
+
+	// The package of an app is published with its own name
+	rr := admin(http.MethodPut, "/api/admin/extensions/"+url.PathEscape(id)+"/versions/1.0.0?type=app&title=Installer&optional=true&packageName="+url.QueryEscape("setup_{version_underscored}.exe"), payload)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	published, err := ioutil.ReadFile(filepath.Join(crxDirectory, "release", id, "setup_1_0_0.exe"))
+	assert.Nil(t, err)
+	assert.Equal(t, payload, published)
+	app, ok := handlerOptions.CurrentCatalog().Lookup(id)
+	assert.True(t, ok)
+	assert.True(t, app.IsApp())
+	assert.True(t, app.Optional)
+
+	req := httptest.NewRequest(http.MethodPost, "/extensions", strings.NewReader(extensiontest.ExtensionRequestFnFor(id)("0.0.0")))
+	req.Header.Set("Content-Type", "application/xml")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `/release/%7B8A69D345-D564-463C-AFF1-A69D9E530F96%7D/setup_1_0_0.exe"></url>`)
+	assert.Contains(t, rr.Body.String(), `<package name="setup_1_0_0.exe" hash_sha256="`)
+	assert.Contains(t, rr.Body.String(), `required="false"`)
+
+	// It is served like CRXs
+	req = httptest.NewRequest(http.MethodGet, "/crx/"+url.PathEscape(id)+"/1.0.0", nil)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/octet-stream", rr.Header().Get("Content-Type"))
+	assert.Equal(t, payload, rr.Body.Bytes())
+
+	// Later versions keep the package name
+	assert.Equal(t, http.StatusCreated, admin(http.MethodPut, "/api/admin/extensions/"+url.PathEscape(id)+"/versions/1.1.0", payload).Code)
+	_, err = os.Stat(filepath.Join(crxDirectory, "release", id, "setup_1_1_0.exe"))
+	assert.Nil(t, err)
+}
@@ -0,0 +1,431 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/brave/go-update/crx"
+	"github.com/brave/go-update/extension"
+	"github.com/pressly/lg"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AdminError is an admin call which failed, with the HTTP status it is answered with
+type AdminError struct {
+	Status  int
+	Message string
+}
+
+// Error returns the message the call is answered with
+func (err *AdminError) Error() string {
+	return err.Message
+}
+
+// adminErrorf returns an AdminError with status and a formatted message
+func adminErrorf(status int, format string, args ...interface{}) error {
+	return &AdminError{Status: status, Message: fmt.Sprintf(format, args...)}
+}
+
+// AdminErrorStatus returns the HTTP status of an admin call which failed with err
+func AdminErrorStatus(err error) int {
+	var adminErr *AdminError
+	if errors.As(err, &adminErr) {
+		return adminErr.Status
+	}
+	return errorStatus(err)
+}
+
+// writeAdminError responds to an admin request which failed with err
+func writeAdminError(w http.ResponseWriter, r *http.Request, err error) {
+	http.Error(w, err.Error(), AdminErrorStatus(err))
+}
+
+// AdminService makes the changes of the admin API, for the REST handlers and other transports like gRPC.
+// Calls are for the catalog of the tenant in their context, or the default catalog, and must have been
+// authorized with AuthorizeAdmin so they are audited with the caller's identity.
+type AdminService struct{}
+
+// adminService serves the REST handlers
+var adminService AdminService
+
+// Upload is a new version of an extension, or the package of an app
+type Upload struct {
+	ID      string
+	Version string
+	// PublishAt is an RFC 3339 time to publish the version at instead of now
+	PublishAt string
+	// Title and Type are only used for extensions which aren't in the catalog yet
+	Title string
+	Type  string
+	// PackageName and Optional replace those of the extension unless they are nil
+	PackageName *string
+	Optional    *bool
+	// Dependencies are IDs of the extensions kept up to date along with this one, which replace the current
+	// ones unless they are nil
+	Dependencies []string
+	ReleaseNotes string
+}
+
+// ListExtensions returns the catalog sorted by ID
+func (AdminService) ListExtensions(ctx context.Context) extension.Extensions {
+	extensions := extension.Extensions{}
+	for _, ext := range snapshotFor(ctx).Map() {
+		extensions = append(extensions, ext)
+	}
+	sort.Slice(extensions, func(i, j int) bool {
+		return extensions[i].ID < extensions[j].ID
+	})
+	return extensions
+}
+
+// GetExtension returns the catalog entry of the extension with id
+func (AdminService) GetExtension(ctx context.Context, id string) (extension.Extension, error) {
+	ext, ok := snapshotFor(ctx).Map()[id]
+	if !ok {
+		return extension.Extension{}, adminErrorf(http.StatusNotFound, "Extension %s isn't in the catalog", id)
+	}
+	return ext, nil
+}
+
+// UploadExtension publishes body, the CRX of a new version of an extension or the package of an app, and registers
+// it in the catalog. CRXs must be signed with the key the extension's ID is derived from. The body is hashed, published to the release bucket (or CRXDirectory when serving payloads
+// locally) and then saved to the store. With a PublishAt time in the future, the version is scheduled and only
+// served once that time has passed. It returns the catalog entry of the extension.
+func (AdminService) UploadExtension(ctx context.Context, upload Upload, body io.Reader) (extension.Extension, error) {
+	log := lg.Log(ctx)
+	if optionsFor(ctx).frozen() {
+		return extension.Extension{}, adminErrorf(http.StatusForbidden, "The catalog is frozen")
+	}
+	id, version := upload.ID, upload.Version
+	if !versionRegexp.MatchString(version) {
+		return extension.Extension{}, adminErrorf(http.StatusBadRequest, "Invalid version: %s", version)
+	}
+	var publishAt *time.Time
+	if len(upload.PublishAt) != 0 {
+		parsed, err := time.Parse(time.RFC3339, upload.PublishAt)
+		if err != nil {
+			return extension.Extension{}, adminErrorf(http.StatusBadRequest, "Error parsing publishAt: %v", err)
+		}
+		// Versions scheduled for a time which has already passed are published straight away
+		if parsed.After(optionsFor(ctx).clock().Now()) {
+			publishAt = &parsed
+		}
+	}
+	// Uploads of the same extension run one at a time, or two could both be checked against the version before
+	// them and the older one could be saved last
+	defer holderFor(ctx).lockUploads(id)()
+	ext, ok := snapshotFor(ctx).Map()[id]
+	if ok && extension.CompareVersions(version, ext.Version) <= 0 {
+		return extension.Extension{}, adminErrorf(http.StatusConflict, "Version %s is not newer than %s", version, ext.Version)
+	}
+	if ok && ext.Scheduled != nil && extension.CompareVersions(version, ext.Scheduled.Version) == 0 {
+		return extension.Extension{}, adminErrorf(http.StatusConflict, "Version %s is already scheduled", version)
+	}
+	// The catalog entry is a copy, so it is still the state before the upload once ext is changed
+	var before interface{}
+	action := AuditUpdate
+	previous := ""
+	if ok {
+		before = ext
+		previous = ext.Version
+	} else {
+		action = AuditCreate
+		ext = extension.Extension{ID: id, Title: upload.Title, Type: upload.Type}
+	}
+	current := ext
+	if upload.PackageName != nil {
+		ext.PackageName = *upload.PackageName
+	}
+	if upload.Optional != nil {
+		ext.Optional = *upload.Optional
+	}
+	// Apps aren't checked against the ID of a CRX, and their ID and package name are part of the key it is published at
+	if ext.IsApp() && (!appIDRegexp.MatchString(id) || (len(ext.PackageName) != 0 && !packageNameRegexp.MatchString(ext.PackageName))) {
+		return extension.Extension{}, adminErrorf(http.StatusBadRequest, "Invalid app ID %s or package name %s", id, ext.PackageName)
+	}
+	if upload.Dependencies != nil {
+		ext.Dependencies = nil
+		for _, dependency := range upload.Dependencies {
+			if dependency = strings.TrimSpace(dependency); len(dependency) != 0 {
+				ext.Dependencies = append(ext.Dependencies, dependency)
+			}
+		}
+	}
+
+	// Spool the upload to disk so we don't need to hold large payloads in memory
+	f, err := ioutil.TempFile("", "go-update-upload")
+	if err != nil {
+		captureContextError(ctx, err)
+		return extension.Extension{}, adminErrorf(http.StatusInternalServerError, "Error creating temporary file: %v", err)
+	}
+	defer func() {
+		err := f.Close()
+		if err != nil {
+			log.Errorf("Error closing temporary file: %v", err)
+		}
+		err = os.Remove(f.Name())
+		if err != nil {
+			log.Errorf("Error removing temporary file: %v", err)
+		}
+	}()
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, hash), io.LimitReader(body, MaxUploadSize+1))
+	if err != nil {
+		return extension.Extension{}, adminErrorf(http.StatusBadRequest, "Error reading body: %v", err)
+	}
+	if size > MaxUploadSize {
+		return extension.Extension{}, adminErrorf(http.StatusRequestEntityTooLarge, "Request too large")
+	}
+
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		captureContextError(ctx, err)
+		return extension.Extension{}, adminErrorf(http.StatusInternalServerError, "Error reading upload: %v", err)
+	}
+	// The packages of apps are installers in their own format, so only CRXs are checked
+	if !ext.IsApp() {
+		// The signature proves the ID, which is derived from the key the CRX is signed with
+		header, err := crx.Verify(f)
+		if err != nil {
+			return extension.Extension{}, adminErrorf(http.StatusBadRequest, "Invalid CRX: %v", err)
+		}
+		if header.ID() != id {
+			return extension.Extension{}, adminErrorf(http.StatusBadRequest, "CRX is for extension %s, not %s", header.ID(), id)
+		}
+
+		_, err = f.Seek(0, io.SeekStart)
+		if err != nil {
+			captureContextError(ctx, err)
+			return extension.Extension{}, adminErrorf(http.StatusInternalServerError, "Error reading upload: %v", err)
+		}
+	}
+	err = publishCRX(ctx, getPackageKey(extension.Extension{ID: id, Version: version, PackageName: ext.PackageName}), f)
+	if err != nil {
+		captureContextError(ctx, err)
+		return extension.Extension{}, adminErrorf(http.StatusInternalServerError, "Error publishing CRX: %v", err)
+	}
+
+	ext.Version = version
+	ext.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	ext.Size = size
+	ext.PublishAt = publishAt
+	// Release notes describe one version, so they aren't carried over from the previous one
+	ext.ReleaseNotes = upload.ReleaseNotes
+	entry := ext
+	if publishAt != nil {
+		// The current version keeps being served until the scheduled one is due
+		ext.Scheduled = nil
+		entry = current
+		entry.Scheduled = &ext
+	} else if ext.Scheduled != nil && extension.CompareVersions(ext.Scheduled.Version, version) <= 0 {
+		entry.Scheduled = nil
+	}
+	err = storeFor(ctx).SaveExtension(ctx, entry)
+	if err != nil {
+		return extension.Extension{}, saveError(ctx, err)
+	}
+	saveToCatalog(ctx, publishScheduled(holderFor(ctx), entry))
+	audit(ctx, action, "extensions/"+id, before, entry)
+	notifyRelease(ctx, previous, ext)
+	return entry, nil
+}
+
+// DeleteExtension removes the extension with id from the store and the catalog, so it is no longer offered
+func (AdminService) DeleteExtension(ctx context.Context, id string) error {
+	if optionsFor(ctx).frozen() {
+		return adminErrorf(http.StatusForbidden, "The catalog is frozen")
+	}
+	ext, ok := snapshotFor(ctx).Map()[id]
+	if !ok {
+		return adminErrorf(http.StatusNotFound, "Extension %s isn't in the catalog", id)
+	}
+	err := storeFor(ctx).DeleteExtension(ctx, id)
+	if err != nil {
+		status := errorStatus(err)
+		if status == http.StatusInternalServerError {
+			captureContextError(ctx, err)
+		}
+		return adminErrorf(status, "Error deleting extension: %v", err)
+	}
+	deleteFromCatalog(ctx, id)
+	audit(ctx, AuditDelete, "extensions/"+id, ext, nil)
+	lg.Log(ctx).Infof("Deleted extension %s", id)
+	return nil
+}
+
+// BlacklistExtension stops offering updates for the extension with id when blacklisted is true,
+// or offers them again, and returns its catalog entry
+func (service AdminService) BlacklistExtension(ctx context.Context, id string, blacklisted bool) (extension.Extension, error) {
+	if optionsFor(ctx).frozen() {
+		return extension.Extension{}, adminErrorf(http.StatusForbidden, "The catalog is frozen")
+	}
+	ext, ok := snapshotFor(ctx).Map()[id]
+	if !ok {
+		return extension.Extension{}, adminErrorf(http.StatusNotFound, "Extension %s isn't in the catalog", id)
+	}
+	before := ext
+	ext.Blacklisted = blacklisted
+	action := AuditUpdate
+	if blacklisted {
+		action = AuditBlacklist
+	}
+	err := service.saveEntry(ctx, action, before, ext)
+	if err != nil {
+		return extension.Extension{}, err
+	}
+	return ext, nil
+}
+
+// saveEntry saves the catalog entry changed from before to the store and the catalog, and audits the change as action
+func (AdminService) saveEntry(ctx context.Context, action string, before extension.Extension, ext extension.Extension) error {
+	err := storeFor(ctx).SaveExtension(ctx, ext)
+	if err != nil {
+		return saveError(ctx, err)
+	}
+	saveToCatalog(ctx, ext)
+	audit(ctx, action, "extensions/"+ext.ID, before, ext)
+	return nil
+}
+
+// saveError is the AdminError of a catalog entry which the store failed to save
+func saveError(ctx context.Context, err error) error {
+	status := errorStatus(err)
+	if status == http.StatusInternalServerError {
+		captureContextError(ctx, err)
+	}
+	return adminErrorf(status, "Error saving extension: %v", err)
+}
+
+// RefreshCatalog reloads the catalog from its store now rather than at the next refresh interval
+func (AdminService) RefreshCatalog(ctx context.Context) error {
+	if optionsFor(ctx).frozen() {
+		return adminErrorf(http.StatusForbidden, "The catalog is frozen")
+	}
+	if tenant := contextTenant(ctx); tenant != nil {
+		tenant.refresh()
+	} else {
+		optionsFor(ctx).refreshDefaultCatalog()
+	}
+	lg.Log(ctx).Info("Refreshed the catalog")
+	return nil
+}
+
+// ReloadConfig reloads the configuration with the Reload hook of the Options serving the call
+func (AdminService) ReloadConfig(ctx context.Context) error {
+	opts := optionsFor(ctx)
+	if opts == nil || opts.Reload == nil {
+		return adminErrorf(http.StatusNotImplemented, "Reloading is not supported")
+	}
+	err := opts.Reload()
+	if err != nil {
+		lg.Log(ctx).Errorf("Error reloading config: %v", err)
+		return adminErrorf(http.StatusBadRequest, "Error reloading config: %v", err)
+	}
+	audit(ctx, AuditReload, "config", nil, nil)
+	return nil
+}
+
+// Maintenance returns whether maintenance mode is enabled
+func (AdminService) Maintenance(ctx context.Context) MaintenanceStatus {
+	settings := optionsFor(ctx).settings()
+	return MaintenanceStatus{Enabled: settings.MaintenanceMode, RetryAfter: int(settings.MaintenanceRetryAfter.Seconds())}
+}
+
+// SetMaintenance turns maintenance mode on or off. It lasts until it is changed again or the configuration is reloaded.
+func (service AdminService) SetMaintenance(ctx context.Context, enabled bool) (MaintenanceStatus, error) {
+	opts := optionsFor(ctx)
+	if opts == nil {
+		return MaintenanceStatus{}, adminErrorf(http.StatusNotImplemented, "Maintenance mode can't be changed without options")
+	}
+	var before bool
+	opts.UpdateSettings(func(settings *Settings) {
+		before, settings.MaintenanceMode = settings.MaintenanceMode, enabled
+	})
+	audit(ctx, AuditUpdate, "maintenance", map[string]bool{"enabled": before}, map[string]bool{"enabled": enabled})
+	if enabled {
+		lg.Log(ctx).Warn("Maintenance mode enabled")
+	} else {
+		lg.Log(ctx).Warn("Maintenance mode disabled")
+	}
+	return service.Maintenance(ctx), nil
+}
+
+// ServingWindows returns the serving windows sorted by extension ID
+func (AdminService) ServingWindows(ctx context.Context) []ServingWindow {
+	opts := optionsFor(ctx)
+	if opts == nil {
+		return []ServingWindow{}
+	}
+	return opts.windows.list()
+}
+
+// PutServingWindow only offers updates for the extension with the window's ID within the window
+func (AdminService) PutServingWindow(ctx context.Context, window ServingWindow) (ServingWindow, error) {
+	id := window.ID
+	if !appIDRegexp.MatchString(id) {
+		return ServingWindow{}, adminErrorf(http.StatusBadRequest, "Invalid extension ID: %s", id)
+	}
+	err := window.validate()
+	if err != nil {
+		return ServingWindow{}, adminErrorf(http.StatusBadRequest, "Invalid serving window: %v", err)
+	}
+	opts := optionsFor(ctx)
+	if opts == nil {
+		return ServingWindow{}, adminErrorf(http.StatusNotImplemented, "Serving windows can't be changed without options")
+	}
+
+	before, existed := opts.windows.put(window)
+	err = opts.saveServingWindows()
+	if err != nil {
+		captureContextError(ctx, err)
+		return ServingWindow{}, adminErrorf(http.StatusInternalServerError, "Error saving serving windows: %v", err)
+	}
+	if existed {
+		audit(ctx, AuditUpdate, "serving-windows/"+id, before, window)
+	} else {
+		audit(ctx, AuditCreate, "serving-windows/"+id, nil, window)
+	}
+	lg.Log(ctx).Infof("Serving extension %s from %s to %s", id, window.Start, window.End)
+	return window, nil
+}
+
+// DeleteServingWindow offers updates for the extension with id at any time again
+func (AdminService) DeleteServingWindow(ctx context.Context, id string) error {
+	opts := optionsFor(ctx)
+	if opts == nil {
+		return adminErrorf(http.StatusNotFound, "Extension %s has no serving window", id)
+	}
+	before, ok := opts.windows.remove(id)
+	if !ok {
+		return adminErrorf(http.StatusNotFound, "Extension %s has no serving window", id)
+	}
+	err := opts.saveServingWindows()
+	if err != nil {
+		captureContextError(ctx, err)
+		return adminErrorf(http.StatusInternalServerError, "Error saving serving windows: %v", err)
+	}
+	audit(ctx, AuditDelete, "serving-windows/"+id, before, nil)
+	lg.Log(ctx).Infof("Serving extension %s at any time", id)
+	return nil
+}
+
+// ExtensionStats counts the updates served and downloads of every extension version since startup,
+// or only the versions of the extension with id unless it is empty
+func (AdminService) ExtensionStats(ctx context.Context, id string) ExtensionStatsReport {
+	since, counts := optionsFor(ctx).extensionStatsSince()
+	report := ExtensionStatsReport{Since: since, Extensions: []ExtensionStats{}}
+	for _, stats := range counts {
+		if len(id) == 0 || stats.ID == id {
+			report.Extensions = append(report.Extensions, stats)
+		}
+	}
+	return report
+}
@@ -0,0 +1,275 @@
+package controller
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cloudwatchtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/brave/go-update/extension"
+	"github.com/getsentry/raven-go"
+	"github.com/go-chi/chi"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ExtensionStats counts how often a version of an extension was offered to clients and downloaded
+type ExtensionStats struct {
+	ID            string `json:"id"`
+	Version       string `json:"version"`
+	UpdatesServed int64  `json:"updatesServed"`
+	Downloads     int64  `json:"downloads"`
+}
+
+// ExtensionStatsReport is the response of /api/stats/extensions
+type ExtensionStatsReport struct {
+	// Since is when the server started counting
+	Since      time.Time        `json:"since"`
+	Extensions []ExtensionStats `json:"extensions"`
+}
+
+// StatsSink persists the counts which haven't been flushed yet, like CloudWatch or DynamoDB
+type StatsSink interface {
+	// FlushExtensionStats returns how many of stats, in order, were persisted even if it fails part way
+	FlushExtensionStats(ctx context.Context, stats []ExtensionStats) (int, error)
+}
+
+// extensionCounts are the counts of some Options since they started, and those not flushed to a StatsSink yet
+type extensionCounts struct {
+	mutex   sync.Mutex
+	since   time.Time
+	total   map[string]ExtensionStats
+	pending map[string]ExtensionStats
+}
+
+// statsOperations are the /api/stats endpoints
+var statsOperations = []apiOperation{
+	{
+		Method: http.MethodGet, Pattern: "/extensions", Handler: GetExtensionStats, Summary: "Count updates served and downloads of every extension version",
+		Query: []apiParameter{{Name: "id", Description: "Only count versions of this extension"}}, Response: ExtensionStatsReport{},
+	},
+}
+
+// StatsRouter is the router for /api/stats endpoints, which require an admin token
+func StatsRouter(opts *Options) chi.Router {
+	r := chi.NewRouter()
+	r.Use(ServeWith(opts))
+	r.Use(adminAuthorizedOnly)
+	routeOperations(r, statsOperations)
+	return r
+}
+
+func addExtensionStats(counts map[string]ExtensionStats, add ExtensionStats) {
+	key := add.ID + "@" + add.Version
+	stats, ok := counts[key]
+	if !ok {
+		stats = ExtensionStats{ID: add.ID, Version: add.Version}
+	}
+	stats.UpdatesServed += add.UpdatesServed
+	stats.Downloads += add.Downloads
+	counts[key] = stats
+}
+
+// init starts counting now unless counting already started, and must be called with the mutex held
+func (counts *extensionCounts) init() {
+	if counts.total == nil {
+		counts.since = time.Now()
+		counts.total = map[string]ExtensionStats{}
+		counts.pending = map[string]ExtensionStats{}
+	}
+}
+
+// countExtensionStats adds to the counts of opts. Nothing is counted without options.
+func (opts *Options) countExtensionStats(add ExtensionStats) {
+	if opts == nil {
+		return
+	}
+	counts := &opts.extensionCounts
+	counts.mutex.Lock()
+	defer counts.mutex.Unlock()
+	counts.init()
+	addExtensionStats(counts.total, add)
+	addExtensionStats(counts.pending, add)
+}
+
+// recordDownload counts a CRX download of an extension version
+func (opts *Options) recordDownload(id string, version string) {
+	opts.countExtensionStats(ExtensionStats{ID: id, Version: version, Downloads: 1})
+}
+
+// GetExtensionStatsSnapshot returns the counts of opts since they started sorted by ID and version
+func (opts *Options) GetExtensionStatsSnapshot() []ExtensionStats {
+	_, stats := opts.extensionStatsSince()
+	return stats
+}
+
+// extensionStatsSince returns when opts started counting, and the counts since then sorted by ID and version
+func (opts *Options) extensionStatsSince() (time.Time, []ExtensionStats) {
+	if opts == nil {
+		return time.Now(), []ExtensionStats{}
+	}
+	counts := &opts.extensionCounts
+	counts.mutex.Lock()
+	defer counts.mutex.Unlock()
+	counts.init()
+	return counts.since, sortedExtensionStats(counts.total)
+}
+
+func sortedExtensionStats(counts map[string]ExtensionStats) []ExtensionStats {
+	stats := []ExtensionStats{}
+	for _, s := range counts {
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].ID != stats[j].ID {
+			return stats[i].ID < stats[j].ID
+		}
+		return extension.CompareVersions(stats[i].Version, stats[j].Version) < 0
+	})
+	return stats
+}
+
+// GetExtensionStats is the handler for the update and download counts of every extension version.
+// The id query parameter limits the result to a single extension.
+func GetExtensionStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, http.StatusOK, adminService.ExtensionStats(r.Context(), r.URL.Query().Get("id")))
+}
+
+// FlushExtensionStatsEvery sends the counts of opts to sink on every interval
+func (opts *Options) FlushExtensionStatsEvery(sink StatsSink, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			err := opts.flushExtensionStats(sink, interval)
+			if err != nil {
+				log.Printf("error flushing extension stats: %v\n", err)
+				raven.CaptureError(err, map[string]string{"task": "stats"})
+			}
+		}
+	}()
+}
+
+// flushExtensionStats sends the pending counts of opts to sink, keeping any it fails to persist for the next flush
+func (opts *Options) flushExtensionStats(sink StatsSink, timeout time.Duration) error {
+	counts := &opts.extensionCounts
+	counts.mutex.Lock()
+	counts.init()
+	pending := sortedExtensionStats(counts.pending)
+	counts.pending = map[string]ExtensionStats{}
+	counts.mutex.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	flushed, err := sink.FlushExtensionStats(ctx, pending)
+	if err != nil {
+		counts.mutex.Lock()
+		defer counts.mutex.Unlock()
+		for _, stats := range pending[flushed:] {
+			addExtensionStats(counts.pending, stats)
+		}
+	}
+	return err
+}
+
+// CloudWatchStatsSink publishes the counts as the UpdatesServed and Downloads metrics,
+// with ExtensionID and Version dimensions
+type CloudWatchStatsSink struct {
+	Namespace string
+	// Region is the region the metrics are put in, DefaultAWSRegion if not set
+	Region string
+}
+
+// cloudWatchBatchSize is the most metrics PutMetricData accepts at once
+const cloudWatchBatchSize = 20
+
+// FlushExtensionStats puts the counts in batches
+func (sink CloudWatchStatsSink) FlushExtensionStats(ctx context.Context, stats []ExtensionStats) (int, error) {
+	cfg, err := AWSConfig(ctx, regionOrDefault(sink.Region))
+	if err != nil {
+		return 0, err
+	}
+	svc := cloudwatch.NewFromConfig(cfg)
+	// Each batch holds both metrics for half as many versions
+	step := cloudWatchBatchSize / 2
+	for start := 0; start < len(stats); start += step {
+		end := start + step
+		if end > len(stats) {
+			end = len(stats)
+		}
+		data := []cloudwatchtypes.MetricDatum{}
+		for _, s := range stats[start:end] {
+			dimensions := []cloudwatchtypes.Dimension{
+				{Name: aws.String("ExtensionID"), Value: aws.String(s.ID)},
+				{Name: aws.String("Version"), Value: aws.String(s.Version)},
+			}
+			data = append(data, cloudwatchtypes.MetricDatum{
+				MetricName: aws.String("UpdatesServed"),
+				Dimensions: dimensions,
+				Unit:       cloudwatchtypes.StandardUnitCount,
+				Value:      aws.Float64(float64(s.UpdatesServed)),
+			}, cloudwatchtypes.MetricDatum{
+				MetricName: aws.String("Downloads"),
+				Dimensions: dimensions,
+				Unit:       cloudwatchtypes.StandardUnitCount,
+				Value:      aws.Float64(float64(s.Downloads)),
+			})
+		}
+		_, err = svc.PutMetricData(ctx, &cloudwatch.PutMetricDataInput{
+			Namespace:  aws.String(sink.Namespace),
+			MetricData: data,
+		})
+		if err != nil {
+			return start, err
+		}
+	}
+	return len(stats), nil
+}
+
+// DynamoDBStatsSink adds the counts to a table keyed by ID and Version,
+// keeping running totals across restarts and instances
+type DynamoDBStatsSink struct {
+	Table string
+	// Region is the region of the table, DefaultAWSRegion if not set
+	Region string
+	// Endpoint overrides the DynamoDB endpoint, for example to use DynamoDB Local
+	Endpoint string
+}
+
+// FlushExtensionStats adds the counts to each version's item
+func (sink DynamoDBStatsSink) FlushExtensionStats(ctx context.Context, stats []ExtensionStats) (int, error) {
+	cfg, err := AWSConfig(ctx, regionOrDefault(sink.Region))
+	if err != nil {
+		return 0, err
+	}
+	svc := dynamodb.NewFromConfig(cfg, func(options *dynamodb.Options) {
+		if len(sink.Endpoint) != 0 {
+			options.BaseEndpoint = aws.String(sink.Endpoint)
+		}
+	})
+	for i, s := range stats {
+		_, err = svc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName: aws.String(sink.Table),
+			Key: map[string]dynamodbtypes.AttributeValue{
+				"ID":      &dynamodbtypes.AttributeValueMemberS{Value: s.ID},
+				"Version": &dynamodbtypes.AttributeValueMemberS{Value: s.Version},
+			},
+			UpdateExpression: aws.String("ADD UpdatesServed :updates, Downloads :downloads"),
+			ExpressionAttributeValues: map[string]dynamodbtypes.AttributeValue{
+				":updates":   &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatInt(s.UpdatesServed, 10)},
+				":downloads": &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatInt(s.Downloads, 10)},
+			},
+		})
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(stats), nil
+}
@@ -0,0 +1,104 @@
+package controller_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/extension/extensiontest"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingStatsSink keeps everything flushed to it, failing the first flush part way
+type recordingStatsSink struct {
+	mutex   sync.Mutex
+	flushes int
+	stats   map[string]controller.ExtensionStats
+}
+
+func (sink *recordingStatsSink) FlushExtensionStats(ctx context.Context, stats []controller.ExtensionStats) (int, error) {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	sink.flushes++
+	flushed := len(stats)
+	if sink.flushes == 1 {
+		flushed = len(stats) / 2
+	}
+	for _, s := range stats[:flushed] {
+		total := sink.stats[s.ID+"@"+s.Version]
+		total.UpdatesServed += s.UpdatesServed
+		total.Downloads += s.Downloads
+		sink.stats[s.ID+"@"+s.Version] = total
+	}
+	if flushed != len(stats) {
+		return flushed, errors.New("throttled")
+	}
+	return flushed, nil
+}
+
+func TestExtensionStats(t *testing.T) {
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	id := "bfdgpgibhagkpdlnjonhkabjoijopoge"
+	version := handlerOptions.CurrentCatalog().Map()[id].Version
+	getStats := func() controller.ExtensionStats {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/api/stats/extensions?id="+id, nil)
+		assert.Nil(t, err)
+		req.Header.Set("Authorization", "Bearer test-token")
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		report := controller.ExtensionStatsReport{}
+		assert.Nil(t, json.NewDecoder(resp.Body).Decode(&report))
+		for _, stats := range report.Extensions {
+			assert.Equal(t, id, stats.ID)
+			if stats.Version == version {
+				return stats
+			}
+		}
+		return controller.ExtensionStats{}
+	}
+
+	before := getStats()
+	requestBody := extensiontest.ExtensionRequestFnFor(id)("0.0.0")
+	for i := 0; i < 2; i++ {
+		resp, err := http.Post(server.URL+"/extensions", "application/xml", bytes.NewBufferString(requestBody))
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	resp, err := http.Get(fmt.Sprintf("%s/crx/%s/%s", server.URL, id, version))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	after := getStats()
+	assert.Equal(t, before.UpdatesServed+2, after.UpdatesServed)
+	assert.Equal(t, before.Downloads+1, after.Downloads)
+
+	// Warming up isn't counted as serving updates, and skips extensions which aren't in the catalog
+	controller.WarmUp(handler, handlerOptions, []string{id, "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"})
+	assert.Equal(t, after.UpdatesServed, getStats().UpdatesServed)
+
+	// Stats need an admin token
+	resp, err = http.Get(server.URL + "/api/stats/extensions")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// Counts that fail to flush are sent again with the next flush
+	sink := &recordingStatsSink{stats: map[string]controller.ExtensionStats{}}
+	handlerOptions.FlushExtensionStatsEvery(sink, time.Millisecond)
+	flushed := func() bool {
+		sink.mutex.Lock()
+		defer sink.mutex.Unlock()
+		return sink.flushes > 1 && sink.stats[id+"@"+version].UpdatesServed == after.UpdatesServed
+	}
+	for i := 0; i < 100 && !flushed(); i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	assert.True(t, flushed())
+}
@@ -0,0 +1,314 @@
+package controller
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	chiware "github.com/go-chi/chi/middleware"
+	"github.com/pressly/lg"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Actions of audit records
+const (
+	AuditCreate    = "create"
+	AuditUpdate    = "update"
+	AuditDelete    = "delete"
+	AuditBlacklist = "blacklist"
+	AuditRollback  = "rollback"
+	AuditReload    = "reload"
+)
+
+// auditMaxRecords is the most records returned by one request for /api/admin/audit
+const auditMaxRecords = 1000
+
+// AuditRecord is a change made with the admin API: who made it, to what, when, and the state before and after
+type AuditRecord struct {
+	ID        string          `json:"id"`
+	Time      time.Time       `json:"time"`
+	Actor     string          `json:"actor"`
+	Role      string          `json:"role,omitempty"`
+	Action    string          `json:"action"`
+	Target    string          `json:"target"`
+	Tenant    string          `json:"tenant,omitempty"`
+	RequestID string          `json:"requestId,omitempty"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+}
+
+// AuditFilter selects audit records. Empty fields and zero times match every record.
+type AuditFilter struct {
+	Actor  string
+	Action string
+	Target string
+	Tenant string
+	Since  time.Time
+	Until  time.Time
+}
+
+func (filter AuditFilter) matches(record AuditRecord) bool {
+	return (len(filter.Actor) == 0 || record.Actor == filter.Actor) &&
+		(len(filter.Action) == 0 || record.Action == filter.Action) &&
+		(len(filter.Target) == 0 || record.Target == filter.Target) &&
+		(len(filter.Tenant) == 0 || record.Tenant == filter.Tenant) &&
+		(filter.Since.IsZero() || !record.Time.Before(filter.Since)) &&
+		(filter.Until.IsZero() || record.Time.Before(filter.Until))
+}
+
+// AuditLog keeps audit records, which are never changed or removed once appended
+type AuditLog interface {
+	Append(ctx context.Context, record AuditRecord) error
+	// Query returns the records matching filter, in any order
+	Query(ctx context.Context, filter AuditFilter) ([]AuditRecord, error)
+}
+
+// MemoryAuditLog keeps audit records until the server restarts
+type MemoryAuditLog struct {
+	mutex   sync.Mutex
+	records []AuditRecord
+}
+
+// Append adds record to the log
+func (auditLog *MemoryAuditLog) Append(ctx context.Context, record AuditRecord) error {
+	auditLog.mutex.Lock()
+	defer auditLog.mutex.Unlock()
+	auditLog.records = append(auditLog.records, record)
+	return nil
+}
+
+// Query returns the records matching filter in the order they were appended
+func (auditLog *MemoryAuditLog) Query(ctx context.Context, filter AuditFilter) ([]AuditRecord, error) {
+	auditLog.mutex.Lock()
+	defer auditLog.mutex.Unlock()
+	records := []AuditRecord{}
+	for _, record := range auditLog.records {
+		if filter.matches(record) {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+// FileAuditLog appends audit records to a file, one JSON record per line
+type FileAuditLog struct {
+	Path  string
+	mutex sync.Mutex
+}
+
+// Append adds record to the end of the file, creating it if needed
+func (auditLog *FileAuditLog) Append(ctx context.Context, record AuditRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	auditLog.mutex.Lock()
+	defer auditLog.mutex.Unlock()
+	file, err := os.OpenFile(auditLog.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(data, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Query reads the records matching filter from the file in the order they were appended
+func (auditLog *FileAuditLog) Query(ctx context.Context, filter AuditFilter) ([]AuditRecord, error) {
+	auditLog.mutex.Lock()
+	defer auditLog.mutex.Unlock()
+	records := []AuditRecord{}
+	file, err := os.Open(auditLog.Path)
+	if os.IsNotExist(err) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	// Records hold whole catalog entries, which can be longer than the default line limit
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		record := AuditRecord{}
+		err = json.Unmarshal(scanner.Bytes(), &record)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", auditLog.Path, err)
+		}
+		if filter.matches(record) {
+			records = append(records, record)
+		}
+	}
+	return records, scanner.Err()
+}
+
+// DynamoDBAuditLog puts audit records in a table keyed by ID, shared by every instance.
+// Records are only ever put when their ID isn't taken, so they can't be overwritten.
+type DynamoDBAuditLog struct {
+	Table string
+	// Region is the region of the table, DefaultAWSRegion if not set
+	Region string
+	// Endpoint overrides the DynamoDB endpoint, for example to use DynamoDB Local
+	Endpoint string
+}
+
+func (auditLog DynamoDBAuditLog) client(ctx context.Context) (*dynamodb.Client, error) {
+	cfg, err := AWSConfig(ctx, regionOrDefault(auditLog.Region))
+	if err != nil {
+		return nil, err
+	}
+	return dynamodb.NewFromConfig(cfg, func(options *dynamodb.Options) {
+		if len(auditLog.Endpoint) != 0 {
+			options.BaseEndpoint = aws.String(auditLog.Endpoint)
+		}
+	}), nil
+}
+
+// Append puts record in the table
+func (auditLog DynamoDBAuditLog) Append(ctx context.Context, record AuditRecord) error {
+	svc, err := auditLog.client(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = svc.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(auditLog.Table),
+		Item: map[string]types.AttributeValue{
+			"ID":     &types.AttributeValueMemberS{Value: record.ID},
+			"Time":   &types.AttributeValueMemberS{Value: record.Time.Format(time.RFC3339Nano)},
+			"Record": &types.AttributeValueMemberS{Value: string(data)},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(ID)"),
+	})
+	return err
+}
+
+// Query scans the table for the records matching filter
+func (auditLog DynamoDBAuditLog) Query(ctx context.Context, filter AuditFilter) ([]AuditRecord, error) {
+	svc, err := auditLog.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	records := []AuditRecord{}
+	pages := dynamodb.NewScanPaginator(svc, &dynamodb.ScanInput{TableName: aws.String(auditLog.Table)})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return records, err
+		}
+		for _, item := range page.Items {
+			data, ok := itemString(item, "Record")
+			if !ok {
+				continue
+			}
+			record := AuditRecord{}
+			if json.Unmarshal([]byte(data), &record) == nil && filter.matches(record) {
+				records = append(records, record)
+			}
+		}
+	}
+	return records, nil
+}
+
+// auditActor identifies who made an admin request or call, as set by AuthorizeAdmin
+func auditActor(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok {
+		return actor
+	}
+	return "anonymous"
+}
+
+// audit records a change made by an admin request or call, with before and after encoded as JSON unless they are nil.
+// The change has already been made, so a record which can't be written is reported rather than failing the request.
+func audit(ctx context.Context, action string, target string, before interface{}, after interface{}) {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	record := AuditRecord{
+		ID:        hex.EncodeToString(id),
+		Time:      time.Now().UTC(),
+		Actor:     auditActor(ctx),
+		Role:      contextRole(ctx),
+		Action:    action,
+		Target:    target,
+		RequestID: chiware.GetReqID(ctx),
+	}
+	if tenant := contextTenant(ctx); tenant != nil {
+		record.Tenant = tenant.Name
+	}
+	if before != nil {
+		record.Before, _ = json.Marshal(before)
+	}
+	if after != nil {
+		record.After, _ = json.Marshal(after)
+	}
+	err := optionsFor(ctx).audit().Append(ctx, record)
+	if err != nil {
+		lg.Log(ctx).Errorf("Error writing audit record of %s %s: %v", action, target, err)
+		captureContextError(ctx, err)
+	}
+}
+
+// GetAuditRecords is the admin handler for querying the audit log, newest records first.
+// The actor, action, target and tenant query parameters select records, since and until are RFC 3339 times,
+// and limit is the most records returned.
+func GetAuditRecords(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := AuditFilter{
+		Actor:  query.Get("actor"),
+		Action: query.Get("action"),
+		Target: query.Get("target"),
+		Tenant: query.Get("tenant"),
+	}
+	for name, value := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if len(query.Get(name)) == 0 {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, query.Get(name))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error parsing %s: %v", name, err), http.StatusBadRequest)
+			return
+		}
+		*value = parsed
+	}
+	limit := 100
+	if value := query.Get("limit"); len(value) != 0 {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > auditMaxRecords {
+			http.Error(w, fmt.Sprintf("limit must be from 1 to %d", auditMaxRecords), http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	records, err := optionsFor(r.Context()).audit().Query(r.Context(), filter)
+	if err != nil {
+		captureRequestError(r, err)
+		http.Error(w, fmt.Sprintf("Error reading audit log: %v", err), http.StatusInternalServerError)
+		return
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Time.After(records[j].Time)
+	})
+	if len(records) > limit {
+		records = records[:limit]
+	}
+	writeList(w, r, "records", records)
+}
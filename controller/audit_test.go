@@ -0,0 +1,77 @@
+package controller_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/brave/go-update/controller"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAuditLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-update-audit")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	handler := newTestHandler(&controller.Options{Audit: &controller.FileAuditLog{Path: filepath.Join(dir, "audit.log")}})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	admin := func(method string, path string, body string) *http.Response {
+		req, err := http.NewRequest(method, server.URL+"/api/admin"+path, bytes.NewBufferString(body))
+		assert.Nil(t, err)
+		req.Header.Set("Authorization", "Bearer test-token")
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		return resp
+	}
+	type record struct {
+		Actor  string          `json:"actor"`
+		Action string          `json:"action"`
+		Target string          `json:"target"`
+		Before json.RawMessage `json:"before"`
+		After  json.RawMessage `json:"after"`
+	}
+	query := func(query string) []record {
+		resp := admin(http.MethodGet, "/audit"+query, "")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		records := []record{}
+		assert.Nil(t, json.NewDecoder(resp.Body).Decode(&records))
+		return records
+	}
+
+	target := "policy/forcelist/aomjjhallfgjeglblehebfpbcfeobpgk"
+	assert.Equal(t, http.StatusOK, admin(http.MethodPut, "/"+target, "").StatusCode)
+	assert.Equal(t, http.StatusOK, admin(http.MethodPut, "/"+target, `{"updateUrl":"https://example.com/crx"}`).StatusCode)
+	assert.Equal(t, http.StatusNoContent, admin(http.MethodDelete, "/"+target, "").StatusCode)
+	assert.Equal(t, http.StatusOK, admin(http.MethodPut, "/maintenance", "").StatusCode)
+	assert.Equal(t, http.StatusOK, admin(http.MethodDelete, "/maintenance", "").StatusCode)
+
+	// Every change is recorded with who made it and the state before and after, newest first
+	records := query("?target=" + target)
+	assert.Equal(t, 3, len(records))
+	assert.Equal(t, []string{"delete", "update", "create"}, []string{records[0].Action, records[1].Action, records[2].Action})
+	fingerprint := sha256.Sum256([]byte("test-token"))
+	assert.Equal(t, "token:"+hex.EncodeToString(fingerprint[:4]), records[0].Actor)
+	assert.Equal(t, `{"id":"aomjjhallfgjeglblehebfpbcfeobpgk","updateUrl":"https://example.com/crx"}`, string(records[0].Before))
+	assert.Empty(t, records[0].After)
+	assert.Equal(t, `{"id":"aomjjhallfgjeglblehebfpbcfeobpgk"}`, string(records[1].Before))
+	assert.Empty(t, records[2].Before)
+
+	records = query("?target=maintenance&limit=1")
+	assert.Equal(t, 1, len(records))
+	assert.Equal(t, `{"enabled":true}`, string(records[0].Before))
+	assert.Equal(t, `{"enabled":false}`, string(records[0].After))
+	assert.Equal(t, 0, len(query("?since="+time.Now().Add(time.Hour).UTC().Format(time.RFC3339))))
+
+	assert.Equal(t, http.StatusBadRequest, admin(http.MethodGet, "/audit?since=yesterday", "").StatusCode)
+	resp, err := http.Get(server.URL + "/api/admin/audit")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
@@ -0,0 +1,142 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"github.com/brave-intl/bat-go/middleware"
+	"github.com/pressly/lg"
+	"net/http"
+	"strings"
+)
+
+// Roles of admin API callers
+const (
+	// RoleReleaseManager can use the whole admin API, including changing the catalog
+	RoleReleaseManager = "release_manager"
+	// RoleViewer can only read, so dashboards can't change anything by accident
+	RoleViewer = "viewer"
+)
+
+type roleKey struct{}
+type actorKey struct{}
+
+// ParseAdminTokens splits a comma separated list of tokens, ignoring empty entries
+func ParseAdminTokens(value string) []string {
+	tokens := []string{}
+	for _, token := range strings.Split(value, ",") {
+		if token = strings.TrimSpace(token); len(token) != 0 {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+// adminAuthorizedOnly restricts access to requests with one of the admin or viewer tokens as their bearer token
+func adminAuthorizedOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveAuthorized(w, r, next, nil)
+	})
+}
+
+// serveAuthorized serves the request with the role of its bearer token for tenant, see AuthorizeAdmin
+func serveAuthorized(w http.ResponseWriter, r *http.Request, next http.Handler, tenant *Tenant) {
+	ctx, err := AuthorizeAdmin(r.Context(), tenant, bearerToken(r), !roleAllows(RoleViewer, r.Method))
+	if err != nil {
+		writeAdminError(w, r, err)
+		return
+	}
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// AuthorizeAdmin authorizes an admin call with token for the catalog of tenant, or the default catalog if it is nil.
+// Tokens from the AdminTokens of the settings serving ctx, or TOKEN_LIST if they aren't set, have the release manager
+// role, those from ViewerTokens the viewer role, and JWTs verified by the OIDC of the options serving ctx the role of
+// their groups. Tenants with their own admin tokens accept those instead of AdminTokens and SSO. Viewers can only make
+// calls which don't write anything.
+// It returns ctx with the caller's role, identity and tenant for audit records, or an AdminError.
+func AuthorizeAdmin(ctx context.Context, tenant *Tenant, token string, write bool) (context.Context, error) {
+	settings := optionsFor(ctx).settings()
+	releaseManagers, viewers := settings.AdminTokens, settings.ViewerTokens
+	sso := true
+	if tenant != nil {
+		if tokens := settings.TenantAdminTokens[tenant.Name]; tokens != nil {
+			releaseManagers, sso = tokens, false
+		}
+	}
+	if releaseManagers == nil {
+		releaseManagers = middleware.TokenList
+	}
+
+	var role, actor string
+	oidc := optionsFor(ctx).oidc()
+	switch {
+	case isAdminTokenValid(releaseManagers, token):
+		role = RoleReleaseManager
+	case isAdminTokenValid(viewers, token):
+		role = RoleViewer
+	case sso && oidc != nil && looksLikeJWT(token):
+		claims, err := oidc.Verify(ctx, token)
+		if err != nil {
+			lg.Log(ctx).Warnf("Rejected SSO token: %v", err)
+			return ctx, &AdminError{Status: http.StatusUnauthorized, Message: http.StatusText(http.StatusUnauthorized)}
+		}
+		role = oidc.Role(claims.Groups)
+		actor = "oidc:" + claims.Subject
+		if len(claims.Email) != 0 {
+			actor = "oidc:" + claims.Email
+		}
+	}
+	if len(role) == 0 {
+		return ctx, &AdminError{Status: http.StatusForbidden, Message: http.StatusText(http.StatusForbidden)}
+	}
+	if write && role != RoleReleaseManager {
+		return ctx, &AdminError{Status: http.StatusForbidden, Message: "The viewer role can only read"}
+	}
+	if len(actor) == 0 {
+		// A fingerprint of the token identifies its holder without keeping the token
+		sum := sha256.Sum256([]byte(token))
+		actor = "token:" + hex.EncodeToString(sum[:4])
+	}
+	ctx = context.WithValue(ctx, roleKey{}, role)
+	ctx = context.WithValue(ctx, actorKey{}, actor)
+	if tenant != nil {
+		ctx = context.WithValue(ctx, tenantContextKey{}, tenant)
+	}
+	return ctx, nil
+}
+
+// roleAllows returns true if role can make requests with method
+func roleAllows(role string, method string) bool {
+	if role == RoleReleaseManager {
+		return true
+	}
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// contextRole returns the role an admin request or call was authorized with, or an empty string outside the admin API
+func contextRole(ctx context.Context) string {
+	role, _ := ctx.Value(roleKey{}).(string)
+	return role
+}
+
+func bearerToken(r *http.Request) string {
+	authorization := r.Header.Get("Authorization")
+	if len(authorization) > 7 && strings.EqualFold(authorization[:7], "bearer ") {
+		return authorization[7:]
+	}
+	return ""
+}
+
+func isAdminTokenValid(tokens []string, token string) bool {
+	if len(token) == 0 {
+		return false
+	}
+	for _, valid := range tokens {
+		if subtle.ConstantTimeCompare([]byte(valid), []byte(token)) == 1 {
+			return true
+		}
+	}
+	return false
+}
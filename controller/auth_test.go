@@ -0,0 +1,46 @@
+package controller_test
+
+import (
+	"context"
+	"github.com/brave/go-update/controller"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestViewerRole(t *testing.T) {
+	handlerOptions.UpdateSettings(func(settings *controller.Settings) {
+		settings.ViewerTokens = []string{"viewer-token"}
+	})
+	defer handlerOptions.UpdateSettings(func(settings *controller.Settings) {
+		settings.ViewerTokens = nil
+	})
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	admin := func(method string, path string, token string) int {
+		req, err := http.NewRequest(method, server.URL+path, nil)
+		assert.Nil(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		return resp.StatusCode
+	}
+
+	// Viewers can read everything but change nothing
+	assert.Equal(t, http.StatusOK, admin(http.MethodGet, "/api/admin/catalog", "viewer-token"))
+	assert.Equal(t, http.StatusOK, admin(http.MethodGet, "/api/v1/stats/extensions", "viewer-token"))
+	assert.Equal(t, http.StatusOK, admin(http.MethodGet, "/api/admin/maintenance", "viewer-token"))
+	assert.Equal(t, http.StatusForbidden, admin(http.MethodPut, "/api/admin/maintenance", "viewer-token"))
+	assert.Equal(t, http.StatusForbidden, admin(http.MethodPut, "/api/admin/policy/forcelist/aomjjhallfgjeglblehebfpbcfeobpgk", "viewer-token"))
+	assert.Equal(t, http.StatusForbidden, admin(http.MethodPut, "/api/admin/extensions/aomjjhallfgjeglblehebfpbcfeobpgk/versions/1.0.0", "viewer-token"))
+	assert.Equal(t, http.StatusForbidden, admin(http.MethodGet, "/api/admin/catalog", "other-token"))
+
+	// Release managers can still change the catalog, which is recorded with their role
+	assert.Equal(t, http.StatusOK, admin(http.MethodPut, "/api/admin/maintenance", "test-token"))
+	assert.Equal(t, http.StatusOK, admin(http.MethodDelete, "/api/admin/maintenance", "test-token"))
+	records, err := handlerOptions.Audit.Query(context.Background(), controller.AuditFilter{Target: "maintenance"})
+	assert.Nil(t, err)
+	assert.Equal(t, controller.RoleReleaseManager, records[len(records)-1].Role)
+}
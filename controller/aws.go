@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/prometheus/client_golang/prometheus"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultAWSRegion is the region of the tables and buckets which aren't given one
+const DefaultAWSRegion = "us-east-2"
+
+// S3Credentials are used for the buckets instead of the config's credentials when set,
+// so payloads can be read and published with keys kept in a secret
+var S3Credentials aws.CredentialsProvider
+
+var awsConfigs = map[string]aws.Config{}
+var awsConfigsMutex sync.Mutex
+
+var awsRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name: "aws_request_duration_seconds",
+	Help: "Duration of AWS API calls including retries made by the SDK.",
+}, []string{"service", "operation", "region", "status"})
+
+func init() {
+	prometheus.MustRegister(awsRequestDuration)
+}
+
+// newAWSConfig returns the config for the AWSRegion of the options serving ctx.
+// Configs are shared so credentials are resolved and cached once rather than for every call.
+func newAWSConfig(ctx context.Context) (aws.Config, error) {
+	return AWSConfig(ctx, optionsFor(ctx).awsRegion())
+}
+
+// regionOrDefault returns region, or DefaultAWSRegion if it is empty
+func regionOrDefault(region string) string {
+	if len(region) == 0 {
+		return DefaultAWSRegion
+	}
+	return region
+}
+
+// AWSConfig returns the shared config for region, loading it the first time it is needed.
+// Its credentials come from the default chain like the AWS CLI's: the environment, profiles from ~/.aws
+// including SSO and role assumption, web identity tokens like those of IAM roles for service accounts,
+// and the container or instance role.
+func AWSConfig(ctx context.Context, region string) (aws.Config, error) {
+	awsConfigsMutex.Lock()
+	defer awsConfigsMutex.Unlock()
+	if cfg, ok := awsConfigs[region]; ok {
+		return cfg, nil
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return aws.Config{}, err
+	}
+	cfg.APIOptions = append(cfg.APIOptions, addRequestMetrics)
+	awsConfigs[region] = cfg
+	return cfg, nil
+}
+
+// newS3Client returns an S3 client for cfg which uses S3Credentials if they are set
+func newS3Client(cfg aws.Config) *s3.Client {
+	return s3.NewFromConfig(cfg, func(options *s3.Options) {
+		if S3Credentials != nil {
+			options.Credentials = S3Credentials
+		}
+	})
+}
+
+// addRequestMetrics records the duration of the API calls of a client. It runs after the operation is named
+// in the initialize step, and so around the retries made by the SDK.
+func addRequestMetrics(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("RequestMetrics", func(
+		ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler,
+	) (middleware.InitializeOutput, middleware.Metadata, error) {
+		start := time.Now()
+		out, metadata, err := next.HandleInitialize(ctx, in)
+		// Calls which got no response have a status of 0
+		status := "error"
+		if response, ok := awsmiddleware.GetRawResponse(metadata).(*smithyhttp.Response); ok && response.Response != nil && response.StatusCode != 0 {
+			status = strconv.Itoa(response.StatusCode)
+		}
+		recordAWSRequest(awsmiddleware.GetServiceID(ctx), awsmiddleware.GetOperationName(ctx), awsmiddleware.GetRegion(ctx), status, time.Since(start))
+		return out, metadata, err
+	}), middleware.After)
+}
+
+// recordAWSRequest records the duration of a finished AWS API call
+func recordAWSRequest(service, operation, region, status string, duration time.Duration) {
+	awsRequestDuration.WithLabelValues(service, operation, region, status).Observe(duration.Seconds())
+}
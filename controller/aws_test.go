@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAWSConfig(t *testing.T) {
+	// Restored afterwards rather than unset, since the other tests of the package need credentials too
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+
+	cfg, err := AWSConfig(context.Background(), "eu-west-3")
+	assert.Nil(t, err)
+	assert.Equal(t, "eu-west-3", cfg.Region)
+	credentials, err := cfg.Credentials.Retrieve(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "test", credentials.AccessKeyID)
+
+	// Configs are loaded once per region, so their clients share cached credentials
+	same, err := AWSConfig(context.Background(), "eu-west-3")
+	assert.Nil(t, err)
+	assert.True(t, cfg.Credentials == same.Credentials)
+	other, err := AWSConfig(context.Background(), "eu-north-1")
+	assert.Nil(t, err)
+	assert.Equal(t, "eu-north-1", other.Region)
+	assert.False(t, cfg.Credentials == other.Credentials)
+}
+
+func TestRecordAWSRequest(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+
+	failing := false
+	dynamoDB := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		if failing {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"__type":"com.amazonaws.dynamodb.v20120810#InternalServerError","message":"down"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"Count":0,"Items":[],"ScannedCount":0}`))
+	}))
+	defer dynamoDB.Close()
+	store := DynamoDBStore{Region: "ap-southeast-4", Endpoint: dynamoDB.URL}
+
+	ok := awsRequestDuration.WithLabelValues("DynamoDB", "Scan", "ap-southeast-4", "200")
+	failed := awsRequestDuration.WithLabelValues("DynamoDB", "Scan", "ap-southeast-4", "500")
+	before := sampleCount(ok)
+	_, err := store.LoadExtensions(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, before+1, sampleCount(ok))
+
+	failing = true
+	before = sampleCount(failed)
+	_, err = store.LoadExtensions(context.Background())
+	assert.NotNil(t, err)
+	assert.Equal(t, before+1, sampleCount(failed))
+
+	// Calls which get no response are recorded as errors
+	dynamoDB.Close()
+	errored := awsRequestDuration.WithLabelValues("DynamoDB", "Scan", "ap-southeast-4", "error")
+	before = sampleCount(errored)
+	_, err = store.LoadExtensions(context.Background())
+	assert.NotNil(t, err)
+	assert.Equal(t, before+1, sampleCount(errored))
+}
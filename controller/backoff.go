@@ -0,0 +1,40 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxRetryAfter caps the X-Retry-After hint, since Chromium ignores longer ones
+const maxRetryAfter = 24 * time.Hour
+
+// retryHint is how long a client should wait before checking again for the updates a response held back,
+// like those outside their serving window or over their budget. It is the shortest wait of the held back updates,
+// so none is delayed for longer than it has to be. The zero value means no update was held back.
+type retryHint time.Duration
+
+// add notes an update held back for wait
+func (hint *retryHint) add(wait time.Duration) {
+	if wait <= 0 {
+		return
+	}
+	if *hint == 0 || wait < time.Duration(*hint) {
+		*hint = retryHint(wait)
+	}
+}
+
+// setRetryAfter tells the client when to check again with X-Retry-After, which the component updater in Chromium
+// honors on successful responses too, if hint held back an update. Retry-After is left to the 503 responses
+// of maintenance and shedding, since these responses do answer the check.
+func setRetryAfter(w http.ResponseWriter, hint retryHint) {
+	if hint == 0 {
+		return
+	}
+	wait := time.Duration(hint)
+	if wait > maxRetryAfter {
+		wait = maxRetryAfter
+	}
+	seconds := int((wait + time.Second - 1) / time.Second)
+	w.Header().Set("X-Retry-After", strconv.Itoa(seconds))
+}
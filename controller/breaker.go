@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"context"
+	"github.com/brave/go-update/extension"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sony/gobreaker"
+	"log"
+	"time"
+)
+
+// BreakerSettings controls when a BreakerStore stops calling its store
+type BreakerSettings struct {
+	// ConsecutiveFailures is how many failures in a row open the breaker
+	ConsecutiveFailures uint32
+	// Timeout is how long the breaker stays open before letting a probe request through
+	Timeout time.Duration
+}
+
+// DefaultBreakerSettings are the settings used for DynamoDB unless configured otherwise
+var DefaultBreakerSettings = BreakerSettings{
+	ConsecutiveFailures: 5,
+	Timeout:             time.Minute,
+}
+
+var storeBreakerState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "store_circuit_breaker_state",
+	Help: "State of the store circuit breaker, 0 for closed, 1 for half open and 2 for open.",
+}, []string{"name"})
+
+func init() {
+	prometheus.MustRegister(storeBreakerState)
+}
+
+// BreakerStore wraps a store in a circuit breaker, so sustained failures stop hammering it.
+// While the breaker is open the refresh fails fast and the last good catalog keeps being served.
+type BreakerStore struct {
+	store   Store
+	breaker *gobreaker.CircuitBreaker
+}
+
+// NewBreakerStore creates a BreakerStore named name around store
+func NewBreakerStore(name string, store Store, settings BreakerSettings) *BreakerStore {
+	storeBreakerState.WithLabelValues(name).Set(float64(gobreaker.StateClosed))
+	return &BreakerStore{
+		store: store,
+		breaker: gobreaker.NewCircuitBreaker(gobreaker.Settings{
+			Name: name,
+			// Recovery is probed one request at a time
+			MaxRequests: 1,
+			Timeout:     settings.Timeout,
+			ReadyToTrip: func(counts gobreaker.Counts) bool {
+				return counts.ConsecutiveFailures >= settings.ConsecutiveFailures
+			},
+			OnStateChange: func(name string, from gobreaker.State, to gobreaker.State) {
+				log.Printf("store circuit breaker %s changed from %s to %s\n", name, from, to)
+				storeBreakerState.WithLabelValues(name).Set(float64(to))
+			},
+		}),
+	}
+}
+
+// LoadExtensions loads the catalog unless the breaker is open
+func (store *BreakerStore) LoadExtensions(ctx context.Context) (extension.Extensions, error) {
+	extensions, err := store.breaker.Execute(func() (interface{}, error) {
+		return store.store.LoadExtensions(ctx)
+	})
+	if err != nil {
+		return nil, breakerError(err)
+	}
+	return extensions.(extension.Extensions), nil
+}
+
+// SaveExtension saves the extension unless the breaker is open
+func (store *BreakerStore) SaveExtension(ctx context.Context, ext extension.Extension) error {
+	_, err := store.breaker.Execute(func() (interface{}, error) {
+		return nil, store.store.SaveExtension(ctx, ext)
+	})
+	return breakerError(err)
+}
+
+// DeleteExtension deletes the extension unless the breaker is open
+func (store *BreakerStore) DeleteExtension(ctx context.Context, id string) error {
+	_, err := store.breaker.Execute(func() (interface{}, error) {
+		return nil, store.store.DeleteExtension(ctx, id)
+	})
+	return breakerError(err)
+}
+
+// breakerError returns ErrStoreUnavailable for the errors of the breaker, and errors of the store as they are
+func breakerError(err error) error {
+	if err == gobreaker.ErrOpenState || err == gobreaker.ErrTooManyRequests {
+		return ErrStoreUnavailable
+	}
+	return err
+}
+
+// isBreakerOpen returns true if err means the store wasn't called because its breaker is open
+func isBreakerOpen(err error) bool {
+	return err == ErrStoreUnavailable
+}
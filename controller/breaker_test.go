@@ -0,0 +1,57 @@
+package controller_test
+
+import (
+	"context"
+	"errors"
+	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/extension"
+	"github.com/stretchr/testify/assert"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// failingStore counts calls and always fails. The count is atomic since a ShadowStore calls it from its own goroutines.
+type failingStore struct {
+	calls *int64
+}
+
+func (store failingStore) LoadExtensions(context.Context) (extension.Extensions, error) {
+	atomic.AddInt64(store.calls, 1)
+	return nil, errors.New("throttled")
+}
+
+func (store failingStore) SaveExtension(context.Context, extension.Extension) error {
+	atomic.AddInt64(store.calls, 1)
+	return errors.New("throttled")
+}
+
+func (store failingStore) DeleteExtension(context.Context, string) error {
+	atomic.AddInt64(store.calls, 1)
+	return errors.New("throttled")
+}
+
+func TestBreakerStore(t *testing.T) {
+	var calls int64
+	store := controller.NewBreakerStore("test", failingStore{&calls}, controller.BreakerSettings{
+		ConsecutiveFailures: 3,
+		Timeout:             50 * time.Millisecond,
+	})
+	for i := 0; i < 5; i++ {
+		_, err := store.LoadExtensions(context.Background())
+		assert.NotNil(t, err)
+	}
+	// The breaker opened after 3 failures, so the store wasn't called again
+	assert.Equal(t, int64(3), atomic.LoadInt64(&calls))
+	assert.Equal(t, controller.ErrStoreUnavailable, store.SaveExtension(context.Background(), newExtension1))
+	assert.Equal(t, int64(3), atomic.LoadInt64(&calls))
+
+	// After the timeout a single probe is let through
+	time.Sleep(60 * time.Millisecond)
+	_, err := store.LoadExtensions(context.Background())
+	assert.NotNil(t, err)
+	assert.Equal(t, int64(4), atomic.LoadInt64(&calls))
+	_, err = store.LoadExtensions(context.Background())
+	assert.NotNil(t, err)
+	assert.Equal(t, int64(4), atomic.LoadInt64(&calls))
+}
@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"github.com/brave/go-update/extension"
+	"github.com/prometheus/client_golang/prometheus"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var updateBudgetExceeded = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "update_budget_exceeded_total",
+	Help: "Number of updates not offered because the extension's budget of updates per minute was used up.",
+}, []string{"extension"})
+
+func init() {
+	prometheus.MustRegister(updateBudgetExceeded)
+}
+
+// tokenBucket holds the updates an extension may still offer. It refills at perMinute, up to perMinute.
+type tokenBucket struct {
+	perMinute int
+	tokens    float64
+	updated   time.Time
+}
+
+// updateBudgets are the token buckets of the extensions with a budget in the settings of one Options
+type updateBudgets struct {
+	mutex   sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// updateBudgetLeft returns true if the extension with id has an update of its budget in the settings of opts left
+// at now, or doesn't have a budget, and uses it up if take is true. Otherwise it returns how long it is until the next
+// update can be offered. Taking an update which isn't left still uses it up, since it was offered when there was one.
+func (opts *Options) updateBudgetLeft(id string, now time.Time, take bool) (bool, time.Duration) {
+	perMinute := opts.settings().UpdateBudgets[id]
+	if perMinute <= 0 {
+		return true, 0
+	}
+	budgets := &opts.budgets
+	budgets.mutex.Lock()
+	defer budgets.mutex.Unlock()
+	bucket, ok := budgets.buckets[id]
+	if !ok || bucket.perMinute != perMinute {
+		bucket = &tokenBucket{perMinute: perMinute, tokens: float64(perMinute), updated: now}
+		if budgets.buckets == nil {
+			budgets.buckets = map[string]*tokenBucket{}
+		}
+		budgets.buckets[id] = bucket
+	}
+	if elapsed := now.Sub(bucket.updated); elapsed > 0 {
+		bucket.tokens += elapsed.Minutes() * float64(perMinute)
+		if bucket.tokens > float64(perMinute) {
+			bucket.tokens = float64(perMinute)
+		}
+		bucket.updated = now
+	}
+	if take {
+		bucket.tokens--
+		return true, 0
+	}
+	if bucket.tokens < 1 {
+		updateBudgetExceeded.WithLabelValues(id).Inc()
+		return false, time.Duration((1 - bucket.tokens) / float64(perMinute) * float64(time.Minute))
+	}
+	return true, 0
+}
+
+// withinUpdateBudget returns true if an update of the extension with id may be offered in the response to r,
+// or how long it is until one can be. It doesn't use up the budget, see chargeUpdateBudgets.
+func withinUpdateBudget(r *http.Request, id string, now time.Time) (bool, time.Duration) {
+	if !chargesUpdateBudget(r) {
+		return true, 0
+	}
+	return optionsFor(r.Context()).updateBudgetLeft(id, now, false)
+}
+
+// chargeUpdateBudgets uses up an update of the budgets of updates, which are offered in the response to r
+func chargeUpdateBudgets(r *http.Request, updates []extension.Extension, now time.Time) {
+	if !chargesUpdateBudget(r) {
+		return
+	}
+	opts := optionsFor(r.Context())
+	for _, ext := range updates {
+		opts.updateBudgetLeft(ext.ID, now, true)
+	}
+}
+
+// chargesUpdateBudget returns true if the updates offered to r use up the budget. Only GET and POST update checks
+// do, not HEAD requests or canary checks.
+func chargesUpdateBudget(r *http.Request) bool {
+	return !isCanaryRequest(r) && (r.Method == http.MethodGet || r.Method == http.MethodPost)
+}
+
+// budgetExceeded returns the noupdate answer for the extension with id, which is over its budget,
+// acknowledging its ping if updateRequest had one
+func budgetExceeded(updateRequest extension.UpdateRequest, id string) extension.Extension {
+	answer := extension.Extension{ID: id, UpdateDisabled: true}
+	for _, requested := range updateRequest {
+		if requested.ID == id {
+			answer.Ping = requested.Ping
+		}
+	}
+	return answer
+}
@@ -0,0 +1,84 @@
+package controller_test
+
+import (
+	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/extension"
+	"github.com/brave/go-update/extension/extensiontest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUpdateBudgets(t *testing.T) {
+	id := "ldimlcelhnjgpjjemdjokpgeeikdinbm"
+	handlerOptions.UpdateSettings(func(settings *controller.Settings) {
+		settings.UpdateBudgets = map[string]int{id: 2}
+	})
+	defer handlerOptions.UpdateSettings(func(settings *controller.Settings) {
+		settings.UpdateBudgets = map[string]int{}
+	})
+	check := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/extensions", strings.NewReader(extensiontest.ExtensionRequestFnFor(id)("0.0.0")))
+		req.Header.Set("Content-Type", "application/xml")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		return rr
+	}
+	webStoreCheck := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/extensions?"+getQueryParams(&extension.Extension{ID: id, Version: "0.0.0"}), nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		return rr
+	}
+
+	// HEAD requests and responses the client has cached don't use up the budget. The server answers HEAD requests
+	// with the GET handler.
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	webStore := &controller.WebStoreHandler{Catalog: controller.ServerCatalogs(handlerOptions), Settings: controller.ServerSettings(handlerOptions), Logger: logger}
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodHead, "/extensions?"+getQueryParams(&extension.Extension{ID: id, Version: "0.0.0"}), nil)
+		rr := httptest.NewRecorder()
+		webStore.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		etag := rr.Header().Get("ETag")
+		req = httptest.NewRequest(http.MethodGet, "/extensions?"+getQueryParams(&extension.Extension{ID: id, Version: "0.0.0"}), nil)
+		req.Header.Set("If-None-Match", etag)
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusNotModified, rr.Code)
+	}
+
+	// The budget is shared by both kinds of checks, and the ones over it are answered with noupdate
+	// and told to check again when the next update can be offered
+	rr := check()
+	assert.Contains(t, rr.Body.String(), `<updatecheck status="ok">`)
+	assert.Equal(t, "", rr.Header().Get("X-Retry-After"))
+	assert.Contains(t, webStoreCheck().Body.String(), `<updatecheck status="ok"`)
+	rr = check()
+	assert.Contains(t, rr.Body.String(), `<updatecheck status="noupdate">`)
+	assert.Equal(t, "30", rr.Header().Get("X-Retry-After"))
+	rr = webStoreCheck()
+	assert.NotContains(t, rr.Body.String(), "updatecheck")
+	assert.Equal(t, "30", rr.Header().Get("X-Retry-After"))
+
+	// It refills over the minute
+	testClock.Advance(30 * time.Second)
+	assert.Contains(t, check().Body.String(), `<updatecheck status="ok">`)
+	assert.Contains(t, check().Body.String(), `<updatecheck status="noupdate">`)
+
+	// Other extensions aren't limited
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/extensions?"+getQueryParams(&extension.Extension{ID: "bfdgpgibhagkpdlnjonhkabjoijopoge", Version: "0.0.0"}), nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Contains(t, rr.Body.String(), `<updatecheck status="ok"`)
+	}
+}
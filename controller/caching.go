@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/brave/go-update/extension"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// snapshotCatalogService is implemented by CatalogServices which serve snapshots of their catalogs, so responses
+// can tell which generation of the catalog answered them
+type snapshotCatalogService interface {
+	Snapshot(r *http.Request) *CatalogSnapshot
+}
+
+// catalogSnapshot returns the catalog serving r and its generation, which is 0 when catalogs doesn't serve snapshots
+func catalogSnapshot(catalogs CatalogService, r *http.Request) (map[string]extension.Extension, uint64) {
+	if snapshots, ok := catalogs.(snapshotCatalogService); ok {
+		snapshot := snapshots.Snapshot(r)
+		return snapshot.Map(), snapshot.Generation()
+	}
+	return catalogs.Catalog(r), 0
+}
+
+// webStoreETag returns the entity tag of the response to a GET update check offering updates, from the generation
+// of the catalog it was answered from and a hash of what is offered. It is weak since the time of day in protocol 2
+// responses changes while the offered updates stay the same.
+func webStoreETag(r *http.Request, generation uint64, updates extension.WebStoreUpdateResponse) string {
+	hash := fnv.New64a()
+	fmt.Fprintf(hash, "%t %t %s\n", wantsJSON(r), isProtocol2Request(r.URL.Query()), extension.CodebaseURLTemplate)
+	for _, update := range updates {
+		fmt.Fprintf(hash, "%s %s %s %d %s %s\n", update.ID, update.Version, update.SHA256, update.Size, update.URL, strings.Join(update.URLs, " "))
+	}
+	return fmt.Sprintf(`W/"%d-%x"`, generation, hash.Sum64())
+}
+
+// etagMatches returns true if the If-None-Match header of r lists etag, comparing weakly
+func etagMatches(r *http.Request, etag string) bool {
+	for _, tag := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// setWebStoreCacheHeaders sets the headers letting caches keep the response to the GET update check r with etag
+func setWebStoreCacheHeaders(w http.ResponseWriter, r *http.Request, etag string) {
+	settings := optionsFor(r.Context()).settings()
+	var countryHeader string
+	if len(settings.CDNURLPrefixes) != 0 {
+		countryHeader = settings.CountryHeader
+	}
+	w.Header().Set("ETag", etag)
+	if maxAge := settings.WebStoreCacheMaxAge; maxAge > 0 {
+		w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(maxAge.Seconds())))
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	w.Header().Add("Vary", "Accept")
+	// Download URLs depend on the client's country when mirrors are picked by country
+	if len(countryHeader) != 0 {
+		w.Header().Add("Vary", countryHeader)
+	}
+}
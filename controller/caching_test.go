@@ -0,0 +1,90 @@
+package controller_test
+
+import (
+	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/extension"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebStoreETag(t *testing.T) {
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	defer handlerOptions.UpdateSettings(func(settings *controller.Settings) {
+		settings.WebStoreCacheMaxAge = 0
+	})
+
+	get := func(query string, header http.Header) (*http.Response, string) {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/extensions?"+query, nil)
+		assert.Nil(t, err)
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		return resp, string(body)
+	}
+	outdated := extension.Extension{ID: "ldimlcelhnjgpjjemdjokpgeeikdinbm", Version: "0.0.0"}
+	query := getQueryParams(&outdated)
+
+	resp, body := get(query, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	etag := resp.Header.Get("ETag")
+	assert.True(t, strings.HasPrefix(etag, `W/"`), etag)
+	assert.Equal(t, "no-cache", resp.Header.Get("Cache-Control"))
+	assert.Contains(t, body, "ldimlcelhnjgpjjemdjokpgeeikdinbm")
+
+	// A matching If-None-Match is answered without a body, and the update the client already has isn't counted again
+	served := func() int64 {
+		for _, stats := range handlerOptions.GetExtensionStatsSnapshot() {
+			if stats.ID == outdated.ID && stats.Version == "1.0.0" {
+				return stats.UpdatesServed
+			}
+		}
+		return 0
+	}
+	before := served()
+	resp, body = get(query, http.Header{"If-None-Match": {`"other", ` + etag}})
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+	assert.Equal(t, etag, resp.Header.Get("ETag"))
+	assert.Equal(t, "", body)
+	assert.Equal(t, before, served())
+	resp, _ = get(query, http.Header{"If-None-Match": {`"other"`}})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Other updates, representations and catalog generations have other tags
+	upToDate := extension.Extension{ID: "ldimlcelhnjgpjjemdjokpgeeikdinbm", Version: "1.0.0"}
+	resp, _ = get(getQueryParams(&upToDate), nil)
+	assert.NotEqual(t, etag, resp.Header.Get("ETag"))
+	resp, _ = get(query, http.Header{"Accept": {"application/json"}})
+	assert.NotEqual(t, etag, resp.Header.Get("ETag"))
+	handlerOptions.UpdateCatalog(func(map[string]extension.Extension) {})
+	resp, _ = get(query, http.Header{"If-None-Match": {etag}})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotEqual(t, etag, resp.Header.Get("ETag"))
+
+	handlerOptions.UpdateSettings(func(settings *controller.Settings) {
+		settings.WebStoreCacheMaxAge = time.Minute
+	})
+	resp, _ = get(query, nil)
+	assert.Equal(t, "public, max-age=60", resp.Header.Get("Cache-Control"))
+
+	// Redirects aren't cached
+	unknown := extension.Extension{ID: "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Version: "0.0.0"}
+	client := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(server.URL + "/extensions?" + getQueryParams(&unknown))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+	assert.Equal(t, "", resp.Header.Get("ETag"))
+	assert.Equal(t, "", resp.Header.Get("Cache-Control"))
+}
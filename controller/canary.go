@@ -0,0 +1,171 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/brave/go-update/client"
+	"github.com/brave/go-update/extension"
+	"github.com/getsentry/raven-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"time"
+)
+
+// CanaryResult is the outcome of the last canary update check of an extension
+type CanaryResult struct {
+	ID        string    `json:"id"`
+	Tenant    string    `json:"tenant,omitempty"`
+	Version   string    `json:"version"`
+	Passed    bool      `json:"passed"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// canaryResults are the last results of the canary of some Options by tenant and ID
+type canaryResults struct {
+	mutex   sync.Mutex
+	results map[string]CanaryResult
+}
+
+var canaryChecks = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "canary_checks_total",
+	Help: "Number of canary update checks, by extension and whether they passed.",
+}, []string{"id", "result"})
+
+var canaryFailingGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "canary_failing_extensions",
+	Help: "Number of extensions whose last canary update check failed.",
+})
+
+func init() {
+	prometheus.MustRegister(canaryChecks, canaryFailingGauge)
+}
+
+type canaryContextKey struct{}
+
+// isCanaryRequest returns true for update checks made by the canary, which aren't counted as clients being served
+func isCanaryRequest(r *http.Request) bool {
+	canary, _ := r.Context().Value(canaryContextKey{}).(bool)
+	return canary
+}
+
+// StartCanary checks now and every interval that each extension in the catalogs of opts can be updated through handler,
+// which serves them, the way a browser would: an Omaha update check is sent for it, and the advertised package is downloaded and verified.
+// Results are exported as the canary_checks_total and canary_failing_extensions metrics and on /api/admin/health/canary.
+func StartCanary(handler http.Handler, opts *Options, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		for {
+			raven.CapturePanic(func() {
+				runCanary(handler, opts)
+			}, map[string]string{"task": "canary"})
+			<-ticker.C
+		}
+	}()
+}
+
+// runCanary checks every extension which should currently be offered to clients,
+// replacing the results of the last run so extensions which were removed are forgotten
+func runCanary(handler http.Handler, opts *Options) {
+	now := time.Now()
+	catalogs := map[string]map[string]extension.Extension{"": opts.CurrentCatalog().Map()}
+	for name, tenant := range opts.tenants() {
+		catalogs[name] = tenant.catalog()
+	}
+	results := map[string]CanaryResult{}
+	failing := 0
+	for tenant, catalog := range catalogs {
+		for _, ext := range catalog {
+			if ext.Blacklisted || len(ext.SHA256) == 0 || opts.isOutsideServingWindow(ext.ID, now) {
+				continue
+			}
+			err := canaryCheck(handler, tenant, ext)
+			result := CanaryResult{ID: ext.ID, Tenant: tenant, Version: ext.Version, Passed: err == nil, CheckedAt: time.Now()}
+			if err != nil {
+				log.Printf("canary update check failed for %s %s: %v\n", ext.ID, ext.Version, err)
+				result.Error = err.Error()
+				failing++
+				canaryChecks.WithLabelValues(ext.ID, "fail").Inc()
+			} else {
+				canaryChecks.WithLabelValues(ext.ID, "pass").Inc()
+			}
+			results[tenant+"/"+ext.ID] = result
+		}
+	}
+	canaryFailingGauge.Set(float64(failing))
+	if opts == nil {
+		return
+	}
+	opts.canary.mutex.Lock()
+	defer opts.canary.mutex.Unlock()
+	opts.canary.results = results
+}
+
+// canaryCheck sends an update check for ext from version 0.0.0.0 to the catalog of tenant and verifies the update offered
+func canaryCheck(handler http.Handler, tenant string, ext extension.Extension) error {
+	request := client.Request{
+		Apps:        []client.App{{ID: ext.ID, Version: "0.0.0.0"}},
+		ProdVersion: "0.0.0.0",
+		Channel:     "stable",
+		OS:          "linux",
+		Arch:        "x64",
+	}
+	body, contentType, err := client.Encode(request, client.XML)
+	if err != nil {
+		return err
+	}
+	path := "/extensions"
+	if len(tenant) != 0 {
+		path = "/t/" + tenant + "/extensions"
+	}
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req.WithContext(context.WithValue(ctx, canaryContextKey{}, true)))
+	if recorder.Code != http.StatusOK {
+		return fmt.Errorf("update check answered %d", recorder.Code)
+	}
+
+	updates, err := client.Parse(recorder.Body.Bytes(), client.XML)
+	if err != nil {
+		return err
+	}
+	if len(updates) != 1 || updates[0].ID != ext.ID {
+		return errors.New("update response is not for the extension checked")
+	}
+	update := updates[0]
+	if !update.Available() {
+		return fmt.Errorf("no update was offered, updatecheck status %q", update.Status)
+	}
+	if update.Version != ext.Version || update.SHA256 != ext.SHA256 {
+		return fmt.Errorf("version %s with SHA256 %s was offered rather than the catalog's", update.Version, update.SHA256)
+	}
+	return verifyDownload(ctx, update.URLs[0], ext)
+}
+
+// CanaryReport is the admin handler for listing the last canary result of every extension
+func CanaryReport(w http.ResponseWriter, r *http.Request) {
+	report := []CanaryResult{}
+	if opts := optionsFor(r.Context()); opts != nil {
+		opts.canary.mutex.Lock()
+		for _, result := range opts.canary.results {
+			report = append(report, result)
+		}
+		opts.canary.mutex.Unlock()
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Tenant != report[j].Tenant {
+			return report[i].Tenant < report[j].Tenant
+		}
+		return report[i].ID < report[j].ID
+	})
+	writeList(w, r, "results", report)
+}
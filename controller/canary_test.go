@@ -0,0 +1,77 @@
+package controller_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/crx"
+	"github.com/brave/go-update/crx/crxtest"
+	"github.com/brave/go-update/extension"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCanary(t *testing.T) {
+	key := crxtest.NewKey()
+	id := crx.IDFromPublicKey(crxtest.PublicKey(key))
+	payload := crxtest.BuildSignedCRX(key, []byte("PK archive"))
+	sum := sha256.Sum256(payload)
+	packages := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/"+id+"/1.0.0" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(payload)
+	}))
+	defer packages.Close()
+	extension.CodebaseURLTemplate = packages.URL + "/{id}/{version}"
+	defer func() {
+		extension.CodebaseURLTemplate = extension.DefaultCodebaseURLTemplate
+	}()
+	handlerOptions.UpdateCatalog(func(catalog map[string]extension.Extension) {
+		catalog[id] = extension.Extension{ID: id, Version: "1.0.0", SHA256: hex.EncodeToString(sum[:]), Size: int64(len(payload))}
+	})
+	defer handlerOptions.UpdateCatalog(func(catalog map[string]extension.Extension) {
+		delete(catalog, id)
+	})
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	report := func() map[string]controller.CanaryResult {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/api/admin/health/canary", nil)
+		assert.Nil(t, err)
+		req.Header.Set("Authorization", "Bearer test-token")
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		results := []controller.CanaryResult{}
+		assert.Nil(t, json.NewDecoder(resp.Body).Decode(&results))
+		byID := map[string]controller.CanaryResult{}
+		for _, result := range results {
+			if len(result.Tenant) == 0 {
+				byID[result.ID] = result
+			}
+		}
+		return byID
+	}
+
+	controller.StartCanary(handler, handlerOptions, time.Hour)
+	deadline := time.Now().Add(10 * time.Second)
+	results := report()
+	for len(results) == 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+		results = report()
+	}
+
+	// The package offered for the extension is downloaded and verified
+	assert.True(t, results[id].Passed, results[id].Error)
+	assert.Equal(t, "1.0.0", results[id].Version)
+	// Packages which can't be downloaded fail
+	failed := results["ldimlcelhnjgpjjemdjokpgeeikdinbm"]
+	assert.False(t, failed.Passed)
+	assert.Contains(t, failed.Error, "404")
+}
@@ -0,0 +1,37 @@
+package controller
+
+import (
+	"github.com/brave/go-update/extension"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// CountryLookup returns the country code of the client making r, from the CountryHeader of the settings serving it.
+// It can be replaced to use something like a MaxMind database instead of a header.
+var CountryLookup = func(r *http.Request) string {
+	header := optionsFor(r.Context()).settings().CountryHeader
+	if len(header) == 0 {
+		return ""
+	}
+	return r.Header.Get(header)
+}
+
+// selectMirrors points the codebase of each extension for client at the mirror for the client's region, if there is one.
+func selectMirrors(r *http.Request, extensions []extension.Extension, client extension.Client) {
+	prefixes := optionsFor(r.Context()).settings().CDNURLPrefixes
+	if len(prefixes) == 0 {
+		return
+	}
+	prefix, ok := prefixes[strings.ToUpper(CountryLookup(r))]
+	if !ok {
+		return
+	}
+	for i := range extensions {
+		codebase, err := url.Parse(extension.GetCodebaseURL(extensions[i], client))
+		if err != nil {
+			continue
+		}
+		extensions[i].URL = prefix + codebase.EscapedPath()
+	}
+}
@@ -0,0 +1,94 @@
+package controller_test
+
+import (
+	"bytes"
+	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/extension"
+	"github.com/brave/go-update/extension/extensiontest"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestClientCodebaseURLs(t *testing.T) {
+	defer func() {
+		extension.CodebaseURLTemplate = extension.DefaultCodebaseURLTemplate
+		handlerOptions.UpdateSettings(func(settings *controller.Settings) {
+			settings.CDNURLPrefixes = map[string]string{}
+			settings.CountryHeader = ""
+		})
+	}()
+	extension.CodebaseURLTemplate = "https://cdn.example.com/{channel}/{platform}/{id}/{version}.crx"
+	id := "ldimlcelhnjgpjjemdjokpgeeikdinbm"
+	check := func(req *http.Request) string {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		return rr.Body.String()
+	}
+
+	// Each client gets the codebase URL for its own channel and platform
+	body := check(httptest.NewRequest(http.MethodPost, "/extensions", strings.NewReader(extensiontest.ExtensionRequestFnFor(id)("0.0.0"))))
+	assert.Contains(t, body, `codebase="https://cdn.example.com/stable/mac/`+id+`/1.0.0.crx"`)
+	body = check(httptest.NewRequest(http.MethodPost, "/extensions", strings.NewReader(`{"request":{"protocol":"4.0","@os":"win","prodchannel":"beta","apps":[
+		{"appid":"`+id+`","version":"0.0.0","updatecheck":{}}]}}`)))
+	assert.Contains(t, body, `"url":"https://cdn.example.com/beta/win/`+id+`/1.0.0.crx"`)
+	body = check(httptest.NewRequest(http.MethodGet, "/extensions?prodchannel=dev&os=linux&x="+url.QueryEscape("id="+id+"&v=0.0.0"), nil))
+	assert.Contains(t, body, `codebase="https://cdn.example.com/dev/linux/`+id+`/1.0.0.crx"`)
+
+	// Regional mirrors keep the path for the client
+	handlerOptions.UpdateSettings(func(settings *controller.Settings) {
+		settings.CDNURLPrefixes = map[string]string{"JP": "https://jp.example.com"}
+		settings.CountryHeader = "CloudFront-Viewer-Country"
+	})
+	req := httptest.NewRequest(http.MethodPost, "/extensions", strings.NewReader(extensiontest.ExtensionRequestFnFor(id)("0.0.0")))
+	req.Header.Set("CloudFront-Viewer-Country", "JP")
+	assert.Contains(t, check(req), `codebase="https://jp.example.com/stable/mac/`+id+`/1.0.0.crx"`)
+
+	// The client's attributes never end up in the catalog
+	req = httptest.NewRequest(http.MethodGet, "/api/admin/catalog", nil)
+	req.Header.Set("Authorization", "Bearer test-token")
+	body = check(req)
+	assert.NotContains(t, body, `"channel"`)
+	assert.NotContains(t, body, `"platform"`)
+}
+
+func TestRegionalMirrors(t *testing.T) {
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	defer func() {
+		handlerOptions.UpdateSettings(func(settings *controller.Settings) {
+			settings.CDNURLPrefixes = map[string]string{}
+			settings.CountryHeader = ""
+		})
+	}()
+	handlerOptions.UpdateSettings(func(settings *controller.Settings) {
+		settings.CDNURLPrefixes = map[string]string{"JP": "https://jp.example.com"}
+	})
+	requestBody := extensiontest.ExtensionRequestFnFor("ldimlcelhnjgpjjemdjokpgeeikdinbm")("0.0.0")
+	getCodebase := func(country string) string {
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/extensions", bytes.NewBufferString(requestBody))
+		assert.Nil(t, err)
+		req.Header.Set("CloudFront-Viewer-Country", country)
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		actual, err := ioutil.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		return string(actual)
+	}
+
+	// The header clients could send themselves isn't trusted until it is configured
+	assert.Contains(t, getCodebase("JP"), `codebase="https://brave-core-ext.s3.brave.com/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/extension_1_0_0.crx"`)
+
+	handlerOptions.UpdateSettings(func(settings *controller.Settings) {
+		settings.CountryHeader = "CloudFront-Viewer-Country"
+	})
+	assert.Contains(t, getCodebase("jp"), `codebase="https://jp.example.com/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/extension_1_0_0.crx"`)
+	assert.Contains(t, getCodebase("US"), `codebase="https://brave-core-ext.s3.brave.com/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/extension_1_0_0.crx"`)
+}
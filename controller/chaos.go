@@ -0,0 +1,254 @@
+package controller
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/pressly/lg"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Faults which can be injected into update checks
+const (
+	// FaultDelay answers after Delay
+	FaultDelay = "delay"
+	// FaultError answers with Status, 503 if it isn't set
+	FaultError = "error"
+	// FaultMalformed answers with XML which can't be parsed
+	FaultMalformed = "malformed"
+	// FaultWrongHash advertises a SHA256 which doesn't match the package
+	FaultWrongHash = "wrong_hash"
+	// FaultTruncate closes the connection halfway through the response
+	FaultTruncate = "truncate"
+)
+
+// ChaosFault is a fault injected into every update check for the extension with ID
+type ChaosFault struct {
+	ID    string `json:"id"`
+	Fault string `json:"fault"`
+	// Delay is a duration like "5s" for FaultDelay
+	Delay  string `json:"delay,omitempty"`
+	Status int    `json:"status,omitempty"`
+}
+
+// chaosFaults are the faults injected by extension ID into the update checks served with some Options
+type chaosFaults struct {
+	mutex  sync.RWMutex
+	faults map[string]ChaosFault
+}
+
+// chaosMode returns whether faults can be injected into the update checks served with opts
+func (opts *Options) chaosMode() bool {
+	return opts != nil && opts.ChaosMode
+}
+
+// validate checks the fault is known and its parameters make sense
+func (fault ChaosFault) validate() error {
+	switch fault.Fault {
+	case FaultDelay:
+		if _, err := time.ParseDuration(fault.Delay); err != nil {
+			return fmt.Errorf("delay: %v", err)
+		}
+	case FaultError:
+		if fault.Status != 0 && (fault.Status < 400 || fault.Status > 599) {
+			return fmt.Errorf("status %d is not an error", fault.Status)
+		}
+	case FaultMalformed, FaultWrongHash, FaultTruncate:
+	default:
+		return fmt.Errorf("unknown fault %q", fault.Fault)
+	}
+	return nil
+}
+
+// find returns the fault for the first extension with one which is mentioned in the request
+func (chaos *chaosFaults) find(r *http.Request, body []byte) (ChaosFault, bool) {
+	chaos.mutex.RLock()
+	defer chaos.mutex.RUnlock()
+	if len(chaos.faults) == 0 {
+		return ChaosFault{}, false
+	}
+	query, _ := url.QueryUnescape(r.URL.RawQuery)
+	ids := []string{}
+	for id := range chaos.faults {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if bytes.Contains(body, []byte(id)) || bytes.Contains([]byte(query), []byte(id)) {
+			return chaos.faults[id], true
+		}
+	}
+	return ChaosFault{}, false
+}
+
+// list returns the faults sorted by ID
+func (chaos *chaosFaults) list() []ChaosFault {
+	chaos.mutex.RLock()
+	defer chaos.mutex.RUnlock()
+	faults := []ChaosFault{}
+	for _, fault := range chaos.faults {
+		faults = append(faults, fault)
+	}
+	sort.Slice(faults, func(i, j int) bool {
+		return faults[i].ID < faults[j].ID
+	})
+	return faults
+}
+
+// put injects fault, returning the fault it replaced if there was one
+func (chaos *chaosFaults) put(fault ChaosFault) (ChaosFault, bool) {
+	chaos.mutex.Lock()
+	defer chaos.mutex.Unlock()
+	before, existed := chaos.faults[fault.ID]
+	if chaos.faults == nil {
+		chaos.faults = map[string]ChaosFault{}
+	}
+	chaos.faults[fault.ID] = fault
+	return before, existed
+}
+
+// remove stops injecting faults for the extension with id, returning the fault it removed if there was one
+func (chaos *chaosFaults) remove(id string) (ChaosFault, bool) {
+	chaos.mutex.Lock()
+	defer chaos.mutex.Unlock()
+	before, ok := chaos.faults[id]
+	delete(chaos.faults, id)
+	return before, ok
+}
+
+// injectFaults applies the fault of an extension in the update check in chaos mode
+func injectFaults(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		opts := optionsFor(r.Context())
+		if !opts.chaosMode() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1024*1024*10))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error reading body: %v", err), http.StatusBadRequest)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		fault, ok := opts.chaosFaults.find(r, body)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		lg.Log(r.Context()).Warnf("Injecting %s fault for extension %s", fault.Fault, fault.ID)
+
+		switch fault.Fault {
+		case FaultDelay:
+			delay, _ := time.ParseDuration(fault.Delay)
+			select {
+			case <-time.After(delay):
+			case <-r.Context().Done():
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		case FaultError:
+			status := fault.Status
+			if status == 0 {
+				status = http.StatusServiceUnavailable
+			}
+			http.Error(w, http.StatusText(status), status)
+			return
+		case FaultMalformed:
+			w.Header().Set("content-type", "application/xml")
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><response protocol="3.1"><app appid="` + fault.ID + `"><updatecheck status="ok"`))
+			return
+		}
+
+		recorder := httptest.NewRecorder()
+		next.ServeHTTP(recorder, r)
+		data := recorder.Body.Bytes()
+		if fault.Fault == FaultWrongHash {
+			if ext, ok := catalogFor(r)[fault.ID]; ok && len(ext.SHA256) != 0 {
+				wrong := sha256.Sum256([]byte(ext.SHA256))
+				data = bytes.Replace(data, []byte(ext.SHA256), []byte(hex.EncodeToString(wrong[:])), -1)
+			}
+		}
+		for name, values := range recorder.Header() {
+			w.Header()[name] = values
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		if fault.Fault == FaultTruncate {
+			// Writing less than Content-Length makes the server close the connection, as if it dropped
+			data = data[:len(data)/2]
+		}
+		w.WriteHeader(recorder.Code)
+		_, _ = w.Write(data)
+	})
+}
+
+// chaosModeOnly hides the chaos endpoints unless chaos mode is enabled
+func chaosModeOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !optionsFor(r.Context()).chaosMode() {
+			http.NotFound(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// GetChaosFaults is the admin handler for listing the injected faults
+func GetChaosFaults(w http.ResponseWriter, r *http.Request) {
+	writeList(w, r, "faults", optionsFor(r.Context()).chaosFaults.list())
+}
+
+// PutChaosFault is the admin handler for injecting a fault into update checks for an extension.
+// The body is a ChaosFault.
+func PutChaosFault(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !appIDRegexp.MatchString(id) {
+		http.Error(w, fmt.Sprintf("Invalid extension ID: %s", id), http.StatusBadRequest)
+		return
+	}
+	fault := ChaosFault{}
+	err := json.NewDecoder(io.LimitReader(r.Body, 1024*1024)).Decode(&fault)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading body: %v", err), http.StatusBadRequest)
+		return
+	}
+	fault.ID = id
+	err = fault.validate()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid fault: %v", err), http.StatusBadRequest)
+		return
+	}
+	before, existed := optionsFor(r.Context()).chaosFaults.put(fault)
+	if existed {
+		audit(r.Context(), AuditUpdate, "chaos/"+id, before, fault)
+	} else {
+		audit(r.Context(), AuditCreate, "chaos/"+id, nil, fault)
+	}
+	lg.Log(r.Context()).Warnf("Injecting %s faults for extension %s", fault.Fault, id)
+	writeJSON(w, r, http.StatusOK, fault)
+}
+
+// DeleteChaosFault is the admin handler for no longer injecting faults for an extension
+func DeleteChaosFault(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	before, ok := optionsFor(r.Context()).chaosFaults.remove(id)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	audit(r.Context(), AuditDelete, "chaos/"+id, before, nil)
+	lg.Log(r.Context()).Infof("No longer injecting faults for extension %s", id)
+	w.WriteHeader(http.StatusNoContent)
+}
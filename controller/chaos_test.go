@@ -0,0 +1,84 @@
+package controller_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/extension"
+	"github.com/brave/go-update/memstore"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestChaosMode(t *testing.T) {
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	admin := func(method string, id string, body string) int {
+		req, err := http.NewRequest(method, server.URL+"/api/admin/chaos/"+id, bytes.NewBufferString(body))
+		assert.Nil(t, err)
+		req.Header.Set("Authorization", "Bearer test-token")
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		return resp.StatusCode
+	}
+	check := func() (*http.Response, string, error) {
+		query := "?" + getQueryParams(&extension.Extension{ID: "ldimlcelhnjgpjjemdjokpgeeikdinbm", Version: "0.0.0"})
+		resp, err := http.Get(server.URL + "/extensions" + query)
+		if err != nil {
+			return nil, "", err
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		return resp, string(body), err
+	}
+
+	// The endpoints don't exist outside chaos mode
+	assert.Equal(t, http.StatusNotFound, admin(http.MethodPut, "ldimlcelhnjgpjjemdjokpgeeikdinbm", `{"fault":"error"}`))
+	opts := &controller.Options{Store: controller.NewValidatingStore(memstore.New(nil)), Clock: testClock, ChaosMode: true}
+	opts.SetCatalog(handlerOptions.CurrentCatalog().Map())
+	server = httptest.NewServer(newTestHandler(opts))
+	defer server.Close()
+	assert.Equal(t, http.StatusBadRequest, admin(http.MethodPut, "ldimlcelhnjgpjjemdjokpgeeikdinbm", `{"fault":"meteor"}`))
+	assert.Equal(t, http.StatusBadRequest, admin(http.MethodPut, "ldimlcelhnjgpjjemdjokpgeeikdinbm", `{"fault":"delay","delay":"soon"}`))
+
+	assert.Equal(t, http.StatusOK, admin(http.MethodPut, "ldimlcelhnjgpjjemdjokpgeeikdinbm", `{"fault":"error","status":502}`))
+	resp, _, err := check()
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+
+	assert.Equal(t, http.StatusOK, admin(http.MethodPut, "ldimlcelhnjgpjjemdjokpgeeikdinbm", `{"fault":"delay","delay":"200ms"}`))
+	start := time.Now()
+	resp, body, err := check()
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.True(t, time.Since(start) >= 200*time.Millisecond)
+	assert.Contains(t, body, `hash_sha256="1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618"`)
+
+	assert.Equal(t, http.StatusOK, admin(http.MethodPut, "ldimlcelhnjgpjjemdjokpgeeikdinbm", `{"fault":"malformed"}`))
+	_, body, err = check()
+	assert.Nil(t, err)
+	assert.NotNil(t, xml.Unmarshal([]byte(body), &struct{}{}))
+
+	assert.Equal(t, http.StatusOK, admin(http.MethodPut, "ldimlcelhnjgpjjemdjokpgeeikdinbm", `{"fault":"wrong_hash"}`))
+	_, body, err = check()
+	assert.Nil(t, err)
+	assert.Contains(t, body, `version="1.0.0"`)
+	assert.NotContains(t, body, "1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618")
+
+	assert.Equal(t, http.StatusOK, admin(http.MethodPut, "ldimlcelhnjgpjjemdjokpgeeikdinbm", `{"fault":"truncate"}`))
+	_, _, err = check()
+	assert.NotNil(t, err)
+
+	// Other extensions aren't affected
+	resp, err = http.Get(server.URL + "/extensions?" + getQueryParams(&extension.Extension{ID: "bfdgpgibhagkpdlnjonhkabjoijopoge", Version: "0.0.0"}))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, http.StatusNoContent, admin(http.MethodDelete, "ldimlcelhnjgpjjemdjokpgeeikdinbm", ""))
+	_, body, err = check()
+	assert.Nil(t, err)
+	assert.Contains(t, body, "1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618")
+}
@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"time"
+)
+
+// Clock tells the time and schedules work. It is replaced in tests, which advance time
+// rather than waiting for refreshes, scheduled versions and serving windows.
+type Clock interface {
+	Now() time.Time
+	// NewTicker returns a Ticker sending the time every d
+	NewTicker(d time.Duration) Ticker
+	// AfterFunc calls f in its own goroutine once d has elapsed
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Ticker sends the time on its channel at intervals, like time.Ticker
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Timer is a call scheduled by Clock.AfterFunc, like time.Timer
+type Timer interface {
+	Stop() bool
+}
+
+// systemClock is the Clock of the time package
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+type systemTicker struct {
+	*time.Ticker
+}
+
+func (ticker systemTicker) C() <-chan time.Time {
+	return ticker.Ticker.C
+}
+
+// SystemClock is the real time
+var SystemClock Clock = systemClock{}
+
+// DefaultClock is the clock of catalog refreshes, scheduled versions, presigned URLs,
+// and of handlers without their own. It must be set before the server starts handling requests.
+var DefaultClock = SystemClock
+
+// clockOr returns clock, or DefaultClock if it is nil
+func clockOr(clock Clock) Clock {
+	if clock == nil {
+		return DefaultClock
+	}
+	return clock
+}
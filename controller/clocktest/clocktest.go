@@ -0,0 +1,159 @@
+// Package clocktest provides a controller.Clock whose time only moves when a test advances it.
+package clocktest
+
+import (
+	"github.com/brave/go-update/controller"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is a controller.Clock which starts at a fixed time and is advanced by Advance.
+// Tickers and timers fire as the time passes their deadlines.
+type Clock struct {
+	mutex   sync.Mutex
+	now     time.Time
+	waiters []*waiter
+}
+
+// waiter is a ticker or timer waiting for the time to reach next
+type waiter struct {
+	clock *Clock
+	next  time.Time
+	// period is the interval of a ticker, or 0 for a timer
+	period time.Duration
+	c      chan time.Time
+	f      func()
+}
+
+// New creates a Clock whose time is now
+func New(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Now returns the time of the clock
+func (clock *Clock) Now() time.Time {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+	return clock.now
+}
+
+// NewTicker returns a Ticker which fires every d of advanced time
+func (clock *Clock) NewTicker(d time.Duration) controller.Ticker {
+	if d <= 0 {
+		panic("clocktest: non-positive interval for NewTicker")
+	}
+	return ticker{clock.add(&waiter{next: clock.Now().Add(d), period: d, c: make(chan time.Time, 1)})}
+}
+
+// AfterFunc calls f once the time is advanced by d
+func (clock *Clock) AfterFunc(d time.Duration, f func()) controller.Timer {
+	w := clock.add(&waiter{next: clock.Now().Add(d), f: f})
+	// Timers which are already due fire straight away, as with time.AfterFunc
+	clock.Advance(0)
+	return timer{w}
+}
+
+func (clock *Clock) add(w *waiter) *waiter {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+	w.clock = clock
+	clock.waiters = append(clock.waiters, w)
+	return w
+}
+
+// Set moves the clock to now, which must not be before its time, firing what is due in order
+func (clock *Clock) Set(now time.Time) {
+	clock.Advance(now.Sub(clock.Now()))
+}
+
+// Advance moves the clock forward by d, firing the tickers and timers which are due in order.
+// The functions of timers have returned by the time Advance does, so tests can check their effects straight away.
+// Each ticker fires at most once per call, and drops ticks its receiver hasn't read yet like time.Ticker.
+func (clock *Clock) Advance(d time.Duration) {
+	clock.mutex.Lock()
+	end := clock.now.Add(d)
+	fired := map[*waiter]bool{}
+	for {
+		due := clock.due(end, fired)
+		if due == nil {
+			break
+		}
+		fired[due] = true
+		clock.now = due.next
+		if due.period == 0 {
+			clock.remove(due)
+			clock.mutex.Unlock()
+			due.f()
+			clock.mutex.Lock()
+			continue
+		}
+		select {
+		case due.c <- due.next:
+		default:
+		}
+		// Ticks missed by a long advance are skipped
+		for !due.next.After(end) {
+			due.next = due.next.Add(due.period)
+		}
+	}
+	if end.After(clock.now) {
+		clock.now = end
+	}
+	clock.mutex.Unlock()
+}
+
+// due returns the earliest waiter due by end which hasn't fired yet. The clock must be locked.
+func (clock *Clock) due(end time.Time, fired map[*waiter]bool) *waiter {
+	waiters := []*waiter{}
+	for _, w := range clock.waiters {
+		if !fired[w] && !w.next.After(end) {
+			waiters = append(waiters, w)
+		}
+	}
+	if len(waiters) == 0 {
+		return nil
+	}
+	sort.SliceStable(waiters, func(i, j int) bool {
+		return waiters[i].next.Before(waiters[j].next)
+	})
+	return waiters[0]
+}
+
+// remove stops w from firing and returns true if it was waiting. The clock must be locked.
+func (clock *Clock) remove(w *waiter) bool {
+	for i, waiting := range clock.waiters {
+		if waiting == w {
+			clock.waiters = append(clock.waiters[:i], clock.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type ticker struct {
+	*waiter
+}
+
+func (t ticker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t ticker) Stop() {
+	t.stop()
+}
+
+type timer struct {
+	*waiter
+}
+
+// Stop returns true if the timer hadn't fired yet
+func (t timer) Stop() bool {
+	return t.stop()
+}
+
+func (w *waiter) stop() bool {
+	w.clock.mutex.Lock()
+	defer w.clock.mutex.Unlock()
+	return w.clock.remove(w)
+}
@@ -1,11 +1,9 @@
 package controller
 
 import (
-	"encoding/xml"
+	"context"
+	"encoding/json"
 	"fmt"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/brave/go-update/extension"
 	"github.com/getsentry/raven-go"
 	"github.com/go-chi/chi"
@@ -19,73 +17,93 @@ import (
 	"time"
 )
 
-// AllExtensionsMap holds a mapping of extension ID to extension object.
-// This list for tests is populated by extensions.OfferedExtensions.
-// For normal operaitons of this server it is obtained from the AWS config
-// of the host machine for DynamoDB.
-var AllExtensionsMap = map[string]extension.Extension{}
-
 // ExtensionUpdaterTimeout is the amount of time to wait between getting new updates from DynamoDB for the list of extensions
 var ExtensionUpdaterTimeout = time.Minute * 10
 
-func initExtensionUpdatesFromDynamoDB() {
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String("us-east-2")},
-	)
-
-	if err != nil {
-		log.Printf("failed to connect to new session %v\n", err)
-		raven.CaptureError(err, nil)
+// loadDefaultCatalog reloads the default catalog of opts from its store
+func (opts *Options) loadDefaultCatalog() {
+	extensions, err := opts.store().LoadExtensions(context.Background())
+	if isBreakerOpen(err) {
+		log.Printf("skipped loading extensions, keeping the current catalog: %v\n", err)
 		return
 	}
-
-	// Create DynamoDB client
-	svc := dynamodb.New(sess)
-	params := &dynamodb.ScanInput{
-		TableName: aws.String("Extensions"),
-	}
-
-	// For most use cases, you probably wouldn't want to scan all entries; however,
-	// for our use case we have a read only small number of items, that are infrequently
-	// updated, usually less than daily by an external tool, and very often queried.
-	result, err := svc.Scan(params)
-	if err != nil {
-		log.Printf("failed to make Scan API call %v\n", err)
-		raven.CaptureError(err, nil)
+	// Invalid records are quarantined below rather than failing the refresh
+	if err != nil && !IsValidationError(err) {
+		log.Printf("failed to load extensions %v\n", err)
+		raven.CaptureError(err, map[string]string{"task": "refresh"})
 		return
 	}
 
-	// Update the extensions map
-	for _, item := range result.Items {
-		id := *item["ID"].S
-		AllExtensionsMap[id] = extension.Extension{
-			ID:          id,
-			Blacklisted: *item["Disabled"].BOOL,
-			SHA256:      *item["SHA256"].S,
-			Title:       *item["Title"].S,
-			Version:     *item["Version"].S,
+	// Update the extensions map, keeping the current entries of extensions whose records are quarantined.
+	// Scheduled versions are handled before taking the write lock, since publishing them also updates the catalog.
+	holder := opts.defaultCatalog()
+	loaded := quarantine(holder, "", extensions)
+	for i, ext := range loaded {
+		loaded[i] = publishScheduled(holder, ext)
+	}
+	holder.update(func(catalog map[string]extension.Extension) {
+		for _, ext := range loaded {
+			catalog[ext.ID] = ext
 		}
+	})
+}
+
+// refreshDefaultCatalog reloads the default catalog of opts and kicks off verification and link checks of the packages
+// in it and the catalogs of the tenants
+func (opts *Options) refreshDefaultCatalog() {
+	opts.loadDefaultCatalog()
+	settings := opts.settings()
+	if settings.VerifyPayloads {
+		extensions := opts.servedExtensions()
+		go raven.CapturePanic(func() {
+			opts.verifyPackages(context.Background(), extensions)
+		}, map[string]string{"task": "verify"})
+	}
+	if settings.CheckLinks {
+		extensions := opts.servedExtensions()
+		go raven.CapturePanic(func() {
+			opts.checkLinks(extensions)
+		}, map[string]string{"task": "linkcheck"})
 	}
 }
 
 // RefreshExtensionsTicker updates the list of extensions by
-// calling the specified extensionMapUpdater function
+// calling the specified extensionMapUpdater function.
+// Panics in the updater are reported to Sentry instead of stopping the refreshes.
 func RefreshExtensionsTicker(extensionMapUpdater func()) {
-	extensionMapUpdater()
-	ticker := time.NewTicker(ExtensionUpdaterTimeout)
+	refreshTicker(DefaultClock, ExtensionUpdaterTimeout, extensionMapUpdater)
+}
+
+// refreshTicker calls refresh now and then every interval of clock, like RefreshExtensionsTicker
+func refreshTicker(clock Clock, interval time.Duration, refresh func()) {
+	refresh()
+	ticker := clock.NewTicker(interval)
 	go func() {
-		for range ticker.C {
-			extensionMapUpdater()
+		for range ticker.C() {
+			raven.CapturePanic(refresh, map[string]string{"task": "refresh"})
 		}
 	}()
 }
 
-// ExtensionsRouter is the router for /extensions endpoints
-func ExtensionsRouter(extensions extension.Extensions) chi.Router {
-	RefreshExtensionsTicker(initExtensionUpdatesFromDynamoDB)
+// ExtensionsRouter is the router for /extensions endpoints. It starts refreshing the catalogs of opts,
+// or the package's catalog from ExtensionStore if opts is nil.
+func ExtensionsRouter(extensions extension.Extensions, opts *Options) chi.Router {
+	opts.start()
+	return extensionsRouter(opts)
+}
+
+// extensionsRouter routes update checks, which are served from the catalog of the request's tenant
+func extensionsRouter(opts *Options) chi.Router {
 	r := chi.NewRouter()
-	r.Post("/", UpdateExtensions)
-	r.Get("/", WebStoreUpdateExtension)
+	r.Use(ServeWith(opts))
+	r.Use(allowUpdateChecksFromAnyOrigin)
+	r.Use(rejectDuringMaintenance)
+	r.Use(shedBackgroundChecks)
+	r.Use(injectFaults)
+	r.Use(signResponses)
+	catalogs, settings := ServerCatalogs(opts), ServerSettings(opts)
+	r.Method(http.MethodPost, "/", NewUpdateHandler(catalogs, settings))
+	r.Method(http.MethodGet, "/", NewWebStoreHandler(catalogs, settings))
 	r.Get("/test", PrintExtensions)
 	return r
 }
@@ -97,14 +115,15 @@ func PrintExtensions(w http.ResponseWriter, r *http.Request) {
 	log := lg.Log(r.Context())
 	w.Header().Set("content-type", "text/plain")
 	w.WriteHeader(http.StatusOK)
-	if len(AllExtensionsMap) == 0 {
+	catalog := catalogFor(r)
+	if len(catalog) == 0 {
 		_, err := w.Write([]byte("No extensions found, do you have the AWS config correct for DynamoDB?"))
 		if err != nil {
 			log.Errorf("Error writing response for printing extensions: %v", err)
 		}
 		return
 	}
-	for key, val := range AllExtensionsMap {
+	for key, val := range catalog {
 		s := fmt.Sprintf("%s=%+v\n\n", key, val)
 		_, err := w.Write([]byte(s))
 		if err != nil {
@@ -118,8 +137,15 @@ func PrintExtensions(w http.ResponseWriter, r *http.Request) {
 // Get requests look like this:
 // /extensions?os=mac&arch=x64&os_arch=x86_64&nacl_arch=x86-64&prod=chromiumcrx&prodchannel=&prodversion=69.0.54.0&lang=en-US&acceptformat=crx2,crx3&x=id%3Doemmndcbldboiebfnladdacbdfmadadm%26v%3D0.0.0.0%26installedby%3Dpolicy%26uc%26ping%3Dr%253D-1%2526e%253D1"
 // The query parameter x contains the encoded extension information, there can be more than one x parameter.
+// It serves the catalogs of the request's Options with their settings.
 func WebStoreUpdateExtension(w http.ResponseWriter, r *http.Request) {
-	log := lg.Log(r.Context())
+	opts := optionsFor(r.Context())
+	NewWebStoreHandler(ServerCatalogs(opts), ServerSettings(opts)).ServeHTTP(w, r)
+}
+
+// ServeHTTP answers a GET update check, see WebStoreUpdateExtension
+func (h *WebStoreHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log := h.log(r)
 	defer func() {
 		err := r.Body.Close()
 		if err != nil {
@@ -127,8 +153,23 @@ func WebStoreUpdateExtension(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 
+	// HEAD requests are only probes, so they aren't exported or counted as updates served
+	if r.Method != http.MethodHead {
+		exportWebStoreCheck(r.Context(), r.URL.Query())
+	}
 	xValues := r.URL.Query()["x"]
+	if max := maxAppsPerResponse(r); max != 0 && len(xValues) > max {
+		recordTruncated(r, "webstore", max, len(xValues))
+		nextPage(w, r, xValues[max:])
+		xValues = xValues[:max]
+	}
+	catalog, generation := catalogSnapshot(h.Catalog, r)
 	webStoreResponse := extension.WebStoreUpdateResponse{}
+	responded := extension.WebStoreUpdateResponse{}
+	requestedIDs := make([]string, 0, len(xValues))
+	var hint retryHint
+	now := h.now(r)
+	settings := h.settings()
 	for _, x := range xValues {
 		unescaped, err := url.QueryUnescape(x)
 		if err != nil {
@@ -147,37 +188,101 @@ func WebStoreUpdateExtension(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, fmt.Sprintf("No extension ID specified."), http.StatusBadRequest)
 			return
 		}
+		requestedIDs = append(requestedIDs, id)
 
-		foundExtension, ok := AllExtensionsMap[id]
-		if !ok && len(xValues) == 1 {
-			http.Redirect(w, r, "https://clients2.google.com/service/update2/crx?"+r.URL.RawQuery+"&braveRedirect=true", http.StatusTemporaryRedirect)
-			return
+		query := r.URL.Query()
+		checked := extension.Extension{
+			ID:          id,
+			Version:     v,
+			Channel:     query.Get("prodchannel"),
+			Platform:    query.Get("os"),
+			Arch:        query.Get("arch"),
+			ProdVersion: query.Get("prodversion"),
+			Lang:        query.Get("lang"),
+		}
+		if respond := settings.Responder(r, id); respond != nil {
+			if update, ok := respond(r, checked); ok {
+				update.ID = id
+				update.SetCodebaseURL(checked.Client())
+				responded = append(responded, update)
+			}
+			continue
 		}
-		if extension.CompareVersions(v, foundExtension.Version) < 0 {
+		foundExtension, err := extension.Lookup(catalog, id)
+		if len(xValues) == 1 {
+			if fallbackURL, _, redirect := settings.RedirectURLs(r, id, extension.Cause(err) != extension.ErrUnknownApp); redirect && len(fallbackURL) != 0 {
+				redirectToFallback(w, r, fallbackURL)
+				return
+			}
+		}
+		foundExtension, offered := foundExtension.Target(checked)
+		if offered && extension.CompareVersions(v, foundExtension.Version) < 0 && !settings.PackageMissing(foundExtension) {
+			if wait := settings.UntilServingWindow(id, now); wait != 0 {
+				hint.add(wait)
+				continue
+			}
+			if ok, wait := withinUpdateBudget(r, id, now); !ok {
+				hint.add(wait)
+				continue
+			}
 			webStoreResponse = append(webStoreResponse, extension.Extension{
 				ID:      foundExtension.ID,
 				Version: foundExtension.Version,
 				SHA256:  foundExtension.SHA256,
+				Size:    foundExtension.Size,
 			})
 		}
 	}
 
-	w.Header().Set("content-type", "application/xml")
-	w.WriteHeader(http.StatusOK)
-	data, err := xml.Marshal(&webStoreResponse)
+	query := r.URL.Query()
+	client := extension.Client{Channel: query.Get("prodchannel"), Platform: query.Get("os")}
+	selectMirrors(r, webStoreResponse, client)
+	for i := range webStoreResponse {
+		webStoreResponse[i].SetCodebaseURL(client)
+	}
+	budgeted := webStoreResponse
+	webStoreResponse = append(webStoreResponse, responded...)
+	etag := webStoreETag(r, generation, webStoreResponse)
+	setWebStoreCacheHeaders(w, r, etag)
+	setRetryAfter(w, hint)
+	setSurrogateKeys(w, r, requestedIDs)
+	if etagMatches(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	buffer := getResponseBuffer()
+	defer putResponseBuffer(buffer)
+	data, contentType, err := marshalWebStoreResponse(*buffer, r, webStoreResponse, now)
+	*buffer = data[:0]
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error in marshal XML %v", err), http.StatusInternalServerError)
+		captureRequestError(r, err)
+		http.Error(w, fmt.Sprintf("Error in marshal response %v", err), http.StatusInternalServerError)
 		return
 	}
+	// Only updates which are sent are counted, not those of HEAD requests or of responses the client has cached,
+	// and the same goes for their budgets
+	if !isCanaryRequest(r) && r.Method != http.MethodHead {
+		recordUpdatesServed(r.Context(), webStoreResponse, "webstore")
+	}
+	chargeUpdateBudgets(r, budgeted, now)
+	w.Header().Set("content-type", contentType)
+	w.WriteHeader(http.StatusOK)
 	_, err = w.Write(data)
 	if err != nil {
 		log.Errorf("Error writing response: %v", err)
 	}
 }
 
-// UpdateExtensions is the handler for updating extensions
+// UpdateExtensions is the handler for updating extensions.
+// It serves the catalogs of the request's Options with their settings.
 func UpdateExtensions(w http.ResponseWriter, r *http.Request) {
-	log := lg.Log(r.Context())
+	opts := optionsFor(r.Context())
+	NewUpdateHandler(ServerCatalogs(opts), ServerSettings(opts)).ServeHTTP(w, r)
+}
+
+// ServeHTTP answers an XML or protocol 4 update check, see UpdateExtensions
+func (h *UpdateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log := h.log(r)
 	defer func() {
 		err := r.Body.Close()
 		if err != nil {
@@ -195,34 +300,161 @@ func UpdateExtensions(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Request too large", http.StatusBadRequest)
 		return
 	}
+	logBodyHash(r, body)
+
+	dedupKey := getDedupKey(r, body)
+	if writeDuplicateResponse(w, r, dedupKey, body) {
+		return
+	}
+	if isProtocol4Request(r, body) {
+		h.serveProtocol4(w, r, body, dedupKey)
+		return
+	}
 
-	updateRequest := extension.UpdateRequest{}
-	err = xml.Unmarshal(body, &updateRequest)
+	updateRequest, err := extension.ParseXMLUpdateRequest(body)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error reading body %v", err), http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("Error reading body %v", err), errorStatus(err))
 		return
 	}
-	// Special case, if there's only 1 extension in the request and it is not something
-	// we know about, redirect the client to google component update server.
-	if len(updateRequest) == 1 {
-		_, ok := AllExtensionsMap[updateRequest[0].ID]
-		if !ok {
-			queryString := "braveRedirect=true"
-			if len(r.URL.RawQuery) != 0 {
-				queryString = r.URL.RawQuery + "&" + queryString
-			}
-			http.Redirect(w, r, "https://update.googleapis.com/service/update2?"+queryString, http.StatusTemporaryRedirect)
-			return
-		}
+	if !isCanaryRequest(r) {
+		exportUpdateCheck(r.Context(), body)
 	}
+	if h.redirectUnknownExtension(w, r, updateRequest) {
+		return
+	}
+	updateResponse, updates, hint := h.updateResponse(r, updateRequest, "omaha")
+	setRetryAfter(w, hint)
 	w.Header().Set("content-type", "application/xml")
 	w.WriteHeader(http.StatusOK)
-	updateResponse := updateRequest.FilterForUpdates(&AllExtensionsMap)
-	data, err := xml.Marshal(&updateResponse)
+	buffer := getResponseBuffer()
+	defer putResponseBuffer(buffer)
+	data := marshalUpdateResponse(r, *buffer, body, updateResponse)
+	*buffer = data[:0]
+	if !isCanaryRequest(r) {
+		recordUpdatesServed(r.Context(), updateResponse[:updates], "omaha")
+	}
+	rememberResponse(r, dedupKey, body, w.Header(), data)
+	_, err = w.Write(data)
+	if err != nil {
+		log.Errorf("Error writing response: %v", err)
+	}
+}
+
+// redirectUnknownExtension redirects the client to Google's component update server
+// and returns true if there's only 1 extension in the request and it is not something we know about,
+// or its AppOverride redirects it.
+func (h *UpdateHandler) redirectUnknownExtension(w http.ResponseWriter, r *http.Request, updateRequest extension.UpdateRequest) bool {
+	settings := h.settings()
+	if len(updateRequest) != 1 || settings.Responder(r, updateRequest[0].ID) != nil {
+		return false
+	}
+	_, err := extension.Lookup(h.Catalog.Catalog(r), updateRequest[0].ID)
+	_, fallbackURL, redirect := settings.RedirectURLs(r, updateRequest[0].ID, extension.Cause(err) != extension.ErrUnknownApp)
+	if !redirect || len(fallbackURL) == 0 {
+		return false
+	}
+	redirectToFallback(w, r, fallbackURL)
+	return true
+}
+
+// redirectToFallback redirects the request to fallbackURL with its query followed by the RedirectMarker
+// of the settings serving it
+func redirectToFallback(w http.ResponseWriter, r *http.Request, fallbackURL string) {
+	marker := optionsFor(r.Context()).settings().RedirectMarker
+	query := r.URL.RawQuery
+	switch {
+	case len(marker) == 0:
+	case len(query) == 0:
+		query = marker
+	default:
+		query += "&" + marker
+	}
+	if len(query) != 0 {
+		fallbackURL += "?" + query
+	}
+	http.Redirect(w, r, fallbackURL, http.StatusTemporaryRedirect)
+}
+
+// updateResponse returns the updates for updateRequest followed by the acknowledgements of its pings, how many
+// of them are updates, and when to check again for the updates which were held back
+func (h *UpdateHandler) updateResponse(r *http.Request, updateRequest extension.UpdateRequest, protocol string) (extension.UpdateResponse, int, retryHint) {
+	catalog := h.Catalog.Catalog(r)
+	updateResponse := extension.UpdateResponse{}
+	requested := len(updateRequest)
+	settings := h.settings()
+	responded, acknowledged, updateRequest := respond(r, settings, updateRequest)
+	now := h.now(r)
+	overBudget := extension.UpdateResponse{}
+	var hint retryHint
+	for _, ext := range updateRequest.FilterForUpdates(&catalog) {
+		if settings.PackageMissing(ext) {
+			continue
+		}
+		if wait := settings.UntilServingWindow(ext.ID, now); wait != 0 {
+			hint.add(wait)
+			continue
+		}
+		if ok, wait := withinUpdateBudget(r, ext.ID, now); !ok {
+			hint.add(wait)
+			overBudget = append(overBudget, budgetExceeded(updateRequest, ext.ID))
+			continue
+		}
+		updateResponse = append(updateResponse, ext)
+	}
+	client := updateRequest.Client()
+	selectMirrors(r, updateResponse, client)
+	for i := range updateResponse {
+		updateResponse[i].SetCodebaseURL(client)
+	}
+	orderDownloadURLs(r.Context(), updateResponse)
+	budgeted := len(updateResponse)
+	updateResponse = append(updateResponse, responded...)
+	max := maxAppsPerResponse(r)
+	truncated := max != 0 && len(updateResponse) > max
+	if truncated {
+		updateResponse = updateResponse[:max]
+		if budgeted > max {
+			budgeted = max
+		}
+	}
+	// Updates cut from the response don't use up their budgets
+	chargeUpdateBudgets(r, updateResponse[:budgeted], now)
+	updates := len(updateResponse)
+	updated := map[string]bool{}
+	for _, ext := range updateResponse {
+		updated[ext.ID] = true
+	}
+	// Dependencies the client only pinged for can be updated, in which case they aren't also acknowledged.
+	// Extensions over their budget are answered with noupdate.
+	acknowledgements := append(updateRequest.Acknowledgements(&catalog), acknowledged...)
+	for _, ack := range append(acknowledgements, overBudget...) {
+		if updated[ack.ID] {
+			continue
+		}
+		updated[ack.ID] = true
+		if max != 0 && len(updateResponse) >= max {
+			truncated = true
+			break
+		}
+		updateResponse = append(updateResponse, ack)
+	}
+	if truncated {
+		recordTruncated(r, protocol, max, requested)
+	}
+	return updateResponse, updates, hint
+}
+
+// writeJSON writes value as a JSON response with status
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, value interface{}) {
+	log := lg.Log(r.Context())
+	data, err := json.Marshal(value)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error in marshal XML %v", err), http.StatusInternalServerError)
+		captureRequestError(r, err)
+		http.Error(w, fmt.Sprintf("Error in marshal JSON %v", err), http.StatusInternalServerError)
 		return
 	}
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(status)
 	_, err = w.Write(data)
 	if err != nil {
 		log.Errorf("Error writing response: %v", err)
@@ -0,0 +1,250 @@
+package controller_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/brave-intl/bat-go/middleware"
+	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/controller/clocktest"
+	"github.com/brave/go-update/extension"
+	"github.com/brave/go-update/extension/extensiontest"
+	"github.com/brave/go-update/memstore"
+	"github.com/go-chi/chi"
+	"github.com/pressly/lg"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var newExtension1 = extension.Extension{
+	ID:          "newext1eplbcioakkpcpgfkobkghlhen",
+	Blacklisted: false,
+	SHA256:      "4c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618",
+	Title:       "test",
+	Version:     "1.0.0",
+}
+
+var newExtension2 = extension.Extension{
+	ID:          "newext2eplbcioakkpcpgfkobkghlhen",
+	Blacklisted: false,
+	SHA256:      "3c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618",
+	Title:       "test",
+	Version:     "1.0.0",
+}
+
+// handler serves the routers of the controller like the server does
+var handler http.Handler
+
+// handlerOptions are the options the routers of handler were given, with its catalog
+var handlerOptions *controller.Options
+
+// testClock is the clock of handler, which only moves when a test advances it
+var testClock *clocktest.Clock
+var crxDirectory string
+
+func init() {
+	// The shared AWS configs resolve their credentials when they are loaded, so every test uses these
+	os.Setenv("AWS_ACCESS_KEY_ID", "test")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+
+	offered := extension.LoadExtensionsIntoMap(&extension.OfferedExtensions)
+	controller.SetCatalog(offered)
+	controller.ExtensionStore = memstore.New(nil)
+	var err error
+	crxDirectory, err = ioutil.TempDir("", "go-update-crx")
+	if err != nil {
+		panic(err)
+	}
+	middleware.TokenList = []string{"test-token"}
+	testClock = clocktest.New(time.Now())
+	controller.DefaultClock = testClock
+	controller.ExtensionUpdaterTimeout = time.Minute
+	handlerOptions = &controller.Options{
+		Store:           controller.NewValidatingStore(memstore.New(nil)),
+		RefreshInterval: time.Minute,
+		Clock:           testClock,
+		Audit:           &controller.MemoryAuditLog{},
+		CRXDirectory:    crxDirectory,
+	}
+	handler = newTestHandler(handlerOptions)
+	handlerOptions.SetCatalog(offered)
+}
+
+// newTestHandler mounts the routers given opts where the server does, choosing tenants by hostname,
+// with a logger in the context of each request
+func newTestHandler(opts *controller.Options) http.Handler {
+	r := chi.NewRouter()
+	r.Use(controller.ServeWith(opts))
+	r.Use(controller.TenantFromHost)
+	r.Mount("/extensions", controller.ExtensionsRouter(extension.OfferedExtensions, opts))
+	r.Mount("/t/{tenant}", controller.TenantRouter(opts))
+	r.Mount("/crx", controller.CRXRouter(opts))
+	r.Mount("/api/v1", controller.APIRouter(controller.APIVersion1, opts))
+	r.Mount("/api/v2", controller.APIRouter(controller.APIVersion2, opts))
+	r.With(controller.Deprecated("/api/", "/api/v1/")).Mount("/api/admin", controller.AdminRouter(opts))
+	r.With(controller.Deprecated("/api/", "/api/v1/")).Mount("/api/stats", controller.StatsRouter(opts))
+	r.Get("/openapi.json", controller.GetOpenAPI)
+	r.Mount("/policy", controller.PolicyRouter(opts))
+	r.Get("/keys", controller.GetSigningKeys)
+	r.Mount("/tuf", controller.TUFRouter(opts))
+	r.Mount("/transparency", controller.TransparencyRouter(opts))
+	r.Get("/readyz", controller.Readiness)
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.ServeHTTP(w, req.WithContext(lg.WithLoggerContext(req.Context(), logger)))
+	})
+}
+
+func testCall(t *testing.T, server *httptest.Server, method string, query string,
+	requestBody string, expectedResponseCode int, expectedResponse string, redirectLocation string) {
+	extensionsURL := fmt.Sprintf("%s/extensions%s", server.URL, query)
+	req, err := http.NewRequest(method, extensionsURL, bytes.NewBuffer([]byte(requestBody)))
+	assert.Nil(t, err)
+	req.Header.Add("Content-Type", "application/xml")
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := client.Do(req)
+	assert.Nil(t, err)
+
+	assert.Equal(t, expectedResponseCode, resp.StatusCode)
+	if resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		location := resp.Header.Get("Location")
+		assert.Equal(t, redirectLocation, location)
+	}
+
+	actual, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+
+	assert.Equal(t, expectedResponse, strings.TrimSpace(string(actual)))
+}
+
+func getQueryParams(extension *extension.Extension) string {
+	return `x=id%3D` + extension.ID + `%26v%3D` + extension.Version
+}
+
+func TestFrozenCatalog(t *testing.T) {
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	adminRequest := func(method string, path string) *http.Response {
+		req, err := http.NewRequest(method, server.URL+path, nil)
+		assert.Nil(t, err)
+		req.Header.Set("Authorization", "Bearer test-token")
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		return resp
+	}
+
+	// The exported catalog can be pinned in a manifest
+	resp := adminRequest(http.MethodGet, "/api/admin/catalog")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	data, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	dir, err := ioutil.TempDir("", "go-update-manifest")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "catalog.json")
+	assert.Nil(t, ioutil.WriteFile(path, data, 0644))
+
+	store := controller.ManifestStore{Path: path}
+	extensions, err := store.LoadExtensions(context.Background())
+	assert.Nil(t, err)
+	ext, ok := extension.LoadExtensionsIntoMap(&extensions)["ldimlcelhnjgpjjemdjokpgeeikdinbm"]
+	assert.True(t, ok)
+	assert.Equal(t, handlerOptions.CurrentCatalog().Map()["ldimlcelhnjgpjjemdjokpgeeikdinbm"], ext)
+	assert.NotNil(t, store.SaveExtension(context.Background(), ext))
+
+	// and served frozen
+	server = httptest.NewServer(newTestHandler(&controller.Options{Store: store, Clock: testClock, FrozenCatalog: true}))
+	defer server.Close()
+	resp = adminRequest(http.MethodPut, "/api/admin/extensions/ldimlcelhnjgpjjemdjokpgeeikdinbm/versions/9.9.9")
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func TestUpdateHandlers(t *testing.T) {
+	ext := extension.Extension{
+		ID:      "hkgkpgldcfgbgnhjdokckbpbenejbkhd",
+		SHA256:  "ac714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618",
+		Title:   "static",
+		Version: "3.0.0",
+	}
+	catalog := controller.NewStaticCatalog(memstore.New(nil), extension.Extensions{ext})
+	updates := controller.NewUpdateHandler(catalog, controller.ServerSettings(nil))
+	updates.Logger = logrus.New()
+	webStore := controller.NewWebStoreHandler(catalog, controller.ServerSettings(nil))
+	webStore.Logger = updates.Logger
+
+	// The handlers only see the catalog they are given
+	req := httptest.NewRequest(http.MethodPost, "/extensions", bytes.NewBufferString(extensiontest.ExtensionRequestFnFor(ext.ID)("1.0.0")))
+	rr := httptest.NewRecorder()
+	updates.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	extensiontest.AssertUpdateOffered(t, rr.Body.String(), ext.ID, "3.0.0", ext.SHA256)
+
+	req = httptest.NewRequest(http.MethodGet, "/extensions?x="+url.QueryEscape("id="+ext.ID+"&v=1.0.0"), nil)
+	rr = httptest.NewRecorder()
+	webStore.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	extensiontest.AssertUpdateOffered(t, rr.Body.String(), ext.ID, "3.0.0", ext.SHA256)
+
+	// Saved extensions are served straight away
+	newer := ext
+	newer.Version = "4.0.0"
+	catalog.Save(req, newer)
+	rr = httptest.NewRecorder()
+	webStore.ServeHTTP(rr, req)
+	extensiontest.AssertUpdateOffered(t, rr.Body.String(), ext.ID, "4.0.0", ext.SHA256)
+
+	// Extensions of the server's catalog aren't
+	req = httptest.NewRequest(http.MethodPost, "/extensions", bytes.NewBufferString(extensiontest.ExtensionRequestFnFor("ldimlcelhnjgpjjemdjokpgeeikdinbm")("0.0.0")))
+	rr = httptest.NewRecorder()
+	updates.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusTemporaryRedirect, rr.Code)
+}
+
+func TestRedirectMarker(t *testing.T) {
+	defer handlerOptions.UpdateSettings(func(settings *controller.Settings) {
+		settings.RedirectMarker = "braveRedirect=true"
+	})
+	redirect := func(method string, target string) string {
+		var body io.Reader
+		if method == http.MethodPost {
+			body = strings.NewReader(extensiontest.ExtensionRequestFnFor("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")("0.0.0"))
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(method, target, body))
+		assert.Equal(t, http.StatusTemporaryRedirect, rr.Code)
+		return rr.Header().Get("Location")
+	}
+	webStoreQuery := "x=" + url.QueryEscape("id=aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa&v=0.0.0")
+
+	handlerOptions.UpdateSettings(func(settings *controller.Settings) {
+		settings.RedirectMarker = "fork=1"
+	})
+	assert.Equal(t, "https://update.googleapis.com/service/update2?fork=1", redirect(http.MethodPost, "/extensions"))
+	assert.Equal(t, "https://update.googleapis.com/service/update2?test=hi&fork=1", redirect(http.MethodPost, "/extensions?test=hi"))
+	assert.Equal(t, "https://clients2.google.com/service/update2/crx?"+webStoreQuery+"&fork=1", redirect(http.MethodGet, "/extensions?"+webStoreQuery))
+
+	// Without a marker, requests are redirected with only their own query
+	handlerOptions.UpdateSettings(func(settings *controller.Settings) {
+		settings.RedirectMarker = ""
+	})
+	assert.Equal(t, "https://update.googleapis.com/service/update2", redirect(http.MethodPost, "/extensions"))
+	assert.Equal(t, "https://update.googleapis.com/service/update2?test=hi", redirect(http.MethodPost, "/extensions?test=hi"))
+	assert.Equal(t, "https://clients2.google.com/service/update2/crx?"+webStoreQuery, redirect(http.MethodGet, "/extensions?"+webStoreQuery))
+}
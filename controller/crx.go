@@ -0,0 +1,202 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/brave/go-update/extension"
+	"github.com/go-chi/chi"
+	"github.com/pressly/lg"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+)
+
+// CRXCacheControl is the Cache-Control header sent with payloads.
+// A given extension version never changes contents so it can be cached for a long time.
+var CRXCacheControl = "public, max-age=31536000, immutable"
+
+var versionRegexp = regexp.MustCompile(`^[0-9]+(\.[0-9]+)*$`)
+
+// CRXProxyEnabled returns true if payloads should be served through the routers given opts.
+func (opts *Options) CRXProxyEnabled() bool {
+	return len(opts.crxDirectory()) != 0 || (opts != nil && len(opts.CRXBucket) != 0)
+}
+
+func (opts *Options) crxDirectory() string {
+	if opts == nil {
+		return ""
+	}
+	return opts.CRXDirectory
+}
+
+// CRXRouter is the router for /crx endpoints which serve the extension payloads themselves
+func CRXRouter(opts *Options) chi.Router {
+	r := chi.NewRouter()
+	r.Use(ServeWith(opts))
+	r.Get("/{id}/{version}", ServeCRX)
+	return r
+}
+
+// getPackageKey returns the key of the package of an extension version in the release bucket layout
+func getPackageKey(ext extension.Extension) string {
+	return "release/" + ext.ID + "/" + extension.GetPackageName(ext)
+}
+
+// ServeCRX is the handler for downloading a CRX payload, or the package of an app.
+// Only extensions that we know about are served, so this can't be used as an open proxy to the bucket.
+func ServeCRX(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	version := chi.URLParam(r, "version")
+	ext, ok := snapshotFor(r.Context()).Lookup(id)
+	if !ok || !versionRegexp.MatchString(version) {
+		http.NotFound(w, r)
+		return
+	}
+	ext.Version = version
+
+	// Resumed downloads and HEAD requests aren't counted
+	if len(r.Header.Get("Range")) == 0 && r.Method != http.MethodHead {
+		optionsFor(r.Context()).recordDownload(id, version)
+	}
+	key := getPackageKey(ext)
+	if ext.IsApp() {
+		w.Header().Set("content-type", "application/octet-stream")
+	} else {
+		w.Header().Set("content-type", "application/x-chrome-extension")
+	}
+	if len(optionsFor(r.Context()).crxDirectory()) != 0 {
+		serveCRXFromDirectory(w, r, key)
+		return
+	}
+	serveCRXFromS3(w, r, key)
+}
+
+func serveCRXFromDirectory(w http.ResponseWriter, r *http.Request, key string) {
+	log := lg.Log(r.Context())
+	f, err := os.Open(filepath.Join(optionsFor(r.Context()).crxDirectory(), filepath.FromSlash(key)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.NotFound(w, r)
+			return
+		}
+		captureRequestError(r, err)
+		http.Error(w, fmt.Sprintf("Error opening payload: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		err := f.Close()
+		if err != nil {
+			log.Errorf("Error closing payload: %v", err)
+		}
+	}()
+	info, err := f.Stat()
+	if err != nil {
+		captureRequestError(r, err)
+		http.Error(w, fmt.Sprintf("Error reading payload: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("cache-control", CRXCacheControl)
+	// An ETag lets ServeContent evaluate If-Range and If-None-Match in addition to the modification time
+	w.Header().Set("etag", fmt.Sprintf(`"%x-%x"`, info.ModTime().Unix(), info.Size()))
+	// ServeContent takes care of Range, If-Range and Content-Length for us
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+func serveCRXFromS3(w http.ResponseWriter, r *http.Request, key string) {
+	log := lg.Log(r.Context())
+	cfg, err := newAWSConfig(r.Context())
+	if err != nil {
+		captureRequestError(r, err)
+		http.Error(w, fmt.Sprintf("Error connecting to S3: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	rangeHeader := r.Header.Get("Range")
+	ifRange := r.Header.Get("If-Range")
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(optionsFor(r.Context()).CRXBucket),
+		Key:    aws.String(key),
+	}
+	if len(rangeHeader) != 0 {
+		input.Range = aws.String(rangeHeader)
+		// S3 has no If-Range, so make the ranged request conditional instead and
+		// fall back to the full payload below if the object has changed.
+		if len(ifRange) != 0 {
+			if t, err := http.ParseTime(ifRange); err == nil {
+				input.IfUnmodifiedSince = aws.Time(t)
+			} else {
+				input.IfMatch = aws.String(ifRange)
+			}
+		}
+	}
+	if ifNoneMatch := r.Header.Get("If-None-Match"); len(ifNoneMatch) != 0 {
+		input.IfNoneMatch = aws.String(ifNoneMatch)
+	}
+	svc := newS3Client(cfg)
+	result, err := svc.GetObject(r.Context(), input)
+	if isS3Status(err, http.StatusPreconditionFailed) && len(ifRange) != 0 {
+		input.Range = nil
+		input.IfMatch = nil
+		input.IfUnmodifiedSince = nil
+		result, err = svc.GetObject(r.Context(), input)
+	}
+	if err != nil {
+		switch {
+		case isS3Status(err, http.StatusNotFound):
+			http.NotFound(w, r)
+		case isS3Status(err, http.StatusNotModified):
+			w.Header().Set("cache-control", CRXCacheControl)
+			w.WriteHeader(http.StatusNotModified)
+		case isS3Status(err, http.StatusRequestedRangeNotSatisfiable):
+			http.Error(w, http.StatusText(http.StatusRequestedRangeNotSatisfiable), http.StatusRequestedRangeNotSatisfiable)
+		default:
+			captureRequestError(r, err)
+			http.Error(w, fmt.Sprintf("Error fetching payload: %v", err), http.StatusBadGateway)
+		}
+		return
+	}
+	defer func() {
+		err := result.Body.Close()
+		if err != nil {
+			log.Errorf("Error closing payload stream: %v", err)
+		}
+	}()
+
+	w.Header().Set("cache-control", CRXCacheControl)
+	w.Header().Set("accept-ranges", "bytes")
+	if result.ContentLength != nil {
+		w.Header().Set("content-length", strconv.FormatInt(*result.ContentLength, 10))
+	}
+	if result.ETag != nil {
+		w.Header().Set("etag", *result.ETag)
+	}
+	if result.LastModified != nil {
+		w.Header().Set("last-modified", result.LastModified.UTC().Format(http.TimeFormat))
+	}
+	status := http.StatusOK
+	if result.ContentRange != nil {
+		w.Header().Set("content-range", *result.ContentRange)
+		status = http.StatusPartialContent
+	}
+	w.WriteHeader(status)
+	if r.Method == http.MethodHead {
+		return
+	}
+	_, err = io.Copy(w, result.Body)
+	if err != nil {
+		log.Errorf("Error writing payload: %v", err)
+	}
+}
+
+// isS3Status returns true if err is an S3 request failure with the specified HTTP status code
+func isS3Status(err error, statusCode int) bool {
+	var responseError *smithyhttp.ResponseError
+	return errors.As(err, &responseError) && responseError.HTTPStatusCode() == statusCode
+}
@@ -0,0 +1,81 @@
+package controller_test
+
+import (
+	"fmt"
+	"github.com/brave/go-update/controller"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestServeCRX(t *testing.T) {
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	id := "ldimlcelhnjgpjjemdjokpgeeikdinbm"
+	payload := []byte("Cr24 totally a real extension")
+	dir := filepath.Join(crxDirectory, "release", id)
+	assert.Nil(t, os.MkdirAll(dir, 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "extension_1_0_0.crx"), payload, 0644))
+
+	// Full download
+	resp, err := http.Get(fmt.Sprintf("%s/crx/%s/1.0.0", server.URL, id))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/x-chrome-extension", resp.Header.Get("Content-Type"))
+	assert.Equal(t, controller.CRXCacheControl, resp.Header.Get("Cache-Control"))
+	actual, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, payload, actual)
+
+	// Partial download
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/crx/%s/1.0.0", server.URL, id), nil)
+	assert.Nil(t, err)
+	req.Header.Set("Range", "bytes=5-")
+	resp, err = http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	actual, err = ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, payload[5:], actual)
+	assert.Equal(t, fmt.Sprintf("%d", len(payload)-5), resp.Header.Get("Content-Length"))
+	etag := resp.Header.Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	// Resuming a download of the same payload only gets the remainder
+	req.Header.Set("If-Range", etag)
+	resp, err = http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	actual, err = ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, payload[5:], actual)
+
+	// Resuming a download of a payload that changed gets the whole thing
+	req.Header.Set("If-Range", `"stale"`)
+	resp, err = http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	actual, err = ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, payload, actual)
+
+	// Missing version of a known extension
+	resp, err = http.Get(fmt.Sprintf("%s/crx/%s/2.0.0", server.URL, id))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// Unknown extensions are not served
+	resp, err = http.Get(fmt.Sprintf("%s/crx/aaaaaaaaaaaaaaaaaaaa/1.0.0", server.URL))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// Versions can't be used to escape the payload directory
+	resp, err = http.Get(fmt.Sprintf("%s/crx/%s/..%%2F..", server.URL, id))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
@@ -0,0 +1,180 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"github.com/brave/go-update/extension"
+	"github.com/pressly/lg"
+	"github.com/prometheus/client_golang/prometheus"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// dedupMaxEntries is the most responses kept at once, so a flood of unique requests can't exhaust memory
+const dedupMaxEntries = 100000
+
+// dedupHeaders are the headers of a response which are replayed with it
+var dedupHeaders = []string{"Content-Type", "X-Retry-After"}
+
+// dedupEntry is a response kept for retries of the request whose body hashed to bodyHash
+type dedupEntry struct {
+	bodyHash [sha256.Size]byte
+	header   http.Header
+	data     []byte
+}
+
+// retryEntry counts the requests with a body hash seen since first
+type retryEntry struct {
+	first time.Time
+	count int
+}
+
+// requestCaches are the responses kept for retries of the update checks served with one Options,
+// and the body hashes of those checks
+type requestCaches struct {
+	once      sync.Once
+	responses *expiringCache
+	bodies    *expiringCache
+}
+
+// caches returns the request caches of opts, creating them the first time
+func (opts *Options) caches() *requestCaches {
+	caches := &opts.requestCaches
+	caches.once.Do(func() {
+		caches.responses = newExpiringCache(dedupMaxEntries)
+		caches.bodies = newExpiringCache(dedupMaxEntries)
+	})
+	return caches
+}
+
+var checksDeduplicated = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "update_checks_deduplicated_total",
+	Help: "Number of retried update checks answered with the response to the original request.",
+})
+
+var retriesDetected = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "update_check_retries_total",
+	Help: "Number of update checks with the same body as another check within the retry window.",
+})
+
+func init() {
+	prometheus.MustRegister(checksDeduplicated, retriesDetected)
+}
+
+// bodyHash returns a fast hash of a request body, which isn't meant to resist collisions but to find identical requests in logs
+func bodyHash(body []byte) string {
+	hash := fnv.New64a()
+	_, _ = hash.Write(body)
+	return strconv.FormatUint(hash.Sum64(), 16)
+}
+
+// logBodyHash adds the hash of an update check body to its request log entry and, with a RetryWindow,
+// how many identical checks were received before it within the window
+func logBodyHash(r *http.Request, body []byte) {
+	hash := bodyHash(body)
+	lg.SetEntryField(r.Context(), "body_hash", hash)
+	opts := optionsFor(r.Context())
+	window := opts.settings().RetryWindow
+	if window <= 0 {
+		return
+	}
+	if tenant := requestTenant(r); tenant != nil {
+		hash = tenant.Name + "\x00" + hash
+	}
+	now := time.Now()
+	bodies := opts.caches().bodies
+	bodies.mutex.Lock()
+	entry := retryEntry{first: now}
+	if cached, ok := bodies.get(hash, now); ok {
+		entry = cached.(retryEntry)
+	}
+	retries := entry.count
+	entry.count++
+	bodies.set(hash, entry, entry.first.Add(window), now)
+	bodies.mutex.Unlock()
+	if retries != 0 {
+		retriesDetected.Inc()
+		lg.SetEntryField(r.Context(), "retries", retries)
+	}
+}
+
+// getDedupKey returns the cache key of an update check, or an empty string if it can't be deduplicated.
+// Requests for different tenants are kept apart in case their clients share a requestid.
+func getDedupKey(r *http.Request, body []byte) string {
+	if optionsFor(r.Context()).settings().DedupTTL <= 0 {
+		return ""
+	}
+	requestID := parseRequestID(r, body)
+	if len(requestID) == 0 {
+		return ""
+	}
+	if tenant := requestTenant(r); tenant != nil {
+		return tenant.Name + "\x00" + requestID
+	}
+	return requestID
+}
+
+// parseRequestID returns the requestid of an XML or protocol 4 update check
+func parseRequestID(r *http.Request, body []byte) string {
+	if isProtocol4Request(r, body) {
+		envelope := struct {
+			Request struct {
+				RequestID string `json:"requestid"`
+			} `json:"request"`
+		}{}
+		if json.Unmarshal(body, &envelope) != nil {
+			return ""
+		}
+		return envelope.Request.RequestID
+	}
+	requestID, _ := extension.ParseRequestID(body)
+	return requestID
+}
+
+// writeDuplicateResponse answers a retried update check r with the response to the original request
+// and returns true, or returns false if there is none.
+// A different body with the same requestid isn't a retry, so it is answered normally.
+func writeDuplicateResponse(w http.ResponseWriter, r *http.Request, key string, body []byte) bool {
+	if len(key) == 0 {
+		return false
+	}
+	responses := optionsFor(r.Context()).caches().responses
+	responses.mutex.Lock()
+	cached, ok := responses.get(key, time.Now())
+	responses.mutex.Unlock()
+	if !ok || cached.(dedupEntry).bodyHash != sha256.Sum256(body) {
+		return false
+	}
+	entry := cached.(dedupEntry)
+	checksDeduplicated.Inc()
+	for name, values := range entry.header {
+		w.Header()[name] = append([]string(nil), values...)
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(entry.data)
+	return true
+}
+
+// rememberResponse keeps a copy of the response to the update check r and those of its headers which are replayed
+// for DedupTTL, since data is in a reused buffer
+func rememberResponse(r *http.Request, key string, body []byte, header http.Header, data []byte) {
+	if len(key) == 0 {
+		return
+	}
+	opts := optionsFor(r.Context())
+	ttl := opts.settings().DedupTTL
+	entry := dedupEntry{bodyHash: sha256.Sum256(body), header: http.Header{}, data: append([]byte(nil), data...)}
+	for _, name := range dedupHeaders {
+		if values := header.Values(name); len(values) != 0 {
+			entry.header[http.CanonicalHeaderKey(name)] = append([]string(nil), values...)
+		}
+	}
+	now := time.Now()
+	responses := opts.caches().responses
+	responses.mutex.Lock()
+	responses.set(key, entry, now.Add(ttl), now)
+	responses.mutex.Unlock()
+}
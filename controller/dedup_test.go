@@ -0,0 +1,134 @@
+package controller_test
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/extension/extensiontest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestDedup(t *testing.T) {
+	handlerOptions.UpdateSettings(func(settings *controller.Settings) {
+		settings.DedupTTL = time.Minute
+	})
+	defer handlerOptions.UpdateSettings(func(settings *controller.Settings) {
+		settings.DedupTTL = 0
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	id := "bfdgpgibhagkpdlnjonhkabjoijopoge"
+	updatesServed := func() int64 {
+		total := int64(0)
+		for _, stats := range handlerOptions.GetExtensionStatsSnapshot() {
+			if stats.ID == id {
+				total += stats.UpdatesServed
+			}
+		}
+		return total
+	}
+	check := func(contentType string, requestBody string) string {
+		resp, err := http.Post(server.URL+"/extensions", contentType, bytes.NewBufferString(requestBody))
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, contentType, resp.Header.Get("Content-Type"))
+		actual, err := ioutil.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		return string(actual)
+	}
+
+	// Retries get the same response without counting the update again
+	before := updatesServed()
+	requestBody := strings.Replace(extensiontest.ExtensionRequestFnFor(id)("0.0.0"), "b4f77b70", "d3d0e7a1", 1)
+	first := check("application/xml", requestBody)
+	assert.Equal(t, first, check("application/xml", requestBody))
+	assert.Equal(t, before+1, updatesServed())
+
+	// A different request reusing the requestid isn't a retry
+	check("application/xml", strings.Replace(requestBody, `version="0.0.0"`, `version="0.0.1"`, 1))
+	assert.Equal(t, before+2, updatesServed())
+
+	requestBody = `{"request":{"protocol":"4.0","requestid":"{d3d0e7a1-0000-4000-8000-000000000000}","apps":[
+		{"appid":"` + id + `","version":"0.0.0","updatecheck":{}},
+		{"appid":"ldimlcelhnjgpjjemdjokpgeeikdinbm","version":"0.0.0","updatecheck":{}}
+	]}}`
+	first = check("application/json", requestBody)
+	assert.Equal(t, first, check("application/json", requestBody))
+	assert.Equal(t, before+3, updatesServed())
+
+	// Requests without a requestid are always answered
+	requestBody = strings.Replace(requestBody, `"requestid":"{d3d0e7a1-0000-4000-8000-000000000000}",`, "", 1)
+	check("application/json", requestBody)
+	check("application/json", requestBody)
+	assert.Equal(t, before+5, updatesServed())
+
+	// Headers like when to check again are replayed along with the response
+	start := testClock.Now().In(time.UTC).Add(2 * time.Hour)
+	window := fmt.Sprintf(`{"start":%q,"end":%q,"timeZone":"UTC"}`, start.Format("15:04"), start.Add(time.Hour).Format("15:04"))
+	req, err := http.NewRequest(http.MethodPut, server.URL+"/api/admin/serving-windows/"+id, bytes.NewBufferString(window))
+	assert.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test-token")
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	defer func() {
+		req, _ := http.NewRequest(http.MethodDelete, server.URL+"/api/admin/serving-windows/"+id, nil)
+		req.Header.Set("Authorization", "Bearer test-token")
+		_, _ = http.DefaultClient.Do(req)
+	}()
+	retryAfter := func(requestBody string) string {
+		resp, err := http.Post(server.URL+"/extensions", "application/xml", bytes.NewBufferString(requestBody))
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		return resp.Header.Get("X-Retry-After")
+	}
+	requestBody = strings.Replace(extensiontest.ExtensionRequestFnFor(id)("0.0.0"), "b4f77b70", "d3d0e7a2", 1)
+	first = retryAfter(requestBody)
+	assert.NotEmpty(t, first)
+	assert.Equal(t, first, retryAfter(requestBody))
+	assert.Equal(t, before+5, updatesServed())
+}
+
+func TestRetryDetection(t *testing.T) {
+	handlerOptions.UpdateSettings(func(settings *controller.Settings) {
+		settings.RetryWindow = time.Minute
+	})
+	defer handlerOptions.UpdateSettings(func(settings *controller.Settings) {
+		settings.RetryWindow = 0
+	})
+	retries := func() float64 {
+		families, err := prometheus.DefaultGatherer.Gather()
+		assert.Nil(t, err)
+		for _, family := range families {
+			if family.GetName() == "update_check_retries_total" {
+				return family.GetMetric()[0].GetCounter().GetValue()
+			}
+		}
+		return 0
+	}
+	check := func(requestBody string) {
+		req, err := http.NewRequest(http.MethodPost, "/extensions", bytes.NewBufferString(requestBody))
+		assert.Nil(t, err)
+		req.Header.Set("Content-Type", "application/xml")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	}
+
+	// Identical bodies within the window are counted as retries, different ones aren't
+	before := retries()
+	requestBody := strings.Replace(extensiontest.ExtensionRequestFnFor("ldimlcelhnjgpjjemdjokpgeeikdinbm")("0.0.0"), "b4f77b70", "0e1f2a3b", 1)
+	check(requestBody)
+	check(requestBody)
+	check(requestBody)
+	assert.Equal(t, before+2, retries())
+	check(strings.Replace(requestBody, "0e1f2a3b", "0e1f2a3c", 1))
+	assert.Equal(t, before+2, retries())
+}
@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/brave/go-update/extension"
+	"net/http"
+	"time"
+)
+
+// Download preferences, which are the class of download URL listed first in update responses
+const (
+	// DownloadPreferenceCacheable lists the codebase or CDN mirror URL first, which proxies can cache
+	DownloadPreferenceCacheable = "cacheable"
+	// DownloadPreferenceSigned lists the presigned URL from the SignedURLBucket of the Options first
+	DownloadPreferenceSigned = "signed"
+)
+
+// clockPresigner signs URLs at the time of the clock of the request's Options, since they expire relative to it
+type clockPresigner struct {
+	signer *v4.Signer
+}
+
+func (presigner clockPresigner) PresignHTTP(
+	ctx context.Context, credentials aws.Credentials, r *http.Request, payloadHash string, service string, region string,
+	signingTime time.Time, optFns ...func(*v4.SignerOptions),
+) (string, http.Header, error) {
+	return presigner.signer.PresignHTTP(ctx, credentials, r, payloadHash, service, region, optionsFor(ctx).clock().Now(), optFns...)
+}
+
+// presignCRXURL returns a presigned URL for the package of an extension version in bucket
+func presignCRXURL(ctx context.Context, bucket string, ext extension.Extension, expiry time.Duration) (string, error) {
+	cfg, err := newAWSConfig(ctx)
+	if err != nil {
+		return "", err
+	}
+	presigned, err := s3.NewPresignClient(newS3Client(cfg), func(options *s3.PresignOptions) {
+		options.Expires = expiry
+		options.Presigner = clockPresigner{v4.NewSigner()}
+	}).PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(getPackageKey(ext)),
+	})
+	if err != nil {
+		return "", err
+	}
+	return presigned.URL, nil
+}
+
+// orderDownloadURLs lists the cacheable and signed download URLs of each extension
+// in the order preferred by the deployment and the client's dlpref.
+// It must run after selectMirrors, since the cacheable URL can be a mirror.
+func orderDownloadURLs(ctx context.Context, extensions []extension.Extension) {
+	opts := optionsFor(ctx)
+	if opts == nil || len(opts.SignedURLBucket) == 0 {
+		return
+	}
+	settings := opts.settings()
+	for i := range extensions {
+		cacheable := extensions[i].GetURL()
+		signed, err := presignCRXURL(ctx, opts.SignedURLBucket, extensions[i], settings.SignedURLExpiry)
+		if err != nil {
+			continue
+		}
+		if settings.DownloadPreference == DownloadPreferenceCacheable || extensions[i].DownloadPreference == DownloadPreferenceCacheable {
+			extensions[i].URLs = []string{cacheable, signed}
+		} else {
+			extensions[i].URLs = []string{signed, cacheable}
+		}
+	}
+}
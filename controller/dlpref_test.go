@@ -0,0 +1,59 @@
+package controller_test
+
+import (
+	"bytes"
+	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/extension/extensiontest"
+	"github.com/brave/go-update/memstore"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestDownloadPreference(t *testing.T) {
+	opts := &controller.Options{Store: controller.NewValidatingStore(memstore.New(nil)), Clock: testClock, SignedURLBucket: "brave-core-ext-private"}
+	opts.SetCatalog(handlerOptions.CurrentCatalog().Map())
+	server := httptest.NewServer(newTestHandler(opts))
+	defer server.Close()
+
+	requestBody := extensiontest.ExtensionRequestFnFor("ldimlcelhnjgpjjemdjokpgeeikdinbm")("0.0.0")
+	codebaseRegexp := regexp.MustCompile(`codebase="([^"]+)"`)
+	getCodebases := func(requestBody string) []string {
+		resp, err := http.Post(server.URL+"/extensions", "application/xml", bytes.NewBufferString(requestBody))
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		actual, err := ioutil.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		codebases := []string{}
+		for _, match := range codebaseRegexp.FindAllStringSubmatch(string(actual), -1) {
+			codebases = append(codebases, match[1])
+		}
+		return codebases
+	}
+	cacheable := "https://brave-core-ext.s3.brave.com/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/extension_1_0_0.crx"
+	signedPrefix := "https://brave-core-ext-private.s3.us-east-2.amazonaws.com/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/extension_1_0_0.crx?"
+
+	// The cacheable URL is listed first by default
+	codebases := getCodebases(requestBody)
+	assert.Equal(t, 2, len(codebases))
+	assert.Equal(t, cacheable, codebases[0])
+	assert.True(t, strings.HasPrefix(codebases[1], signedPrefix), codebases[1])
+	assert.Contains(t, codebases[1], "X-Amz-Signature=")
+
+	// The deployment can prefer signed URLs, unless the client prefers cacheable ones
+	opts.UpdateSettings(func(settings *controller.Settings) {
+		settings.DownloadPreference = controller.DownloadPreferenceSigned
+	})
+	codebases = getCodebases(requestBody)
+	assert.Equal(t, 2, len(codebases))
+	assert.True(t, strings.HasPrefix(codebases[0], signedPrefix), codebases[0])
+	assert.Equal(t, cacheable, codebases[1])
+
+	codebases = getCodebases(strings.Replace(requestBody, "<request ", `<request dlpref="cacheable" `, 1))
+	assert.Equal(t, 2, len(codebases))
+	assert.Equal(t, cacheable, codebases[0])
+}
@@ -0,0 +1,26 @@
+package controller
+
+import (
+	"errors"
+	"github.com/brave/go-update/extension"
+	"net/http"
+)
+
+// ErrStoreUnavailable is returned by a BreakerStore while its breaker is open, without calling the store
+var ErrStoreUnavailable = errors.New("the store is unavailable")
+
+// errorStatus returns the status of the response to a request which failed with err
+func errorStatus(err error) int {
+	switch extension.Cause(err) {
+	case extension.ErrUnsupportedProtocol, extension.ErrMalformedRequest:
+		return http.StatusBadRequest
+	case extension.ErrUnknownApp:
+		return http.StatusNotFound
+	case ErrStoreUnavailable:
+		return http.StatusServiceUnavailable
+	}
+	if IsValidationError(err) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
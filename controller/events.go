@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"context"
+	"github.com/brave/go-update/extension"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// exportUpdateCheck exports the metadata, pings and events of an update check request body
+func exportUpdateCheck(ctx context.Context, body []byte) {
+	opts := optionsFor(ctx)
+	exporter, scrubber := opts.events(), opts.scrubber()
+	if exporter == nil {
+		return
+	}
+	event, err := extension.ParseUpdateCheckEvent(body)
+	if err != nil {
+		// The body was already parsed successfully as an update request
+		return
+	}
+	event.RequestID = scrubber.ID(event.RequestID)
+	event.SessionID = scrubber.ID(event.SessionID)
+	event.UserID = scrubber.ID(event.UserID)
+	exporter.Export(event.RequestID, event)
+}
+
+// exportWebStoreCheck exports the metadata of a GET update check, which only has the
+// IDs, versions and pings encoded in its x parameters
+func exportWebStoreCheck(ctx context.Context, query url.Values) {
+	exporter := optionsFor(ctx).events()
+	if exporter == nil {
+		return
+	}
+	event := extension.UpdateCheckEvent{
+		Time:        time.Now().UTC(),
+		ProdVersion: query.Get("prodversion"),
+		ProdChannel: query.Get("prodchannel"),
+		Lang:        query.Get("lang"),
+		OS:          query.Get("os"),
+		Arch:        query.Get("arch"),
+		Apps:        []extension.AppEvent{},
+	}
+	for _, x := range query["x"] {
+		values, err := url.ParseQuery(x)
+		if err != nil {
+			continue
+		}
+		app := extension.AppEvent{
+			AppID:          strings.Trim(values.Get("id"), "[]"),
+			Version:        values.Get("v"),
+			InstallSource:  values.Get("installsource"),
+			HasUpdateCheck: true,
+		}
+		if ping, err := url.ParseQuery(values.Get("ping")); err == nil && len(ping) != 0 {
+			app.Ping = &extension.Ping{RollCallAge: ping.Get("r"), ActiveAge: ping.Get("a")}
+		}
+		event.Apps = append(event.Apps, app)
+	}
+	exporter.Export("", event)
+}
@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// expiringCache holds up to max values by key until they expire. Its entries are listed in the order they expire,
+// which is the order they were added in while they all live equally long, so the expired ones and, once the cache
+// is full, the one expiring first are evicted without looking at the others.
+type expiringCache struct {
+	mutex   sync.Mutex
+	max     int
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+// expiringEntry is a value of an expiringCache and when it expires
+type expiringEntry struct {
+	key     string
+	value   interface{}
+	expires time.Time
+}
+
+func newExpiringCache(max int) *expiringCache {
+	return &expiringCache{max: max, entries: map[string]*list.Element{}, order: list.New()}
+}
+
+// get returns the value of key, unless it expired before now. The mutex must be held.
+func (cache *expiringCache) get(key string, now time.Time) (interface{}, bool) {
+	element, ok := cache.entries[key]
+	if !ok || now.After(element.Value.(*expiringEntry).expires) {
+		return nil, false
+	}
+	return element.Value.(*expiringEntry).value, true
+}
+
+// set keeps value under key until expires, evicting the entries which expired before now and,
+// if the cache is still full, the one expiring first. The mutex must be held.
+func (cache *expiringCache) set(key string, value interface{}, expires time.Time, now time.Time) {
+	if element, ok := cache.entries[key]; ok {
+		cache.order.Remove(element)
+		delete(cache.entries, key)
+	}
+	for front := cache.order.Front(); front != nil; front = cache.order.Front() {
+		entry := front.Value.(*expiringEntry)
+		if !now.After(entry.expires) && len(cache.entries) < cache.max {
+			break
+		}
+		cache.order.Remove(front)
+		delete(cache.entries, entry.key)
+	}
+	// Entries only expire before the ones added earlier when the time they are kept for was shortened
+	mark := cache.order.Back()
+	for mark != nil && mark.Value.(*expiringEntry).expires.After(expires) {
+		mark = mark.Prev()
+	}
+	entry := &expiringEntry{key: key, value: value, expires: expires}
+	if mark == nil {
+		cache.entries[key] = cache.order.PushFront(entry)
+	} else {
+		cache.entries[key] = cache.order.InsertAfter(entry, mark)
+	}
+}
@@ -0,0 +1,48 @@
+package controller
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestExpiringCache(t *testing.T) {
+	cache := newExpiringCache(3)
+	now := time.Date(2026, time.March, 2, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		cache.set(strconv.Itoa(i), i, now.Add(time.Duration(i+1)*time.Minute), now)
+	}
+	value, ok := cache.get("0", now)
+	assert.True(t, ok)
+	assert.Equal(t, 0, value)
+
+	// Once full, the entry expiring first makes room
+	cache.set("3", 3, now.Add(10*time.Minute), now)
+	_, ok = cache.get("0", now)
+	assert.False(t, ok)
+	assert.Len(t, cache.entries, 3)
+
+	// Expired entries are gone, and evicted before any other
+	later := now.Add(150 * time.Second)
+	_, ok = cache.get("1", later)
+	assert.False(t, ok)
+	cache.set("4", 4, later.Add(time.Minute), later)
+	assert.Len(t, cache.entries, 3)
+	for _, key := range []string{"2", "3", "4"} {
+		_, ok = cache.get(key, later)
+		assert.True(t, ok, key)
+	}
+
+	// Entries kept for less time than the ones before are still evicted in the order they expire
+	cache.set("5", 5, later.Add(time.Second), later)
+	_, ok = cache.get("2", later)
+	assert.False(t, ok)
+	cache.set("6", 6, later.Add(time.Hour), later)
+	_, ok = cache.get("5", later)
+	assert.False(t, ok)
+	for _, key := range []string{"3", "4", "6"} {
+		_, ok = cache.get(key, later)
+		assert.True(t, ok, key)
+	}
+}
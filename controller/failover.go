@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"context"
+	"github.com/brave/go-update/extension"
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+)
+
+var storeActiveRegion = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "store_active_region",
+	Help: "1 for the region which served the last successful store call, 0 for the others.",
+}, []string{"region"})
+
+func init() {
+	prometheus.MustRegister(storeActiveRegion)
+}
+
+// RegionStore is a store for a single region of a DynamoDB global table
+type RegionStore struct {
+	Region string
+	Store  Store
+}
+
+// FailoverStore tries each regional store in order until one succeeds,
+// so an outage in the primary region doesn't freeze the catalog.
+type FailoverStore struct {
+	regions []RegionStore
+}
+
+// NewFailoverStore creates a FailoverStore preferring regions in the order given
+func NewFailoverStore(regions ...RegionStore) *FailoverStore {
+	for _, region := range regions {
+		storeActiveRegion.WithLabelValues(region.Region).Set(0)
+	}
+	return &FailoverStore{regions: regions}
+}
+
+// LoadExtensions loads the catalog from the first region that answers
+func (store *FailoverStore) LoadExtensions(ctx context.Context) (extension.Extensions, error) {
+	var extensions extension.Extensions
+	err := store.failover(ctx, "load", func(region Store) error {
+		var err error
+		extensions, err = region.LoadExtensions(ctx)
+		return err
+	})
+	return extensions, err
+}
+
+// SaveExtension saves to the first region that answers and lets the global table replicate it
+func (store *FailoverStore) SaveExtension(ctx context.Context, ext extension.Extension) error {
+	return store.failover(ctx, "save", func(region Store) error {
+		return region.SaveExtension(ctx, ext)
+	})
+}
+
+// DeleteExtension deletes from the first region that answers like SaveExtension
+func (store *FailoverStore) DeleteExtension(ctx context.Context, id string) error {
+	return store.failover(ctx, "delete", func(region Store) error {
+		return region.DeleteExtension(ctx, id)
+	})
+}
+
+func (store *FailoverStore) failover(ctx context.Context, operation string, fn func(region Store) error) error {
+	var err error
+	for _, region := range store.regions {
+		err = fn(region.Store)
+		if err == nil {
+			for _, other := range store.regions {
+				storeActiveRegion.WithLabelValues(other.Region).Set(0)
+			}
+			storeActiveRegion.WithLabelValues(region.Region).Set(1)
+			return nil
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		log.Printf("%s failed in %s, trying the next region: %v\n", operation, region.Region, err)
+	}
+	return err
+}
@@ -0,0 +1,34 @@
+package controller_test
+
+import (
+	"context"
+	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/extension"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFailoverStore(t *testing.T) {
+	var primaryCalls int64
+	secondaryCalls := 0
+	store := controller.NewFailoverStore(
+		controller.RegionStore{Region: "us-east-1", Store: failingStore{&primaryCalls}},
+		controller.RegionStore{Region: "us-west-2", Store: flakyStore{&secondaryCalls, 0, nil}},
+	)
+	extensions, err := store.LoadExtensions(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, extension.Extensions{newExtension1}, extensions)
+	assert.Equal(t, int64(1), primaryCalls)
+	assert.Equal(t, 1, secondaryCalls)
+
+	assert.Nil(t, store.SaveExtension(context.Background(), newExtension1))
+	assert.Equal(t, int64(2), primaryCalls)
+	assert.Equal(t, 2, secondaryCalls)
+
+	// When every region fails the last error is returned
+	store = controller.NewFailoverStore(
+		controller.RegionStore{Region: "us-east-1", Store: failingStore{&primaryCalls}},
+	)
+	_, err = store.LoadExtensions(context.Background())
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,350 @@
+package controller
+
+import (
+	"context"
+	"github.com/brave/go-update/events"
+	"github.com/brave/go-update/extension"
+	"github.com/brave/go-update/privacy"
+	"github.com/brave/go-update/statsd"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options are the dependencies and state of the routers serving one handler, so a program can serve several handlers
+// with different stores, clocks, settings and exporters side by side. Fields which aren't set mean the feature is off
+// or takes its documented default. Only the default catalog of Options without a Store, and of a nil *Options,
+// is the package's one loaded from ExtensionStore.
+type Options struct {
+	// Store is where the default catalog is loaded from and uploads to it are saved. Options with a Store
+	// serve their own default catalog, while those without serve the package's one, loaded from ExtensionStore.
+	Store Store
+	// RefreshInterval is how often the catalogs are reloaded from their stores, ExtensionUpdaterTimeout if zero
+	RefreshInterval time.Duration
+	// Clock is the clock of catalog refreshes, scheduled versions, serving windows and presigned URLs
+	Clock Clock
+	// Settings are the settings the routers start with, DefaultSettings if nil. Once the routers are serving
+	// they must only be changed with UpdateSettings.
+	Settings *Settings
+	// Reload reloads the configuration when POST /api/admin/reload is called.
+	// It is nil when the routers weren't created from a configuration that can be reloaded.
+	Reload func() error
+	// Stats sends metrics to StatsD or the Datadog agent, none if nil
+	Stats *statsd.Client
+	// Events exports the metadata of every update check for analytics, none if nil
+	Events *events.Exporter
+	// Scrubber removes or hashes client identifiers before events are exported, leaving them unchanged if nil
+	Scrubber *privacy.Scrubber
+	// Audit is where changes made with the admin API are recorded, in memory until the server restarts if nil
+	Audit AuditLog
+	// OIDC verifies JWTs from single sign-on for the admin and stats APIs, which only accept tokens if it is nil
+	OIDC *OIDCVerifier
+	// Purger is told about every change to the catalogs once they were loaded, when it is set.
+	// Each instance purges the changes it sees, so a change found by a refresh is purged by every instance.
+	Purger CDNPurger
+	// ReleaseChannels are told about every upload to their tenant's catalog
+	ReleaseChannels []ReleaseChannel
+	// Responders answer update checks for extensions by ID before those registered with RegisterResponder
+	Responders map[string]Responder
+	// Tenants are served on /t/{name}/extensions and their hosts along with those registered with RegisterTenants
+	Tenants []*Tenant
+	// FrozenCatalog serves the catalogs loaded at startup and never refreshes or changes them,
+	// which is useful for reproducing incidents and for air-gapped deployments
+	FrozenCatalog bool
+	// ChaosMode lets faults be injected into update checks for chosen extensions with /api/admin/chaos, so the
+	// resilience of browser updaters can be tested against a real server. It must never be enabled in production.
+	ChaosMode bool
+	// CRXDirectory is a local directory to serve CRX payloads from on /crx/{id}/{version}, and to publish uploads to.
+	// Payloads are expected to use the same layout as the release bucket, for example release/{id}/extension_1_0_0.crx.
+	CRXDirectory string
+	// CRXBucket is the S3 bucket to proxy CRX payloads from on /crx/{id}/{version} when there is no CRXDirectory
+	CRXBucket string
+	// SignedURLBucket is the S3 bucket to presign download URLs for, using the release bucket layout.
+	// When it is set update responses list both the cacheable URL and a presigned URL for each extension.
+	SignedURLBucket string
+	// ReleaseBucket is the S3 bucket uploads are published to when there is no CRXDirectory, DefaultReleaseBucket if empty
+	ReleaseBucket string
+	// AWSRegion is the region of the buckets, DefaultAWSRegion if empty
+	AWSRegion string
+	// ServingWindowsFile is a JSON file the serving windows are loaded from by LoadServingWindows and saved to
+	// when they change. When it is empty changes made with the admin API only last until the server restarts.
+	ServingWindowsFile string
+	// ForceInstallFile is a JSON file the force install list is loaded from by LoadForceInstallList and saved to
+	// when it changes. When it is empty changes made with the admin API only last until the server restarts.
+	ForceInstallFile string
+	// PolicyUpdateURL is the update URL for force installed extensions which don't have their own.
+	// When it is empty the /extensions endpoint of the host the policy was requested from is used.
+	PolicyUpdateURL string
+	// TransparencyLogFile is a file of JSON lines the transparency log is loaded from by LoadTransparencyLog and appended to.
+	// When it is empty no log is kept and /transparency isn't served, since a log in memory would shrink when the
+	// server restarts, which auditors can't tell from tampering.
+	//
+	// The file has a single writer, so only one Options may log to it. Instances with their own files publish
+	// different trees, so deployments with several instances should log on one of them only.
+	TransparencyLogFile string
+
+	catalog         catalogHolder
+	started         sync.Once
+	settingsMutex   sync.RWMutex
+	budgets         updateBudgets
+	requestCaches   requestCaches
+	memoryAudit     MemoryAuditLog
+	chaosFaults     chaosFaults
+	windows         servingWindows
+	forceInstall    forceInstallList
+	transparency    transparencyLog
+	packageHealth   packageHealth
+	verifications   packageVerifications
+	linkCheckMutex  sync.Mutex
+	extensionCounts extensionCounts
+	canary          canaryResults
+}
+
+type optionsContextKey struct{}
+
+// WithOptionsContext returns ctx for a request or admin call served with opts
+func WithOptionsContext(ctx context.Context, opts *Options) context.Context {
+	if opts == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, optionsContextKey{}, opts)
+}
+
+// optionsFor returns the options a request or admin call is served with, nil for the package variables
+func optionsFor(ctx context.Context) *Options {
+	opts, _ := ctx.Value(optionsContextKey{}).(*Options)
+	return opts
+}
+
+// ServeWith serves requests with opts, unless they already have options from an outer router.
+// The routers taking Options use it, and it runs before them for middleware like TenantFromHost.
+func ServeWith(opts *Options) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if opts == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if optionsFor(r.Context()) == nil {
+				r = r.WithContext(WithOptionsContext(r.Context(), opts))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// start loads the default catalog and those of the tenants of opts and refreshes them every refresh interval,
+// unless the catalog is frozen. Options only start once, while nil options start another refresh of the package's
+// catalog every time.
+func (opts *Options) start() {
+	if opts == nil {
+		opts.startRefreshing()
+		return
+	}
+	opts.started.Do(opts.startRefreshing)
+}
+
+func (opts *Options) startRefreshing() {
+	if opts != nil {
+		opts.extensionCounts.mutex.Lock()
+		opts.extensionCounts.init()
+		opts.extensionCounts.mutex.Unlock()
+	}
+	holder := opts.defaultCatalog()
+	if opts != nil && opts.Store != nil {
+		holder.options = opts
+	}
+	servingCatalog(holder)
+	opts.refreshEvery(opts.refreshDefaultCatalog)
+	if opts == nil {
+		return
+	}
+	for _, tenant := range opts.Tenants {
+		tenant.extensions.tenant = tenant.Name
+		tenant.extensions.options = opts
+		servingCatalog(&tenant.extensions)
+		opts.refreshEvery(tenant.refresh)
+	}
+}
+
+// refreshEvery calls refresh now, and then every refresh interval unless the catalog is frozen
+func (opts *Options) refreshEvery(refresh func()) {
+	if opts.frozen() {
+		refresh()
+		return
+	}
+	refreshTicker(opts.clock(), opts.refreshInterval(), refresh)
+}
+
+// CurrentCatalog returns the current snapshot of the default catalog of opts
+func (opts *Options) CurrentCatalog() *CatalogSnapshot {
+	return opts.defaultCatalog().snapshot()
+}
+
+// SetCatalog replaces the default catalog of opts with extensions, which must not be changed afterwards
+func (opts *Options) SetCatalog(extensions map[string]extension.Extension) {
+	opts.defaultCatalog().replace(extensions)
+}
+
+// UpdateCatalog replaces the default catalog of opts with a copy changed by change
+func (opts *Options) UpdateCatalog(change func(extensions map[string]extension.Extension)) {
+	opts.defaultCatalog().update(change)
+}
+
+// defaultCatalog returns the catalog served to requests which aren't for a tenant
+func (opts *Options) defaultCatalog() *catalogHolder {
+	if opts == nil || opts.Store == nil {
+		return &defaultCatalog
+	}
+	return &opts.catalog
+}
+
+// store returns the store of the default catalog
+func (opts *Options) store() Store {
+	if opts == nil || opts.Store == nil {
+		return ExtensionStore
+	}
+	return opts.Store
+}
+
+func (opts *Options) clock() Clock {
+	if opts == nil {
+		return clockOr(nil)
+	}
+	return clockOr(opts.Clock)
+}
+
+func (opts *Options) refreshInterval() time.Duration {
+	if opts == nil || opts.RefreshInterval == 0 {
+		return ExtensionUpdaterTimeout
+	}
+	return opts.RefreshInterval
+}
+
+// frozen returns whether the catalogs served with opts must not change
+func (opts *Options) frozen() bool {
+	return opts != nil && opts.FrozenCatalog
+}
+
+func (opts *Options) releaseBucket() string {
+	if opts == nil || len(opts.ReleaseBucket) == 0 {
+		return DefaultReleaseBucket
+	}
+	return opts.ReleaseBucket
+}
+
+func (opts *Options) awsRegion() string {
+	if opts == nil || len(opts.AWSRegion) == 0 {
+		return DefaultAWSRegion
+	}
+	return opts.AWSRegion
+}
+
+func (opts *Options) stats() *statsd.Client {
+	if opts == nil {
+		return nil
+	}
+	return opts.Stats
+}
+
+func (opts *Options) events() *events.Exporter {
+	if opts == nil {
+		return nil
+	}
+	return opts.Events
+}
+
+func (opts *Options) scrubber() *privacy.Scrubber {
+	if opts == nil {
+		return nil
+	}
+	return opts.Scrubber
+}
+
+// audit returns the audit log of opts, which keeps its records in memory when it has no Audit.
+// Changes made without options aren't recorded.
+func (opts *Options) audit() AuditLog {
+	if opts == nil {
+		return &MemoryAuditLog{}
+	}
+	if opts.Audit == nil {
+		return &opts.memoryAudit
+	}
+	return opts.Audit
+}
+
+func (opts *Options) oidc() *OIDCVerifier {
+	if opts == nil {
+		return nil
+	}
+	return opts.OIDC
+}
+
+func (opts *Options) purger() CDNPurger {
+	if opts == nil {
+		return nil
+	}
+	return opts.Purger
+}
+
+func (opts *Options) releaseChannels() []ReleaseChannel {
+	if opts == nil {
+		return nil
+	}
+	return opts.ReleaseChannels
+}
+
+// responder returns the Responder of opts for the extension with id, or nil if it has none
+func (opts *Options) responder(id string) Responder {
+	if opts == nil {
+		return nil
+	}
+	return opts.Responders[id]
+}
+
+// fallbackURLs returns where requests for a single unknown extension which aren't for a tenant are redirected,
+// for GET and POST requests respectively
+func (opts *Options) fallbackURLs() (string, string) {
+	settings := opts.settings()
+	return settings.WebStoreFallbackURL, settings.ComponentUpdaterFallbackURL
+}
+
+// TenantNamed returns the tenant of opts called name, or the registered one if opts has none, or nil if there is none
+func (opts *Options) TenantNamed(name string) *Tenant {
+	if opts != nil {
+		for _, tenant := range opts.Tenants {
+			if tenant.Name == name {
+				return tenant
+			}
+		}
+	}
+	return TenantNamed(name)
+}
+
+// tenantForHost returns the tenant of opts serving host, or the registered one if opts has none, or nil if there is none
+func (opts *Options) tenantForHost(host string) *Tenant {
+	if opts != nil {
+		for _, tenant := range opts.Tenants {
+			for _, tenantHost := range tenant.Hosts {
+				if strings.EqualFold(tenantHost, host) {
+					return tenant
+				}
+			}
+		}
+	}
+	return tenantHosts[strings.ToLower(host)]
+}
+
+// tenants returns the tenants of opts and the registered ones by name
+func (opts *Options) tenants() map[string]*Tenant {
+	all := map[string]*Tenant{}
+	for name, tenant := range tenants {
+		all[name] = tenant
+	}
+	if opts != nil {
+		for _, tenant := range opts.Tenants {
+			all[tenant.Name] = tenant
+		}
+	}
+	return all
+}
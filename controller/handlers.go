@@ -0,0 +1,258 @@
+package controller
+
+import (
+	"github.com/brave/go-update/extension"
+	"github.com/pressly/lg"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"time"
+)
+
+// CatalogService is the catalog update checks are answered from
+type CatalogService interface {
+	// Catalog returns the catalog serving r by extension ID, which must not be changed
+	Catalog(r *http.Request) map[string]extension.Extension
+	// Store returns the store uploads for r are saved to
+	Store(r *http.Request) Store
+	// Save adds ext to the catalog serving r, after it was saved to the store
+	Save(r *http.Request, ext extension.Extension)
+}
+
+// tenantCatalogs serves each request from the catalog of its tenant, or the default catalog of options
+type tenantCatalogs struct {
+	options *Options
+}
+
+// ServerCatalogs returns the CatalogService of the routers given opts, which serves each request from the catalog
+// of its tenant, or the default catalog of opts. Nil opts serve the package's default catalog.
+func ServerCatalogs(opts *Options) CatalogService {
+	return tenantCatalogs{options: opts}
+}
+
+func (catalogs tenantCatalogs) holder(r *http.Request) *catalogHolder {
+	if tenant := requestTenant(r); tenant != nil {
+		return &tenant.extensions
+	}
+	return catalogs.options.defaultCatalog()
+}
+
+func (catalogs tenantCatalogs) Catalog(r *http.Request) map[string]extension.Extension {
+	return catalogs.holder(r).snapshot().Map()
+}
+
+func (catalogs tenantCatalogs) Snapshot(r *http.Request) *CatalogSnapshot {
+	return catalogs.holder(r).snapshot()
+}
+
+func (catalogs tenantCatalogs) Store(r *http.Request) Store {
+	if tenant := requestTenant(r); tenant != nil {
+		return tenant.Store
+	}
+	return catalogs.options.store()
+}
+
+func (catalogs tenantCatalogs) Save(r *http.Request, ext extension.Extension) {
+	catalogs.holder(r).update(func(catalog map[string]extension.Extension) {
+		catalog[ext.ID] = ext
+	})
+}
+
+// StaticCatalog is a CatalogService serving the same catalog for every request, which is never refreshed.
+// It suits tests and programs which manage the catalog themselves.
+type StaticCatalog struct {
+	store      Store
+	extensions catalogHolder
+}
+
+// NewStaticCatalog creates a StaticCatalog serving extensions, saving uploads to store
+func NewStaticCatalog(store Store, extensions extension.Extensions) *StaticCatalog {
+	catalog := &StaticCatalog{store: store, extensions: catalogHolder{tenant: "static", noPurge: true}}
+	catalog.extensions.replace(extension.LoadExtensionsIntoMap(&extensions))
+	return catalog
+}
+
+// Catalog returns the catalog, which is replaced rather than changed by Save
+func (catalog *StaticCatalog) Catalog(r *http.Request) map[string]extension.Extension {
+	return catalog.extensions.snapshot().Map()
+}
+
+// Snapshot returns the current snapshot of the catalog
+func (catalog *StaticCatalog) Snapshot(r *http.Request) *CatalogSnapshot {
+	return catalog.extensions.snapshot()
+}
+
+// Store returns the store uploads are saved to
+func (catalog *StaticCatalog) Store(r *http.Request) Store {
+	return catalog.store
+}
+
+// Save adds ext to a copy of the catalog
+func (catalog *StaticCatalog) Save(r *http.Request, ext extension.Extension) {
+	catalog.extensions.update(func(extensions map[string]extension.Extension) {
+		extensions[ext.ID] = ext
+	})
+}
+
+// ServingSettings decide how update checks are answered besides the catalog
+type ServingSettings interface {
+	// Responder returns the Responder answering checks in r for the extension with id, or nil to answer from the catalog
+	Responder(r *http.Request, id string) Responder
+	// UntilServingWindow returns how long it is from now until updates for the extension with id are offered,
+	// which is 0 when they are offered at now
+	UntilServingWindow(id string, now time.Time) time.Duration
+	// PackageMissing returns true if ext isn't offered because its package can't be downloaded
+	PackageMissing(ext extension.Extension) bool
+	// RedirectURLs returns where a check in r for only the extension with id is redirected, for GET and POST requests
+	// respectively, and false if it is answered here. known is true if the extension is in the catalog.
+	RedirectURLs(r *http.Request, id string, known bool) (string, string, bool)
+}
+
+// serverSettings are the settings of the routers given options
+type serverSettings struct {
+	options *Options
+}
+
+// ServerSettings returns the ServingSettings of the routers given opts: the responders of opts and the package,
+// the serving windows, missing packages and app overrides of the package, and the fallback URLs of the request's
+// tenant, opts or the package. Nil opts only use the package's.
+func ServerSettings(opts *Options) ServingSettings {
+	return serverSettings{options: opts}
+}
+
+func (settings serverSettings) Responder(r *http.Request, id string) Responder {
+	return responderFor(settings.options, id)
+}
+
+func (settings serverSettings) UntilServingWindow(id string, now time.Time) time.Duration {
+	return settings.options.untilServingWindow(id, now)
+}
+
+func (settings serverSettings) PackageMissing(ext extension.Extension) bool {
+	return settings.options.isPackageMissing(ext)
+}
+
+func (settings serverSettings) RedirectURLs(r *http.Request, id string, known bool) (string, string, bool) {
+	return redirectURLsFor(settings.options, r, id, known)
+}
+
+// StaticSettings are ServingSettings which never change, for tests and programs which manage settings themselves.
+// The zero value has no responders, serving windows or missing packages, and doesn't redirect.
+type StaticSettings struct {
+	// Responders answer checks by extension ID instead of the catalog
+	Responders map[string]Responder
+	// ServingWindows are when updates are offered by extension ID
+	ServingWindows map[string]ServingWindow
+	// MissingPackages are the IDs of extensions whose packages can't be downloaded
+	MissingPackages map[string]bool
+	// WebStoreFallbackURL and ComponentUpdaterFallbackURL are where GET and POST checks for only an unknown extension
+	// are redirected. They are answered here when the URL is empty.
+	WebStoreFallbackURL         string
+	ComponentUpdaterFallbackURL string
+}
+
+// Responder returns the responder of the extension with id
+func (settings *StaticSettings) Responder(r *http.Request, id string) Responder {
+	return settings.Responders[id]
+}
+
+// UntilServingWindow returns how long it is from now until the serving window of the extension with id opens
+func (settings *StaticSettings) UntilServingWindow(id string, now time.Time) time.Duration {
+	window, ok := settings.ServingWindows[id]
+	if !ok || window.contains(now) {
+		return 0
+	}
+	return window.untilOpen(now)
+}
+
+// PackageMissing returns true if ext is one of MissingPackages
+func (settings *StaticSettings) PackageMissing(ext extension.Extension) bool {
+	return settings.MissingPackages[ext.ID]
+}
+
+// RedirectURLs returns the fallback URLs, and true if the extension isn't known
+func (settings *StaticSettings) RedirectURLs(r *http.Request, id string, known bool) (string, string, bool) {
+	return settings.WebStoreFallbackURL, settings.ComponentUpdaterFallbackURL, !known
+}
+
+// noSettings are the settings of handlers which weren't given any
+var noSettings = &StaticSettings{}
+
+// UpdateHandler answers POST update checks in the XML protocol 3 and JSON protocol 4
+type UpdateHandler struct {
+	// Catalog is where updates are looked up
+	Catalog CatalogService
+	// Settings decide how checks are answered besides the catalog, none if nil
+	Settings ServingSettings
+	// Clock is the time serving windows are checked at, the clock of the request's Options if nil
+	Clock Clock
+	// Logger logs errors, the request's logger if nil
+	Logger logrus.FieldLogger
+}
+
+// NewUpdateHandler creates an UpdateHandler answering from catalog with settings
+func NewUpdateHandler(catalog CatalogService, settings ServingSettings) *UpdateHandler {
+	return &UpdateHandler{Catalog: catalog, Settings: settings}
+}
+
+func (h *UpdateHandler) now(r *http.Request) time.Time {
+	return clockFor(r, h.Clock).Now()
+}
+
+func (h *UpdateHandler) log(r *http.Request) logrus.FieldLogger {
+	return requestLogger(r, h.Logger)
+}
+
+func (h *UpdateHandler) settings() ServingSettings {
+	return settingsOr(h.Settings)
+}
+
+// WebStoreHandler answers GET update checks, which list the extensions in x query parameters
+type WebStoreHandler struct {
+	// Catalog, Settings, Clock and Logger are as for UpdateHandler. Clock is also the time of day
+	// in protocol 2 responses.
+	Catalog  CatalogService
+	Settings ServingSettings
+	Clock    Clock
+	Logger   logrus.FieldLogger
+}
+
+// NewWebStoreHandler creates a WebStoreHandler answering from catalog with settings
+func NewWebStoreHandler(catalog CatalogService, settings ServingSettings) *WebStoreHandler {
+	return &WebStoreHandler{Catalog: catalog, Settings: settings}
+}
+
+func (h *WebStoreHandler) now(r *http.Request) time.Time {
+	return clockFor(r, h.Clock).Now()
+}
+
+func (h *WebStoreHandler) log(r *http.Request) logrus.FieldLogger {
+	return requestLogger(r, h.Logger)
+}
+
+func (h *WebStoreHandler) settings() ServingSettings {
+	return settingsOr(h.Settings)
+}
+
+// settingsOr returns settings, or none if it is nil
+func settingsOr(settings ServingSettings) ServingSettings {
+	if settings == nil {
+		return noSettings
+	}
+	return settings
+}
+
+// clockFor returns clock, or the clock of the Options serving r if it is nil
+func clockFor(r *http.Request, clock Clock) Clock {
+	if clock == nil {
+		return optionsFor(r.Context()).clock()
+	}
+	return clock
+}
+
+// requestLogger returns logger, or the logger of r if it is nil
+func requestLogger(r *http.Request, logger logrus.FieldLogger) logrus.FieldLogger {
+	if logger == nil {
+		return lg.Log(r.Context())
+	}
+	return logger
+}
@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"bytes"
+	"github.com/brave/go-update/extension"
+	"github.com/brave/go-update/extension/extensiontest"
+	"github.com/brave/go-update/memstore"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// fixedClock is a Clock which is always at now
+type fixedClock struct {
+	systemClock
+	now time.Time
+}
+
+func (clock fixedClock) Now() time.Time {
+	return clock.now
+}
+
+func newTestHandlers(settings ServingSettings, extensions ...extension.Extension) (*UpdateHandler, *WebStoreHandler) {
+	catalog := NewStaticCatalog(memstore.New(nil), extensions)
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	clock := fixedClock{now: time.Date(2026, time.March, 2, 12, 0, 0, 0, time.UTC)}
+	updates := &UpdateHandler{Catalog: catalog, Settings: settings, Clock: clock, Logger: logger}
+	webStore := &WebStoreHandler{Catalog: catalog, Settings: settings, Clock: clock, Logger: logger}
+	return updates, webStore
+}
+
+func checkForUpdate(h http.Handler, method string, id string, version string) *httptest.ResponseRecorder {
+	var req *http.Request
+	if method == http.MethodGet {
+		req = httptest.NewRequest(method, "/extensions?x="+url.QueryEscape("id="+id+"&v="+version), nil)
+	} else {
+		req = httptest.NewRequest(method, "/extensions", bytes.NewBufferString(extensiontest.ExtensionRequestFnFor(id)(version)))
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestHandlerSettings(t *testing.T) {
+	ext := extension.Extension{
+		ID:      "hkgkpgldcfgbgnhjdokckbpbenejbkhd",
+		SHA256:  "ac714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618",
+		Version: "3.0.0",
+	}
+	settings := &StaticSettings{}
+	updates, webStore := newTestHandlers(settings, ext)
+	handlers := map[string]http.Handler{http.MethodPost: updates, http.MethodGet: webStore}
+
+	for method, h := range handlers {
+		rr := checkForUpdate(h, method, ext.ID, "1.0.0")
+		assert.Equal(t, http.StatusOK, rr.Code, method)
+		extensiontest.AssertUpdateOffered(t, rr.Body.String(), ext.ID, "3.0.0", ext.SHA256)
+
+		// Unknown extensions are answered rather than redirected without fallback URLs
+		rr = checkForUpdate(h, method, "ldimlcelhnjgpjjemdjokpgeeikdinbm", "1.0.0")
+		assert.Equal(t, http.StatusOK, rr.Code, method)
+	}
+
+	settings.WebStoreFallbackURL = "https://webstore.example.com/update"
+	settings.ComponentUpdaterFallbackURL = "https://components.example.com/update"
+	rr := checkForUpdate(updates, http.MethodPost, "ldimlcelhnjgpjjemdjokpgeeikdinbm", "1.0.0")
+	assert.Equal(t, http.StatusTemporaryRedirect, rr.Code)
+	assert.Contains(t, rr.Header().Get("Location"), settings.ComponentUpdaterFallbackURL)
+	rr = checkForUpdate(webStore, http.MethodGet, "ldimlcelhnjgpjjemdjokpgeeikdinbm", "1.0.0")
+	assert.Equal(t, http.StatusTemporaryRedirect, rr.Code)
+	assert.Contains(t, rr.Header().Get("Location"), settings.WebStoreFallbackURL)
+
+	// Updates wait for the serving window, which opens at 22:00
+	settings.ServingWindows = map[string]ServingWindow{ext.ID: {ID: ext.ID, Start: "22:00", End: "06:00", TimeZone: "UTC"}}
+	for method, h := range handlers {
+		rr := checkForUpdate(h, method, ext.ID, "1.0.0")
+		assert.Equal(t, http.StatusOK, rr.Code, method)
+		extensiontest.AssertNoUpdate(t, rr.Body.String(), ext.ID)
+		assert.NotEmpty(t, rr.Header().Get("X-Retry-After"), method)
+	}
+	settings.ServingWindows = nil
+
+	settings.MissingPackages = map[string]bool{ext.ID: true}
+	for method, h := range handlers {
+		rr := checkForUpdate(h, method, ext.ID, "1.0.0")
+		extensiontest.AssertNoUpdate(t, rr.Body.String(), ext.ID)
+	}
+	settings.MissingPackages = nil
+
+	// Responders answer instead of the catalog
+	settings.Responders = map[string]Responder{ext.ID: func(r *http.Request, checked extension.Extension) (extension.Extension, bool) {
+		return extension.Extension{Version: "4.0.0", SHA256: ext.SHA256, URL: "https://example.com/component.crx"}, true
+	}}
+	for method, h := range handlers {
+		rr := checkForUpdate(h, method, ext.ID, "1.0.0")
+		extensiontest.AssertUpdateOffered(t, rr.Body.String(), ext.ID, "4.0.0", ext.SHA256)
+		assert.Contains(t, rr.Body.String(), "https://example.com/component.crx", method)
+	}
+}
+
+func TestHandlersWithoutSettings(t *testing.T) {
+	updates, _ := newTestHandlers(nil)
+
+	// Handlers which weren't given settings answer unknown extensions rather than redirecting them
+	rr := checkForUpdate(updates, http.MethodPost, "ldimlcelhnjgpjjemdjokpgeeikdinbm", "1.0.0")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	extensiontest.AssertNoUpdate(t, rr.Body.String(), "ldimlcelhnjgpjjemdjokpgeeikdinbm")
+}
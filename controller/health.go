@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"github.com/brave/go-update/extension"
+	"github.com/prometheus/client_golang/prometheus"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// PackageHealth is what we know about the published CRX for an extension version
+type PackageHealth struct {
+	ID            string    `json:"id"`
+	Version       string    `json:"version"`
+	Verified      bool      `json:"verified"`
+	VerifyError   string    `json:"verifyError,omitempty"`
+	VerifiedAt    time.Time `json:"verifiedAt,omitempty"`
+	Reachable     bool      `json:"reachable"`
+	LinkError     string    `json:"linkError,omitempty"`
+	Size          int64     `json:"size,omitempty"`
+	LinkCheckedAt time.Time `json:"linkCheckedAt,omitempty"`
+}
+
+// Healthy returns true if nothing is known to be wrong with the package
+func (health *PackageHealth) Healthy() bool {
+	return len(health.VerifyError) == 0 && len(health.LinkError) == 0
+}
+
+// packageHealth is the health of the packages of the extension versions served with some Options, by health key
+type packageHealth struct {
+	mutex   sync.RWMutex
+	records map[string]PackageHealth
+}
+
+var unhealthyPackagesGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "unhealthy_packages",
+	Help: "Number of extension packages which failed verification or health checks.",
+})
+
+func init() {
+	prometheus.MustRegister(unhealthyPackagesGauge)
+}
+
+func getPackageHealthKey(id string, version string) string {
+	return id + "@" + version
+}
+
+// updatePackageHealth applies update to the health record of opts for the specified extension version
+func (opts *Options) updatePackageHealth(id string, version string, update func(health *PackageHealth)) {
+	opts.packageHealth.mutex.Lock()
+	defer opts.packageHealth.mutex.Unlock()
+	key := getPackageHealthKey(id, version)
+	health, ok := opts.packageHealth.records[key]
+	if !ok {
+		health = PackageHealth{ID: id, Version: version}
+	}
+	update(&health)
+	if opts.packageHealth.records == nil {
+		opts.packageHealth.records = map[string]PackageHealth{}
+	}
+	opts.packageHealth.records[key] = health
+	unhealthy := 0
+	for _, h := range opts.packageHealth.records {
+		if !h.Healthy() {
+			unhealthy++
+		}
+	}
+	unhealthyPackagesGauge.Set(float64(unhealthy))
+}
+
+// GetPackageHealth returns the health of the package for the specified extension version served with opts
+func (opts *Options) GetPackageHealth(id string, version string) (PackageHealth, bool) {
+	if opts == nil {
+		return PackageHealth{}, false
+	}
+	opts.packageHealth.mutex.RLock()
+	defer opts.packageHealth.mutex.RUnlock()
+	health, ok := opts.packageHealth.records[getPackageHealthKey(id, version)]
+	return health, ok
+}
+
+// snapshotExtensions returns the extensions of a catalog snapshot
+func snapshotExtensions(snapshot *CatalogSnapshot) extension.Extensions {
+	extensions := extension.Extensions{}
+	for _, ext := range snapshot.Map() {
+		extensions = append(extensions, ext)
+	}
+	return extensions
+}
+
+// servedExtensions returns the extension versions in the default catalog of opts and those of its tenants,
+// each version once since packages are published by ID and version
+func (opts *Options) servedExtensions() extension.Extensions {
+	extensions := snapshotExtensions(opts.CurrentCatalog())
+	seen := map[string]bool{}
+	for _, ext := range extensions {
+		seen[getPackageHealthKey(ext.ID, ext.Version)] = true
+	}
+	for _, tenant := range opts.tenants() {
+		for _, ext := range tenant.catalog() {
+			if key := getPackageHealthKey(ext.ID, ext.Version); !seen[key] {
+				seen[key] = true
+				extensions = append(extensions, ext)
+			}
+		}
+	}
+	return extensions
+}
+
+// PackageHealthReport is the handler for listing the health of every package we have checked
+func PackageHealthReport(w http.ResponseWriter, r *http.Request) {
+	report := []PackageHealth{}
+	if opts := optionsFor(r.Context()); opts != nil {
+		opts.packageHealth.mutex.RLock()
+		for _, health := range opts.packageHealth.records {
+			report = append(report, health)
+		}
+		opts.packageHealth.mutex.RUnlock()
+	}
+	sort.Slice(report, func(i, j int) bool {
+		return getPackageHealthKey(report[i].ID, report[i].Version) < getPackageHealthKey(report[j].ID, report[j].Version)
+	})
+
+	writeList(w, r, "packages", report)
+}
@@ -0,0 +1,30 @@
+package controller_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/brave/go-update/controller"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPackageHealthReport(t *testing.T) {
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/api/admin/health/packages", server.URL), nil)
+	assert.Nil(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	req.Header.Set("Authorization", "Bearer test-token")
+	resp, err = http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	report := []controller.PackageHealth{}
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(&report))
+}
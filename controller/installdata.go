@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/pressly/lg"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"unicode/utf8"
+)
+
+// MaxInstallDataSize is the largest install data blob accepted, as it is sent in the update responses of every install
+var MaxInstallDataSize = 64 * 1024
+
+// installDataIndexRegexp matches the index names install data can be requested by
+var installDataIndexRegexp = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// PutInstallData is the admin handler for storing an install data blob of an extension in the catalog,
+// which clients get along with an update when they request its index with a data element.
+func PutInstallData(w http.ResponseWriter, r *http.Request) {
+	log := lg.Log(r.Context())
+	if optionsFor(r.Context()).frozen() {
+		http.Error(w, "The catalog is frozen", http.StatusForbidden)
+		return
+	}
+	id := chi.URLParam(r, "id")
+	index := chi.URLParam(r, "index")
+	ext, ok := catalogFor(r)[id]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(r.Body, int64(MaxInstallDataSize)+1))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if problems := validateInstallData(id, map[string]string{index: string(data)}); len(problems) != 0 {
+		http.Error(w, fmt.Sprintf("Invalid install data: %s", problems[0]), http.StatusBadRequest)
+		return
+	}
+
+	before := ext
+	ext.InstallData = copyInstallData(before.InstallData, index)
+	ext.InstallData[index] = string(data)
+	if saveCatalogEntry(w, r, before, ext) {
+		log.Infof("Stored install data %s of extension %s", index, id)
+	}
+}
+
+// DeleteInstallData is the admin handler for removing an install data blob of an extension in the catalog
+func DeleteInstallData(w http.ResponseWriter, r *http.Request) {
+	log := lg.Log(r.Context())
+	if optionsFor(r.Context()).frozen() {
+		http.Error(w, "The catalog is frozen", http.StatusForbidden)
+		return
+	}
+	id := chi.URLParam(r, "id")
+	index := chi.URLParam(r, "index")
+	ext, ok := catalogFor(r)[id]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if _, ok := ext.InstallData[index]; !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	before := ext
+	ext.InstallData = copyInstallData(before.InstallData, index)
+	if len(ext.InstallData) == 0 {
+		ext.InstallData = nil
+	}
+	if saveCatalogEntry(w, r, before, ext) {
+		log.Infof("Removed install data %s of extension %s", index, id)
+	}
+}
+
+// copyInstallData returns a copy of installData without index, as the catalog's entries must not be changed
+func copyInstallData(installData map[string]string, index string) map[string]string {
+	copied := map[string]string{}
+	for other, data := range installData {
+		if other != index {
+			copied[other] = data
+		}
+	}
+	return copied
+}
+
+// validateInstallData returns the problems with the install data of the extension with id
+func validateInstallData(id string, installData map[string]string) []string {
+	problems := []string{}
+	for index, data := range installData {
+		if !installDataIndexRegexp.MatchString(index) {
+			problems = append(problems, fmt.Sprintf("%s: install data index %q is not up to 64 letters, digits, dots, dashes or underscores", id, index))
+		}
+		if len(data) > MaxInstallDataSize {
+			problems = append(problems, fmt.Sprintf("%s: install data %s is larger than %d bytes", id, index, MaxInstallDataSize))
+		}
+		// The data is sent as the text of an XML element
+		if !utf8.ValidString(data) {
+			problems = append(problems, fmt.Sprintf("%s: install data %s is not UTF-8 text", id, index))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,55 @@
+package controller_test
+
+import (
+	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/extension/extensiontest"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestInstallData(t *testing.T) {
+	id := "ldimlcelhnjgpjjemdjokpgeeikdinbm"
+	admin := func(method string, index string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/admin/extensions/"+id+"/install-data/"+index, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer test-token")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+	check := func(data string) string {
+		requestBody := strings.Replace(extensiontest.ExtensionRequestFnFor(id)("0.0.0"), "<updatecheck />", "<updatecheck />"+data, 1)
+		req := httptest.NewRequest(http.MethodPost, "/extensions", strings.NewReader(requestBody))
+		req.Header.Set("Content-Type", "application/xml")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		return rr.Body.String()
+	}
+
+	assert.Equal(t, http.StatusNotFound, admin(http.MethodDelete, "referral", "").Code)
+	assert.Equal(t, http.StatusBadRequest, admin(http.MethodPut, "a%20b", "x").Code)
+	assert.Equal(t, http.StatusBadRequest, admin(http.MethodPut, "referral", strings.Repeat("x", controller.MaxInstallDataSize+1)).Code)
+	assert.Equal(t, http.StatusBadRequest, admin(http.MethodPut, "referral", "\xff").Code)
+
+	rr := admin(http.MethodPut, "referral", `{"code":"BRV001"}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	defer admin(http.MethodDelete, "referral", "")
+	assert.Contains(t, rr.Body.String(), `"installData":{"referral":`)
+	assert.Equal(t, http.StatusOK, admin(http.MethodPut, "config", "verbose").Code)
+	assert.Equal(t, 2, len(handlerOptions.CurrentCatalog().Map()[id].InstallData))
+
+	// Only requested install data is sent, along with the update
+	body := check(`<data name="install" index="referral"/><data name="install" index="missing"/>`)
+	assert.Contains(t, body, `<data name="install" index="referral" status="ok">{&#34;code&#34;:&#34;BRV001&#34;}</data>`)
+	assert.Contains(t, body, `<data name="install" index="missing" status="error-nodata"></data>`)
+	assert.NotContains(t, body, "verbose")
+	assert.NotContains(t, check(""), "<data")
+
+	assert.Equal(t, http.StatusOK, admin(http.MethodDelete, "config", "").Code)
+	assert.Equal(t, http.StatusNotFound, admin(http.MethodDelete, "config", "").Code)
+	assert.Equal(t, http.StatusOK, admin(http.MethodDelete, "referral", "").Code)
+	assert.Nil(t, handlerOptions.CurrentCatalog().Map()[id].InstallData)
+}
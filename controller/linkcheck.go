@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/brave/go-update/extension"
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+	"net/http"
+	"time"
+)
+
+var linkCheckClient = &http.Client{Timeout: 30 * time.Second}
+
+var linkCheckFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "package_link_check_failures_total",
+	Help: "Number of failed HEAD requests for advertised extension packages.",
+}, []string{"id"})
+
+func init() {
+	prometheus.MustRegister(linkCheckFailures)
+}
+
+// checkLinks sends a HEAD request for the codebase URL of every extension
+// and records in the package health of opts whether it is reachable and how big it is. Nothing is checked when
+// the codebase URL depends on the client's channel or platform, since there is no single URL a version is downloaded from.
+func (opts *Options) checkLinks(extensions extension.Extensions) {
+	if extension.CodebaseURLDependsOnClient() {
+		return
+	}
+	opts.linkCheckMutex.Lock()
+	defer opts.linkCheckMutex.Unlock()
+	for _, ext := range extensions {
+		size, err := checkLink(ext)
+		if err != nil {
+			log.Printf("link check failed for %s %s: %v\n", ext.ID, ext.Version, err)
+			linkCheckFailures.WithLabelValues(ext.ID).Inc()
+		}
+		opts.updatePackageHealth(ext.ID, ext.Version, func(health *PackageHealth) {
+			health.Reachable = err == nil
+			health.LinkError = ""
+			if err != nil {
+				health.LinkError = err.Error()
+			}
+			health.Size = size
+			health.LinkCheckedAt = time.Now()
+		})
+	}
+}
+
+func checkLink(ext extension.Extension) (int64, error) {
+	resp, err := linkCheckClient.Head(extension.GetCodebaseURL(ext, extension.Client{}))
+	if err != nil {
+		return 0, err
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		log.Printf("error closing link check response: %v\n", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("HEAD failed with status %d", resp.StatusCode)
+	}
+	if ext.Size != 0 && resp.ContentLength >= 0 && resp.ContentLength != ext.Size {
+		return resp.ContentLength, fmt.Errorf("size %d does not match the catalog size %d", resp.ContentLength, ext.Size)
+	}
+	return resp.ContentLength, nil
+}
+
+// isPackageMissing returns true if serving ext with opts should be suppressed because its CRX can't be downloaded
+func (opts *Options) isPackageMissing(ext extension.Extension) bool {
+	if !opts.settings().SuppressMissingPackages {
+		return false
+	}
+	health, ok := opts.GetPackageHealth(ext.ID, ext.Version)
+	return ok && !health.LinkCheckedAt.IsZero() && !health.Reachable
+}
@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"github.com/brave/go-update/extension"
+	"github.com/brave/go-update/extension/extensiontest"
+	"github.com/brave/go-update/memstore"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckLinks(t *testing.T) {
+	packages := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodHead, r.Method)
+		if strings.Contains(r.URL.Path, "2.0.0") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Length", "1024")
+	}))
+	defer packages.Close()
+	defer func(template string) {
+		extension.CodebaseURLTemplate = template
+	}(extension.CodebaseURLTemplate)
+	extension.CodebaseURLTemplate = packages.URL + "/{id}/{version}.crx"
+
+	id := "aomjjhallfgjeglblehebfpbcfeobpgk"
+	reachable := extension.Extension{ID: id, Version: "1.0.0", Size: 1024}
+	missing := extension.Extension{ID: id, Version: "2.0.0"}
+	resized := extension.Extension{ID: id, Version: "3.0.0", Size: 2048}
+	before := counterValue(linkCheckFailures.WithLabelValues(id))
+	opts := &Options{}
+	opts.checkLinks(extension.Extensions{reachable, missing, resized})
+
+	health, ok := opts.GetPackageHealth(id, "1.0.0")
+	assert.True(t, ok)
+	assert.True(t, health.Reachable)
+	assert.True(t, health.Healthy())
+	assert.Equal(t, int64(1024), health.Size)
+	assert.False(t, health.LinkCheckedAt.IsZero())
+
+	health, ok = opts.GetPackageHealth(id, "2.0.0")
+	assert.True(t, ok)
+	assert.False(t, health.Reachable)
+	assert.False(t, health.Healthy())
+	assert.Equal(t, "HEAD failed with status 404", health.LinkError)
+
+	health, ok = opts.GetPackageHealth(id, "3.0.0")
+	assert.True(t, ok)
+	assert.False(t, health.Reachable)
+	assert.Equal(t, "size 1024 does not match the catalog size 2048", health.LinkError)
+	assert.Equal(t, before+2, counterValue(linkCheckFailures.WithLabelValues(id)))
+
+	// Codebase URLs which depend on the client aren't checked
+	extension.CodebaseURLTemplate = packages.URL + "/{channel}/{id}/{version}.crx"
+	opts.checkLinks(extension.Extensions{{ID: id, Version: "4.0.0"}})
+	_, ok = opts.GetPackageHealth(id, "4.0.0")
+	assert.False(t, ok)
+}
+
+func TestSuppressMissingPackages(t *testing.T) {
+	packages := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/ccccccccccccccccccccccccccccccca/") {
+			http.NotFound(w, r)
+		}
+	}))
+	defer packages.Close()
+	defer func(template string) {
+		extension.CodebaseURLTemplate = template
+	}(extension.CodebaseURLTemplate)
+	extension.CodebaseURLTemplate = packages.URL + "/{id}/{version}.crx"
+
+	missing := extension.Extension{ID: "ccccccccccccccccccccccccccccccca", Version: "1.0.0"}
+	reachable := extension.Extension{ID: "ccccccccccccccccccccccccccccccce", Version: "1.0.0"}
+	unchecked := extension.Extension{ID: "ccccccccccccccccccccccccccccccci", Version: "1.0.0"}
+	opts := &Options{}
+	opts.checkLinks(extension.Extensions{missing, reachable})
+
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	handler := &UpdateHandler{
+		Catalog:  NewStaticCatalog(memstore.New(nil), extension.Extensions{missing, reachable, unchecked}),
+		Settings: ServerSettings(opts),
+		Logger:   logger,
+	}
+	offered := func(id string) bool {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/extensions", strings.NewReader(extensiontest.ExtensionRequestFnFor(id)("0.0.1"))))
+		assert.Equal(t, http.StatusOK, rr.Code)
+		return strings.Contains(rr.Body.String(), `<updatecheck status="ok">`)
+	}
+
+	// Packages which failed their link check are still offered unless suppression is on
+	assert.False(t, opts.isPackageMissing(missing))
+	assert.True(t, offered(missing.ID))
+
+	opts.UpdateSettings(func(settings *Settings) {
+		settings.SuppressMissingPackages = true
+	})
+	assert.True(t, opts.isPackageMissing(missing))
+	assert.False(t, offered(missing.ID))
+
+	// Reachable packages and those which weren't checked yet are offered
+	assert.False(t, opts.isPackageMissing(reachable))
+	assert.True(t, offered(reachable.ID))
+	assert.False(t, opts.isPackageMissing(unchecked))
+	assert.True(t, offered(unchecked.ID))
+}
@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// MaintenanceStatus is the body of the maintenance admin endpoints
+type MaintenanceStatus struct {
+	Enabled    bool `json:"enabled"`
+	RetryAfter int  `json:"retryAfter"`
+}
+
+// rejectDuringMaintenance answers every request with 503 and Retry-After while in maintenance mode
+func rejectDuringMaintenance(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		settings := optionsFor(r.Context()).settings()
+		if !settings.MaintenanceMode {
+			next.ServeHTTP(w, r)
+			return
+		}
+		seconds := strconv.Itoa(int(settings.MaintenanceRetryAfter.Seconds()))
+		w.Header().Set("Retry-After", seconds)
+		// The component updater in Chromium backs off based on X-Retry-After rather than Retry-After
+		w.Header().Set("X-Retry-After", seconds)
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+	})
+}
+
+// GetMaintenance is the handler for checking whether maintenance mode is enabled
+func GetMaintenance(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, http.StatusOK, adminService.Maintenance(r.Context()))
+}
+
+// EnableMaintenance is the handler for turning on maintenance mode.
+// It lasts until it is disabled or the configuration is reloaded.
+func EnableMaintenance(w http.ResponseWriter, r *http.Request) {
+	setMaintenance(w, r, true)
+}
+
+// DisableMaintenance is the handler for turning off maintenance mode
+func DisableMaintenance(w http.ResponseWriter, r *http.Request) {
+	setMaintenance(w, r, false)
+}
+
+func setMaintenance(w http.ResponseWriter, r *http.Request, enabled bool) {
+	status, err := adminService.SetMaintenance(r.Context(), enabled)
+	if err != nil {
+		writeAdminError(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, status)
+}
@@ -0,0 +1,46 @@
+package controller_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/extension/extensiontest"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	admin := func(method string) controller.MaintenanceStatus {
+		req, err := http.NewRequest(method, server.URL+"/api/admin/maintenance", nil)
+		assert.Nil(t, err)
+		req.Header.Set("Authorization", "Bearer test-token")
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		status := controller.MaintenanceStatus{}
+		assert.Nil(t, json.NewDecoder(resp.Body).Decode(&status))
+		return status
+	}
+	defer admin(http.MethodDelete)
+
+	assert.False(t, admin(http.MethodGet).Enabled)
+	status := admin(http.MethodPut)
+	assert.True(t, status.Enabled)
+	assert.Equal(t, 300, status.RetryAfter)
+
+	requestBody := extensiontest.ExtensionRequestFnFor("ldimlcelhnjgpjjemdjokpgeeikdinbm")("0.0.0")
+	resp, err := http.Post(server.URL+"/extensions", "application/xml", bytes.NewBufferString(requestBody))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, "300", resp.Header.Get("Retry-After"))
+	assert.Equal(t, "300", resp.Header.Get("X-Retry-After"))
+
+	assert.False(t, admin(http.MethodDelete).Enabled)
+	resp, err = http.Post(server.URL+"/extensions", "application/xml", bytes.NewBufferString(requestBody))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
@@ -0,0 +1,24 @@
+package controller
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// counterValue returns the current value of counter
+func counterValue(counter prometheus.Counter) float64 {
+	metric := dto.Metric{}
+	if err := counter.Write(&metric); err != nil {
+		panic(err)
+	}
+	return metric.GetCounter().GetValue()
+}
+
+// sampleCount returns how many observations histogram has recorded
+func sampleCount(histogram prometheus.Observer) uint64 {
+	metric := dto.Metric{}
+	if err := histogram.(prometheus.Metric).Write(&metric); err != nil {
+		panic(err)
+	}
+	return metric.GetHistogram().GetSampleCount()
+}
@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/brave/go-update/extension"
+	"github.com/getsentry/raven-go"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Kinds of release channels
+const (
+	ReleaseChannelSlack   = "slack"
+	ReleaseChannelDiscord = "discord"
+)
+
+// releaseNotificationTimeout is how long posting one release notification may take
+const releaseNotificationTimeout = 10 * time.Second
+
+// ReleaseChannel is a Slack or Discord channel which is told about new versions uploaded to the admin API
+type ReleaseChannel struct {
+	// Name identifies the channel, and its webhook URL is set with SetReleaseChannelURL
+	Name string
+	// Kind is ReleaseChannelSlack or ReleaseChannelDiscord
+	Kind string
+	// Tenant is the name of the tenant whose uploads are posted, or empty for the default catalog
+	Tenant string
+	// Client posts to the webhook, http.DefaultClient if nil
+	Client *http.Client
+}
+
+// releaseMessage describes an upload, like "Brave Wallet (id) updated 1.2.3 → 1.2.4", with the channel's markup
+func (channel ReleaseChannel) releaseMessage(tenant string, previous string, ext extension.Extension) string {
+	name := ext.ID
+	if len(ext.Title) != 0 {
+		bold := "*"
+		if channel.Kind == ReleaseChannelDiscord {
+			bold = "**"
+		}
+		name = fmt.Sprintf("%s%s%s (`%s`)", bold, ext.Title, bold, ext.ID)
+	}
+	message := fmt.Sprintf("%s published %s", name, ext.Version)
+	if len(previous) != 0 {
+		message = fmt.Sprintf("%s updated %s → %s", name, previous, ext.Version)
+	}
+	if len(tenant) != 0 {
+		message += " for " + tenant
+	}
+	if ext.PublishAt != nil {
+		message += ", scheduled for " + ext.PublishAt.UTC().Format(time.RFC3339)
+	}
+	return message
+}
+
+// post sends message to the channel's webhook
+func (channel ReleaseChannel) post(ctx context.Context, url string, message string) error {
+	field := "text"
+	if channel.Kind == ReleaseChannelDiscord {
+		field = "content"
+	}
+	data, err := json.Marshal(map[string]string{field: message})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("content-type", "application/json")
+	client := channel.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// notifyRelease posts an upload to the release channels of the catalog the request changed, previous being the version
+// it replaces or empty for a new extension. Posting happens in the background so slow chat services don't hold up uploads.
+func notifyRelease(ctx context.Context, previous string, ext extension.Extension) {
+	tenant := ""
+	if contextTenant := contextTenant(ctx); contextTenant != nil {
+		tenant = contextTenant.Name
+	}
+	opts := optionsFor(ctx)
+	urls := opts.settings().ReleaseChannelURLs
+	for _, channel := range opts.releaseChannels() {
+		if channel.Tenant != tenant {
+			continue
+		}
+		url := urls[channel.Name]
+		if len(url) == 0 {
+			continue
+		}
+		channel := channel
+		message := channel.releaseMessage(tenant, previous, ext)
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), releaseNotificationTimeout)
+			defer cancel()
+			err := channel.post(ctx, url, message)
+			if err != nil {
+				log.Printf("error posting release of %s %s to %s: %v\n", ext.ID, ext.Version, channel.Name, err)
+				raven.CaptureError(err, map[string]string{"releaseChannel": channel.Name})
+			}
+		}()
+	}
+}
@@ -0,0 +1,78 @@
+package controller_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/crx"
+	"github.com/brave/go-update/crx/crxtest"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReleaseChannels(t *testing.T) {
+	messages := make(chan map[string]string, 2)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		message := map[string]string{}
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&message))
+		message["path"] = r.URL.Path
+		messages <- message
+	}))
+	defer webhook.Close()
+	opts := &controller.Options{
+		ReleaseChannels: []controller.ReleaseChannel{
+			{Name: "slack", Kind: controller.ReleaseChannelSlack},
+			{Name: "discord", Kind: controller.ReleaseChannelDiscord},
+			{Name: "beta", Kind: controller.ReleaseChannelSlack, Tenant: "beta"},
+		},
+		CRXDirectory: crxDirectory,
+	}
+	opts.SetReleaseChannelURL("slack", webhook.URL+"/slack")
+	opts.SetReleaseChannelURL("discord", webhook.URL+"/discord")
+	opts.SetReleaseChannelURL("beta", webhook.URL+"/beta")
+	server := httptest.NewServer(newTestHandler(opts))
+	defer server.Close()
+
+	key := crxtest.NewKey()
+	id := crx.IDFromPublicKey(crxtest.PublicKey(key))
+	payload := crxtest.BuildSignedCRX(key, []byte("PK archive"))
+	received := func() map[string]map[string]string {
+		byPath := map[string]map[string]string{}
+		for i := 0; i < 2; i++ {
+			select {
+			case message := <-messages:
+				byPath[message["path"]] = message
+			case <-time.After(5 * time.Second):
+				t.Fatal("release notification wasn't posted")
+			}
+		}
+		return byPath
+	}
+	for _, version := range []string{"1.2.3", "1.2.4"} {
+		req, err := http.NewRequest(http.MethodPut, fmt.Sprintf("%s/api/admin/extensions/%s/versions/%s?title=Notified", server.URL, id, version), bytes.NewBuffer(payload))
+		assert.Nil(t, err)
+		req.Header.Set("Authorization", "Bearer test-token")
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		// Only the channels of the default catalog are told, each with its own markup
+		byPath := received()
+		if version == "1.2.3" {
+			assert.Equal(t, map[string]string{"path": "/slack", "text": "*Notified* (`" + id + "`) published 1.2.3"}, byPath["/slack"])
+			assert.Equal(t, map[string]string{"path": "/discord", "content": "**Notified** (`" + id + "`) published 1.2.3"}, byPath["/discord"])
+		} else {
+			assert.Equal(t, "*Notified* (`"+id+"`) updated 1.2.3 → 1.2.4", byPath["/slack"]["text"])
+			assert.Equal(t, "**Notified** (`"+id+"`) updated 1.2.3 → 1.2.4", byPath["/discord"]["content"])
+		}
+	}
+	select {
+	case message := <-messages:
+		t.Fatalf("unexpected release notification %v", message)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,298 @@
+package controller
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// oidcLeeway is how far the clocks of the issuer and this server may disagree
+const oidcLeeway = time.Minute
+
+// oidcRefreshInterval is the least time between fetches of the issuer's keys, so tokens with unknown key IDs can't hammer it
+const oidcRefreshInterval = time.Minute
+
+// oidcClient fetches the issuer's keys for verifiers without a Client
+var oidcClient = &http.Client{Timeout: 10 * time.Second}
+
+// OIDCVerifier validates ID tokens from an OpenID Connect issuer, like Okta or Google Workspace,
+// and maps the groups in them to admin API roles
+type OIDCVerifier struct {
+	Issuer   string
+	Audience string
+	// GroupsClaim is the claim listing the user's groups, "groups" if empty
+	GroupsClaim          string
+	ReleaseManagerGroups []string
+	ViewerGroups         []string
+	// Client fetches the issuer's discovery document and keys, a client with a 10 second timeout if nil
+	Client *http.Client
+
+	mutex sync.Mutex
+	keys  map[string]crypto.PublicKey
+	// fetched is when the last fetch of the keys started, whether it succeeded or not
+	fetched time.Time
+	// fetching is closed when the fetch in progress ends, with its error in fetchError, or nil if there is none
+	fetching   chan struct{}
+	fetchError error
+}
+
+// OIDCClaims are the claims of a verified token which are used
+type OIDCClaims struct {
+	Subject string
+	Email   string
+	Groups  []string
+}
+
+// looksLikeJWT returns true for tokens in the compact JWS form, so static tokens aren't sent to the issuer
+func looksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// Verify checks the signature, issuer, audience and validity period of token and returns its claims
+func (verifier *OIDCVerifier) Verify(ctx context.Context, token string) (OIDCClaims, error) {
+	claims := OIDCClaims{}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims, errors.New("token is not a JWT")
+	}
+	header := struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}{}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return claims, fmt.Errorf("error parsing token header: %v", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims, fmt.Errorf("error decoding token signature: %v", err)
+	}
+	key, err := verifier.key(ctx, header.KeyID)
+	if err != nil {
+		return claims, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if header.Algorithm != "RS256" || rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) != nil {
+			return claims, errors.New("invalid token signature")
+		}
+	case *ecdsa.PublicKey:
+		if header.Algorithm != "ES256" || len(signature) != 64 ||
+			!ecdsa.Verify(key, digest[:], new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])) {
+			return claims, errors.New("invalid token signature")
+		}
+	default:
+		return claims, fmt.Errorf("unsupported key type for %s", header.KeyID)
+	}
+
+	payload := map[string]interface{}{}
+	if err := decodeJWTPart(parts[1], &payload); err != nil {
+		return claims, fmt.Errorf("error parsing token claims: %v", err)
+	}
+	if issuer, _ := payload["iss"].(string); issuer != verifier.Issuer {
+		return claims, fmt.Errorf("token is from %q, not %q", issuer, verifier.Issuer)
+	}
+	if !hasAudience(payload["aud"], verifier.Audience) {
+		return claims, fmt.Errorf("token is not for %q", verifier.Audience)
+	}
+	now := time.Now()
+	expires, ok := payload["exp"].(float64)
+	if !ok || now.After(time.Unix(int64(expires), 0).Add(oidcLeeway)) {
+		return claims, errors.New("token has expired")
+	}
+	if notBefore, ok := payload["nbf"].(float64); ok && now.Add(oidcLeeway).Before(time.Unix(int64(notBefore), 0)) {
+		return claims, errors.New("token is not valid yet")
+	}
+	claims.Subject, _ = payload["sub"].(string)
+	claims.Email, _ = payload["email"].(string)
+	groupsClaim := verifier.GroupsClaim
+	if len(groupsClaim) == 0 {
+		groupsClaim = "groups"
+	}
+	groups, _ := payload[groupsClaim].([]interface{})
+	for _, group := range groups {
+		if group, ok := group.(string); ok {
+			claims.Groups = append(claims.Groups, group)
+		}
+	}
+	return claims, nil
+}
+
+// Role returns the admin API role of a user in groups, release manager taking precedence, or an empty string for none
+func (verifier *OIDCVerifier) Role(groups []string) string {
+	for _, role := range []struct {
+		name   string
+		groups []string
+	}{{RoleReleaseManager, verifier.ReleaseManagerGroups}, {RoleViewer, verifier.ViewerGroups}} {
+		for _, group := range groups {
+			for _, allowed := range role.groups {
+				if group == allowed {
+					return role.name
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func decodeJWTPart(part string, value interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, value)
+}
+
+// hasAudience returns true if the aud claim, a string or a list of them, includes audience
+func hasAudience(claim interface{}, audience string) bool {
+	switch claim := claim.(type) {
+	case string:
+		return claim == audience
+	case []interface{}:
+		for _, aud := range claim {
+			if aud == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// key returns the issuer's key with keyID, fetching the keys again if it is unknown, as it is after the issuer rotates them.
+// Requests for unknown keys share one fetch, which runs without holding the mutex.
+func (verifier *OIDCVerifier) key(ctx context.Context, keyID string) (crypto.PublicKey, error) {
+	verifier.mutex.Lock()
+	if key, ok := verifier.keys[keyID]; ok {
+		verifier.mutex.Unlock()
+		return key, nil
+	}
+	fetching := verifier.fetching
+	if fetching == nil {
+		if time.Since(verifier.fetched) < oidcRefreshInterval {
+			verifier.mutex.Unlock()
+			return nil, fmt.Errorf("unknown signing key %q", keyID)
+		}
+		// The fetch counts from when it starts, so failed ones aren't retried any sooner
+		verifier.fetched = time.Now()
+		fetching = make(chan struct{})
+		verifier.fetching = fetching
+		go verifier.refreshKeys(fetching)
+	}
+	verifier.mutex.Unlock()
+
+	select {
+	case <-fetching:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	verifier.mutex.Lock()
+	defer verifier.mutex.Unlock()
+	if key, ok := verifier.keys[keyID]; ok {
+		return key, nil
+	}
+	if verifier.fetchError != nil {
+		return nil, fmt.Errorf("error fetching the issuer's keys: %v", verifier.fetchError)
+	}
+	return nil, fmt.Errorf("unknown signing key %q", keyID)
+}
+
+// refreshKeys fetches the issuer's keys and closes fetching once they replace the current ones. It doesn't use the
+// context of the request which started it, since the other requests waiting for it would fail if that one is canceled.
+func (verifier *OIDCVerifier) refreshKeys(fetching chan struct{}) {
+	keys, err := verifier.fetchKeys(context.Background())
+	verifier.mutex.Lock()
+	if err == nil {
+		verifier.keys = keys
+	}
+	verifier.fetchError = err
+	verifier.fetching = nil
+	verifier.mutex.Unlock()
+	close(fetching)
+}
+
+// fetchKeys reads the issuer's keys from the jwks_uri in its discovery document
+func (verifier *OIDCVerifier) fetchKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	discovery := struct {
+		JWKSURI string `json:"jwks_uri"`
+	}{}
+	err := verifier.getJSON(ctx, strings.TrimSuffix(verifier.Issuer, "/")+"/.well-known/openid-configuration", &discovery)
+	if err != nil {
+		return nil, err
+	}
+	jwks := struct {
+		Keys []struct {
+			KeyType string `json:"kty"`
+			KeyID   string `json:"kid"`
+			Use     string `json:"use"`
+			N       string `json:"n"`
+			E       string `json:"e"`
+			Curve   string `json:"crv"`
+			X       string `json:"x"`
+			Y       string `json:"y"`
+		} `json:"keys"`
+	}{}
+	err = verifier.getJSON(ctx, discovery.JWKSURI, &jwks)
+	if err != nil {
+		return nil, err
+	}
+	keys := map[string]crypto.PublicKey{}
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		switch {
+		case jwk.KeyType == "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+			e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+			if errN != nil || errE != nil || len(e) > 4 {
+				continue
+			}
+			keys[jwk.KeyID] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case jwk.KeyType == "EC" && jwk.Curve == "P-256":
+			x, errX := base64.RawURLEncoding.DecodeString(jwk.X)
+			y, errY := base64.RawURLEncoding.DecodeString(jwk.Y)
+			if errX != nil || errY != nil {
+				continue
+			}
+			key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+			if !key.Curve.IsOnCurve(key.X, key.Y) {
+				continue
+			}
+			keys[jwk.KeyID] = key
+		}
+	}
+	return keys, nil
+}
+
+func (verifier *OIDCVerifier) getJSON(ctx context.Context, url string, value interface{}) error {
+	client := verifier.Client
+	if client == nil {
+		client = oidcClient
+	}
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %s", url, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1024*1024)).Decode(value)
+}
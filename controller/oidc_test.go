@@ -0,0 +1,147 @@
+package controller_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/brave/go-update/controller"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestOIDC(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	issuer := httptest.NewServer(nil)
+	defer issuer.Close()
+	issuer.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			fmt.Fprintf(w, `{"issuer": "%s", "jwks_uri": "%s/keys"}`, issuer.URL, issuer.URL)
+		case "/keys":
+			fmt.Fprintf(w, `{"keys": [{"kty": "RSA", "kid": "key-1", "use": "sig", "n": "%s", "e": "AQAB"}]}`,
+				base64.RawURLEncoding.EncodeToString(key.N.Bytes()))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	sign := func(keyID string, claims map[string]interface{}) string {
+		header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT","kid":"` + keyID + `"}`))
+		payload, err := json.Marshal(claims)
+		assert.Nil(t, err)
+		signingInput := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+		digest := sha256.Sum256([]byte(signingInput))
+		signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		assert.Nil(t, err)
+		return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+	}
+	claims := func(groups ...string) map[string]interface{} {
+		return map[string]interface{}{
+			"iss":    issuer.URL,
+			"aud":    []string{"go-update"},
+			"sub":    "00u1",
+			"email":  "releaser@example.com",
+			"exp":    time.Now().Add(time.Hour).Unix(),
+			"groups": groups,
+		}
+	}
+	opts := &controller.Options{
+		OIDC: &controller.OIDCVerifier{
+			Issuer:               issuer.URL,
+			Audience:             "go-update",
+			ReleaseManagerGroups: []string{"releases"},
+			ViewerGroups:         []string{"dashboards"},
+		},
+		Audit: &controller.MemoryAuditLog{},
+	}
+	server := httptest.NewServer(newTestHandler(opts))
+	defer server.Close()
+	admin := func(method string, path string, token string) int {
+		req, err := http.NewRequest(method, server.URL+path, nil)
+		assert.Nil(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		return resp.StatusCode
+	}
+
+	// Groups map to roles
+	viewer := sign("key-1", claims("everyone", "dashboards"))
+	assert.Equal(t, http.StatusOK, admin(http.MethodGet, "/api/admin/catalog", viewer))
+	assert.Equal(t, http.StatusForbidden, admin(http.MethodPut, "/api/admin/maintenance", viewer))
+	releaser := sign("key-1", claims("releases"))
+	assert.Equal(t, http.StatusOK, admin(http.MethodPut, "/api/admin/maintenance", releaser))
+	assert.Equal(t, http.StatusOK, admin(http.MethodDelete, "/api/admin/maintenance", releaser))
+	assert.Equal(t, http.StatusForbidden, admin(http.MethodGet, "/api/admin/catalog", sign("key-1", claims("everyone"))))
+
+	// Changes are recorded with the user's identity
+	records, err := opts.Audit.Query(context.Background(), controller.AuditFilter{Actor: "oidc:releaser@example.com"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(records))
+
+	// Tokens which are forged, expired or for someone else are rejected
+	expired := claims("releases")
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	assert.Equal(t, http.StatusUnauthorized, admin(http.MethodGet, "/api/admin/catalog", sign("key-1", expired)))
+	otherAudience := claims("releases")
+	otherAudience["aud"] = "other-app"
+	assert.Equal(t, http.StatusUnauthorized, admin(http.MethodGet, "/api/admin/catalog", sign("key-1", otherAudience)))
+	otherIssuer := claims("releases")
+	otherIssuer["iss"] = "https://evil.example.com"
+	assert.Equal(t, http.StatusUnauthorized, admin(http.MethodGet, "/api/admin/catalog", sign("key-1", otherIssuer)))
+	assert.Equal(t, http.StatusUnauthorized, admin(http.MethodGet, "/api/admin/catalog", sign("key-2", claims("releases"))))
+	parts := strings.Split(releaser, ".")
+	forged := parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"iss":"`+issuer.URL+`","aud":"go-update","groups":["releases"],"exp":9999999999}`)) + "." + parts[2]
+	assert.Equal(t, http.StatusUnauthorized, admin(http.MethodGet, "/api/admin/catalog", forged))
+
+	// Static tokens still work
+	assert.Equal(t, http.StatusOK, admin(http.MethodGet, "/api/admin/catalog", "test-token"))
+}
+
+func TestOIDCKeyFetches(t *testing.T) {
+	var fetches int64
+	release := make(chan struct{})
+	issuer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&fetches, 1)
+		<-release
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer issuer.Close()
+	verifier := &controller.OIDCVerifier{Issuer: issuer.URL, Audience: "go-update"}
+	token := "e30.e30.c2lnbmF0dXJl"
+
+	// Requests don't wait for a slow issuer longer than they may take
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := verifier.Verify(ctx, token)
+	assert.Equal(t, context.Canceled, err)
+
+	// Requests for unknown keys share the fetch in progress
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := verifier.Verify(context.Background(), token)
+			assert.NotNil(t, err)
+		}()
+	}
+	close(release)
+	wg.Wait()
+
+	// and a failed fetch isn't retried before the refresh interval has passed
+	_, err = verifier.Verify(context.Background(), token)
+	assert.Contains(t, err.Error(), "unknown signing key")
+	assert.Equal(t, int64(1), atomic.LoadInt64(&fetches))
+}
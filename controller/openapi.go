@@ -0,0 +1,254 @@
+package controller
+
+import (
+	"encoding/json"
+	"github.com/go-chi/chi"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiParameter is a query parameter of an API operation
+type apiParameter struct {
+	Name        string
+	Description string
+	// Type is the JSON schema type of the value, string if empty, and Format its format like date-time
+	Type   string
+	Format string
+}
+
+// apiOperation is an endpoint of the admin or stats API. The routers and the OpenAPI document are both built from
+// the operations, so the document always lists the routes which are served, with the types their handlers read and write.
+type apiOperation struct {
+	Method     string
+	Pattern    string
+	Handler    http.HandlerFunc
+	Middleware []func(http.Handler) http.Handler
+	Summary    string
+	Query      []apiParameter
+	// Body is the value a JSON request body is decoded into, or BodyType the content type of other bodies
+	Body     interface{}
+	BodyType string
+	// Status is the status of a successful response, 200 if not set, and Response the value written with it
+	Status   int
+	Response interface{}
+	// List is the name of the object a list Response is wrapped in from APIVersion2 on, see writeList
+	List string
+	// Tenant is true for operations which are also served on the catalog of each tenant
+	Tenant bool
+}
+
+// routeOperations adds the operations to r
+func routeOperations(r chi.Router, operations []apiOperation) {
+	for _, operation := range operations {
+		r.With(operation.Middleware...).Method(operation.Method, operation.Pattern, operation.Handler)
+	}
+}
+
+// tenantOperations are the admin operations served on the catalog of each tenant
+func tenantOperations() []apiOperation {
+	operations := []apiOperation{}
+	for _, operation := range adminOperations {
+		if operation.Tenant {
+			operations = append(operations, operation)
+		}
+	}
+	return operations
+}
+
+// pathParameterRegexp matches the parameters of route patterns, which chi and OpenAPI write the same way
+var pathParameterRegexp = regexp.MustCompile(`\{([^}]+)\}`)
+
+// openAPISchemas builds the schemas of the JSON encoding of Go types, keeping named structs in components
+type openAPISchemas map[string]interface{}
+
+var timeType = reflect.TypeOf(time.Time{})
+var rawMessageType = reflect.TypeOf(json.RawMessage{})
+
+// schema returns the schema of the JSON encoding of t
+func (schemas openAPISchemas) schema(t reflect.Type) map[string]interface{} {
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == rawMessageType:
+		return map[string]interface{}{}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemas.schema(t.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": schemas.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemas.schema(t.Elem())}
+	case reflect.Struct:
+		if len(t.Name()) == 0 {
+			return schemas.object(t)
+		}
+		ref := map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+		if _, ok := schemas[t.Name()]; !ok {
+			// Added before the fields so types which contain themselves refer to it rather than recursing
+			schemas[t.Name()] = nil
+			schemas[t.Name()] = schemas.object(t)
+		}
+		return ref
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// object returns the schema of a struct, whose fields without omitempty are always present
+func (schemas openAPISchemas) object(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if len(field.PkgPath) != 0 {
+			continue
+		}
+		tag := strings.Split(field.Tag.Get("json"), ",")
+		if tag[0] == "-" {
+			continue
+		}
+		name := tag[0]
+		if len(name) == 0 {
+			name = field.Name
+		}
+		properties[name] = schemas.schema(field.Type)
+		omitempty := false
+		for _, option := range tag[1:] {
+			omitempty = omitempty || option == "omitempty"
+		}
+		if !omitempty {
+			required = append(required, name)
+		}
+	}
+	object := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) != 0 {
+		object["required"] = required
+	}
+	return object
+}
+
+// openAPIOperation describes operation, as served with the given API version
+func (schemas openAPISchemas) openAPIOperation(operation apiOperation, version string, path string) map[string]interface{} {
+	parameters := []interface{}{}
+	for _, match := range pathParameterRegexp.FindAllStringSubmatch(path, -1) {
+		parameters = append(parameters, map[string]interface{}{
+			"name": match[1], "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"},
+		})
+	}
+	for _, parameter := range operation.Query {
+		schema := map[string]interface{}{"type": "string"}
+		if len(parameter.Type) != 0 {
+			schema["type"] = parameter.Type
+		}
+		if len(parameter.Format) != 0 {
+			schema["format"] = parameter.Format
+		}
+		query := map[string]interface{}{"name": parameter.Name, "in": "query", "schema": schema}
+		if len(parameter.Description) != 0 {
+			query["description"] = parameter.Description
+		}
+		parameters = append(parameters, query)
+	}
+
+	status := operation.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := map[string]interface{}{"description": http.StatusText(status)}
+	if operation.Response != nil {
+		schema := schemas.schema(reflect.TypeOf(operation.Response))
+		if len(operation.List) != 0 && version != APIVersion1 {
+			schema = map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{operation.List: schema},
+				"required":   []string{operation.List},
+			}
+		}
+		success["content"] = map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+	}
+	described := map[string]interface{}{
+		"summary":    operation.Summary,
+		"parameters": parameters,
+		"responses": map[string]interface{}{
+			strconv.Itoa(status): success,
+			"default":            map[string]interface{}{"description": "Error, described in a plain text body"},
+		},
+	}
+	switch {
+	case operation.Body != nil:
+		described["requestBody"] = map[string]interface{}{
+			"content": map[string]interface{}{"application/json": map[string]interface{}{"schema": schemas.schema(reflect.TypeOf(operation.Body))}},
+		}
+	case len(operation.BodyType) != 0:
+		described["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  map[string]interface{}{operation.BodyType: map[string]interface{}{"schema": map[string]interface{}{"type": "string", "format": "binary"}}},
+		}
+	}
+	return described
+}
+
+// openAPIDocument describes the admin and stats APIs of every version, and the admin API of tenants
+func openAPIDocument() map[string]interface{} {
+	schemas := openAPISchemas{}
+	paths := map[string]map[string]interface{}{}
+	add := func(prefix string, version string, operations []apiOperation, deprecated bool) {
+		for _, operation := range operations {
+			path := prefix + operation.Pattern
+			if paths[path] == nil {
+				paths[path] = map[string]interface{}{}
+			}
+			described := schemas.openAPIOperation(operation, version, path)
+			if deprecated {
+				described["deprecated"] = true
+			}
+			paths[path][strings.ToLower(operation.Method)] = described
+		}
+	}
+	for _, version := range []string{APIVersion1, APIVersion2} {
+		add("/api/"+version+"/admin", version, adminOperations, false)
+		add("/api/"+version+"/stats", version, statsOperations, false)
+		add("/t/{tenant}/api/"+version+"/admin", version, tenantOperations(), false)
+	}
+	add("/api/admin", APIVersion1, adminOperations, true)
+	add("/api/stats", APIVersion1, statsOperations, true)
+	add("/t/{tenant}/api/admin", APIVersion1, tenantOperations(), true)
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "go-update admin API",
+			"version":     APIVersion2,
+			"description": "Admin and stats endpoints of the extension update server. Update checks follow the Omaha protocol and aren't described here.",
+		},
+		"security": []interface{}{map[string]interface{}{"bearer": []string{}}},
+		"paths":    paths,
+		"components": map[string]interface{}{
+			"schemas":         schemas,
+			"securitySchemes": map[string]interface{}{"bearer": map[string]interface{}{"type": "http", "scheme": "bearer"}},
+		},
+	}
+}
+
+// GetOpenAPI is the handler for the OpenAPI 3 document of the admin and stats APIs
+func GetOpenAPI(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, http.StatusOK, openAPIDocument())
+}
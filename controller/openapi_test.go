@@ -0,0 +1,57 @@
+package controller_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/brave/go-update/controller"
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOpenAPI(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "/openapi.json", nil)
+	assert.Nil(t, err)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	document := struct {
+		OpenAPI string                                       `json:"openapi"`
+		Paths   map[string]map[string]map[string]interface{} `json:"paths"`
+	}{}
+	assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &document))
+	assert.Equal(t, "3.0.3", document.OpenAPI)
+
+	// Every admin and stats route is described
+	routers := map[string]chi.Routes{
+		"/api/v2/admin":            controller.AdminRouter(nil),
+		"/api/v1/stats":            controller.StatsRouter(nil),
+		"/t/{tenant}/api/v2/admin": controller.TenantRouter(nil),
+	}
+	for prefix, router := range routers {
+		err = chi.Walk(router, func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+			// Walk marks where routers are mounted with /*
+			route = strings.Replace(route, "/*", "", -1)
+			if strings.HasPrefix(prefix, "/t/") {
+				if !strings.HasPrefix(route, "/api/v2/admin/") {
+					return nil
+				}
+				route = strings.TrimPrefix(route, "/api/v2/admin")
+			}
+			assert.Contains(t, document.Paths[prefix+route], strings.ToLower(method), prefix+route)
+			return nil
+		})
+		assert.Nil(t, err)
+	}
+
+	// Lists are wrapped in an object from v2 on
+	v1 := document.Paths["/api/v1/admin/catalog"]["get"]["responses"].(map[string]interface{})["200"]
+	v2 := document.Paths["/api/v2/admin/catalog"]["get"]["responses"].(map[string]interface{})["200"]
+	assert.Contains(t, fmt.Sprint(v1), "type:array")
+	assert.Contains(t, fmt.Sprint(v2), "extensions:map[items")
+	assert.Contains(t, rr.Body.String(), `"Extension":{"properties":{"actions":{"items":{"$ref":"#/components/schemas/Action"},"type":"array"},"blacklisted":{"type":"boolean"}`)
+}
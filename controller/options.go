@@ -0,0 +1,33 @@
+package controller
+
+import (
+	"net/http"
+)
+
+// updateCheckMethods are the methods update checks can be sent with
+const updateCheckMethods = "GET, HEAD, POST, OPTIONS"
+
+// allowUpdateChecksFromAnyOrigin answers OPTIONS requests for update checks with the methods they can be sent with,
+// and lets pages from any origin read the responses. Update checks are public and need no credentials, so embedded
+// webviews may send them too.
+func allowUpdateChecksFromAnyOrigin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.Header.Get("Origin")) != 0 {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		}
+		if r.Method != http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Allow", updateCheckMethods)
+		// A CORS preflight
+		if len(r.Header.Get("Access-Control-Request-Method")) != 0 {
+			w.Header().Set("Access-Control-Allow-Methods", updateCheckMethods)
+			if headers := r.Header.Get("Access-Control-Request-Headers"); len(headers) != 0 {
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+			}
+			w.Header().Set("Access-Control-Max-Age", "86400")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
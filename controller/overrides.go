@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"github.com/brave/go-update/extension"
+	"net/http"
+)
+
+// Actions of an AppOverride
+const (
+	// OverrideServe answers update checks from the catalog only, so checks for the app are never redirected
+	// even when the catalog doesn't have it
+	OverrideServe = "serve"
+	// OverrideRedirect redirects update checks for only the app to UpstreamURL, or WebStoreURL for GET checks,
+	// even when the catalog has it. Either one which is empty is the fallback URL.
+	OverrideRedirect = "redirect"
+	// OverrideProxy answers update checks with what the update server at UpstreamURL offers, see Passthrough
+	OverrideProxy = "proxy"
+	// OverrideBlock offers no update for the app and never redirects checks for it
+	OverrideBlock = "block"
+)
+
+// AppOverride replaces how update checks for one app are answered, instead of from the catalog with
+// checks for only an app it doesn't have redirected to the fallback URLs
+type AppOverride struct {
+	Action      string
+	UpstreamURL string
+	WebStoreURL string
+}
+
+// appOverride returns the override of the app with id in the settings of opts, and false if it has none
+func (opts *Options) appOverride(id string) (AppOverride, bool) {
+	override, ok := opts.settings().AppOverrides[id]
+	return override, ok
+}
+
+// responder returns the Responder answering update checks for the app, or nil for the actions which
+// leave them to the catalog
+func (override AppOverride) responder() Responder {
+	switch override.Action {
+	case OverrideProxy:
+		return Passthrough{Mode: PassthroughProxy, UpstreamURL: override.UpstreamURL}.Responder()
+	case OverrideBlock:
+		return blockUpdates
+	}
+	return nil
+}
+
+// blockUpdates is the Responder of blocked apps, which offers no update
+func blockUpdates(r *http.Request, checked extension.Extension) (extension.Extension, bool) {
+	return extension.Extension{}, false
+}
+
+// redirectURLsFor returns where an update check in r for only the app with id is redirected, like fallbackURLsFor,
+// and false if it is answered here: from the catalog when known is true, or because of its override
+func redirectURLsFor(opts *Options, r *http.Request, id string, known bool) (string, string, bool) {
+	webStoreURL, componentUpdaterURL := fallbackURLsFor(opts, r)
+	override, ok := opts.appOverride(id)
+	if !ok {
+		return webStoreURL, componentUpdaterURL, !known
+	}
+	if override.Action != OverrideRedirect {
+		return "", "", false
+	}
+	if len(override.WebStoreURL) != 0 {
+		webStoreURL = override.WebStoreURL
+	}
+	if len(override.UpstreamURL) != 0 {
+		componentUpdaterURL = override.UpstreamURL
+	}
+	return webStoreURL, componentUpdaterURL, true
+}
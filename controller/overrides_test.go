@@ -0,0 +1,80 @@
+package controller_test
+
+import (
+	"fmt"
+	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/extension/extensiontest"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestAppOverrides(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<response protocol="3.1"><app appid="ccccccccccccccccccccccccccccccca" status="ok"><updatecheck status="ok">
+			<urls><url codebase="https://dl.example.com/c.crx"/></urls>
+			<manifest version="3.0.0"><packages><package name="c.crx" hash_sha256="abc" required="true"/></packages></manifest>
+		</updatecheck></app></response>`)
+	}))
+	defer upstream.Close()
+	known := "bfdgpgibhagkpdlnjonhkabjoijopoge"
+	handlerOptions.UpdateSettings(func(settings *controller.Settings) {
+		settings.AppOverrides = map[string]controller.AppOverride{
+			known:                              {Action: controller.OverrideBlock},
+			"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa": {Action: controller.OverrideServe},
+			"ldimlcelhnjgpjjemdjokpgeeikdinbm": {Action: controller.OverrideRedirect, UpstreamURL: "https://updates.example.com/update2", WebStoreURL: "https://updates.example.com/crx"},
+			"bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb": {Action: controller.OverrideRedirect},
+			"ccccccccccccccccccccccccccccccca": {Action: controller.OverrideProxy, UpstreamURL: upstream.URL},
+		}
+	})
+	defer handlerOptions.UpdateSettings(func(settings *controller.Settings) {
+		settings.AppOverrides = map[string]controller.AppOverride{}
+	})
+	check := func(id string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/extensions", strings.NewReader(extensiontest.ExtensionRequestFnFor(id)("0.0.1"))))
+		return rr
+	}
+	webStoreCheck := func(id string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/extensions?x="+url.QueryEscape("id="+id+"&v=0.0.1"), nil))
+		return rr
+	}
+
+	// Blocked apps are offered no update even though the catalog has them
+	rr := check(known)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotContains(t, rr.Body.String(), "updatecheck")
+	rr = webStoreCheck(known)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotContains(t, rr.Body.String(), "updatecheck")
+
+	// Served apps the catalog doesn't have aren't redirected
+	rr = check("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotContains(t, rr.Body.String(), "updatecheck")
+	assert.Equal(t, http.StatusOK, webStoreCheck("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa").Code)
+
+	// Redirected apps are redirected to their own URLs, or the fallback URLs, even when the catalog has them
+	rr = check("ldimlcelhnjgpjjemdjokpgeeikdinbm")
+	assert.Equal(t, http.StatusTemporaryRedirect, rr.Code)
+	assert.Equal(t, "https://updates.example.com/update2?braveRedirect=true", rr.Header().Get("Location"))
+	rr = webStoreCheck("ldimlcelhnjgpjjemdjokpgeeikdinbm")
+	assert.Equal(t, http.StatusTemporaryRedirect, rr.Code)
+	assert.True(t, strings.HasPrefix(rr.Header().Get("Location"), "https://updates.example.com/crx?x="))
+	rr = check("bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")
+	assert.Equal(t, http.StatusTemporaryRedirect, rr.Code)
+	assert.Equal(t, "https://update.googleapis.com/service/update2?braveRedirect=true", rr.Header().Get("Location"))
+
+	// Proxied apps are offered what the upstream server offers
+	rr = check("ccccccccccccccccccccccccccccccca")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `<url codebase="https://dl.example.com/c.crx"></url>`)
+	assert.Contains(t, rr.Body.String(), `<manifest version="3.0.0">`)
+
+	// Apps without an override are still redirected when the catalog doesn't have them
+	assert.Equal(t, http.StatusTemporaryRedirect, check("dddddddddddddddddddddddddddddddd").Code)
+}
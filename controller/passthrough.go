@@ -0,0 +1,200 @@
+package controller
+
+import (
+	"context"
+	"github.com/brave/go-update/client"
+	"github.com/brave/go-update/extension"
+	"github.com/pressly/lg"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Modes of a Passthrough
+const (
+	// PassthroughProxy answers update checks with what the upstream server offers, so the packages are
+	// downloaded from it and never copied
+	PassthroughProxy = "proxy"
+	// PassthroughMirror answers update checks from the catalog record for the platforms with mirrored
+	// copies, and proxies the others
+	PassthroughMirror = "mirror"
+)
+
+// Passthrough answers update checks for a third party component, like the Widevine CDM, whose packages
+// this server may not be allowed to serve to everyone. Without one, checks for it alone are redirected to
+// ComponentUpdaterFallbackURL like any extension which isn't in the catalog, and checks for it with
+// other extensions get no answer for it.
+type Passthrough struct {
+	Mode string
+	// UpstreamURL is the update server checks are proxied to. Without one, mirrored components
+	// offer no update to the platforms they have no copies for.
+	UpstreamURL string
+	// Platforms are the os, or os and arch like win_x64, of the clients served the mirrored copies.
+	// The catalog record offers each of them its variant with targeting rules.
+	Platforms []string
+}
+
+// passthroughCacheTTL is how long the upstream answers are reused for clients checking from the same version and platform,
+// passthroughStaleTTL how long after that they are still served while they are refreshed, and passthroughCacheSize
+// bounds the number kept, which are all dropped when it is reached
+const (
+	passthroughCacheTTL  = time.Minute
+	passthroughStaleTTL  = 10 * time.Minute
+	passthroughCacheSize = 4096
+)
+
+// passthroughTimeout is the deadline of proxied update checks on DefaultClock, after which they are given up on
+// rather than holding up the client's check
+const passthroughTimeout = 10 * time.Second
+
+// passthroughClient sends proxied update checks. Its timeout only backs up passthroughTimeout.
+var passthroughClient = &http.Client{Timeout: passthroughTimeout}
+
+// passthroughKey identifies the clients sent the same answer by an upstream server
+type passthroughKey struct {
+	UpstreamURL string
+	ID          string
+	Version     string
+	ProdVersion string
+	Channel     string
+	Platform    string
+	Arch        string
+}
+
+type passthroughAnswer struct {
+	update  extension.Extension
+	offered bool
+	expires time.Time
+}
+
+// passthroughCheck is an upstream check in progress, which every client with the same key waits for
+// instead of sending its own. done is closed once answer is set, and ok is false if the check failed.
+type passthroughCheck struct {
+	done   chan struct{}
+	answer passthroughAnswer
+	ok     bool
+}
+
+var (
+	passthroughMutex   sync.Mutex
+	passthroughAnswers = map[passthroughKey]passthroughAnswer{}
+	passthroughChecks  = map[passthroughKey]*passthroughCheck{}
+)
+
+// Responder returns the Responder answering update checks for the component, see RegisterResponder
+func (passthrough Passthrough) Responder() Responder {
+	return func(r *http.Request, checked extension.Extension) (extension.Extension, bool) {
+		if passthrough.Mode == PassthroughMirror && passthrough.mirrors(checked) {
+			return mirroredUpdate(r, checked)
+		}
+		if len(passthrough.UpstreamURL) == 0 {
+			return extension.Extension{}, false
+		}
+		return passthrough.proxy(r, checked)
+	}
+}
+
+// mirrors returns true if the client checking is on one of the mirrored platforms
+func (passthrough Passthrough) mirrors(checked extension.Extension) bool {
+	for _, platform := range passthrough.Platforms {
+		if strings.EqualFold(platform, checked.Platform) || strings.EqualFold(platform, checked.Platform+"_"+checked.Arch) {
+			return true
+		}
+	}
+	return false
+}
+
+// mirroredUpdate returns the mirrored copy the catalog of r offers the client, like it would offer any extension
+func mirroredUpdate(r *http.Request, checked extension.Extension) (extension.Extension, bool) {
+	ext, ok := catalogFor(r)[checked.ID]
+	if !ok || ext.Blacklisted {
+		return extension.Extension{}, false
+	}
+	ext, offered := ext.Target(checked)
+	if !offered || optionsFor(r.Context()).isPackageMissing(ext) || extension.CompareVersions(checked.Version, ext.Version) >= 0 {
+		return extension.Extension{}, false
+	}
+	return ext, true
+}
+
+// proxy returns the update the upstream server offers the client, with its download URLs.
+// Only one check per key is sent upstream at a time, and expired answers are served while it runs,
+// so answers expiring under load don't send every client's check upstream.
+// Failed checks are logged and offer no update, so the client checks again later.
+func (passthrough Passthrough) proxy(r *http.Request, checked extension.Extension) (extension.Extension, bool) {
+	key := passthroughKey{
+		UpstreamURL: passthrough.UpstreamURL,
+		ID:          checked.ID,
+		Version:     checked.Version,
+		ProdVersion: checked.ProdVersion,
+		Channel:     checked.Channel,
+		Platform:    checked.Platform,
+		Arch:        checked.Arch,
+	}
+	now := DefaultClock.Now()
+	passthroughMutex.Lock()
+	answer, cached := passthroughAnswers[key]
+	if cached && now.Before(answer.expires) {
+		passthroughMutex.Unlock()
+		return answer.update, answer.offered
+	}
+	check, checking := passthroughChecks[key]
+	if !checking {
+		check = &passthroughCheck{done: make(chan struct{})}
+		passthroughChecks[key] = check
+		go passthrough.check(lg.Log(r.Context()), key, check)
+	}
+	passthroughMutex.Unlock()
+
+	if cached && now.Before(answer.expires.Add(passthroughStaleTTL)) {
+		return answer.update, answer.offered
+	}
+	select {
+	case <-check.done:
+		return check.answer.update, check.answer.offered
+	case <-r.Context().Done():
+		return extension.Extension{}, false
+	}
+}
+
+// check sends the update check of the clients with key upstream and caches the answer.
+// It isn't canceled with the request which started it, since other clients wait for it too.
+func (passthrough Passthrough) check(logger logrus.FieldLogger, key passthroughKey, check *passthroughCheck) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	timer := DefaultClock.AfterFunc(passthroughTimeout, cancel)
+	defer timer.Stop()
+
+	upstream := &client.Client{
+		URL:        passthrough.UpstreamURL,
+		Format:     client.XML,
+		HTTPClient: passthroughClient,
+		Request:    client.Request{ProdVersion: key.ProdVersion, Channel: key.Channel, OS: key.Platform, Arch: key.Arch},
+	}
+	updates, err := upstream.Check(ctx, client.App{ID: key.ID, Version: key.Version})
+	if err != nil {
+		logger.Errorf("Error proxying update check for %s to %s: %v", key.ID, passthrough.UpstreamURL, err)
+	} else {
+		check.answer.expires = DefaultClock.Now().Add(passthroughCacheTTL)
+		check.ok = true
+		for _, update := range updates {
+			if update.ID == key.ID && update.Available() {
+				check.answer.update = extension.Extension{Version: update.Version, SHA256: update.SHA256, Size: update.Size, URLs: update.URLs}
+				check.answer.offered = true
+			}
+		}
+	}
+
+	passthroughMutex.Lock()
+	delete(passthroughChecks, key)
+	if check.ok {
+		if len(passthroughAnswers) >= passthroughCacheSize {
+			passthroughAnswers = map[passthroughKey]passthroughAnswer{}
+		}
+		passthroughAnswers[key] = check.answer
+	}
+	passthroughMutex.Unlock()
+	close(check.done)
+}
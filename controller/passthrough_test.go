@@ -0,0 +1,168 @@
+package controller_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/extension/extensiontest"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestComponentPassthrough(t *testing.T) {
+	var mutex sync.Mutex
+	checks := []string{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := struct {
+			OS   string `xml:"os,attr"`
+			Arch string `xml:"arch,attr"`
+			App  struct {
+				AppID   string `xml:"appid,attr"`
+				Version string `xml:"version,attr"`
+			} `xml:"app"`
+		}{}
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Nil(t, xml.Unmarshal(body, &request))
+		mutex.Lock()
+		checks = append(checks, request.App.AppID+" "+request.OS+"_"+request.Arch)
+		mutex.Unlock()
+		if request.App.Version == "4.10.2710.0" {
+			fmt.Fprintf(w, `<response protocol="3.1"><app appid="%s" status="ok"><updatecheck status="noupdate"/></app></response>`, request.App.AppID)
+			return
+		}
+		fmt.Fprintf(w, `<response protocol="3.1"><app appid="%s" status="ok"><updatecheck status="ok">
+			<urls><url codebase="https://dl.example.com/widevine/"/></urls>
+			<manifest version="4.10.2710.0"><packages><package name="widevine_%s_%s.crx" hash_sha256="abc" size="1024" required="true"/></packages></manifest>
+		</updatecheck></app></response>`, request.App.AppID, request.OS, request.Arch)
+	}))
+	defer upstream.Close()
+	proxied := "oimompecagnajdejgnnjijobebaeigek"
+	mirrored := "bfdgpgibhagkpdlnjonhkabjoijopoge"
+	controller.RegisterResponder(proxied, controller.Passthrough{Mode: controller.PassthroughProxy, UpstreamURL: upstream.URL}.Responder())
+	defer controller.RegisterResponder(proxied, nil)
+	controller.RegisterResponder(mirrored, controller.Passthrough{Mode: controller.PassthroughMirror, UpstreamURL: upstream.URL, Platforms: []string{"linux_x64"}}.Responder())
+	defer controller.RegisterResponder(mirrored, nil)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	check := func(os string, versions ...string) string {
+		apps := []string{}
+		for i := 0; i < len(versions); i += 2 {
+			apps = append(apps, `{"appid":"`+versions[i]+`","version":"`+versions[i+1]+`","updatecheck":{}}`)
+		}
+		requestBody := `{"request":{"protocol":"4.0","@os":"` + os + `","arch":"x64","apps":[` + strings.Join(apps, ",") + `]}}`
+		resp, err := http.Post(server.URL+"/extensions", "application/json", bytes.NewBufferString(requestBody))
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		body, err := ioutil.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		return string(body)
+	}
+
+	// The proxied component is offered what the upstream server offers, downloaded from there,
+	// rather than the client being redirected, and also when it is checked with other extensions
+	body := check("win", proxied, "4.10.2600.0")
+	assert.Contains(t, body, `"nextversion":"4.10.2710.0"`)
+	assert.Contains(t, body, `"url":"https://dl.example.com/widevine/widevine_win_x64.crx"`)
+	body = check("win", proxied, "4.10.2600.0", "ldimlcelhnjgpjjemdjokpgeeikdinbm", "0.0.0")
+	assert.Contains(t, body, `"url":"https://dl.example.com/widevine/widevine_win_x64.crx"`)
+	assert.Equal(t, []string{proxied + " win_x64"}, checks, "the upstream answer is reused")
+	assert.NotContains(t, check("win", proxied, "4.10.2710.0"), "nextversion")
+
+	// Mirrored copies are only served to the platforms they are mirrored for, and the others are proxied
+	body = check("linux", mirrored, "0.0.1")
+	assert.Contains(t, body, `"nextversion":"1.0.0"`)
+	assert.Contains(t, body, "brave-core-ext.s3.brave.com")
+	body = check("mac", mirrored, "0.0.1")
+	assert.Contains(t, body, `"nextversion":"4.10.2710.0"`)
+	assert.Contains(t, body, "widevine_mac_x64.crx")
+	assert.Equal(t, []string{proxied + " win_x64", proxied + " win_x64", mirrored + " mac_x64"}, checks)
+}
+
+func TestComponentPassthroughChecks(t *testing.T) {
+	var mutex sync.Mutex
+	version := "2.0.0"
+	release := make(chan bool)
+	var upstreamChecks int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&upstreamChecks, 1)
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		fmt.Fprintf(w, `<response protocol="3.1"><app appid="oimompecagnajdejgnnjijobebaeigek" status="ok"><updatecheck status="ok">
+			<urls><url codebase="https://dl.example.com/widevine/"/></urls>
+			<manifest version="%s"><packages><package name="widevine.crx" hash_sha256="abc" required="true"/></packages></manifest>
+		</updatecheck></app></response>`, version)
+	}))
+	defer upstream.Close()
+	defer close(release)
+	proxied := "oimompecagnajdejgnnjijobebaeigek"
+	controller.RegisterResponder(proxied, controller.Passthrough{Mode: controller.PassthroughProxy, UpstreamURL: upstream.URL}.Responder())
+	defer controller.RegisterResponder(proxied, nil)
+	check := func(version string) string {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/extensions", strings.NewReader(extensiontest.ExtensionRequestFnFor(proxied)(version))))
+		assert.Equal(t, http.StatusOK, rr.Code)
+		return rr.Body.String()
+	}
+	waitForChecks := func(n int64) {
+		for i := 0; i < 100 && atomic.LoadInt64(&upstreamChecks) < n; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		assert.Equal(t, n, atomic.LoadInt64(&upstreamChecks))
+	}
+
+	// Clients checking at the same time wait for a single upstream check
+	var wg sync.WaitGroup
+	bodies := make([]string, 10)
+	for i := range bodies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			bodies[i] = check("1.0.0")
+		}(i)
+	}
+	waitForChecks(1)
+	time.Sleep(50 * time.Millisecond)
+	release <- true
+	wg.Wait()
+	for _, body := range bodies {
+		assert.Contains(t, body, `version="2.0.0"`)
+	}
+	assert.Equal(t, int64(1), atomic.LoadInt64(&upstreamChecks))
+
+	// Expired answers are served without waiting while one check refreshes them
+	mutex.Lock()
+	version = "3.0.0"
+	mutex.Unlock()
+	testClock.Advance(time.Minute)
+	assert.Contains(t, check("1.0.0"), `version="2.0.0"`)
+	assert.Contains(t, check("1.0.0"), `version="2.0.0"`)
+	waitForChecks(2)
+	release <- true
+	for i := 0; i < 100 && !strings.Contains(check("1.0.0"), `version="3.0.0"`); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Contains(t, check("1.0.0"), `version="3.0.0"`)
+	assert.Equal(t, int64(2), atomic.LoadInt64(&upstreamChecks))
+
+	// Upstream checks are given up on once the deadline passes on the clock
+	done := make(chan string)
+	go func() {
+		done <- check("1.5.0")
+	}()
+	waitForChecks(3)
+	testClock.Advance(10 * time.Second)
+	assert.NotContains(t, <-done, "updatecheck status=\"ok\"")
+}
@@ -0,0 +1,238 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/pressly/lg"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// ForceInstallEntry is an extension an organization wants force installed, and where it is updated from
+type ForceInstallEntry struct {
+	ID        string `json:"id"`
+	UpdateURL string `json:"updateUrl,omitempty"`
+}
+
+// forceInstallList maps the ID of each extension force installed with some Options to its own update URL, if it has one
+type forceInstallList struct {
+	mutex      sync.RWMutex
+	updateURLs map[string]string
+}
+
+// extensionIDRegexp matches Chromium extension IDs, which are 32 letters from a to p
+var extensionIDRegexp = regexp.MustCompile(`^[a-p]{32}$`)
+
+// PolicyRouter is the router for /policy endpoints, which serve group policy for Chromium
+func PolicyRouter(opts *Options) chi.Router {
+	r := chi.NewRouter()
+	r.Use(ServeWith(opts))
+	r.Get("/forcelist", GetForceInstallPolicy)
+	return r
+}
+
+// LoadForceInstallList replaces the force install list of opts with the one in its ForceInstallFile, if it exists
+func (opts *Options) LoadForceInstallList() error {
+	if len(opts.ForceInstallFile) == 0 {
+		return nil
+	}
+	data, err := ioutil.ReadFile(opts.ForceInstallFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	entries := []ForceInstallEntry{}
+	err = json.Unmarshal(data, &entries)
+	if err != nil {
+		return fmt.Errorf("%s: %v", opts.ForceInstallFile, err)
+	}
+	updateURLs := map[string]string{}
+	for _, entry := range entries {
+		updateURLs[entry.ID] = entry.UpdateURL
+	}
+	opts.forceInstall.mutex.Lock()
+	defer opts.forceInstall.mutex.Unlock()
+	opts.forceInstall.updateURLs = updateURLs
+	return nil
+}
+
+// forceInstallEntries returns the force install list of opts sorted by ID
+func (opts *Options) forceInstallEntries() []ForceInstallEntry {
+	entries := []ForceInstallEntry{}
+	if opts == nil {
+		return entries
+	}
+	opts.forceInstall.mutex.RLock()
+	defer opts.forceInstall.mutex.RUnlock()
+	for id, updateURL := range opts.forceInstall.updateURLs {
+		entries = append(entries, ForceInstallEntry{ID: id, UpdateURL: updateURL})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ID < entries[j].ID
+	})
+	return entries
+}
+
+// put force installs the extension of entry, returning the update URL it had before if it was already force installed
+func (list *forceInstallList) put(entry ForceInstallEntry) (string, bool) {
+	list.mutex.Lock()
+	defer list.mutex.Unlock()
+	updateURL, existed := list.updateURLs[entry.ID]
+	if list.updateURLs == nil {
+		list.updateURLs = map[string]string{}
+	}
+	list.updateURLs[entry.ID] = entry.UpdateURL
+	return updateURL, existed
+}
+
+// remove stops force installing the extension with id, returning the update URL it had if it was force installed
+func (list *forceInstallList) remove(id string) (string, bool) {
+	list.mutex.Lock()
+	defer list.mutex.Unlock()
+	updateURL, ok := list.updateURLs[id]
+	delete(list.updateURLs, id)
+	return updateURL, ok
+}
+
+// saveForceInstallList writes the force install list of opts to its ForceInstallFile.
+// It is written to a temporary file first so a crash can't leave it half written.
+func (opts *Options) saveForceInstallList() error {
+	if len(opts.ForceInstallFile) == 0 {
+		return nil
+	}
+	data, err := json.MarshalIndent(opts.forceInstallEntries(), "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(opts.ForceInstallFile), ".forcelist")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), opts.ForceInstallFile)
+}
+
+// policyUpdateURL returns the update URL for force installed extensions without their own
+func (opts *Options) policyUpdateURL(r *http.Request) string {
+	if opts != nil && len(opts.PolicyUpdateURL) != 0 {
+		return opts.PolicyUpdateURL
+	}
+	return "https://" + r.Host + "/extensions"
+}
+
+// GetForceInstallPolicy is the handler for the force install list in the form Chromium group policy expects.
+// By default it is the ExtensionInstallForcelist policy, and with ?format=settings it is the ExtensionSettings policy.
+func GetForceInstallPolicy(w http.ResponseWriter, r *http.Request) {
+	opts := optionsFor(r.Context())
+	defaultUpdateURL := opts.policyUpdateURL(r)
+	var policy interface{}
+	if r.URL.Query().Get("format") == "settings" {
+		type Settings struct {
+			InstallationMode string `json:"installation_mode"`
+			UpdateURL        string `json:"update_url"`
+		}
+		settings := map[string]Settings{}
+		for _, entry := range opts.forceInstallEntries() {
+			if len(entry.UpdateURL) == 0 {
+				entry.UpdateURL = defaultUpdateURL
+			}
+			settings[entry.ID] = Settings{InstallationMode: "force_installed", UpdateURL: entry.UpdateURL}
+		}
+		policy = map[string]interface{}{"ExtensionSettings": settings}
+	} else {
+		forcelist := []string{}
+		for _, entry := range opts.forceInstallEntries() {
+			if len(entry.UpdateURL) == 0 {
+				entry.UpdateURL = defaultUpdateURL
+			}
+			forcelist = append(forcelist, entry.ID+";"+entry.UpdateURL)
+		}
+		policy = map[string]interface{}{"ExtensionInstallForcelist": forcelist}
+	}
+	writeJSON(w, r, http.StatusOK, policy)
+}
+
+// GetForceInstallList is the admin handler for listing the force install list
+func GetForceInstallList(w http.ResponseWriter, r *http.Request) {
+	writeList(w, r, "extensions", optionsFor(r.Context()).forceInstallEntries())
+}
+
+// PutForceInstallEntry is the admin handler for force installing an extension.
+// The optional body is a ForceInstallEntry with its own update URL.
+func PutForceInstallEntry(w http.ResponseWriter, r *http.Request) {
+	log := lg.Log(r.Context())
+	id := chi.URLParam(r, "id")
+	if !extensionIDRegexp.MatchString(id) {
+		http.Error(w, fmt.Sprintf("Invalid extension ID: %s", id), http.StatusBadRequest)
+		return
+	}
+	entry := ForceInstallEntry{}
+	err := json.NewDecoder(io.LimitReader(r.Body, 1024*1024)).Decode(&entry)
+	if err != nil && err != io.EOF {
+		http.Error(w, fmt.Sprintf("Error reading body: %v", err), http.StatusBadRequest)
+		return
+	}
+	entry.ID = id
+	opts := optionsFor(r.Context())
+	if opts == nil {
+		http.Error(w, "The force install list can't be changed without options", http.StatusNotImplemented)
+		return
+	}
+
+	updateURL, existed := opts.forceInstall.put(entry)
+	err = opts.saveForceInstallList()
+	if err != nil {
+		captureRequestError(r, err)
+		http.Error(w, fmt.Sprintf("Error saving force install list: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if existed {
+		audit(r.Context(), AuditUpdate, "policy/forcelist/"+id, ForceInstallEntry{ID: id, UpdateURL: updateURL}, entry)
+	} else {
+		audit(r.Context(), AuditCreate, "policy/forcelist/"+id, nil, entry)
+	}
+	log.Infof("Force installing extension %s", id)
+	writeJSON(w, r, http.StatusOK, entry)
+}
+
+// DeleteForceInstallEntry is the admin handler for no longer force installing an extension
+func DeleteForceInstallEntry(w http.ResponseWriter, r *http.Request) {
+	log := lg.Log(r.Context())
+	id := chi.URLParam(r, "id")
+	opts := optionsFor(r.Context())
+	if opts == nil {
+		http.NotFound(w, r)
+		return
+	}
+	updateURL, ok := opts.forceInstall.remove(id)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	err := opts.saveForceInstallList()
+	if err != nil {
+		captureRequestError(r, err)
+		http.Error(w, fmt.Sprintf("Error saving force install list: %v", err), http.StatusInternalServerError)
+		return
+	}
+	audit(r.Context(), AuditDelete, "policy/forcelist/"+id, ForceInstallEntry{ID: id, UpdateURL: updateURL}, nil)
+	log.Infof("No longer force installing extension %s", id)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,75 @@
+package controller_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/brave/go-update/controller"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestForceInstallPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-update-policy")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	opts := &controller.Options{ForceInstallFile: filepath.Join(dir, "forcelist.json")}
+	server := httptest.NewServer(newTestHandler(opts))
+	defer server.Close()
+	admin := func(method string, id string, body string) int {
+		req, err := http.NewRequest(method, server.URL+"/api/admin/policy/forcelist/"+id, bytes.NewBufferString(body))
+		assert.Nil(t, err)
+		req.Header.Set("Authorization", "Bearer test-token")
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		return resp.StatusCode
+	}
+	getPolicy := func(query string) string {
+		resp, err := http.Get(server.URL + "/policy/forcelist" + query)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		actual, err := ioutil.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		return string(actual)
+	}
+
+	assert.Equal(t, http.StatusOK, admin(http.MethodPut, "ldimlcelhnjgpjjemdjokpgeeikdinbm", ""))
+	defer admin(http.MethodDelete, "ldimlcelhnjgpjjemdjokpgeeikdinbm", "")
+	assert.Equal(t, http.StatusOK, admin(http.MethodPut, "aomjjhallfgjeglblehebfpbcfeobpgk", `{"updateUrl":"https://clients2.google.com/service/update2/crx"}`))
+	assert.Equal(t, http.StatusBadRequest, admin(http.MethodPut, "not-an-id", ""))
+	host := strings.TrimPrefix(server.URL, "http://")
+	assert.Equal(t, `{"ExtensionInstallForcelist":["aomjjhallfgjeglblehebfpbcfeobpgk;https://clients2.google.com/service/update2/crx","ldimlcelhnjgpjjemdjokpgeeikdinbm;https://`+host+`/extensions"]}`, getPolicy(""))
+	assert.Equal(t, `{"ExtensionSettings":{"aomjjhallfgjeglblehebfpbcfeobpgk":{"installation_mode":"force_installed","update_url":"https://clients2.google.com/service/update2/crx"},"ldimlcelhnjgpjjemdjokpgeeikdinbm":{"installation_mode":"force_installed","update_url":"https://`+host+`/extensions"}}}`, getPolicy("?format=settings"))
+
+	// Changes are saved so they are loaded again after a restart
+	assert.Equal(t, http.StatusNoContent, admin(http.MethodDelete, "aomjjhallfgjeglblehebfpbcfeobpgk", ""))
+	assert.Equal(t, http.StatusNotFound, admin(http.MethodDelete, "aomjjhallfgjeglblehebfpbcfeobpgk", ""))
+	data, err := ioutil.ReadFile(opts.ForceInstallFile)
+	assert.Nil(t, err)
+	entries := []controller.ForceInstallEntry{}
+	assert.Nil(t, json.Unmarshal(data, &entries))
+	assert.Equal(t, []controller.ForceInstallEntry{{ID: "ldimlcelhnjgpjjemdjokpgeeikdinbm"}}, entries)
+	restarted := &controller.Options{ForceInstallFile: opts.ForceInstallFile, PolicyUpdateURL: "https://updates.example.com/extensions"}
+	assert.Nil(t, restarted.LoadForceInstallList())
+	restartedServer := httptest.NewServer(newTestHandler(restarted))
+	defer restartedServer.Close()
+	resp, err := http.Get(restartedServer.URL + "/policy/forcelist")
+	assert.Nil(t, err)
+	actual, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"ExtensionInstallForcelist":["ldimlcelhnjgpjjemdjokpgeeikdinbm;https://updates.example.com/extensions"]}`, string(actual))
+
+	// Other handlers have their own list
+	sharedServer := httptest.NewServer(handler)
+	defer sharedServer.Close()
+	resp, err = http.Get(sharedServer.URL + "/policy/forcelist")
+	assert.Nil(t, err)
+	actual, err = ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"ExtensionInstallForcelist":[]}`, string(actual))
+}
@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/brave/go-update/extension"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// responseBuffers are reused for encoding XML update responses, so the hot path doesn't allocate them
+var responseBuffers = sync.Pool{
+	New: func() interface{} {
+		buffer := make([]byte, 0, 4096)
+		return &buffer
+	},
+}
+
+// maxPooledBuffer is the largest buffer put back in responseBuffers, so a few very large responses don't keep memory
+const maxPooledBuffer = 64 * 1024
+
+// getResponseBuffer returns an empty buffer from responseBuffers, which should be put back with putResponseBuffer
+func getResponseBuffer() *[]byte {
+	buffer := responseBuffers.Get().(*[]byte)
+	*buffer = (*buffer)[:0]
+	return buffer
+}
+
+// putResponseBuffer puts buffer back in responseBuffers once what was encoded in it has been written
+func putResponseBuffer(buffer *[]byte) {
+	if cap(*buffer) <= maxPooledBuffer {
+		responseBuffers.Put(buffer)
+	}
+}
+
+// marshalUpdateResponse appends the encoded updateResponse for the update request body of r to dst
+func marshalUpdateResponse(r *http.Request, dst []byte, body []byte, updateResponse extension.UpdateResponse) []byte {
+	if !optionsFor(r.Context()).settings().MirrorProtocol {
+		return updateResponse.AppendXML(dst)
+	}
+	protocol, err := extension.ParseRequestProtocol(body)
+	if err != nil || len(protocol) == 0 {
+		// The body was already parsed successfully as an update request
+		protocol = extension.DefaultProtocol
+	}
+	response := extension.ProtocolUpdateResponse{Protocol: protocol, Extensions: updateResponse}
+	return response.AppendXML(dst)
+}
+
+// isProtocol4Request returns true if an update request body uses the protocol 4 JSON schema
+func isProtocol4Request(r *http.Request, body []byte) bool {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		return true
+	}
+	return strings.HasPrefix(strings.TrimSpace(string(body)), "{")
+}
+
+// serveProtocol4 answers a protocol 4 update request with the same updates as the XML protocol,
+// keeping the response for retries under dedupKey
+func (h *UpdateHandler) serveProtocol4(w http.ResponseWriter, r *http.Request, body []byte, dedupKey string) {
+	log := h.log(r)
+	updateRequest, err := extension.ParseJSONUpdateRequest(body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading body %v", err), errorStatus(err))
+		return
+	}
+	if h.redirectUnknownExtension(w, r, updateRequest) {
+		return
+	}
+	updateResponse, updates, hint := h.updateResponse(r, updateRequest, "omaha4")
+	data, err := json.Marshal(&extension.Protocol4Response{UpdateResponse: updateResponse})
+	if err != nil {
+		captureRequestError(r, err)
+		http.Error(w, fmt.Sprintf("Error in marshal JSON %v", err), http.StatusInternalServerError)
+		return
+	}
+	data = append([]byte(extension.Protocol4Prefix), data...)
+	if !isCanaryRequest(r) {
+		recordUpdatesServed(r.Context(), updateResponse[:updates], "omaha4")
+	}
+	setRetryAfter(w, hint)
+	w.Header().Set("content-type", "application/json")
+	rememberResponse(r, dedupKey, body, w.Header(), data)
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(data)
+	if err != nil {
+		log.Errorf("Error writing response: %v", err)
+	}
+}
+
+// isProtocol2Request returns true if a GET update check comes from a legacy client using protocol 2.0,
+// which sends either protocol=2.0 or v=2 alongside its x parameters
+func isProtocol2Request(query url.Values) bool {
+	return query.Get("protocol") == "2.0" || query.Get("v") == "2"
+}
+
+// wantsJSON returns true if a GET update check asks for JSON with format=json,
+// or with an Accept header listing JSON before XML
+func wantsJSON(r *http.Request) bool {
+	if format := r.URL.Query().Get("format"); len(format) != 0 {
+		return format == "json"
+	}
+	for _, mediaRange := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType := strings.TrimSpace(strings.Split(mediaRange, ";")[0])
+		switch {
+		case mediaType == "application/json":
+			return true
+		case mediaType == "application/xml" || mediaType == "text/xml":
+			return false
+		}
+	}
+	return false
+}
+
+// marshalWebStoreResponse appends webStoreResponse to dst in the gupdate shape and format the client asked for,
+// returning the encoded response and its content type. Protocol 2 responses have the time of day of now.
+func marshalWebStoreResponse(dst []byte, r *http.Request, webStoreResponse extension.WebStoreUpdateResponse, now time.Time) ([]byte, string, error) {
+	if wantsJSON(r) {
+		data, err := json.Marshal(&webStoreResponse)
+		return data, "application/json", err
+	}
+	if !isProtocol2Request(r.URL.Query()) {
+		return webStoreResponse.AppendXML(dst), "application/xml", nil
+	}
+	now = now.UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	response := extension.WebStoreProtocol2Response{
+		ElapsedSeconds: int(now.Sub(midnight).Seconds()),
+		Extensions:     webStoreResponse,
+	}
+	return response.AppendXML(dst), "application/xml", nil
+}
@@ -0,0 +1,83 @@
+package controller_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/extension"
+	"github.com/brave/go-update/extension/extensiontest"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMirrorProtocol(t *testing.T) {
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	defer func() {
+		handlerOptions.UpdateSettings(func(settings *controller.Settings) {
+			settings.MirrorProtocol = false
+		})
+	}()
+	requestBody := extensiontest.ExtensionRequestFnFor("ldimlcelhnjgpjjemdjokpgeeikdinbm")("0.0.0")
+	getProtocol := func(requestBody string) string {
+		resp, err := http.Post(server.URL+"/extensions", "application/xml", bytes.NewBufferString(requestBody))
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		actual, err := ioutil.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		response := struct {
+			Protocol string `xml:"protocol,attr"`
+		}{}
+		assert.Nil(t, xml.Unmarshal(actual, &response))
+		return response.Protocol
+	}
+
+	// 3.0 requests get 3.1 responses unless the protocol is mirrored
+	assert.Equal(t, "3.1", getProtocol(requestBody))
+	handlerOptions.UpdateSettings(func(settings *controller.Settings) {
+		settings.MirrorProtocol = true
+	})
+	assert.Equal(t, "3.0", getProtocol(requestBody))
+	assert.Equal(t, "3.1", getProtocol(strings.Replace(requestBody, `protocol="3.0"`, `protocol="3.1"`, 1)))
+}
+
+func TestProtocol4(t *testing.T) {
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	requestBody := `{"request":{"protocol":"4.0","@os":"mac","prodchannel":"stable","apps":[
+		{"appid":"ldimlcelhnjgpjjemdjokpgeeikdinbm","version":"0.0.0","updatecheck":{}},
+		{"appid":"bfdgpgibhagkpdlnjonhkabjoijopoge","version":"1.0.0","updatecheck":{}}
+	]}}`
+	resp, err := http.Post(server.URL+"/extensions", "application/json", bytes.NewBufferString(requestBody))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	actual, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(string(actual), extension.Protocol4Prefix))
+	assert.Contains(t, string(actual), `"appid":"ldimlcelhnjgpjjemdjokpgeeikdinbm","status":"ok","updatecheck":{"status":"ok","nextversion":"1.0.0"`)
+	assert.NotContains(t, string(actual), "bfdgpgibhagkpdlnjonhkabjoijopoge")
+
+	// A single unknown extension is redirected like protocol 3 requests
+	requestBody = `{"request":{"protocol":"4.0","apps":[{"appid":"aomjjhallfgjeglblehebfpbcfeobpgk","version":"0.0.0","updatecheck":{}}]}}`
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err = client.Post(server.URL+"/extensions", "application/json", bytes.NewBufferString(requestBody))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+
+	// Other protocol versions are rejected
+	requestBody = `{"request":{"protocol":"3.1","apps":[]}}`
+	resp, err = http.Post(server.URL+"/extensions", "application/json", bytes.NewBufferString(requestBody))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
@@ -0,0 +1,190 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront/types"
+	"github.com/brave/go-update/extension"
+	"github.com/getsentry/raven-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cdnPurgeTimeout is how long purging the responses for one catalog change may take
+const cdnPurgeTimeout = 30 * time.Second
+
+// fastlyMaxKeys is the most surrogate keys Fastly purges in one request
+const fastlyMaxKeys = 256
+
+var cdnPurges = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "cdn_purges_total",
+	Help: "Number of purges of cached update check responses sent to the CDN after catalog changes, by result.",
+}, []string{"result"})
+
+func init() {
+	prometheus.MustRegister(cdnPurges)
+}
+
+// CDNPurger purges the update check responses a CDN cached for extensions which changed in the catalog
+type CDNPurger interface {
+	// Purge purges the responses mentioning any of ids from the catalog of tenant, empty for the default catalog
+	Purge(ctx context.Context, tenant string, ids []string) error
+}
+
+// surrogateKey is the key of the cached responses mentioning the extension id from the catalog of tenant
+func surrogateKey(tenant string, id string) string {
+	if len(tenant) == 0 {
+		return id
+	}
+	return tenant + "/" + id
+}
+
+// setSurrogateKeys sets the Surrogate-Key header of a cacheable response mentioning ids, so they can be purged
+// when any of the extensions changes
+func setSurrogateKeys(w http.ResponseWriter, r *http.Request, ids []string) {
+	if len(ids) == 0 {
+		return
+	}
+	tenant := ""
+	if requestTenant := requestTenant(r); requestTenant != nil {
+		tenant = requestTenant.Name
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = surrogateKey(tenant, id)
+	}
+	w.Header().Set("Surrogate-Key", strings.Join(keys, " "))
+}
+
+// changedExtensions returns the IDs of the extensions which differ between two catalogs, in order
+func changedExtensions(previous map[string]extension.Extension, current map[string]extension.Extension) []string {
+	ids := []string{}
+	for id, ext := range current {
+		if old, ok := previous[id]; !ok || !reflect.DeepEqual(old, ext) {
+			ids = append(ids, id)
+		}
+	}
+	for id := range previous {
+		if _, ok := current[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// purgeChanges purges the responses for the extensions which changed between two snapshots of the catalog
+// of tenant with the purger of opts in the background. Loading the catalog at startup purges nothing, since nothing
+// was cached from it yet.
+func purgeChanges(opts *Options, tenant string, previous *CatalogSnapshot, current *CatalogSnapshot) {
+	purger := opts.purger()
+	if purger == nil || previous.Generation() == 0 {
+		return
+	}
+	ids := changedExtensions(previous.Map(), current.Map())
+	if len(ids) == 0 {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(WithOptionsContext(context.Background(), opts), cdnPurgeTimeout)
+		defer cancel()
+		err := purger.Purge(ctx, tenant, ids)
+		if err != nil {
+			cdnPurges.WithLabelValues("error").Inc()
+			log.Printf("error purging %d changed extensions from the CDN: %v\n", len(ids), err)
+			raven.CaptureError(err, map[string]string{"task": "cdn-purge"})
+			return
+		}
+		cdnPurges.WithLabelValues("ok").Inc()
+	}()
+}
+
+// FastlyPurger purges by surrogate key from a Fastly service, with the FastlyToken of the settings of the Options
+// in the context of the purge
+type FastlyPurger struct {
+	ServiceID string
+	// SoftPurge marks the responses stale rather than removing them, so Fastly can still serve them if go-update fails
+	SoftPurge bool
+	// URL is the Fastly API, https://api.fastly.com if empty
+	URL string
+	// Client sends the purges, http.DefaultClient if nil
+	Client *http.Client
+}
+
+// Purge purges the surrogate keys of ids in batches
+func (purger FastlyPurger) Purge(ctx context.Context, tenant string, ids []string) error {
+	token := optionsFor(ctx).settings().FastlyToken
+	api := purger.URL
+	if len(api) == 0 {
+		api = "https://api.fastly.com"
+	}
+	client := purger.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	for start := 0; start < len(ids); start += fastlyMaxKeys {
+		end := start + fastlyMaxKeys
+		if end > len(ids) {
+			end = len(ids)
+		}
+		keys := make([]string, 0, end-start)
+		for _, id := range ids[start:end] {
+			keys = append(keys, surrogateKey(tenant, id))
+		}
+		req, err := http.NewRequest(http.MethodPost, api+"/service/"+purger.ServiceID+"/purge", nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Fastly-Key", token)
+		req.Header.Set("Surrogate-Key", strings.Join(keys, " "))
+		if purger.SoftPurge {
+			req.Header.Set("Fastly-Soft-Purge", "1")
+		}
+		resp, err := client.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("fastly answered %s", resp.Status)
+		}
+	}
+	return nil
+}
+
+// CloudFrontPurger invalidates the update check paths of a CloudFront distribution. CloudFront can't invalidate
+// by surrogate key or query string, so every cached GET update check of the catalog is invalidated.
+type CloudFrontPurger struct {
+	DistributionID string
+}
+
+// Purge creates an invalidation of /extensions, and /t/{tenant}/extensions for tenants
+func (purger CloudFrontPurger) Purge(ctx context.Context, tenant string, ids []string) error {
+	cfg, err := newAWSConfig(ctx)
+	if err != nil {
+		return err
+	}
+	paths := []string{"/extensions*"}
+	if len(tenant) != 0 {
+		paths = append(paths, "/t/"+tenant+"/extensions*")
+	}
+	_, err = cloudfront.NewFromConfig(cfg).CreateInvalidation(ctx, &cloudfront.CreateInvalidationInput{
+		DistributionId: aws.String(purger.DistributionID),
+		InvalidationBatch: &types.InvalidationBatch{
+			CallerReference: aws.String("go-update-" + strconv.FormatInt(time.Now().UnixNano(), 10)),
+			Paths: &types.Paths{
+				Items:    paths,
+				Quantity: aws.Int32(int32(len(paths))),
+			},
+		},
+	})
+	return err
+}
@@ -0,0 +1,80 @@
+package controller_test
+
+import (
+	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/extension"
+	"github.com/brave/go-update/memstore"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCDNPurge(t *testing.T) {
+	purges := make(chan *http.Request, 10)
+	fastly := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		purges <- r
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer fastly.Close()
+	settings := controller.DefaultSettings()
+	settings.FastlyToken = "fastly-token"
+	opts := &controller.Options{
+		Store:    controller.NewValidatingStore(memstore.New(nil)),
+		Clock:    testClock,
+		Settings: &settings,
+		Purger:   controller.FastlyPurger{ServiceID: "service", URL: fastly.URL},
+	}
+	handler := newTestHandler(opts)
+	nextPurge := func() *http.Request {
+		select {
+		case r := <-purges:
+			return r
+		case <-time.After(5 * time.Second):
+			t.Fatal("no purge")
+			return nil
+		}
+	}
+
+	// Loading the catalog purges everything in it
+	opts.SetCatalog(handlerOptions.CurrentCatalog().Map())
+	assert.Contains(t, nextPurge().Header.Get("Surrogate-Key"), "ldimlcelhnjgpjjemdjokpgeeikdinbm")
+
+	// Changed extensions are purged by surrogate key
+	id := "ldimlcelhnjgpjjemdjokpgeeikdinbm"
+	original, ok := opts.CurrentCatalog().Lookup(id)
+	assert.True(t, ok)
+	opts.UpdateCatalog(func(extensions map[string]extension.Extension) {
+		changed := original
+		changed.Version = "2.0.0"
+		extensions[id] = changed
+	})
+	purge := nextPurge()
+	assert.Equal(t, http.MethodPost, purge.Method)
+	assert.Equal(t, "/service/service/purge", purge.URL.Path)
+	assert.Equal(t, "fastly-token", purge.Header.Get("Fastly-Key"))
+	assert.Equal(t, id, purge.Header.Get("Surrogate-Key"))
+	opts.UpdateCatalog(func(extensions map[string]extension.Extension) {
+		extensions[id] = original
+	})
+	assert.Equal(t, id, nextPurge().Header.Get("Surrogate-Key"))
+
+	// Nothing is purged when nothing changed
+	opts.UpdateCatalog(func(map[string]extension.Extension) {})
+	select {
+	case <-purges:
+		t.Error("unexpected purge")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// GET update checks are tagged with the extensions they mention
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	light := extension.Extension{ID: id, Version: "0.0.0"}
+	dark := extension.Extension{ID: "bfdgpgibhagkpdlnjonhkabjoijopoge", Version: "9.9.9"}
+	resp, err := http.Get(server.URL + "/extensions?" + getQueryParams(&light) + "&" + getQueryParams(&dark))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, id+" bfdgpgibhagkpdlnjonhkabjoijopoge", resp.Header.Get("Surrogate-Key"))
+}
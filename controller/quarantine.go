@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"encoding/json"
+	"github.com/brave/go-update/extension"
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// QuarantinedRecord is a catalog record which was left out at the last refresh, because it was invalid
+// or conflicted with another record for the same extension. The previous good entry is served instead, if there was one.
+type QuarantinedRecord struct {
+	Tenant  string `json:"tenant,omitempty"`
+	ID      string `json:"id"`
+	Version string `json:"version"`
+	// Reason is invalid or conflict, and Problems describes what is wrong
+	Reason     string    `json:"reason"`
+	Problems   []string  `json:"problems"`
+	DetectedAt time.Time `json:"detectedAt"`
+}
+
+var quarantinedGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "catalog_quarantined_records",
+	Help: "Number of catalog records left out at the last refresh, by tenant and whether they were invalid or conflicting.",
+}, []string{"tenant", "reason"})
+
+var duplicateRecords = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "catalog_duplicate_records_total",
+	Help: "Number of identical duplicate catalog records found while refreshing, by tenant.",
+}, []string{"tenant"})
+
+func init() {
+	prometheus.MustRegister(quarantinedGauge, duplicateRecords)
+}
+
+// quarantine returns the records of a freshly loaded catalog of tenant held by holder which can be served. Invalid records,
+// and every record of an extension listed more than once with different contents, are quarantined and replaced by
+// the entry in the catalog being served, so one bad row doesn't change what clients get. Identical duplicates are merged.
+func quarantine(holder *catalogHolder, tenant string, extensions extension.Extensions) extension.Extensions {
+	current := holder.snapshot().Map()
+	records := map[string][]extension.Extension{}
+	order := []string{}
+	for _, ext := range extensions {
+		if _, ok := records[ext.ID]; !ok {
+			order = append(order, ext.ID)
+		}
+		records[ext.ID] = append(records[ext.ID], ext)
+	}
+
+	now := time.Now()
+	accepted := extension.Extensions{}
+	quarantined := []QuarantinedRecord{}
+	for _, id := range order {
+		rows := records[id]
+		reason := ""
+		problems := ValidateExtension(rows[0])
+		if len(problems) != 0 {
+			reason = "invalid"
+		}
+		first, _ := json.Marshal(rows[0])
+		for _, row := range rows[1:] {
+			other, _ := json.Marshal(row)
+			if string(other) != string(first) {
+				reason = "conflict"
+				problems = []string{"listed more than once with different records, like version " + rows[0].Version + " and " + row.Version}
+				break
+			}
+		}
+		if len(rows) > 1 && len(reason) == 0 {
+			log.Printf("catalog has %d identical records for %s\n", len(rows), id)
+			duplicateRecords.WithLabelValues(tenant).Add(float64(len(rows) - 1))
+		}
+		if len(reason) == 0 {
+			accepted = append(accepted, rows[0])
+			continue
+		}
+		for _, row := range rows {
+			log.Printf("quarantined catalog record of %s %s: %v\n", row.ID, row.Version, problems)
+			quarantined = append(quarantined, QuarantinedRecord{
+				Tenant: tenant, ID: row.ID, Version: row.Version, Reason: reason, Problems: problems, DetectedAt: now,
+			})
+		}
+		if previous, ok := current[id]; ok {
+			accepted = append(accepted, previous)
+		}
+	}
+
+	holder.quarantineMutex.Lock()
+	defer holder.quarantineMutex.Unlock()
+	holder.quarantined = quarantined
+	counts := map[string]int{"invalid": 0, "conflict": 0}
+	for _, record := range quarantined {
+		counts[record.Reason]++
+	}
+	for reason, count := range counts {
+		quarantinedGauge.WithLabelValues(tenant, reason).Set(float64(count))
+	}
+	return accepted
+}
+
+// GetQuarantinedRecords is the admin handler listing the records quarantined at the last refresh of the catalog
+func GetQuarantinedRecords(w http.ResponseWriter, r *http.Request) {
+	holder := optionsFor(r.Context()).defaultCatalog()
+	if tenant := requestTenant(r); tenant != nil {
+		holder = &tenant.extensions
+	}
+	holder.quarantineMutex.Lock()
+	records := append([]QuarantinedRecord{}, holder.quarantined...)
+	holder.quarantineMutex.Unlock()
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].ID < records[j].ID
+	})
+	writeList(w, r, "records", records)
+}
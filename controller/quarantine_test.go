@@ -0,0 +1,109 @@
+package controller_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/extension"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// rowsStore returns its rows as they are, duplicates included, like a table without a unique key
+type rowsStore struct {
+	mutex *sync.Mutex
+	rows  *extension.Extensions
+}
+
+func (store rowsStore) LoadExtensions(context.Context) (extension.Extensions, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	return append(extension.Extensions{}, *store.rows...), nil
+}
+
+func (store rowsStore) SaveExtension(context.Context, extension.Extension) error {
+	return errors.New("read only")
+}
+
+func (store rowsStore) DeleteExtension(context.Context, string) error {
+	return errors.New("read only")
+}
+
+func TestQuarantine(t *testing.T) {
+	good := extension.Extension{
+		ID:      "cdaeidlnaaddgbddnkllimcbohcngcie",
+		SHA256:  "6c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618",
+		Title:   "good",
+		Version: "1.0.0",
+	}
+	other := extension.Extension{
+		ID:      "fefpamdnopmhomhkffkgmkehemehhgpo",
+		SHA256:  "7c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618",
+		Title:   "other",
+		Version: "1.0.0",
+	}
+	mutex := &sync.Mutex{}
+	rows := extension.Extensions{good, other, other}
+	controller.RegisterTenants(&controller.Tenant{Name: "quarantine", Store: rowsStore{mutex, &rows}})
+	request := func(method string, path string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, "/t/quarantine/api/v2/admin"+path, nil)
+		assert.Nil(t, err)
+		req.Header.Set("Authorization", "Bearer test-token")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+	served := func() string {
+		rr := request(http.MethodGet, "/catalog")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		return rr.Body.String()
+	}
+
+	// Identical duplicates are merged
+	assert.Equal(t, http.StatusNoContent, request(http.MethodPost, "/refresh").Code)
+	rr := request(http.MethodGet, "/quarantine")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `{"records":[]}`, strings.TrimSpace(rr.Body.String()))
+	assert.Contains(t, served(), `"version":"1.0.0"`)
+
+	// A conflicting record and a blank version are quarantined, and the previous entries are still served
+	conflicting, blank := good, other
+	conflicting.Version = "2.0.0"
+	blank.Version = ""
+	blank.SHA256 = "not a hash"
+	mutex.Lock()
+	rows = extension.Extensions{good, conflicting, blank}
+	mutex.Unlock()
+	assert.Equal(t, http.StatusNoContent, request(http.MethodPost, "/refresh").Code)
+	records := struct {
+		Records []controller.QuarantinedRecord `json:"records"`
+	}{}
+	rr = request(http.MethodGet, "/quarantine")
+	assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &records))
+	assert.Equal(t, 3, len(records.Records))
+	assert.Equal(t, good.ID, records.Records[0].ID)
+	assert.Equal(t, "conflict", records.Records[0].Reason)
+	assert.Equal(t, "2.0.0", records.Records[1].Version)
+	assert.Equal(t, other.ID, records.Records[2].ID)
+	assert.Equal(t, "invalid", records.Records[2].Reason)
+	assert.Equal(t, "quarantine", records.Records[2].Tenant)
+	assert.True(t, len(records.Records[2].Problems) >= 2)
+	catalog := served()
+	assert.Contains(t, catalog, `"id":"`+good.ID+`","version":"1.0.0"`)
+	assert.Contains(t, catalog, `"id":"`+other.ID+`","version":"1.0.0"`)
+	assert.NotContains(t, catalog, "2.0.0")
+
+	// The records of the default catalog aren't listed for tenants
+	req, err := http.NewRequest(http.MethodGet, "/api/v2/admin/quarantine", nil)
+	assert.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test-token")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotContains(t, rr.Body.String(), good.ID)
+}
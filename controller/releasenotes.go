@@ -0,0 +1,46 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/pressly/lg"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// MaxReleaseNotesLength is the longest release notes accepted, as they are sent along with every update
+var MaxReleaseNotesLength = 1024
+
+// PutReleaseNotes is the admin handler for replacing the release notes of the current version of an extension
+// in the catalog, which are also set when uploading it. The body is the text of the notes or a URL to them,
+// and an empty body removes them.
+func PutReleaseNotes(w http.ResponseWriter, r *http.Request) {
+	log := lg.Log(r.Context())
+	if optionsFor(r.Context()).frozen() {
+		http.Error(w, "The catalog is frozen", http.StatusForbidden)
+		return
+	}
+	id := chi.URLParam(r, "id")
+	ext, ok := catalogFor(r)[id]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	notes, err := ioutil.ReadAll(io.LimitReader(r.Body, int64(MaxReleaseNotesLength)+1))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	before := ext
+	ext.ReleaseNotes = strings.TrimSpace(string(notes))
+	if problems := validateVersion(ext); len(problems) != 0 {
+		http.Error(w, fmt.Sprintf("Invalid release notes: %s", strings.Join(problems, "; ")), http.StatusBadRequest)
+		return
+	}
+	if saveCatalogEntry(w, r, before, ext) {
+		log.Infof("Replaced the release notes of extension %s %s", id, ext.Version)
+	}
+}
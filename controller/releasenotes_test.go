@@ -0,0 +1,54 @@
+package controller_test
+
+import (
+	"bytes"
+	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/crx"
+	"github.com/brave/go-update/crx/crxtest"
+	"github.com/brave/go-update/extension/extensiontest"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestReleaseNotes(t *testing.T) {
+	key := crxtest.NewKey()
+	id := crx.IDFromPublicKey(crxtest.PublicKey(key))
+	payload := crxtest.BuildSignedCRX(key, []byte("PK archive"))
+	admin := func(method string, path string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer test-token")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+	check := func() string {
+		req := httptest.NewRequest(http.MethodPost, "/extensions", strings.NewReader(extensiontest.ExtensionRequestFnFor(id)("0.0.0")))
+		req.Header.Set("Content-Type", "application/xml")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		return rr.Body.String()
+	}
+
+	// Release notes are set with the upload of a version, and sent along with updates to it
+	rr := admin(http.MethodPut, "/api/admin/extensions/"+id+"/versions/1.0.0?title=Noted&releaseNotes="+url.QueryEscape("Fixes & improvements"), payload)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, "Fixes & improvements", handlerOptions.CurrentCatalog().Map()[id].ReleaseNotes)
+	assert.Contains(t, check(), `<data name="releasenotes" status="ok">Fixes &amp; improvements</data>`)
+
+	// They can be replaced, and are listed in the catalog
+	assert.Equal(t, http.StatusBadRequest, admin(http.MethodPut, "/api/admin/extensions/"+id+"/release-notes", bytes.Repeat([]byte("x"), controller.MaxReleaseNotesLength+1)).Code)
+	assert.Equal(t, http.StatusNotFound, admin(http.MethodPut, "/api/admin/extensions/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa/release-notes", []byte("x")).Code)
+	assert.Equal(t, http.StatusOK, admin(http.MethodPut, "/api/admin/extensions/"+id+"/release-notes", []byte("https://example.com/notes/1.0.0\n")).Code)
+	assert.Contains(t, admin(http.MethodGet, "/api/admin/catalog", nil).Body.String(), `"releaseNotes":"https://example.com/notes/1.0.0"`)
+	assert.Contains(t, check(), `<data name="releasenotes" status="ok">https://example.com/notes/1.0.0</data>`)
+
+	// They describe one version, so later versions don't keep them
+	assert.Equal(t, http.StatusCreated, admin(http.MethodPut, "/api/admin/extensions/"+id+"/versions/1.1.0", payload).Code)
+	assert.Equal(t, "", handlerOptions.CurrentCatalog().Map()[id].ReleaseNotes)
+	assert.NotContains(t, check(), "<data")
+}
@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"github.com/brave/go-update/extension"
+	"net/http"
+	"sync"
+)
+
+// Responder answers update checks for one extension with custom logic rather than from the catalog, like a component
+// whose packages are hosted elsewhere or whose download URLs are signed for each request. It is called with the extension
+// as checked by the client, with the version it has and its channel and platform, and returns the update to offer
+// and true, or false to offer none. The URLs of the update are used as they are, without mirrors or signing.
+type Responder func(r *http.Request, checked extension.Extension) (extension.Extension, bool)
+
+var responders = map[string]Responder{}
+var respondersMutex sync.RWMutex
+
+// RegisterResponder answers update checks for the extension with id with respond, for every tenant,
+// whether or not it is in the catalog. Registering nil goes back to answering from the catalog.
+func RegisterResponder(id string, respond Responder) {
+	respondersMutex.Lock()
+	defer respondersMutex.Unlock()
+	if respond == nil {
+		delete(responders, id)
+		return
+	}
+	responders[id] = respond
+}
+
+// responderFor returns the Responder of opts for the extension with id, or the one registered for it,
+// or the one of its AppOverride, or nil
+func responderFor(opts *Options, id string) Responder {
+	if respond := opts.responder(id); respond != nil {
+		return respond
+	}
+	respondersMutex.RLock()
+	respond := responders[id]
+	respondersMutex.RUnlock()
+	if respond != nil {
+		return respond
+	}
+	if override, ok := opts.appOverride(id); ok {
+		return override.responder()
+	}
+	return nil
+}
+
+// respond answers the extensions of updateRequest which have a Responder in settings, returning their updates and the
+// acknowledgements of their pings, and the rest of the request, which is answered from the catalog
+func respond(r *http.Request, settings ServingSettings, updateRequest extension.UpdateRequest) (extension.UpdateResponse, extension.UpdateResponse, extension.UpdateRequest) {
+	updates := extension.UpdateResponse{}
+	acknowledgements := extension.UpdateResponse{}
+	rest := extension.UpdateRequest{}
+	for _, checked := range updateRequest {
+		respond := settings.Responder(r, checked.ID)
+		switch {
+		case respond == nil:
+			rest = append(rest, checked)
+		case checked.PingOnly || checked.UpdateDisabled:
+			acknowledgements = append(acknowledgements, extension.Extension{
+				ID:             checked.ID,
+				PingOnly:       checked.PingOnly,
+				UpdateDisabled: checked.UpdateDisabled,
+				Ping:           checked.Ping,
+			})
+		default:
+			if update, ok := respond(r, checked); ok {
+				update.ID = checked.ID
+				update.SetCodebaseURL(checked.Client())
+				update.DownloadPreference = checked.DownloadPreference
+				updates = append(updates, update)
+			}
+		}
+	}
+	return updates, acknowledgements, rest
+}
@@ -0,0 +1,56 @@
+package controller_test
+
+import (
+	"bytes"
+	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/extension"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestResponder(t *testing.T) {
+	id := "mnjmhalfldbkdopbcpdnmfnhelbimkfn"
+	controller.RegisterResponder(id, func(r *http.Request, checked extension.Extension) (extension.Extension, bool) {
+		if extension.CompareVersions(checked.Version, "2.0.0") >= 0 {
+			return extension.Extension{}, false
+		}
+		return extension.Extension{
+			Version: "2.0.0",
+			SHA256:  "9c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618",
+			URL:     "https://example.com/" + checked.Platform + "/component.crx?signature=abc",
+		}, true
+	})
+	defer controller.RegisterResponder(id, nil)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	// The responder answers for an extension which isn't in the catalog, rather than the client being redirected
+	requestBody := `{"request":{"protocol":"4.0","@os":"win","apps":[{"appid":"` + id + `","version":"1.0.0","updatecheck":{}}]}}`
+	resp, err := http.Post(server.URL+"/extensions", "application/json", bytes.NewBufferString(requestBody))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Contains(t, string(body), `"nextversion":"2.0.0"`)
+	assert.Contains(t, string(body), `"url":"https://example.com/win/component.crx?signature=abc"`)
+
+	requestBody = strings.Replace(requestBody, `"version":"1.0.0"`, `"version":"2.0.0"`, 1)
+	resp, err = http.Post(server.URL+"/extensions", "application/json", bytes.NewBufferString(requestBody))
+	assert.Nil(t, err)
+	body, err = ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(body), "nextversion")
+
+	// Web store checks are answered too
+	resp, err = http.Get(server.URL + "/extensions?os=mac&x=" + url.QueryEscape("id="+id+"&v=1.0.0"))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err = ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Contains(t, string(body), "https://example.com/mac/component.crx?signature=abc")
+}
@@ -0,0 +1,123 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/brave/go-update/extension"
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+	"math/rand"
+	"time"
+)
+
+// RetrySettings controls how a RetryStore retries transient failures
+type RetrySettings struct {
+	// Attempts is the most times an operation is tried
+	Attempts int
+	// BaseDelay is the backoff before the first retry, doubling for every retry after it up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Timeout is the deadline for an operation including all of its retries
+	Timeout time.Duration
+}
+
+// DefaultRetrySettings are the settings used for DynamoDB unless configured otherwise
+var DefaultRetrySettings = RetrySettings{
+	Attempts:  4,
+	BaseDelay: 100 * time.Millisecond,
+	MaxDelay:  5 * time.Second,
+	Timeout:   30 * time.Second,
+}
+
+var storeErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "store_errors_total",
+	Help: "Number of failed store calls by operation and whether the error was transient or permanent.",
+}, []string{"name", "operation", "kind"})
+
+func init() {
+	prometheus.MustRegister(storeErrors)
+}
+
+// RetryStore gives every operation on a store a deadline and retries transient failures,
+// like DynamoDB throttling, with jittered exponential backoff.
+type RetryStore struct {
+	name     string
+	store    Store
+	settings RetrySettings
+}
+
+// NewRetryStore creates a RetryStore named name around store
+func NewRetryStore(name string, store Store, settings RetrySettings) *RetryStore {
+	return &RetryStore{name: name, store: store, settings: settings}
+}
+
+// LoadExtensions loads the catalog, retrying transient failures
+func (store *RetryStore) LoadExtensions(ctx context.Context) (extension.Extensions, error) {
+	var extensions extension.Extensions
+	err := store.retry(ctx, "load", func(ctx context.Context) error {
+		var err error
+		extensions, err = store.store.LoadExtensions(ctx)
+		return err
+	})
+	return extensions, err
+}
+
+// SaveExtension saves the extension, retrying transient failures
+func (store *RetryStore) SaveExtension(ctx context.Context, ext extension.Extension) error {
+	return store.retry(ctx, "save", func(ctx context.Context) error {
+		return store.store.SaveExtension(ctx, ext)
+	})
+}
+
+// DeleteExtension deletes the extension, retrying transient failures
+func (store *RetryStore) DeleteExtension(ctx context.Context, id string) error {
+	return store.retry(ctx, "delete", func(ctx context.Context) error {
+		return store.store.DeleteExtension(ctx, id)
+	})
+}
+
+func (store *RetryStore) retry(ctx context.Context, operation string, fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, store.settings.Timeout)
+	defer cancel()
+	delay := store.settings.BaseDelay
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			return nil
+		}
+		if !isTransientError(err) {
+			storeErrors.WithLabelValues(store.name, operation, "permanent").Inc()
+			log.Printf("permanent %s error from %s store: %v\n", operation, store.name, err)
+			return err
+		}
+		storeErrors.WithLabelValues(store.name, operation, "transient").Inc()
+		if attempt >= store.settings.Attempts {
+			log.Printf("giving up on %s from %s store after %d attempts: %v\n", operation, store.name, attempt, err)
+			return err
+		}
+
+		// Full jitter keeps many instances from retrying in lockstep
+		select {
+		case <-time.After(time.Duration(rand.Int63n(int64(delay) + 1))):
+		case <-ctx.Done():
+			return err
+		}
+		delay *= 2
+		if delay > store.settings.MaxDelay {
+			delay = store.settings.MaxDelay
+		}
+	}
+}
+
+// isTransientError returns true for errors worth retrying, like throttling and 5xx responses
+func isTransientError(err error) bool {
+	var responseError *smithyhttp.ResponseError
+	if errors.As(err, &responseError) && responseError.HTTPStatusCode() >= 500 {
+		return true
+	}
+	return retry.IsErrorThrottles(retry.DefaultThrottles).IsErrorThrottle(err) == aws.TrueTernary ||
+		retry.IsErrorRetryables(retry.DefaultRetryables).IsErrorRetryable(err) == aws.TrueTernary
+}
@@ -0,0 +1,85 @@
+package controller_test
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/smithy-go"
+	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/extension"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// flakyStore fails with throttling until it has been called failures times
+type flakyStore struct {
+	calls    *int
+	failures int
+	err      error
+}
+
+func (store flakyStore) LoadExtensions(context.Context) (extension.Extensions, error) {
+	*store.calls++
+	if *store.calls <= store.failures {
+		return nil, store.err
+	}
+	return extension.Extensions{newExtension1}, nil
+}
+
+func (store flakyStore) SaveExtension(context.Context, extension.Extension) error {
+	*store.calls++
+	if *store.calls <= store.failures {
+		return store.err
+	}
+	return nil
+}
+
+func (store flakyStore) DeleteExtension(context.Context, string) error {
+	*store.calls++
+	if *store.calls <= store.failures {
+		return store.err
+	}
+	return nil
+}
+
+func TestRetryStore(t *testing.T) {
+	settings := controller.RetrySettings{
+		Attempts:  3,
+		BaseDelay: time.Millisecond,
+		MaxDelay:  5 * time.Millisecond,
+		Timeout:   time.Second,
+	}
+	throttled := &smithy.GenericAPIError{Code: "ProvisionedThroughputExceededException", Message: "slow down"}
+
+	// Transient failures are retried
+	calls := 0
+	store := controller.NewRetryStore("test", flakyStore{&calls, 2, throttled}, settings)
+	extensions, err := store.LoadExtensions(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, extension.Extensions{newExtension1}, extensions)
+	assert.Equal(t, 3, calls)
+
+	// Until the attempts run out
+	calls = 0
+	store = controller.NewRetryStore("test", flakyStore{&calls, 5, throttled}, settings)
+	assert.Equal(t, throttled, store.SaveExtension(context.Background(), newExtension1))
+	assert.Equal(t, 3, calls)
+
+	// Permanent failures are not retried
+	calls = 0
+	store = controller.NewRetryStore("test", flakyStore{&calls, 5, errors.New("no such table")}, settings)
+	_, err = store.LoadExtensions(context.Background())
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, calls)
+
+	// The deadline covers the backoff too
+	calls = 0
+	settings.Attempts = 100
+	settings.BaseDelay = time.Second
+	settings.Timeout = 20 * time.Millisecond
+	store = controller.NewRetryStore("test", flakyStore{&calls, 100, throttled}, settings)
+	start := time.Now()
+	_, err = store.LoadExtensions(context.Background())
+	assert.NotNil(t, err)
+	assert.True(t, time.Since(start) < 500*time.Millisecond)
+}
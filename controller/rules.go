@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/brave/go-update/extension"
+	"github.com/go-chi/chi"
+	"github.com/pressly/lg"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// PutTargetingRules is the admin handler for replacing the targeting rules of an extension in the catalog,
+// which decide the package offered to clients by the attributes of their update checks, see extension.Rule.
+// The body is the list of rules, evaluated in order, and an empty list removes them.
+func PutTargetingRules(w http.ResponseWriter, r *http.Request) {
+	log := lg.Log(r.Context())
+	if optionsFor(r.Context()).frozen() {
+		http.Error(w, "The catalog is frozen", http.StatusForbidden)
+		return
+	}
+	id := chi.URLParam(r, "id")
+	ext, ok := catalogFor(r)[id]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	rules := []extension.Rule{}
+	err := json.NewDecoder(io.LimitReader(r.Body, 1024*1024)).Decode(&rules)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if problems := validateRules(id, rules); len(problems) != 0 {
+		http.Error(w, fmt.Sprintf("Invalid rules: %s", strings.Join(problems, "; ")), http.StatusBadRequest)
+		return
+	}
+
+	before := ext
+	ext.Rules = rules
+	if len(rules) == 0 {
+		ext.Rules = nil
+	}
+	if saveCatalogEntry(w, r, before, ext) {
+		log.Infof("Targeting extension %s with %d rules", id, len(rules))
+	}
+}
+
+// PutLocalePackages is the admin handler for replacing the packages of an extension in the catalog which are
+// offered by the lang of update checks, for extensions whose payload differs by language, see extension.Localize.
+// The body maps language tags to packages, and an empty map removes them.
+func PutLocalePackages(w http.ResponseWriter, r *http.Request) {
+	log := lg.Log(r.Context())
+	if optionsFor(r.Context()).frozen() {
+		http.Error(w, "The catalog is frozen", http.StatusForbidden)
+		return
+	}
+	id := chi.URLParam(r, "id")
+	ext, ok := catalogFor(r)[id]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	locales := map[string]extension.Package{}
+	err := json.NewDecoder(io.LimitReader(r.Body, 1024*1024)).Decode(&locales)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if problems := validateLocales(id, locales); len(problems) != 0 {
+		http.Error(w, fmt.Sprintf("Invalid locales: %s", strings.Join(problems, "; ")), http.StatusBadRequest)
+		return
+	}
+
+	before := ext
+	ext.Locales = locales
+	if len(locales) == 0 {
+		ext.Locales = nil
+	}
+	if saveCatalogEntry(w, r, before, ext) {
+		log.Infof("Offering extension %s in %d locales", id, len(locales))
+	}
+}
+
+// MemoryRequirement is the least memory in GB of clients offered an extension's package,
+// and the lite package offered to clients with less, who are offered no update without one
+type MemoryRequirement struct {
+	MinPhysMemory int                `json:"minPhysMemory"`
+	Lite          *extension.Package `json:"lite,omitempty"`
+}
+
+// PutMemoryRequirement is the admin handler for replacing the memory requirement of an extension in the catalog,
+// so low memory clients which report their memory get a lite package or none, see extension.FitMemory.
+// A minPhysMemory of 0 removes it.
+func PutMemoryRequirement(w http.ResponseWriter, r *http.Request) {
+	log := lg.Log(r.Context())
+	if optionsFor(r.Context()).frozen() {
+		http.Error(w, "The catalog is frozen", http.StatusForbidden)
+		return
+	}
+	id := chi.URLParam(r, "id")
+	ext, ok := catalogFor(r)[id]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	requirement := MemoryRequirement{}
+	err := json.NewDecoder(io.LimitReader(r.Body, 1024*1024)).Decode(&requirement)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if problems := validateMemoryRequirement(id, requirement); len(problems) != 0 {
+		http.Error(w, fmt.Sprintf("Invalid memory requirement: %s", strings.Join(problems, "; ")), http.StatusBadRequest)
+		return
+	}
+
+	before := ext
+	ext.MinPhysMemory = requirement.MinPhysMemory
+	ext.Lite = requirement.Lite
+	if saveCatalogEntry(w, r, before, ext) {
+		log.Infof("Requiring %d GB of memory for extension %s", requirement.MinPhysMemory, id)
+	}
+}
+
+// saveCatalogEntry saves the catalog entry changed from before, and responds with it.
+// It returns false if saving failed, which has been responded to.
+func saveCatalogEntry(w http.ResponseWriter, r *http.Request, before extension.Extension, ext extension.Extension) bool {
+	err := adminService.saveEntry(r.Context(), AuditUpdate, before, ext)
+	if err != nil {
+		writeAdminError(w, r, err)
+		return false
+	}
+	writeJSON(w, r, http.StatusOK, ext)
+	return true
+}
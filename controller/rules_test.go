@@ -0,0 +1,162 @@
+package controller_test
+
+import (
+	"github.com/brave/go-update/extension"
+	"github.com/brave/go-update/extension/extensiontest"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTargetingRules(t *testing.T) {
+	id := "ldimlcelhnjgpjjemdjokpgeeikdinbm"
+	put := func(path string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer test-token")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+	check := func(requestBody string) string {
+		req := httptest.NewRequest(http.MethodPost, "/extensions", strings.NewReader(requestBody))
+		req.Header.Set("Content-Type", "application/xml")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		return rr.Body.String()
+	}
+	webStoreCheck := func(os string) string {
+		req := httptest.NewRequest(http.MethodGet, "/extensions?os="+os+"&"+getQueryParams(&extension.Extension{ID: id, Version: "0.0.0"}), nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		return rr.Body.String()
+	}
+	requestBody := extensiontest.ExtensionRequestFnFor(id)("0.0.0")
+
+	assert.Equal(t, http.StatusNotFound, put("/api/admin/extensions/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa/rules", `[]`).Code)
+	assert.Equal(t, http.StatusBadRequest, put("/api/admin/extensions/"+id+"/rules", `[{"conditions":[{"attribute":"country","operator":"eq","value":"US"}],"noUpdate":true}]`).Code)
+	assert.Equal(t, http.StatusBadRequest, put("/api/admin/extensions/"+id+"/rules", `[{"package":{"version":"0.9.0","sha256":"abc"}}]`).Code)
+
+	// Old browsers get an older package, and Macs with little memory none at all
+	legacySHA256 := strings.Repeat("a", 64)
+	rr := put("/api/admin/extensions/"+id+"/rules", `[
+		{"conditions":[{"attribute":"prodversion","operator":"lt","value":"60"}],"package":{"version":"0.9.0","sha256":"`+legacySHA256+`"}},
+		{"conditions":[{"attribute":"os","operator":"eq","value":"mac"},{"attribute":"physmemory","operator":"lt","value":"4"}],"noUpdate":true}
+	]`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	defer put("/api/admin/extensions/"+id+"/rules", `[]`)
+	assert.Contains(t, rr.Body.String(), `"rules":[`)
+
+	body := check(requestBody)
+	assert.Contains(t, body, `version="0.9.0"`)
+	assert.Contains(t, body, legacySHA256)
+	body = check(strings.Replace(requestBody, `prodversion="53.0.2785.116"`, `prodversion="120.1.61.100"`, 1))
+	assert.Contains(t, body, `version="1.0.0"`)
+	body = check(strings.Replace(strings.Replace(requestBody, `prodversion="53.0.2785.116"`, `prodversion="120.1.61.100"`, 1), `physmemory="16"`, `physmemory="2"`, 1))
+	assert.NotContains(t, body, "<app")
+
+	// GET checks are targeted by their query parameters
+	assert.Contains(t, webStoreCheck("win"), `version="1.0.0"`)
+	assert.NotContains(t, webStoreCheck("win"), "0.9.0")
+
+	// The rules are kept in the catalog
+	assert.Equal(t, 2, len(handlerOptions.CurrentCatalog().Map()[id].Rules))
+	assert.Equal(t, http.StatusOK, put("/api/admin/extensions/"+id+"/rules", `[]`).Code)
+	assert.Nil(t, handlerOptions.CurrentCatalog().Map()[id].Rules)
+	assert.Contains(t, check(requestBody), `version="1.0.0"`)
+}
+
+func TestLocalePackages(t *testing.T) {
+	id := "ldimlcelhnjgpjjemdjokpgeeikdinbm"
+	put := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/admin/extensions/"+id+"/locales", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer test-token")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+	check := func(lang string) string {
+		requestBody := strings.Replace(extensiontest.ExtensionRequestFnFor(id)("0.0.0"), `lang=""`, `lang="`+lang+`"`, 1)
+		req := httptest.NewRequest(http.MethodPost, "/extensions", strings.NewReader(requestBody))
+		req.Header.Set("Content-Type", "application/xml")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		return rr.Body.String()
+	}
+
+	ptSHA256 := strings.Repeat("b", 64)
+	ptBRSHA256 := strings.Repeat("c", 64)
+	assert.Equal(t, http.StatusBadRequest, put(`{"portuguese":{"version":"1.0.1","sha256":"`+ptSHA256+`"}}`).Code)
+	assert.Equal(t, http.StatusBadRequest, put(`{"pt":{"version":"1.0.1","sha256":"abc"}}`).Code)
+	assert.Equal(t, http.StatusBadRequest, put(`{"pt-BR":{"version":"1.0.1","sha256":"`+ptSHA256+`"},"pt_br":{"version":"1.0.1","sha256":"`+ptSHA256+`"}}`).Code)
+
+	rr := put(`{"pt":{"version":"1.0.1","sha256":"` + ptSHA256 + `"},"pt-BR":{"version":"1.0.2","sha256":"` + ptBRSHA256 + `"}}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	defer put(`{}`)
+	assert.Contains(t, rr.Body.String(), `"locales":{`)
+
+	assert.Contains(t, check("pt-BR"), ptBRSHA256)
+	assert.Contains(t, check("pt-PT"), ptSHA256)
+	body := check("en-US")
+	assert.Contains(t, body, `version="1.0.0"`)
+	assert.NotContains(t, body, ptSHA256)
+	assert.Contains(t, check(""), `version="1.0.0"`)
+
+	// GET checks are localized by their lang query parameter
+	req := httptest.NewRequest(http.MethodGet, "/extensions?lang=pt-BR&"+getQueryParams(&extension.Extension{ID: id, Version: "0.0.0"}), nil)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Contains(t, rr.Body.String(), `version="1.0.2"`)
+
+	assert.Equal(t, http.StatusOK, put(`{}`).Code)
+	assert.Nil(t, handlerOptions.CurrentCatalog().Map()[id].Locales)
+	assert.Contains(t, check("pt-BR"), `version="1.0.0"`)
+}
+
+func TestMemoryRequirement(t *testing.T) {
+	id := "ldimlcelhnjgpjjemdjokpgeeikdinbm"
+	put := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/admin/extensions/"+id+"/memory", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer test-token")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+	check := func(physMemory string) string {
+		requestBody := strings.Replace(extensiontest.ExtensionRequestFnFor(id)("0.0.0"), `physmemory="16"`, `physmemory="`+physMemory+`"`, 1)
+		req := httptest.NewRequest(http.MethodPost, "/extensions", strings.NewReader(requestBody))
+		req.Header.Set("Content-Type", "application/xml")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		return rr.Body.String()
+	}
+
+	liteSHA256 := strings.Repeat("d", 64)
+	assert.Equal(t, http.StatusBadRequest, put(`{"minPhysMemory":-1}`).Code)
+	assert.Equal(t, http.StatusBadRequest, put(`{"minPhysMemory":0,"lite":{"version":"1.0.0","sha256":"`+liteSHA256+`"}}`).Code)
+	assert.Equal(t, http.StatusBadRequest, put(`{"minPhysMemory":4,"lite":{"version":"1.0.0","sha256":"abc"}}`).Code)
+
+	// Without a lite package, low memory clients get no update
+	assert.Equal(t, http.StatusOK, put(`{"minPhysMemory":4}`).Code)
+	defer put(`{"minPhysMemory":0}`)
+	assert.NotContains(t, check("2"), "<app")
+	assert.Contains(t, check("16"), `version="1.0.0"`)
+	assert.Contains(t, check(""), `version="1.0.0"`)
+
+	rr := put(`{"minPhysMemory":4,"lite":{"version":"1.0.0","sha256":"` + liteSHA256 + `","size":512}}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"minPhysMemory":4`)
+	body := check("2")
+	assert.Contains(t, body, liteSHA256)
+	assert.Contains(t, body, `size="512"`)
+	assert.NotContains(t, check("16"), liteSHA256)
+
+	assert.Equal(t, http.StatusOK, put(`{"minPhysMemory":0}`).Code)
+	assert.Nil(t, handlerOptions.CurrentCatalog().Map()[id].Lite)
+	assert.Contains(t, check("2"), `version="1.0.0"`)
+}
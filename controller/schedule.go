@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"github.com/brave/go-update/extension"
+	"log"
+)
+
+// publishTimer is a scheduled version waiting to be published
+type publishTimer struct {
+	id      string
+	version string
+}
+
+// publishedVersion returns the scheduled version of ext, which replaces it once it is due
+func publishedVersion(ext extension.Extension) extension.Extension {
+	published := *ext.Scheduled
+	published.Scheduled = nil
+	return published
+}
+
+// publishScheduled returns ext with its scheduled version in its place if that is due.
+// Otherwise a timer on the clock of the catalog's Options publishes it in catalog when it is.
+// Entries are published in memory only, the store keeps the scheduled version until the next upload replaces it.
+func publishScheduled(catalog *catalogHolder, ext extension.Extension) extension.Extension {
+	if ext.Scheduled == nil || ext.Scheduled.PublishAt == nil {
+		return ext
+	}
+	clock := catalog.options.clock()
+	publishAt := *ext.Scheduled.PublishAt
+	if !clock.Now().Before(publishAt) {
+		return publishedVersion(ext)
+	}
+
+	version := ext.Scheduled.Version
+	key := publishTimer{id: ext.ID, version: version}
+	catalog.publishTimersMutex.Lock()
+	defer catalog.publishTimersMutex.Unlock()
+	if catalog.publishTimers[key] {
+		return ext
+	}
+	if catalog.publishTimers == nil {
+		catalog.publishTimers = map[publishTimer]bool{}
+	}
+	catalog.publishTimers[key] = true
+	clock.AfterFunc(publishAt.Sub(clock.Now()), func() {
+		catalog.publishTimersMutex.Lock()
+		delete(catalog.publishTimers, key)
+		catalog.publishTimersMutex.Unlock()
+
+		published := false
+		catalog.update(func(extensions map[string]extension.Extension) {
+			// The schedule may have been replaced by another upload in the meantime
+			current, ok := extensions[ext.ID]
+			if !ok || current.Scheduled == nil || current.Scheduled.Version != version {
+				return
+			}
+			extensions[ext.ID] = publishedVersion(current)
+			published = true
+		})
+		if published {
+			log.Printf("published scheduled version %s of %s\n", version, ext.ID)
+		}
+	})
+	return ext
+}
@@ -0,0 +1,67 @@
+package controller_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/brave/go-update/crx"
+	"github.com/brave/go-update/crx/crxtest"
+	"github.com/brave/go-update/extension"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestScheduledPublishing(t *testing.T) {
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	key := crxtest.NewKey()
+	id := crx.IDFromPublicKey(crxtest.PublicKey(key))
+	payload := crxtest.BuildSignedCRX(key, []byte("PK archive"))
+	upload := func(version string, publishAt string) *http.Response {
+		uploadURL := fmt.Sprintf("%s/api/admin/extensions/%s/versions/%s?publishAt=%s", server.URL, id, version, url.QueryEscape(publishAt))
+		req, err := http.NewRequest(http.MethodPut, uploadURL, bytes.NewBuffer(payload))
+		assert.Nil(t, err)
+		req.Header.Set("Authorization", "Bearer test-token")
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		return resp
+	}
+	served := func() string {
+		resp, err := http.Get(server.URL + "/extensions?x=" + url.QueryEscape("id="+id+"&v=0.0.0"))
+		assert.Nil(t, err)
+		body, err := ioutil.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		return string(body)
+	}
+
+	// Times which have already passed publish straight away
+	resp := upload("1.0.0", testClock.Now().Add(-time.Hour).Format(time.RFC3339))
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Contains(t, served(), `version="1.0.0"`)
+
+	resp = upload("1.1.0", "tomorrow")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// A scheduled version isn't served until it is due
+	publishAt := testClock.Now().Add(time.Second)
+	resp = upload("1.1.0", publishAt.Format(time.RFC3339Nano))
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	entry := extension.Extension{}
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(&entry))
+	assert.Equal(t, "1.0.0", entry.Version)
+	assert.Equal(t, "1.1.0", entry.Scheduled.Version)
+	assert.True(t, publishAt.Equal(*entry.Scheduled.PublishAt))
+	assert.Contains(t, served(), `version="1.0.0"`)
+	resp = upload("1.1.0", publishAt.Format(time.RFC3339Nano))
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	testClock.Set(publishAt)
+	assert.Contains(t, served(), `version="1.1.0"`)
+	assert.Nil(t, handlerOptions.CurrentCatalog().Map()[id].Scheduled)
+}
@@ -0,0 +1,28 @@
+package controller
+
+import (
+	"context"
+	"github.com/getsentry/raven-go"
+	chiware "github.com/go-chi/chi/middleware"
+	"net/http"
+)
+
+// captureRequestError reports an unexpected error to Sentry along with the request it happened in.
+// Sentry is configured with the SENTRY_DSN, SENTRY_RELEASE and SENTRY_ENVIRONMENT environment variables.
+func captureRequestError(r *http.Request, err error) {
+	tags := map[string]string{}
+	if requestID := chiware.GetReqID(r.Context()); len(requestID) != 0 {
+		tags["request_id"] = requestID
+	}
+	raven.CaptureError(err, tags, raven.NewHttp(r))
+}
+
+// captureContextError reports an unexpected error to Sentry like captureRequestError, for admin calls which
+// may not be HTTP requests
+func captureContextError(ctx context.Context, err error) {
+	tags := map[string]string{}
+	if requestID := chiware.GetReqID(ctx); len(requestID) != 0 {
+		tags["request_id"] = requestID
+	}
+	raven.CaptureError(err, tags)
+}
@@ -0,0 +1,167 @@
+package controller
+
+import (
+	"net/http"
+	"time"
+)
+
+// Settings are the settings of the routers given Options which can be changed while they are serving, when the
+// configuration is reloaded or a secret is rotated. Maps in Settings are replaced rather than changed once the
+// settings are in use, since requests keep reading the maps they started with.
+type Settings struct {
+	// WebStoreFallbackURL is where GET requests for a single unknown extension are redirected
+	WebStoreFallbackURL string
+	// ComponentUpdaterFallbackURL is where POST requests for a single unknown extension are redirected
+	ComponentUpdaterFallbackURL string
+	// RedirectMarker is the name=value query parameter added to redirected requests, so the server they are
+	// redirected to can tell them apart, or empty to add none
+	RedirectMarker string
+	// CDNURLPrefixes maps a client's country code to the download mirror closest to it.
+	// Mirrors must use the same layout as the codebase URL template.
+	CDNURLPrefixes map[string]string
+	// CountryHeader is the header the load balancer or CDN puts the client's country code in, like
+	// CloudFront-Viewer-Country. Clients can set any header themselves, so it is empty by default and must only be set
+	// when the proxy in front of the server overwrites it. Clients aren't sent to mirrors by country while it is empty.
+	CountryHeader string
+	// MirrorProtocol answers update checks with the protocol version of the request, like 3.0,
+	// instead of always answering with extension.DefaultProtocol, for older clients which reject newer responses.
+	MirrorProtocol bool
+	// SignedURLExpiry is how long presigned download URLs are valid for
+	SignedURLExpiry time.Duration
+	// DownloadPreference is which class of download URL is listed first for clients that don't send dlpref.
+	// Clients sending dlpref="cacheable", like those behind caching enterprise proxies, always get the cacheable URL first.
+	DownloadPreference string
+	// VerifyPayloads enables downloading and verifying the CRX of every newly seen extension version after each refresh.
+	// The versions in the catalogs of tenants are verified along with those of the default catalog.
+	VerifyPayloads bool
+	// CheckLinks enables a HEAD request for every advertised CRX URL, in the catalogs of tenants too, after each refresh.
+	CheckLinks bool
+	// SuppressMissingPackages stops offering updates whose CRX is known to be unreachable,
+	// so clients don't get 404s after a botched upload.
+	SuppressMissingPackages bool
+	// MaintenanceMode makes /extensions answer 503 so load can be shed during backend incidents.
+	// The heartbeat and admin endpoints keep working so the instance isn't taken out of rotation.
+	MaintenanceMode bool
+	// MaintenanceRetryAfter is how long clients are told to wait before checking again during maintenance
+	MaintenanceRetryAfter time.Duration
+	// BackgroundShedThreshold is how many update checks can be in flight before background checks are deferred,
+	// or 0 to never defer them. Foreground checks, which the user started, are always served.
+	BackgroundShedThreshold int
+	// BackgroundRetryAfter is how long deferred background checks are told to wait before checking again
+	BackgroundRetryAfter time.Duration
+	// DedupTTL is how long the response to an update check is kept for retries with the same requestid, or 0 not to
+	// keep them. Clients which time out retry with the same request, so answering from the cache saves the work and
+	// keeps update counts and exported events from counting the same check twice.
+	DedupTTL time.Duration
+	// RetryWindow is how long the body hash of each update check is remembered to detect identical requests
+	// sent again, like the retry storms of misbehaving clients, or 0 not to. Detected retries are logged and counted.
+	RetryWindow time.Duration
+	// TUFRootVersion is the version of the TUF root metadata. It must be increased by one
+	// whenever the signing keys change, so clients can walk from the root they trust to the new one.
+	TUFRootVersion int
+	// WebStoreCacheMaxAge is how long caches like CDNs may serve GET update check responses without revalidating
+	// them, or 0 to make them revalidate with If-None-Match every time
+	WebStoreCacheMaxAge time.Duration
+	// MaxAppsPerResponse is the most apps answered in one update check response, or 0 for no limit, so pathological
+	// requests can't make the server build huge responses. POST checks answer updates before acknowledgements and
+	// leave out the rest, which clients check again later. GET checks answer the first apps and link to the rest,
+	// see nextPage.
+	MaxAppsPerResponse int
+	// UpdateBudgets are the most updates offered per minute by extension ID, so releasing a large component can't
+	// saturate CDN egress or the origin bucket. Checks over the budget are answered with noupdate and get the update
+	// when they check again. Extensions without a budget are offered to every client.
+	UpdateBudgets map[string]int
+	// AppOverrides are the overrides by app ID, for every tenant. Responders for an app take precedence.
+	AppOverrides map[string]AppOverride
+	// AdminTokens are the bearer tokens accepted by /api/admin with the release manager role.
+	// When nil the TOKEN_LIST environment variable is used.
+	AdminTokens []string
+	// ViewerTokens are the bearer tokens accepted by /api/admin and /api/stats with the viewer role.
+	// Users can also sign in with single sign-on when the Options have OIDC.
+	ViewerTokens []string
+	// TenantAdminTokens are the tokens accepted by the admin API of each tenant, by name.
+	// Tenants without tokens accept AdminTokens.
+	TenantAdminTokens map[string][]string
+	// ReleaseChannelURLs are the incoming webhook URLs of the release channels, by name.
+	// They are credentials, so they come from secrets rather than the configuration.
+	ReleaseChannelURLs map[string]string
+	// FastlyToken is the API token FastlyPurger purges with, which comes from a secret
+	FastlyToken string
+	// SigningKeys are the keys update responses are signed with, parsed with ParseSigningKeys from a secret.
+	// The first is the active key, and responses aren't signed when there are none.
+	SigningKeys []SigningKey
+}
+
+// DefaultSettings returns the settings of Options which weren't given any
+func DefaultSettings() Settings {
+	return Settings{
+		WebStoreFallbackURL:         "https://clients2.google.com/service/update2/crx",
+		ComponentUpdaterFallbackURL: "https://update.googleapis.com/service/update2",
+		RedirectMarker:              "braveRedirect=true",
+		SignedURLExpiry:             time.Hour,
+		DownloadPreference:          DownloadPreferenceCacheable,
+		MaintenanceRetryAfter:       5 * time.Minute,
+		BackgroundRetryAfter:        30 * time.Minute,
+		TUFRootVersion:              1,
+	}
+}
+
+// UpdateSettings runs update on the settings of opts while no request is reading them
+func (opts *Options) UpdateSettings(update func(settings *Settings)) {
+	opts.settingsMutex.Lock()
+	defer opts.settingsMutex.Unlock()
+	if opts.Settings == nil {
+		settings := DefaultSettings()
+		opts.Settings = &settings
+	}
+	update(opts.Settings)
+}
+
+// SetTenantAdminTokens replaces the admin tokens of the tenant called name
+func (opts *Options) SetTenantAdminTokens(name string, tokens []string) {
+	opts.UpdateSettings(func(settings *Settings) {
+		replaced := map[string][]string{name: tokens}
+		for tenant, tenantTokens := range settings.TenantAdminTokens {
+			if tenant != name {
+				replaced[tenant] = tenantTokens
+			}
+		}
+		settings.TenantAdminTokens = replaced
+	})
+}
+
+// SetReleaseChannelURL sets the incoming webhook URL of the release channel called name
+func (opts *Options) SetReleaseChannelURL(name string, url string) {
+	opts.UpdateSettings(func(settings *Settings) {
+		replaced := map[string]string{name: url}
+		for channel, channelURL := range settings.ReleaseChannelURLs {
+			if channel != name {
+				replaced[channel] = channelURL
+			}
+		}
+		settings.ReleaseChannelURLs = replaced
+	})
+}
+
+// settings returns the current settings of opts, or the default settings if opts is nil
+func (opts *Options) settings() Settings {
+	if opts == nil {
+		return DefaultSettings()
+	}
+	opts.settingsMutex.RLock()
+	defer opts.settingsMutex.RUnlock()
+	if opts.Settings == nil {
+		return DefaultSettings()
+	}
+	return *opts.Settings
+}
+
+// Reload is the handler for reloading the configuration without restarting the server
+func Reload(w http.ResponseWriter, r *http.Request) {
+	err := adminService.ReloadConfig(r.Context())
+	if err != nil {
+		writeAdminError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
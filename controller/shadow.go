@@ -0,0 +1,157 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/brave/go-update/extension"
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+	"sync"
+	"time"
+)
+
+// shadowTimeout is the deadline for repeating an operation on the secondary store of a ShadowStore
+const shadowTimeout = 30 * time.Second
+
+var shadowComparisons = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "shadow_store_comparisons_total",
+	Help: "Number of store operations repeated on the shadow store, by operation and whether the result matched, differed or failed.",
+}, []string{"operation", "result"})
+
+var shadowDifferences = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "shadow_store_differences_total",
+	Help: "Number of extensions whose records differ between the primary and shadow stores, by whether the shadow is missing, has an extra or a changed record.",
+}, []string{"kind"})
+
+func init() {
+	prometheus.MustRegister(shadowComparisons, shadowDifferences)
+}
+
+// ShadowStore answers from a primary store and repeats every operation on a secondary store in the background,
+// logging and counting where the two differ, so a new backend can be tried with production traffic before switching to it.
+// Failures and slowness of the secondary store never affect the primary.
+//
+// Each operation is repeated on the secondary store in its own goroutine, so operations started close together
+// can interleave and complete there out of order: a save can land before an earlier one, leaving the secondary
+// with an older record, and a load can be compared against a catalog changed since the primary answered.
+// Such differences are counted like any other, and the secondary store must be safe for concurrent use.
+type ShadowStore struct {
+	primary   Store
+	secondary Store
+	pending   sync.WaitGroup
+}
+
+// NewShadowStore creates a ShadowStore answering from primary and comparing secondary with it
+func NewShadowStore(primary Store, secondary Store) *ShadowStore {
+	return &ShadowStore{primary: primary, secondary: secondary}
+}
+
+// LoadExtensions loads the catalog from the primary store and compares the secondary's with it in the background
+func (store *ShadowStore) LoadExtensions(ctx context.Context) (extension.Extensions, error) {
+	extensions, err := store.primary.LoadExtensions(ctx)
+	if err != nil {
+		return extensions, err
+	}
+	primary := append(extension.Extensions{}, extensions...)
+	store.shadow(func(ctx context.Context) {
+		shadow, err := store.secondary.LoadExtensions(ctx)
+		if err != nil {
+			log.Printf("error loading the catalog from the shadow store: %v\n", err)
+			shadowComparisons.WithLabelValues("load", "error").Inc()
+			return
+		}
+		result := "match"
+		if compareCatalogs(primary, shadow) != 0 {
+			result = "diff"
+		}
+		shadowComparisons.WithLabelValues("load", result).Inc()
+	})
+	return extensions, nil
+}
+
+// SaveExtension saves to the primary store, and to the secondary in the background so it stays in step
+func (store *ShadowStore) SaveExtension(ctx context.Context, ext extension.Extension) error {
+	err := store.primary.SaveExtension(ctx, ext)
+	if err != nil {
+		return err
+	}
+	store.shadow(func(ctx context.Context) {
+		err := store.secondary.SaveExtension(ctx, ext)
+		if err != nil {
+			log.Printf("error saving %s %s to the shadow store: %v\n", ext.ID, ext.Version, err)
+			shadowComparisons.WithLabelValues("save", "error").Inc()
+			return
+		}
+		shadowComparisons.WithLabelValues("save", "match").Inc()
+	})
+	return nil
+}
+
+// DeleteExtension deletes from the primary store, and from the secondary in the background like SaveExtension
+func (store *ShadowStore) DeleteExtension(ctx context.Context, id string) error {
+	err := store.primary.DeleteExtension(ctx, id)
+	if err != nil {
+		return err
+	}
+	store.shadow(func(ctx context.Context) {
+		err := store.secondary.DeleteExtension(ctx, id)
+		if err != nil {
+			log.Printf("error deleting %s from the shadow store: %v\n", id, err)
+			shadowComparisons.WithLabelValues("delete", "error").Inc()
+			return
+		}
+		shadowComparisons.WithLabelValues("delete", "match").Inc()
+	})
+	return nil
+}
+
+// Wait blocks until the operations being repeated on the secondary store have finished
+func (store *ShadowStore) Wait() {
+	store.pending.Wait()
+}
+
+// shadow runs fn against the secondary store in the background with its own deadline,
+// concurrently with the operations already pending there
+func (store *ShadowStore) shadow(fn func(ctx context.Context)) {
+	store.pending.Add(1)
+	go func() {
+		defer store.pending.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), shadowTimeout)
+		defer cancel()
+		fn(ctx)
+	}()
+}
+
+// compareCatalogs logs and counts each extension whose record differs between the primary and shadow catalogs,
+// and returns how many do. Records are compared as JSON, the way the admin API shows them.
+func compareCatalogs(primary extension.Extensions, shadow extension.Extensions) int {
+	shadowByID := map[string]extension.Extension{}
+	for _, ext := range shadow {
+		shadowByID[ext.ID] = ext
+	}
+	differences := 0
+	for _, ext := range primary {
+		other, ok := shadowByID[ext.ID]
+		delete(shadowByID, ext.ID)
+		if !ok {
+			log.Printf("shadow store is missing %s %s\n", ext.ID, ext.Version)
+			shadowDifferences.WithLabelValues("missing").Inc()
+			differences++
+			continue
+		}
+		expected, _ := json.Marshal(ext)
+		actual, _ := json.Marshal(other)
+		if !bytes.Equal(expected, actual) {
+			log.Printf("shadow store record of %s differs: %s rather than %s\n", ext.ID, actual, expected)
+			shadowDifferences.WithLabelValues("changed").Inc()
+			differences++
+		}
+	}
+	for id, ext := range shadowByID {
+		log.Printf("shadow store has extra extension %s %s\n", id, ext.Version)
+		shadowDifferences.WithLabelValues("extra").Inc()
+		differences++
+	}
+	return differences
+}
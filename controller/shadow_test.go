@@ -0,0 +1,49 @@
+package controller_test
+
+import (
+	"context"
+	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/extension"
+	"github.com/brave/go-update/memstore"
+	"github.com/stretchr/testify/assert"
+	"sync/atomic"
+	"testing"
+)
+
+func TestShadowStore(t *testing.T) {
+	ctx := context.Background()
+	primary := memstore.New(extension.Extensions{newExtension1})
+	secondary := memstore.New(nil)
+	store := controller.NewShadowStore(primary, secondary)
+	extensions, err := store.LoadExtensions(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, extension.Extensions{newExtension1}, extensions)
+	store.Wait()
+
+	// Saves are repeated on the shadow store so it stays in step
+	updated := newExtension1
+	updated.Version = "2.0.0"
+	assert.Nil(t, store.SaveExtension(ctx, updated))
+	store.Wait()
+	shadow, err := secondary.LoadExtensions(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, extension.Extensions{updated}, shadow)
+
+	// Failures of the shadow store don't reach the caller
+	var calls int64
+	store = controller.NewShadowStore(primary, failingStore{&calls})
+	extensions, err = store.LoadExtensions(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, extension.Extensions{updated}, extensions)
+	assert.Nil(t, store.SaveExtension(ctx, updated))
+	store.Wait()
+	assert.Equal(t, int64(2), atomic.LoadInt64(&calls))
+
+	// Failures of the primary store are returned without trying the shadow
+	store = controller.NewShadowStore(failingStore{&calls}, secondary)
+	_, err = store.LoadExtensions(ctx)
+	assert.NotNil(t, err)
+	assert.NotNil(t, store.SaveExtension(ctx, updated))
+	store.Wait()
+	assert.Equal(t, int64(4), atomic.LoadInt64(&calls))
+}
@@ -0,0 +1,47 @@
+package controller
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+)
+
+// inFlightChecks is the number of update checks currently being handled
+var inFlightChecks int64
+
+var checksShed = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "update_checks_shed_total",
+	Help: "Number of background update checks deferred because the server was under load.",
+})
+
+func init() {
+	prometheus.MustRegister(checksShed)
+}
+
+// isBackgroundCheck returns true if the client says the update check wasn't started by the user.
+// Chromium sends X-Goog-Update-Interactivity with "bg" or "fg", and checks without it are served.
+func isBackgroundCheck(r *http.Request) bool {
+	return r.Header.Get("X-Goog-Update-Interactivity") == "bg"
+}
+
+// shedBackgroundChecks answers background update checks with 503 and Retry-After
+// while more than the BackgroundShedThreshold of the settings serving them are in flight
+func shedBackgroundChecks(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inFlight := atomic.AddInt64(&inFlightChecks, 1)
+		defer atomic.AddInt64(&inFlightChecks, -1)
+
+		settings := optionsFor(r.Context()).settings()
+		threshold := settings.BackgroundShedThreshold
+		if threshold > 0 && inFlight > int64(threshold) && isBackgroundCheck(r) {
+			checksShed.Inc()
+			seconds := strconv.Itoa(int(settings.BackgroundRetryAfter.Seconds()))
+			w.Header().Set("Retry-After", seconds)
+			w.Header().Set("X-Retry-After", seconds)
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,63 @@
+package controller_test
+
+import (
+	"bytes"
+	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/extension/extensiontest"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBackgroundShedding(t *testing.T) {
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	handlerOptions.UpdateSettings(func(settings *controller.Settings) {
+		settings.BackgroundShedThreshold = 1
+	})
+	defer handlerOptions.UpdateSettings(func(settings *controller.Settings) {
+		settings.BackgroundShedThreshold = 0
+	})
+
+	requestBody := extensiontest.ExtensionRequestFnFor("ldimlcelhnjgpjjemdjokpgeeikdinbm")("0.0.0")
+	check := func(interactivity string) *http.Response {
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/extensions", bytes.NewBufferString(requestBody))
+		assert.Nil(t, err)
+		req.Header.Set("X-Goog-Update-Interactivity", interactivity)
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		return resp
+	}
+	assert.Equal(t, http.StatusOK, check("bg").StatusCode)
+
+	// Keep a check in flight by not finishing its body
+	body, writer := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		resp, err := http.Post(server.URL+"/extensions", "application/xml", body)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		close(done)
+	}()
+	var resp *http.Response
+	for i := 0; i < 100; i++ {
+		if resp = check("bg"); resp.StatusCode == http.StatusServiceUnavailable {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, "1800", resp.Header.Get("Retry-After"))
+	assert.Equal(t, "1800", resp.Header.Get("X-Retry-After"))
+	// Checks the user started are always served
+	assert.Equal(t, http.StatusOK, check("fg").StatusCode)
+
+	_, err := writer.Write([]byte(requestBody))
+	assert.Nil(t, err)
+	assert.Nil(t, writer.Close())
+	<-done
+	assert.Equal(t, http.StatusOK, check("bg").StatusCode)
+}
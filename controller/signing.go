@@ -0,0 +1,170 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/ed25519"
+	"net/http"
+	"time"
+)
+
+// SignatureHeader carries the detached Ed25519 signature of an update response body,
+// for clients which don't implement CUP
+const SignatureHeader = "X-Brave-Update-Signature"
+
+// Statuses of signing keys in their rotation
+const (
+	// SigningKeyActive is the key responses are signed with
+	SigningKeyActive = "active"
+	// SigningKeyNext is published ahead of a rotation so clients trust it before it signs anything
+	SigningKeyNext = "next"
+	// SigningKeyRetired is kept published so responses signed before a rotation can still be verified
+	SigningKeyRetired = "retired"
+)
+
+// SigningKey is an Ed25519 key used to sign update responses, or published for verifying them.
+// Only the active key needs its private key.
+type SigningKey struct {
+	ID         string
+	Status     string
+	Expires    time.Time
+	PublicKey  ed25519.PublicKey
+	PrivateKey ed25519.PrivateKey
+}
+
+// ParseSigningKeys parses the JSON list of signing keys kept in a secret, like
+// [{"id": "2024-01", "status": "active", "privateKey": "<base64 seed>", "expires": "2025-01-01T00:00:00Z"}].
+// Keys which aren't active can list only their base64 publicKey. Exactly one key must be active.
+func ParseSigningKeys(value string) ([]SigningKey, error) {
+	entries := []struct {
+		ID         string    `json:"id"`
+		Status     string    `json:"status"`
+		Expires    time.Time `json:"expires"`
+		PublicKey  string    `json:"publicKey"`
+		PrivateKey string    `json:"privateKey"`
+	}{}
+	err := json.Unmarshal([]byte(value), &entries)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing signing keys: %v", err)
+	}
+	keys := []SigningKey{}
+	active := -1
+	for _, entry := range entries {
+		key := SigningKey{ID: entry.ID, Status: entry.Status, Expires: entry.Expires}
+		if len(key.ID) == 0 {
+			return nil, errors.New("every signing key needs an id")
+		}
+		if len(entry.PrivateKey) != 0 {
+			seed, err := base64.StdEncoding.DecodeString(entry.PrivateKey)
+			if err != nil || len(seed) != ed25519.SeedSize {
+				return nil, fmt.Errorf("signing key %s: privateKey must be a base64 %d byte seed", key.ID, ed25519.SeedSize)
+			}
+			key.PrivateKey = ed25519.NewKeyFromSeed(seed)
+			key.PublicKey = key.PrivateKey.Public().(ed25519.PublicKey)
+		} else {
+			public, err := base64.StdEncoding.DecodeString(entry.PublicKey)
+			if err != nil || len(public) != ed25519.PublicKeySize {
+				return nil, fmt.Errorf("signing key %s: publicKey must be a base64 %d byte key", key.ID, ed25519.PublicKeySize)
+			}
+			key.PublicKey = public
+		}
+		switch key.Status {
+		case SigningKeyActive:
+			if active >= 0 {
+				return nil, errors.New("only one signing key can be active")
+			}
+			if key.PrivateKey == nil {
+				return nil, fmt.Errorf("active signing key %s needs its privateKey", key.ID)
+			}
+			active = len(keys)
+		case SigningKeyNext, SigningKeyRetired:
+		default:
+			return nil, fmt.Errorf("signing key %s: status %q must be active, next or retired", key.ID, key.Status)
+		}
+		keys = append(keys, key)
+	}
+	if active < 0 {
+		return nil, errors.New("one signing key must be active")
+	}
+	keys[0], keys[active] = keys[active], keys[0]
+	return keys, nil
+}
+
+// SigningKeys returns the current signing keys of opts, the active key first
+func (opts *Options) SigningKeys() []SigningKey {
+	return opts.settings().SigningKeys
+}
+
+// signingResponseWriter holds back the response body so it can be signed once complete
+type signingResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *signingResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *signingResponseWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(data)
+}
+
+// signResponses adds a detached signature of successful update response bodies in SignatureHeader,
+// like keyid="2024-01", sig="<base64>", made with the active signing key
+func signResponses(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys := optionsFor(r.Context()).SigningKeys()
+		if len(keys) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		signing := &signingResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(signing, r)
+		if signing.status == 0 {
+			signing.status = http.StatusOK
+		}
+		if signing.status == http.StatusOK {
+			signature := ed25519.Sign(keys[0].PrivateKey, signing.body.Bytes())
+			w.Header().Set(SignatureHeader, fmt.Sprintf(`keyid="%s", sig="%s"`, keys[0].ID, base64.StdEncoding.EncodeToString(signature)))
+		}
+		w.WriteHeader(signing.status)
+		_, _ = w.Write(signing.body.Bytes())
+	})
+}
+
+// GetSigningKeys is the handler for the public keys update responses are signed with, and their rotation status
+func GetSigningKeys(w http.ResponseWriter, r *http.Request) {
+	type Key struct {
+		ID        string     `json:"id"`
+		Algorithm string     `json:"algorithm"`
+		Status    string     `json:"status"`
+		PublicKey string     `json:"publicKey"`
+		Expires   *time.Time `json:"expires,omitempty"`
+	}
+	keys := []Key{}
+	for _, signingKey := range optionsFor(r.Context()).SigningKeys() {
+		key := Key{
+			ID:        signingKey.ID,
+			Algorithm: "ed25519",
+			Status:    signingKey.Status,
+			PublicKey: base64.StdEncoding.EncodeToString(signingKey.PublicKey),
+		}
+		if !signingKey.Expires.IsZero() {
+			expires := signingKey.Expires
+			key.Expires = &expires
+		}
+		keys = append(keys, key)
+	}
+	// Clients poll for new keys, but they only change on rotation
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	writeJSON(w, r, http.StatusOK, map[string]interface{}{"keys": keys})
+}
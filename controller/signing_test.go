@@ -0,0 +1,83 @@
+package controller_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/extension/extensiontest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ed25519"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResponseSigning(t *testing.T) {
+	active := bytes.Repeat([]byte{1}, ed25519.SeedSize)
+	next := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{2}, ed25519.SeedSize)).Public().(ed25519.PublicKey)
+	secret := fmt.Sprintf(`[
+		{"id": "2024-02", "status": "next", "publicKey": "%s"},
+		{"id": "2024-01", "status": "active", "privateKey": "%s", "expires": "2030-01-01T00:00:00Z"}
+	]`, base64.StdEncoding.EncodeToString(next), base64.StdEncoding.EncodeToString(active))
+	signingKeys, err := controller.ParseSigningKeys(secret)
+	assert.Nil(t, err)
+	handlerOptions.UpdateSettings(func(settings *controller.Settings) {
+		settings.SigningKeys = signingKeys
+	})
+	defer handlerOptions.UpdateSettings(func(settings *controller.Settings) {
+		settings.SigningKeys = nil
+	})
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	// The active key is published with the keys rotating in and out
+	resp, err := http.Get(server.URL + "/keys")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	keys := struct {
+		Keys []struct {
+			ID        string `json:"id"`
+			Algorithm string `json:"algorithm"`
+			Status    string `json:"status"`
+			PublicKey string `json:"publicKey"`
+		} `json:"keys"`
+	}{}
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(&keys))
+	assert.Equal(t, 2, len(keys.Keys))
+	assert.Equal(t, "2024-01", keys.Keys[0].ID)
+	assert.Equal(t, "active", keys.Keys[0].Status)
+	assert.Equal(t, "ed25519", keys.Keys[0].Algorithm)
+	assert.Equal(t, "next", keys.Keys[1].Status)
+	publicKey, err := base64.StdEncoding.DecodeString(keys.Keys[0].PublicKey)
+	assert.Nil(t, err)
+
+	// Update responses carry a signature of their body
+	requestBody := extensiontest.ExtensionRequestFnFor("ldimlcelhnjgpjjemdjokpgeeikdinbm")("0.0.0")
+	resp, err = http.Post(server.URL+"/extensions", "application/xml", bytes.NewBufferString(requestBody))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	header := resp.Header.Get(controller.SignatureHeader)
+	assert.True(t, strings.HasPrefix(header, `keyid="2024-01", sig="`))
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSuffix(strings.TrimPrefix(header, `keyid="2024-01", sig="`), `"`))
+	assert.Nil(t, err)
+	assert.True(t, ed25519.Verify(publicKey, body, signature))
+
+	// Errors aren't signed
+	resp, err = http.Post(server.URL+"/extensions", "application/xml", bytes.NewBufferString("<request"))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Empty(t, resp.Header.Get(controller.SignatureHeader))
+
+	// A secret without an active key is rejected
+	_, err = controller.ParseSigningKeys(fmt.Sprintf(`[{"id": "2024-02", "status": "next", "publicKey": "%s"}]`, base64.StdEncoding.EncodeToString(next)))
+	assert.NotNil(t, err)
+	_, err = controller.ParseSigningKeys(`[{"id": "2024-01", "status": "active", "privateKey": "c2hvcnQ="}]`)
+	assert.NotNil(t, err)
+}
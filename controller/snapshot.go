@@ -0,0 +1,150 @@
+package controller
+
+import (
+	"github.com/brave/go-update/extension"
+	"github.com/prometheus/client_golang/prometheus"
+	"sync"
+	"sync/atomic"
+)
+
+var catalogGeneration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "catalog_generation",
+	Help: "Generation of the catalog being served, which increases every time it changes.",
+}, []string{"tenant"})
+
+func init() {
+	prometheus.MustRegister(catalogGeneration)
+}
+
+// CatalogSnapshot is a catalog as it was at one point. It never changes, so requests can read it
+// without locking; changes to the catalog replace the snapshot instead, with the next generation.
+type CatalogSnapshot struct {
+	extensions map[string]extension.Extension
+	generation uint64
+}
+
+// emptySnapshot is the snapshot of catalogs which were never loaded
+var emptySnapshot = &CatalogSnapshot{extensions: map[string]extension.Extension{}}
+
+// Lookup returns the extension with id
+func (snapshot *CatalogSnapshot) Lookup(id string) (extension.Extension, bool) {
+	ext, ok := snapshot.extensions[id]
+	return ext, ok
+}
+
+// Map returns the extensions by ID, which must not be changed
+func (snapshot *CatalogSnapshot) Map() map[string]extension.Extension {
+	return snapshot.extensions
+}
+
+// Len returns the number of extensions
+func (snapshot *CatalogSnapshot) Len() int {
+	return len(snapshot.extensions)
+}
+
+// Generation returns the number of times the catalog had changed when the snapshot was taken
+func (snapshot *CatalogSnapshot) Generation() uint64 {
+	return snapshot.generation
+}
+
+// catalogHolder holds the current snapshot of a catalog, which is swapped atomically by writers.
+// The zero value holds an empty catalog.
+type catalogHolder struct {
+	// tenant labels the generation metric, and is empty for the default catalog
+	tenant string
+	// noPurge is set for catalogs which aren't served by the server's own routes, so Purger isn't told about them
+	noPurge bool
+	// options are those the catalog belongs to, for its clock and purger, or nil for the package's catalogs
+	options *Options
+	// writeMutex serializes writers, so changes made at the same time aren't lost
+	writeMutex sync.Mutex
+	current    atomic.Value
+	// uploadMutexes serialize the uploads of each extension by ID, so every upload is checked against the
+	// version the one before it saved. They are guarded by writeMutex.
+	uploadMutexes map[string]*sync.Mutex
+	// quarantined are the records left out at the last refresh, guarded by quarantineMutex
+	quarantineMutex sync.Mutex
+	quarantined     []QuarantinedRecord
+	// tuf is the signed TUF metadata of the catalog, guarded by tufMutex
+	tufMutex sync.Mutex
+	tuf      *tufMetadata
+	// publishTimers are the scheduled versions waiting to be published, so refreshing the catalog doesn't start
+	// another timer for each of them. They are guarded by publishTimersMutex.
+	publishTimersMutex sync.Mutex
+	publishTimers      map[publishTimer]bool
+}
+
+// snapshot returns the current snapshot
+func (holder *catalogHolder) snapshot() *CatalogSnapshot {
+	if snapshot, ok := holder.current.Load().(*CatalogSnapshot); ok {
+		return snapshot
+	}
+	return emptySnapshot
+}
+
+// replace makes extensions the catalog, which must not be changed afterwards
+func (holder *catalogHolder) replace(extensions map[string]extension.Extension) *CatalogSnapshot {
+	holder.writeMutex.Lock()
+	defer holder.writeMutex.Unlock()
+	return holder.store(extensions)
+}
+
+// lockUploads waits until no other upload of the extension with id is running and returns the function ending this one
+func (holder *catalogHolder) lockUploads(id string) func() {
+	holder.writeMutex.Lock()
+	if holder.uploadMutexes == nil {
+		holder.uploadMutexes = map[string]*sync.Mutex{}
+	}
+	mutex, ok := holder.uploadMutexes[id]
+	if !ok {
+		mutex = &sync.Mutex{}
+		holder.uploadMutexes[id] = mutex
+	}
+	holder.writeMutex.Unlock()
+	mutex.Lock()
+	return mutex.Unlock
+}
+
+// update replaces the catalog with a copy changed by change
+func (holder *catalogHolder) update(change func(extensions map[string]extension.Extension)) *CatalogSnapshot {
+	holder.writeMutex.Lock()
+	defer holder.writeMutex.Unlock()
+	current := holder.snapshot().extensions
+	extensions := make(map[string]extension.Extension, len(current)+1)
+	for id, ext := range current {
+		extensions[id] = ext
+	}
+	change(extensions)
+	return holder.store(extensions)
+}
+
+// store swaps in a snapshot of extensions with the next generation. The write mutex must be held.
+func (holder *catalogHolder) store(extensions map[string]extension.Extension) *CatalogSnapshot {
+	previous := holder.snapshot()
+	snapshot := &CatalogSnapshot{extensions: extensions, generation: previous.generation + 1}
+	holder.current.Store(snapshot)
+	catalogGeneration.WithLabelValues(holder.tenant).Set(float64(snapshot.generation))
+	if !holder.noPurge {
+		purgeChanges(holder.options, holder.tenant, previous, snapshot)
+	}
+	return snapshot
+}
+
+// defaultCatalog is the catalog served to requests which aren't for a tenant by routers whose Options have no Store.
+// For normal operations it is loaded from ExtensionStore, and for tests from extension.OfferedExtensions.
+var defaultCatalog catalogHolder
+
+// CurrentCatalog returns the current snapshot of the default catalog
+func CurrentCatalog() *CatalogSnapshot {
+	return defaultCatalog.snapshot()
+}
+
+// SetCatalog replaces the default catalog with extensions, which must not be changed afterwards
+func SetCatalog(extensions map[string]extension.Extension) {
+	defaultCatalog.replace(extensions)
+}
+
+// UpdateCatalog replaces the default catalog with a copy changed by change
+func UpdateCatalog(change func(extensions map[string]extension.Extension)) {
+	defaultCatalog.update(change)
+}
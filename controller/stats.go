@@ -0,0 +1,18 @@
+package controller
+
+import (
+	"context"
+	"github.com/brave/go-update/extension"
+)
+
+// recordUpdatesServed counts every update offered to a client, by extension and protocol,
+// and adds versions served for the first time to the transparency log
+func recordUpdatesServed(ctx context.Context, extensions []extension.Extension, protocol string) {
+	opts := optionsFor(ctx)
+	opts.logServed(extensions)
+	stats := opts.stats()
+	for _, ext := range extensions {
+		opts.countExtensionStats(ExtensionStats{ID: ext.ID, Version: ext.Version, UpdatesServed: 1})
+		stats.Incr("updates.served", "id:"+ext.ID, "version:"+ext.Version, "protocol:"+protocol)
+	}
+}
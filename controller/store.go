@@ -0,0 +1,353 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/brave/go-update/extension"
+	"io/ioutil"
+	"log"
+	"strconv"
+	"sync"
+)
+
+// Store is where the extensions catalog is loaded from and saved to
+type Store interface {
+	// LoadExtensions returns every extension in the catalog
+	LoadExtensions(ctx context.Context) (extension.Extensions, error)
+	// SaveExtension creates or replaces the catalog record for an extension
+	SaveExtension(ctx context.Context, ext extension.Extension) error
+	// DeleteExtension removes the catalog record of the extension with id, if there is one
+	DeleteExtension(ctx context.Context, id string) error
+}
+
+// ExtensionStore is the store the catalog is refreshed from and uploads are saved to
+var ExtensionStore Store = NewBreakerStore("dynamodb", NewRetryStore("dynamodb", DynamoDBStore{}, DefaultRetrySettings), DefaultBreakerSettings)
+
+// ManifestStore is a read only catalog pinned in a JSON file holding a list of extensions,
+// like the one returned by GET /api/v1/admin/catalog, or the v2 catalog object
+type ManifestStore struct {
+	Path string
+}
+
+// LoadExtensions reads every extension from the manifest
+func (store ManifestStore) LoadExtensions(ctx context.Context) (extension.Extensions, error) {
+	data, err := ioutil.ReadFile(store.Path)
+	if err != nil {
+		return nil, err
+	}
+	extensions := extension.Extensions{}
+	// The v2 catalog wraps the list in an object
+	if trimmed := bytes.TrimSpace(data); len(trimmed) != 0 && trimmed[0] == '{' {
+		catalog := struct {
+			Extensions *extension.Extensions `json:"extensions"`
+		}{&extensions}
+		err = json.Unmarshal(data, &catalog)
+	} else {
+		err = json.Unmarshal(data, &extensions)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing manifest %s: %v", store.Path, err)
+	}
+	return extensions, nil
+}
+
+// SaveExtension always fails since the manifest is pinned
+func (store ManifestStore) SaveExtension(ctx context.Context, ext extension.Extension) error {
+	return errors.New("the catalog manifest is read only")
+}
+
+// DeleteExtension always fails since the manifest is pinned
+func (store ManifestStore) DeleteExtension(ctx context.Context, id string) error {
+	return errors.New("the catalog manifest is read only")
+}
+
+// DynamoDBStore keeps the catalog in a DynamoDB table
+type DynamoDBStore struct {
+	// Table is the name of the table, Extensions if not set
+	Table string
+	// Region is the region of the table, DefaultAWSRegion if not set
+	Region string
+	// Endpoint overrides the DynamoDB endpoint, for example to use DynamoDB Local
+	Endpoint string
+	// ScanSegments is how many segments the table is scanned in parallel, 1 if not set
+	ScanSegments int
+}
+
+func (store DynamoDBStore) table() string {
+	if len(store.Table) == 0 {
+		return "Extensions"
+	}
+	return store.Table
+}
+
+func (store DynamoDBStore) client(ctx context.Context) (*dynamodb.Client, error) {
+	cfg, err := AWSConfig(ctx, regionOrDefault(store.Region))
+	if err != nil {
+		return nil, err
+	}
+	return dynamodb.NewFromConfig(cfg, func(options *dynamodb.Options) {
+		// Retries are left to RetryStore
+		options.Retryer = aws.NopRetryer{}
+		if len(store.Endpoint) != 0 {
+			options.BaseEndpoint = aws.String(store.Endpoint)
+		}
+	}), nil
+}
+
+// LoadExtensions scans the whole Extensions table, following every page of results
+func (store DynamoDBStore) LoadExtensions(ctx context.Context) (extension.Extensions, error) {
+	svc, err := store.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// For most use cases, you probably wouldn't want to scan all entries; however,
+	// for our use case we have a read only small number of items, that are infrequently
+	// updated, usually less than daily by an external tool, and very often queried.
+	// Scans return at most 1MB per page, and large catalogs can be split into parallel segments.
+	segments := store.ScanSegments
+	if segments < 1 {
+		segments = 1
+	}
+	results := make([]extension.Extensions, segments)
+	errs := make([]error, segments)
+	var wg sync.WaitGroup
+	for segment := 0; segment < segments; segment++ {
+		wg.Add(1)
+		go func(segment int) {
+			defer wg.Done()
+			params := &dynamodb.ScanInput{
+				TableName: aws.String(store.table()),
+			}
+			if segments > 1 {
+				params.Segment = aws.Int32(int32(segment))
+				params.TotalSegments = aws.Int32(int32(segments))
+			}
+			pages := dynamodb.NewScanPaginator(svc, params)
+			for pages.HasMorePages() {
+				page, err := pages.NextPage(ctx)
+				if err != nil {
+					errs[segment] = err
+					return
+				}
+				for _, item := range page.Items {
+					results[segment] = append(results[segment], extensionFromItem(item))
+				}
+			}
+		}(segment)
+	}
+	wg.Wait()
+
+	extensions := extension.Extensions{}
+	for segment := range results {
+		if errs[segment] != nil {
+			return nil, errs[segment]
+		}
+		extensions = append(extensions, results[segment]...)
+	}
+	return extensions, nil
+}
+
+// itemString returns the string attribute name of item, and false if it has none
+func itemString(item map[string]types.AttributeValue, name string) (string, bool) {
+	value, ok := item[name].(*types.AttributeValueMemberS)
+	if !ok {
+		return "", false
+	}
+	return value.Value, true
+}
+
+// itemNumber returns the number attribute name of item, and false if it has none
+func itemNumber(item map[string]types.AttributeValue, name string) (string, bool) {
+	value, ok := item[name].(*types.AttributeValueMemberN)
+	if !ok {
+		return "", false
+	}
+	return value.Value, true
+}
+
+// itemBool returns the boolean attribute name of item, and false if it has none
+func itemBool(item map[string]types.AttributeValue, name string) (bool, bool) {
+	value, ok := item[name].(*types.AttributeValueMemberBOOL)
+	if !ok {
+		return false, false
+	}
+	return value.Value, true
+}
+
+func extensionFromItem(item map[string]types.AttributeValue) extension.Extension {
+	id, _ := itemString(item, "ID")
+	ext := extension.Extension{ID: id}
+	ext.Blacklisted, _ = itemBool(item, "Disabled")
+	ext.SHA256, _ = itemString(item, "SHA256")
+	ext.Title, _ = itemString(item, "Title")
+	ext.Version, _ = itemString(item, "Version")
+	// Size was added later so older items don't have it
+	if size, ok := itemNumber(item, "Size"); ok {
+		var err error
+		ext.Size, err = strconv.ParseInt(size, 10, 64)
+		if err != nil {
+			log.Printf("invalid size for extension %s: %v\n", id, err)
+		}
+	}
+	ext.Type, _ = itemString(item, "Type")
+	ext.PackageName, _ = itemString(item, "PackageName")
+	ext.Optional, _ = itemBool(item, "Optional")
+	if dependencies, ok := item["Dependencies"].(*types.AttributeValueMemberSS); ok {
+		ext.Dependencies = dependencies.Value
+	}
+	if scheduled, ok := itemString(item, "Scheduled"); ok {
+		ext.Scheduled = &extension.Extension{}
+		err := json.Unmarshal([]byte(scheduled), ext.Scheduled)
+		if err != nil {
+			log.Printf("invalid scheduled version for extension %s: %v\n", id, err)
+			ext.Scheduled = nil
+		}
+	}
+	if rules, ok := itemString(item, "Rules"); ok {
+		err := json.Unmarshal([]byte(rules), &ext.Rules)
+		if err != nil {
+			log.Printf("invalid rules for extension %s: %v\n", id, err)
+			ext.Rules = nil
+		}
+	}
+	if locales, ok := itemString(item, "Locales"); ok {
+		err := json.Unmarshal([]byte(locales), &ext.Locales)
+		if err != nil {
+			log.Printf("invalid locales for extension %s: %v\n", id, err)
+			ext.Locales = nil
+		}
+	}
+	if minPhysMemory, ok := itemNumber(item, "MinPhysMemory"); ok {
+		var err error
+		ext.MinPhysMemory, err = strconv.Atoi(minPhysMemory)
+		if err != nil {
+			log.Printf("invalid minimum memory for extension %s: %v\n", id, err)
+		}
+	}
+	if lite, ok := itemString(item, "Lite"); ok {
+		ext.Lite = &extension.Package{}
+		err := json.Unmarshal([]byte(lite), ext.Lite)
+		if err != nil {
+			log.Printf("invalid lite package for extension %s: %v\n", id, err)
+			ext.Lite = nil
+		}
+	}
+	if actions, ok := itemString(item, "Actions"); ok {
+		err := json.Unmarshal([]byte(actions), &ext.Actions)
+		if err != nil {
+			log.Printf("invalid actions for extension %s: %v\n", id, err)
+			ext.Actions = nil
+		}
+	}
+	ext.ReleaseNotes, _ = itemString(item, "ReleaseNotes")
+	if installData, ok := itemString(item, "InstallData"); ok {
+		err := json.Unmarshal([]byte(installData), &ext.InstallData)
+		if err != nil {
+			log.Printf("invalid install data for extension %s: %v\n", id, err)
+			ext.InstallData = nil
+		}
+	}
+	return ext
+}
+
+// SaveExtension puts the extension record into the Extensions table
+func (store DynamoDBStore) SaveExtension(ctx context.Context, ext extension.Extension) error {
+	svc, err := store.client(ctx)
+	if err != nil {
+		return err
+	}
+	item := map[string]types.AttributeValue{
+		"ID":       &types.AttributeValueMemberS{Value: ext.ID},
+		"Disabled": &types.AttributeValueMemberBOOL{Value: ext.Blacklisted},
+		"SHA256":   &types.AttributeValueMemberS{Value: ext.SHA256},
+		"Title":    &types.AttributeValueMemberS{Value: ext.Title},
+		"Version":  &types.AttributeValueMemberS{Value: ext.Version},
+		"Size":     &types.AttributeValueMemberN{Value: strconv.FormatInt(ext.Size, 10)},
+	}
+	if len(ext.Type) != 0 {
+		item["Type"] = &types.AttributeValueMemberS{Value: ext.Type}
+	}
+	if len(ext.PackageName) != 0 {
+		item["PackageName"] = &types.AttributeValueMemberS{Value: ext.PackageName}
+	}
+	if ext.Optional {
+		item["Optional"] = &types.AttributeValueMemberBOOL{Value: true}
+	}
+	// String sets can't be empty
+	if len(ext.Dependencies) != 0 {
+		item["Dependencies"] = &types.AttributeValueMemberSS{Value: ext.Dependencies}
+	}
+	if ext.Scheduled != nil {
+		scheduled, err := json.Marshal(ext.Scheduled)
+		if err != nil {
+			return err
+		}
+		item["Scheduled"] = &types.AttributeValueMemberS{Value: string(scheduled)}
+	}
+	if len(ext.Rules) != 0 {
+		rules, err := json.Marshal(ext.Rules)
+		if err != nil {
+			return err
+		}
+		item["Rules"] = &types.AttributeValueMemberS{Value: string(rules)}
+	}
+	if len(ext.Locales) != 0 {
+		locales, err := json.Marshal(ext.Locales)
+		if err != nil {
+			return err
+		}
+		item["Locales"] = &types.AttributeValueMemberS{Value: string(locales)}
+	}
+	if ext.MinPhysMemory != 0 {
+		item["MinPhysMemory"] = &types.AttributeValueMemberN{Value: strconv.Itoa(ext.MinPhysMemory)}
+	}
+	if ext.Lite != nil {
+		lite, err := json.Marshal(ext.Lite)
+		if err != nil {
+			return err
+		}
+		item["Lite"] = &types.AttributeValueMemberS{Value: string(lite)}
+	}
+	if len(ext.Actions) != 0 {
+		actions, err := json.Marshal(ext.Actions)
+		if err != nil {
+			return err
+		}
+		item["Actions"] = &types.AttributeValueMemberS{Value: string(actions)}
+	}
+	if len(ext.ReleaseNotes) != 0 {
+		item["ReleaseNotes"] = &types.AttributeValueMemberS{Value: ext.ReleaseNotes}
+	}
+	if len(ext.InstallData) != 0 {
+		installData, err := json.Marshal(ext.InstallData)
+		if err != nil {
+			return err
+		}
+		item["InstallData"] = &types.AttributeValueMemberS{Value: string(installData)}
+	}
+	_, err = svc.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(store.table()),
+		Item:      item,
+	})
+	return err
+}
+
+// DeleteExtension deletes the extension's record from the Extensions table
+func (store DynamoDBStore) DeleteExtension(ctx context.Context, id string) error {
+	svc, err := store.client(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = svc.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(store.table()),
+		Key:       map[string]types.AttributeValue{"ID": &types.AttributeValueMemberS{Value: id}},
+	})
+	return err
+}
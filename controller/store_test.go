@@ -0,0 +1,78 @@
+package controller_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/extension"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeDynamoDB serves Scan requests for the Extensions table from items, two items per page
+func fakeDynamoDB(t *testing.T, items []extension.Extension) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "DynamoDB_20120810.Scan", r.Header.Get("X-Amz-Target"))
+		var input struct {
+			TableName         string
+			ExclusiveStartKey map[string]map[string]string
+			Segment           int
+			TotalSegments     int
+		}
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&input))
+		assert.Equal(t, "Extensions", input.TableName)
+
+		// Each segment gets every nth item
+		segment := []extension.Extension{}
+		for i, ext := range items {
+			if input.TotalSegments == 0 || i%input.TotalSegments == input.Segment {
+				segment = append(segment, ext)
+			}
+		}
+		start := 0
+		if key, ok := input.ExclusiveStartKey["ID"]; ok {
+			for i, ext := range segment {
+				if ext.ID == key["S"] {
+					start = i + 1
+				}
+			}
+		}
+		end := start + 2
+		if end > len(segment) {
+			end = len(segment)
+		}
+
+		output := map[string]interface{}{}
+		page := []map[string]interface{}{}
+		for _, ext := range segment[start:end] {
+			page = append(page, map[string]interface{}{
+				"ID":       map[string]string{"S": ext.ID},
+				"Disabled": map[string]bool{"BOOL": ext.Blacklisted},
+				"SHA256":   map[string]string{"S": ext.SHA256},
+				"Title":    map[string]string{"S": ext.Title},
+				"Version":  map[string]string{"S": ext.Version},
+			})
+		}
+		output["Items"] = page
+		if end < len(segment) {
+			output["LastEvaluatedKey"] = map[string]interface{}{"ID": map[string]string{"S": segment[end-1].ID}}
+		}
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		assert.Nil(t, json.NewEncoder(w).Encode(output))
+	}))
+}
+
+func TestDynamoDBStoreScan(t *testing.T) {
+	dynamoDB := fakeDynamoDB(t, extension.OfferedExtensions)
+	defer dynamoDB.Close()
+
+	for _, segments := range []int{1, 3} {
+		store := controller.DynamoDBStore{Endpoint: dynamoDB.URL, ScanSegments: segments}
+		extensions, err := store.LoadExtensions(context.Background())
+		assert.Nil(t, err)
+		assert.Equal(t, len(extension.OfferedExtensions), len(extensions))
+		assert.Equal(t, extension.LoadExtensionsIntoMap(&extension.OfferedExtensions), extension.LoadExtensionsIntoMap(&extensions))
+	}
+}
@@ -0,0 +1,219 @@
+package controller
+
+import (
+	"context"
+	"github.com/brave/go-update/extension"
+	"github.com/getsentry/raven-go"
+	"github.com/go-chi/chi"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Tenant is an independent extension catalog, served on /t/{name}/extensions or on its own hostnames.
+// Requests for a tenant only see its catalog and use its fallback URLs, and its admin API takes its own tokens.
+type Tenant struct {
+	Name string
+	// Hosts are hostnames whose requests are served from this tenant's catalog
+	Hosts []string
+	// Store is where the tenant's catalog is loaded from and uploads are saved to
+	Store Store
+	// WebStoreFallbackURL and ComponentUpdaterFallbackURL replace those of the settings serving the tenant when set
+	WebStoreFallbackURL         string
+	ComponentUpdaterFallbackURL string
+
+	extensions catalogHolder
+}
+
+// tenants are the registered tenants by name, and tenantHosts by hostname
+var tenants = map[string]*Tenant{}
+var tenantHosts = map[string]*Tenant{}
+
+type tenantContextKey struct{}
+
+// RegisterTenants makes tenants available and starts refreshing their catalogs.
+// It must be called before the server starts handling requests.
+func RegisterTenants(registered ...*Tenant) {
+	for _, tenant := range registered {
+		tenant.extensions.tenant = tenant.Name
+		tenants[tenant.Name] = tenant
+		for _, host := range tenant.Hosts {
+			tenantHosts[strings.ToLower(host)] = tenant
+		}
+		servingCatalog(&tenant.extensions)
+		RefreshExtensionsTicker(tenant.refresh)
+	}
+}
+
+// refresh loads the tenant's catalog from its store, keeping the current one if that fails
+func (tenant *Tenant) refresh() {
+	extensions, err := tenant.Store.LoadExtensions(context.Background())
+	if isBreakerOpen(err) {
+		log.Printf("skipped loading extensions for tenant %s, keeping the current catalog: %v\n", tenant.Name, err)
+		return
+	}
+	if err != nil && !IsValidationError(err) {
+		log.Printf("failed to load extensions for tenant %s: %v\n", tenant.Name, err)
+		raven.CaptureError(err, map[string]string{"task": "refresh", "tenant": tenant.Name})
+		return
+	}
+	extensions = quarantine(&tenant.extensions, tenant.Name, extensions)
+	catalog := extension.LoadExtensionsIntoMap(&extensions)
+	for id, ext := range catalog {
+		catalog[id] = publishScheduled(&tenant.extensions, ext)
+	}
+	tenant.extensions.replace(catalog)
+}
+
+// catalog returns the tenant's catalog. It is replaced rather than changed, so it can be read without locking.
+func (tenant *Tenant) catalog() map[string]extension.Extension {
+	return tenant.extensions.snapshot().Map()
+}
+
+// save adds ext to a copy of the tenant's catalog
+func (tenant *Tenant) save(ext extension.Extension) {
+	tenant.extensions.update(func(catalog map[string]extension.Extension) {
+		catalog[ext.ID] = ext
+	})
+}
+
+// contextTenant returns the tenant a request or admin call is for, or nil for the default catalog
+func contextTenant(ctx context.Context) *Tenant {
+	tenant, _ := ctx.Value(tenantContextKey{}).(*Tenant)
+	return tenant
+}
+
+// requestTenant returns the tenant a request is for, or nil for the default catalog
+func requestTenant(r *http.Request) *Tenant {
+	return contextTenant(r.Context())
+}
+
+// catalogFor returns the catalog a request is served from
+func catalogFor(r *http.Request) map[string]extension.Extension {
+	return snapshotFor(r.Context()).Map()
+}
+
+// holderFor returns the catalog a request or admin call is served from
+func holderFor(ctx context.Context) *catalogHolder {
+	if tenant := contextTenant(ctx); tenant != nil {
+		return &tenant.extensions
+	}
+	return optionsFor(ctx).defaultCatalog()
+}
+
+// snapshotFor returns the current snapshot of the catalog a request or admin call is served from
+func snapshotFor(ctx context.Context) *CatalogSnapshot {
+	return holderFor(ctx).snapshot()
+}
+
+// storeFor returns the store uploads for a request or admin call are saved to
+func storeFor(ctx context.Context) Store {
+	if tenant := contextTenant(ctx); tenant != nil {
+		return tenant.Store
+	}
+	return optionsFor(ctx).store()
+}
+
+// saveToCatalog adds ext to the catalog a request or admin call is served from
+func saveToCatalog(ctx context.Context, ext extension.Extension) {
+	holderFor(ctx).update(func(catalog map[string]extension.Extension) {
+		catalog[ext.ID] = ext
+	})
+}
+
+// deleteFromCatalog removes the extension with id from the catalog a request or admin call is served from
+func deleteFromCatalog(ctx context.Context, id string) {
+	holderFor(ctx).update(func(catalog map[string]extension.Extension) {
+		delete(catalog, id)
+	})
+}
+
+// fallbackURLsFor returns where requests like r for a single unknown extension are redirected by the routers
+// given opts, for GET and POST requests respectively
+func fallbackURLsFor(opts *Options, r *http.Request) (string, string) {
+	webStoreURL, componentUpdaterURL := opts.fallbackURLs()
+	if tenant := requestTenant(r); tenant != nil {
+		if len(tenant.WebStoreFallbackURL) != 0 {
+			webStoreURL = tenant.WebStoreFallbackURL
+		}
+		if len(tenant.ComponentUpdaterFallbackURL) != 0 {
+			componentUpdaterURL = tenant.ComponentUpdaterFallbackURL
+		}
+	}
+	return webStoreURL, componentUpdaterURL
+}
+
+// TenantNamed returns the registered tenant called name, or nil if there is none
+func TenantNamed(name string) *Tenant {
+	return tenants[name]
+}
+
+// TenantForHost returns the tenant serving the hostname of r, or nil for the default catalog.
+// Tenants of the Options serving r come before the registered ones.
+func TenantForHost(r *http.Request) *Tenant {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return optionsFor(r.Context()).tenantForHost(host)
+}
+
+// ResolveTenant serves each request from the catalog of the tenant resolve returns for it, or the default catalog for nil
+func ResolveTenant(resolve func(r *http.Request) *Tenant) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if tenant := resolve(r); tenant != nil {
+				r = r.WithContext(context.WithValue(r.Context(), tenantContextKey{}, tenant))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// TenantFromHost serves requests for the hostnames of a tenant from its catalog
+func TenantFromHost(next http.Handler) http.Handler {
+	return ResolveTenant(TenantForHost)(next)
+}
+
+// tenantFromPath serves requests under /t/{tenant} from the catalog of that tenant
+func tenantFromPath(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant := optionsFor(r.Context()).TenantNamed(chi.URLParam(r, "tenant"))
+		if tenant == nil {
+			http.NotFound(w, r)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tenantContextKey{}, tenant)))
+	})
+}
+
+// tenantAdminAuthorizedOnly restricts access to requests with one of the tenant's admin tokens,
+// or the global admin tokens and SSO if the tenant doesn't have its own. Viewer tokens can read every tenant.
+func tenantAdminAuthorizedOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveAuthorized(w, r, next, requestTenant(r))
+	})
+}
+
+// TenantRouter is the router for /t/{tenant} endpoints, which serve update checks
+// and a subset of the admin API for the catalog of a tenant of opts or a registered one
+func TenantRouter(opts *Options) chi.Router {
+	r := chi.NewRouter()
+	r.Use(ServeWith(opts))
+	r.Use(tenantFromPath)
+	r.Mount("/extensions", extensionsRouter(opts))
+	r.Mount("/tuf", TUFRouter(opts))
+	r.With(withAPIVersion(APIVersion1)).Mount("/api/v1/admin", tenantAdminRouter())
+	r.With(withAPIVersion(APIVersion2)).Mount("/api/v2/admin", tenantAdminRouter())
+	r.With(Deprecated("/api/", "/api/v1/")).Mount("/api/admin", tenantAdminRouter())
+	return r
+}
+
+// tenantAdminRouter is the subset of the admin API available for the catalog of a tenant
+func tenantAdminRouter() chi.Router {
+	r := chi.NewRouter()
+	r.Use(tenantAdminAuthorizedOnly)
+	routeOperations(r, tenantOperations())
+	return r
+}
@@ -0,0 +1,88 @@
+package controller_test
+
+import (
+	"bytes"
+	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/extension"
+	"github.com/brave/go-update/memstore"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTenants(t *testing.T) {
+	betaExtension := extension.Extension{
+		ID:      "aomjjhallfgjeglblehebfpbcfeobpgk",
+		SHA256:  "5c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618",
+		Title:   "beta",
+		Version: "2.0.0",
+	}
+	controller.RegisterTenants(&controller.Tenant{
+		Name:                        "beta",
+		Hosts:                       []string{"beta.example.com"},
+		Store:                       memstore.New(extension.Extensions{betaExtension}),
+		ComponentUpdaterFallbackURL: "https://beta.example.com/update2",
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	check := func(path string, host string, id string) (*http.Response, string) {
+		requestBody := `{"request":{"protocol":"4.0","apps":[{"appid":"` + id + `","version":"0.0.0","updatecheck":{}}]}}`
+		req, err := http.NewRequest(http.MethodPost, server.URL+path, bytes.NewBufferString(requestBody))
+		assert.Nil(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Host = host
+		resp, err := client.Do(req)
+		assert.Nil(t, err)
+		actual, err := ioutil.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		return resp, string(actual)
+	}
+
+	// Tenants only see their own catalog, selected by path or host
+	resp, body := check("/t/beta/extensions", "", betaExtension.ID)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, body, `"nextversion":"2.0.0"`)
+	resp, body = check("/extensions", "beta.example.com", betaExtension.ID)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, body, `"nextversion":"2.0.0"`)
+	resp, _ = check("/extensions", "", betaExtension.ID)
+	assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+	assert.Equal(t, "https://update.googleapis.com/service/update2?braveRedirect=true", resp.Header.Get("Location"))
+	resp, _ = check("/t/beta/extensions", "", "ldimlcelhnjgpjjemdjokpgeeikdinbm")
+	assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+	assert.Equal(t, "https://beta.example.com/update2?braveRedirect=true", resp.Header.Get("Location"))
+	resp, _ = check("/t/missing/extensions", "", betaExtension.ID)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// The tenant's admin tokens replace the global ones for its admin API
+	getCatalog := func(path string, token string) (int, string) {
+		req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		assert.Nil(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		actual, err := ioutil.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		return resp.StatusCode, string(actual)
+	}
+	status, body := getCatalog("/t/beta/api/admin/catalog", "test-token")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, betaExtension.ID)
+	handlerOptions.SetTenantAdminTokens("beta", []string{"beta-token"})
+	defer handlerOptions.SetTenantAdminTokens("beta", nil)
+	status, _ = getCatalog("/t/beta/api/admin/catalog", "test-token")
+	assert.Equal(t, http.StatusForbidden, status)
+	status, body = getCatalog("/t/beta/api/admin/catalog", "beta-token")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 1, strings.Count(body, `"id"`))
+	status, _ = getCatalog("/api/admin/catalog", "beta-token")
+	assert.Equal(t, http.StatusForbidden, status)
+}
@@ -0,0 +1,405 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/brave/go-update/extension"
+	"github.com/getsentry/raven-go"
+	"github.com/go-chi/chi"
+	"golang.org/x/crypto/ed25519"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// transparencyMaxEntries is the most entries returned by one request for /transparency/entries
+const transparencyMaxEntries = 1000
+
+// TransparencyEntry is a version of an extension which has been served, logged when it was first served
+type TransparencyEntry struct {
+	ID      string    `json:"id"`
+	Version string    `json:"version"`
+	SHA256  string    `json:"sha256"`
+	Logged  time.Time `json:"logged"`
+}
+
+// The transparency log is a Merkle tree as in RFC 6962, whose leaves are the JSON encoded entries in the order they were logged.
+// It is only ever appended to, so auditors can check every version they were served is in it and that no entry was changed or removed.
+// Each Options keeps its own.
+type transparencyLog struct {
+	mutex      sync.RWMutex
+	entries    []TransparencyEntry
+	leafInputs [][]byte
+	leafHashes [][]byte
+	indexes    map[string]int
+}
+
+// TransparencyRouter is the router for /transparency endpoints, which let auditors follow the transparency log of opts
+func TransparencyRouter(opts *Options) chi.Router {
+	r := chi.NewRouter()
+	r.Use(ServeWith(opts))
+	r.Use(transparencyLogOnly)
+	r.Get("/sth", GetSignedTreeHead)
+	r.Get("/entries", GetTransparencyEntries)
+	r.Get("/proof", GetInclusionProof)
+	r.Get("/consistency", GetConsistencyProof)
+	return r
+}
+
+// transparencyLogOnly hides the transparency endpoints unless the log is persisted to the TransparencyLogFile of the options
+func transparencyLogOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !optionsFor(r.Context()).keepsTransparencyLog() {
+			http.NotFound(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// keepsTransparencyLog returns whether opts log the versions they serve
+func (opts *Options) keepsTransparencyLog() bool {
+	return opts != nil && len(opts.TransparencyLogFile) != 0
+}
+
+// LoadTransparencyLog replaces the transparency log of opts with the one in its TransparencyLogFile, if it exists
+func (opts *Options) LoadTransparencyLog() error {
+	transparency := &opts.transparency
+	transparency.mutex.Lock()
+	defer transparency.mutex.Unlock()
+	transparency.entries = nil
+	transparency.leafInputs = nil
+	transparency.leafHashes = nil
+	transparency.indexes = map[string]int{}
+	if len(opts.TransparencyLogFile) == 0 {
+		return nil
+	}
+	file, err := os.Open(opts.TransparencyLogFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		entry := TransparencyEntry{}
+		err = json.Unmarshal(line, &entry)
+		if err != nil {
+			return fmt.Errorf("%s: entry %d: %v", opts.TransparencyLogFile, len(transparency.entries), err)
+		}
+		// The leaf is hashed as it was written, so reading the log can't change the tree
+		transparency.add(entry, append([]byte{}, line...))
+	}
+	return scanner.Err()
+}
+
+func transparencyKey(id, version, sha256 string) string {
+	return id + "\x00" + version + "\x00" + sha256
+}
+
+// add appends entry to the log in memory, and must be called with the mutex of the log held
+func (transparency *transparencyLog) add(entry TransparencyEntry, leafInput []byte) {
+	if transparency.indexes == nil {
+		transparency.indexes = map[string]int{}
+	}
+	transparency.indexes[transparencyKey(entry.ID, entry.Version, entry.SHA256)] = len(transparency.entries)
+	transparency.entries = append(transparency.entries, entry)
+	transparency.leafInputs = append(transparency.leafInputs, leafInput)
+	transparency.leafHashes = append(transparency.leafHashes, merkleLeafHash(leafInput))
+}
+
+// index returns the index of the entry with key, and whether it was logged
+func (transparency *transparencyLog) index(key string) (int, bool) {
+	transparency.mutex.RLock()
+	defer transparency.mutex.RUnlock()
+	index, ok := transparency.indexes[key]
+	return index, ok
+}
+
+// logServed appends the versions in extensions which haven't been served with opts before to their transparency log,
+// if they keep one. A version which can't be written to the TransparencyLogFile isn't logged, so it is tried again
+// the next time it is served.
+func (opts *Options) logServed(extensions []extension.Extension) {
+	if !opts.keepsTransparencyLog() {
+		return
+	}
+	for _, ext := range extensions {
+		if len(ext.SHA256) == 0 {
+			continue
+		}
+		key := transparencyKey(ext.ID, ext.Version, ext.SHA256)
+		if _, ok := opts.transparency.index(key); ok {
+			continue
+		}
+		err := opts.appendTransparencyEntry(key, TransparencyEntry{
+			ID:      ext.ID,
+			Version: ext.Version,
+			SHA256:  ext.SHA256,
+			Logged:  time.Now().UTC().Truncate(time.Second),
+		})
+		if err != nil {
+			log.Printf("error appending %s %s to the transparency log: %v\n", ext.ID, ext.Version, err)
+			raven.CaptureError(err, map[string]string{"task": "transparency"})
+		}
+	}
+}
+
+func (opts *Options) appendTransparencyEntry(key string, entry TransparencyEntry) error {
+	transparency := &opts.transparency
+	transparency.mutex.Lock()
+	defer transparency.mutex.Unlock()
+	if _, ok := transparency.indexes[key]; ok {
+		return nil
+	}
+	leafInput, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(opts.TransparencyLogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(leafInput, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	transparency.add(entry, leafInput)
+	return nil
+}
+
+// merkleLeafHash and merkleNodeHash are the hashes of RFC 6962, which differ so a leaf can't pass for a node
+func merkleLeafHash(leafInput []byte) []byte {
+	sum := sha256.Sum256(append([]byte{0}, leafInput...))
+	return sum[:]
+}
+
+func merkleNodeHash(left, right []byte) []byte {
+	sum := sha256.Sum256(append(append([]byte{1}, left...), right...))
+	return sum[:]
+}
+
+// merkleSplit returns the largest power of two smaller than n, which is where a tree of n > 1 leaves is split
+func merkleSplit(n int) int {
+	k := 1
+	for k*2 < n {
+		k *= 2
+	}
+	return k
+}
+
+// merkleRoot returns the root hash of the tree with leaves
+func merkleRoot(leaves [][]byte) []byte {
+	switch len(leaves) {
+	case 0:
+		sum := sha256.Sum256(nil)
+		return sum[:]
+	case 1:
+		return leaves[0]
+	}
+	k := merkleSplit(len(leaves))
+	return merkleNodeHash(merkleRoot(leaves[:k]), merkleRoot(leaves[k:]))
+}
+
+// merkleInclusionProof returns the audit path of the leaf at index in the tree with leaves
+func merkleInclusionProof(index int, leaves [][]byte) [][]byte {
+	if len(leaves) <= 1 {
+		return [][]byte{}
+	}
+	k := merkleSplit(len(leaves))
+	if index < k {
+		return append(merkleInclusionProof(index, leaves[:k]), merkleRoot(leaves[k:]))
+	}
+	return append(merkleInclusionProof(index-k, leaves[k:]), merkleRoot(leaves[:k]))
+}
+
+// merkleConsistencyProof returns the proof that the tree of the first m leaves is a prefix of the tree with leaves
+func merkleConsistencyProof(m int, leaves [][]byte) [][]byte {
+	return merkleSubproof(m, leaves, true)
+}
+
+func merkleSubproof(m int, leaves [][]byte, complete bool) [][]byte {
+	if m == len(leaves) {
+		if complete {
+			return [][]byte{}
+		}
+		return [][]byte{merkleRoot(leaves)}
+	}
+	k := merkleSplit(len(leaves))
+	if m <= k {
+		return append(merkleSubproof(m, leaves[:k], complete), merkleRoot(leaves[k:]))
+	}
+	return append(merkleSubproof(m-k, leaves[k:], false), merkleRoot(leaves[:k]))
+}
+
+func encodeHashes(hashes [][]byte) []string {
+	encoded := []string{}
+	for _, hash := range hashes {
+		encoded = append(encoded, base64.StdEncoding.EncodeToString(hash))
+	}
+	return encoded
+}
+
+// leaves returns the leaf hashes of the log as it is now, which are never changed once appended
+func (transparency *transparencyLog) leaves() [][]byte {
+	transparency.mutex.RLock()
+	defer transparency.mutex.RUnlock()
+	return transparency.leafHashes[:len(transparency.leafHashes):len(transparency.leafHashes)]
+}
+
+// treeSizeParam parses the tree size in the query parameter name, defaulting to the size of the log
+func treeSizeParam(r *http.Request, name string, leaves [][]byte) (int, error) {
+	value := r.URL.Query().Get(name)
+	if len(value) == 0 {
+		return len(leaves), nil
+	}
+	size, err := strconv.Atoi(value)
+	if err != nil || size < 0 || size > len(leaves) {
+		return 0, fmt.Errorf("%s must be a tree size from 0 to %d", name, len(leaves))
+	}
+	return size, nil
+}
+
+// GetSignedTreeHead is the handler for the size and root hash of the transparency log.
+// When responses are signed the tree head is too, with a signature of its JSON without the signature fields.
+func GetSignedTreeHead(w http.ResponseWriter, r *http.Request) {
+	type TreeHead struct {
+		TreeSize  int       `json:"treeSize"`
+		Timestamp time.Time `json:"timestamp"`
+		RootHash  string    `json:"rootHash"`
+	}
+	leaves := optionsFor(r.Context()).transparency.leaves()
+	head := TreeHead{
+		TreeSize:  len(leaves),
+		Timestamp: time.Now().UTC().Truncate(time.Second),
+		RootHash:  base64.StdEncoding.EncodeToString(merkleRoot(leaves)),
+	}
+	keys := optionsFor(r.Context()).SigningKeys()
+	if len(keys) == 0 {
+		writeJSON(w, r, http.StatusOK, head)
+		return
+	}
+	data, err := json.Marshal(head)
+	if err != nil {
+		captureRequestError(r, err)
+		http.Error(w, fmt.Sprintf("Error in marshal JSON %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, struct {
+		TreeHead
+		KeyID     string `json:"keyId"`
+		Signature string `json:"signature"`
+	}{head, keys[0].ID, base64.StdEncoding.EncodeToString(ed25519.Sign(keys[0].PrivateKey, data))})
+}
+
+// GetTransparencyEntries is the handler for the entries of the transparency log from start up to but not including end,
+// with the exact leafInput each leaf hash is computed from
+func GetTransparencyEntries(w http.ResponseWriter, r *http.Request) {
+	type Entry struct {
+		Index int `json:"index"`
+		TransparencyEntry
+		LeafInput string `json:"leafInput"`
+	}
+	transparency := &optionsFor(r.Context()).transparency
+	transparency.mutex.RLock()
+	entries := transparency.entries[:len(transparency.entries):len(transparency.entries)]
+	leafInputs := transparency.leafInputs[:len(transparency.entries):len(transparency.entries)]
+	transparency.mutex.RUnlock()
+
+	start, err := strconv.Atoi(r.URL.Query().Get("start"))
+	if err != nil || start < 0 || start > len(entries) {
+		http.Error(w, fmt.Sprintf("start must be an index from 0 to %d", len(entries)), http.StatusBadRequest)
+		return
+	}
+	end := len(entries)
+	if value := r.URL.Query().Get("end"); len(value) != 0 {
+		end, err = strconv.Atoi(value)
+		if err != nil || end < start {
+			http.Error(w, "end must be an index after start", http.StatusBadRequest)
+			return
+		}
+	}
+	if end > len(entries) {
+		end = len(entries)
+	}
+	if end-start > transparencyMaxEntries {
+		end = start + transparencyMaxEntries
+	}
+	list := []Entry{}
+	for i := start; i < end; i++ {
+		list = append(list, Entry{i, entries[i], base64.StdEncoding.EncodeToString(leafInputs[i])})
+	}
+	writeJSON(w, r, http.StatusOK, map[string]interface{}{"entries": list})
+}
+
+// GetInclusionProof is the handler for the audit path of an entry in the tree of treeSize entries, the whole log by default.
+// The entry is given by its index, or by its id, version and sha256.
+func GetInclusionProof(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	leaves := optionsFor(r.Context()).transparency.leaves()
+	treeSize, err := treeSizeParam(r, "treeSize", leaves)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	index := -1
+	if value := query.Get("index"); len(value) != 0 {
+		index, err = strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error parsing index: %v", err), http.StatusBadRequest)
+			return
+		}
+	} else {
+		found, ok := optionsFor(r.Context()).transparency.index(transparencyKey(query.Get("id"), query.Get("version"), query.Get("sha256")))
+		if !ok {
+			http.Error(w, "The version was never served", http.StatusNotFound)
+			return
+		}
+		index = found
+	}
+	if index < 0 || index >= treeSize {
+		http.Error(w, fmt.Sprintf("Entry %d isn't in a tree of size %d", index, treeSize), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, map[string]interface{}{
+		"leafIndex": index,
+		"treeSize":  treeSize,
+		"auditPath": encodeHashes(merkleInclusionProof(index, leaves[:treeSize])),
+	})
+}
+
+// GetConsistencyProof is the handler for the proof that the tree of first entries is a prefix of the tree of second entries,
+// which is the whole log by default
+func GetConsistencyProof(w http.ResponseWriter, r *http.Request) {
+	leaves := optionsFor(r.Context()).transparency.leaves()
+	second, err := treeSizeParam(r, "second", leaves)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	first, err := strconv.Atoi(r.URL.Query().Get("first"))
+	if err != nil || first < 1 || first > second {
+		http.Error(w, fmt.Sprintf("first must be a tree size from 1 to %d", second), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, map[string]interface{}{
+		"first":       first,
+		"second":      second,
+		"consistency": encodeHashes(merkleConsistencyProof(first, leaves[:second])),
+	})
+}
@@ -0,0 +1,135 @@
+package controller_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/extension/extensiontest"
+	"github.com/brave/go-update/memstore"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTransparencyLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-update-transparency")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	opts := &controller.Options{
+		Store:               controller.NewValidatingStore(memstore.New(nil)),
+		Clock:               testClock,
+		TransparencyLogFile: filepath.Join(dir, "transparency.log"),
+	}
+	assert.Nil(t, opts.LoadTransparencyLog())
+	opts.SetCatalog(handlerOptions.CurrentCatalog().Map())
+	server := httptest.NewServer(newTestHandler(opts))
+	defer server.Close()
+	getJSON := func(path string, value interface{}) {
+		resp, err := http.Get(server.URL + path)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, path)
+		assert.Nil(t, json.NewDecoder(resp.Body).Decode(value))
+	}
+	type treeHead struct {
+		TreeSize int    `json:"treeSize"`
+		RootHash string `json:"rootHash"`
+	}
+
+	// Versions are logged the first time they are served
+	for _, id := range []string{"ldimlcelhnjgpjjemdjokpgeeikdinbm", "bfdgpgibhagkpdlnjonhkabjoijopoge", "ldimlcelhnjgpjjemdjokpgeeikdinbm"} {
+		requestBody := extensiontest.ExtensionRequestFnFor(id)("0.0.0")
+		resp, err := http.Post(server.URL+"/extensions", "application/xml", bytes.NewBufferString(requestBody))
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	var head treeHead
+	getJSON("/transparency/sth", &head)
+	assert.Equal(t, 2, head.TreeSize)
+
+	entries := struct {
+		Entries []struct {
+			Index     int    `json:"index"`
+			ID        string `json:"id"`
+			Version   string `json:"version"`
+			SHA256    string `json:"sha256"`
+			LeafInput string `json:"leafInput"`
+		} `json:"entries"`
+	}{}
+	getJSON("/transparency/entries?start=0", &entries)
+	assert.Equal(t, 2, len(entries.Entries))
+	assert.Equal(t, "ldimlcelhnjgpjjemdjokpgeeikdinbm", entries.Entries[0].ID)
+	assert.Equal(t, "1.0.0", entries.Entries[0].Version)
+	leafHashes := [][]byte{}
+	for _, entry := range entries.Entries {
+		leafInput, err := base64.StdEncoding.DecodeString(entry.LeafInput)
+		assert.Nil(t, err)
+		sum := sha256.Sum256(append([]byte{0}, leafInput...))
+		leafHashes = append(leafHashes, sum[:])
+	}
+
+	// The audit path of the first entry leads to the root hash
+	proof := struct {
+		LeafIndex int      `json:"leafIndex"`
+		AuditPath []string `json:"auditPath"`
+	}{}
+	getJSON(fmt.Sprintf("/transparency/proof?id=%s&version=%s&sha256=%s", entries.Entries[0].ID, entries.Entries[0].Version, entries.Entries[0].SHA256), &proof)
+	assert.Equal(t, 0, proof.LeafIndex)
+	assert.Equal(t, []string{base64.StdEncoding.EncodeToString(leafHashes[1])}, proof.AuditPath)
+	root := sha256.Sum256(append(append([]byte{1}, leafHashes[0]...), leafHashes[1]...))
+	assert.Equal(t, base64.StdEncoding.EncodeToString(root[:]), head.RootHash)
+
+	// The tree of the first entry is a prefix of the whole log
+	consistency := struct {
+		Consistency []string `json:"consistency"`
+	}{}
+	getJSON("/transparency/consistency?first=1", &consistency)
+	assert.Equal(t, []string{base64.StdEncoding.EncodeToString(leafHashes[1])}, consistency.Consistency)
+
+	// Versions never served aren't in the log
+	resp, err := http.Get(server.URL + "/transparency/proof?id=ldimlcelhnjgpjjemdjokpgeeikdinbm&version=9.9.9&sha256=00")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp, err = http.Get(server.URL + "/transparency/consistency?first=3")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// The same tree is loaded back from the file
+	assert.Nil(t, opts.LoadTransparencyLog())
+	var reloaded treeHead
+	getJSON("/transparency/sth", &reloaded)
+	assert.Equal(t, head, reloaded)
+}
+
+func TestTransparencyLogDisabled(t *testing.T) {
+	// Without a file the log isn't kept or served, since it would shrink on restart
+	requestBody := extensiontest.ExtensionRequestFnFor("ldimlcelhnjgpjjemdjokpgeeikdinbm")("0.0.0")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/extensions", strings.NewReader(requestBody)))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	for _, path := range []string{"/transparency/sth", "/transparency/entries", "/transparency/proof?index=0"} {
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusNotFound, rr.Code, path)
+	}
+
+	// and nothing served meanwhile was kept in memory
+	dir, err := ioutil.TempDir("", "go-update-transparency")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	handlerOptions.TransparencyLogFile = filepath.Join(dir, "transparency.log")
+	defer func() {
+		handlerOptions.TransparencyLogFile = ""
+	}()
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/transparency/sth", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"treeSize":0`)
+}
@@ -0,0 +1,37 @@
+package controller
+
+import (
+	"github.com/pressly/lg"
+	"github.com/prometheus/client_golang/prometheus"
+	"net/http"
+	"net/url"
+)
+
+var truncatedResponses = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "update_check_truncated_total",
+	Help: "Number of update check responses which left out apps over the limit, by protocol.",
+}, []string{"protocol"})
+
+func init() {
+	prometheus.MustRegister(truncatedResponses)
+}
+
+// maxAppsPerResponse returns the MaxAppsPerResponse of the settings serving r
+func maxAppsPerResponse(r *http.Request) int {
+	return optionsFor(r.Context()).settings().MaxAppsPerResponse
+}
+
+// recordTruncated notes that the response to r only answers max of requested apps
+func recordTruncated(r *http.Request, protocol string, max int, requested int) {
+	lg.Log(r.Context()).Warnf("Answering %d of %d apps in the %s update check", max, requested, protocol)
+	truncatedResponses.WithLabelValues(protocol).Inc()
+}
+
+// nextPage links the response to the GET update check r to the same check for the remaining x parameters,
+// so clients can request the apps which were left out
+func nextPage(w http.ResponseWriter, r *http.Request, remaining []string) {
+	query := r.URL.Query()
+	query["x"] = remaining
+	next := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+	w.Header().Set("Link", "<"+next.String()+`>; rel="next"`)
+}
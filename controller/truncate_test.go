@@ -0,0 +1,60 @@
+package controller_test
+
+import (
+	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/extension"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestMaxAppsPerResponse(t *testing.T) {
+	handlerOptions.UpdateSettings(func(settings *controller.Settings) {
+		settings.MaxAppsPerResponse = 2
+	})
+	defer handlerOptions.UpdateSettings(func(settings *controller.Settings) {
+		settings.MaxAppsPerResponse = 0
+	})
+	ids := []string{extension.OfferedExtensions[0].ID, extension.OfferedExtensions[1].ID, extension.OfferedExtensions[2].ID}
+
+	// POST checks leave out the apps over the limit
+	requestBody := `<?xml version="1.0" encoding="UTF-8"?><request protocol="3.0">`
+	for _, id := range ids {
+		requestBody += `<app appid="` + id + `" version="0.0.0"><updatecheck/></app>`
+	}
+	requestBody += `</request>`
+	req := httptest.NewRequest(http.MethodPost, "/extensions", strings.NewReader(requestBody))
+	req.Header.Set("Content-Type", "application/xml")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, 2, strings.Count(rr.Body.String(), "<app "))
+	assert.NotContains(t, rr.Body.String(), ids[2])
+
+	// GET checks link to a request for the rest
+	query := url.Values{"prodversion": {"70.0"}}
+	for _, id := range ids {
+		query.Add("x", "id="+id+"&v=0.0.0")
+	}
+	req = httptest.NewRequest(http.MethodGet, "/extensions?"+query.Encode(), nil)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, 2, strings.Count(rr.Body.String(), "<app "))
+	link := rr.Header().Get("Link")
+	assert.True(t, strings.HasPrefix(link, "</extensions?") && strings.HasSuffix(link, `>; rel="next"`), link)
+
+	next, err := url.Parse(strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`))
+	assert.Nil(t, err)
+	assert.Equal(t, "70.0", next.Query().Get("prodversion"))
+	req = httptest.NewRequest(http.MethodGet, next.String(), nil)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, 1, strings.Count(rr.Body.String(), "<app "))
+	assert.Contains(t, rr.Body.String(), ids[2])
+	assert.Equal(t, "", rr.Header().Get("Link"))
+}
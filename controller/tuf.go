@@ -0,0 +1,282 @@
+package controller
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/brave/go-update/extension"
+	"github.com/go-chi/chi"
+	"golang.org/x/crypto/ed25519"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// TUFSpecVersion is the version of The Update Framework specification the metadata follows
+const TUFSpecVersion = "1.0.31"
+
+// How long TUF metadata is valid for, and how often it is signed again even if it hasn't changed
+const (
+	tufRootExpiry      = 365 * 24 * time.Hour
+	tufTargetsExpiry   = 7 * 24 * time.Hour
+	tufTargetsResign   = 24 * time.Hour
+	tufTimestampExpiry = 24 * time.Hour
+	tufTimestampResign = time.Minute
+)
+
+// tufMetadata is the signed TUF metadata of one catalog
+type tufMetadata struct {
+	catalogHash [sha256.Size]byte
+	keyID       string
+	targets     []byte
+	snapshot    []byte
+	timestamp   []byte
+	signed      time.Time
+	stamped     time.Time
+}
+
+// TUFRouter is the router for /tuf endpoints, which publish the catalog as The Update Framework metadata
+// signed with the active response signing key, so it can be verified independently of TLS.
+func TUFRouter(opts *Options) chi.Router {
+	r := chi.NewRouter()
+	r.Use(ServeWith(opts))
+	r.Get("/root.json", GetTUFMetadata("root"))
+	r.Get("/targets.json", GetTUFMetadata("targets"))
+	r.Get("/snapshot.json", GetTUFMetadata("snapshot"))
+	r.Get("/timestamp.json", GetTUFMetadata("timestamp"))
+	return r
+}
+
+// GetTUFMetadata returns the handler for the TUF metadata of role, which is 404 when responses aren't signed
+func GetTUFMetadata(role string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keys := optionsFor(r.Context()).SigningKeys()
+		if len(keys) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+		var data []byte
+		var err error
+		if role == "root" {
+			opts := optionsFor(r.Context())
+			var root map[string]interface{}
+			root, err = tufRoot(keys, opts.settings().TUFRootVersion, opts.clock().Now())
+			if err == nil {
+				data, err = signTUFMetadata(root, keys[0])
+			}
+		} else {
+			data, err = getTUFMetadata(r, keys[0], role)
+		}
+		if err != nil {
+			captureRequestError(r, err)
+			http.Error(w, fmt.Sprintf("Error signing TUF metadata %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("content-type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(data)
+	}
+}
+
+// getTUFMetadata returns the signed targets, snapshot or timestamp metadata of the catalog a request is served from.
+// Targets and snapshot get a new version when the catalog or signing key changes, or before they expire,
+// and the timestamp is signed again every minute so clients can tell the metadata is fresh.
+func getTUFMetadata(r *http.Request, key SigningKey, role string) ([]byte, error) {
+	catalog := holderFor(r.Context())
+	targets := tufTargets(catalog.snapshot().Map())
+	encodedTargets, err := canonicalJSON(targets)
+	if err != nil {
+		return nil, err
+	}
+	catalogHash := sha256.Sum256(encodedTargets)
+	keyID, err := tufKeyID(key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	now := optionsFor(r.Context()).clock().Now().UTC()
+
+	catalog.tufMutex.Lock()
+	defer catalog.tufMutex.Unlock()
+	metadata := catalog.tuf
+	ok := metadata != nil
+	if !ok || metadata.catalogHash != catalogHash || metadata.keyID != keyID || now.Sub(metadata.signed) > tufTargetsResign {
+		// Versions are the time they were signed, so they keep increasing across restarts
+		version := now.Unix()
+		if ok && version <= tufVersion(metadata.signed) {
+			version = tufVersion(metadata.signed) + 1
+		}
+		signedTargets, err := signTUFMetadata(map[string]interface{}{
+			"_type":        "targets",
+			"spec_version": TUFSpecVersion,
+			"version":      version,
+			"expires":      tufExpires(now, tufTargetsExpiry),
+			"targets":      targets,
+		}, key)
+		if err != nil {
+			return nil, err
+		}
+		signedSnapshot, err := signTUFMetadata(map[string]interface{}{
+			"_type":        "snapshot",
+			"spec_version": TUFSpecVersion,
+			"version":      version,
+			"expires":      tufExpires(now, tufTargetsExpiry),
+			"meta":         map[string]interface{}{"targets.json": tufFileMeta(signedTargets, version)},
+		}, key)
+		if err != nil {
+			return nil, err
+		}
+		metadata = &tufMetadata{
+			catalogHash: catalogHash,
+			keyID:       keyID,
+			targets:     signedTargets,
+			snapshot:    signedSnapshot,
+			signed:      time.Unix(version, 0),
+		}
+		catalog.tuf = metadata
+	}
+	if metadata.timestamp == nil || now.Sub(metadata.stamped) > tufTimestampResign {
+		version := now.Unix()
+		if version <= tufVersion(metadata.stamped) {
+			version = tufVersion(metadata.stamped) + 1
+		}
+		timestamp, err := signTUFMetadata(map[string]interface{}{
+			"_type":        "timestamp",
+			"spec_version": TUFSpecVersion,
+			"version":      version,
+			"expires":      tufExpires(now, tufTimestampExpiry),
+			"meta":         map[string]interface{}{"snapshot.json": tufFileMeta(metadata.snapshot, tufVersion(metadata.signed))},
+		}, key)
+		if err != nil {
+			return nil, err
+		}
+		metadata.timestamp = timestamp
+		metadata.stamped = time.Unix(version, 0)
+	}
+	switch role {
+	case "targets":
+		return metadata.targets, nil
+	case "snapshot":
+		return metadata.snapshot, nil
+	default:
+		return metadata.timestamp, nil
+	}
+}
+
+// tufRoot returns the root metadata trusting every published key for every role
+func tufRoot(keys []SigningKey, version int, now time.Time) (map[string]interface{}, error) {
+	tufKeys := map[string]interface{}{}
+	keyIDs := []string{}
+	for _, key := range keys {
+		if key.Status == SigningKeyRetired {
+			continue
+		}
+		keyID, err := tufKeyID(key.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		tufKeys[keyID] = tufKey(key.PublicKey)
+		keyIDs = append(keyIDs, keyID)
+	}
+	sort.Strings(keyIDs)
+	roles := map[string]interface{}{}
+	for _, role := range []string{"root", "targets", "snapshot", "timestamp"} {
+		roles[role] = map[string]interface{}{"keyids": keyIDs, "threshold": 1}
+	}
+	return map[string]interface{}{
+		"_type":               "root",
+		"spec_version":        TUFSpecVersion,
+		"version":             version,
+		"expires":             tufExpires(now, tufRootExpiry),
+		"consistent_snapshot": false,
+		"keys":                tufKeys,
+		"roles":               roles,
+	}, nil
+}
+
+// tufTargets returns the TUF targets of a catalog, which are the package of the current version of each extension
+func tufTargets(catalog map[string]extension.Extension) map[string]interface{} {
+	targets := map[string]interface{}{}
+	for _, ext := range catalog {
+		if ext.Blacklisted || len(ext.SHA256) == 0 {
+			continue
+		}
+		targets[ext.ID+"/"+extension.GetPackageName(ext)] = map[string]interface{}{
+			"length": ext.Size,
+			"hashes": map[string]interface{}{"sha256": ext.SHA256},
+			"custom": map[string]interface{}{"id": ext.ID, "version": ext.Version},
+		}
+	}
+	return targets
+}
+
+func tufKey(public ed25519.PublicKey) map[string]interface{} {
+	return map[string]interface{}{
+		"keytype": "ed25519",
+		"scheme":  "ed25519",
+		"keyval":  map[string]interface{}{"public": hex.EncodeToString(public)},
+	}
+}
+
+// tufKeyID is the SHA-256 of the canonical JSON of a key, as TUF defines it
+func tufKeyID(public ed25519.PublicKey) (string, error) {
+	data, err := canonicalJSON(tufKey(public))
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func tufFileMeta(data []byte, version int64) map[string]interface{} {
+	sum := sha256.Sum256(data)
+	return map[string]interface{}{
+		"version": version,
+		"length":  len(data),
+		"hashes":  map[string]interface{}{"sha256": hex.EncodeToString(sum[:])},
+	}
+}
+
+func tufExpires(now time.Time, expiry time.Duration) string {
+	return now.Add(expiry).UTC().Format(time.RFC3339)
+}
+
+func tufVersion(signed time.Time) int64 {
+	if signed.IsZero() {
+		return 0
+	}
+	return signed.Unix()
+}
+
+// signTUFMetadata wraps signed with a signature of its canonical JSON made with key
+func signTUFMetadata(signed map[string]interface{}, key SigningKey) ([]byte, error) {
+	data, err := canonicalJSON(signed)
+	if err != nil {
+		return nil, err
+	}
+	keyID, err := tufKeyID(key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(map[string]interface{}{
+		"signed": json.RawMessage(data),
+		"signatures": []map[string]string{{
+			"keyid": keyID,
+			"sig":   hex.EncodeToString(ed25519.Sign(key.PrivateKey, data)),
+		}},
+	})
+}
+
+// canonicalJSON encodes maps of strings, integers, lists and maps with sorted keys and no whitespace,
+// which is all TUF metadata needs of canonical JSON
+func canonicalJSON(value interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	err := encoder.Encode(value)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buffer.Bytes(), []byte("\n")), nil
+}
@@ -0,0 +1,88 @@
+package controller_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/brave/go-update/controller"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ed25519"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTUF(t *testing.T) {
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	// Without signing keys there is no metadata
+	resp, err := http.Get(server.URL + "/tuf/root.json")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	key, err := controller.ParseSigningKeys(fmt.Sprintf(`[{"id": "2024-01", "status": "active", "privateKey": "%s"}]`,
+		base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, ed25519.SeedSize))))
+	assert.Nil(t, err)
+	handlerOptions.UpdateSettings(func(settings *controller.Settings) {
+		settings.SigningKeys = key
+	})
+	defer handlerOptions.UpdateSettings(func(settings *controller.Settings) {
+		settings.SigningKeys = nil
+	})
+
+	type metadata struct {
+		Signed     json.RawMessage `json:"signed"`
+		Signatures []struct {
+			KeyID string `json:"keyid"`
+			Sig   string `json:"sig"`
+		} `json:"signatures"`
+	}
+	get := func(role string) (metadata, map[string]interface{}) {
+		resp, err := http.Get(server.URL + "/tuf/" + role + ".json")
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var document metadata
+		assert.Nil(t, json.NewDecoder(resp.Body).Decode(&document))
+		signed := map[string]interface{}{}
+		assert.Nil(t, json.Unmarshal(document.Signed, &signed))
+		assert.Equal(t, role, signed["_type"])
+		return document, signed
+	}
+
+	// Every role is signed by the key in root
+	root, signed := get("root")
+	assert.Equal(t, float64(1), signed["version"])
+	// Metadata expires by the clock of the server
+	assert.Equal(t, testClock.Now().Add(365*24*time.Hour).UTC().Format(time.RFC3339), signed["expires"])
+	keys := signed["keys"].(map[string]interface{})
+	assert.Equal(t, 1, len(keys))
+	public, err := hex.DecodeString(keys[root.Signatures[0].KeyID].(map[string]interface{})["keyval"].(map[string]interface{})["public"].(string))
+	assert.Nil(t, err)
+	for _, role := range []string{"root", "targets", "snapshot", "timestamp"} {
+		document, _ := get(role)
+		assert.Equal(t, root.Signatures[0].KeyID, document.Signatures[0].KeyID)
+		sig, err := hex.DecodeString(document.Signatures[0].Sig)
+		assert.Nil(t, err)
+		assert.True(t, ed25519.Verify(public, document.Signed, sig), role)
+	}
+
+	// Targets are the CRXs of the catalog
+	_, signed = get("targets")
+	targets := signed["targets"].(map[string]interface{})
+	target, ok := targets["ldimlcelhnjgpjjemdjokpgeeikdinbm/extension_1_0_0.crx"].(map[string]interface{})
+	assert.True(t, ok)
+	assert.Equal(t, "ldimlcelhnjgpjjemdjokpgeeikdinbm", target["custom"].(map[string]interface{})["id"])
+
+	// Snapshot pins the targets and timestamp pins the snapshot
+	targetsDocument, _ := get("targets")
+	targetsJSON, err := json.Marshal(targetsDocument)
+	assert.Nil(t, err)
+	_, snapshot := get("snapshot")
+	assert.Equal(t, float64(len(targetsJSON)), snapshot["meta"].(map[string]interface{})["targets.json"].(map[string]interface{})["length"])
+	_, timestamp := get("timestamp")
+	assert.NotNil(t, timestamp["meta"].(map[string]interface{})["snapshot.json"])
+}
@@ -0,0 +1,241 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"github.com/brave/go-update/extension"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// sha256Regexp matches hex encoded SHA256 hashes, as browsers compare them with the packages they download
+var sha256Regexp = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// appIDRegexp matches the IDs of Omaha apps, like GUIDs in braces or bundle IDs, which include extension IDs.
+// They are part of the keys packages are published at, so they can't start with a dot.
+var appIDRegexp = regexp.MustCompile(`^[A-Za-z0-9{}_-][A-Za-z0-9{}._-]{0,127}$`)
+
+// packageNameRegexp matches the file names of app packages, which may have placeholders for the version
+var packageNameRegexp = regexp.MustCompile(`^[A-Za-z0-9{}_-][A-Za-z0-9{}._-]*$`)
+
+// ValidateExtension returns the problems with a catalog record which would stop browsers from updating
+// the extension, like an invalid ID, version or SHA256. Its scheduled version is checked too.
+func ValidateExtension(ext extension.Extension) []string {
+	problems := []string{}
+	switch {
+	case ext.IsApp():
+		if !appIDRegexp.MatchString(ext.ID) {
+			problems = append(problems, fmt.Sprintf("%q is not an app ID, which is up to 128 letters, digits, braces, dots, dashes or underscores", ext.ID))
+		}
+		if len(ext.PackageName) != 0 && !packageNameRegexp.MatchString(ext.PackageName) {
+			problems = append(problems, fmt.Sprintf("%s: package name %q is not a file name", ext.ID, ext.PackageName))
+		}
+	case len(ext.Type) != 0 && ext.Type != extension.TypeExtension:
+		problems = append(problems, fmt.Sprintf("%s: type %q is not %s or %s", ext.ID, ext.Type, extension.TypeExtension, extension.TypeApp))
+	default:
+		if !extensionIDRegexp.MatchString(ext.ID) {
+			problems = append(problems, fmt.Sprintf("%q is not an extension ID, which is 32 letters from a to p", ext.ID))
+		}
+		// Chrome only installs CRXs
+		if len(ext.PackageName) != 0 {
+			problems = append(problems, fmt.Sprintf("%s: only apps can have a package name", ext.ID))
+		}
+	}
+	problems = append(problems, validateVersion(ext)...)
+	for _, dependency := range ext.Dependencies {
+		if !appIDRegexp.MatchString(dependency) {
+			problems = append(problems, fmt.Sprintf("%s: dependency %q is not an extension or app ID", ext.ID, dependency))
+		} else if dependency == ext.ID {
+			problems = append(problems, fmt.Sprintf("%s: depends on itself", ext.ID))
+		}
+	}
+	if scheduled := ext.Scheduled; scheduled != nil {
+		if scheduled.ID != ext.ID {
+			problems = append(problems, fmt.Sprintf("%s: scheduled version is for %s", ext.ID, scheduled.ID))
+		}
+		if scheduled.PublishAt == nil {
+			problems = append(problems, fmt.Sprintf("%s: scheduled version %s has no publishAt", ext.ID, scheduled.Version))
+		}
+		if extension.CompareVersions(scheduled.Version, ext.Version) <= 0 {
+			problems = append(problems, fmt.Sprintf("%s: scheduled version %s is not newer than %s", ext.ID, scheduled.Version, ext.Version))
+		}
+		problems = append(problems, validateVersion(*scheduled)...)
+	}
+	problems = append(problems, validateActions(ext.ID, ext.Actions)...)
+	problems = append(problems, validateRules(ext.ID, ext.Rules)...)
+	problems = append(problems, validateLocales(ext.ID, ext.Locales)...)
+	problems = append(problems, validateMemoryRequirement(ext.ID, MemoryRequirement{MinPhysMemory: ext.MinPhysMemory, Lite: ext.Lite})...)
+	problems = append(problems, validateInstallData(ext.ID, ext.InstallData)...)
+	return problems
+}
+
+// validateActions returns the problems with the install actions of the extension with id
+func validateActions(id string, actions []extension.Action) []string {
+	problems := []string{}
+	for i, action := range actions {
+		if err := action.Validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: action %d: %v", id, i+1, err))
+		}
+	}
+	return problems
+}
+
+// validateRules returns the problems with the targeting rules of the extension with id
+func validateRules(id string, rules []extension.Rule) []string {
+	problems := []string{}
+	for i, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: rule %d: %v", id, i+1, err))
+		}
+		if rule.Package != nil {
+			problems = append(problems, validatePackage(id, *rule.Package)...)
+		}
+	}
+	return problems
+}
+
+// validateLocales returns the problems with the locale packages of the extension with id,
+// including locales which only differ in case or separator, as clients couldn't be offered one of them
+func validateLocales(id string, locales map[string]extension.Package) []string {
+	problems := []string{}
+	seen := map[string]string{}
+	for locale, pkg := range locales {
+		if err := extension.ValidateLocale(locale); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: locale %v", id, err))
+		}
+		normalized := extension.NormalizeLocale(locale)
+		if other, ok := seen[normalized]; ok {
+			problems = append(problems, fmt.Sprintf("%s: locales %q and %q are the same", id, other, locale))
+		}
+		seen[normalized] = locale
+		problems = append(problems, validatePackage(id, pkg)...)
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// validateMemoryRequirement returns the problems with the memory requirement of the extension with id
+func validateMemoryRequirement(id string, requirement MemoryRequirement) []string {
+	problems := []string{}
+	if requirement.MinPhysMemory < 0 {
+		problems = append(problems, fmt.Sprintf("%s: minimum memory %d is negative", id, requirement.MinPhysMemory))
+	}
+	if requirement.Lite != nil {
+		if requirement.MinPhysMemory <= 0 {
+			problems = append(problems, fmt.Sprintf("%s: lite package without a minimum memory", id))
+		}
+		problems = append(problems, validatePackage(id, *requirement.Lite)...)
+	}
+	return problems
+}
+
+// validatePackage returns the problems with a package offered instead of the extension's own
+func validatePackage(id string, pkg extension.Package) []string {
+	return validateVersion(extension.Extension{
+		ID:      id,
+		Version: pkg.Version,
+		SHA256:  pkg.SHA256,
+		Size:    pkg.Size,
+		URL:     pkg.URL,
+	})
+}
+
+// validateVersion returns the problems with the fields describing the package of one version of an extension
+func validateVersion(ext extension.Extension) []string {
+	problems := []string{}
+	if !versionRegexp.MatchString(ext.Version) {
+		problems = append(problems, fmt.Sprintf("%s: %q is not a version like 1.2.3", ext.ID, ext.Version))
+	}
+	// Blacklisted extensions are never offered, so they don't need a package
+	if !ext.Blacklisted && !sha256Regexp.MatchString(ext.SHA256) {
+		problems = append(problems, fmt.Sprintf("%s %s: SHA256 %q is not 64 lowercase hex digits", ext.ID, ext.Version, ext.SHA256))
+	}
+	if len(ext.URL) != 0 {
+		if u, err := url.Parse(ext.URL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || len(u.Host) == 0 {
+			problems = append(problems, fmt.Sprintf("%s %s: URL %q is not an absolute HTTP URL", ext.ID, ext.Version, ext.URL))
+		}
+	}
+	if ext.Size < 0 {
+		problems = append(problems, fmt.Sprintf("%s %s: size %d is negative", ext.ID, ext.Version, ext.Size))
+	}
+	if len(ext.ReleaseNotes) > MaxReleaseNotesLength {
+		problems = append(problems, fmt.Sprintf("%s %s: release notes are longer than %d bytes", ext.ID, ext.Version, MaxReleaseNotesLength))
+	}
+	if !utf8.ValidString(ext.ReleaseNotes) {
+		problems = append(problems, fmt.Sprintf("%s %s: release notes are not UTF-8 text", ext.ID, ext.Version))
+	}
+	return problems
+}
+
+// ValidateCatalog returns the problems with every record of a catalog, and with IDs it lists more than once
+func ValidateCatalog(extensions extension.Extensions) []string {
+	problems := []string{}
+	seen := map[string]bool{}
+	for _, ext := range extensions {
+		if seen[ext.ID] {
+			problems = append(problems, fmt.Sprintf("%s is listed more than once", ext.ID))
+		}
+		seen[ext.ID] = true
+		problems = append(problems, ValidateExtension(ext)...)
+	}
+	return problems
+}
+
+// ValidationError is the error of a ValidatingStore for records which aren't valid,
+// as opposed to errors reading from or writing to the store itself
+type ValidationError struct {
+	Problems []string
+}
+
+func (err *ValidationError) Error() string {
+	return "invalid extension records: " + strings.Join(err.Problems, "; ")
+}
+
+// IsValidationError returns true if err means records were invalid rather than the store failing
+func IsValidationError(err error) bool {
+	_, ok := err.(*ValidationError)
+	return ok
+}
+
+// ValidatingStore checks every record read from or written to its store with ValidateExtension
+type ValidatingStore struct {
+	store Store
+}
+
+// NewValidatingStore creates a ValidatingStore around store
+func NewValidatingStore(store Store) *ValidatingStore {
+	return &ValidatingStore{store: store}
+}
+
+// LoadExtensions loads the catalog, returning a *ValidationError along with every record if some are invalid,
+// so the refresh can quarantine them and keep serving the rest
+func (store *ValidatingStore) LoadExtensions(ctx context.Context) (extension.Extensions, error) {
+	extensions, err := store.store.LoadExtensions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	problems := []string{}
+	for _, ext := range extensions {
+		problems = append(problems, ValidateExtension(ext)...)
+	}
+	if len(problems) != 0 {
+		return extensions, &ValidationError{Problems: problems}
+	}
+	return extensions, nil
+}
+
+// SaveExtension saves the extension, or returns a *ValidationError without calling the store if it is invalid
+func (store *ValidatingStore) SaveExtension(ctx context.Context, ext extension.Extension) error {
+	if problems := ValidateExtension(ext); len(problems) != 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return store.store.SaveExtension(ctx, ext)
+}
+
+// DeleteExtension deletes the extension, which leaves nothing to validate
+func (store *ValidatingStore) DeleteExtension(ctx context.Context, id string) error {
+	return store.store.DeleteExtension(ctx, id)
+}
@@ -0,0 +1,40 @@
+package controller_test
+
+import (
+	"context"
+	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/extension"
+	"github.com/brave/go-update/memstore"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestValidatingStore(t *testing.T) {
+	valid := extension.Extension{
+		ID:      "jcdhmojfecjfmbdpchihbeilohgnbdci",
+		SHA256:  "8c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618",
+		Title:   "valid",
+		Version: "1.0.0",
+	}
+	invalid := valid
+	invalid.SHA256 = "8C714FAD"
+	store := controller.NewValidatingStore(memstore.New(nil))
+	ctx := context.Background()
+
+	// Invalid records aren't saved
+	err := store.SaveExtension(ctx, invalid)
+	assert.True(t, controller.IsValidationError(err))
+	assert.Contains(t, err.Error(), "is not 64 lowercase hex digits")
+	assert.Nil(t, store.SaveExtension(ctx, valid))
+
+	// Invalid records are read with a validation error, unlike failures of the store
+	underlying := memstore.New(extension.Extensions{newExtension2, invalid})
+	extensions, err := controller.NewValidatingStore(underlying).LoadExtensions(ctx)
+	assert.True(t, controller.IsValidationError(err))
+	assert.Equal(t, 2, len(extensions))
+	var calls int64
+	_, err = controller.NewValidatingStore(failingStore{&calls}).LoadExtensions(ctx)
+	assert.NotNil(t, err)
+	assert.False(t, controller.IsValidationError(err))
+	assert.False(t, controller.IsValidationError(controller.NewValidatingStore(failingStore{&calls}).SaveExtension(ctx, valid)))
+}
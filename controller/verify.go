@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"github.com/brave/go-update/client"
+	"github.com/brave/go-update/extension"
+	"github.com/getsentry/raven-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// verifyClient downloads packages, which may be large but mustn't hang a verification run forever
+var verifyClient = &http.Client{Timeout: 5 * time.Minute}
+
+// packageVerifications holds the health keys of the versions being verified with some Options, so runs which
+// overlap don't download them twice. The mutex isn't held while downloading.
+type packageVerifications struct {
+	mutex     sync.Mutex
+	verifying map[string]bool
+}
+
+var packageVerificationFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "package_verification_failures_total",
+	Help: "Number of extension packages which failed CRX verification.",
+}, []string{"id"})
+
+func init() {
+	prometheus.MustRegister(packageVerificationFailures)
+}
+
+// verifyPackages downloads and verifies each extension version opts haven't verified yet. Like link checks,
+// it is skipped when the codebase URL depends on the client's channel or platform.
+func (opts *Options) verifyPackages(ctx context.Context, extensions extension.Extensions) {
+	if extension.CodebaseURLDependsOnClient() {
+		return
+	}
+	verifications := &opts.verifications
+	for _, ext := range extensions {
+		key := getPackageHealthKey(ext.ID, ext.Version)
+		verifications.mutex.Lock()
+		health, ok := opts.GetPackageHealth(ext.ID, ext.Version)
+		if (ok && health.Verified) || verifications.verifying[key] {
+			verifications.mutex.Unlock()
+			continue
+		}
+		if verifications.verifying == nil {
+			verifications.verifying = map[string]bool{}
+		}
+		verifications.verifying[key] = true
+		verifications.mutex.Unlock()
+
+		err := verifyPackage(ctx, ext)
+		if err != nil {
+			log.Printf("package verification failed for %s %s: %v\n", ext.ID, ext.Version, err)
+			raven.CaptureError(err, map[string]string{"id": ext.ID, "version": ext.Version})
+			packageVerificationFailures.WithLabelValues(ext.ID).Inc()
+		}
+		opts.updatePackageHealth(ext.ID, ext.Version, func(health *PackageHealth) {
+			health.Verified = err == nil
+			health.VerifyError = ""
+			if err != nil {
+				health.VerifyError = err.Error()
+			}
+			health.VerifiedAt = time.Now()
+		})
+		verifications.mutex.Lock()
+		delete(verifications.verifying, key)
+		verifications.mutex.Unlock()
+	}
+}
+
+// verifyPackage checks the CRX signature, that the declared ID matches the signing key
+// and that the SHA256 matches what we advertise in the catalog.
+func verifyPackage(ctx context.Context, ext extension.Extension) error {
+	return verifyDownload(ctx, extension.GetCodebaseURL(ext, extension.Client{}), ext)
+}
+
+// verifyDownload downloads the CRX of ext from url and checks it like verifyPackage
+func verifyDownload(ctx context.Context, url string, ext extension.Extension) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := verifyClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err := resp.Body.Close()
+		if err != nil {
+			log.Printf("error closing package stream: %v\n", err)
+		}
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download failed with status %d", resp.StatusCode)
+	}
+
+	return client.Verify(client.Update{ID: ext.ID, Version: ext.Version, SHA256: ext.SHA256}, resp.Body)
+}
@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/brave/go-update/crx"
+	"github.com/brave/go-update/crx/crxtest"
+	"github.com/brave/go-update/extension"
+	"github.com/pressly/lg"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestVerifyPackages(t *testing.T) {
+	key := crxtest.NewKey()
+	id := crx.IDFromPublicKey(crxtest.PublicKey(key))
+	signed := crxtest.BuildSignedCRX(key, []byte("PK archive"))
+	// Changing the archive after signing it breaks the signature
+	tampered := append([]byte{}, signed...)
+	tampered[len(tampered)-1] ^= 0xff
+	var mutex sync.Mutex
+	packages := map[string][]byte{"1.0.0": signed, "2.0.0": signed, "3.0.0": tampered}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		version := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"+id+"/"), ".crx")
+		mutex.Lock()
+		defer mutex.Unlock()
+		_, err := w.Write(packages[version])
+		assert.Nil(t, err)
+	}))
+	defer server.Close()
+	defer func(template string) {
+		extension.CodebaseURLTemplate = template
+	}(extension.CodebaseURLTemplate)
+	extension.CodebaseURLTemplate = server.URL + "/{id}/{version}.crx"
+
+	sha256Of := func(data []byte) string {
+		sum := sha256.Sum256(data)
+		return hex.EncodeToString(sum[:])
+	}
+	valid := extension.Extension{ID: id, Version: "1.0.0", SHA256: sha256Of(signed)}
+	wrongSHA256 := extension.Extension{ID: id, Version: "2.0.0", SHA256: sha256Of(tampered)}
+	badSignature := extension.Extension{ID: id, Version: "3.0.0", SHA256: sha256Of(tampered)}
+	before := counterValue(packageVerificationFailures.WithLabelValues(id))
+	opts := &Options{}
+	opts.verifyPackages(context.Background(), extension.Extensions{valid, wrongSHA256, badSignature})
+
+	health, ok := opts.GetPackageHealth(id, "1.0.0")
+	assert.True(t, ok)
+	assert.True(t, health.Verified)
+	assert.True(t, health.Healthy())
+
+	health, ok = opts.GetPackageHealth(id, "2.0.0")
+	assert.True(t, ok)
+	assert.False(t, health.Verified)
+	assert.False(t, health.Healthy())
+	assert.Contains(t, health.VerifyError, "does not match the update's "+wrongSHA256.SHA256)
+
+	health, ok = opts.GetPackageHealth(id, "3.0.0")
+	assert.True(t, ok)
+	assert.False(t, health.Verified)
+	assert.False(t, health.Healthy())
+	assert.Contains(t, health.VerifyError, "signature")
+	assert.Equal(t, before+2, counterValue(packageVerificationFailures.WithLabelValues(id)))
+
+	// The report lists the failures
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	r := httptest.NewRequest(http.MethodGet, "/api/admin/health/packages", nil)
+	rr := httptest.NewRecorder()
+	PackageHealthReport(rr, r.WithContext(WithOptionsContext(lg.WithLoggerContext(r.Context(), logger), opts)))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	report := []PackageHealth{}
+	assert.Nil(t, json.NewDecoder(rr.Body).Decode(&report))
+	unhealthy := []string{}
+	for _, health := range report {
+		if health.ID == id && !health.Healthy() {
+			unhealthy = append(unhealthy, health.Version)
+		}
+	}
+	assert.Equal(t, []string{"2.0.0", "3.0.0"}, unhealthy)
+
+	// Verified versions aren't downloaded again, and failed ones are retried
+	mutex.Lock()
+	packages["3.0.0"] = signed
+	delete(packages, "1.0.0")
+	mutex.Unlock()
+	badSignature.SHA256 = sha256Of(signed)
+	opts.verifyPackages(context.Background(), extension.Extensions{valid, badSignature})
+	health, _ = opts.GetPackageHealth(id, "1.0.0")
+	assert.True(t, health.Verified)
+	health, _ = opts.GetPackageHealth(id, "3.0.0")
+	assert.True(t, health.Healthy())
+}
+
+func TestServedExtensions(t *testing.T) {
+	shared := extension.Extension{ID: "ldimlcelhnjgpjjemdjokpgeeikdinbm", Version: "1.0.0"}
+	tenant := &Tenant{Name: "verify"}
+	tenant.extensions.replace(map[string]extension.Extension{
+		shared.ID:                          shared,
+		"bfdgpgibhagkpdlnjonhkabjoijopoge": {ID: "bfdgpgibhagkpdlnjonhkabjoijopoge", Version: "2.0.0"},
+	})
+	opts := &Options{Tenants: []*Tenant{tenant}}
+	opts.SetCatalog(map[string]extension.Extension{shared.ID: shared})
+
+	// The versions of tenants are checked too, but each version only once
+	versions := []string{}
+	for _, ext := range opts.servedExtensions() {
+		versions = append(versions, ext.ID+" "+ext.Version)
+	}
+	assert.ElementsMatch(t, []string{shared.ID + " 1.0.0", "bfdgpgibhagkpdlnjonhkabjoijopoge 2.0.0"}, versions)
+}
@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"context"
+	"github.com/go-chi/chi"
+	"net/http"
+	"strings"
+)
+
+// Versions of the admin and stats APIs, served on /api/{version}.
+// Update checks follow the Omaha protocol version instead.
+const (
+	// APIVersion1 is the original API, also served on the unversioned /api routes
+	APIVersion1 = "v1"
+	// APIVersion2 wraps every list in an object, so fields can be added to responses without breaking clients
+	APIVersion2 = "v2"
+)
+
+type apiVersionContextKey struct{}
+
+// APIRouter is the router for /api/{version} endpoints
+func APIRouter(version string, opts *Options) chi.Router {
+	r := chi.NewRouter()
+	r.Use(withAPIVersion(version))
+	r.Mount("/admin", AdminRouter(opts))
+	r.Mount("/stats", StatsRouter(opts))
+	return r
+}
+
+// withAPIVersion serves requests with the given version of the API
+func withAPIVersion(version string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiVersionContextKey{}, version)))
+		})
+	}
+}
+
+// apiVersion returns the API version a request is served with, APIVersion1 for the unversioned routes
+func apiVersion(r *http.Request) string {
+	if version, ok := r.Context().Value(apiVersionContextKey{}).(string); ok {
+		return version
+	}
+	return APIVersion1
+}
+
+// Deprecated marks routes as replaced by the same path with the first occurrence of legacy replaced by successor,
+// with the Deprecation and Link headers clients and proxies can warn about
+func Deprecated(legacy string, successor string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", "true")
+			w.Header().Set("Link", "<"+strings.Replace(r.URL.Path, legacy, successor, 1)+`>; rel="successor-version"`)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// writeList writes list as a JSON response, wrapped in an object under name from APIVersion2 on
+func writeList(w http.ResponseWriter, r *http.Request, name string, list interface{}) {
+	if apiVersion(r) == APIVersion1 {
+		writeJSON(w, r, http.StatusOK, list)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, map[string]interface{}{name: list})
+}
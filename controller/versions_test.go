@@ -0,0 +1,65 @@
+package controller_test
+
+import (
+	"context"
+	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/extension"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAPIVersions(t *testing.T) {
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	adminRequest := func(path string) (*http.Response, []byte) {
+		req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		assert.Nil(t, err)
+		req.Header.Set("Authorization", "Bearer test-token")
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		data, err := ioutil.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		return resp, data
+	}
+
+	// The unversioned routes behave like v1 and point to it
+	legacy, legacyData := adminRequest("/api/admin/catalog")
+	assert.Equal(t, http.StatusOK, legacy.StatusCode)
+	assert.Equal(t, "true", legacy.Header.Get("Deprecation"))
+	assert.Equal(t, `</api/v1/admin/catalog>; rel="successor-version"`, legacy.Header.Get("Link"))
+	resp, data := adminRequest("/api/v1/admin/catalog")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, resp.Header.Get("Deprecation"))
+	assert.Equal(t, legacyData, data)
+	assert.True(t, strings.HasPrefix(string(data), "["))
+
+	// v2 wraps lists in objects, and its catalog can still be pinned in a manifest
+	resp, data = adminRequest("/api/v2/admin/catalog")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.True(t, strings.HasPrefix(string(data), `{"extensions":[`))
+	dir, err := ioutil.TempDir("", "go-update-manifest")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "catalog.json")
+	assert.Nil(t, ioutil.WriteFile(path, data, 0644))
+	extensions, err := controller.ManifestStore{Path: path}.LoadExtensions(context.Background())
+	assert.Nil(t, err)
+	_, ok := extension.LoadExtensionsIntoMap(&extensions)["ldimlcelhnjgpjjemdjokpgeeikdinbm"]
+	assert.True(t, ok)
+	resp, data = adminRequest("/api/v2/admin/health/packages")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.True(t, strings.HasPrefix(string(data), `{"packages":[`))
+
+	resp, _ = adminRequest("/api/v1/stats/extensions")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, _ = adminRequest("/api/stats/extensions")
+	assert.Equal(t, `</api/v1/stats/extensions>; rel="successor-version"`, resp.Header.Get("Link"))
+	resp, _ = adminRequest("/api/v3/admin/catalog")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
@@ -0,0 +1,110 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"github.com/brave/go-update/client"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// warmingUp is 1 while WarmUp is running
+var warmingUp int32
+
+// servedCatalogs are the catalogs refreshed for routers and tenants, which are loaded once their generation isn't 0
+var servedCatalogs = []*catalogHolder{}
+var servedCatalogsMutex sync.Mutex
+
+// servingCatalog adds catalog to those which must be loaded before the server is Ready
+func servingCatalog(catalog *catalogHolder) {
+	servedCatalogsMutex.Lock()
+	defer servedCatalogsMutex.Unlock()
+	for _, served := range servedCatalogs {
+		if served == catalog {
+			return
+		}
+	}
+	servedCatalogs = append(servedCatalogs, catalog)
+}
+
+// Ready returns true once every catalog being served has been loaded and WarmUp has finished,
+// so load balancers don't send traffic to a server which would redirect every update check for lack of a catalog.
+// The package's default catalog is checked until routers start serving any.
+func Ready() bool {
+	if atomic.LoadInt32(&warmingUp) != 0 {
+		return false
+	}
+	servedCatalogsMutex.Lock()
+	defer servedCatalogsMutex.Unlock()
+	if len(servedCatalogs) == 0 {
+		return CurrentCatalog().Generation() != 0
+	}
+	for _, catalog := range servedCatalogs {
+		if catalog.snapshot().Generation() == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Readiness answers 200 once the server is Ready, and 503 until then
+func Readiness(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "text/plain")
+	if !Ready() {
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+	_, _ = w.Write([]byte("ready"))
+}
+
+// WarmUp sends update checks for the extensions with ids in the default catalog of opts through handler, which serves it, in the XML and JSON
+// protocols and as a web store GET, so their responses are built and cached before clients arrive. Like canary checks
+// they aren't counted as clients being served. Extensions which aren't in the catalog are skipped.
+func WarmUp(handler http.Handler, opts *Options, ids []string) {
+	atomic.StoreInt32(&warmingUp, 1)
+	defer atomic.StoreInt32(&warmingUp, 0)
+
+	request := client.Request{ProdVersion: "0.0.0.0", Channel: "stable", OS: "linux", Arch: "x64"}
+	query := url.Values{}
+	catalog := opts.CurrentCatalog()
+	for _, id := range ids {
+		if _, ok := catalog.Lookup(id); !ok {
+			log.Printf("skipped warming up %s, which isn't in the catalog\n", id)
+			continue
+		}
+		request.Apps = append(request.Apps, client.App{ID: id, Version: "0.0.0.0"})
+		query.Add("x", "id="+id+"&v=0.0.0.0&uc")
+	}
+	if len(request.Apps) == 0 {
+		return
+	}
+	start := time.Now()
+	for _, format := range []client.Format{client.XML, client.JSON} {
+		body, contentType, err := client.Encode(request, format)
+		if err != nil {
+			log.Printf("failed to warm up: %v\n", err)
+			return
+		}
+		req := httptest.NewRequest(http.MethodPost, "/extensions", bytes.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		warmUpCheck(handler, req)
+	}
+	warmUpCheck(handler, httptest.NewRequest(http.MethodGet, "/extensions?"+query.Encode(), nil))
+	log.Printf("warmed up %d extensions in %s\n", len(request.Apps), time.Since(start))
+}
+
+// warmUpCheck sends req through handler as a canary request, logging unless it succeeds
+func warmUpCheck(handler http.Handler, req *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req.WithContext(context.WithValue(ctx, canaryContextKey{}, true)))
+	if recorder.Code != http.StatusOK {
+		log.Printf("warm up %s update check answered %d\n", req.Method, recorder.Code)
+	}
+}
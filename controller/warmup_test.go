@@ -0,0 +1,24 @@
+package controller_test
+
+import (
+	"github.com/brave/go-update/controller"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReadiness(t *testing.T) {
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	// The catalog was loaded when the handler was created
+	resp, err := http.Get(server.URL + "/readyz")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, "ready", string(body))
+	assert.True(t, controller.Ready())
+}
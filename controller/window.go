@@ -0,0 +1,225 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ServingWindow limits when updates for an extension are offered, like keeping large components out of peak hours.
+// Start and End are times of day like "22:00" in TimeZone, UTC if empty. Windows where End is before Start span midnight.
+type ServingWindow struct {
+	ID       string `json:"id"`
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+// servingWindowLayout is the layout of the start and end of serving windows
+const servingWindowLayout = "15:04"
+
+// servingWindows are the serving windows by extension ID of some Options. Extensions without one are always served.
+type servingWindows struct {
+	mutex   sync.RWMutex
+	windows map[string]ServingWindow
+}
+
+// validate checks the times and time zone of window
+func (window ServingWindow) validate() error {
+	for _, value := range []string{window.Start, window.End} {
+		if _, err := time.Parse(servingWindowLayout, value); err != nil {
+			return fmt.Errorf("%q is not a time of day like 22:00", value)
+		}
+	}
+	if window.Start == window.End {
+		return fmt.Errorf("window is empty")
+	}
+	_, err := time.LoadLocation(window.TimeZone)
+	return err
+}
+
+// contains returns true if the time of day of now is within the window
+func (window ServingWindow) contains(now time.Time) bool {
+	location, err := time.LoadLocation(window.TimeZone)
+	if err != nil {
+		// Windows are validated before they are added, so this only happens if the time zone database changed
+		return true
+	}
+	now = now.In(location)
+	start, _ := time.Parse(servingWindowLayout, window.Start)
+	end, _ := time.Parse(servingWindowLayout, window.End)
+	minute := now.Hour()*60 + now.Minute()
+	startMinute := start.Hour()*60 + start.Minute()
+	endMinute := end.Hour()*60 + end.Minute()
+	if startMinute < endMinute {
+		return minute >= startMinute && minute < endMinute
+	}
+	return minute >= startMinute || minute < endMinute
+}
+
+// untilOpen returns how long it is from now until the window next starts
+func (window ServingWindow) untilOpen(now time.Time) time.Duration {
+	location, err := time.LoadLocation(window.TimeZone)
+	if err != nil {
+		return 0
+	}
+	now = now.In(location)
+	start, _ := time.Parse(servingWindowLayout, window.Start)
+	opens := time.Date(now.Year(), now.Month(), now.Day(), start.Hour(), start.Minute(), 0, 0, location)
+	if !opens.After(now) {
+		opens = opens.AddDate(0, 0, 1)
+	}
+	return opens.Sub(now)
+}
+
+// isOutsideServingWindow returns true if updates for the extension with id aren't offered with opts at now
+func (opts *Options) isOutsideServingWindow(id string, now time.Time) bool {
+	return opts.untilServingWindow(id, now) != 0
+}
+
+// untilServingWindow returns how long it is from now until updates for the extension with id are offered with opts,
+// which is 0 when they are offered at now
+func (opts *Options) untilServingWindow(id string, now time.Time) time.Duration {
+	if opts == nil {
+		return 0
+	}
+	opts.windows.mutex.RLock()
+	window, ok := opts.windows.windows[id]
+	opts.windows.mutex.RUnlock()
+	if !ok || window.contains(now) {
+		return 0
+	}
+	return window.untilOpen(now)
+}
+
+// LoadServingWindows replaces the serving windows of opts with those in its ServingWindowsFile, if it exists
+func (opts *Options) LoadServingWindows() error {
+	if len(opts.ServingWindowsFile) == 0 {
+		return nil
+	}
+	data, err := ioutil.ReadFile(opts.ServingWindowsFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	list := []ServingWindow{}
+	err = json.Unmarshal(data, &list)
+	if err != nil {
+		return fmt.Errorf("%s: %v", opts.ServingWindowsFile, err)
+	}
+	windows := map[string]ServingWindow{}
+	for _, window := range list {
+		if err := window.validate(); err != nil {
+			return fmt.Errorf("%s: serving window of %s: %v", opts.ServingWindowsFile, window.ID, err)
+		}
+		windows[window.ID] = window
+	}
+	opts.windows.mutex.Lock()
+	defer opts.windows.mutex.Unlock()
+	opts.windows.windows = windows
+	return nil
+}
+
+// list returns the serving windows sorted by ID
+func (serving *servingWindows) list() []ServingWindow {
+	serving.mutex.RLock()
+	defer serving.mutex.RUnlock()
+	windows := []ServingWindow{}
+	for _, window := range serving.windows {
+		windows = append(windows, window)
+	}
+	sort.Slice(windows, func(i, j int) bool {
+		return windows[i].ID < windows[j].ID
+	})
+	return windows
+}
+
+// put sets the serving window of its extension, returning the one it replaced if it had one
+func (serving *servingWindows) put(window ServingWindow) (ServingWindow, bool) {
+	serving.mutex.Lock()
+	defer serving.mutex.Unlock()
+	before, existed := serving.windows[window.ID]
+	if serving.windows == nil {
+		serving.windows = map[string]ServingWindow{}
+	}
+	serving.windows[window.ID] = window
+	return before, existed
+}
+
+// remove deletes the serving window of the extension with id, returning it if there was one
+func (serving *servingWindows) remove(id string) (ServingWindow, bool) {
+	serving.mutex.Lock()
+	defer serving.mutex.Unlock()
+	before, ok := serving.windows[id]
+	delete(serving.windows, id)
+	return before, ok
+}
+
+// saveServingWindows writes the serving windows of opts to its ServingWindowsFile.
+// It is written to a temporary file first so a crash can't leave it half written.
+func (opts *Options) saveServingWindows() error {
+	if len(opts.ServingWindowsFile) == 0 {
+		return nil
+	}
+	data, err := json.MarshalIndent(opts.windows.list(), "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(opts.ServingWindowsFile), ".windows")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), opts.ServingWindowsFile)
+}
+
+// GetServingWindows is the admin handler for listing the serving windows
+func GetServingWindows(w http.ResponseWriter, r *http.Request) {
+	writeList(w, r, "windows", adminService.ServingWindows(r.Context()))
+}
+
+// PutServingWindow is the admin handler for only offering updates for an extension within a window.
+// The body is a ServingWindow.
+func PutServingWindow(w http.ResponseWriter, r *http.Request) {
+	window := ServingWindow{}
+	err := json.NewDecoder(io.LimitReader(r.Body, 1024*1024)).Decode(&window)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading body: %v", err), http.StatusBadRequest)
+		return
+	}
+	window.ID = chi.URLParam(r, "id")
+	window, err = adminService.PutServingWindow(r.Context(), window)
+	if err != nil {
+		writeAdminError(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, window)
+}
+
+// DeleteServingWindow is the admin handler for offering updates for an extension at any time again
+func DeleteServingWindow(w http.ResponseWriter, r *http.Request) {
+	err := adminService.DeleteServingWindow(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeAdminError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,101 @@
+package controller_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/extension"
+	"github.com/brave/go-update/memstore"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestServingWindows(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-update-windows")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	opts := &controller.Options{
+		Store:              controller.NewValidatingStore(memstore.New(nil)),
+		Clock:              testClock,
+		ServingWindowsFile: filepath.Join(dir, "windows.json"),
+	}
+	opts.SetCatalog(handlerOptions.CurrentCatalog().Map())
+	server := httptest.NewServer(newTestHandler(opts))
+	defer server.Close()
+	admin := func(method string, id string, body string) int {
+		req, err := http.NewRequest(method, server.URL+"/api/admin/serving-windows/"+id, bytes.NewBufferString(body))
+		assert.Nil(t, err)
+		req.Header.Set("Authorization", "Bearer test-token")
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		return resp.StatusCode
+	}
+	window := func(from time.Duration, to time.Duration) string {
+		now := testClock.Now().In(time.FixedZone("", 0))
+		return fmt.Sprintf(`{"start":%q,"end":%q,"timeZone":"UTC"}`, now.Add(from).Format("15:04"), now.Add(to).Format("15:04"))
+	}
+	query := "?" + getQueryParams(&extension.Extension{ID: "ldimlcelhnjgpjjemdjokpgeeikdinbm", Version: "0.0.0"})
+	noUpdate := `<gupdate protocol="3.1" server="prod"></gupdate>`
+	update := `<gupdate protocol="3.1" server="prod">
+    <app appid="ldimlcelhnjgpjjemdjokpgeeikdinbm" status="ok">
+        <updatecheck status="ok" codebase="https://brave-core-ext.s3.brave.com/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/extension_1_0_0.crx" version="1.0.0" hash_sha256="1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618"></updatecheck>
+    </app>
+</gupdate>`
+
+	assert.Equal(t, http.StatusBadRequest, admin(http.MethodPut, "ldimlcelhnjgpjjemdjokpgeeikdinbm", `{"start":"25:00","end":"06:00"}`))
+	assert.Equal(t, http.StatusBadRequest, admin(http.MethodPut, "ldimlcelhnjgpjjemdjokpgeeikdinbm", `{"start":"22:00","end":"06:00","timeZone":"Mars/Olympus_Mons"}`))
+
+	// Outside the window clients are told there is no update
+	assert.Equal(t, http.StatusOK, admin(http.MethodPut, "ldimlcelhnjgpjjemdjokpgeeikdinbm", window(2*time.Hour, 3*time.Hour)))
+	defer admin(http.MethodDelete, "ldimlcelhnjgpjjemdjokpgeeikdinbm", "")
+	testCall(t, server, http.MethodGet, query, "", http.StatusOK, noUpdate, "")
+
+	// and when to check again, which is when the window starts
+	resp, err := http.Get(server.URL + "/extensions" + query)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	retryAfter, err := strconv.Atoi(resp.Header.Get("X-Retry-After"))
+	assert.Nil(t, err)
+	assert.True(t, retryAfter > 2*3600-60 && retryAfter <= 2*3600, retryAfter)
+
+	// Windows can span midnight
+	assert.Equal(t, http.StatusOK, admin(http.MethodPut, "ldimlcelhnjgpjjemdjokpgeeikdinbm", window(-time.Hour, time.Hour)))
+	testCall(t, server, http.MethodGet, query, "", http.StatusOK, update, "")
+	assert.Equal(t, http.StatusOK, admin(http.MethodPut, "ldimlcelhnjgpjjemdjokpgeeikdinbm", window(time.Hour, -time.Hour)))
+	testCall(t, server, http.MethodGet, query, "", http.StatusOK, noUpdate, "")
+
+	// Changes are saved so they are loaded again after a restart
+	data, err := ioutil.ReadFile(opts.ServingWindowsFile)
+	assert.Nil(t, err)
+	windows := []controller.ServingWindow{}
+	assert.Nil(t, json.Unmarshal(data, &windows))
+	assert.Equal(t, 1, len(windows))
+	assert.Equal(t, "ldimlcelhnjgpjjemdjokpgeeikdinbm", windows[0].ID)
+	restarted := &controller.Options{
+		Store:              controller.NewValidatingStore(memstore.New(nil)),
+		Clock:              testClock,
+		ServingWindowsFile: opts.ServingWindowsFile,
+	}
+	assert.Nil(t, restarted.LoadServingWindows())
+	restarted.SetCatalog(handlerOptions.CurrentCatalog().Map())
+	restartedServer := httptest.NewServer(newTestHandler(restarted))
+	defer restartedServer.Close()
+	testCall(t, restartedServer, http.MethodGet, query, "", http.StatusOK, noUpdate, "")
+
+	// Other handlers don't share the windows
+	sharedServer := httptest.NewServer(handler)
+	defer sharedServer.Close()
+	testCall(t, sharedServer, http.MethodGet, query, "", http.StatusOK, update, "")
+
+	assert.Equal(t, http.StatusNoContent, admin(http.MethodDelete, "ldimlcelhnjgpjjemdjokpgeeikdinbm", ""))
+	assert.Equal(t, http.StatusNotFound, admin(http.MethodDelete, "ldimlcelhnjgpjjemdjokpgeeikdinbm", ""))
+	testCall(t, server, http.MethodGet, query, "", http.StatusOK, update, "")
+}
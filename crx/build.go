@@ -0,0 +1,142 @@
+package crx
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ParsePrivateKey parses a PEM encoded RSA or ECDSA private key, like the .pem file Chromium creates
+// when it first packs an extension, in PKCS #8, PKCS #1 or SEC 1 form
+func ParsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM private key found")
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		switch key := key.(type) {
+		case *rsa.PrivateKey:
+			return key, nil
+		case *ecdsa.PrivateKey:
+			return key, nil
+		default:
+			return nil, fmt.Errorf("%T keys can't sign CRX files", key)
+		}
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("the PEM block is not an RSA or ECDSA private key")
+}
+
+// Build creates a CRX3 file containing the zip archive, signed with key and declaring the ID derived from it.
+// The ID is returned along with the file.
+func Build(key crypto.Signer, archive []byte) ([]byte, string, error) {
+	publicKey, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(publicKey)
+	signedData := appendBytesField(nil, fieldCRXID, sum[:16])
+
+	hash := sha256.New()
+	size := make([]byte, 4)
+	binary.LittleEndian.PutUint32(size, uint32(len(signedData)))
+	_, _ = hash.Write([]byte(signatureContext))
+	_, _ = hash.Write(size)
+	_, _ = hash.Write(signedData)
+	_, _ = hash.Write(archive)
+	signature, err := key.Sign(rand.Reader, hash.Sum(nil), crypto.SHA256)
+	if err != nil {
+		return nil, "", err
+	}
+
+	proof := appendBytesField(nil, fieldPublicKey, publicKey)
+	proof = appendBytesField(proof, fieldSignature, signature)
+	var header []byte
+	switch key.Public().(type) {
+	case *rsa.PublicKey:
+		header = appendBytesField(nil, fieldSHA256WithRSA, proof)
+	case *ecdsa.PublicKey:
+		header = appendBytesField(nil, fieldSHA256WithECDSA, proof)
+	default:
+		return nil, "", fmt.Errorf("%T keys can't sign CRX files", key.Public())
+	}
+	header = appendBytesField(header, fieldSignedHeaderData, signedData)
+
+	crx := []byte(Magic)
+	crx = appendUint32(crx, Version)
+	crx = appendUint32(crx, uint32(len(header)))
+	crx = append(crx, header...)
+	return append(crx, archive...), EncodeID(sum[:16]), nil
+}
+
+// ZipDirectory creates a zip archive of the files under dir, as they are laid out in an unpacked extension
+func ZipDirectory(dir string) ([]byte, error) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(name)
+		header.Method = zip.Deflate
+		w, err := archive.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(w, f)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = archive.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf, v)
+	return append(b, buf...)
+}
+
+func appendBytesField(b []byte, field uint64, value []byte) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, field<<3|2)
+	b = append(b, buf[:n]...)
+	n = binary.PutUvarint(buf, uint64(len(value)))
+	b = append(b, buf[:n]...)
+	return append(b, value...)
+}
@@ -0,0 +1,252 @@
+// Package crx implements reading and building of CRX3 extension packages
+package crx
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// Magic is the leading bytes of every CRX file
+const Magic = "Cr24"
+
+// Version is the only CRX format version we support
+const Version = 3
+
+// signatureContext is prepended to the signed data of every CRX3 signature
+const signatureContext = "CRX3 SignedData\x00"
+
+// maxHeaderSize guards against allocating huge headers from untrusted uploads
+const maxHeaderSize = 1024 * 1024
+
+// Field numbers from Chromium's crx3.proto
+const (
+	fieldSHA256WithRSA    = 2
+	fieldSHA256WithECDSA  = 3
+	fieldSignedHeaderData = 10000
+	fieldPublicKey        = 1
+	fieldSignature        = 2
+	fieldCRXID            = 1
+)
+
+// AsymmetricKeyProof is a public key and the signature made with it
+type AsymmetricKeyProof struct {
+	PublicKey []byte
+	Signature []byte
+}
+
+// Header is the parsed header of a CRX3 file
+type Header struct {
+	SHA256WithRSA    []AsymmetricKeyProof
+	SHA256WithECDSA  []AsymmetricKeyProof
+	SignedHeaderData []byte
+	// CRXID is the 16 byte ID declared in the signed header data
+	CRXID []byte
+	// Size is the number of bytes before the zip archive starts
+	Size int64
+}
+
+// ReadHeader reads and parses the CRX3 header from r.
+// After it returns, r is positioned at the start of the zip archive.
+func ReadHeader(r io.Reader) (*Header, error) {
+	prefix := make([]byte, 12)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, fmt.Errorf("error reading CRX header: %v", err)
+	}
+	if string(prefix[:4]) != Magic {
+		return nil, errors.New("not a CRX file")
+	}
+	if version := binary.LittleEndian.Uint32(prefix[4:8]); version != Version {
+		return nil, fmt.Errorf("CRX version: %d not supported", version)
+	}
+	headerSize := binary.LittleEndian.Uint32(prefix[8:12])
+	if headerSize > maxHeaderSize {
+		return nil, fmt.Errorf("CRX header of %d bytes is too large", headerSize)
+	}
+	data := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("error reading CRX header: %v", err)
+	}
+
+	header := Header{Size: int64(len(prefix)) + int64(headerSize)}
+	err := parseMessage(data, func(field uint64, value []byte) error {
+		switch field {
+		case fieldSHA256WithRSA, fieldSHA256WithECDSA:
+			proof, err := parseProof(value)
+			if err != nil {
+				return err
+			}
+			if field == fieldSHA256WithRSA {
+				header.SHA256WithRSA = append(header.SHA256WithRSA, proof)
+			} else {
+				header.SHA256WithECDSA = append(header.SHA256WithECDSA, proof)
+			}
+		case fieldSignedHeaderData:
+			header.SignedHeaderData = value
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = parseMessage(header.SignedHeaderData, func(field uint64, value []byte) error {
+		if field == fieldCRXID {
+			header.CRXID = value
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(header.CRXID) != 16 {
+		return nil, errors.New("CRX header does not declare an ID")
+	}
+	return &header, nil
+}
+
+// Verify reads a whole CRX3 file from r and checks every signature in its header.
+// One of the signatures must be made with the key that the declared ID is derived from,
+// otherwise anyone could publish a package claiming to be any extension.
+func Verify(r io.Reader) (*Header, error) {
+	header, err := ReadHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(header.SHA256WithRSA)+len(header.SHA256WithECDSA) == 0 {
+		return nil, errors.New("CRX is not signed")
+	}
+
+	hash := sha256.New()
+	size := make([]byte, 4)
+	binary.LittleEndian.PutUint32(size, uint32(len(header.SignedHeaderData)))
+	_, _ = hash.Write([]byte(signatureContext))
+	_, _ = hash.Write(size)
+	_, _ = hash.Write(header.SignedHeaderData)
+	if _, err := io.Copy(hash, r); err != nil {
+		return nil, fmt.Errorf("error reading CRX archive: %v", err)
+	}
+	digest := hash.Sum(nil)
+
+	foundDeveloperKey := false
+	for _, proof := range header.SHA256WithRSA {
+		publicKey, err := x509.ParsePKIXPublicKey(proof.PublicKey)
+		rsaKey, ok := publicKey.(*rsa.PublicKey)
+		if err != nil || !ok {
+			return nil, errors.New("CRX has an invalid RSA public key")
+		}
+		if rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest, proof.Signature) != nil {
+			return nil, errors.New("CRX has an invalid RSA signature")
+		}
+		foundDeveloperKey = foundDeveloperKey || IDFromPublicKey(proof.PublicKey) == header.ID()
+	}
+	for _, proof := range header.SHA256WithECDSA {
+		publicKey, err := x509.ParsePKIXPublicKey(proof.PublicKey)
+		ecdsaKey, ok := publicKey.(*ecdsa.PublicKey)
+		if err != nil || !ok {
+			return nil, errors.New("CRX has an invalid ECDSA public key")
+		}
+		var signature struct {
+			R, S *big.Int
+		}
+		if _, err := asn1.Unmarshal(proof.Signature, &signature); err != nil || !ecdsa.Verify(ecdsaKey, digest, signature.R, signature.S) {
+			return nil, errors.New("CRX has an invalid ECDSA signature")
+		}
+		foundDeveloperKey = foundDeveloperKey || IDFromPublicKey(proof.PublicKey) == header.ID()
+	}
+	if !foundDeveloperKey {
+		return nil, fmt.Errorf("CRX is not signed by the key for %s", header.ID())
+	}
+	return header, nil
+}
+
+// ID returns the extension ID declared in the header
+func (header *Header) ID() string {
+	return EncodeID(header.CRXID)
+}
+
+// EncodeID converts the 16 byte binary form of an ID into the a-p alphabet used for extension IDs
+func EncodeID(crxID []byte) string {
+	id := []byte(hex.EncodeToString(crxID))
+	for i, c := range id {
+		if c >= 'a' {
+			id[i] = c - 'a' + 'k'
+		} else {
+			id[i] = c - '0' + 'a'
+		}
+	}
+	return string(id)
+}
+
+// IDFromPublicKey computes the extension ID for a DER encoded public key
+func IDFromPublicKey(publicKey []byte) string {
+	sum := sha256.Sum256(publicKey)
+	return EncodeID(sum[:16])
+}
+
+func parseProof(data []byte) (AsymmetricKeyProof, error) {
+	proof := AsymmetricKeyProof{}
+	err := parseMessage(data, func(field uint64, value []byte) error {
+		switch field {
+		case fieldPublicKey:
+			proof.PublicKey = value
+		case fieldSignature:
+			proof.Signature = value
+		}
+		return nil
+	})
+	return proof, err
+}
+
+// parseMessage walks the length delimited fields of a protobuf message.
+// The CRX3 header only uses bytes fields, so any other wire type is skipped.
+func parseMessage(data []byte, fn func(field uint64, value []byte) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errors.New("malformed CRX header")
+		}
+		data = data[n:]
+		field, wireType := key>>3, key&7
+		switch wireType {
+		case 0:
+			_, n = binary.Uvarint(data)
+			if n <= 0 {
+				return errors.New("malformed CRX header")
+			}
+			data = data[n:]
+		case 1:
+			if len(data) < 8 {
+				return errors.New("malformed CRX header")
+			}
+			data = data[8:]
+		case 2:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < length {
+				return errors.New("malformed CRX header")
+			}
+			value := data[n : n+int(length)]
+			data = data[n+int(length):]
+			if err := fn(field, value); err != nil {
+				return err
+			}
+		case 5:
+			if len(data) < 4 {
+				return errors.New("malformed CRX header")
+			}
+			data = data[4:]
+		default:
+			return errors.New("malformed CRX header")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package crx
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/brave/go-update/crx/crxtest"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncodeID(t *testing.T) {
+	assert.Equal(t, "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", EncodeID(make([]byte, 16)))
+	assert.Equal(t, "abcdefghijklmnopaaaaaaaaaaaaaaaa", EncodeID([]byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef, 0, 0, 0, 0, 0, 0, 0, 0}))
+}
+
+func TestReadHeader(t *testing.T) {
+	key := crxtest.NewKey()
+	archive := []byte("PK not really a zip")
+	data := crxtest.BuildSignedCRX(key, archive)
+
+	reader := bytes.NewReader(data)
+	header, err := ReadHeader(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, IDFromPublicKey(crxtest.PublicKey(key)), header.ID())
+	assert.Equal(t, 1, len(header.SHA256WithRSA))
+	assert.Equal(t, 0, len(header.SHA256WithECDSA))
+	assert.Equal(t, crxtest.PublicKey(key), header.SHA256WithRSA[0].PublicKey)
+	assert.Equal(t, int64(len(data)-len(archive)), header.Size)
+
+	// The reader is left at the start of the archive
+	rest, err := ioutil.ReadAll(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, archive, rest)
+
+	// Not a CRX
+	_, err = ReadHeader(bytes.NewReader([]byte("PK\x03\x04 this is a zip file")))
+	assert.NotNil(t, err)
+
+	// CRX2 is not supported
+	crx2 := append([]byte{}, data...)
+	crx2[4] = 2
+	_, err = ReadHeader(bytes.NewReader(crx2))
+	assert.NotNil(t, err)
+
+	// Truncated header
+	_, err = ReadHeader(bytes.NewReader(data[:20]))
+	assert.NotNil(t, err)
+
+	// Header without an ID
+	_, err = ReadHeader(bytes.NewReader(crxtest.BuildCRX(key, nil, archive)))
+	assert.NotNil(t, err)
+}
+
+func TestVerify(t *testing.T) {
+	key := crxtest.NewKey()
+	archive := []byte("PK not really a zip")
+	data := crxtest.BuildSignedCRX(key, archive)
+
+	header, err := Verify(bytes.NewReader(data))
+	assert.Nil(t, err)
+	assert.Equal(t, IDFromPublicKey(crxtest.PublicKey(key)), header.ID())
+
+	// Tampering with the archive breaks the signature
+	tampered := append([]byte{}, data...)
+	tampered[len(tampered)-1] = 'X'
+	_, err = Verify(bytes.NewReader(tampered))
+	assert.NotNil(t, err)
+
+	// Claiming another extension's ID is rejected even though the signature is valid
+	otherID := []byte("0123456789abcdef")
+	_, err = Verify(bytes.NewReader(crxtest.BuildCRX(key, otherID, archive)))
+	assert.NotNil(t, err)
+}
+
+func TestBuild(t *testing.T) {
+	rsaKey := crxtest.NewKey()
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	for _, key := range []crypto.Signer{rsaKey, ecdsaKey} {
+		publicKey, err := x509.MarshalPKIXPublicKey(key.Public())
+		assert.Nil(t, err)
+		data, id, err := Build(key, []byte("PK archive"))
+		assert.Nil(t, err)
+		assert.Equal(t, IDFromPublicKey(publicKey), id)
+		header, err := Verify(bytes.NewReader(data))
+		assert.Nil(t, err)
+		assert.Equal(t, id, header.ID())
+	}
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	key := crxtest.NewKey()
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.Nil(t, err)
+	for _, block := range []*pem.Block{
+		{Type: "PRIVATE KEY", Bytes: pkcs8},
+		{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)},
+	} {
+		parsed, err := ParsePrivateKey(pem.EncodeToMemory(block))
+		assert.Nil(t, err)
+		assert.Equal(t, &key.PublicKey, parsed.Public())
+	}
+	_, err = ParsePrivateKey([]byte("not a key"))
+	assert.NotNil(t, err)
+}
+
+func TestZipDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-update-crx")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "images"), 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "manifest.json"), []byte(`{"version": "1.0"}`), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "images", "icon.png"), []byte("PNG"), 0644))
+
+	data, err := ZipDirectory(dir)
+	assert.Nil(t, err)
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	assert.Nil(t, err)
+	names := []string{}
+	for _, file := range archive.File {
+		names = append(names, file.Name)
+	}
+	assert.Equal(t, []string{"images/icon.png", "manifest.json"}, names)
+}
@@ -0,0 +1,75 @@
+package crxtest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+)
+
+// NewKey generates a small RSA key which is good enough for signing test packages.
+func NewKey() *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// PublicKey returns the DER encoded public key for key, which is what the extension ID is derived from.
+func PublicKey(key *rsa.PrivateKey) []byte {
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		panic(err)
+	}
+	return publicKey
+}
+
+// BuildCRX creates a CRX3 file containing archive, signed with key and declaring the ID for crxID.
+func BuildCRX(key *rsa.PrivateKey, crxID []byte, archive []byte) []byte {
+	signedData := appendBytesField(nil, 1, crxID)
+
+	signed := []byte("CRX3 SignedData\x00")
+	signed = appendUint32(signed, uint32(len(signedData)))
+	signed = append(signed, signedData...)
+	signed = append(signed, archive...)
+	digest := sha256.Sum256(signed)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		panic(err)
+	}
+
+	proof := appendBytesField(nil, 1, PublicKey(key))
+	proof = appendBytesField(proof, 2, signature)
+	header := appendBytesField(nil, 2, proof)
+	header = appendBytesField(header, 10000, signedData)
+
+	crx := []byte("Cr24")
+	crx = appendUint32(crx, 3)
+	crx = appendUint32(crx, uint32(len(header)))
+	crx = append(crx, header...)
+	return append(crx, archive...)
+}
+
+// BuildSignedCRX creates a CRX3 file whose declared ID matches the signing key.
+func BuildSignedCRX(key *rsa.PrivateKey, archive []byte) []byte {
+	sum := sha256.Sum256(PublicKey(key))
+	return BuildCRX(key, sum[:16], archive)
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf, v)
+	return append(b, buf...)
+}
+
+func appendBytesField(b []byte, field uint64, value []byte) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, field<<3|2)
+	b = append(b, buf[:n]...)
+	n = binary.PutUvarint(buf, uint64(len(value)))
+	b = append(b, buf[:n]...)
+	return append(b, value...)
+}
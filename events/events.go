@@ -0,0 +1,159 @@
+// Package events exports update check metadata to Kinesis, Kafka, files or S3 for downstream analytics.
+// Events are queued and sent in batches in the background so exporting never blocks a request.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Record is a single event, Key decides its Kinesis shard or Kafka partition
+type Record struct {
+	Key  string
+	Data []byte
+}
+
+// Sink sends a batch of records to a stream
+type Sink interface {
+	Send(ctx context.Context, records []Record) error
+}
+
+// Settings control the queue and batching of an Exporter
+type Settings struct {
+	// QueueSize is the most events waiting to be sent, events are dropped once it is full
+	QueueSize int
+	// BatchSize is the most events sent at once
+	BatchSize int
+	// FlushInterval is the longest an event waits for a batch to fill up
+	FlushInterval time.Duration
+	// Timeout is the deadline for sending each batch
+	Timeout time.Duration
+}
+
+// DefaultSettings suit Kinesis, which accepts up to 500 records at once
+var DefaultSettings = Settings{
+	QueueSize:     10000,
+	BatchSize:     500,
+	FlushInterval: time.Second,
+	Timeout:       10 * time.Second,
+}
+
+var eventsExported = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "events_exported_total",
+	Help: "Number of update check events sent to the event stream.",
+})
+
+var eventsDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "events_dropped_total",
+	Help: "Number of update check events dropped because the queue was full or sending failed.",
+}, []string{"reason"})
+
+func init() {
+	prometheus.MustRegister(eventsExported)
+	prometheus.MustRegister(eventsDropped)
+}
+
+// Exporter queues events and sends them to a Sink in batches.
+// A nil *Exporter is valid and discards everything, so callers don't need to check whether exporting is enabled.
+type Exporter struct {
+	sink     Sink
+	settings Settings
+	queue    chan Record
+	done     chan struct{}
+	once     sync.Once
+}
+
+// NewExporter starts sending events exported with the returned Exporter to sink
+func NewExporter(sink Sink, settings Settings) *Exporter {
+	exporter := &Exporter{
+		sink:     sink,
+		settings: settings,
+		queue:    make(chan Record, settings.QueueSize),
+		done:     make(chan struct{}),
+	}
+	go exporter.run()
+	return exporter
+}
+
+// Export queues event to be sent as JSON, dropping it if the queue is full.
+// key groups related events, and a timestamp is used when it is empty.
+func (exporter *Exporter) Export(key string, event interface{}) {
+	if exporter == nil {
+		return
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("error encoding event: %v\n", err)
+		eventsDropped.WithLabelValues("encoding").Inc()
+		return
+	}
+	if len(key) == 0 {
+		key = strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	select {
+	case exporter.queue <- Record{Key: key, Data: data}:
+	default:
+		eventsDropped.WithLabelValues("queue_full").Inc()
+	}
+}
+
+// Close sends the events which are still queued and stops the exporter.
+// Export must not be called after Close.
+func (exporter *Exporter) Close() {
+	if exporter == nil {
+		return
+	}
+	exporter.once.Do(func() {
+		close(exporter.queue)
+	})
+	<-exporter.done
+}
+
+func (exporter *Exporter) run() {
+	defer close(exporter.done)
+	ticker := time.NewTicker(exporter.settings.FlushInterval)
+	defer ticker.Stop()
+	batch := make([]Record, 0, exporter.settings.BatchSize)
+	for {
+		select {
+		case record, ok := <-exporter.queue:
+			if !ok {
+				exporter.send(batch)
+				return
+			}
+			batch = append(batch, record)
+			if len(batch) < exporter.settings.BatchSize {
+				continue
+			}
+		case <-ticker.C:
+		}
+		exporter.send(batch)
+		batch = batch[:0]
+	}
+}
+
+// send sends a batch, dropping it if it fails since analytics are best effort
+func (exporter *Exporter) send(batch []Record) {
+	if len(batch) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), exporter.settings.Timeout)
+	defer cancel()
+	err := exporter.sink.Send(ctx, batch)
+	if err == nil {
+		eventsExported.Add(float64(len(batch)))
+		return
+	}
+	failed := len(batch)
+	if sendErr, ok := err.(*SendError); ok {
+		failed = sendErr.Failed
+	}
+	log.Printf("error sending %d events: %v\n", failed, err)
+	eventsDropped.WithLabelValues("send_failed").Add(float64(failed))
+	eventsExported.Add(float64(len(batch) - failed))
+}
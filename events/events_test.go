@@ -0,0 +1,185 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingSink keeps every batch sent to it
+type recordingSink struct {
+	mutex   sync.Mutex
+	batches [][]Record
+	block   chan struct{}
+}
+
+func (sink *recordingSink) Send(ctx context.Context, records []Record) error {
+	if sink.block != nil {
+		<-sink.block
+	}
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	sink.batches = append(sink.batches, append([]Record{}, records...))
+	return nil
+}
+
+func TestExporter(t *testing.T) {
+	var exporter *Exporter
+	// A nil exporter discards events
+	exporter.Export("key", map[string]string{"a": "b"})
+	exporter.Close()
+
+	sink := &recordingSink{}
+	exporter = NewExporter(sink, Settings{QueueSize: 10, BatchSize: 2, FlushInterval: time.Hour, Timeout: time.Second})
+	for i := 0; i < 3; i++ {
+		exporter.Export("key", map[string]int{"i": i})
+	}
+	exporter.Export("", map[string]int{"i": 3})
+	exporter.Close()
+
+	assert.Equal(t, 2, len(sink.batches))
+	assert.Equal(t, "key", sink.batches[0][0].Key)
+	assert.Equal(t, `{"i":0}`, string(sink.batches[0][0].Data))
+	assert.Equal(t, `{"i":3}`, string(sink.batches[1][1].Data))
+	assert.NotEmpty(t, sink.batches[1][1].Key)
+
+	// Partial batches are sent after FlushInterval
+	sink = &recordingSink{}
+	exporter = NewExporter(sink, Settings{QueueSize: 10, BatchSize: 100, FlushInterval: time.Millisecond, Timeout: time.Second})
+	exporter.Export("key", "event")
+	sent := func() bool {
+		sink.mutex.Lock()
+		defer sink.mutex.Unlock()
+		return len(sink.batches) == 1
+	}
+	for i := 0; i < 100 && !sent(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.True(t, sent())
+	exporter.Close()
+
+	// Events are dropped rather than blocking when the queue is full
+	sink = &recordingSink{block: make(chan struct{})}
+	exporter = NewExporter(sink, Settings{QueueSize: 1, BatchSize: 1, FlushInterval: time.Hour, Timeout: time.Second})
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ {
+			exporter.Export("key", i)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("Export blocked on a full queue")
+	}
+	close(sink.block)
+	exporter.Close()
+	assert.True(t, len(sink.batches) < 10)
+}
+
+type fakeKinesis struct {
+	calls [][]string
+}
+
+// PutRecords rejects the records with the key "throttled" the first time they are sent
+func (f *fakeKinesis) PutRecords(ctx context.Context, input *kinesis.PutRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.PutRecordsOutput, error) {
+	keys := []string{}
+	output := &kinesis.PutRecordsOutput{FailedRecordCount: aws.Int32(0)}
+	for _, entry := range input.Records {
+		keys = append(keys, *entry.PartitionKey)
+		result := types.PutRecordsResultEntry{}
+		if *entry.PartitionKey == "throttled" && len(f.calls) == 0 {
+			result.ErrorCode = aws.String("ProvisionedThroughputExceededException")
+			*output.FailedRecordCount++
+		}
+		output.Records = append(output.Records, result)
+	}
+	f.calls = append(f.calls, keys)
+	return output, nil
+}
+
+func TestKinesisSink(t *testing.T) {
+	client := &fakeKinesis{}
+	sink := KinesisSink{Client: client, Stream: "update-checks"}
+	err := sink.Send(context.Background(), []Record{{Key: "a", Data: []byte("{}")}, {Key: "throttled", Data: []byte("{}")}})
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{{"a", "throttled"}, {"throttled"}}, client.calls)
+}
+
+func TestKafkaRESTSink(t *testing.T) {
+	var body struct {
+		Records []struct {
+			Key   string          `json:"key"`
+			Value json.RawMessage `json:"value"`
+		} `json:"records"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/topics/update-checks" {
+			http.NotFound(w, r)
+			return
+		}
+		assert.Equal(t, "application/vnd.kafka.json.v2+json", r.Header.Get("Content-Type"))
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	sink := KafkaRESTSink{URL: server.URL + "/", Topic: "update-checks"}
+	err := sink.Send(context.Background(), []Record{{Key: "a", Data: []byte(`{"i":1}`)}})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(body.Records))
+	assert.Equal(t, "a", body.Records[0].Key)
+	assert.Equal(t, `{"i":1}`, string(body.Records[0].Value))
+
+	sink.Topic = "missing"
+	assert.NotNil(t, sink.Send(context.Background(), []Record{{Key: "a", Data: []byte(`{}`)}}))
+}
+
+func TestFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-update-events")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	sink := &FileSink{Path: filepath.Join(dir, "events.jsonl")}
+	assert.Nil(t, sink.Send(context.Background(), []Record{{Key: "a", Data: []byte(`{"i":1}`)}, {Key: "b", Data: []byte(`{"i":2}`)}}))
+	assert.Nil(t, sink.Send(context.Background(), []Record{{Key: "c", Data: []byte(`{"i":3}`)}}))
+	data, err := ioutil.ReadFile(sink.Path)
+	assert.Nil(t, err)
+	assert.Equal(t, "{\"i\":1}\n{\"i\":2}\n{\"i\":3}\n", string(data))
+}
+
+type fakeS3 struct {
+	puts []*s3.PutObjectInput
+}
+
+func (f *fakeS3) PutObject(ctx context.Context, input *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	f.puts = append(f.puts, input)
+	return &s3.PutObjectOutput{}, nil
+}
+
+func TestS3Sink(t *testing.T) {
+	client := &fakeS3{}
+	sink := S3Sink{Client: client, Bucket: "recordings", Prefix: "update-checks"}
+	assert.Nil(t, sink.Send(context.Background(), []Record{{Key: "a", Data: []byte(`{"i":1}`)}, {Key: "b", Data: []byte(`{"i":2}`)}}))
+	assert.Equal(t, 1, len(client.puts))
+	assert.Equal(t, "recordings", *client.puts[0].Bucket)
+	assert.True(t, strings.HasPrefix(*client.puts[0].Key, "update-checks/"+time.Now().UTC().Format("2006/01/02")+"/"))
+	assert.True(t, strings.HasSuffix(*client.puts[0].Key, ".jsonl"))
+	body, err := ioutil.ReadAll(client.puts[0].Body)
+	assert.Nil(t, err)
+	assert.Equal(t, "{\"i\":1}\n{\"i\":2}\n", string(body))
+}
@@ -0,0 +1,177 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SendError is returned when only some records of a batch could not be sent
+type SendError struct {
+	Failed int
+	Total  int
+}
+
+func (err *SendError) Error() string {
+	return fmt.Sprintf("%d of %d records failed", err.Failed, err.Total)
+}
+
+// KinesisAPI is the part of the Kinesis client used by KinesisSink
+type KinesisAPI interface {
+	PutRecords(ctx context.Context, params *kinesis.PutRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.PutRecordsOutput, error)
+}
+
+// KinesisSink puts records on a Kinesis data stream
+type KinesisSink struct {
+	Client KinesisAPI
+	Stream string
+}
+
+// Send puts the records, retrying the ones Kinesis rejects once since throttling is usually per shard
+func (sink KinesisSink) Send(ctx context.Context, records []Record) error {
+	entries := make([]types.PutRecordsRequestEntry, 0, len(records))
+	for _, record := range records {
+		entries = append(entries, types.PutRecordsRequestEntry{
+			Data:         record.Data,
+			PartitionKey: aws.String(record.Key),
+		})
+	}
+	for attempt := 0; ; attempt++ {
+		result, err := sink.Client.PutRecords(ctx, &kinesis.PutRecordsInput{
+			StreamName: aws.String(sink.Stream),
+			Records:    entries,
+		})
+		if err != nil {
+			return err
+		}
+		if result.FailedRecordCount == nil || *result.FailedRecordCount == 0 {
+			return nil
+		}
+		failed := []types.PutRecordsRequestEntry{}
+		for i, entry := range result.Records {
+			if entry.ErrorCode != nil {
+				failed = append(failed, entries[i])
+			}
+		}
+		if attempt == 1 {
+			return &SendError{Failed: len(failed), Total: len(records)}
+		}
+		entries = failed
+	}
+}
+
+// KafkaRESTSink produces records to a Kafka topic through a Confluent compatible REST proxy
+type KafkaRESTSink struct {
+	// URL is the base URL of the REST proxy, like https://kafka-rest.example.com
+	URL    string
+	Topic  string
+	Client *http.Client
+}
+
+// Send produces the records, which are already JSON, in a single request
+func (sink KafkaRESTSink) Send(ctx context.Context, records []Record) error {
+	type kafkaRecord struct {
+		Key   string          `json:"key"`
+		Value json.RawMessage `json:"value"`
+	}
+	body := struct {
+		Records []kafkaRecord `json:"records"`
+	}{}
+	for _, record := range records {
+		body.Records = append(body.Records, kafkaRecord{Key: record.Key, Value: record.Data})
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(sink.URL, "/")+"/topics/"+url.PathEscape(sink.Topic), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("content-type", "application/vnd.kafka.json.v2+json")
+	client := sink.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("kafka REST proxy returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// FileSink appends records to a file, one JSON record per line
+type FileSink struct {
+	Path  string
+	mutex sync.Mutex
+}
+
+// Send appends the records to the file, creating it if needed
+func (sink *FileSink) Send(ctx context.Context, records []Record) error {
+	var buffer bytes.Buffer
+	for _, record := range records {
+		buffer.Write(record.Data)
+		buffer.WriteByte('\n')
+	}
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	file, err := os.OpenFile(sink.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(buffer.Bytes())
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// S3API is the part of the S3 client used by S3Sink
+type S3API interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+// S3Sink puts each batch of records in its own object under Prefix, one JSON record per line.
+// Objects are named by the time they were sent, like 2019/06/01/120000.000000000.jsonl, so they list in order.
+type S3Sink struct {
+	Client S3API
+	Bucket string
+	Prefix string
+}
+
+// Send puts the records in a new object
+func (sink S3Sink) Send(ctx context.Context, records []Record) error {
+	var buffer bytes.Buffer
+	for _, record := range records {
+		buffer.Write(record.Data)
+		buffer.WriteByte('\n')
+	}
+	_, err := sink.Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(sink.Bucket),
+		Key:         aws.String(path.Join(sink.Prefix, time.Now().UTC().Format("2006/01/02/150405.000000000")+".jsonl")),
+		Body:        bytes.NewReader(buffer.Bytes()),
+		ContentType: aws.String("application/x-ndjson"),
+	})
+	return err
+}
@@ -0,0 +1,49 @@
+package extension
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// Action is run by Omaha clients when they install an update, like the installer of a non-extension app and
+// the command line it is run with. Chrome ignores them, but some other clients can't complete installation without.
+type Action struct {
+	Event      string `json:"event"`
+	Run        string `json:"run,omitempty"`
+	Arguments  string `json:"arguments,omitempty"`
+	OnSuccess  string `json:"onsuccess,omitempty"`
+	SuccessURL string `json:"successurl,omitempty"`
+}
+
+// Events of actions
+const (
+	ActionEventPreinstall  = "preinstall"
+	ActionEventInstall     = "install"
+	ActionEventUpdate      = "update"
+	ActionEventPostinstall = "postinstall"
+)
+
+// Validate returns an error if the action's event or onsuccess behavior is unknown,
+// or an install action doesn't say what to run
+func (action Action) Validate() error {
+	switch action.Event {
+	case ActionEventPreinstall, ActionEventUpdate, ActionEventPostinstall:
+	case ActionEventInstall:
+		if len(action.Run) == 0 {
+			return fmt.Errorf("install actions need a command to run")
+		}
+	default:
+		return fmt.Errorf("unknown event %q", action.Event)
+	}
+	switch action.OnSuccess {
+	case "", "default", "exitsilently", "exitsilentlyonlaunchcmd":
+	default:
+		return fmt.Errorf("unknown onsuccess %q", action.OnSuccess)
+	}
+	if len(action.SuccessURL) != 0 {
+		if u, err := url.Parse(action.SuccessURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || len(u.Host) == 0 {
+			return fmt.Errorf("successurl %q is not an absolute HTTP URL", action.SuccessURL)
+		}
+	}
+	return nil
+}
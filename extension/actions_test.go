@@ -0,0 +1,28 @@
+package extension
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestValidateAction(t *testing.T) {
+	valid := []Action{
+		{Event: ActionEventInstall, Run: "setup.exe", Arguments: "--install --system-level"},
+		{Event: ActionEventPostinstall, OnSuccess: "exitsilentlyonlaunchcmd"},
+		{Event: ActionEventPostinstall, SuccessURL: "https://example.com/welcome"},
+		{Event: ActionEventUpdate, Run: "setup.exe"},
+	}
+	for _, action := range valid {
+		assert.Nil(t, action.Validate(), action.Event)
+	}
+	invalid := []Action{
+		{},
+		{Event: "uninstall", Run: "setup.exe"},
+		{Event: ActionEventInstall},
+		{Event: ActionEventPostinstall, OnSuccess: "reboot"},
+		{Event: ActionEventPostinstall, SuccessURL: "javascript:alert(1)"},
+	}
+	for _, action := range invalid {
+		assert.NotNil(t, action.Validate(), action.Event)
+	}
+}
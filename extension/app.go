@@ -0,0 +1,27 @@
+package extension
+
+import "strings"
+
+// Types of catalog records. Records without a type are extensions.
+const (
+	TypeExtension = "extension"
+	// TypeApp is an Omaha app other than an extension, like a native installer, whose package isn't a CRX
+	TypeApp = "app"
+)
+
+// IsApp returns true if the record is an Omaha app rather than an extension
+func (extension *Extension) IsApp() bool {
+	return extension.Type == TypeApp
+}
+
+// GetPackageName returns the file name of the package of the extension version, which is its PackageName
+// with the {version} and {version_underscored} placeholders replaced, or the CRX name if it has none
+func GetPackageName(extension Extension) string {
+	if len(extension.PackageName) == 0 {
+		return GetCRXName(extension.Version)
+	}
+	return strings.NewReplacer(
+		"{version}", extension.Version,
+		"{version_underscored}", strings.Replace(extension.Version, ".", "_", -1),
+	).Replace(extension.PackageName)
+}
@@ -0,0 +1,23 @@
+package extension
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestGetPackageName(t *testing.T) {
+	assert.Equal(t, "extension_1_0_2.crx", GetPackageName(Extension{ID: "ldimlcelhnjgpjjemdjokpgeeikdinbm", Version: "1.0.2"}))
+
+	app := Extension{ID: "{8A69D345-D564-463C-AFF1-A69D9E530F96}", Version: "1.0.2", Type: TypeApp, PackageName: "setup_{version_underscored}.exe"}
+	assert.True(t, app.IsApp())
+	assert.Equal(t, "setup_1_0_2.exe", GetPackageName(app))
+	app.PackageName = "Brave-{version}.dmg"
+	assert.Equal(t, "Brave-1.0.2.dmg", GetPackageName(app))
+	assert.Equal(t, "https://brave-core-ext.s3.brave.com/release/%7B8A69D345-D564-463C-AFF1-A69D9E530F96%7D/Brave-1.0.2.dmg", GetCodebaseURL(app, Client{}))
+
+	// Targeted packages are named after their own version
+	app.Rules = []Rule{{Package: &Package{Version: "1.0.1", SHA256: "legacy"}}}
+	targeted, ok := app.Target(Extension{})
+	assert.True(t, ok)
+	assert.Equal(t, "Brave-1.0.1.dmg", GetPackageName(targeted))
+}
@@ -0,0 +1,55 @@
+package extension
+
+import (
+	"errors"
+)
+
+// The kinds of errors of update requests, so callers can tell them apart without matching messages.
+// Errors are returned as an *Error of one of these kinds, see Cause.
+var (
+	// ErrUnsupportedProtocol is the kind of errors for requests with a protocol version which isn't served
+	ErrUnsupportedProtocol = errors.New("unsupported protocol")
+	// ErrMalformedRequest is the kind of errors for requests which can't be decoded
+	ErrMalformedRequest = errors.New("malformed request")
+	// ErrUnknownApp is the kind of errors for extensions which aren't in the catalog
+	ErrUnknownApp = errors.New("unknown app")
+)
+
+// Error is an error of one of the kinds above, with the details of what went wrong
+type Error struct {
+	Kind   error
+	Detail string
+}
+
+func (err *Error) Error() string {
+	if len(err.Detail) == 0 {
+		return err.Kind.Error()
+	}
+	return err.Kind.Error() + ": " + err.Detail
+}
+
+// Cause returns the kind of err if it is an *Error, or err itself otherwise
+func Cause(err error) error {
+	if typed, ok := err.(*Error); ok {
+		return typed.Kind
+	}
+	return err
+}
+
+// RequestError returns an error decoding an update request as an *Error, so errors of the XML and JSON
+// decoders, which fail before the request is looked at, are ErrMalformedRequest
+func RequestError(err error) error {
+	if _, ok := err.(*Error); ok || err == nil {
+		return err
+	}
+	return &Error{Kind: ErrMalformedRequest, Detail: err.Error()}
+}
+
+// Lookup returns the extension with id in catalog, or an ErrUnknownApp error if it isn't there
+func Lookup(catalog map[string]Extension, id string) (Extension, error) {
+	ext, ok := catalog[id]
+	if !ok {
+		return Extension{}, &Error{Kind: ErrUnknownApp, Detail: id}
+	}
+	return ext, nil
+}
@@ -0,0 +1,80 @@
+package extension
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// UpdateCheckEvent is the metadata of an update check request, including the ping and event
+// elements clients report for each app. It is exported to analytics as JSON.
+type UpdateCheckEvent struct {
+	XMLName        xml.Name   `xml:"request" json:"-"`
+	Time           time.Time  `xml:"-" json:"time"`
+	Protocol       string     `xml:"protocol,attr" json:"protocol"`
+	RequestID      string     `xml:"requestid,attr" json:"requestId,omitempty"`
+	SessionID      string     `xml:"sessionid,attr" json:"sessionId,omitempty"`
+	UserID         string     `xml:"userid,attr" json:"userId,omitempty"`
+	Updater        string     `xml:"updater,attr" json:"updater,omitempty"`
+	UpdaterVersion string     `xml:"version,attr" json:"updaterVersion,omitempty"`
+	ProdVersion    string     `xml:"prodversion,attr" json:"prodVersion,omitempty"`
+	ProdChannel    string     `xml:"prodchannel,attr" json:"prodChannel,omitempty"`
+	UpdaterChannel string     `xml:"updaterchannel,attr" json:"updaterChannel,omitempty"`
+	Lang           string     `xml:"lang,attr" json:"lang,omitempty"`
+	OS             string     `xml:"os,attr" json:"os,omitempty"`
+	Arch           string     `xml:"arch,attr" json:"arch,omitempty"`
+	OSInfo         *OSInfo    `xml:"os" json:"osInfo,omitempty"`
+	Apps           []AppEvent `xml:"app" json:"apps"`
+}
+
+// OSInfo is the os element of an update check
+type OSInfo struct {
+	Platform string `xml:"platform,attr" json:"platform,omitempty"`
+	Version  string `xml:"version,attr" json:"version,omitempty"`
+	Arch     string `xml:"arch,attr" json:"arch,omitempty"`
+}
+
+// AppEvent is what a client reported about one app in an update check
+type AppEvent struct {
+	AppID         string       `xml:"appid,attr" json:"appId"`
+	Version       string       `xml:"version,attr" json:"version"`
+	InstallSource string       `xml:"installsource,attr" json:"installSource,omitempty"`
+	UpdateCheck   *struct{}    `xml:"updatecheck" json:"-"`
+	Ping          *Ping        `xml:"ping" json:"ping,omitempty"`
+	Events        []OmahaEvent `xml:"event" json:"events,omitempty"`
+	// HasUpdateCheck is true when the app asked for an update rather than only sending pings or events
+	HasUpdateCheck bool `xml:"-" json:"updateCheck"`
+}
+
+// Ping is the active and roll call ping of an app
+type Ping struct {
+	Active        string `xml:"active,attr" json:"active,omitempty"`
+	RollCallDays  string `xml:"rd,attr" json:"rd,omitempty"`
+	ActiveDays    string `xml:"ad,attr" json:"ad,omitempty"`
+	RollCallAge   string `xml:"r,attr" json:"r,omitempty"`
+	ActiveAge     string `xml:"a,attr" json:"a,omitempty"`
+	PingFreshness string `xml:"ping_freshness,attr" json:"pingFreshness,omitempty"`
+}
+
+// OmahaEvent is an event element, like the result of an install or update
+type OmahaEvent struct {
+	Type            string `xml:"eventtype,attr" json:"type"`
+	Result          string `xml:"eventresult,attr" json:"result"`
+	ErrorCode       string `xml:"errorcode,attr" json:"errorCode,omitempty"`
+	ExtraCode1      string `xml:"extracode1,attr" json:"extraCode1,omitempty"`
+	PreviousVersion string `xml:"previousversion,attr" json:"previousVersion,omitempty"`
+	NextVersion     string `xml:"nextversion,attr" json:"nextVersion,omitempty"`
+}
+
+// ParseUpdateCheckEvent parses the metadata, pings and events of an update check request body
+func ParseUpdateCheckEvent(body []byte) (UpdateCheckEvent, error) {
+	event := UpdateCheckEvent{}
+	err := xml.Unmarshal(body, &event)
+	if err != nil {
+		return event, err
+	}
+	event.Time = time.Now().UTC()
+	for i := range event.Apps {
+		event.Apps[i].HasUpdateCheck = event.Apps[i].UpdateCheck != nil
+	}
+	return event, nil
+}
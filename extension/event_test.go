@@ -0,0 +1,75 @@
+package extension
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"github.com/brave/go-update/extension/extensiontest"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseUpdateCheckEvent(t *testing.T) {
+	_, err := ParseUpdateCheckEvent([]byte("<"))
+	assert.NotNil(t, err)
+
+	event, err := ParseUpdateCheckEvent([]byte(extensiontest.ExtensionRequestFnFor("aomjjhallfgjeglblehebfpbcfeobpgk")("4.7.0.90")))
+	assert.Nil(t, err)
+	assert.False(t, event.Time.IsZero())
+	assert.Equal(t, "3.0", event.Protocol)
+	assert.Equal(t, "{b4f77b70-af29-462b-a637-8a3e4be5ecd9}", event.RequestID)
+	assert.Equal(t, "53.0.2785.116", event.ProdVersion)
+	assert.Equal(t, "stable", event.ProdChannel)
+	assert.Equal(t, "mac", event.OS)
+	assert.Equal(t, "Mac OS X", event.OSInfo.Platform)
+	assert.Equal(t, 1, len(event.Apps))
+	assert.Equal(t, "aomjjhallfgjeglblehebfpbcfeobpgk", event.Apps[0].AppID)
+	assert.Equal(t, "4.7.0.90", event.Apps[0].Version)
+	assert.True(t, event.Apps[0].HasUpdateCheck)
+	assert.Equal(t, "-2", event.Apps[0].Ping.RollCallDays)
+
+	// Apps can report events without checking for updates
+	event, err = ParseUpdateCheckEvent([]byte(`<request protocol="3.1" sessionid="{5a2b2c1e}">
+		<app appid="aomjjhallfgjeglblehebfpbcfeobpgk" version="4.7.0.90">
+			<event eventtype="3" eventresult="1" errorcode="0" previousversion="4.6.0" nextversion="4.7.0.90"/>
+		</app>
+	</request>`))
+	assert.Nil(t, err)
+	assert.Equal(t, "{5a2b2c1e}", event.SessionID)
+	assert.False(t, event.Apps[0].HasUpdateCheck)
+	assert.Nil(t, event.Apps[0].Ping)
+	assert.Equal(t, []OmahaEvent{{Type: "3", Result: "1", ErrorCode: "0", PreviousVersion: "4.6.0", NextVersion: "4.7.0.90"}}, event.Apps[0].Events)
+}
+
+func TestRequestBuilder(t *testing.T) {
+	request := extensiontest.NewRequest().OS("linux").Channel("beta").DLPref("cacheable").
+		App("aomjjhallfgjeglblehebfpbcfeobpgk", "4.7.0.90").Ping().TargetVersionPrefix("4.7.").FP("1.abc").
+		App("ldimlcelhnjgpjjemdjokpgeeikdinbm", "1.0.0").NoUpdateCheck().
+		Event(extensiontest.Event{Type: extensiontest.EventTypeUpdate, Result: extensiontest.EventResultSuccess, PreviousVersion: "0.9.0", NextVersion: "1.0.0"}).
+		App("jdbefljfgobbmcidnmpjamcbhnbphjnb", "1.0.0").UpdateDisabled()
+
+	// The same request is parsed from XML and JSON
+	updateRequest := UpdateRequest{}
+	assert.Nil(t, xml.Unmarshal([]byte(request.BuildXML()), &updateRequest))
+	protocol4Request := Protocol4Request{}
+	assert.Nil(t, json.Unmarshal([]byte(request.BuildJSON()), &protocol4Request))
+	for _, parsed := range []UpdateRequest{updateRequest, protocol4Request.UpdateRequest} {
+		assert.Equal(t, 3, len(parsed))
+		assert.Equal(t, "aomjjhallfgjeglblehebfpbcfeobpgk", parsed[0].ID)
+		assert.Equal(t, "4.7.0.90", parsed[0].Version)
+		assert.Equal(t, "linux", parsed[0].Platform)
+		assert.Equal(t, "beta", parsed[0].Channel)
+		assert.Equal(t, "cacheable", parsed[0].DownloadPreference)
+		assert.True(t, parsed[0].Ping)
+		assert.True(t, parsed[1].PingOnly)
+		assert.True(t, parsed[2].UpdateDisabled)
+	}
+
+	event, err := ParseUpdateCheckEvent([]byte(request.BuildXML()))
+	assert.Nil(t, err)
+	assert.Equal(t, "3.1", event.Protocol)
+	assert.True(t, event.Apps[0].HasUpdateCheck)
+	assert.False(t, event.Apps[1].HasUpdateCheck)
+	assert.Equal(t, []OmahaEvent{{Type: "3", Result: "1", PreviousVersion: "0.9.0", NextVersion: "1.0.0"}}, event.Apps[1].Events)
+	assert.Contains(t, request.BuildXML(), `<packages><package fp="1.abc"></package></packages><updatecheck targetversionprefix="4.7."></updatecheck>`)
+	assert.Contains(t, request.BuildJSON(), `"packages":{"package":[{"fp":"1.abc"}]},"updatecheck":{"targetversionprefix":"4.7."}`)
+}
@@ -1,21 +1,81 @@
 package extension
 
 import (
+	"net/url"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Extension represents an extension which is both used in update checks
 // and responses.
 type Extension struct {
-	ID          string
-	Version     string
-	SHA256      string
-	Title       string
-	URL         string
-	Blacklisted bool
+	ID          string `json:"id"`
+	Version     string `json:"version"`
+	SHA256      string `json:"sha256"`
+	Title       string `json:"title"`
+	URL         string `json:"url,omitempty"`
+	Blacklisted bool   `json:"blacklisted"`
+	// Size is the size of the CRX in bytes, or 0 if unknown
+	Size int64 `json:"size,omitempty"`
+	// Type is TypeApp for Omaha apps other than extensions, which can have a PackageName other than
+	// the CRX name, see GetPackageName. Optional packages are sent as not required.
+	Type        string `json:"type,omitempty"`
+	PackageName string `json:"packageName,omitempty"`
+	Optional    bool   `json:"optional,omitempty"`
+	// ReleaseNotes is a short description of what changed in this version, or a URL to one,
+	// which is sent along with updates to it
+	ReleaseNotes string `json:"releaseNotes,omitempty"`
+	// Actions are run by clients when they install the package, see Action
+	Actions []Action `json:"actions,omitempty"`
+	// Dependencies are the IDs of extensions which must be kept up to date along with this one,
+	// like the base component a theme requires
+	Dependencies []string `json:"dependencies,omitempty"`
+	// Scheduled is the next version, which replaces this one once its PublishAt has passed.
+	// PublishAt is only set on scheduled versions.
+	Scheduled *Extension `json:"scheduled,omitempty"`
+	PublishAt *time.Time `json:"publishAt,omitempty"`
+	// Rules target clients with other packages than this one, or with no update, see Target
+	Rules []Rule `json:"rules,omitempty"`
+	// Locales are packages offered instead of this one to clients by their lang, see Localize
+	Locales map[string]Package `json:"locales,omitempty"`
+	// MinPhysMemory is the least memory in GB of clients offered this package, and clients with less are
+	// offered Lite instead, or no update if it isn't set, see FitMemory
+	MinPhysMemory int      `json:"minPhysMemory,omitempty"`
+	Lite          *Package `json:"lite,omitempty"`
+	// InstallData are blobs by index, like configuration or referral data, which clients get along with
+	// an update when they request the index with a data element
+	InstallData map[string]string `json:"installData,omitempty"`
+	// Channel, Platform, Arch, ProdVersion, Lang and PhysMemory are the prodchannel, os and other attributes
+	// of the client checking for updates which rules can target. PhysMemory is in GB, or 0 if unknown.
+	// They are only set on the extensions of requests, see Client for the codebase URLs of updates.
+	Channel     string `json:"-"`
+	Platform    string `json:"-"`
+	Arch        string `json:"-"`
+	ProdVersion string `json:"-"`
+	Lang        string `json:"-"`
+	PhysMemory  int    `json:"-"`
+	// PingOnly is true when the client only sent a ping or events for the extension rather than an update check,
+	// and UpdateDisabled when it checked but updates are disabled by policy. Ping is true when it sent a ping.
+	// These are only used for requests and their acknowledgements.
+	PingOnly       bool `json:"-"`
+	UpdateDisabled bool `json:"-"`
+	Ping           bool `json:"-"`
+	// DownloadPreference is the dlpref of the client checking for updates, like "cacheable"
+	DownloadPreference string `json:"-"`
+	// InstallDataIndexes are the indexes of the install data requested by the client checking for updates
+	InstallDataIndexes []string `json:"-"`
+	// URLs are the download URLs for this response in order of preference, replacing GetURL when set
+	URLs []string `json:"-"`
 }
 
+// DefaultCodebaseURLTemplate is the layout of Brave's release bucket.
+const DefaultCodebaseURLTemplate = "https://brave-core-ext.s3.brave.com/release/{id}/{package}"
+
+// CodebaseURLTemplate is the template for the URL clients download CRXs from.
+// It supports the {id}, {version}, {version_underscored}, {package}, {channel} and {platform} placeholders.
+var CodebaseURLTemplate = DefaultCodebaseURLTemplate
+
 // Extensions is type for a slice of Extension.
 type Extensions []Extension
 
@@ -60,6 +120,66 @@ func CompareVersions(version1 string, version2 string) int {
 	return 0
 }
 
+// GetCRXName returns the package file name used for the CRX of the specified extension version.
+func GetCRXName(version string) string {
+	return "extension_" + strings.Replace(version, ".", "_", -1) + ".crx"
+}
+
+// Client is what codebase URLs can depend on about the client an update is offered to:
+// its prodchannel and os, for the {channel} and {platform} placeholders
+type Client struct {
+	Channel  string
+	Platform string
+}
+
+// Client returns the Client checking for the extension of a request
+func (extension Extension) Client() Client {
+	return Client{Channel: extension.Channel, Platform: extension.Platform}
+}
+
+// CodebaseURLDependsOnClient returns true if CodebaseURLTemplate has the {channel} or {platform} placeholder,
+// so clients may download the same version from different URLs
+func CodebaseURLDependsOnClient() bool {
+	return strings.Contains(CodebaseURLTemplate, "{channel}") || strings.Contains(CodebaseURLTemplate, "{platform}")
+}
+
+// GetCodebaseURL returns the URL client downloads the package for the specified extension version from.
+// Packages checked for outside of an update check, like by link checks, use the zero Client.
+func GetCodebaseURL(extension Extension, client Client) string {
+	return strings.NewReplacer(
+		"{id}", url.PathEscape(extension.ID),
+		"{version}", url.PathEscape(extension.Version),
+		"{version_underscored}", url.PathEscape(strings.Replace(extension.Version, ".", "_", -1)),
+		"{package}", url.PathEscape(GetPackageName(extension)),
+		"{channel}", url.PathEscape(client.Channel),
+		"{platform}", url.PathEscape(client.Platform),
+	).Replace(CodebaseURLTemplate)
+}
+
+// GetURL returns the URL set for this response, such as a regional mirror or the codebase URL for the client
+// set by SetCodebaseURL, or otherwise the codebase URL for a client which sent no channel or platform.
+func (extension *Extension) GetURL() string {
+	if len(extension.URL) != 0 {
+		return extension.URL
+	}
+	return GetCodebaseURL(*extension, Client{})
+}
+
+// SetCodebaseURL sets the URL of this response to the codebase URL for client, unless it has one already
+func (extension *Extension) SetCodebaseURL(client Client) {
+	if len(extension.URL) == 0 {
+		extension.URL = codebaseURL(extension, client)
+	}
+}
+
+// GetURLs returns the download URLs for this response in order of preference
+func (extension *Extension) GetURLs() []string {
+	if len(extension.URLs) != 0 {
+		return extension.URLs
+	}
+	return []string{extension.GetURL()}
+}
+
 // LoadExtensionsIntoMap converts a slice of extensions into a map from ID to extension.Extension
 func LoadExtensionsIntoMap(extensions *Extensions) map[string]Extension {
 	m := make(map[string]Extension)
@@ -71,15 +191,74 @@ func LoadExtensionsIntoMap(extensions *Extensions) map[string]Extension {
 
 // FilterForUpdates filters `extensions` down to only the extensions that are being checked,
 // and only the ones that we have updates for.
+// Outdated dependencies of an update are also included ahead of it when the client listed them,
+// even if it only sent a ping for them, so bundles of extensions stay consistent.
 func (updateRequest *UpdateRequest) FilterForUpdates(allExtensionsMap *map[string]Extension) UpdateResponse {
 	filteredExtensions := UpdateResponse{}
-	for _, extensionBeingChecked := range *updateRequest {
+	included := map[string]bool{}
+	var include func(extensionBeingChecked Extension, dependency bool)
+	include = func(extensionBeingChecked Extension, dependency bool) {
+		if included[extensionBeingChecked.ID] || extensionBeingChecked.UpdateDisabled || (extensionBeingChecked.PingOnly && !dependency) {
+			return
+		}
 		foundExtension, ok := (*allExtensionsMap)[extensionBeingChecked.ID]
-		if ok {
-			if !foundExtension.Blacklisted && CompareVersions(extensionBeingChecked.Version, foundExtension.Version) < 0 {
-				filteredExtensions = append(filteredExtensions, foundExtension)
+		if !ok || foundExtension.Blacklisted {
+			return
+		}
+		foundExtension, ok = foundExtension.Target(extensionBeingChecked)
+		if !ok || CompareVersions(extensionBeingChecked.Version, foundExtension.Version) >= 0 {
+			return
+		}
+		included[extensionBeingChecked.ID] = true
+		for _, id := range foundExtension.Dependencies {
+			if listed, ok := updateRequest.find(id); ok {
+				include(listed, true)
 			}
 		}
+		foundExtension.DownloadPreference = extensionBeingChecked.DownloadPreference
+		foundExtension.InstallDataIndexes = extensionBeingChecked.InstallDataIndexes
+		filteredExtensions = append(filteredExtensions, foundExtension)
+	}
+	for _, extensionBeingChecked := range *updateRequest {
+		include(extensionBeingChecked, false)
 	}
 	return filteredExtensions
 }
+
+// Client returns the Client sending the request, whose attributes are set on each of its extensions
+func (updateRequest *UpdateRequest) Client() Client {
+	if len(*updateRequest) == 0 {
+		return Client{}
+	}
+	return (*updateRequest)[0].Client()
+}
+
+// find returns the extension with id listed in the request
+func (updateRequest *UpdateRequest) find(id string) (Extension, bool) {
+	for _, extensionBeingChecked := range *updateRequest {
+		if extensionBeingChecked.ID == id {
+			return extensionBeingChecked, true
+		}
+	}
+	return Extension{}, false
+}
+
+// Acknowledgements returns the known extensions which only sent a ping or have updates disabled,
+// so their pings can be acknowledged without offering an update.
+func (updateRequest *UpdateRequest) Acknowledgements(allExtensionsMap *map[string]Extension) UpdateResponse {
+	acknowledgements := UpdateResponse{}
+	for _, extensionBeingChecked := range *updateRequest {
+		if _, ok := (*allExtensionsMap)[extensionBeingChecked.ID]; !ok {
+			continue
+		}
+		if extensionBeingChecked.PingOnly || extensionBeingChecked.UpdateDisabled {
+			acknowledgements = append(acknowledgements, Extension{
+				ID:             extensionBeingChecked.ID,
+				PingOnly:       extensionBeingChecked.PingOnly,
+				UpdateDisabled: extensionBeingChecked.UpdateDisabled,
+				Ping:           extensionBeingChecked.Ping,
+			})
+		}
+	}
+	return acknowledgements
+}
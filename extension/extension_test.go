@@ -78,4 +78,99 @@ func TestFilterForUpdates(t *testing.T) {
 	}
 	check = outdatedExtensionCheck.FilterForUpdates(&allExtensionsBlacklistedMap)
 	assert.Equal(t, 0, len(check))
+
+	// Outdated extensions which only sent a ping or have updates disabled don't get updates
+	pingOnlyCheck := olderExtensionCheck1
+	pingOnlyCheck.PingOnly = true
+	updateDisabledCheck := olderExtensionCheck2
+	updateDisabledCheck.UpdateDisabled = true
+	updateRequest = UpdateRequest{pingOnlyCheck, updateDisabledCheck}
+	check = updateRequest.FilterForUpdates(&testExtensionsMap)
+	assert.Equal(t, 0, len(check))
+}
+
+func TestFilterForUpdatesDependencies(t *testing.T) {
+	allExtensionsMap := LoadExtensionsIntoMap(&OfferedExtensions)
+	lightThemeExtension, ok := allExtensionsMap["ldimlcelhnjgpjjemdjokpgeeikdinbm"]
+	assert.True(t, ok)
+	darkThemeExtension, ok := allExtensionsMap["bfdgpgibhagkpdlnjonhkabjoijopoge"]
+	assert.True(t, ok)
+	// The dark theme requires the light theme
+	darkThemeExtension.Dependencies = []string{lightThemeExtension.ID}
+	testExtensions := Extensions{lightThemeExtension, darkThemeExtension}
+	testExtensionsMap := LoadExtensionsIntoMap(&testExtensions)
+
+	// An outdated dependency the client only pinged for is updated ahead of the extension requiring it
+	darkThemeCheck := Extension{ID: darkThemeExtension.ID, Version: "0.1.0"}
+	lightThemePing := Extension{ID: lightThemeExtension.ID, Version: "0.1.0", PingOnly: true, Ping: true}
+	updateRequest := UpdateRequest{darkThemeCheck, lightThemePing}
+	check := updateRequest.FilterForUpdates(&testExtensionsMap)
+	assert.Equal(t, 2, len(check))
+	assert.Equal(t, lightThemeExtension.ID, check[0].ID)
+	assert.Equal(t, darkThemeExtension.ID, check[1].ID)
+
+	// Dependencies are only included once
+	lightThemeCheck := Extension{ID: lightThemeExtension.ID, Version: "0.1.0"}
+	updateRequest = UpdateRequest{lightThemeCheck, darkThemeCheck}
+	check = updateRequest.FilterForUpdates(&testExtensionsMap)
+	assert.Equal(t, 2, len(check))
+	assert.Equal(t, lightThemeExtension.ID, check[0].ID)
+	assert.Equal(t, darkThemeExtension.ID, check[1].ID)
+
+	// Up to date dependencies, ones with updates disabled and ones the client didn't list aren't included
+	upToDatePing := Extension{ID: lightThemeExtension.ID, Version: "1.0.0", PingOnly: true}
+	disabledCheck := Extension{ID: lightThemeExtension.ID, Version: "0.1.0", UpdateDisabled: true}
+	for _, updateRequest := range []UpdateRequest{{darkThemeCheck, upToDatePing}, {darkThemeCheck, disabledCheck}, {darkThemeCheck}} {
+		check = updateRequest.FilterForUpdates(&testExtensionsMap)
+		assert.Equal(t, 1, len(check))
+		assert.Equal(t, darkThemeExtension.ID, check[0].ID)
+	}
+}
+
+func TestAcknowledgements(t *testing.T) {
+	allExtensionsMap := LoadExtensionsIntoMap(&OfferedExtensions)
+	lightThemeExtension, ok := allExtensionsMap["ldimlcelhnjgpjjemdjokpgeeikdinbm"]
+	assert.True(t, ok)
+	darkThemeExtension, ok := allExtensionsMap["bfdgpgibhagkpdlnjonhkabjoijopoge"]
+	assert.True(t, ok)
+
+	// Update checks aren't acknowledged
+	updateRequest := UpdateRequest{lightThemeExtension}
+	assert.Equal(t, 0, len(updateRequest.Acknowledgements(&allExtensionsMap)))
+
+	// Pings and disabled update checks of known extensions are acknowledged without their details
+	pingOnlyCheck := Extension{ID: lightThemeExtension.ID, Version: "0.1.0", PingOnly: true, Ping: true}
+	updateDisabledCheck := Extension{ID: darkThemeExtension.ID, Version: "0.1.0", UpdateDisabled: true}
+	unknownCheck := Extension{ID: "aomjjhallfgjeglblehebfpbcfeobpgk", Version: "0.1.0", PingOnly: true, Ping: true}
+	updateRequest = UpdateRequest{pingOnlyCheck, updateDisabledCheck, unknownCheck}
+	acknowledgements := updateRequest.Acknowledgements(&allExtensionsMap)
+	assert.Equal(t, UpdateResponse{
+		{ID: lightThemeExtension.ID, PingOnly: true, Ping: true},
+		{ID: darkThemeExtension.ID, UpdateDisabled: true},
+	}, acknowledgements)
+}
+
+func TestGetCodebaseURL(t *testing.T) {
+	extension := Extension{
+		ID:      "ldimlcelhnjgpjjemdjokpgeeikdinbm",
+		Version: "1.0.2",
+	}
+	client := Client{Channel: "beta", Platform: "mac"}
+	assert.Equal(t, "https://brave-core-ext.s3.brave.com/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/extension_1_0_2.crx", GetCodebaseURL(extension, client))
+
+	defer func() {
+		CodebaseURLTemplate = DefaultCodebaseURLTemplate
+	}()
+	CodebaseURLTemplate = "https://cdn.example.com/{channel}/{platform}/{id}/{version}.crx"
+	assert.Equal(t, "https://cdn.example.com/beta/mac/ldimlcelhnjgpjjemdjokpgeeikdinbm/1.0.2.crx", GetCodebaseURL(extension, client))
+	assert.Equal(t, "https://cdn.example.com///ldimlcelhnjgpjjemdjokpgeeikdinbm/1.0.2.crx", extension.GetURL())
+	// Responses get the codebase URL for the client checking
+	response := extension
+	response.SetCodebaseURL(client)
+	assert.Equal(t, "https://cdn.example.com/beta/mac/ldimlcelhnjgpjjemdjokpgeeikdinbm/1.0.2.crx", response.GetURL())
+	response.SetCodebaseURL(Client{Channel: "stable", Platform: "win"})
+	assert.Equal(t, "https://cdn.example.com/beta/mac/ldimlcelhnjgpjjemdjokpgeeikdinbm/1.0.2.crx", response.GetURL())
+	// The previous default layout is the same as the current one for extensions
+	CodebaseURLTemplate = "https://brave-core-ext.s3.brave.com/release/{id}/extension_{version_underscored}.crx"
+	assert.Equal(t, "https://brave-core-ext.s3.brave.com/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/extension_1_0_2.crx", GetCodebaseURL(extension, client))
 }
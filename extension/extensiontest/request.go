@@ -0,0 +1,372 @@
+package extensiontest
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"strconv"
+)
+
+// Request builds an update check for any set of apps, in the XML protocol 3 or the JSON protocol 4:
+//
+//	body := extensiontest.NewRequest().App(id, "1.0.0").Ping().OS("mac").BuildXML()
+//
+// App starts a new app, and the methods describing an app, like Ping, Event, FP and TargetVersionPrefix, apply to the last one.
+// The browser attributes default to those of a stable macOS browser.
+type Request struct {
+	protocol    string
+	requestID   string
+	prodVersion string
+	channel     string
+	os          string
+	arch        string
+	lang        string
+	dlpref      string
+	physMemory  int
+	apps        []*requestApp
+}
+
+type requestApp struct {
+	id                  string
+	version             string
+	installSource       string
+	updateCheck         bool
+	updateDisabled      bool
+	targetVersionPrefix string
+	fp                  string
+	ping                *Ping
+	events              []Event
+}
+
+// Ping is the ping of an app, with the attributes browsers send. Empty attributes are left out.
+type Ping struct {
+	Active        string
+	RollCallDays  string
+	ActiveDays    string
+	PingFreshness string
+}
+
+// Event is an event of an app, like the result of an update. Codes which are 0 are left out.
+type Event struct {
+	Type            int
+	Result          int
+	ErrorCode       int
+	PreviousVersion string
+	NextVersion     string
+}
+
+// Event types and results sent by browsers
+const (
+	EventTypeInstall   = 2
+	EventTypeUpdate    = 3
+	EventTypeUninstall = 4
+	EventResultError   = 0
+	EventResultSuccess = 1
+)
+
+// NewRequest creates an update check without apps
+func NewRequest() *Request {
+	return &Request{
+		requestID:   "{b4f77b70-af29-462b-a637-8a3e4be5ecd9}",
+		prodVersion: "53.0.2785.116",
+		channel:     "stable",
+		os:          "mac",
+		arch:        "x64",
+	}
+}
+
+// Protocol sets the protocol version, 3.1 for XML and 4.0 for JSON by default
+func (request *Request) Protocol(protocol string) *Request {
+	request.protocol = protocol
+	return request
+}
+
+// RequestID sets the ID of the request
+func (request *Request) RequestID(id string) *Request {
+	request.requestID = id
+	return request
+}
+
+// ProdVersion sets the version of the browser
+func (request *Request) ProdVersion(version string) *Request {
+	request.prodVersion = version
+	return request
+}
+
+// Channel sets the release channel of the browser, like stable or beta
+func (request *Request) Channel(channel string) *Request {
+	request.channel = channel
+	return request
+}
+
+// OS sets the platform of the browser, like mac, win or linux
+func (request *Request) OS(os string) *Request {
+	request.os = os
+	return request
+}
+
+// Arch sets the architecture of the browser, like x64 or arm64
+func (request *Request) Arch(arch string) *Request {
+	request.arch = arch
+	return request
+}
+
+// Lang sets the language of the browser
+func (request *Request) Lang(lang string) *Request {
+	request.lang = lang
+	return request
+}
+
+// DLPref sets the download preference of the client, like cacheable
+func (request *Request) DLPref(dlpref string) *Request {
+	request.dlpref = dlpref
+	return request
+}
+
+// PhysMemory sets the memory of the device in GB, sent in the hw element
+func (request *Request) PhysMemory(gb int) *Request {
+	request.physMemory = gb
+	return request
+}
+
+// App adds an app at version which asks for an update
+func (request *Request) App(id string, version string) *Request {
+	request.apps = append(request.apps, &requestApp{id: id, version: version, updateCheck: true})
+	return request
+}
+
+// last returns the app the app methods apply to
+func (request *Request) last() *requestApp {
+	if len(request.apps) == 0 {
+		panic("extensiontest: App must be called before the methods of an app")
+	}
+	return request.apps[len(request.apps)-1]
+}
+
+// InstallSource sets where the app was installed from, like ondemand or policy
+func (request *Request) InstallSource(source string) *Request {
+	request.last().installSource = source
+	return request
+}
+
+// NoUpdateCheck only sends the pings and events of the app, without asking for an update
+func (request *Request) NoUpdateCheck() *Request {
+	request.last().updateCheck = false
+	return request
+}
+
+// UpdateDisabled marks updates of the app as disabled by policy
+func (request *Request) UpdateDisabled() *Request {
+	request.last().updateDisabled = true
+	return request
+}
+
+// TargetVersionPrefix asks for the latest version of the app starting with prefix
+func (request *Request) TargetVersionPrefix(prefix string) *Request {
+	request.last().targetVersionPrefix = prefix
+	return request
+}
+
+// FP sets the fingerprint of the package of the app which is installed
+func (request *Request) FP(fp string) *Request {
+	request.last().fp = fp
+	return request
+}
+
+// Ping adds the ping of a first check, like browsers send after installing the app
+func (request *Request) Ping() *Request {
+	return request.PingWith(Ping{RollCallDays: "-2"})
+}
+
+// PingWith adds ping to the app
+func (request *Request) PingWith(ping Ping) *Request {
+	request.last().ping = &ping
+	return request
+}
+
+// Event adds an event to the app
+func (request *Request) Event(event Event) *Request {
+	app := request.last()
+	app.events = append(app.events, event)
+	return request
+}
+
+// code formats a non-zero code as an attribute value
+func code(value int) string {
+	if value == 0 {
+		return ""
+	}
+	return strconv.Itoa(value)
+}
+
+// BuildXML returns the request in the XML protocol 3
+func (request *Request) BuildXML() string {
+	type Package struct {
+		FP string `xml:"fp,attr"`
+	}
+	type UpdateCheck struct {
+		UpdateDisabled      string `xml:"updatedisabled,attr,omitempty"`
+		TargetVersionPrefix string `xml:"targetversionprefix,attr,omitempty"`
+	}
+	type XMLPing struct {
+		Active        string `xml:"active,attr,omitempty"`
+		RollCallDays  string `xml:"rd,attr,omitempty"`
+		ActiveDays    string `xml:"ad,attr,omitempty"`
+		PingFreshness string `xml:"ping_freshness,attr,omitempty"`
+	}
+	type XMLEvent struct {
+		Type            int    `xml:"eventtype,attr"`
+		Result          int    `xml:"eventresult,attr"`
+		ErrorCode       string `xml:"errorcode,attr,omitempty"`
+		PreviousVersion string `xml:"previousversion,attr,omitempty"`
+		NextVersion     string `xml:"nextversion,attr,omitempty"`
+	}
+	type App struct {
+		AppID         string       `xml:"appid,attr"`
+		Version       string       `xml:"version,attr"`
+		InstallSource string       `xml:"installsource,attr,omitempty"`
+		Packages      []Package    `xml:"packages>package,omitempty"`
+		UpdateCheck   *UpdateCheck `xml:"updatecheck"`
+		Ping          *XMLPing     `xml:"ping"`
+		Events        []XMLEvent   `xml:"event"`
+	}
+	type HW struct {
+		PhysMemory int `xml:"physmemory,attr"`
+	}
+	type Body struct {
+		XMLName     xml.Name `xml:"request"`
+		Protocol    string   `xml:"protocol,attr"`
+		RequestID   string   `xml:"requestid,attr,omitempty"`
+		ProdVersion string   `xml:"prodversion,attr,omitempty"`
+		Lang        string   `xml:"lang,attr,omitempty"`
+		ProdChannel string   `xml:"prodchannel,attr,omitempty"`
+		OS          string   `xml:"os,attr,omitempty"`
+		Arch        string   `xml:"arch,attr,omitempty"`
+		DLPref      string   `xml:"dlpref,attr,omitempty"`
+		HW          *HW      `xml:"hw"`
+		Apps        []App    `xml:"app"`
+	}
+	body := Body{
+		Protocol: request.protocol, RequestID: request.requestID, ProdVersion: request.prodVersion, Lang: request.lang,
+		ProdChannel: request.channel, OS: request.os, Arch: request.arch, DLPref: request.dlpref,
+	}
+	if len(body.Protocol) == 0 {
+		body.Protocol = "3.1"
+	}
+	if request.physMemory != 0 {
+		body.HW = &HW{PhysMemory: request.physMemory}
+	}
+	for _, app := range request.apps {
+		encoded := App{AppID: app.id, Version: app.version, InstallSource: app.installSource}
+		if len(app.fp) != 0 {
+			encoded.Packages = []Package{{FP: app.fp}}
+		}
+		if app.updateCheck {
+			encoded.UpdateCheck = &UpdateCheck{TargetVersionPrefix: app.targetVersionPrefix}
+			if app.updateDisabled {
+				encoded.UpdateCheck.UpdateDisabled = "true"
+			}
+		}
+		if ping := app.ping; ping != nil {
+			encoded.Ping = &XMLPing{Active: ping.Active, RollCallDays: ping.RollCallDays, ActiveDays: ping.ActiveDays, PingFreshness: ping.PingFreshness}
+		}
+		for _, event := range app.events {
+			encoded.Events = append(encoded.Events, XMLEvent{
+				Type: event.Type, Result: event.Result, ErrorCode: code(event.ErrorCode),
+				PreviousVersion: event.PreviousVersion, NextVersion: event.NextVersion,
+			})
+		}
+		body.Apps = append(body.Apps, encoded)
+	}
+	data, err := xml.Marshal(body)
+	if err != nil {
+		panic(err)
+	}
+	return xml.Header + string(data)
+}
+
+// BuildJSON returns the request in the JSON protocol 4
+func (request *Request) BuildJSON() string {
+	type Package struct {
+		FP string `json:"fp"`
+	}
+	type Packages struct {
+		Package []Package `json:"package"`
+	}
+	type UpdateCheck struct {
+		UpdateDisabled      bool   `json:"updatedisabled,omitempty"`
+		TargetVersionPrefix string `json:"targetversionprefix,omitempty"`
+	}
+	type JSONPing struct {
+		Active        string `json:"active,omitempty"`
+		RollCallDays  string `json:"rd,omitempty"`
+		ActiveDays    string `json:"ad,omitempty"`
+		PingFreshness string `json:"ping_freshness,omitempty"`
+	}
+	type JSONEvent struct {
+		Type            int    `json:"eventtype"`
+		Result          int    `json:"eventresult"`
+		ErrorCode       int    `json:"errorcode,omitempty"`
+		PreviousVersion string `json:"previousversion,omitempty"`
+		NextVersion     string `json:"nextversion,omitempty"`
+	}
+	type App struct {
+		AppID         string       `json:"appid"`
+		Version       string       `json:"version"`
+		InstallSource string       `json:"installsource,omitempty"`
+		Packages      *Packages    `json:"packages,omitempty"`
+		UpdateCheck   *UpdateCheck `json:"updatecheck,omitempty"`
+		Ping          *JSONPing    `json:"ping,omitempty"`
+		Events        []JSONEvent  `json:"event,omitempty"`
+	}
+	type HW struct {
+		PhysMemory int `json:"physmemory"`
+	}
+	type Body struct {
+		Protocol    string `json:"protocol"`
+		RequestID   string `json:"requestid,omitempty"`
+		ProdVersion string `json:"prodversion,omitempty"`
+		Lang        string `json:"lang,omitempty"`
+		ProdChannel string `json:"prodchannel,omitempty"`
+		OS          string `json:"@os,omitempty"`
+		Arch        string `json:"arch,omitempty"`
+		DLPref      string `json:"dlpref,omitempty"`
+		HW          *HW    `json:"hw,omitempty"`
+		Apps        []App  `json:"apps"`
+	}
+	body := Body{
+		Protocol: request.protocol, RequestID: request.requestID, ProdVersion: request.prodVersion, Lang: request.lang,
+		ProdChannel: request.channel, OS: request.os, Arch: request.arch, DLPref: request.dlpref, Apps: []App{},
+	}
+	if len(body.Protocol) == 0 {
+		body.Protocol = "4.0"
+	}
+	if request.physMemory != 0 {
+		body.HW = &HW{PhysMemory: request.physMemory}
+	}
+	for _, app := range request.apps {
+		encoded := App{AppID: app.id, Version: app.version, InstallSource: app.installSource}
+		if len(app.fp) != 0 {
+			encoded.Packages = &Packages{Package: []Package{{FP: app.fp}}}
+		}
+		if app.updateCheck {
+			encoded.UpdateCheck = &UpdateCheck{UpdateDisabled: app.updateDisabled, TargetVersionPrefix: app.targetVersionPrefix}
+		}
+		if ping := app.ping; ping != nil {
+			encoded.Ping = &JSONPing{Active: ping.Active, RollCallDays: ping.RollCallDays, ActiveDays: ping.ActiveDays, PingFreshness: ping.PingFreshness}
+		}
+		for _, event := range app.events {
+			encoded.Events = append(encoded.Events, JSONEvent{
+				Type: event.Type, Result: event.Result, ErrorCode: event.ErrorCode,
+				PreviousVersion: event.PreviousVersion, NextVersion: event.NextVersion,
+			})
+		}
+		body.Apps = append(body.Apps, encoded)
+	}
+	data, err := json.Marshal(struct {
+		Request Body `json:"request"`
+	}{body})
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
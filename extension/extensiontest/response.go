@@ -0,0 +1,268 @@
+package extensiontest
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// protocol4Prefix is the prefix of JSON protocol 4 responses, like extension.Protocol4Prefix without the newline
+const protocol4Prefix = ")]}'"
+
+// Response is an update response, parsed from any of the shapes the server answers in:
+// the XML protocol 3 response, the XML and JSON gupdate of GET checks, and the JSON protocol 4 response.
+type Response struct {
+	Protocol string
+	Apps     []ResponseApp
+}
+
+// ResponseApp is the answer for one app in a Response
+type ResponseApp struct {
+	ID     string
+	Status string
+	// UpdateStatus is the status of the update check, ok when an update is offered or like noupdate otherwise.
+	// It is empty when the app only had pings acknowledged.
+	UpdateStatus string
+	Version      string
+	SHA256       string
+	Size         int64
+	URLs         []string
+	// PingStatus is the status of the acknowledgement of the app's ping, if it had one
+	PingStatus string
+}
+
+// App returns the answer for the app with id
+func (response Response) App(id string) (ResponseApp, bool) {
+	for _, app := range response.Apps {
+		if app.ID == id {
+			return app, true
+		}
+	}
+	return ResponseApp{}, false
+}
+
+// ParseResponse parses an update response in any of the shapes the server answers in
+func ParseResponse(body []byte) (Response, error) {
+	trimmed := bytes.TrimSpace(body)
+	if bytes.HasPrefix(trimmed, []byte(protocol4Prefix)) || bytes.HasPrefix(trimmed, []byte("{")) {
+		return parseJSONResponse(bytes.TrimPrefix(trimmed, []byte(protocol4Prefix)))
+	}
+	return parseXMLResponse(trimmed)
+}
+
+func parseXMLResponse(body []byte) (Response, error) {
+	type UpdateCheck struct {
+		Status   string `xml:"status,attr"`
+		Codebase string `xml:"codebase,attr"`
+		Version  string `xml:"version,attr"`
+		SHA256   string `xml:"hash_sha256,attr"`
+		Size     int64  `xml:"size,attr"`
+		URLs     []struct {
+			Codebase string `xml:"codebase,attr"`
+		} `xml:"urls>url"`
+		Manifest *struct {
+			Version  string `xml:"version,attr"`
+			Packages []struct {
+				SHA256 string `xml:"hash_sha256,attr"`
+				Size   int64  `xml:"size,attr"`
+			} `xml:"packages>package"`
+		} `xml:"manifest"`
+	}
+	parsed := struct {
+		XMLName  xml.Name
+		Protocol string `xml:"protocol,attr"`
+		Apps     []struct {
+			AppID       string       `xml:"appid,attr"`
+			Status      string       `xml:"status,attr"`
+			UpdateCheck *UpdateCheck `xml:"updatecheck"`
+			Ping        *struct {
+				Status string `xml:"status,attr"`
+			} `xml:"ping"`
+		} `xml:"app"`
+	}{}
+	err := xml.Unmarshal(body, &parsed)
+	if err != nil {
+		return Response{}, fmt.Errorf("error parsing update response: %v", err)
+	}
+	if parsed.XMLName.Local != "response" && parsed.XMLName.Local != "gupdate" {
+		return Response{}, fmt.Errorf("update response is a %s element", parsed.XMLName.Local)
+	}
+	response := Response{Protocol: parsed.Protocol, Apps: []ResponseApp{}}
+	for _, app := range parsed.Apps {
+		answer := ResponseApp{ID: app.AppID, Status: app.Status}
+		if app.Ping != nil {
+			answer.PingStatus = app.Ping.Status
+		}
+		if updateCheck := app.UpdateCheck; updateCheck != nil {
+			answer.UpdateStatus = updateCheck.Status
+			// gupdate responses have the package in the updatecheck, protocol 3 in its manifest
+			answer.Version, answer.SHA256, answer.Size = updateCheck.Version, updateCheck.SHA256, updateCheck.Size
+			if len(updateCheck.Codebase) != 0 {
+				answer.URLs = append(answer.URLs, updateCheck.Codebase)
+			}
+			for _, url := range updateCheck.URLs {
+				answer.URLs = append(answer.URLs, url.Codebase)
+			}
+			if manifest := updateCheck.Manifest; manifest != nil {
+				answer.Version = manifest.Version
+				if len(manifest.Packages) != 0 {
+					answer.SHA256, answer.Size = manifest.Packages[0].SHA256, manifest.Packages[0].Size
+				}
+			}
+		}
+		response.Apps = append(response.Apps, answer)
+	}
+	return response, nil
+}
+
+func parseJSONResponse(body []byte) (Response, error) {
+	type Status struct {
+		Status string `json:"status"`
+	}
+	parsed := struct {
+		GUpdate *struct {
+			Protocol string `json:"protocol"`
+			Apps     []struct {
+				AppID       string `json:"appid"`
+				Status      string `json:"status"`
+				UpdateCheck struct {
+					Status   string `json:"status"`
+					Codebase string `json:"codebase"`
+					Version  string `json:"version"`
+					SHA256   string `json:"hash_sha256"`
+					Size     int64  `json:"size"`
+				} `json:"updatecheck"`
+			} `json:"app"`
+		} `json:"gupdate"`
+		Response *struct {
+			Protocol string `json:"protocol"`
+			Apps     []struct {
+				AppID       string  `json:"appid"`
+				Status      string  `json:"status"`
+				Ping        *Status `json:"ping"`
+				UpdateCheck *struct {
+					Status      string `json:"status"`
+					NextVersion string `json:"nextversion"`
+					Pipelines   []struct {
+						Operations []struct {
+							Type string `json:"type"`
+							Size int64  `json:"size"`
+							URLs []struct {
+								URL string `json:"url"`
+							} `json:"urls"`
+							Out *struct {
+								SHA256 string `json:"sha256"`
+							} `json:"out"`
+						} `json:"operations"`
+					} `json:"pipelines"`
+				} `json:"updatecheck"`
+			} `json:"apps"`
+		} `json:"response"`
+	}{}
+	err := json.Unmarshal(body, &parsed)
+	if err != nil {
+		return Response{}, fmt.Errorf("error parsing update response: %v", err)
+	}
+	response := Response{Apps: []ResponseApp{}}
+	switch {
+	case parsed.GUpdate != nil:
+		response.Protocol = parsed.GUpdate.Protocol
+		for _, app := range parsed.GUpdate.Apps {
+			updateCheck := app.UpdateCheck
+			answer := ResponseApp{
+				ID: app.AppID, Status: app.Status, UpdateStatus: updateCheck.Status,
+				Version: updateCheck.Version, SHA256: updateCheck.SHA256, Size: updateCheck.Size,
+			}
+			if len(updateCheck.Codebase) != 0 {
+				answer.URLs = []string{updateCheck.Codebase}
+			}
+			response.Apps = append(response.Apps, answer)
+		}
+	case parsed.Response != nil:
+		response.Protocol = parsed.Response.Protocol
+		for _, app := range parsed.Response.Apps {
+			answer := ResponseApp{ID: app.AppID, Status: app.Status}
+			if app.Ping != nil {
+				answer.PingStatus = app.Ping.Status
+			}
+			if updateCheck := app.UpdateCheck; updateCheck != nil {
+				answer.UpdateStatus, answer.Version = updateCheck.Status, updateCheck.NextVersion
+				// The download of the first pipeline is the full package
+				if len(updateCheck.Pipelines) != 0 {
+					for _, operation := range updateCheck.Pipelines[0].Operations {
+						if operation.Type != "download" {
+							continue
+						}
+						answer.Size = operation.Size
+						if operation.Out != nil {
+							answer.SHA256 = operation.Out.SHA256
+						}
+						for _, url := range operation.URLs {
+							answer.URLs = append(answer.URLs, url.URL)
+						}
+						break
+					}
+				}
+			}
+			response.Apps = append(response.Apps, answer)
+		}
+	default:
+		return Response{}, errors.New("update response has neither a gupdate nor a response object")
+	}
+	return response, nil
+}
+
+// parseForAssert parses body, failing t if it can't be
+func parseForAssert(t testing.TB, body string) (Response, bool) {
+	response, err := ParseResponse([]byte(body))
+	if err != nil {
+		t.Errorf("%v in:\n%s", err, body)
+		return Response{}, false
+	}
+	return response, true
+}
+
+// AssertUpdateOffered checks that the update response body offers version of the app with id, whose package has sha256.
+// It returns true if it does, failing t otherwise.
+func AssertUpdateOffered(t testing.TB, body string, id string, version string, sha256 string) bool {
+	t.Helper()
+	response, ok := parseForAssert(t, body)
+	if !ok {
+		return false
+	}
+	app, ok := response.App(id)
+	switch {
+	case !ok:
+		t.Errorf("update response has no answer for %s:\n%s", id, body)
+	case app.UpdateStatus != "ok":
+		t.Errorf("update response has status %q rather than ok for %s:\n%s", app.UpdateStatus, id, body)
+	case app.Version != version:
+		t.Errorf("update response offers version %s rather than %s of %s", app.Version, version, id)
+	case app.SHA256 != sha256:
+		t.Errorf("update response offers SHA256 %s rather than %s for %s", app.SHA256, sha256, id)
+	case len(app.URLs) == 0:
+		t.Errorf("update response has no download URLs for %s:\n%s", id, body)
+	default:
+		return true
+	}
+	return false
+}
+
+// AssertNoUpdate checks that the update response body doesn't offer an update of the app with id,
+// either because it has no answer for it or because its update check status isn't ok.
+// It returns true if it doesn't, failing t otherwise.
+func AssertNoUpdate(t testing.TB, body string, id string) bool {
+	t.Helper()
+	response, ok := parseForAssert(t, body)
+	if !ok {
+		return false
+	}
+	if app, ok := response.App(id); ok && app.UpdateStatus == "ok" {
+		t.Errorf("update response offers version %s of %s", app.Version, id)
+		return false
+	}
+	return true
+}
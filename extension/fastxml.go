@@ -0,0 +1,319 @@
+package extension
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// The AppendXML methods encode update responses into exactly the bytes their MarshalXML methods do,
+// without reflection and without allocating once their buffer has grown to fit, for the update check hot path.
+// The fragments which only depend on an extension version, its manifest and codebase URL, are built once and cached.
+
+// fragmentCacheSize bounds the number of cached fragments of each kind, which are all dropped when it is reached
+// so versions which are no longer offered don't accumulate
+const fragmentCacheSize = 4096
+
+// manifestKey identifies the manifest fragment of an extension version
+type manifestKey struct {
+	Version     string
+	SHA256      string
+	Size        int64
+	PackageName string
+	Optional    bool
+}
+
+// codebaseKey identifies the codebase URL of an extension version for a client
+type codebaseKey struct {
+	Template    string
+	ID          string
+	Version     string
+	PackageName string
+	Channel     string
+	Platform    string
+}
+
+var (
+	fragmentMutex     sync.RWMutex
+	manifestFragments = map[manifestKey][]byte{}
+	codebaseURLs      = map[codebaseKey]string{}
+)
+
+// manifestFragment returns the indented manifest element of the protocol 3 response for extension,
+// up to the actions and closing tag which follow its packages
+func manifestFragment(extension *Extension) []byte {
+	key := manifestKey{Version: extension.Version, SHA256: extension.SHA256, Size: extension.Size, PackageName: extension.PackageName, Optional: extension.Optional}
+	fragmentMutex.RLock()
+	fragment, ok := manifestFragments[key]
+	fragmentMutex.RUnlock()
+	if ok {
+		return fragment
+	}
+	fragment = append(fragment, "\n            <manifest version=\""...)
+	fragment = appendEscaped(fragment, extension.Version)
+	fragment = append(fragment, "\">\n                <packages>\n                    <package name=\""...)
+	fragment = appendEscaped(fragment, GetPackageName(*extension))
+	fragment = append(fragment, "\" hash_sha256=\""...)
+	fragment = appendEscaped(fragment, extension.SHA256)
+	fragment = appendSize(fragment, extension.Size)
+	if extension.Optional {
+		fragment = append(fragment, " required=\"false\"></package>\n                </packages>"...)
+	} else {
+		fragment = append(fragment, " required=\"true\"></package>\n                </packages>"...)
+	}
+	fragmentMutex.Lock()
+	if len(manifestFragments) >= fragmentCacheSize {
+		manifestFragments = map[manifestKey][]byte{}
+	}
+	manifestFragments[key] = fragment
+	fragmentMutex.Unlock()
+	return fragment
+}
+
+// codebaseURL returns the URL set for extension like GetURL, or its codebase URL for client,
+// caching codebase URLs
+func codebaseURL(extension *Extension, client Client) string {
+	if len(extension.URL) != 0 {
+		return extension.URL
+	}
+	key := codebaseKey{Template: CodebaseURLTemplate, ID: extension.ID, Version: extension.Version, PackageName: extension.PackageName}
+	// Clients on every channel and platform share the URL unless the template depends on them
+	if strings.Contains(key.Template, "{channel}") {
+		key.Channel = client.Channel
+	}
+	if strings.Contains(key.Template, "{platform}") {
+		key.Platform = client.Platform
+	}
+	fragmentMutex.RLock()
+	url, ok := codebaseURLs[key]
+	fragmentMutex.RUnlock()
+	if ok {
+		return url
+	}
+	url = GetCodebaseURL(*extension, client)
+	fragmentMutex.Lock()
+	if len(codebaseURLs) >= fragmentCacheSize {
+		codebaseURLs = map[codebaseKey]string{}
+	}
+	codebaseURLs[key] = url
+	fragmentMutex.Unlock()
+	return url
+}
+
+// AppendXML appends the response XML of the extension list to dst, like MarshalXML
+func (updateResponse *UpdateResponse) AppendXML(dst []byte) []byte {
+	return updateResponse.appendXML(dst, DefaultProtocol)
+}
+
+// AppendXML appends the response XML of the extension list to dst with the protocol version of the response,
+// like MarshalXML
+func (protocolResponse *ProtocolUpdateResponse) AppendXML(dst []byte) []byte {
+	return protocolResponse.Extensions.appendXML(dst, protocolResponse.Protocol)
+}
+
+func (updateResponse *UpdateResponse) appendXML(dst []byte, protocol string) []byte {
+	dst = append(dst, `<response protocol="`...)
+	dst = appendEscaped(dst, protocol)
+	dst = append(dst, `" server="prod">`...)
+	for i := range *updateResponse {
+		extension := &(*updateResponse)[i]
+		dst = append(dst, "\n    <app appid=\""...)
+		dst = appendEscaped(dst, extension.ID)
+		dst = append(dst, `">`...)
+		if extension.PingOnly || extension.UpdateDisabled {
+			if !extension.Ping && !extension.UpdateDisabled {
+				dst = append(dst, "</app>"...)
+				continue
+			}
+			if extension.UpdateDisabled {
+				dst = append(dst, "\n        <updatecheck status=\"noupdate\"></updatecheck>"...)
+			}
+			if extension.Ping {
+				dst = append(dst, "\n        <ping status=\"ok\"></ping>"...)
+			}
+			dst = append(dst, "\n    </app>"...)
+			continue
+		}
+		dst = append(dst, "\n        <updatecheck status=\"ok\">\n            <urls>"...)
+		if len(extension.URLs) != 0 {
+			for _, url := range extension.URLs {
+				dst = appendURL(dst, url)
+			}
+		} else {
+			dst = appendURL(dst, codebaseURL(extension, Client{}))
+		}
+		dst = append(dst, "\n            </urls>"...)
+		dst = append(dst, manifestFragment(extension)...)
+		if len(extension.Actions) != 0 {
+			dst = append(dst, "\n                <actions>"...)
+			for _, action := range extension.Actions {
+				dst = appendAction(dst, action)
+			}
+			dst = append(dst, "\n                </actions>"...)
+		}
+		dst = append(dst, "\n            </manifest>"...)
+		dst = append(dst, "\n        </updatecheck>"...)
+		for _, index := range extension.InstallDataIndexes {
+			text, status := extension.installDataFor(index)
+			dst = appendData(dst, InstallDataName, index, status, text)
+		}
+		if len(extension.ReleaseNotes) != 0 {
+			dst = appendData(dst, ReleaseNotesDataName, "", DataStatusOK, extension.ReleaseNotes)
+		}
+		dst = append(dst, "\n    </app>"...)
+	}
+	if len(*updateResponse) != 0 {
+		dst = append(dst, '\n')
+	}
+	return append(dst, "</response>"...)
+}
+
+// appendURL appends the url element of a protocol 3 response
+func appendURL(dst []byte, url string) []byte {
+	dst = append(dst, "\n                <url codebase=\""...)
+	dst = appendEscaped(dst, url)
+	return append(dst, "\"></url>"...)
+}
+
+// appendAction appends an action element of a protocol 3 response, without the optional attributes which are empty
+func appendAction(dst []byte, action Action) []byte {
+	dst = append(dst, "\n                    <action event=\""...)
+	dst = appendEscaped(dst, action.Event)
+	dst = appendOptional(dst, "run", action.Run)
+	dst = appendOptional(dst, "arguments", action.Arguments)
+	dst = appendOptional(dst, "onsuccess", action.OnSuccess)
+	dst = appendOptional(dst, "successurl", action.SuccessURL)
+	return append(dst, "\"></action>"...)
+}
+
+// appendOptional appends the attribute name with value after the value of the previous one, unless value is empty
+func appendOptional(dst []byte, name string, value string) []byte {
+	if len(value) == 0 {
+		return dst
+	}
+	dst = append(dst, "\" "...)
+	dst = append(dst, name...)
+	dst = append(dst, "=\""...)
+	return appendEscaped(dst, value)
+}
+
+// appendData appends a data element of a protocol 3 response, without the index attribute if it is empty
+func appendData(dst []byte, name string, index string, status string, text string) []byte {
+	dst = append(dst, "\n        <data name=\""...)
+	dst = append(dst, name...)
+	dst = appendOptional(dst, "index", index)
+	dst = append(dst, "\" status=\""...)
+	dst = append(dst, status...)
+	dst = append(dst, "\">"...)
+	dst = appendEscaped(dst, text)
+	return append(dst, "</data>"...)
+}
+
+// AppendXML appends the gupdate response XML of the extension list to dst, like MarshalXML
+func (updateResponse *WebStoreUpdateResponse) AppendXML(dst []byte) []byte {
+	return updateResponse.appendXML(dst, DefaultProtocol, -1)
+}
+
+// AppendXML appends the protocol 2.0 gupdate response XML of the extension list to dst, like MarshalXML
+func (protocol2Response *WebStoreProtocol2Response) AppendXML(dst []byte) []byte {
+	return protocol2Response.Extensions.appendXML(dst, "2.0", protocol2Response.ElapsedSeconds)
+}
+
+// appendXML appends the gupdate response declaring protocol, with the update2 namespace and
+// a daystart element unless elapsedSeconds is negative
+func (updateResponse *WebStoreUpdateResponse) appendXML(dst []byte, protocol string, elapsedSeconds int) []byte {
+	dst = append(dst, "<gupdate"...)
+	if elapsedSeconds >= 0 {
+		dst = append(dst, ` xmlns="http://www.google.com/update2/response"`...)
+	}
+	dst = append(dst, ` protocol="`...)
+	dst = appendEscaped(dst, protocol)
+	dst = append(dst, `" server="prod">`...)
+	if elapsedSeconds >= 0 {
+		dst = append(dst, "\n    <daystart elapsed_seconds=\""...)
+		dst = strconv.AppendInt(dst, int64(elapsedSeconds), 10)
+		dst = append(dst, "\"></daystart>"...)
+	}
+	for i := range *updateResponse {
+		extension := &(*updateResponse)[i]
+		dst = append(dst, "\n    <app appid=\""...)
+		dst = appendEscaped(dst, extension.ID)
+		dst = append(dst, "\" status=\"ok\">\n        <updatecheck status=\"ok\" codebase=\""...)
+		dst = appendEscaped(dst, codebaseURL(extension, Client{}))
+		dst = append(dst, `" version="`...)
+		dst = appendEscaped(dst, extension.Version)
+		dst = append(dst, `" hash_sha256="`...)
+		dst = appendEscaped(dst, extension.SHA256)
+		dst = appendSize(dst, extension.Size)
+		dst = append(dst, "></updatecheck>\n    </app>"...)
+	}
+	if len(*updateResponse) != 0 || elapsedSeconds >= 0 {
+		dst = append(dst, '\n')
+	}
+	return append(dst, "</gupdate>"...)
+}
+
+// appendSize appends the size attribute, which is omitted when the size is unknown
+func appendSize(dst []byte, size int64) []byte {
+	if size == 0 {
+		return append(dst, '"')
+	}
+	dst = append(dst, `" size="`...)
+	dst = strconv.AppendInt(dst, size, 10)
+	return append(dst, '"')
+}
+
+// appendEscaped appends s escaped as an attribute value, the same way encoding/xml escapes them
+func appendEscaped(dst []byte, s string) []byte {
+	if !strings.ContainsAny(s, "\"'&<>\t\n\r") && isPlain(s) {
+		return append(dst, s...)
+	}
+	for i := 0; i < len(s); {
+		r, width := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == '"':
+			dst = append(dst, "&#34;"...)
+		case r == '\'':
+			dst = append(dst, "&#39;"...)
+		case r == '&':
+			dst = append(dst, "&amp;"...)
+		case r == '<':
+			dst = append(dst, "&lt;"...)
+		case r == '>':
+			dst = append(dst, "&gt;"...)
+		case r == '\t':
+			dst = append(dst, "&#x9;"...)
+		case r == '\n':
+			dst = append(dst, "&#xA;"...)
+		case r == '\r':
+			dst = append(dst, "&#xD;"...)
+		case !isInCharacterRange(r) || (r == utf8.RuneError && width == 1):
+			dst = append(dst, "\uFFFD"...)
+		default:
+			dst = append(dst, s[i:i+width]...)
+		}
+		i += width
+	}
+	return dst
+}
+
+// isPlain returns true if s is printable ASCII, which needs no escaping other than of the characters handled above
+func isPlain(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// isInCharacterRange returns true if r may appear in an XML document, as in encoding/xml
+func isInCharacterRange(r rune) bool {
+	return r == 0x09 ||
+		r == 0x0A ||
+		r == 0x0D ||
+		r >= 0x20 && r <= 0xD7FF ||
+		r >= 0xE000 && r <= 0xFFFD ||
+		r >= 0x10000 && r <= 0x10FFFF
+}
@@ -0,0 +1,131 @@
+package extension
+
+import (
+	"encoding/xml"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// benchmarkResponse is like the response to a browser checking its components, with a few updates and acknowledgements
+func benchmarkResponse() UpdateResponse {
+	allExtensionsMap := LoadExtensionsIntoMap(&OfferedExtensions)
+	response := UpdateResponse{}
+	for _, id := range []string{"bfdgpgibhagkpdlnjonhkabjoijopoge", "ldimlcelhnjgpjjemdjokpgeeikdinbm", "cffkpbalmllkdoenhmdmpbkajipdjfam"} {
+		extension := allExtensionsMap[id]
+		extension.Size = 1024
+		extension.Channel = "stable"
+		extension.Platform = "linux"
+		response = append(response, extension)
+	}
+	response[1].URLs = []string{"https://mirror.example.com/a.crx", "https://brave-core-ext.s3.brave.com/a.crx"}
+	return append(response,
+		Extension{ID: "ghnjmapememheddlfgmklijahiofgkea", PingOnly: true, Ping: true},
+		Extension{ID: "fnpjliiiicbbpkfihnggnmobcpppjhlj", UpdateDisabled: true, Ping: true},
+	)
+}
+
+func TestAppendXML(t *testing.T) {
+	escaped := Extension{
+		ID:      `a"b'c&d<e>f`,
+		Version: "1.0.0",
+		SHA256:  "tab\tnewline\nreturn\rinvalid\x01\xffé",
+		URL:     "https://example.com/?a=1&b=2",
+	}
+	installData := escaped
+	installData.InstallData = map[string]string{"config": "{\"a\": 1}\n<b>&'c'</b>"}
+	installData.InstallDataIndexes = []string{"config", "missing\"", ""}
+	installData.ReleaseNotes = "Fixes <b> & \"more\""
+	installData.Actions = []Action{
+		{Event: ActionEventInstall, Run: "setup.exe", Arguments: `--install --path="C:\Program Files"`},
+		{Event: ActionEventPostinstall, OnSuccess: "exitsilentlyonlaunchcmd"},
+	}
+	app := Extension{ID: "{8A69D345-D564-463C-AFF1-A69D9E530F96}", Version: "2.0.0", SHA256: "app", Type: TypeApp, PackageName: "setup_{version}.exe", Optional: true}
+	responses := []UpdateResponse{
+		{},
+		benchmarkResponse(),
+		{escaped},
+		{installData},
+		{app, escaped},
+		{Extension{ID: "x", PingOnly: true}, Extension{ID: "y", PingOnly: true, UpdateDisabled: true}},
+	}
+	for _, response := range responses {
+		expected, err := xml.Marshal(&response)
+		assert.Nil(t, err)
+		assert.Equal(t, string(expected), string(response.AppendXML(nil)))
+		// Fragments are cached, so the second response must be the same as the first
+		assert.Equal(t, string(expected), string(response.AppendXML([]byte{})))
+
+		protocolResponse := ProtocolUpdateResponse{Protocol: "3.0", Extensions: response}
+		expected, err = xml.Marshal(&protocolResponse)
+		assert.Nil(t, err)
+		assert.Equal(t, string(expected), string(protocolResponse.AppendXML(nil)))
+
+		webStoreResponse := WebStoreUpdateResponse(response)
+		expected, err = xml.Marshal(&webStoreResponse)
+		assert.Nil(t, err)
+		assert.Equal(t, string(expected), string(webStoreResponse.AppendXML(nil)))
+
+		protocol2Response := WebStoreProtocol2Response{ElapsedSeconds: 3600, Extensions: webStoreResponse}
+		expected, err = xml.Marshal(&protocol2Response)
+		assert.Nil(t, err)
+		assert.Equal(t, string(expected), string(protocol2Response.AppendXML(nil)))
+	}
+
+	// Appending keeps what is already in the buffer
+	response := UpdateResponse{}
+	assert.Equal(t, `prefix<response protocol="3.1" server="prod"></response>`, string(response.AppendXML([]byte("prefix"))))
+}
+
+func TestAppendXMLAllocations(t *testing.T) {
+	response := benchmarkResponse()
+	webStoreResponse := WebStoreUpdateResponse(response[:3])
+	buffer := response.AppendXML(nil)
+	allocs := testing.AllocsPerRun(100, func() {
+		buffer = response.AppendXML(buffer[:0])
+		buffer = webStoreResponse.AppendXML(buffer[:0])
+	})
+	assert.Equal(t, 0.0, allocs)
+}
+
+// BenchmarkMarshalXML is the reflection based encoding, to compare with BenchmarkAppendXML:
+//
+//	go test ./extension -run '^$' -bench XML -benchmem
+func BenchmarkMarshalXML(b *testing.B) {
+	response := benchmarkResponse()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, err := xml.Marshal(&response)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAppendXML(b *testing.B) {
+	response := benchmarkResponse()
+	var buffer []byte
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buffer = response.AppendXML(buffer[:0])
+	}
+}
+
+func BenchmarkWebStoreMarshalXML(b *testing.B) {
+	response := WebStoreUpdateResponse(benchmarkResponse()[:3])
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, err := xml.Marshal(&response)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkWebStoreAppendXML(b *testing.B) {
+	response := WebStoreUpdateResponse(benchmarkResponse()[:3])
+	var buffer []byte
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buffer = response.AppendXML(buffer[:0])
+	}
+}
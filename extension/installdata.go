@@ -0,0 +1,23 @@
+package extension
+
+// Names of the data elements of update responses. Clients request install data by index,
+// and the release notes of a version are sent along with every update to it.
+const (
+	InstallDataName      = "install"
+	ReleaseNotesDataName = "releasenotes"
+)
+
+// Statuses of data elements
+const (
+	DataStatusOK     = "ok"
+	DataStatusNoData = "error-nodata"
+)
+
+// installDataFor returns the install data of the extension with index, and the status of the data element with it
+func (extension *Extension) installDataFor(index string) (string, string) {
+	data, ok := extension.InstallData[index]
+	if !ok {
+		return "", DataStatusNoData
+	}
+	return data, DataStatusOK
+}
@@ -0,0 +1,44 @@
+package extension
+
+import (
+	"encoding/json"
+)
+
+// MarshalJSON encodes the extension list into a JSON gupdate response,
+// with the same apps and attributes as the XML response
+func (updateResponse *WebStoreUpdateResponse) MarshalJSON() ([]byte, error) {
+	type UpdateCheck struct {
+		Status   string `json:"status"`
+		Codebase string `json:"codebase"`
+		Version  string `json:"version"`
+		SHA256   string `json:"hash_sha256"`
+		Size     int64  `json:"size,omitempty"`
+	}
+	type App struct {
+		AppID       string      `json:"appid"`
+		Status      string      `json:"status"`
+		UpdateCheck UpdateCheck `json:"updatecheck"`
+	}
+	type GUpdate struct {
+		Protocol string `json:"protocol"`
+		Server   string `json:"server"`
+		Apps     []App  `json:"app"`
+	}
+	response := GUpdate{Protocol: DefaultProtocol, Server: "prod", Apps: []App{}}
+	for _, extension := range *updateResponse {
+		response.Apps = append(response.Apps, App{
+			AppID:  extension.ID,
+			Status: "ok",
+			UpdateCheck: UpdateCheck{
+				Status:   "ok",
+				SHA256:   extension.SHA256,
+				Size:     extension.Size,
+				Version:  extension.Version,
+				Codebase: extension.GetURL(),
+			},
+		})
+	}
+	return json.Marshal(struct {
+		GUpdate GUpdate `json:"gupdate"`
+	}{response})
+}
@@ -0,0 +1,27 @@
+package extension
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestWebStoreUpdateResponseMarshalJSON(t *testing.T) {
+	// No extensions returns blank update response
+	updateResponse := WebStoreUpdateResponse{}
+	data, err := json.Marshal(&updateResponse)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"gupdate":{"protocol":"3.1","server":"prod","app":[]}}`, string(data))
+
+	allExtensionsMap := LoadExtensionsIntoMap(&OfferedExtensions)
+	darkThemeExtension, ok := allExtensionsMap["bfdgpgibhagkpdlnjonhkabjoijopoge"]
+	assert.True(t, ok)
+	darkThemeExtension.Size = 1024
+	updateResponse = WebStoreUpdateResponse{darkThemeExtension}
+	data, err = json.Marshal(&updateResponse)
+	assert.Nil(t, err)
+	expectedOutput := `{"gupdate":{"protocol":"3.1","server":"prod","app":[{"appid":"bfdgpgibhagkpdlnjonhkabjoijopoge","status":"ok","updatecheck":{` +
+		`"status":"ok","codebase":"https://brave-core-ext.s3.brave.com/release/bfdgpgibhagkpdlnjonhkabjoijopoge/extension_1_0_0.crx","version":"1.0.0",` +
+		`"hash_sha256":"ae517d6273a4fc126961cb026e02946db4f9dbb58e3d9bc29f5e1270e3ce9834","size":1024}}]}}`
+	assert.Equal(t, expectedOutput, string(data))
+}
@@ -0,0 +1,44 @@
+package extension
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// localeRegexp matches the language tags clients send as lang, like en, en-US or zh-Hant-TW
+var localeRegexp = regexp.MustCompile(`^[a-zA-Z]{2,3}([-_][a-zA-Z0-9]{1,8})*$`)
+
+// Localize returns the extension with the package of its Locales which best matches lang: the one for lang itself,
+// or else for its shorter prefixes, so pt-BR falls back to pt. Clients with no matching locale get the extension's own.
+func (extension Extension) Localize(lang string) Extension {
+	if len(extension.Locales) == 0 || len(lang) == 0 {
+		return extension
+	}
+	tag := NormalizeLocale(lang)
+	for {
+		for locale, pkg := range extension.Locales {
+			if NormalizeLocale(locale) == tag {
+				return extension.withPackage(pkg)
+			}
+		}
+		i := strings.LastIndex(tag, "-")
+		if i < 0 {
+			return extension
+		}
+		tag = tag[:i]
+	}
+}
+
+// ValidateLocale returns an error if locale isn't a language tag which clients could send as lang
+func ValidateLocale(locale string) error {
+	if !localeRegexp.MatchString(locale) {
+		return fmt.Errorf("%q is not a language tag like en or pt-BR", locale)
+	}
+	return nil
+}
+
+// NormalizeLocale returns locale in lowercase with hyphens, as clients send either en-US or en_US
+func NormalizeLocale(locale string) string {
+	return strings.ToLower(strings.Replace(locale, "_", "-", -1))
+}
@@ -0,0 +1,44 @@
+package extension
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLocalize(t *testing.T) {
+	ext := Extension{ID: "ldimlcelhnjgpjjemdjokpgeeikdinbm", Version: "1.0.0", SHA256: "default", Locales: map[string]Package{
+		"pt":    {Version: "1.0.1", SHA256: "pt"},
+		"pt-BR": {Version: "1.0.2", SHA256: "pt-BR", URL: "https://example.com/pt-BR.crx"},
+		"zh_TW": {Version: "1.0.3", SHA256: "zh-TW"},
+	}}
+
+	// The most specific locale applies, ignoring case and separators
+	assert.Equal(t, "pt-BR", ext.Localize("pt-br").SHA256)
+	assert.Equal(t, "https://example.com/pt-BR.crx", ext.Localize("pt-BR").URL)
+	assert.Equal(t, "pt", ext.Localize("pt-PT").SHA256)
+	assert.Equal(t, "pt", ext.Localize("pt").SHA256)
+	assert.Equal(t, "zh-TW", ext.Localize("zh-TW").SHA256)
+
+	// Others get the extension's own package
+	assert.Equal(t, "default", ext.Localize("zh-CN").SHA256)
+	assert.Equal(t, "default", ext.Localize("en").SHA256)
+	assert.Equal(t, "default", ext.Localize("").SHA256)
+
+	// Locales also apply to clients matching no rule
+	ext.Rules = []Rule{{Conditions: []Condition{{Attribute: AttributeOS, Operator: OperatorEqual, Value: "android"}}, Package: &Package{Version: "0.9.0", SHA256: "android"}}}
+	targeted, ok := ext.Target(Extension{Platform: "android", Lang: "pt-BR"})
+	assert.True(t, ok)
+	assert.Equal(t, "android", targeted.SHA256)
+	targeted, ok = ext.Target(Extension{Platform: "win", Lang: "pt-BR"})
+	assert.True(t, ok)
+	assert.Equal(t, "pt-BR", targeted.SHA256)
+}
+
+func TestValidateLocale(t *testing.T) {
+	for _, locale := range []string{"en", "pt-BR", "zh_TW", "zh-Hant-TW", "es-419", "fil"} {
+		assert.Nil(t, ValidateLocale(locale), locale)
+	}
+	for _, locale := range []string{"", "e", "english", "en-", "en US", "-US"} {
+		assert.NotNil(t, ValidateLocale(locale), locale)
+	}
+}
@@ -0,0 +1,14 @@
+package extension
+
+// FitMemory returns the extension as offered to a client reporting physMemory GB of memory, which is its Lite package
+// when that is less than MinPhysMemory, and false if it has none. Clients which didn't report their memory get
+// the extension's own package.
+func (extension Extension) FitMemory(physMemory int) (Extension, bool) {
+	if extension.MinPhysMemory == 0 || physMemory == 0 || physMemory >= extension.MinPhysMemory {
+		return extension, true
+	}
+	if extension.Lite == nil {
+		return extension, false
+	}
+	return extension.withPackage(*extension.Lite), true
+}
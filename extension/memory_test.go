@@ -0,0 +1,40 @@
+package extension
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFitMemory(t *testing.T) {
+	ext := Extension{ID: "ldimlcelhnjgpjjemdjokpgeeikdinbm", Version: "1.0.0", SHA256: "full", MinPhysMemory: 4}
+
+	// Without a lite package, low memory clients get no update
+	_, ok := ext.FitMemory(2)
+	assert.False(t, ok)
+	fitted, ok := ext.FitMemory(4)
+	assert.True(t, ok)
+	assert.Equal(t, "full", fitted.SHA256)
+	// Clients which didn't report their memory get the full package
+	fitted, ok = ext.FitMemory(0)
+	assert.True(t, ok)
+	assert.Equal(t, "full", fitted.SHA256)
+
+	ext.Lite = &Package{Version: "1.0.0", SHA256: "lite", Size: 512, URL: "https://example.com/lite.crx"}
+	fitted, ok = ext.FitMemory(2)
+	assert.True(t, ok)
+	assert.Equal(t, "lite", fitted.SHA256)
+	assert.Equal(t, int64(512), fitted.Size)
+	assert.Equal(t, "https://example.com/lite.crx", fitted.URL)
+
+	// Low memory clients get the lite package whatever their locale, and rules come first
+	ext.Locales = map[string]Package{"de": {Version: "1.0.0", SHA256: "de"}}
+	ext.Rules = []Rule{{Conditions: []Condition{{Attribute: AttributeOS, Operator: OperatorEqual, Value: "ios"}}, NoUpdate: true}}
+	targeted, ok := ext.Target(Extension{Platform: "android", Lang: "de", PhysMemory: 2})
+	assert.True(t, ok)
+	assert.Equal(t, "lite", targeted.SHA256)
+	targeted, ok = ext.Target(Extension{Platform: "android", Lang: "de", PhysMemory: 8})
+	assert.True(t, ok)
+	assert.Equal(t, "de", targeted.SHA256)
+	_, ok = ext.Target(Extension{Platform: "ios", PhysMemory: 2})
+	assert.False(t, ok)
+}
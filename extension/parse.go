@@ -0,0 +1,37 @@
+package extension
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+)
+
+// ParseUpdateRequest parses an update request body in the JSON protocol 4 if it is a JSON object,
+// or in the XML protocol 3 otherwise. It only depends on body and SupportedProtocols,
+// and errors are an *Error of kind ErrMalformedRequest or ErrUnsupportedProtocol.
+func ParseUpdateRequest(body []byte) (UpdateRequest, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(body), []byte("{")) {
+		return ParseJSONUpdateRequest(body)
+	}
+	return ParseXMLUpdateRequest(body)
+}
+
+// ParseXMLUpdateRequest parses an update request body in the XML protocol 3, see ParseUpdateRequest
+func ParseXMLUpdateRequest(body []byte) (UpdateRequest, error) {
+	updateRequest := UpdateRequest{}
+	err := xml.Unmarshal(body, &updateRequest)
+	if err != nil {
+		return nil, RequestError(err)
+	}
+	return updateRequest, nil
+}
+
+// ParseJSONUpdateRequest parses an update request body in the JSON protocol 4, see ParseUpdateRequest
+func ParseJSONUpdateRequest(body []byte) (UpdateRequest, error) {
+	protocol4Request := Protocol4Request{}
+	err := json.Unmarshal(body, &protocol4Request)
+	if err != nil {
+		return nil, RequestError(err)
+	}
+	return protocol4Request.UpdateRequest, nil
+}
@@ -0,0 +1,79 @@
+//go:build go1.18
+// +build go1.18
+
+package extension
+
+import (
+	"github.com/brave/go-update/extension/extensiontest"
+	"testing"
+)
+
+// Run the fuzz targets with go test -fuzz, like:
+//
+//	go test ./extension -run '^$' -fuzz FuzzParseUpdateRequest -fuzztime 1m
+
+// fuzzSeeds are realistic request bodies for the fuzzer to start from
+func fuzzSeeds(f *testing.F) {
+	request := extensiontest.NewRequest().DLPref("cacheable").PhysMemory(16).
+		App("aomjjhallfgjeglblehebfpbcfeobpgk", "4.7.0.90").Ping().FP("1.abc").TargetVersionPrefix("4.").
+		App("ldimlcelhnjgpjjemdjokpgeeikdinbm", "1.0.0").NoUpdateCheck().
+		Event(extensiontest.Event{Type: extensiontest.EventTypeUpdate, Result: extensiontest.EventResultSuccess}).
+		App("jdbefljfgobbmcidnmpjamcbhnbphjnb", "1.0.0").UpdateDisabled()
+	f.Add([]byte(request.BuildXML()))
+	f.Add([]byte(request.BuildJSON()))
+	f.Add([]byte(extensiontest.ExtensionRequestFnForTwo("aomjjhallfgjeglblehebfpbcfeobpgk", "ldimlcelhnjgpjjemdjokpgeeikdinbm")("1.0", "2.0")))
+	f.Add([]byte(extensiontest.NewRequest().Protocol("2.0").App("aomjjhallfgjeglblehebfpbcfeobpgk", "1.0").BuildXML()))
+	f.Add([]byte(`{"request":{"protocol":"4.0","apps":[{"appid":"a","ping":{"r":-2}}]}}`))
+	f.Add([]byte("<request"))
+	f.Add([]byte("{"))
+	f.Add([]byte{})
+}
+
+// checkParsed checks the invariants of parsing any body: errors are only of the request kinds,
+// and requests which parse have one entry per app
+func checkParsed(t *testing.T, updateRequest UpdateRequest, err error) {
+	if err != nil {
+		if updateRequest != nil {
+			t.Errorf("a request was returned with the error %v", err)
+		}
+		if kind := Cause(err); kind != ErrMalformedRequest && kind != ErrUnsupportedProtocol {
+			t.Errorf("error %v isn't a request error", err)
+		}
+		return
+	}
+	for _, ext := range updateRequest {
+		if ext.PingOnly && ext.UpdateDisabled {
+			t.Errorf("app %q without an update check has updates disabled", ext.ID)
+		}
+	}
+}
+
+func FuzzParseUpdateRequest(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, body []byte) {
+		updateRequest, err := ParseUpdateRequest(body)
+		checkParsed(t, updateRequest, err)
+	})
+}
+
+func FuzzParseXMLUpdateRequest(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, body []byte) {
+		updateRequest, err := ParseXMLUpdateRequest(body)
+		checkParsed(t, updateRequest, err)
+		// The protocol and request ID are read without decoding the whole request, and must agree with it
+		protocol, protocolErr := ParseRequestProtocol(body)
+		if err == nil && (protocolErr != nil || !IsSupportedProtocol(protocol)) {
+			t.Errorf("request parsed with protocol %q, %v", protocol, protocolErr)
+		}
+		_, _ = ParseRequestID(body)
+	})
+}
+
+func FuzzParseJSONUpdateRequest(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, body []byte) {
+		updateRequest, err := ParseJSONUpdateRequest(body)
+		checkParsed(t, updateRequest, err)
+	})
+}
@@ -0,0 +1,194 @@
+package extension
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Protocol4 is the protocol version of JSON update responses.
+// Protocol 4 replaces the single package of an update with pipelines of operations, like downloading and installing a CRX.
+const Protocol4 = "4.0"
+
+// Protocol4Prefix is sent before every protocol 4 response, so it can't be evaluated as a script
+const Protocol4Prefix = ")]}'\n"
+
+// Protocol4Request is a protocol 4 update request
+type Protocol4Request struct {
+	UpdateRequest UpdateRequest
+}
+
+// Protocol4Response is a protocol 4 update response
+type Protocol4Response struct {
+	UpdateResponse UpdateResponse
+}
+
+// UnmarshalJSON decodes a protocol 4 update request for a list of extensions
+func (protocol4Request *Protocol4Request) UnmarshalJSON(data []byte) error {
+	type UpdateCheck struct {
+		UpdateDisabled bool `json:"updatedisabled"`
+	}
+	type Data struct {
+		Name  string `json:"name"`
+		Index string `json:"index"`
+	}
+	type App struct {
+		AppID       string           `json:"appid"`
+		Version     string           `json:"version"`
+		UpdateCheck *UpdateCheck     `json:"updatecheck"`
+		Ping        *json.RawMessage `json:"ping"`
+		Data        []Data           `json:"data"`
+	}
+	type HW struct {
+		PhysMemory int `json:"physmemory"`
+	}
+	type Request struct {
+		Protocol    string `json:"protocol"`
+		ProdChannel string `json:"prodchannel"`
+		OS          string `json:"@os"`
+		Arch        string `json:"arch"`
+		ProdVersion string `json:"prodversion"`
+		Lang        string `json:"lang"`
+		DLPref      string `json:"dlpref"`
+		HW          HW     `json:"hw"`
+		Apps        []App  `json:"apps"`
+	}
+	envelope := struct {
+		Request *Request `json:"request"`
+	}{}
+	err := json.Unmarshal(data, &envelope)
+	if err != nil {
+		return RequestError(err)
+	}
+	if envelope.Request == nil {
+		return &Error{Kind: ErrMalformedRequest, Detail: "request is missing"}
+	}
+	request := envelope.Request
+	if !strings.HasPrefix(request.Protocol, "4.") {
+		return &Error{Kind: ErrUnsupportedProtocol, Detail: fmt.Sprintf("request version %q", request.Protocol)}
+	}
+
+	protocol4Request.UpdateRequest = UpdateRequest{}
+	for _, app := range request.Apps {
+		var indexes []string
+		for _, data := range app.Data {
+			if data.Name == InstallDataName {
+				indexes = append(indexes, data.Index)
+			}
+		}
+		protocol4Request.UpdateRequest = append(protocol4Request.UpdateRequest, Extension{
+			ID:                 app.AppID,
+			Version:            app.Version,
+			Channel:            request.ProdChannel,
+			Platform:           request.OS,
+			Arch:               request.Arch,
+			ProdVersion:        request.ProdVersion,
+			Lang:               request.Lang,
+			PhysMemory:         request.HW.PhysMemory,
+			PingOnly:           app.UpdateCheck == nil,
+			UpdateDisabled:     app.UpdateCheck != nil && app.UpdateCheck.UpdateDisabled,
+			Ping:               app.Ping != nil,
+			DownloadPreference: request.DLPref,
+			InstallDataIndexes: indexes,
+		})
+	}
+	return nil
+}
+
+// MarshalJSON encodes the extension list into a protocol 4 response, without Protocol4Prefix
+func (protocol4Response *Protocol4Response) MarshalJSON() ([]byte, error) {
+	type URL struct {
+		URL string `json:"url"`
+	}
+	type Hash struct {
+		SHA256 string `json:"sha256"`
+	}
+	type Operation struct {
+		Type      string `json:"type"`
+		Size      int64  `json:"size,omitempty"`
+		URLs      []URL  `json:"urls,omitempty"`
+		In        *Hash  `json:"in,omitempty"`
+		Out       *Hash  `json:"out,omitempty"`
+		Path      string `json:"path,omitempty"`
+		Arguments string `json:"arguments,omitempty"`
+	}
+	type Pipeline struct {
+		PipelineID string      `json:"pipeline_id"`
+		Operations []Operation `json:"operations"`
+	}
+	type UpdateCheck struct {
+		Status      string     `json:"status"`
+		NextVersion string     `json:"nextversion,omitempty"`
+		Pipelines   []Pipeline `json:"pipelines,omitempty"`
+	}
+	type Data struct {
+		Name   string `json:"name"`
+		Index  string `json:"index,omitempty"`
+		Status string `json:"status"`
+		Text   string `json:"#text,omitempty"`
+	}
+	type Ping struct {
+		Status string `json:"status"`
+	}
+	type App struct {
+		AppID       string       `json:"appid"`
+		Status      string       `json:"status"`
+		UpdateCheck *UpdateCheck `json:"updatecheck,omitempty"`
+		Data        []Data       `json:"data,omitempty"`
+		Ping        *Ping        `json:"ping,omitempty"`
+	}
+	type Response struct {
+		Protocol string `json:"protocol"`
+		Server   string `json:"server"`
+		Apps     []App  `json:"apps"`
+	}
+	response := Response{Protocol: Protocol4, Server: "prod", Apps: []App{}}
+	for _, extension := range protocol4Response.UpdateResponse {
+		app := App{AppID: extension.ID, Status: "ok"}
+		// Acknowledgements don't offer an update, only confirm the ping was received
+		if extension.PingOnly || extension.UpdateDisabled {
+			if extension.Ping {
+				app.Ping = &Ping{Status: "ok"}
+			}
+			if extension.UpdateDisabled {
+				app.UpdateCheck = &UpdateCheck{Status: "noupdate"}
+			}
+			response.Apps = append(response.Apps, app)
+			continue
+		}
+		download := Operation{Type: "download", Size: extension.Size, Out: &Hash{SHA256: extension.SHA256}}
+		for _, codebase := range extension.GetURLs() {
+			download.URLs = append(download.URLs, URL{URL: codebase})
+		}
+		operations := []Operation{download}
+		// The packages of apps aren't CRXs, so they are only installed by their actions
+		if !extension.IsApp() {
+			operations = append(operations, Operation{Type: "crx3", In: &Hash{SHA256: extension.SHA256}})
+		}
+		// Install actions run a command once the package is installed, or downloaded for apps, the other events have no operation
+		for _, action := range extension.Actions {
+			if action.Event == ActionEventInstall {
+				operations = append(operations, Operation{Type: "run", Path: action.Run, Arguments: action.Arguments})
+			}
+		}
+		app.UpdateCheck = &UpdateCheck{
+			Status:      "ok",
+			NextVersion: extension.Version,
+			Pipelines: []Pipeline{{
+				PipelineID: "direct_full",
+				Operations: operations,
+			}},
+		}
+		for _, index := range extension.InstallDataIndexes {
+			text, status := extension.installDataFor(index)
+			app.Data = append(app.Data, Data{Name: InstallDataName, Index: index, Status: status, Text: text})
+		}
+		if len(extension.ReleaseNotes) != 0 {
+			app.Data = append(app.Data, Data{Name: ReleaseNotesDataName, Status: DataStatusOK, Text: extension.ReleaseNotes})
+		}
+		response.Apps = append(response.Apps, app)
+	}
+	return json.Marshal(struct {
+		Response Response `json:"response"`
+	}{response})
+}
@@ -0,0 +1,138 @@
+package extension
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"github.com/brave/go-update/extension/extensiontest"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestProtocol4RequestUnmarshalJSON(t *testing.T) {
+	// Malformed JSON, a missing request or another protocol version returns an error
+	protocol4Request := Protocol4Request{}
+	assert.Equal(t, ErrMalformedRequest, Cause(RequestError(json.Unmarshal([]byte("{"), &protocol4Request))))
+	assert.Equal(t, ErrMalformedRequest, Cause(json.Unmarshal([]byte(`{"response":{}}`), &protocol4Request)))
+	assert.Equal(t, ErrUnsupportedProtocol, Cause(json.Unmarshal([]byte(`{"request":{"protocol":"3.1","apps":[]}}`), &protocol4Request)))
+
+	data := []byte(`{"request":{"protocol":"4.0","@os":"mac","arch":"arm64","prodversion":"120.1.61.100","lang":"de","hw":{"physmemory":8},"prodchannel":"stable","dlpref":"cacheable","apps":[
+		{"appid":"aomjjhallfgjeglblehebfpbcfeobpgk","version":"4.7.0.90","updatecheck":{},"ping":{"r":-2},"data":[{"name":"install","index":"referral"},{"name":"untrusted","#text":"abc"}]},
+		{"appid":"jdbefljfgobbmcidnmpjamcbhnbphjnb","version":"1.0.0","updatecheck":{"updatedisabled":true}},
+		{"appid":"ldimlcelhnjgpjjemdjokpgeeikdinbm","version":"1.0.0","ping":{"r":1}}
+	]}}`)
+	assert.Nil(t, json.Unmarshal(data, &protocol4Request))
+	updateRequest := protocol4Request.UpdateRequest
+	assert.Equal(t, 3, len(updateRequest))
+	assert.Equal(t, "aomjjhallfgjeglblehebfpbcfeobpgk", updateRequest[0].ID)
+	assert.Equal(t, "4.7.0.90", updateRequest[0].Version)
+	assert.Equal(t, "stable", updateRequest[0].Channel)
+	assert.Equal(t, "mac", updateRequest[0].Platform)
+	assert.Equal(t, "cacheable", updateRequest[0].DownloadPreference)
+	assert.Equal(t, "arm64", updateRequest[0].Arch)
+	assert.Equal(t, "120.1.61.100", updateRequest[0].ProdVersion)
+	assert.Equal(t, "de", updateRequest[0].Lang)
+	assert.Equal(t, 8, updateRequest[0].PhysMemory)
+	assert.Equal(t, []string{"referral"}, updateRequest[0].InstallDataIndexes)
+	assert.True(t, updateRequest[0].Ping)
+	assert.False(t, updateRequest[0].PingOnly)
+	assert.False(t, updateRequest[0].UpdateDisabled)
+	assert.True(t, updateRequest[1].UpdateDisabled)
+	assert.False(t, updateRequest[1].Ping)
+	assert.True(t, updateRequest[2].PingOnly)
+	assert.True(t, updateRequest[2].Ping)
+}
+
+func TestProtocol4ResponseMarshalJSON(t *testing.T) {
+	allExtensionsMap := LoadExtensionsIntoMap(&OfferedExtensions)
+	darkThemeExtension, ok := allExtensionsMap["bfdgpgibhagkpdlnjonhkabjoijopoge"]
+	assert.True(t, ok)
+
+	// Empty extension list returns no apps
+	data, err := json.Marshal(&Protocol4Response{UpdateResponse: UpdateResponse{}})
+	assert.Nil(t, err)
+	assert.Equal(t, `{"response":{"protocol":"4.0","server":"prod","apps":[]}}`, string(data))
+
+	// Updates download then install the CRX, and acknowledgements only confirm pings
+	updateResponse := UpdateResponse{
+		darkThemeExtension,
+		{ID: "ldimlcelhnjgpjjemdjokpgeeikdinbm", PingOnly: true, Ping: true},
+		{ID: "aomjjhallfgjeglblehebfpbcfeobpgk", UpdateDisabled: true},
+	}
+	data, err = json.Marshal(&Protocol4Response{UpdateResponse: updateResponse})
+	assert.Nil(t, err)
+	expectedOutput := `{"response":{"protocol":"4.0","server":"prod","apps":[` +
+		`{"appid":"bfdgpgibhagkpdlnjonhkabjoijopoge","status":"ok","updatecheck":{"status":"ok","nextversion":"1.0.0","pipelines":[{"pipeline_id":"direct_full","operations":[` +
+		`{"type":"download","urls":[{"url":"https://brave-core-ext.s3.brave.com/release/bfdgpgibhagkpdlnjonhkabjoijopoge/extension_1_0_0.crx"}],"out":{"sha256":"ae517d6273a4fc126961cb026e02946db4f9dbb58e3d9bc29f5e1270e3ce9834"}},` +
+		`{"type":"crx3","in":{"sha256":"ae517d6273a4fc126961cb026e02946db4f9dbb58e3d9bc29f5e1270e3ce9834"}}]}]}},` +
+		`{"appid":"ldimlcelhnjgpjjemdjokpgeeikdinbm","status":"ok","ping":{"status":"ok"}},` +
+		`{"appid":"aomjjhallfgjeglblehebfpbcfeobpgk","status":"ok","updatecheck":{"status":"noupdate"}}]}}`
+	assert.Equal(t, expectedOutput, string(data))
+
+	// Requested install data is sent along with updates
+	darkThemeExtension.InstallData = map[string]string{"referral": "BRV001"}
+	darkThemeExtension.InstallDataIndexes = []string{"referral", "missing"}
+	darkThemeExtension.ReleaseNotes = "https://example.com/notes"
+	data, err = json.Marshal(&Protocol4Response{UpdateResponse: UpdateResponse{darkThemeExtension}})
+	assert.Nil(t, err)
+	assert.NotContains(t, string(data), `"type":"run"`)
+	assert.Contains(t, string(data), `"data":[{"name":"install","index":"referral","status":"ok","#text":"BRV001"},{"name":"install","index":"missing","status":"error-nodata"},`+
+		`{"name":"releasenotes","status":"ok","#text":"https://example.com/notes"}]`)
+
+	// Install actions run a command after the CRX is installed
+	darkThemeExtension.Actions = []Action{
+		{Event: ActionEventInstall, Run: "setup.exe", Arguments: "--install"},
+		{Event: ActionEventPostinstall, OnSuccess: "exitsilently"},
+	}
+	data, err = json.Marshal(&Protocol4Response{UpdateResponse: UpdateResponse{darkThemeExtension}})
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), `{"type":"crx3","in":{"sha256":"ae517d6273a4fc126961cb026e02946db4f9dbb58e3d9bc29f5e1270e3ce9834"}},{"type":"run","path":"setup.exe","arguments":"--install"}]`)
+
+	// The packages of apps are only run, as they aren't CRXs
+	darkThemeExtension.Type = TypeApp
+	data, err = json.Marshal(&Protocol4Response{UpdateResponse: UpdateResponse{darkThemeExtension}})
+	assert.Nil(t, err)
+	assert.NotContains(t, string(data), "crx3")
+	assert.Contains(t, string(data), `"out":{"sha256":"ae517d6273a4fc126961cb026e02946db4f9dbb58e3d9bc29f5e1270e3ce9834"}},{"type":"run","path":"setup.exe","arguments":"--install"}]`)
+}
+
+func TestParseResponse(t *testing.T) {
+	allExtensionsMap := LoadExtensionsIntoMap(&OfferedExtensions)
+	darkThemeExtension := allExtensionsMap["bfdgpgibhagkpdlnjonhkabjoijopoge"]
+	updateResponse := UpdateResponse{darkThemeExtension, {ID: "ldimlcelhnjgpjjemdjokpgeeikdinbm", PingOnly: true, Ping: true}}
+	webStoreResponse := WebStoreUpdateResponse{darkThemeExtension}
+
+	// Every shape of response is parsed the same way
+	protocol4, err := json.Marshal(&Protocol4Response{UpdateResponse: updateResponse})
+	assert.Nil(t, err)
+	protocol3, err := xml.Marshal(&updateResponse)
+	assert.Nil(t, err)
+	gupdateXML, err := xml.Marshal(&webStoreResponse)
+	assert.Nil(t, err)
+	gupdateJSON, err := json.Marshal(&webStoreResponse)
+	assert.Nil(t, err)
+	for _, body := range [][]byte{append([]byte(Protocol4Prefix), protocol4...), protocol3, gupdateXML, gupdateJSON} {
+		response, err := extensiontest.ParseResponse(body)
+		assert.Nil(t, err)
+		app, ok := response.App(darkThemeExtension.ID)
+		assert.True(t, ok)
+		assert.Equal(t, "ok", app.UpdateStatus)
+		assert.Equal(t, "1.0.0", app.Version)
+		assert.Equal(t, darkThemeExtension.SHA256, app.SHA256)
+		assert.Equal(t, []string{darkThemeExtension.GetURL()}, app.URLs)
+		assert.True(t, extensiontest.AssertUpdateOffered(t, string(body), darkThemeExtension.ID, "1.0.0", darkThemeExtension.SHA256))
+		assert.True(t, extensiontest.AssertNoUpdate(t, string(body), "ldimlcelhnjgpjjemdjokpgeeikdinbm"))
+	}
+
+	// Acknowledged pings aren't updates
+	response, err := extensiontest.ParseResponse(protocol4)
+	assert.Nil(t, err)
+	app, ok := response.App("ldimlcelhnjgpjjemdjokpgeeikdinbm")
+	assert.True(t, ok)
+	assert.Equal(t, "ok", app.PingStatus)
+	assert.Equal(t, "", app.UpdateStatus)
+
+	_, err = extensiontest.ParseResponse([]byte("<html></html>"))
+	assert.NotNil(t, err)
+	_, err = extensiontest.ParseResponse([]byte(`{"error":"bad"}`))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,215 @@
+package extension
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Rule targets the clients whose update checks match all of its Conditions, which are offered Package instead of
+// the extension's own, or no update at all when NoUpdate is set. The first matching rule of an extension applies,
+// and clients matching none are offered the extension's own package.
+type Rule struct {
+	Conditions []Condition `json:"conditions"`
+	Package    *Package    `json:"package,omitempty"`
+	NoUpdate   bool        `json:"noUpdate,omitempty"`
+}
+
+// Condition compares an attribute of the client checking for updates with Value, or with Values for the in and
+// notIn operators. Attributes the client didn't send match no condition.
+type Condition struct {
+	Attribute string   `json:"attribute"`
+	Operator  string   `json:"operator"`
+	Value     string   `json:"value,omitempty"`
+	Values    []string `json:"values,omitempty"`
+}
+
+// Package is a CRX a Rule, locale or low memory client is offered instead of the extension's own
+type Package struct {
+	Version string `json:"version"`
+	SHA256  string `json:"sha256"`
+	Size    int64  `json:"size,omitempty"`
+	URL     string `json:"url,omitempty"`
+}
+
+// Attributes of the client checking for updates which conditions can compare
+const (
+	AttributeOS          = "os"
+	AttributeArch        = "arch"
+	AttributeProdVersion = "prodversion"
+	AttributeLang        = "lang"
+	AttributeChannel     = "channel"
+	AttributePhysMemory  = "physmemory"
+)
+
+// Operators of conditions. Strings are compared ignoring case, and the ordering operators only apply to
+// prodversion, compared as versions, and physmemory, compared as numbers.
+const (
+	OperatorEqual          = "eq"
+	OperatorNotEqual       = "ne"
+	OperatorIn             = "in"
+	OperatorNotIn          = "notIn"
+	OperatorPrefix         = "prefix"
+	OperatorLess           = "lt"
+	OperatorLessOrEqual    = "le"
+	OperatorGreater        = "gt"
+	OperatorGreaterOrEqual = "ge"
+)
+
+// Target returns the extension as offered to client, with the package of the first rule it matches,
+// and false if that rule offers it no update. Clients matching no rule get the package
+// for their locale and memory, see Localize and FitMemory.
+func (extension Extension) Target(client Extension) (Extension, bool) {
+	for _, rule := range extension.Rules {
+		if !rule.Matches(client) {
+			continue
+		}
+		if rule.NoUpdate {
+			return extension, false
+		}
+		if rule.Package != nil {
+			extension = extension.withPackage(*rule.Package)
+		}
+		return extension, true
+	}
+	// Low memory clients get the lite package whatever their locale
+	return extension.Localize(client.Lang).FitMemory(client.PhysMemory)
+}
+
+// withPackage returns the extension with pkg in place of its own package.
+// Its release notes only describe its own version, so they are dropped for other versions.
+func (extension Extension) withPackage(pkg Package) Extension {
+	if pkg.Version != extension.Version {
+		extension.ReleaseNotes = ""
+	}
+	extension.Version = pkg.Version
+	extension.SHA256 = pkg.SHA256
+	extension.Size = pkg.Size
+	extension.URL = pkg.URL
+	return extension
+}
+
+// Matches returns true if client matches all the conditions of the rule
+func (rule Rule) Matches(client Extension) bool {
+	for _, condition := range rule.Conditions {
+		if !condition.Matches(client) {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate returns an error if the rule has conditions which can't be evaluated,
+// or doesn't say what to offer the clients it matches
+func (rule Rule) Validate() error {
+	if rule.NoUpdate == (rule.Package != nil) {
+		return fmt.Errorf("rules need either a package or noUpdate")
+	}
+	for _, condition := range rule.Conditions {
+		if err := condition.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attribute returns the value of the condition's attribute for client, which is empty if the client didn't send it
+func (condition Condition) attribute(client Extension) string {
+	switch condition.Attribute {
+	case AttributeOS:
+		return client.Platform
+	case AttributeArch:
+		return client.Arch
+	case AttributeProdVersion:
+		return client.ProdVersion
+	case AttributeLang:
+		return client.Lang
+	case AttributeChannel:
+		return client.Channel
+	case AttributePhysMemory:
+		if client.PhysMemory > 0 {
+			return strconv.Itoa(client.PhysMemory)
+		}
+	}
+	return ""
+}
+
+// compare returns -1, 0 or 1 as value is less than, equal to or greater than the condition's value
+func (condition Condition) compare(value string) int {
+	if condition.Attribute == AttributePhysMemory {
+		memory, _ := strconv.Atoi(value)
+		threshold, _ := strconv.Atoi(condition.Value)
+		switch {
+		case memory < threshold:
+			return -1
+		case memory > threshold:
+			return 1
+		}
+		return 0
+	}
+	return CompareVersions(value, condition.Value)
+}
+
+// Matches returns true if the attribute of client satisfies the condition
+func (condition Condition) Matches(client Extension) bool {
+	value := condition.attribute(client)
+	if len(value) == 0 {
+		return false
+	}
+	switch condition.Operator {
+	case OperatorEqual:
+		return strings.EqualFold(value, condition.Value)
+	case OperatorNotEqual:
+		return !strings.EqualFold(value, condition.Value)
+	case OperatorIn, OperatorNotIn:
+		in := false
+		for _, candidate := range condition.Values {
+			in = in || strings.EqualFold(value, candidate)
+		}
+		return in == (condition.Operator == OperatorIn)
+	case OperatorPrefix:
+		return strings.HasPrefix(strings.ToLower(value), strings.ToLower(condition.Value))
+	case OperatorLess:
+		return condition.compare(value) < 0
+	case OperatorLessOrEqual:
+		return condition.compare(value) <= 0
+	case OperatorGreater:
+		return condition.compare(value) > 0
+	case OperatorGreaterOrEqual:
+		return condition.compare(value) >= 0
+	}
+	return false
+}
+
+// Validate returns an error if the condition's attribute or operator is unknown, or its value doesn't suit them
+func (condition Condition) Validate() error {
+	switch condition.Attribute {
+	case AttributeOS, AttributeArch, AttributeProdVersion, AttributeLang, AttributeChannel, AttributePhysMemory:
+	default:
+		return fmt.Errorf("unknown attribute %q", condition.Attribute)
+	}
+	switch condition.Operator {
+	case OperatorEqual, OperatorNotEqual, OperatorPrefix:
+	case OperatorIn, OperatorNotIn:
+		if len(condition.Values) == 0 {
+			return fmt.Errorf("%s %s needs values", condition.Attribute, condition.Operator)
+		}
+		return nil
+	case OperatorLess, OperatorLessOrEqual, OperatorGreater, OperatorGreaterOrEqual:
+		switch condition.Attribute {
+		case AttributeProdVersion:
+		case AttributePhysMemory:
+			if _, err := strconv.Atoi(condition.Value); err != nil {
+				return fmt.Errorf("physmemory %s %q is not a number", condition.Operator, condition.Value)
+			}
+		default:
+			return fmt.Errorf("%s can't be compared with %s", condition.Attribute, condition.Operator)
+		}
+	default:
+		return fmt.Errorf("unknown operator %q", condition.Operator)
+	}
+	if len(condition.Value) == 0 {
+		return fmt.Errorf("%s %s needs a value", condition.Attribute, condition.Operator)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package extension
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTarget(t *testing.T) {
+	legacy := &Package{Version: "0.9.0", SHA256: "legacy"}
+	ext := Extension{ID: "ldimlcelhnjgpjjemdjokpgeeikdinbm", Version: "1.0.0", SHA256: "current", URL: "https://example.com/current.crx", ReleaseNotes: "1.0.0 notes", Rules: []Rule{
+		{Conditions: []Condition{{Attribute: AttributeOS, Operator: OperatorEqual, Value: "win"}, {Attribute: AttributeProdVersion, Operator: OperatorLess, Value: "100"}}, Package: legacy},
+		{Conditions: []Condition{{Attribute: AttributeArch, Operator: OperatorIn, Values: []string{"x86", "arm"}}}, NoUpdate: true},
+		{Conditions: []Condition{{Attribute: AttributeLang, Operator: OperatorPrefix, Value: "pt"}, {Attribute: AttributePhysMemory, Operator: OperatorGreaterOrEqual, Value: "4"}}, Package: &Package{Version: "1.0.1", SHA256: "pt"}},
+	}}
+
+	// Clients matching no rule get the extension's own package
+	targeted, ok := ext.Target(Extension{Platform: "win", ProdVersion: "120.1.61.100", Arch: "x64"})
+	assert.True(t, ok)
+	assert.Equal(t, "1.0.0", targeted.Version)
+	assert.Equal(t, "https://example.com/current.crx", targeted.URL)
+	assert.Equal(t, "1.0.0 notes", targeted.ReleaseNotes)
+
+	// The first matching rule applies, with strings compared ignoring case
+	targeted, ok = ext.Target(Extension{Platform: "WIN", ProdVersion: "99.0.1", Arch: "x86"})
+	assert.True(t, ok)
+	assert.Equal(t, "0.9.0", targeted.Version)
+	assert.Equal(t, "legacy", targeted.SHA256)
+	assert.Equal(t, "", targeted.URL)
+	// Release notes only describe the extension's own version
+	assert.Equal(t, "", targeted.ReleaseNotes)
+
+	_, ok = ext.Target(Extension{Platform: "linux", Arch: "arm"})
+	assert.False(t, ok)
+
+	targeted, ok = ext.Target(Extension{Lang: "pt-BR", PhysMemory: 8})
+	assert.True(t, ok)
+	assert.Equal(t, "1.0.1", targeted.Version)
+
+	// Attributes the client didn't send match no condition
+	targeted, ok = ext.Target(Extension{Lang: "pt-BR"})
+	assert.True(t, ok)
+	assert.Equal(t, "1.0.0", targeted.Version)
+	assert.False(t, Condition{Attribute: AttributeLang, Operator: OperatorNotEqual, Value: "en"}.Matches(Extension{}))
+}
+
+func TestValidateRule(t *testing.T) {
+	valid := []Rule{
+		{NoUpdate: true},
+		{Conditions: []Condition{{Attribute: AttributeChannel, Operator: OperatorNotIn, Values: []string{"beta"}}}, Package: &Package{}},
+		{Conditions: []Condition{{Attribute: AttributePhysMemory, Operator: OperatorLess, Value: "2"}}, NoUpdate: true},
+	}
+	for _, rule := range valid {
+		assert.Nil(t, rule.Validate())
+	}
+	invalid := []Rule{
+		{},
+		{NoUpdate: true, Package: &Package{}},
+		{Conditions: []Condition{{Attribute: "country", Operator: OperatorEqual, Value: "US"}}, NoUpdate: true},
+		{Conditions: []Condition{{Attribute: AttributeOS, Operator: "matches", Value: "win"}}, NoUpdate: true},
+		{Conditions: []Condition{{Attribute: AttributeOS, Operator: OperatorLess, Value: "win"}}, NoUpdate: true},
+		{Conditions: []Condition{{Attribute: AttributePhysMemory, Operator: OperatorLess, Value: "lots"}}, NoUpdate: true},
+		{Conditions: []Condition{{Attribute: AttributeLang, Operator: OperatorIn}}, NoUpdate: true},
+		{Conditions: []Condition{{Attribute: AttributeLang, Operator: OperatorEqual}}, NoUpdate: true},
+	}
+	for _, rule := range invalid {
+		assert.NotNil(t, rule.Validate(), "%+v", rule)
+	}
+}
@@ -1,13 +1,38 @@
 package extension
 
 import (
+	"bytes"
 	"encoding/xml"
 	"fmt"
-	"strings"
+	"strconv"
 )
 
+// DefaultProtocol is the protocol version of update responses
+const DefaultProtocol = "3.1"
+
+// SupportedProtocols are the protocol versions of update requests which are accepted
+var SupportedProtocols = []string{"3.0", "3.1"}
+
+// ProtocolUpdateResponse is an update response which declares a specific protocol version,
+// for clients which don't accept responses in a newer version than their request.
+type ProtocolUpdateResponse struct {
+	Protocol   string
+	Extensions UpdateResponse
+}
+
 // MarshalXML encodes the extension list into response XML
 func (updateResponse *UpdateResponse) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return updateResponse.marshalXML(e, DefaultProtocol)
+}
+
+// MarshalXML encodes the extension list into response XML with the protocol version of the response
+func (protocolResponse *ProtocolUpdateResponse) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return protocolResponse.Extensions.marshalXML(e, protocolResponse.Protocol)
+}
+
+// marshalXML encodes the extension list into response XML declaring protocol.
+// The 3.0 and 3.1 responses have the same elements.
+func (updateResponse *UpdateResponse) marshalXML(e *xml.Encoder, protocol string) error {
 	type URL struct {
 		XMLName  xml.Name `xml:"url"`
 		Codebase string   `xml:"codebase,attr"`
@@ -20,27 +45,54 @@ func (updateResponse *UpdateResponse) MarshalXML(e *xml.Encoder, start xml.Start
 		XMLName  xml.Name `xml:"package"`
 		Name     string   `xml:"name,attr"`
 		SHA256   string   `xml:"hash_sha256,attr"`
+		Size     int64    `xml:"size,attr,omitempty"`
 		Required bool     `xml:"required,attr"`
 	}
 	type Packages struct {
 		XMLName xml.Name `xml:"packages"`
 		Package []Package
 	}
+	type Action struct {
+		XMLName    xml.Name `xml:"action"`
+		Event      string   `xml:"event,attr"`
+		Run        string   `xml:"run,attr,omitempty"`
+		Arguments  string   `xml:"arguments,attr,omitempty"`
+		OnSuccess  string   `xml:"onsuccess,attr,omitempty"`
+		SuccessURL string   `xml:"successurl,attr,omitempty"`
+	}
+	type Actions struct {
+		XMLName xml.Name `xml:"actions"`
+		Action  []Action
+	}
 	type Manifest struct {
 		XMLName  xml.Name `xml:"manifest"`
 		Version  string   `xml:"version,attr"`
 		Packages Packages
+		Actions  *Actions
 	}
 	type UpdateCheck struct {
 		XMLName  xml.Name `xml:"updatecheck"`
-		URLs     URLs
+		URLs     *URLs
 		Status   string `xml:"status,attr"`
-		Manifest Manifest
+		Manifest *Manifest
+	}
+	type Data struct {
+		XMLName xml.Name `xml:"data"`
+		Name    string   `xml:"name,attr"`
+		Index   string   `xml:"index,attr,omitempty"`
+		Status  string   `xml:"status,attr"`
+		Text    string   `xml:",chardata"`
+	}
+	type Ping struct {
+		XMLName xml.Name `xml:"ping"`
+		Status  string   `xml:"status,attr"`
 	}
 	type App struct {
 		XMLName     xml.Name `xml:"app"`
 		AppID       string   `xml:"appid,attr"`
-		UpdateCheck UpdateCheck
+		UpdateCheck *UpdateCheck
+		Data        []Data
+		Ping        *Ping
 	}
 	type Response struct {
 		XMLName  xml.Name `xml:"response"`
@@ -49,25 +101,57 @@ func (updateResponse *UpdateResponse) MarshalXML(e *xml.Encoder, start xml.Start
 		Apps     []App
 	}
 	response := Response{}
-	response.Protocol = "3.1"
+	response.Protocol = protocol
 	response.Server = "prod"
 	for _, extension := range *updateResponse {
 		app := App{AppID: extension.ID}
-		app.UpdateCheck = UpdateCheck{Status: "ok"}
-		extensionName := "extension_" + strings.Replace(extension.Version, ".", "_", -1) + ".crx"
-		url := "https://brave-core-ext.s3.brave.com/release/" + extension.ID + "/" + extensionName
-		app.UpdateCheck.URLs.URLs = append(app.UpdateCheck.URLs.URLs, URL{
-			Codebase: url,
-		})
-		app.UpdateCheck.Manifest = Manifest{
+		// Acknowledgements don't offer an update, only confirm the ping was received
+		if extension.PingOnly || extension.UpdateDisabled {
+			if extension.Ping {
+				app.Ping = &Ping{Status: "ok"}
+			}
+			if extension.UpdateDisabled {
+				app.UpdateCheck = &UpdateCheck{Status: "noupdate"}
+			}
+			response.Apps = append(response.Apps, app)
+			continue
+		}
+		app.UpdateCheck = &UpdateCheck{Status: "ok", URLs: &URLs{}}
+		extensionName := GetPackageName(extension)
+		for _, codebase := range extension.GetURLs() {
+			app.UpdateCheck.URLs.URLs = append(app.UpdateCheck.URLs.URLs, URL{
+				Codebase: codebase,
+			})
+		}
+		app.UpdateCheck.Manifest = &Manifest{
 			Version: extension.Version,
 		}
 		pkg := Package{
 			Name:     extensionName,
 			SHA256:   extension.SHA256,
-			Required: true,
+			Size:     extension.Size,
+			Required: !extension.Optional,
 		}
 		app.UpdateCheck.Manifest.Packages.Package = append(app.UpdateCheck.Manifest.Packages.Package, pkg)
+		if len(extension.Actions) != 0 {
+			app.UpdateCheck.Manifest.Actions = &Actions{}
+			for _, action := range extension.Actions {
+				app.UpdateCheck.Manifest.Actions.Action = append(app.UpdateCheck.Manifest.Actions.Action, Action{
+					Event:      action.Event,
+					Run:        action.Run,
+					Arguments:  action.Arguments,
+					OnSuccess:  action.OnSuccess,
+					SuccessURL: action.SuccessURL,
+				})
+			}
+		}
+		for _, index := range extension.InstallDataIndexes {
+			text, status := extension.installDataFor(index)
+			app.Data = append(app.Data, Data{Name: InstallDataName, Index: index, Status: status, Text: text})
+		}
+		if len(extension.ReleaseNotes) != 0 {
+			app.Data = append(app.Data, Data{Name: ReleaseNotesDataName, Status: DataStatusOK, Text: extension.ReleaseNotes})
+		}
 		response.Apps = append(response.Apps, app)
 	}
 	e.Indent("", "    ")
@@ -75,14 +159,33 @@ func (updateResponse *UpdateResponse) MarshalXML(e *xml.Encoder, start xml.Start
 	return err
 }
 
+// WebStoreProtocol2Response is a gupdate response for legacy clients using protocol 2.0,
+// which expect the update2 namespace and the number of seconds elapsed since midnight.
+type WebStoreProtocol2Response struct {
+	ElapsedSeconds int
+	Extensions     WebStoreUpdateResponse
+}
+
 // MarshalXML encodes the extension list into response XML
 func (updateResponse *WebStoreUpdateResponse) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return updateResponse.marshalXML(e, DefaultProtocol, nil)
+}
+
+// MarshalXML encodes the extension list into protocol 2.0 response XML
+func (protocol2Response *WebStoreProtocol2Response) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return protocol2Response.Extensions.marshalXML(e, "2.0", &protocol2Response.ElapsedSeconds)
+}
+
+// marshalXML encodes the extension list into response XML declaring protocol.
+// The protocol 2.0 response also has the update2 namespace and a daystart element with elapsedSeconds.
+func (updateResponse *WebStoreUpdateResponse) marshalXML(e *xml.Encoder, protocol string, elapsedSeconds *int) error {
 	type UpdateCheck struct {
 		XMLName  xml.Name `xml:"updatecheck"`
 		Status   string   `xml:"status,attr"`
 		Codebase string   `xml:"codebase,attr"`
 		Version  string   `xml:"version,attr"`
 		SHA256   string   `xml:"hash_sha256,attr"`
+		Size     int64    `xml:"size,attr,omitempty"`
 	}
 	type App struct {
 		XMLName     xml.Name `xml:"app"`
@@ -90,26 +193,36 @@ func (updateResponse *WebStoreUpdateResponse) MarshalXML(e *xml.Encoder, start x
 		Status      string   `xml:"status,attr"`
 		UpdateCheck UpdateCheck
 	}
+	type DayStart struct {
+		XMLName        xml.Name `xml:"daystart"`
+		ElapsedSeconds int      `xml:"elapsed_seconds,attr"`
+	}
 	type GUpdate struct {
 		XMLName  xml.Name `xml:"gupdate"`
+		Xmlns    string   `xml:"xmlns,attr,omitempty"`
 		Protocol string   `xml:"protocol,attr"`
 		Server   string   `xml:"server,attr"`
+		DayStart *DayStart
 		Apps     []App
 	}
 	response := GUpdate{}
-	response.Protocol = "3.1"
+	response.Protocol = protocol
 	response.Server = "prod"
+	if elapsedSeconds != nil {
+		response.Xmlns = "http://www.google.com/update2/response"
+		response.DayStart = &DayStart{ElapsedSeconds: *elapsedSeconds}
+	}
 
 	for _, extension := range *updateResponse {
-		extensionName := "extension_" + strings.Replace(extension.Version, ".", "_", -1) + ".crx"
 		app := App{
 			AppID:  extension.ID,
 			Status: "ok",
 			UpdateCheck: UpdateCheck{
 				Status:   "ok",
 				SHA256:   extension.SHA256,
+				Size:     extension.Size,
 				Version:  extension.Version,
-				Codebase: "https://brave-core-ext.s3.brave.com/release/" + extension.ID + "/" + extensionName,
+				Codebase: extension.GetURL(),
 			},
 		}
 		response.Apps = append(response.Apps, app)
@@ -122,37 +235,112 @@ func (updateResponse *WebStoreUpdateResponse) MarshalXML(e *xml.Encoder, start x
 // UnmarshalXML decodes the update server request XML data for a list of extensions
 func (updateRequest *UpdateRequest) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 	type UpdateCheck struct {
-		XMLName xml.Name `xml:"updatecheck"`
+		XMLName        xml.Name `xml:"updatecheck"`
+		UpdateDisabled string   `xml:"updatedisabled,attr"`
+	}
+	type Data struct {
+		Name  string `xml:"name,attr"`
+		Index string `xml:"index,attr"`
 	}
 	type App struct {
 		XMLName     xml.Name `xml:"app"`
 		AppID       string   `xml:"appid,attr"`
-		UpdateCheck UpdateCheck
-		Version     string `xml:"version,attr"`
+		UpdateCheck *UpdateCheck
+		Ping        *struct{} `xml:"ping"`
+		Data        []Data    `xml:"data"`
+		Version     string    `xml:"version,attr"`
+	}
+	type HW struct {
+		PhysMemory string `xml:"physmemory,attr"`
 	}
 	type Request struct {
-		XMLName  xml.Name `xml:"request"`
-		App      []App    `xml:"app"`
-		Protocol string   `xml:"protocol,attr"`
+		XMLName     xml.Name `xml:"request"`
+		App         []App    `xml:"app"`
+		Protocol    string   `xml:"protocol,attr"`
+		ProdChannel string   `xml:"prodchannel,attr"`
+		OS          string   `xml:"os,attr"`
+		Arch        string   `xml:"arch,attr"`
+		ProdVersion string   `xml:"prodversion,attr"`
+		Lang        string   `xml:"lang,attr"`
+		DLPref      string   `xml:"dlpref,attr"`
+		HW          HW       `xml:"hw"`
 	}
 
 	request := Request{}
 	err := d.DecodeElement(&request, &start)
 	if err != nil {
-		return err
+		return RequestError(err)
 	}
 
+	// Clients which can't tell their memory leave it out, and invalid values are treated the same
+	physMemory, _ := strconv.Atoi(request.HW.PhysMemory)
 	*updateRequest = UpdateRequest{}
 	for _, app := range request.App {
+		var indexes []string
+		for _, data := range app.Data {
+			if data.Name == InstallDataName {
+				indexes = append(indexes, data.Index)
+			}
+		}
 		*updateRequest = append(*updateRequest, Extension{
-			ID:      app.AppID,
-			Version: app.Version,
+			ID:                 app.AppID,
+			Version:            app.Version,
+			Channel:            request.ProdChannel,
+			Platform:           request.OS,
+			Arch:               request.Arch,
+			ProdVersion:        request.ProdVersion,
+			Lang:               request.Lang,
+			PhysMemory:         physMemory,
+			PingOnly:           app.UpdateCheck == nil,
+			UpdateDisabled:     app.UpdateCheck != nil && app.UpdateCheck.UpdateDisabled == "true",
+			Ping:               app.Ping != nil,
+			DownloadPreference: request.DLPref,
+			InstallDataIndexes: indexes,
 		})
 	}
 
-	if request.Protocol != "3.0" && request.Protocol != "3.1" {
-		err = fmt.Errorf("request version: %v not supported", request.Protocol)
+	if !IsSupportedProtocol(request.Protocol) {
+		return &Error{Kind: ErrUnsupportedProtocol, Detail: fmt.Sprintf("request version %q", request.Protocol)}
 	}
+	return nil
+}
 
-	return err
+// IsSupportedProtocol returns true if requests using protocol are accepted
+func IsSupportedProtocol(protocol string) bool {
+	for _, supported := range SupportedProtocols {
+		if protocol == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseRequestProtocol returns the protocol version of an update request body
+func ParseRequestProtocol(data []byte) (string, error) {
+	return parseRequestAttr(data, "protocol")
+}
+
+// ParseRequestID returns the requestid of an update request body, which clients keep when retrying a request
+func ParseRequestID(data []byte) (string, error) {
+	return parseRequestAttr(data, "requestid")
+}
+
+// parseRequestAttr returns an attribute of the root element of an update request body
+func parseRequestAttr(data []byte, name string) (string, error) {
+	// Only the root element is needed, so the rest of the request isn't decoded
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			for _, attr := range start.Attr {
+				if attr.Name.Local == name {
+					return attr.Value, nil
+				}
+			}
+			return "", nil
+		}
+	}
 }
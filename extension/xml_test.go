@@ -76,6 +76,61 @@ func TestUpdateResponseMarshalXML(t *testing.T) {
 	assert.Equal(t, expectedOutput, string(xmlData))
 }
 
+func TestProtocolUpdateResponseMarshalXML(t *testing.T) {
+	// The response declares the requested protocol version
+	protocolResponse := ProtocolUpdateResponse{Protocol: "3.0", Extensions: UpdateResponse{}}
+	xmlData, err := xml.Marshal(&protocolResponse)
+	assert.Nil(t, err)
+	assert.Equal(t, `<response protocol="3.0" server="prod"></response>`, string(xmlData))
+}
+
+func TestParseRequestProtocol(t *testing.T) {
+	protocol, err := ParseRequestProtocol([]byte(extensiontest.ExtensionRequestFnFor("aomjjhallfgjeglblehebfpbcfeobpgk")("1.0.0")))
+	assert.Nil(t, err)
+	assert.Equal(t, "3.0", protocol)
+
+	protocol, err = ParseRequestProtocol([]byte(`<request version="chrome-53.0.2785.116"/>`))
+	assert.Nil(t, err)
+	assert.Equal(t, "", protocol)
+
+	_, err = ParseRequestProtocol([]byte(""))
+	assert.NotNil(t, err)
+}
+
+func TestParseRequestID(t *testing.T) {
+	requestID, err := ParseRequestID([]byte(extensiontest.ExtensionRequestFnFor("aomjjhallfgjeglblehebfpbcfeobpgk")("1.0.0")))
+	assert.Nil(t, err)
+	assert.Equal(t, "{b4f77b70-af29-462b-a637-8a3e4be5ecd9}", requestID)
+
+	requestID, err = ParseRequestID([]byte(`<request protocol="3.1"/>`))
+	assert.Nil(t, err)
+	assert.Equal(t, "", requestID)
+}
+
+func TestAcknowledgementsMarshalXML(t *testing.T) {
+	// Ping-only apps get a ping acknowledgement, and apps with updates disabled get noupdate
+	updateResponse := UpdateResponse{
+		{ID: "ldimlcelhnjgpjjemdjokpgeeikdinbm", PingOnly: true, Ping: true},
+		{ID: "bfdgpgibhagkpdlnjonhkabjoijopoge", UpdateDisabled: true, Ping: true},
+		{ID: "aomjjhallfgjeglblehebfpbcfeobpgk", UpdateDisabled: true},
+	}
+	xmlData, err := xml.Marshal(&updateResponse)
+	assert.Nil(t, err)
+	expectedOutput := `<response protocol="3.1" server="prod">
+    <app appid="ldimlcelhnjgpjjemdjokpgeeikdinbm">
+        <ping status="ok"></ping>
+    </app>
+    <app appid="bfdgpgibhagkpdlnjonhkabjoijopoge">
+        <updatecheck status="noupdate"></updatecheck>
+        <ping status="ok"></ping>
+    </app>
+    <app appid="aomjjhallfgjeglblehebfpbcfeobpgk">
+        <updatecheck status="noupdate"></updatecheck>
+    </app>
+</response>`
+	assert.Equal(t, expectedOutput, string(xmlData))
+}
+
 func TestUpdateRequestUnmarshalXML(t *testing.T) {
 	// Empty data returns an error
 	updateRequest := UpdateRequest{}
@@ -109,6 +164,11 @@ func TestUpdateRequestUnmarshalXML(t *testing.T) {
 	assert.Equal(t, 1, len(updateRequest))
 	assert.Equal(t, onePasswordID, updateRequest[0].ID)
 	assert.Equal(t, onePasswordVersion, updateRequest[0].Version)
+	assert.Equal(t, "stable", updateRequest[0].Channel)
+	assert.Equal(t, "mac", updateRequest[0].Platform)
+	assert.Equal(t, "x64", updateRequest[0].Arch)
+	assert.Equal(t, "53.0.2785.116", updateRequest[0].ProdVersion)
+	assert.Equal(t, 16, updateRequest[0].PhysMemory)
 
 	pdfJSID := "jdbefljfgobbmcidnmpjamcbhnbphjnb"
 	pdfJSVersion := "1.0.0"
@@ -122,10 +182,54 @@ func TestUpdateRequestUnmarshalXML(t *testing.T) {
 	assert.Equal(t, pdfJSID, updateRequest[1].ID)
 	assert.Equal(t, pdfJSVersion, updateRequest[1].Version)
 
+	// Apps with only a ping, or with updates disabled, are marked so they aren't offered updates
+	data = []byte(`<request protocol="3.1" version="chrome-53.0.2785.116" prodversion="53.0.2785.116" requestid="{b4f77b70-af29-462b-a637-8a3e4be5ecd9}" lang="" updaterchannel="stable" prodchannel="stable" os="mac" arch="x64" nacl_arch="x86-64">
+		  <app appid="` + onePasswordID + `" version="` + onePasswordVersion + `">
+		    <ping rd="4523" ping_freshness="{d7f5c8a0-e7c1-4f26-b9a1-4fbd6a7e3c1c}"/>
+		  </app>
+		  <app appid="` + pdfJSID + `" version="` + pdfJSVersion + `">
+		    <updatecheck updatedisabled="true"/>
+		  </app>
+		</request>`)
+	err = xml.Unmarshal(data, &updateRequest)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(updateRequest))
+	assert.True(t, updateRequest[0].PingOnly)
+	assert.True(t, updateRequest[0].Ping)
+	assert.False(t, updateRequest[0].UpdateDisabled)
+	assert.False(t, updateRequest[1].PingOnly)
+	assert.False(t, updateRequest[1].Ping)
+	assert.True(t, updateRequest[1].UpdateDisabled)
+
+	// Install data is requested by index, and other data elements are ignored
+	data = []byte(`<request protocol="3.1" version="chrome-53.0.2785.116" prodversion="53.0.2785.116" requestid="{b4f77b70-af29-462b-a637-8a3e4be5ecd9}" lang="" updaterchannel="stable" prodchannel="stable" os="mac" arch="x64" nacl_arch="x86-64">
+		  <app appid="` + onePasswordID + `" version="` + onePasswordVersion + `">
+		    <updatecheck/>
+		    <data name="install" index="referral"/>
+		    <data name="untrusted">abc</data>
+		  </app>
+		</request>`)
+	err = xml.Unmarshal(data, &updateRequest)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"referral"}, updateRequest[0].InstallDataIndexes)
+
+	// Supported protocol versions can be narrowed
+	defer func() {
+		SupportedProtocols = []string{"3.0", "3.1"}
+	}()
+	SupportedProtocols = []string{"3.1"}
+	err = xml.Unmarshal([]byte(onePasswordRequest(onePasswordVersion)), &updateRequest)
+	assert.Equal(t, ErrUnsupportedProtocol, Cause(err), "Protocol 3.0 should have an error when only 3.1 is supported")
+
 	// Check for unsupported protocol version
 	data = []byte(`<request protocol="2.0" version="chrome-53.0.2785.116" prodversion="53.0.2785.116" requestid="{b4f77b70-af29-462b-a637-8a3e4be5ecd9}" lang="" updaterchannel="stable" prodchannel="stable" os="mac" arch="x64" nacl_arch="x86-64"/>`)
 	err = xml.Unmarshal(data, &updateRequest)
-	assert.NotNil(t, err, "Unrecognized protocol should have an error")
+	assert.Equal(t, ErrUnsupportedProtocol, Cause(err), "Unrecognized protocol should have an error")
+
+	// Requests which can't be decoded are malformed
+	err = xml.Unmarshal([]byte("<text>For the alliance!</text>"), &updateRequest)
+	assert.Equal(t, ErrMalformedRequest, Cause(err))
+	assert.Equal(t, ErrMalformedRequest, Cause(RequestError(xml.Unmarshal([]byte("<request"), &updateRequest))))
 }
 
 func TestWebStoreUpdateResponseMarshalXML(t *testing.T) {
@@ -169,3 +273,42 @@ func TestWebStoreUpdateResponseMarshalXML(t *testing.T) {
 </gupdate>`
 	assert.Equal(t, expectedOutput, string(xmlData))
 }
+
+func TestWebStoreProtocol2ResponseMarshalXML(t *testing.T) {
+	allExtensionsMap := LoadExtensionsIntoMap(&OfferedExtensions)
+	darkThemeExtension, ok := allExtensionsMap["bfdgpgibhagkpdlnjonhkabjoijopoge"]
+	assert.True(t, ok)
+
+	// Legacy responses have the update2 namespace and the seconds elapsed since midnight
+	updateResponse := WebStoreProtocol2Response{ElapsedSeconds: 3600, Extensions: WebStoreUpdateResponse{darkThemeExtension}}
+	xmlData, err := xml.Marshal(&updateResponse)
+	assert.Nil(t, err)
+	expectedOutput := `<gupdate xmlns="http://www.google.com/update2/response" protocol="2.0" server="prod">
+    <daystart elapsed_seconds="3600"></daystart>
+    <app appid="bfdgpgibhagkpdlnjonhkabjoijopoge" status="ok">
+        <updatecheck status="ok" codebase="https://brave-core-ext.s3.brave.com/release/bfdgpgibhagkpdlnjonhkabjoijopoge/extension_1_0_0.crx" version="1.0.0" hash_sha256="ae517d6273a4fc126961cb026e02946db4f9dbb58e3d9bc29f5e1270e3ce9834"></updatecheck>
+    </app>
+</gupdate>`
+	assert.Equal(t, expectedOutput, string(xmlData))
+}
+
+func TestParseUpdateRequest(t *testing.T) {
+	request := extensiontest.NewRequest().App("aomjjhallfgjeglblehebfpbcfeobpgk", "4.7.0.90").Ping()
+
+	// XML and JSON bodies are told apart by their first character
+	for _, body := range []string{request.BuildXML(), "\n" + request.BuildJSON()} {
+		updateRequest, err := ParseUpdateRequest([]byte(body))
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(updateRequest))
+		assert.Equal(t, "aomjjhallfgjeglblehebfpbcfeobpgk", updateRequest[0].ID)
+		assert.True(t, updateRequest[0].Ping)
+	}
+
+	updateRequest, err := ParseUpdateRequest([]byte("<request"))
+	assert.Nil(t, updateRequest)
+	assert.Equal(t, ErrMalformedRequest, Cause(err))
+	_, err = ParseUpdateRequest([]byte(`{"request":{"protocol":"3.1"}}`))
+	assert.Equal(t, ErrUnsupportedProtocol, Cause(err))
+	_, err = ParseXMLUpdateRequest([]byte(request.BuildJSON()))
+	assert.Equal(t, ErrMalformedRequest, Cause(err))
+}
@@ -0,0 +1,345 @@
+// Package loadgen sends update checks to a server at a target rate, in a mix of the kinds browsers send,
+// and reports the latency percentiles of each kind, for capacity planning with realistic Omaha traffic.
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/brave/go-update/extension/extensiontest"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The kinds of update checks sent
+const (
+	// KindSingle is a POST update check for one extension in the catalog
+	KindSingle = "single"
+	// KindMulti is a POST update check for several extensions in the catalog, like a browser checking all its components
+	KindMulti = "multi"
+	// KindUnknown is a POST update check for one extension which isn't in the catalog, which is redirected
+	KindUnknown = "unknown"
+	// KindWebStore is a GET update check for one extension, like those of extensions installed from the web store
+	KindWebStore = "webstore"
+)
+
+// Kinds are the kinds of update checks, in the order they are reported
+var Kinds = []string{KindSingle, KindMulti, KindUnknown, KindWebStore}
+
+// Mix is the relative weight of each kind of update check by kind
+type Mix map[string]int
+
+// DefaultMix is mostly single extension checks, like the traffic of the component updater
+var DefaultMix = Mix{KindSingle: 70, KindMulti: 15, KindUnknown: 5, KindWebStore: 10}
+
+// ParseMix parses a mix like "single=70,multi=15,unknown=5,webstore=10". Kinds which aren't listed aren't sent.
+func ParseMix(value string) (Mix, error) {
+	mix := Mix{}
+	total := 0
+	for _, entry := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("mix entry %q must be kind=weight", entry)
+		}
+		known := false
+		for _, kind := range Kinds {
+			known = known || parts[0] == kind
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown kind %q, must be one of %s", parts[0], strings.Join(Kinds, ", "))
+		}
+		weight, err := strconv.Atoi(parts[1])
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("weight of %s must be a non-negative integer", parts[0])
+		}
+		mix[parts[0]] = weight
+		total += weight
+	}
+	if total == 0 {
+		return nil, errors.New("the mix must have a positive weight")
+	}
+	return mix, nil
+}
+
+// pick returns a kind at random according to the weights of mix
+func (mix Mix) pick(random *rand.Rand) string {
+	total := 0
+	for _, kind := range Kinds {
+		total += mix[kind]
+	}
+	n := random.Intn(total)
+	for _, kind := range Kinds {
+		if n < mix[kind] {
+			return kind
+		}
+		n -= mix[kind]
+	}
+	return KindSingle
+}
+
+// Config describes the traffic to send
+type Config struct {
+	// Target is the base URL of the server, like http://localhost:8192
+	Target string
+	// RPS is the rate of update checks per second, and Duration how long to send them for
+	RPS      float64
+	Duration time.Duration
+	// Concurrency is the most update checks waiting for a response at once. Checks due while
+	// all of them are waiting are skipped and counted, which means the server can't keep up with RPS.
+	Concurrency int
+	Mix         Mix
+	// IDs are extensions in the catalog of the server
+	IDs []string
+	// AppsPerCheck is the number of extensions in multi extension checks
+	AppsPerCheck int
+	// Outdated is the share of extensions checked from version 0.0.0, which are offered an update.
+	// The others are checked from a version which is newer than any in the catalog.
+	Outdated float64
+	// Client sends the update checks, without following redirects if nil
+	Client *http.Client
+}
+
+// KindReport is the outcome of the update checks of one kind
+type KindReport struct {
+	Kind     string
+	Requests int
+	// Errors are checks which failed or were answered with an unexpected status
+	Errors int
+	// P50, P90, P99 and Max are latency percentiles of the checks which got a response
+	P50, P90, P99, Max time.Duration
+}
+
+// Report is the outcome of a run
+type Report struct {
+	Elapsed time.Duration
+	// Skipped are the checks which weren't sent because every worker was waiting for a response
+	Skipped int
+	Kinds   []KindReport
+	Total   KindReport
+}
+
+// result is the outcome of one update check
+type result struct {
+	kind    string
+	latency time.Duration
+	err     error
+}
+
+// Run sends update checks as described by config until its duration has elapsed or ctx is done
+func Run(ctx context.Context, config Config) (Report, error) {
+	if len(config.Target) == 0 || config.RPS <= 0 || config.Duration <= 0 || config.Concurrency <= 0 {
+		return Report{}, errors.New("the target, a positive rate, duration and concurrency are required")
+	}
+	if len(config.IDs) == 0 {
+		return Report{}, errors.New("at least one extension ID is required")
+	}
+	if config.Mix == nil {
+		config.Mix = DefaultMix
+	}
+	total := 0
+	for _, kind := range Kinds {
+		total += config.Mix[kind]
+	}
+	if total <= 0 {
+		return Report{}, errors.New("the mix must have a positive weight")
+	}
+	if config.AppsPerCheck <= 0 {
+		config.AppsPerCheck = 5
+	}
+	client := config.Client
+	if client == nil {
+		client = &http.Client{
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+	}
+	// Checks which are sent before the duration has elapsed are waited for, unless ctx is done
+	sending, cancel := context.WithTimeout(ctx, config.Duration)
+	defer cancel()
+
+	kinds := make(chan string, config.Concurrency)
+	results := make(chan result, config.Concurrency)
+	var workers sync.WaitGroup
+	for i := 0; i < config.Concurrency; i++ {
+		workers.Add(1)
+		go func(seed int64) {
+			defer workers.Done()
+			random := rand.New(rand.NewSource(seed))
+			for kind := range kinds {
+				start := time.Now()
+				err := check(ctx, client, config, kind, random)
+				results <- result{kind: kind, latency: time.Since(start), err: err}
+			}
+		}(time.Now().UnixNano() + int64(i))
+	}
+	latencies := map[string][]time.Duration{}
+	errorCounts := map[string]int{}
+	collected := make(chan bool)
+	go func() {
+		for result := range results {
+			if result.err != nil {
+				errorCounts[result.kind]++
+				continue
+			}
+			latencies[result.kind] = append(latencies[result.kind], result.latency)
+		}
+		close(collected)
+	}()
+
+	start := time.Now()
+	skipped := 0
+	random := rand.New(rand.NewSource(start.UnixNano()))
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / config.RPS))
+	for done := false; !done; {
+		select {
+		case <-sending.Done():
+			done = true
+		case <-ticker.C:
+			select {
+			case kinds <- config.Mix.pick(random):
+			default:
+				skipped++
+			}
+		}
+	}
+	ticker.Stop()
+	close(kinds)
+	workers.Wait()
+	close(results)
+	<-collected
+
+	report := Report{Elapsed: time.Since(start), Skipped: skipped, Total: KindReport{Kind: "total"}}
+	all := []time.Duration{}
+	for _, kind := range Kinds {
+		if _, ok := config.Mix[kind]; !ok {
+			continue
+		}
+		report.Kinds = append(report.Kinds, summarize(kind, latencies[kind], errorCounts[kind]))
+		all = append(all, latencies[kind]...)
+		report.Total.Errors += errorCounts[kind]
+	}
+	report.Total = summarize("total", all, report.Total.Errors)
+	return report, nil
+}
+
+// summarize returns the report of the checks of kind which got a response in latencies and failed
+func summarize(kind string, latencies []time.Duration, failed int) KindReport {
+	report := KindReport{Kind: kind, Requests: len(latencies) + failed, Errors: failed}
+	if len(latencies) == 0 {
+		return report
+	}
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i] < latencies[j]
+	})
+	percentile := func(p float64) time.Duration {
+		return latencies[int(p*float64(len(latencies)-1))]
+	}
+	report.P50, report.P90, report.P99, report.Max = percentile(0.5), percentile(0.9), percentile(0.99), latencies[len(latencies)-1]
+	return report
+}
+
+// check sends one update check of kind, returning an error unless it is answered as expected
+func check(ctx context.Context, client *http.Client, config Config, kind string, random *rand.Rand) error {
+	version := func() string {
+		if random.Float64() < config.Outdated {
+			return "0.0.0"
+		}
+		return "9999.0.0"
+	}
+	id := config.IDs[random.Intn(len(config.IDs))]
+	expected := http.StatusOK
+	var req *http.Request
+	var err error
+	switch kind {
+	case KindWebStore:
+		x := url.QueryEscape("id=" + id + "&v=" + version() + "&uc")
+		req, err = http.NewRequest(http.MethodGet, config.Target+"/extensions?os=linux&arch=x64&prodversion=0.0.0.0&x="+x, nil)
+	default:
+		request := extensiontest.NewRequest().RequestID(randomRequestID(random)).OS("linux").Arch("x64")
+		switch kind {
+		case KindMulti:
+			apps := config.AppsPerCheck
+			if apps > len(config.IDs) {
+				apps = len(config.IDs)
+			}
+			for _, i := range random.Perm(len(config.IDs))[:apps] {
+				request.App(config.IDs[i], version()).Ping()
+			}
+		case KindUnknown:
+			request.App(randomExtensionID(random), version()).Ping()
+			expected = http.StatusTemporaryRedirect
+		default:
+			request.App(id, version()).Ping()
+		}
+		req, err = http.NewRequest(http.MethodPost, config.Target+"/extensions", bytes.NewBufferString(request.BuildXML()))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/xml")
+		}
+	}
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(ioutil.Discard, resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != expected {
+		return fmt.Errorf("%s update check answered %d", kind, resp.StatusCode)
+	}
+	return nil
+}
+
+// randomRequestID returns a request ID like browsers send, different for each check so they aren't taken for retries
+func randomRequestID(random *rand.Rand) string {
+	return fmt.Sprintf("{%08x-%04x-%04x-%04x-%012x}", random.Uint32(), random.Intn(1<<16), random.Intn(1<<16), random.Intn(1<<16), random.Int63n(1<<48))
+}
+
+// randomExtensionID returns an extension ID which is very unlikely to be in any catalog
+func randomExtensionID(random *rand.Rand) string {
+	id := make([]byte, 32)
+	for i := range id {
+		id[i] = byte('a' + random.Intn(16))
+	}
+	return string(id)
+}
+
+// Write prints report as a table
+func (report Report) Write(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "%-10s %9s %7s %10s %10s %10s %10s\n", "kind", "requests", "errors", "p50", "p90", "p99", "max")
+	if err != nil {
+		return err
+	}
+	for _, kind := range append(report.Kinds, report.Total) {
+		_, err = fmt.Fprintf(w, "%-10s %9d %7d %10s %10s %10s %10s\n", kind.Kind, kind.Requests, kind.Errors,
+			round(kind.P50), round(kind.P90), round(kind.P99), round(kind.Max))
+		if err != nil {
+			return err
+		}
+	}
+	rate := float64(report.Total.Requests) / report.Elapsed.Seconds()
+	_, err = fmt.Fprintf(w, "%.1f requests per second over %s, %d skipped\n", rate, round(report.Elapsed), report.Skipped)
+	return err
+}
+
+// round rounds latencies for printing
+func round(d time.Duration) time.Duration {
+	if d > time.Second {
+		return d.Round(time.Millisecond)
+	}
+	return d.Round(time.Microsecond)
+}
@@ -0,0 +1,100 @@
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"github.com/brave/go-update/extension"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseMix(t *testing.T) {
+	mix, err := ParseMix("single=70, multi=30,webstore=0")
+	assert.Nil(t, err)
+	assert.Equal(t, Mix{KindSingle: 70, KindMulti: 30, KindWebStore: 0}, mix)
+
+	for _, value := range []string{"", "single", "single=x", "single=-1", "other=1", "single=0,multi=0"} {
+		_, err = ParseMix(value)
+		assert.NotNil(t, err, value)
+	}
+}
+
+func TestRun(t *testing.T) {
+	known := map[string]bool{
+		"hkgkpgldcfgbgnhjdokckbpbenejbkhd": true,
+		"bfdgpgibhagkpdlnjonhkabjoijopoge": true,
+		"gccbbckogglekeggclmmekhdbmbmdbdi": true,
+	}
+	ids := []string{}
+	for id := range known {
+		ids = append(ids, id)
+	}
+	var mutex sync.Mutex
+	counts := map[string]int{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if r.Method == http.MethodGet {
+			counts[KindWebStore]++
+			if !known[strings.TrimPrefix(strings.SplitN(r.URL.Query().Get("x"), "&", 2)[0], "id=")] {
+				w.WriteHeader(http.StatusNotFound)
+			}
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		request, err := extension.ParseUpdateRequest(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, app := range request {
+			if !known[app.ID] {
+				counts[KindUnknown]++
+				http.Redirect(w, r, "https://example.com", http.StatusTemporaryRedirect)
+				return
+			}
+		}
+		if len(request) > 1 {
+			counts[KindMulti]++
+		} else {
+			counts[KindSingle]++
+		}
+	}))
+	defer ts.Close()
+
+	report, err := Run(context.Background(), Config{
+		Target:       ts.URL,
+		RPS:          200,
+		Duration:     500 * time.Millisecond,
+		Concurrency:  4,
+		Mix:          Mix{KindSingle: 1, KindMulti: 1, KindUnknown: 1, KindWebStore: 1},
+		IDs:          ids,
+		AppsPerCheck: 2,
+		Outdated:     0.5,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, report.Total.Errors)
+	assert.Len(t, report.Kinds, 4)
+	total := 0
+	for _, kind := range report.Kinds {
+		assert.Equal(t, counts[kind.Kind], kind.Requests, kind.Kind)
+		assert.True(t, kind.P50 <= kind.P90 && kind.P90 <= kind.P99 && kind.P99 <= kind.Max, kind.Kind)
+		total += kind.Requests
+	}
+	assert.Equal(t, total, report.Total.Requests)
+	assert.True(t, total > 0)
+
+	var out bytes.Buffer
+	assert.Nil(t, report.Write(&out))
+	assert.Contains(t, out.String(), "webstore")
+	assert.Contains(t, out.String(), "requests per second")
+
+	_, err = Run(context.Background(), Config{Target: ts.URL, RPS: 1, Duration: time.Second, Concurrency: 1})
+	assert.NotNil(t, err)
+}
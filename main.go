@@ -1,9 +1,30 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"github.com/brave/go-update/cli"
 	"github.com/brave/go-update/server"
+	"os"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		if os.Args[1] == "help" {
+			cli.Usage(os.Stdout)
+			return
+		}
+		if command, ok := cli.Commands[os.Args[1]]; ok {
+			err := command(os.Args[2:], os.Stdout)
+			if err == flag.ErrHelp {
+				os.Exit(2)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "go-update %s: %v\n", os.Args[1], err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
 	server.StartServer()
 }
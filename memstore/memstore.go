@@ -0,0 +1,73 @@
+// Package memstore implements an in-memory extensions catalog, so the server can run
+// for local development and tests without any AWS setup
+package memstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/brave/go-update/extension"
+	"io/ioutil"
+	"sort"
+	"sync"
+)
+
+// Store is an in-memory catalog. Saved extensions are lost when the process exits.
+type Store struct {
+	mutex      sync.RWMutex
+	extensions map[string]extension.Extension
+}
+
+// New creates a store seeded with extensions
+func New(extensions extension.Extensions) *Store {
+	store := &Store{extensions: map[string]extension.Extension{}}
+	for _, ext := range extensions {
+		store.extensions[ext.ID] = ext
+	}
+	return store
+}
+
+// NewFromFile creates a store seeded from a JSON file holding a list of extensions,
+// like the one returned by GET /api/admin/catalog
+func NewFromFile(path string) (*Store, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	extensions := extension.Extensions{}
+	err = json.Unmarshal(data, &extensions)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing seed %s: %v", path, err)
+	}
+	return New(extensions), nil
+}
+
+// LoadExtensions returns every extension in the store, ordered by ID
+func (store *Store) LoadExtensions(ctx context.Context) (extension.Extensions, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	extensions := extension.Extensions{}
+	for _, ext := range store.extensions {
+		extensions = append(extensions, ext)
+	}
+	sort.Slice(extensions, func(i, j int) bool {
+		return extensions[i].ID < extensions[j].ID
+	})
+	return extensions, nil
+}
+
+// SaveExtension creates or replaces the extension in the store
+func (store *Store) SaveExtension(ctx context.Context, ext extension.Extension) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.extensions[ext.ID] = ext
+	return nil
+}
+
+// DeleteExtension removes the extension with id from the store
+func (store *Store) DeleteExtension(ctx context.Context, id string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	delete(store.extensions, id)
+	return nil
+}
@@ -0,0 +1,51 @@
+package memstore
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/brave/go-update/extension"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	store := New(extension.OfferedExtensions)
+	extensions, err := store.LoadExtensions(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, extension.LoadExtensionsIntoMap(&extension.OfferedExtensions), extension.LoadExtensionsIntoMap(&extensions))
+	for i := 1; i < len(extensions); i++ {
+		assert.True(t, extensions[i-1].ID < extensions[i].ID)
+	}
+
+	ext := extensions[0]
+	ext.Version = "99.0.0"
+	assert.Nil(t, store.SaveExtension(context.Background(), ext))
+	extensions, err = store.LoadExtensions(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "99.0.0", extensions[0].Version)
+	assert.Equal(t, len(extension.OfferedExtensions), len(extensions))
+}
+
+func TestNewFromFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-update-memstore")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "seed.json")
+	seed := extension.Extensions{{ID: "aomjjhallfgjeglblehebfpbcfeobpgk", Version: "1.0.0", SHA256: "abc", Title: "test"}}
+	data, err := json.Marshal(seed)
+	assert.Nil(t, err)
+	assert.Nil(t, ioutil.WriteFile(path, data, 0644))
+
+	store, err := NewFromFile(path)
+	assert.Nil(t, err)
+	extensions, err := store.LoadExtensions(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, seed, extensions)
+
+	assert.Nil(t, ioutil.WriteFile(path, []byte("not json"), 0644))
+	_, err = NewFromFile(path)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,119 @@
+// Package privacy scrubs client identifiers like request, session and machine IDs and IP addresses
+// before they reach logs, error reports or analytics.
+package privacy
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Modes of a Scrubber
+const (
+	// ModeOff leaves identifiers unchanged
+	ModeOff = "off"
+	// ModeHash replaces IDs with a keyed hash, so events from one client can still be correlated,
+	// and truncates IP addresses to their /24 or /48 network
+	ModeHash = "hash"
+	// ModeGDPR drops IDs and IP addresses entirely
+	ModeGDPR = "gdpr"
+)
+
+// ipHeaders are the request headers which can carry the client IP address
+var ipHeaders = []string{"X-Forwarded-For", "X-Real-IP", "True-Client-IP", "CF-Connecting-IP"}
+
+// Scrubber removes or hashes client identifiers.
+// A nil *Scrubber is valid and leaves everything unchanged.
+type Scrubber struct {
+	mode string
+	key  []byte
+}
+
+// NewScrubber returns a scrubber for mode. In ModeHash IDs are hashed with salt,
+// or with a random key if salt is empty, in which case hashes only match within this process.
+func NewScrubber(mode string, salt string) *Scrubber {
+	key := []byte(salt)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		_, _ = rand.Read(key)
+	}
+	return &Scrubber{mode: mode, key: key}
+}
+
+// ID scrubs a request, session or machine ID
+func (scrubber *Scrubber) ID(id string) string {
+	if scrubber == nil || len(id) == 0 {
+		return id
+	}
+	switch scrubber.mode {
+	case ModeOff:
+		return id
+	case ModeHash:
+		mac := hmac.New(sha256.New, scrubber.key)
+		_, _ = mac.Write([]byte(id))
+		return hex.EncodeToString(mac.Sum(nil)[:16])
+	default:
+		return ""
+	}
+}
+
+// IP scrubs an IP address, which may include a port
+func (scrubber *Scrubber) IP(addr string) string {
+	if scrubber == nil || len(addr) == 0 {
+		return addr
+	}
+	switch scrubber.mode {
+	case ModeOff:
+		return addr
+	case ModeHash:
+		host := addr
+		if h, _, err := net.SplitHostPort(addr); err == nil {
+			host = h
+		}
+		ip := net.ParseIP(strings.TrimSpace(host))
+		if ip == nil {
+			return ""
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			return ip4.Mask(net.CIDRMask(24, 32)).String()
+		}
+		return ip.Mask(net.CIDRMask(48, 128)).String()
+	default:
+		return ""
+	}
+}
+
+// Middleware scrubs the client IP address from the request and its forwarding headers
+// so handlers, the request logger and error reports never see it.
+// It must run after anything which needs the real address, like the server's trusted proxy handling.
+func (scrubber *Scrubber) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if scrubber == nil || scrubber.mode == ModeOff {
+			next.ServeHTTP(w, r)
+			return
+		}
+		r.RemoteAddr = scrubber.IP(r.RemoteAddr)
+		for _, header := range ipHeaders {
+			values := r.Header.Get(header)
+			if len(values) == 0 {
+				continue
+			}
+			scrubbed := []string{}
+			for _, value := range strings.Split(values, ",") {
+				if ip := scrubber.IP(value); len(ip) != 0 {
+					scrubbed = append(scrubbed, ip)
+				}
+			}
+			if len(scrubbed) == 0 {
+				r.Header.Del(header)
+			} else {
+				r.Header.Set(header, strings.Join(scrubbed, ", "))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,68 @@
+package privacy
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestScrubberID(t *testing.T) {
+	var scrubber *Scrubber
+	assert.Equal(t, "{b4f77b70}", scrubber.ID("{b4f77b70}"))
+	assert.Equal(t, "{b4f77b70}", NewScrubber(ModeOff, "").ID("{b4f77b70}"))
+	assert.Equal(t, "", NewScrubber(ModeGDPR, "").ID("{b4f77b70}"))
+
+	scrubber = NewScrubber(ModeHash, "salt")
+	hashed := scrubber.ID("{b4f77b70}")
+	assert.Equal(t, 32, len(hashed))
+	assert.Equal(t, hashed, scrubber.ID("{b4f77b70}"))
+	assert.NotEqual(t, hashed, scrubber.ID("{b4f77b71}"))
+	assert.Equal(t, hashed, NewScrubber(ModeHash, "salt").ID("{b4f77b70}"))
+	assert.NotEqual(t, hashed, NewScrubber(ModeHash, "pepper").ID("{b4f77b70}"))
+	assert.NotEqual(t, hashed, NewScrubber(ModeHash, "").ID("{b4f77b70}"))
+	assert.Equal(t, "", scrubber.ID(""))
+}
+
+func TestScrubberIP(t *testing.T) {
+	scrubber := NewScrubber(ModeHash, "")
+	assert.Equal(t, "203.0.113.0", scrubber.IP("203.0.113.54"))
+	assert.Equal(t, "203.0.113.0", scrubber.IP("203.0.113.54:52311"))
+	assert.Equal(t, "2001:db8:85a3::", scrubber.IP("2001:db8:85a3:8d3:1319:8a2e:370:7348"))
+	assert.Equal(t, "2001:db8:85a3::", scrubber.IP("[2001:db8:85a3:8d3:1319:8a2e:370:7348]:443"))
+	assert.Equal(t, "", scrubber.IP("not an ip"))
+	assert.Equal(t, "", NewScrubber(ModeGDPR, "").IP("203.0.113.54"))
+	assert.Equal(t, "203.0.113.54", NewScrubber(ModeOff, "").IP("203.0.113.54"))
+}
+
+func TestMiddleware(t *testing.T) {
+	var remoteAddr string
+	var header http.Header
+	handler := func(scrubber *Scrubber) http.Handler {
+		return scrubber.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			remoteAddr = r.RemoteAddr
+			header = r.Header
+		}))
+	}
+	request := func() *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/extensions", nil)
+		r.RemoteAddr = "203.0.113.54:52311"
+		r.Header.Set("X-Forwarded-For", "198.51.100.7, 10.0.0.1")
+		r.Header.Set("X-Real-IP", "198.51.100.7")
+		return r
+	}
+
+	handler(NewScrubber(ModeHash, "")).ServeHTTP(httptest.NewRecorder(), request())
+	assert.Equal(t, "203.0.113.0", remoteAddr)
+	assert.Equal(t, "198.51.100.0, 10.0.0.0", header.Get("X-Forwarded-For"))
+	assert.Equal(t, "198.51.100.0", header.Get("X-Real-IP"))
+
+	handler(NewScrubber(ModeGDPR, "")).ServeHTTP(httptest.NewRecorder(), request())
+	assert.Equal(t, "", remoteAddr)
+	assert.Equal(t, "", header.Get("X-Forwarded-For"))
+	assert.Equal(t, "", header.Get("X-Real-IP"))
+
+	handler(nil).ServeHTTP(httptest.NewRecorder(), request())
+	assert.Equal(t, "203.0.113.54:52311", remoteAddr)
+	assert.Equal(t, "198.51.100.7, 10.0.0.1", header.Get("X-Forwarded-For"))
+}
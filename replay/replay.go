@@ -0,0 +1,177 @@
+// Package replay records a sample of update checks with the responses they were given, anonymized,
+// and replays them against a handler or server to find responses which changed,
+// so a new build can be tested against the shape of real traffic before it is deployed.
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/brave/go-update/events"
+	"github.com/brave/go-update/privacy"
+	chiware "github.com/go-chi/chi/middleware"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// maxBodySize is the largest update check body which is recorded, like the limit of the update handlers
+const maxBodySize = 1024 * 1024 * 10
+
+// Recording is an update check and the response it was given
+type Recording struct {
+	Time   time.Time `json:"time"`
+	Method string    `json:"method"`
+	// Host decides the tenant of the request
+	Host string `json:"host,omitempty"`
+	// URL is the path and query the request was sent to
+	URL      string            `json:"url"`
+	Header   map[string]string `json:"header,omitempty"`
+	Body     string            `json:"body,omitempty"`
+	Status   int               `json:"status"`
+	Response string            `json:"response"`
+}
+
+// recordedHeaders are the request headers which are recorded, they describe the client rather than identify it
+var recordedHeaders = []string{"Accept", "Content-Type", "User-Agent", "X-Goog-Update-AppId", "X-Goog-Update-Interactivity", "X-Goog-Update-Updater"}
+
+// clientIDRegexp matches the client IDs of XML and JSON update checks
+var clientIDRegexp = regexp.MustCompile(`((?:requestid|sessionid|userid|machineid)="|"(?:requestid|sessionid|userid|machineid)"\s*:\s*")([^"]*)(")`)
+
+// volatileRegexp matches the parts of responses which differ between two answers to the same update check,
+// the seconds since midnight and the expiry and signature of signed download URLs
+var volatileRegexp = regexp.MustCompile(`(elapsed_seconds="|X-Amz-[A-Za-z]+=)[^"&]*`)
+
+// Recorder exports a sample of update checks as Recordings.
+// A nil *Recorder is valid and records nothing.
+type Recorder struct {
+	exporter   *events.Exporter
+	sampleRate float64
+	scrubber   *privacy.Scrubber
+}
+
+// NewRecorder records sampleRate of update checks, between 0 and 1, with exporter
+func NewRecorder(exporter *events.Exporter, sampleRate float64) *Recorder {
+	return &Recorder{exporter: exporter, sampleRate: sampleRate, scrubber: privacy.NewScrubber(privacy.ModeHash, "")}
+}
+
+// anonymize replaces the client IDs in an update check with hashes which only match within this process
+func (recorder *Recorder) anonymize(body []byte) string {
+	return clientIDRegexp.ReplaceAllStringFunc(string(body), func(match string) string {
+		parts := clientIDRegexp.FindStringSubmatch(match)
+		return parts[1] + recorder.scrubber.ID(parts[2]) + parts[3]
+	})
+}
+
+// isUpdateCheck returns true for requests to the extensions routes of the default catalog or a tenant
+func isUpdateCheck(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		return false
+	}
+	return strings.HasSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/extensions")
+}
+
+// Middleware records a sample of the update checks passing through it.
+// Client IP addresses and cookies are never recorded.
+func (recorder *Recorder) Middleware(next http.Handler) http.Handler {
+	if recorder == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isUpdateCheck(r) || rand.Float64() >= recorder.sampleRate {
+			next.ServeHTTP(w, r)
+			return
+		}
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxBodySize))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error reading body: %v", err), http.StatusBadRequest)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		var response bytes.Buffer
+		ww := chiware.NewWrapResponseWriter(w, r.ProtoMajor)
+		ww.Tee(&response)
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		recording := Recording{
+			Time:     time.Now().UTC(),
+			Method:   r.Method,
+			Host:     r.Host,
+			URL:      r.URL.RequestURI(),
+			Header:   map[string]string{},
+			Body:     recorder.anonymize(body),
+			Status:   status,
+			Response: response.String(),
+		}
+		for _, name := range recordedHeaders {
+			if value := r.Header.Get(name); len(value) != 0 {
+				recording.Header[name] = value
+			}
+		}
+		recorder.exporter.Export("", recording)
+	})
+}
+
+// Load reads recordings written one per line, like the files and objects of events.FileSink and events.S3Sink
+func Load(r io.Reader) ([]Recording, error) {
+	recordings := []Recording{}
+	decoder := json.NewDecoder(r)
+	for {
+		recording := Recording{}
+		err := decoder.Decode(&recording)
+		if err == io.EOF {
+			return recordings, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("recording %d: %v", len(recordings)+1, err)
+		}
+		recordings = append(recordings, recording)
+	}
+}
+
+// Result is the response a recording got when it was replayed
+type Result struct {
+	Recording Recording
+	Status    int
+	Response  string
+}
+
+// Changed returns true if the replayed response differs from the recorded one,
+// ignoring the parts which differ every time an update check is answered
+func (result Result) Changed() bool {
+	return result.Status != result.Recording.Status ||
+		normalize(result.Response) != normalize(result.Recording.Response)
+}
+
+// normalize blanks out the volatile parts of a response
+func normalize(response string) string {
+	return volatileRegexp.ReplaceAllString(response, "${1}")
+}
+
+// Replay sends every recording to handler and returns the responses in the same order.
+// Use an httputil.ReverseProxy as handler to replay against a running server.
+func Replay(handler http.Handler, recordings []Recording) []Result {
+	results := []Result{}
+	for _, recording := range recordings {
+		req := httptest.NewRequest(recording.Method, recording.URL, strings.NewReader(recording.Body))
+		if len(recording.Host) != 0 {
+			req.Host = recording.Host
+		}
+		for name, value := range recording.Header {
+			req.Header.Set(name, value)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		results = append(results, Result{Recording: recording, Status: recorder.Code, Response: recorder.Body.String()})
+	}
+	return results
+}
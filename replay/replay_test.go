@@ -0,0 +1,94 @@
+package replay
+
+import (
+	"bytes"
+	"github.com/brave/go-update/events"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAnonymize(t *testing.T) {
+	recorder := NewRecorder(nil, 1)
+	body := recorder.anonymize([]byte(`<request protocol="3.1" requestid="{abc}" sessionid="{def}"><app appid="x"/></request>`))
+	assert.NotContains(t, body, "{abc}")
+	assert.NotContains(t, body, "{def}")
+	assert.Contains(t, body, `<app appid="x"/>`)
+
+	body = recorder.anonymize([]byte(`{"request":{"requestid": "{abc}","@os":"mac"}}`))
+	assert.NotContains(t, body, "{abc}")
+	assert.Contains(t, body, `"@os":"mac"`)
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-update-replay")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "recordings.jsonl")
+
+	answer := `<response protocol="3.1"><daystart elapsed_seconds="100"/></response>`
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/xml")
+		_, _ = w.Write([]byte(answer))
+	})
+	exporter := events.NewExporter(&events.FileSink{Path: path}, events.DefaultSettings)
+	recorded := NewRecorder(exporter, 1).Middleware(handler)
+
+	req := httptest.NewRequest(http.MethodPost, "/extensions", strings.NewReader(`<request requestid="{abc}"/>`))
+	req.Header.Set("Content-Type", "application/xml")
+	req.Header.Set("Cookie", "secret")
+	req.RemoteAddr = "198.51.100.7:1234"
+	recorder := httptest.NewRecorder()
+	recorded.ServeHTTP(recorder, req)
+	assert.Equal(t, answer, recorder.Body.String())
+	// Only update checks are recorded
+	recorded.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/admin/catalog", nil))
+	exporter.Close()
+
+	data, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(data), "{abc}")
+	assert.NotContains(t, string(data), "secret")
+	assert.NotContains(t, string(data), "198.51.100.7")
+	recordings, err := Load(bytes.NewReader(data))
+	assert.Nil(t, err)
+	assert.Len(t, recordings, 1)
+	assert.Equal(t, "/extensions", recordings[0].URL)
+	assert.Equal(t, http.StatusOK, recordings[0].Status)
+	assert.Equal(t, map[string]string{"Content-Type": "application/xml"}, recordings[0].Header)
+
+	// The seconds since midnight differ every time and are ignored
+	answer = `<response protocol="3.1"><daystart elapsed_seconds="200"/></response>`
+	results := Replay(handler, recordings)
+	assert.Len(t, results, 1)
+	assert.False(t, results[0].Changed())
+
+	answer = `<response protocol="3.1"><daystart elapsed_seconds="200"/><app appid="x"/></response>`
+	results = Replay(handler, recordings)
+	assert.True(t, results[0].Changed())
+}
+
+func TestRecorderSampleRate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-update-replay")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "recordings.jsonl")
+
+	exporter := events.NewExporter(&events.FileSink{Path: path}, events.DefaultSettings)
+	handler := NewRecorder(exporter, 0).Middleware(http.NotFoundHandler())
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/extensions", strings.NewReader("<request/>")))
+	exporter.Close()
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	// A nil recorder passes requests through
+	var nilRecorder *Recorder
+	recorder := httptest.NewRecorder()
+	nilRecorder.Middleware(http.NotFoundHandler()).ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/extensions", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
@@ -0,0 +1,163 @@
+// Package secrets loads credentials from the environment, AWS Secrets Manager or SSM Parameter Store
+// so they don't have to be passed to the server as long-lived environment variables.
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"log"
+	"os"
+	"time"
+)
+
+// Provider looks up the current value of a secret by name
+type Provider interface {
+	GetSecret(ctx context.Context, name string) (string, error)
+}
+
+// Env reads each secret from the environment variable of the same name
+type Env struct{}
+
+// GetSecret returns the environment variable name, which must be set
+func (Env) GetSecret(ctx context.Context, name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
+
+// SecretsManagerAPI is the part of the Secrets Manager client used by SecretsManager
+type SecretsManagerAPI interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+// SecretsManager reads secrets from AWS Secrets Manager, where name is the secret ID or ARN
+type SecretsManager struct {
+	Client SecretsManagerAPI
+}
+
+// GetSecret returns the current version of the secret string
+func (store SecretsManager) GetSecret(ctx context.Context, name string) (string, error) {
+	result, err := store.Client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(name),
+	})
+	if err != nil {
+		return "", err
+	}
+	if result.SecretString == nil {
+		return "", fmt.Errorf("secret %s is not a string", name)
+	}
+	return *result.SecretString, nil
+}
+
+// SSMAPI is the part of the SSM client used by ParameterStore
+type SSMAPI interface {
+	GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error)
+}
+
+// ParameterStore reads secrets from SSM Parameter Store, decrypting SecureString parameters
+type ParameterStore struct {
+	Client SSMAPI
+}
+
+// GetSecret returns the current value of the parameter
+func (store ParameterStore) GetSecret(ctx context.Context, name string) (string, error) {
+	result, err := store.Client.GetParameter(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return "", err
+	}
+	if result.Parameter == nil || result.Parameter.Value == nil {
+		return "", fmt.Errorf("parameter %s has no value", name)
+	}
+	return *result.Parameter.Value, nil
+}
+
+// Watch loads the secret name and calls apply with its value.
+// If interval is positive the secret is then polled in the background until ctx is done,
+// and apply is called again each time it is rotated. Failed polls keep the current value.
+func Watch(ctx context.Context, provider Provider, name string, interval time.Duration, apply func(string)) error {
+	value, err := provider.GetSecret(ctx, name)
+	if err != nil {
+		return fmt.Errorf("error loading secret %s: %v", name, err)
+	}
+	apply(value)
+	if interval <= 0 {
+		return nil
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			latest, err := provider.GetSecret(ctx, name)
+			if err != nil {
+				log.Printf("error refreshing secret %s: %v\n", name, err)
+				continue
+			}
+			if latest != value {
+				value = latest
+				apply(value)
+			}
+		}
+	}()
+	return nil
+}
+
+// awsCredentials is the JSON form of AWS credentials stored in a secret
+type awsCredentials struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	SessionToken    string `json:"SessionToken"`
+}
+
+// credentialsProvider adapts a secret to the AWS SDK credentials provider interface
+type credentialsProvider struct {
+	provider Provider
+	name     string
+	interval time.Duration
+}
+
+// NewAWSCredentials returns AWS credentials read from the secret name, which holds a JSON object
+// like {"AccessKeyId": "...", "SecretAccessKey": "...", "SessionToken": "..."}.
+// The credentials are cached, and if interval is positive the secret is read again once they are that old,
+// so rotated keys are picked up.
+func NewAWSCredentials(provider Provider, name string, interval time.Duration) aws.CredentialsProvider {
+	return aws.NewCredentialsCache(&credentialsProvider{provider: provider, name: name, interval: interval})
+}
+
+// Retrieve reads the credentials from the secret
+func (p *credentialsProvider) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	value, err := p.provider.GetSecret(ctx, p.name)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+	creds := awsCredentials{}
+	err = json.Unmarshal([]byte(value), &creds)
+	if err != nil {
+		return aws.Credentials{}, fmt.Errorf("secret %s is not AWS credentials: %v", p.name, err)
+	}
+	if len(creds.AccessKeyID) == 0 || len(creds.SecretAccessKey) == 0 {
+		return aws.Credentials{}, errors.New("secret " + p.name + " is missing AccessKeyId or SecretAccessKey")
+	}
+	return aws.Credentials{
+		AccessKeyID:     creds.AccessKeyID,
+		SecretAccessKey: creds.SecretAccessKey,
+		SessionToken:    creds.SessionToken,
+		Source:          "secrets",
+		CanExpire:       p.interval > 0,
+		Expires:         time.Now().Add(p.interval),
+	}, nil
+}
@@ -0,0 +1,123 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeSecretsManager struct {
+	values map[string]string
+}
+
+func (f fakeSecretsManager) GetSecretValue(ctx context.Context, input *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	value, ok := f.values[*input.SecretId]
+	if !ok {
+		return nil, errors.New("ResourceNotFoundException")
+	}
+	return &secretsmanager.GetSecretValueOutput{SecretString: aws.String(value)}, nil
+}
+
+type fakeSSM struct {
+	values map[string]string
+}
+
+func (f fakeSSM) GetParameter(ctx context.Context, input *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error) {
+	value, ok := f.values[*input.Name]
+	if !ok || !*input.WithDecryption {
+		return nil, errors.New("ParameterNotFound")
+	}
+	return &ssm.GetParameterOutput{Parameter: &types.Parameter{Value: aws.String(value)}}, nil
+}
+
+// rotatingProvider returns the values in order, repeating the last one
+type rotatingProvider struct {
+	mutex  sync.Mutex
+	values []string
+}
+
+func (p *rotatingProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	value := p.values[0]
+	if len(p.values) > 1 {
+		p.values = p.values[1:]
+	}
+	return value, nil
+}
+
+func TestProviders(t *testing.T) {
+	ctx := context.Background()
+	assert.Nil(t, os.Setenv("GO_UPDATE_TEST_SECRET", "env-value"))
+	defer os.Unsetenv("GO_UPDATE_TEST_SECRET")
+	value, err := Env{}.GetSecret(ctx, "GO_UPDATE_TEST_SECRET")
+	assert.Nil(t, err)
+	assert.Equal(t, "env-value", value)
+	_, err = Env{}.GetSecret(ctx, "GO_UPDATE_TEST_MISSING")
+	assert.NotNil(t, err)
+
+	secretsManager := SecretsManager{Client: fakeSecretsManager{values: map[string]string{"go-update/tokens": "a,b"}}}
+	value, err = secretsManager.GetSecret(ctx, "go-update/tokens")
+	assert.Nil(t, err)
+	assert.Equal(t, "a,b", value)
+	_, err = secretsManager.GetSecret(ctx, "go-update/missing")
+	assert.NotNil(t, err)
+
+	parameterStore := ParameterStore{Client: fakeSSM{values: map[string]string{"/go-update/tokens": "c"}}}
+	value, err = parameterStore.GetSecret(ctx, "/go-update/tokens")
+	assert.Nil(t, err)
+	assert.Equal(t, "c", value)
+	_, err = parameterStore.GetSecret(ctx, "/go-update/missing")
+	assert.NotNil(t, err)
+}
+
+func TestWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	provider := &rotatingProvider{values: []string{"first", "first", "second"}}
+	values := make(chan string, 10)
+	err := Watch(ctx, provider, "tokens", time.Millisecond, func(value string) {
+		values <- value
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "first", <-values)
+	// Unchanged values aren't applied again
+	assert.Equal(t, "second", <-values)
+
+	err = Watch(ctx, Env{}, "GO_UPDATE_TEST_MISSING", 0, func(string) {
+		t.Error("apply should not be called when the secret can't be loaded")
+	})
+	assert.NotNil(t, err)
+}
+
+func TestNewAWSCredentials(t *testing.T) {
+	provider := &rotatingProvider{values: []string{
+		`{"AccessKeyId":"AKID1","SecretAccessKey":"secret1"}`,
+		`{"AccessKeyId":"AKID2","SecretAccessKey":"secret2","SessionToken":"token2"}`,
+	}}
+	creds := NewAWSCredentials(provider, "s3", time.Millisecond)
+	value, err := creds.Retrieve(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "AKID1", value.AccessKeyID)
+	assert.Equal(t, "secret1", value.SecretAccessKey)
+
+	// Rotated keys are picked up once the credentials expire
+	time.Sleep(2 * time.Millisecond)
+	value, err = creds.Retrieve(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "AKID2", value.AccessKeyID)
+	assert.Equal(t, "token2", value.SessionToken)
+
+	_, err = NewAWSCredentials(&rotatingProvider{values: []string{`{"AccessKeyId":"AKID"}`}}, "s3", 0).Retrieve(context.Background())
+	assert.NotNil(t, err)
+	_, err = NewAWSCredentials(&rotatingProvider{values: []string{"not json"}}, "s3", 0).Retrieve(context.Background())
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/brave/go-update/config"
+	"io/ioutil"
+	"net/http"
+)
+
+type adminListenerKey struct{}
+
+// viaAdminListener marks requests to handler as coming through the admin listener
+func viaAdminListener(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), adminListenerKey{}, true)))
+	})
+}
+
+// adminListenerOnly hides routes from requests which didn't come through the admin listener when required is true,
+// so the admin API isn't reachable from the public listener at all
+func adminListenerOnly(required bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !required {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if via, _ := r.Context().Value(adminListenerKey{}).(bool); !via {
+				http.NotFound(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// newAdminTLSConfig requires clients of the admin listener to present a certificate issued by one of the CAs in clientCAFile
+func newAdminTLSConfig(clientCAFile string) (*tls.Config, error) {
+	data, err := ioutil.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%s has no PEM certificates", clientCAFile)
+	}
+	return &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  pool,
+		MinVersion: tls.VersionTLS12,
+	}, nil
+}
+
+// newAdminServer creates the server for the admin API on cfg.AdminAddr, which only accepts clients with a certificate.
+// handler must have been created with WithAdminListener so it only serves the admin API to this server.
+func newAdminServer(cfg config.Config, handler http.Handler) (*http.Server, error) {
+	tlsConfig, err := newAdminTLSConfig(cfg.AdminClientCA)
+	if err != nil {
+		return nil, err
+	}
+	srv := NewHTTPServer(cfg.AdminAddr, viaAdminListener(handler), cfg.Limits)
+	srv.TLSConfig = tlsConfig
+	return srv, nil
+}
@@ -0,0 +1,35 @@
+//go:build brotli
+// +build brotli
+
+package server
+
+import (
+	"bytes"
+	"github.com/andybalholm/brotli"
+	"sync"
+)
+
+// brotliLevel trades a little compression for speed, since responses are compressed as they are served
+const brotliLevel = 5
+
+func init() {
+	encoders["br"] = brotliCompress
+}
+
+var brotliWriters = sync.Pool{New: func() interface{} {
+	return brotli.NewWriterLevel(nil, brotliLevel)
+}}
+
+func brotliCompress(body []byte) ([]byte, error) {
+	var out bytes.Buffer
+	w := brotliWriters.Get().(*brotli.Writer)
+	defer brotliWriters.Put(w)
+	w.Reset(&out)
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
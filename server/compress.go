@@ -0,0 +1,205 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"github.com/prometheus/client_golang/prometheus"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// compressedCacheBytes bounds the size of the cached compressed responses, which are all dropped when it is reached
+const compressedCacheBytes = 16 << 20
+
+var compressedResponses = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "compressed_responses_total",
+	Help: "Number of responses compressed, by content coding and whether the compressed body was cached.",
+}, []string{"encoding", "cache"})
+
+func init() {
+	prometheus.MustRegister(compressedResponses)
+}
+
+// encoders compress response bodies, by content coding. Brotli is added by builds with the brotli tag.
+var encoders = map[string]func(body []byte) ([]byte, error){
+	"gzip": gzipCompress,
+}
+
+// encodingPreference is the order content codings are picked in when a client accepts several
+var encodingPreference = []string{"br", "gzip"}
+
+var gzipWriters = sync.Pool{New: func() interface{} {
+	return gzip.NewWriter(nil)
+}}
+
+func gzipCompress(body []byte) ([]byte, error) {
+	var out bytes.Buffer
+	w := gzipWriters.Get().(*gzip.Writer)
+	defer gzipWriters.Put(w)
+	w.Reset(&out)
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// compressedKey identifies a compressed response body by its content coding and the hash of the uncompressed body
+type compressedKey struct {
+	encoding string
+	sum      [sha256.Size]byte
+}
+
+var (
+	compressedMutex sync.Mutex
+	compressedCache = map[compressedKey][]byte{}
+	compressedSize  int
+)
+
+// compress returns body compressed with encoding. Identical responses, like the answers to the most common update
+// checks, are only compressed once.
+func compress(encoding string, body []byte) ([]byte, error) {
+	key := compressedKey{encoding: encoding, sum: sha256.Sum256(body)}
+	compressedMutex.Lock()
+	compressed, ok := compressedCache[key]
+	compressedMutex.Unlock()
+	if ok {
+		compressedResponses.WithLabelValues(encoding, "hit").Inc()
+		return compressed, nil
+	}
+	compressed, err := encoders[encoding](body)
+	if err != nil {
+		return nil, err
+	}
+	compressedResponses.WithLabelValues(encoding, "miss").Inc()
+	compressedMutex.Lock()
+	if compressedSize+len(compressed) > compressedCacheBytes {
+		compressedCache = map[compressedKey][]byte{}
+		compressedSize = 0
+	}
+	if len(compressed) <= compressedCacheBytes/16 {
+		compressedCache[key] = compressed
+		compressedSize += len(compressed)
+	}
+	compressedMutex.Unlock()
+	return compressed, nil
+}
+
+// acceptedEncoding returns the preferred content coding accepted by the Accept-Encoding header of r,
+// or an empty string if none is
+func acceptedEncoding(r *http.Request) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		ok := true
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64)
+				ok = err == nil && q > 0
+			}
+		}
+		accepted[coding] = ok
+	}
+	for _, encoding := range encodingPreference {
+		if _, supported := encoders[encoding]; !supported {
+			continue
+		}
+		if ok, listed := accepted[encoding]; ok || (!listed && accepted["*"]) {
+			return encoding
+		}
+	}
+	return ""
+}
+
+// isCompressible returns true for the content types of update responses, catalogs and other text
+func isCompressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "text/") || mediaType == "application/json" || mediaType == "application/xml" ||
+		strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml")
+}
+
+// compressResponses compresses text and JSON responses of at least minSize bytes with brotli or gzip, when the client
+// accepts them. Other responses, like CRX payloads, are passed through as they are written. 0 disables compression.
+func compressResponses(minSize int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if minSize <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encoding := acceptedEncoding(r)
+			if len(encoding) == 0 || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			cw := &compressWriter{ResponseWriter: w, encoding: encoding, minSize: minSize}
+			next.ServeHTTP(cw, r)
+			cw.finish()
+		})
+	}
+}
+
+// compressWriter buffers compressible successful responses to compress them once they are complete
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	minSize     int
+	status      int
+	wroteHeader bool
+	buffering   bool
+	buffer      bytes.Buffer
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	header := w.Header()
+	// Handlers which set the Content-Length, like chaos mode truncating responses, mean to send exactly those bytes
+	if status != http.StatusOK || len(header.Get("Content-Encoding")) != 0 || len(header.Get("Content-Length")) != 0 ||
+		!isCompressible(header.Get("Content-Type")) {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	header.Add("Vary", "Accept-Encoding")
+	w.status = status
+	w.buffering = true
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.buffering {
+		return w.ResponseWriter.Write(p)
+	}
+	return w.buffer.Write(p)
+}
+
+// finish sends the buffered response, compressed if it is large enough
+func (w *compressWriter) finish() {
+	if !w.buffering {
+		return
+	}
+	body := w.buffer.Bytes()
+	if len(body) >= w.minSize {
+		if compressed, err := compress(w.encoding, body); err == nil {
+			body = compressed
+			w.Header().Set("Content-Encoding", w.encoding)
+		}
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.ResponseWriter.WriteHeader(w.status)
+	_, _ = w.ResponseWriter.Write(body)
+}
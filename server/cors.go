@@ -0,0 +1,52 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+)
+
+// isAPIPath returns true for the JSON admin, catalog and stats endpoints, of the default catalog or a tenant
+func isAPIPath(path string) bool {
+	if strings.HasPrefix(path, "/t/") {
+		parts := strings.SplitN(path, "/", 5)
+		return len(parts) >= 4 && parts[3] == "api"
+	}
+	return strings.HasPrefix(path, "/api/") || path == "/openapi.json"
+}
+
+// corsAPI lets pages from origins call the admin, catalog and stats APIs with methods, for dashboards served
+// from another origin. Origins are matched exactly, or "*" allows every origin. Preflights are answered before
+// authorization, since browsers send them without the token.
+func corsAPI(origins []string, methods []string) func(http.Handler) http.Handler {
+	allowed := map[string]bool{}
+	for _, origin := range origins {
+		allowed[strings.TrimSuffix(origin, "/")] = true
+	}
+	allowMethods := strings.Join(methods, ", ")
+	return func(next http.Handler) http.Handler {
+		if len(allowed) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !isAPIPath(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Add("Vary", "Origin")
+			origin := r.Header.Get("Origin")
+			if len(origin) == 0 || !(allowed["*"] || allowed[origin]) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			if r.Method != http.MethodOptions || len(r.Header.Get("Access-Control-Request-Method")) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Methods", allowMethods)
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
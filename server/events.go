@@ -0,0 +1,53 @@
+package server
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/brave/go-update/config"
+	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/events"
+	"github.com/brave/go-update/replay"
+	"net/http"
+)
+
+// newEventExporter creates the exporter for the configured events sink, or returns nil if there isn't one
+func newEventExporter(ctx context.Context, cfg config.Config) (*events.Exporter, error) {
+	settings := events.DefaultSettings
+	settings.QueueSize = cfg.EventsQueueSize
+	settings.BatchSize = cfg.EventsBatchSize
+	settings.FlushInterval = cfg.EventsFlushInterval
+	var sink events.Sink
+	switch cfg.EventsSink {
+	case "kinesis":
+		awsConfig, err := controller.AWSConfig(ctx, cfg.AWSRegion)
+		if err != nil {
+			return nil, err
+		}
+		sink = events.KinesisSink{Client: kinesis.NewFromConfig(awsConfig), Stream: cfg.EventsKinesisStream}
+	case "kafka":
+		sink = events.KafkaRESTSink{URL: cfg.EventsKafkaRESTURL, Topic: cfg.EventsKafkaTopic, Client: &http.Client{}}
+	default:
+		return nil, nil
+	}
+	return events.NewExporter(sink, settings), nil
+}
+
+// newRecorder creates the recorder of a sample of update checks for the configured sink, or returns nil if none are recorded
+func newRecorder(ctx context.Context, cfg config.Config) (*replay.Recorder, error) {
+	if cfg.RecordSampleRate <= 0 {
+		return nil, nil
+	}
+	var sink events.Sink
+	switch cfg.RecordSink {
+	case "file":
+		sink = &events.FileSink{Path: cfg.RecordFile}
+	case "s3":
+		awsConfig, err := controller.AWSConfig(ctx, cfg.AWSRegion)
+		if err != nil {
+			return nil, err
+		}
+		sink = events.S3Sink{Client: s3.NewFromConfig(awsConfig), Bucket: cfg.RecordBucket, Prefix: cfg.RecordPrefix}
+	}
+	return replay.NewRecorder(events.NewExporter(sink, events.DefaultSettings), cfg.RecordSampleRate), nil
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"crypto/tls"
+	"github.com/brave/go-update/adminrpc"
+	"github.com/brave/go-update/config"
+	"github.com/brave/go-update/controller"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// newGRPCServer creates the server for the gRPC admin service on cfg.GRPCAddr. With an admin listener it uses the
+// same certificate and only accepts clients with a certificate, as the admin API isn't served anywhere else.
+// Calls are served with routerOptions, like requests to the handler they were given to.
+func newGRPCServer(cfg config.Config, logger *logrus.Logger, routerOptions *controller.Options) (*grpc.Server, error) {
+	options := []grpc.ServerOption{}
+	if len(cfg.AdminAddr) != 0 {
+		tlsConfig, err := newAdminTLSConfig(cfg.AdminClientCA)
+		if err != nil {
+			return nil, err
+		}
+		certificate, err := tls.LoadX509KeyPair(cfg.AdminTLSCert, cfg.AdminTLSKey)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+		options = append(options, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	srv := grpc.NewServer(options...)
+	adminrpc.RegisterAdminServer(srv, adminrpc.NewServer(logger, routerOptions))
+	return srv, nil
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"github.com/go-chi/chi"
+	"net/http"
+	"strconv"
+)
+
+// answerHead routes HEAD requests to the GET handlers, and answers them without the body but with the Content-Length
+// it would have, since monitoring systems probe with HEAD. Handlers still see the HEAD method, so they can skip
+// work which only matters for GET requests, like counting updates served.
+func answerHead(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			rctx.RouteMethod = http.MethodGet
+		}
+		head := &headResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(head, r)
+		head.finish()
+	})
+}
+
+// headResponseWriter counts the body written to it instead of sending it, and holds the status until finish
+type headResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	length      int
+}
+
+func (w *headResponseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status, w.wroteHeader = status, true
+	}
+}
+
+func (w *headResponseWriter) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	w.length += len(p)
+	return len(p), nil
+}
+
+// finish sends the headers, with the Content-Length of the body unless the handler set one
+func (w *headResponseWriter) finish() {
+	if len(w.Header().Get("Content-Length")) == 0 && w.status != http.StatusNoContent && w.status != http.StatusNotModified {
+		w.Header().Set("Content-Length", strconv.Itoa(w.length))
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+}
@@ -0,0 +1,28 @@
+//go:build http3
+// +build http3
+
+package server
+
+import (
+	"github.com/brave/go-update/config"
+	"github.com/quic-go/quic-go/http3"
+	"net/http"
+)
+
+// listenAndServeHTTP3 serves handler over HTTP/3 on the UDP port of addr in the background, reporting the error
+// it stops with to failed. It returns handler advertising HTTP/3 with Alt-Svc, to be served on the TCP listener.
+func listenAndServeHTTP3(addr string, handler http.Handler, limits config.Limits, certFile, keyFile string, failed func(error)) (http.Handler, error) {
+	srv := &http3.Server{
+		Addr:           addr,
+		Handler:        handler,
+		MaxHeaderBytes: limits.MaxHeaderBytes,
+		IdleTimeout:    limits.IdleTimeout,
+	}
+	go func() {
+		failed(srv.ListenAndServeTLS(certFile, keyFile))
+	}()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = srv.SetQUICHeaders(w.Header())
+		handler.ServeHTTP(w, r)
+	}), nil
+}
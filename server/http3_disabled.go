@@ -0,0 +1,15 @@
+//go:build !http3
+// +build !http3
+
+package server
+
+import (
+	"errors"
+	"github.com/brave/go-update/config"
+	"net/http"
+)
+
+// listenAndServeHTTP3 is only available in builds with the http3 tag, so quic-go isn't a dependency otherwise
+func listenAndServeHTTP3(addr string, handler http.Handler, limits config.Limits, certFile, keyFile string, failed func(error)) (http.Handler, error) {
+	return nil, errors.New("http3 needs a build with -tags http3")
+}
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"crypto/tls"
+	"github.com/brave/go-update/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// overloadRetryAfter is how long clients are told to wait before retrying requests answered with 503 by LimitInFlight
+const overloadRetryAfter = time.Minute
+
+var requestsInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "http_requests_in_flight",
+	Help: "Number of requests being handled, limited by max_in_flight.",
+})
+
+var requestsQueued = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "http_requests_queued",
+	Help: "Number of requests waiting for one in flight to finish.",
+})
+
+var requestsRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "http_requests_rejected_total",
+	Help: "Number of requests answered with 503 by the in-flight limit, because the queue was full or they waited too long.",
+}, []string{"reason"})
+
+func init() {
+	prometheus.MustRegister(requestsInFlight)
+	prometheus.MustRegister(requestsQueued)
+	prometheus.MustRegister(requestsRejected)
+}
+
+// NewHTTPServer creates an http.Server for handler with the timeouts and header limit in limits
+func NewHTTPServer(addr string, handler http.Handler, limits config.Limits) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadTimeout:       limits.ReadTimeout,
+		ReadHeaderTimeout: limits.ReadHeaderTimeout,
+		WriteTimeout:      limits.WriteTimeout,
+		IdleTimeout:       limits.IdleTimeout,
+		MaxHeaderBytes:    limits.MaxHeaderBytes,
+	}
+}
+
+// ListenAndServe is like srv.ListenAndServe but accepts at most maxConnections connections at once.
+// srv.Addr can be any address accepted by Listen.
+func ListenAndServe(srv *http.Server, maxConnections int) error {
+	listener, err := Listen(srv.Addr)
+	if err != nil {
+		return err
+	}
+	return srv.Serve(LimitListener(listener, maxConnections))
+}
+
+// ListenAndServeTLS is like srv.ListenAndServeTLS but accepts at most maxConnections connections at once.
+// HTTP/2 is negotiated with clients which support it, and srv.Addr can be any address accepted by Listen.
+func ListenAndServeTLS(srv *http.Server, maxConnections int, certFile, keyFile string) error {
+	listener, err := Listen(srv.Addr)
+	if err != nil {
+		return err
+	}
+	return serveTLS(srv, LimitListener(listener, maxConnections), certFile, keyFile)
+}
+
+// serveTLS serves HTTPS on listener, with HTTP/2 and at least TLS 1.2 unless srv has its own TLS configuration
+func serveTLS(srv *http.Server, listener net.Listener, certFile, keyFile string) error {
+	if srv.TLSConfig == nil {
+		srv.TLSConfig = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			NextProtos: []string{"h2", "http/1.1"},
+		}
+	}
+	return srv.ServeTLS(listener, certFile, keyFile)
+}
+
+// LimitListener returns a listener which accepts at most n connections at once.
+// Further connections wait in the kernel's accept queue. If n is 0 listener is returned as is.
+func LimitListener(listener net.Listener, n int) net.Listener {
+	if n <= 0 {
+		return listener
+	}
+	return &limitListener{Listener: listener, sem: make(chan struct{}, n)}
+}
+
+type limitListener struct {
+	net.Listener
+	sem chan struct{}
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	l.sem <- struct{}{}
+	c, err := l.Listener.Accept()
+	if err != nil {
+		<-l.sem
+		return nil, err
+	}
+	return &limitListenerConn{Conn: c, release: func() { <-l.sem }}, nil
+}
+
+type limitListenerConn struct {
+	net.Conn
+	releaseOnce sync.Once
+	release     func()
+}
+
+func (c *limitListenerConn) Close() error {
+	err := c.Conn.Close()
+	c.releaseOnce.Do(c.release)
+	return err
+}
+
+// LimitInFlight returns a handler which handles at most limits.MaxInFlight requests at once.
+// Up to limits.QueueSize more wait for at most limits.QueueTimeout for one of them to finish,
+// and the others are answered with 503 and Retry-After straight away, so a spike in traffic
+// doesn't slow down every request. If limits.MaxInFlight is 0 handler is returned as is.
+func LimitInFlight(handler http.Handler, limits config.Limits) http.Handler {
+	if limits.MaxInFlight <= 0 {
+		return handler
+	}
+	return &inFlightLimiter{
+		next:    handler,
+		slots:   make(chan struct{}, limits.MaxInFlight),
+		queue:   make(chan struct{}, limits.QueueSize),
+		timeout: limits.QueueTimeout,
+	}
+}
+
+type inFlightLimiter struct {
+	next http.Handler
+	// slots holds a value for each request in flight, and queue for each request waiting for a slot
+	slots   chan struct{}
+	queue   chan struct{}
+	timeout time.Duration
+}
+
+func (l *inFlightLimiter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	select {
+	case l.slots <- struct{}{}:
+	default:
+		if !l.wait(w, r) {
+			return
+		}
+	}
+	requestsInFlight.Inc()
+	defer func() {
+		requestsInFlight.Dec()
+		<-l.slots
+	}()
+	l.next.ServeHTTP(w, r)
+}
+
+// wait queues r until it gets a slot and returns true, or answers it and returns false
+// if the queue is full or it waited too long
+func (l *inFlightLimiter) wait(w http.ResponseWriter, r *http.Request) bool {
+	select {
+	case l.queue <- struct{}{}:
+	default:
+		l.reject(w, "queue_full")
+		return false
+	}
+	requestsQueued.Inc()
+	defer func() {
+		requestsQueued.Dec()
+		<-l.queue
+	}()
+	timer := time.NewTimer(l.timeout)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		l.reject(w, "queue_timeout")
+		return false
+	case <-r.Context().Done():
+		// The client is gone, so there's no one to answer
+		return false
+	}
+}
+
+func (l *inFlightLimiter) reject(w http.ResponseWriter, reason string) {
+	requestsRejected.WithLabelValues(reason).Inc()
+	seconds := strconv.Itoa(int(overloadRetryAfter.Seconds()))
+	w.Header().Set("Retry-After", seconds)
+	w.Header().Set("X-Retry-After", seconds)
+	http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// systemdFirstFD is the first file descriptor of the sockets passed by systemd socket activation, see sd_listen_fds(3)
+const systemdFirstFD = 3
+
+// Listen listens on addr, which is either a host:port to listen on with TCP, unix:PATH to listen on a Unix socket,
+// or systemd to use the socket passed by systemd socket activation. With several sockets, systemd:NAME picks the one
+// with FileDescriptorName=NAME.
+func Listen(addr string) (net.Listener, error) {
+	switch {
+	case strings.HasPrefix(addr, "unix:"):
+		return listenUnix(strings.TrimPrefix(addr, "unix:"))
+	case addr == "systemd":
+		return systemdListener("")
+	case strings.HasPrefix(addr, "systemd:"):
+		return systemdListener(strings.TrimPrefix(addr, "systemd:"))
+	}
+	return net.Listen("tcp", addr)
+}
+
+// listenUnix listens on a Unix socket at path, replacing the socket left behind by a previous process
+func listenUnix(path string) (net.Listener, error) {
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen("unix", path)
+}
+
+// systemdListener returns the socket passed by systemd named name, or the first one if name is empty
+func systemdListener(name string) (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, errors.New("systemd didn't pass any sockets")
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count < 1 {
+		return nil, errors.New("systemd didn't pass any sockets")
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	for i := 0; i < count; i++ {
+		if len(name) != 0 && (i >= len(names) || names[i] != name) {
+			continue
+		}
+		// FileListener duplicates the descriptor, so the original can be closed
+		file := os.NewFile(uintptr(systemdFirstFD+i), "systemd:"+name)
+		listener, err := net.FileListener(file)
+		_ = file.Close()
+		return listener, err
+	}
+	return nil, fmt.Errorf("systemd didn't pass a socket named %s", name)
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"expvar"
+	"github.com/brave-intl/bat-go/middleware"
+	"github.com/brave/go-update/controller"
+	"github.com/go-chi/chi"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+)
+
+func init() {
+	expvar.Publish("goroutines", expvar.Func(func() interface{} {
+		return runtime.NumGoroutine()
+	}))
+	expvar.Publish("extensions", expvar.Func(func() interface{} {
+		return controller.CurrentCatalog().Len()
+	}))
+}
+
+// opsRouter serves health checks, metrics and runtime diagnostics. It is meant for an internal listener only,
+// since profiles expose memory contents and are expensive to collect.
+func opsRouter() chi.Router {
+	r := chi.NewRouter()
+	r.Get("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("ok\n"))
+	})
+	r.Get("/readyz", controller.Readiness)
+	r.Get("/metrics", middleware.Metrics())
+	r.Get("/debug/vars", expvar.Handler().ServeHTTP)
+	r.Get("/debug/pprof/cmdline", pprof.Cmdline)
+	r.Get("/debug/pprof/profile", pprof.Profile)
+	r.Get("/debug/pprof/symbol", pprof.Symbol)
+	r.Post("/debug/pprof/symbol", pprof.Symbol)
+	r.Get("/debug/pprof/trace", pprof.Trace)
+	// Index also serves the named profiles like /debug/pprof/heap and /debug/pprof/goroutine
+	r.Get("/debug/pprof/*", pprof.Index)
+	return r
+}
+
+// newOpsServer creates the server for opsRouter on addr.
+// It has no write timeout so CPU profiles and traces can run for as long as requested.
+func newOpsServer(addr string) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           opsRouter(),
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       120 * time.Second,
+	}
+}
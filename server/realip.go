@@ -0,0 +1,78 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// parseCIDRs parses a list of CIDR blocks, which must have been checked by config.Validate
+func parseCIDRs(cidrs []string) []*net.IPNet {
+	networks := []*net.IPNet{}
+	for _, cidr := range cidrs {
+		if _, network, err := net.ParseCIDR(cidr); err == nil {
+			networks = append(networks, network)
+		}
+	}
+	return networks
+}
+
+func isTrustedProxy(trusted []*net.IPNet, ip net.IP) bool {
+	for _, network := range trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// realIP sets the request's RemoteAddr to the client IP when it comes through one of the trusted proxies.
+// X-Forwarded-For is read from the right, skipping trusted proxies, so addresses a client prepends itself
+// are never used. X-Real-IP is only used from a trusted proxy which doesn't send X-Forwarded-For.
+// Requests from anywhere else keep the address of the connection.
+func realIP(trusted []*net.IPNet) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ip := clientIP(trusted, r); len(ip) != 0 {
+				r.RemoteAddr = ip
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientIP returns the client IP forwarded by trusted proxies, or an empty string to keep the connection address
+func clientIP(trusted []*net.IPNet, r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	peer := net.ParseIP(host)
+	if peer == nil || !isTrustedProxy(trusted, peer) {
+		return ""
+	}
+	// Proxies may each add their own header rather than appending to the first
+	if headers := r.Header["X-Forwarded-For"]; len(headers) != 0 {
+		return forwardedClientIP(trusted, strings.Split(strings.Join(headers, ","), ","))
+	}
+	if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
+
+// forwardedClientIP returns the rightmost address in X-Forwarded-For which isn't a trusted proxy,
+// or the leftmost if they all are
+func forwardedClientIP(trusted []*net.IPNet, forwarded []string) string {
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if ip == nil {
+			// Anything left of an address we can't parse could have been made up
+			return ""
+		}
+		if !isTrustedProxy(trusted, ip) || i == 0 {
+			return ip.String()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"github.com/brave/go-update/extension"
+	"github.com/getsentry/raven-go"
+	"github.com/pressly/lg"
+	"github.com/prometheus/client_golang/prometheus"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"strings"
+)
+
+// internalErrorXML is what an update client gets when we fail unexpectedly, so it sees a
+// well-formed response it can parse instead of a dropped connection.
+const internalErrorXML = `<response protocol="3.1" server="prod" status="error-internal"></response>`
+
+// internalErrorJSON is the same for clients checking with the JSON protocol 4
+const internalErrorJSON = extension.Protocol4Prefix + `{"response":{"protocol":"` + extension.Protocol4 + `","server":"prod","status":"error-internal","apps":[]}}`
+
+// updateCheckPath matches the paths of update checks, for the default catalog and for tenants
+var updateCheckPath = regexp.MustCompile(`^(/t/[^/]+)?/extensions(/|$)`)
+
+var panicsCounter = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "panics_total",
+	Help: "Number of requests which panicked.",
+})
+
+func init() {
+	prometheus.MustRegister(panicsCounter)
+}
+
+// recoverer recovers from panics in handlers, logs the stack, reports it to Sentry and answers with a 500.
+// Update checks, tenants' included, get an Omaha style error response in the protocol they were sent in.
+// http.ErrAbortHandler is panicked again, since it only aborts the response.
+func recoverer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+			stack := debug.Stack()
+			panicsCounter.Inc()
+			lg.Log(r.Context()).Errorf("Panic handling %s %s: %v\n%s", r.Method, r.URL.Path, rec, stack)
+
+			recStr := fmt.Sprint(rec)
+			packet := raven.NewPacket(
+				recStr,
+				raven.NewException(errors.New(recStr), raven.NewStacktrace(2, 3, nil)),
+				raven.NewHttp(r),
+			)
+			raven.Capture(packet, nil)
+
+			if updateCheckPath.MatchString(r.URL.Path) {
+				if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+					w.Header().Set("content-type", "application/json")
+					w.WriteHeader(http.StatusInternalServerError)
+					_, _ = w.Write([]byte(internalErrorJSON))
+					return
+				}
+				w.Header().Set("content-type", "application/xml")
+				w.WriteHeader(http.StatusInternalServerError)
+				_, _ = w.Write([]byte(internalErrorXML))
+				return
+			}
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"github.com/brave/go-update/config"
+	"github.com/brave/go-update/controller"
+	"github.com/sirupsen/logrus"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+)
+
+// configReloader loads the configuration again on SIGHUP or POST /api/admin/reload.
+// Only the log level, fallback URLs, redirect marker, app overrides, mirrors, protocol mirroring, download preferences, package checks, maintenance mode and load shedding take effect without a restart.
+type configReloader struct {
+	mutex  sync.Mutex
+	args   []string
+	logger *logrus.Logger
+	config config.Config
+	// options are those of the handler whose settings are reloaded
+	options *controller.Options
+}
+
+// Reload loads and applies the configuration, leaving the current one in place if it is invalid
+func (reloader *configReloader) Reload() error {
+	reloader.mutex.Lock()
+	defer reloader.mutex.Unlock()
+	cfg, err := config.Load(reloader.args)
+	if err != nil {
+		return err
+	}
+	level, err := logrus.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		return err
+	}
+
+	// Everything else is baked into the router or http.Server when they are created
+	restartOnly := map[string][2]interface{}{
+		"addr":                  {reloader.config.Addr, cfg.Addr},
+		"ops_addr":              {reloader.config.OpsAddr, cfg.OpsAddr},
+		"cdn_purge":             {[]interface{}{reloader.config.CDNPurge, reloader.config.FastlyServiceID, reloader.config.FastlySoftPurge, reloader.config.CloudFrontDistributionID}, []interface{}{cfg.CDNPurge, cfg.FastlyServiceID, cfg.FastlySoftPurge, cfg.CloudFrontDistributionID}},
+		"cors":                  {[]interface{}{reloader.config.CORSAllowedOrigins, reloader.config.CORSAllowedMethods}, []interface{}{cfg.CORSAllowedOrigins, cfg.CORSAllowedMethods}},
+		"compression_min_size":  {reloader.config.CompressionMinSize, cfg.CompressionMinSize},
+		"tls":                   {[]interface{}{reloader.config.TLSCert, reloader.config.TLSKey, reloader.config.HTTP3}, []interface{}{cfg.TLSCert, cfg.TLSKey, cfg.HTTP3}},
+		"trusted_proxies":       {reloader.config.TrustedProxies, cfg.TrustedProxies},
+		"https":                 {[]interface{}{reloader.config.HSTSMaxAge, reloader.config.HTTPSRedirect}, []interface{}{cfg.HSTSMaxAge, cfg.HTTPSRedirect}},
+		"codebase_url_template": {reloader.config.CodebaseURLTemplate, cfg.CodebaseURLTemplate},
+		"protocol_versions":     {reloader.config.ProtocolVersions, cfg.ProtocolVersions},
+		"component_passthrough": {reloader.config.ComponentPassthrough, cfg.ComponentPassthrough},
+		"refresh_interval":      {reloader.config.RefreshInterval, cfg.RefreshInterval},
+		"frozen_catalog":        {reloader.config.FrozenCatalog, cfg.FrozenCatalog},
+		"chaos_mode":            {reloader.config.ChaosMode, cfg.ChaosMode},
+		"catalog_manifest":      {reloader.config.CatalogManifest, cfg.CatalogManifest},
+		"store":                 {[]interface{}{reloader.config.Store, reloader.config.MemoryStoreSeed}, []interface{}{cfg.Store, cfg.MemoryStoreSeed}},
+		"shadow_store":          {[]interface{}{reloader.config.ShadowStore, reloader.config.ShadowDynamoDBTable, reloader.config.ShadowDynamoDBEndpoint, reloader.config.ShadowMemoryStoreSeed}, []interface{}{cfg.ShadowStore, cfg.ShadowDynamoDBTable, cfg.ShadowDynamoDBEndpoint, cfg.ShadowMemoryStoreSeed}},
+		"aws_region":            {reloader.config.AWSRegion, cfg.AWSRegion},
+		"failover_regions":      {reloader.config.DynamoDBFailoverRegions, cfg.DynamoDBFailoverRegions},
+		"dynamodb":              {[]interface{}{reloader.config.DynamoDBEndpoint, reloader.config.DynamoDBScanSegments}, []interface{}{cfg.DynamoDBEndpoint, cfg.DynamoDBScanSegments}},
+		"store_retries":         {[]interface{}{reloader.config.StoreAttempts, reloader.config.StoreTimeout}, []interface{}{cfg.StoreAttempts, cfg.StoreTimeout}},
+		"store_breaker":         {[]interface{}{reloader.config.StoreBreakerFailures, reloader.config.StoreBreakerTimeout}, []interface{}{cfg.StoreBreakerFailures, cfg.StoreBreakerTimeout}},
+		"crx_directory":         {reloader.config.CRXDirectory, cfg.CRXDirectory},
+		"crx_bucket":            {reloader.config.CRXBucket, cfg.CRXBucket},
+		"signed_url_bucket":     {reloader.config.SignedURLBucket, cfg.SignedURLBucket},
+		"canary_interval":       {reloader.config.CanaryInterval, cfg.CanaryInterval},
+		"serving_windows":       {reloader.config.ServingWindowsFile, cfg.ServingWindowsFile},
+		"policy":                {[]interface{}{reloader.config.ForceInstallFile, reloader.config.PolicyUpdateURL}, []interface{}{cfg.ForceInstallFile, cfg.PolicyUpdateURL}},
+		"transparency_log_file": {reloader.config.TransparencyLogFile, cfg.TransparencyLogFile},
+		"release_bucket":        {reloader.config.ReleaseBucket, cfg.ReleaseBucket},
+		"extension_stats":       {[]interface{}{reloader.config.ExtensionStatsSink, reloader.config.ExtensionStatsFlushInterval, reloader.config.ExtensionStatsNamespace, reloader.config.ExtensionStatsTable}, []interface{}{cfg.ExtensionStatsSink, cfg.ExtensionStatsFlushInterval, cfg.ExtensionStatsNamespace, cfg.ExtensionStatsTable}},
+		"audit":                 {[]interface{}{reloader.config.AuditSink, reloader.config.AuditLogFile, reloader.config.AuditTable}, []interface{}{cfg.AuditSink, cfg.AuditLogFile, cfg.AuditTable}},
+		"events":                {[]interface{}{reloader.config.EventsSink, reloader.config.EventsKinesisStream, reloader.config.EventsKafkaRESTURL, reloader.config.EventsKafkaTopic, reloader.config.EventsQueueSize, reloader.config.EventsBatchSize, reloader.config.EventsFlushInterval}, []interface{}{cfg.EventsSink, cfg.EventsKinesisStream, cfg.EventsKafkaRESTURL, cfg.EventsKafkaTopic, cfg.EventsQueueSize, cfg.EventsBatchSize, cfg.EventsFlushInterval}},
+		"recording":             {[]interface{}{reloader.config.RecordSampleRate, reloader.config.RecordSink, reloader.config.RecordFile, reloader.config.RecordBucket, reloader.config.RecordPrefix}, []interface{}{cfg.RecordSampleRate, cfg.RecordSink, cfg.RecordFile, cfg.RecordBucket, cfg.RecordPrefix}},
+		"privacy":               {[]interface{}{reloader.config.PrivacyMode, reloader.config.PrivacySalt}, []interface{}{cfg.PrivacyMode, cfg.PrivacySalt}},
+		"secrets":               {[]interface{}{reloader.config.SecretsProvider, reloader.config.AdminTokensSecret, reloader.config.ViewerTokensSecret, reloader.config.S3CredentialsSecret, reloader.config.ResponseSigningKeysSecret, reloader.config.SecretsRefreshInterval}, []interface{}{cfg.SecretsProvider, cfg.AdminTokensSecret, cfg.ViewerTokensSecret, cfg.S3CredentialsSecret, cfg.ResponseSigningKeysSecret, cfg.SecretsRefreshInterval}},
+		"oidc":                  {[]interface{}{reloader.config.OIDCIssuer, reloader.config.OIDCAudience, reloader.config.OIDCGroupsClaim, reloader.config.OIDCReleaseManagerGroups, reloader.config.OIDCViewerGroups}, []interface{}{cfg.OIDCIssuer, cfg.OIDCAudience, cfg.OIDCGroupsClaim, cfg.OIDCReleaseManagerGroups, cfg.OIDCViewerGroups}},
+		"admin_listener":        {[]interface{}{reloader.config.AdminAddr, reloader.config.AdminTLSCert, reloader.config.AdminTLSKey, reloader.config.AdminClientCA}, []interface{}{cfg.AdminAddr, cfg.AdminTLSCert, cfg.AdminTLSKey, cfg.AdminClientCA}},
+		"grpc_addr":             {reloader.config.GRPCAddr, cfg.GRPCAddr},
+		"limits":                {reloader.config.Limits, cfg.Limits},
+		"tenants":               {reloader.config.Tenants, cfg.Tenants},
+		"release_channels":      {reloader.config.ReleaseChannels, cfg.ReleaseChannels},
+		"statsd":                {[]interface{}{reloader.config.StatsDAddr, reloader.config.StatsDPrefix, reloader.config.StatsDTags}, []interface{}{cfg.StatsDAddr, cfg.StatsDPrefix, cfg.StatsDTags}},
+	}
+	for name, values := range restartOnly {
+		if !reflect.DeepEqual(values[0], values[1]) {
+			reloader.logger.WithFields(logrus.Fields{"prefix": "reload"}).Warnf("%s changed but only takes effect after a restart", name)
+		}
+	}
+
+	reloader.logger.SetLevel(level)
+	reloader.options.UpdateSettings(func(settings *controller.Settings) {
+		applyReloadableSettings(settings, cfg)
+	})
+	reloader.config = cfg
+	reloader.logger.WithFields(logrus.Fields{"prefix": "reload"}).Info("Reloaded config")
+	return nil
+}
+
+// ReloadOnSIGHUP reloads the configuration every time the process receives SIGHUP
+func (reloader *configReloader) ReloadOnSIGHUP() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for range signals {
+			err := reloader.Reload()
+			if err != nil {
+				reloader.logger.WithFields(logrus.Fields{"prefix": "reload"}).Errorf("Error reloading config: %v", err)
+			}
+		}
+	}()
+}
+
+// applyReloadableSettings sets the settings which come from the configuration, leaving those from secrets alone
+func applyReloadableSettings(settings *controller.Settings, cfg config.Config) {
+	settings.WebStoreFallbackURL = cfg.WebStoreFallbackURL
+	settings.ComponentUpdaterFallbackURL = cfg.ComponentUpdaterFallbackURL
+	settings.RedirectMarker = cfg.RedirectMarker
+	settings.CDNURLPrefixes = cfg.CDNURLPrefixes
+	settings.CountryHeader = cfg.CountryHeader
+	settings.MirrorProtocol = cfg.MirrorProtocol
+	settings.SignedURLExpiry = cfg.SignedURLExpiry
+	settings.DownloadPreference = cfg.DownloadPreference
+	settings.VerifyPayloads = cfg.VerifyPayloads
+	settings.CheckLinks = cfg.CheckLinks
+	settings.SuppressMissingPackages = cfg.SuppressMissingPackages
+	settings.MaintenanceMode = cfg.MaintenanceMode
+	settings.MaintenanceRetryAfter = cfg.MaintenanceRetryAfter
+	settings.BackgroundShedThreshold = cfg.BackgroundShedThreshold
+	settings.BackgroundRetryAfter = cfg.BackgroundRetryAfter
+	settings.DedupTTL = cfg.RequestDedupTTL
+	settings.RetryWindow = cfg.RetryWindow
+	settings.TUFRootVersion = cfg.TUFRootVersion
+	settings.WebStoreCacheMaxAge = cfg.WebStoreCacheMaxAge
+	settings.MaxAppsPerResponse = cfg.MaxAppsPerResponse
+	settings.UpdateBudgets = cfg.UpdateBudgets
+	settings.AppOverrides = map[string]controller.AppOverride{}
+	for id, override := range cfg.AppOverrides {
+		settings.AppOverrides[id] = controller.AppOverride{Action: override.Action, UpstreamURL: override.UpstreamURL, WebStoreURL: override.WebStoreURL}
+	}
+}
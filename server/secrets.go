@@ -0,0 +1,112 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/brave/go-update/config"
+	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/secrets"
+	"log"
+	"strings"
+)
+
+// newSecretsProvider returns the configured secrets provider in the primary AWS region
+func newSecretsProvider(ctx context.Context, cfg config.Config) (secrets.Provider, error) {
+	if cfg.SecretsProvider == "env" {
+		return secrets.Env{}, nil
+	}
+	awsConfig, err := controller.AWSConfig(ctx, cfg.AWSRegion)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.SecretsProvider == "ssm" {
+		return secrets.ParameterStore{Client: ssm.NewFromConfig(awsConfig)}, nil
+	}
+	return secrets.SecretsManager{Client: secretsmanager.NewFromConfig(awsConfig)}, nil
+}
+
+// loadSecrets loads the admin and viewer tokens, including those of tenants, release channel webhook URLs, the response signing keys and S3 credentials from their secrets if they are configured,
+// polling for rotated values until ctx is done when SecretsRefreshInterval is set. The tokens and URLs go into the settings of opts.
+func loadSecrets(ctx context.Context, cfg config.Config, provider secrets.Provider, opts *controller.Options) error {
+	if len(cfg.AdminTokensSecret) != 0 {
+		err := secrets.Watch(ctx, provider, cfg.AdminTokensSecret, cfg.SecretsRefreshInterval, func(value string) {
+			opts.UpdateSettings(func(settings *controller.Settings) {
+				settings.AdminTokens = controller.ParseAdminTokens(value)
+			})
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(cfg.ViewerTokensSecret) != 0 {
+		err := secrets.Watch(ctx, provider, cfg.ViewerTokensSecret, cfg.SecretsRefreshInterval, func(value string) {
+			opts.UpdateSettings(func(settings *controller.Settings) {
+				settings.ViewerTokens = controller.ParseAdminTokens(value)
+			})
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, tenant := range cfg.Tenants {
+		if len(tenant.AdminTokensSecret) == 0 {
+			continue
+		}
+		name := tenant.Name
+		err := secrets.Watch(ctx, provider, tenant.AdminTokensSecret, cfg.SecretsRefreshInterval, func(value string) {
+			opts.SetTenantAdminTokens(name, controller.ParseAdminTokens(value))
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, channel := range cfg.ReleaseChannels {
+		name := channel.Name
+		err := secrets.Watch(ctx, provider, channel.WebhookURLSecret, cfg.SecretsRefreshInterval, func(value string) {
+			opts.SetReleaseChannelURL(name, strings.TrimSpace(value))
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(cfg.FastlyTokenSecret) != 0 {
+		err := secrets.Watch(ctx, provider, cfg.FastlyTokenSecret, cfg.SecretsRefreshInterval, func(value string) {
+			opts.UpdateSettings(func(settings *controller.Settings) {
+				settings.FastlyToken = strings.TrimSpace(value)
+			})
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(cfg.ResponseSigningKeysSecret) != 0 {
+		err := secrets.Watch(ctx, provider, cfg.ResponseSigningKeysSecret, cfg.SecretsRefreshInterval, func(value string) {
+			keys, err := controller.ParseSigningKeys(value)
+			if err != nil {
+				// Keep signing with the current keys rather than stop signing
+				log.Printf("error loading response signing keys from %s: %v\n", cfg.ResponseSigningKeysSecret, err)
+				return
+			}
+			opts.UpdateSettings(func(settings *controller.Settings) {
+				settings.SigningKeys = keys
+			})
+		})
+		if err != nil {
+			return err
+		}
+		if len(opts.SigningKeys()) == 0 {
+			return fmt.Errorf("secret %s has no valid response signing keys", cfg.ResponseSigningKeysSecret)
+		}
+	}
+	if len(cfg.S3CredentialsSecret) != 0 {
+		controller.S3Credentials = secrets.NewAWSCredentials(provider, cfg.S3CredentialsSecret, cfg.SecretsRefreshInterval)
+		// Fail at startup rather than on the first download if the secret is missing
+		_, err := controller.S3Credentials.Retrieve(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// isHTTPS returns true if the client connected over TLS, directly or to one of the trusted proxies.
+// It must run before realIP replaces the address of the connection.
+func isHTTPS(trusted []*net.IPNet, r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	peer := net.ParseIP(host)
+	if peer == nil || !isTrustedProxy(trusted, peer) {
+		return false
+	}
+	return strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+// isUpdatePath returns true for the update check endpoints, of the default catalog or a tenant
+func isUpdatePath(path string) bool {
+	if strings.HasPrefix(path, "/t/") {
+		parts := strings.SplitN(path, "/", 5)
+		return len(parts) >= 4 && parts[3] == "extensions"
+	}
+	return path == "/extensions" || strings.HasPrefix(path, "/extensions/")
+}
+
+// securityHeaders sets X-Content-Type-Options on every response, and Strict-Transport-Security
+// on responses over HTTPS unless hstsMaxAge is 0.
+// With redirectHTTPS update checks over plain HTTP are redirected to HTTPS, since clients only
+// trust the update metadata as far as the transport it came over.
+func securityHeaders(trusted []*net.IPNet, hstsMaxAge time.Duration, redirectHTTPS bool) func(http.Handler) http.Handler {
+	hsts := "max-age=" + strconv.Itoa(int(hstsMaxAge.Seconds()))
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			https := isHTTPS(trusted, r)
+			if https && hstsMaxAge > 0 {
+				w.Header().Set("Strict-Transport-Security", hsts)
+			}
+			if !https && redirectHTTPS && isUpdatePath(r.URL.Path) {
+				// 308 keeps POST update checks from being turned into GET requests
+				status := http.StatusPermanentRedirect
+				if r.Method == http.MethodGet || r.Method == http.MethodHead {
+					status = http.StatusMovedPermanently
+				}
+				http.Redirect(w, r, "https://"+r.Host+r.URL.RequestURI(), status)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
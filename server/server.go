@@ -5,53 +5,793 @@ import (
 	"context"
 	"fmt"
 	"github.com/brave-intl/bat-go/middleware"
+	"github.com/brave/go-update/config"
 	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/events"
 	"github.com/brave/go-update/extension"
+	"github.com/brave/go-update/memstore"
+	"github.com/brave/go-update/privacy"
+	"github.com/brave/go-update/replay"
+	"github.com/brave/go-update/statsd"
 	"github.com/getsentry/raven-go"
 	"github.com/go-chi/chi"
 	chiware "github.com/go-chi/chi/middleware"
 	"github.com/pressly/lg"
 	"github.com/sirupsen/logrus"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"strings"
 	"time"
 )
 
-func setupLogger(ctx context.Context) (context.Context, *logrus.Logger) {
+// Option configures the handler returned by New
+type Option func(*options)
+
+type options struct {
+	store                       controller.Store
+	shadowStore                 controller.Store
+	logger                      *logrus.Logger
+	settings                    *controller.Settings
+	webStoreFallbackURL         string
+	componentUpdaterFallbackURL string
+	refreshInterval             time.Duration
+	clock                       controller.Clock
+	middleware                  []func(http.Handler) http.Handler
+	outerMiddleware             []func(http.Handler) http.Handler
+	routeMiddleware             []routeMiddleware
+	tenantResolver              func(r *http.Request) *controller.Tenant
+	stats                       *statsd.Client
+	statsSink                   controller.StatsSink
+	statsFlushInterval          time.Duration
+	audit                       controller.AuditLog
+	oidc                        *controller.OIDCVerifier
+	adminListener               bool
+	opsListener                 bool
+	corsOrigins                 []string
+	corsMethods                 []string
+	compressionMinSize          int
+	purger                      controller.CDNPurger
+	events                      *events.Exporter
+	recorder                    *replay.Recorder
+	scrubber                    *privacy.Scrubber
+	tenants                     []*controller.Tenant
+	releaseChannels             []controller.ReleaseChannel
+	responders                  map[string]controller.Responder
+	trustedProxies              []*net.IPNet
+	hstsMaxAge                  time.Duration
+	httpsRedirect               bool
+	frozenCatalog               bool
+	chaosMode                   bool
+	crxDirectory                string
+	crxBucket                   string
+	signedURLBucket             string
+	releaseBucket               string
+	awsRegion                   string
+	servingWindowsFile          string
+	forceInstallFile            string
+	policyUpdateURL             string
+	transparencyLogFile         string
+	// routerOptions are given to the controller's routers, built by New from the rest
+	routerOptions *controller.Options
+}
+
+// WithStore sets the store the extensions catalog is loaded from, DynamoDB by default
+func WithStore(store controller.Store) Option {
+	return func(o *options) {
+		o.store = store
+	}
+}
+
+// WithShadowStore repeats every catalog load and save on store in the background and logs how it differs from the main store
+func WithShadowStore(store controller.Store) Option {
+	return func(o *options) {
+		o.shadowStore = store
+	}
+}
+
+// WithLogger sets the logger used for request logging and by the handlers
+func WithLogger(logger *logrus.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithSettings sets the settings the handler starts with, controller.DefaultSettings() by default.
+// They can be changed while it serves with the UpdateSettings method of the controller.Options its routers are given.
+func WithSettings(settings controller.Settings) Option {
+	return func(o *options) {
+		o.settings = &settings
+	}
+}
+
+// WithFallbackURLs sets where requests for a single unknown extension are redirected, replacing those of the settings.
+// webStoreURL is used for GET requests and componentUpdaterURL for POST requests.
+func WithFallbackURLs(webStoreURL string, componentUpdaterURL string) Option {
+	return func(o *options) {
+		o.webStoreFallbackURL = webStoreURL
+		o.componentUpdaterFallbackURL = componentUpdaterURL
+	}
+}
+
+// WithCRXDirectory serves CRX payloads from directory on /crx/{id}/{version} and publishes uploads to it,
+// rather than to the release bucket
+func WithCRXDirectory(directory string) Option {
+	return func(o *options) {
+		o.crxDirectory = directory
+	}
+}
+
+// WithRefreshInterval sets how often the extensions catalog is reloaded from the store
+func WithRefreshInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.refreshInterval = interval
+	}
+}
+
+// WithClock sets the clock of catalog refreshes, scheduled versions, serving windows and presigned URLs,
+// so tests can advance time rather than wait for it
+func WithClock(clock controller.Clock) Option {
+	return func(o *options) {
+		o.clock = clock
+	}
+}
+
+// WithMiddleware adds middleware to run on every request after the built in middleware
+func WithMiddleware(middleware ...func(http.Handler) http.Handler) Option {
+	return func(o *options) {
+		o.middleware = append(o.middleware, middleware...)
+	}
+}
+
+// WithOuterMiddleware adds middleware to run on every request before the built in middleware,
+// so it can answer requests before they are logged, counted or given a request ID
+func WithOuterMiddleware(middleware ...func(http.Handler) http.Handler) Option {
+	return func(o *options) {
+		o.outerMiddleware = append(o.outerMiddleware, middleware...)
+	}
+}
+
+// routeMiddleware is middleware which only runs on requests for paths starting with prefix
+type routeMiddleware struct {
+	prefix     string
+	middleware []func(http.Handler) http.Handler
+}
+
+// WithRouteMiddleware adds middleware to run after the middleware of WithMiddleware, only on requests
+// for paths starting with prefix, like quotas on "/extensions" or authentication on "/api/"
+func WithRouteMiddleware(prefix string, middleware ...func(http.Handler) http.Handler) Option {
+	return func(o *options) {
+		o.routeMiddleware = append(o.routeMiddleware, routeMiddleware{prefix: prefix, middleware: middleware})
+	}
+}
+
+// WithTenantResolver chooses the tenant serving each request outside /t/{tenant} with resolve rather than by hostname.
+// resolve returns nil for the default catalog, and can return tenants given to WithTenants or look registered ones up
+// with controller.TenantNamed.
+func WithTenantResolver(resolve func(r *http.Request) *controller.Tenant) Option {
+	return func(o *options) {
+		o.tenantResolver = resolve
+	}
+}
+
+// WithStatsD sends request and update metrics to StatsD or the Datadog agent in addition to Prometheus
+func WithStatsD(client *statsd.Client) Option {
+	return func(o *options) {
+		o.stats = client
+	}
+}
+
+// WithEvents exports the metadata, pings and events of every update check with exporter
+func WithEvents(exporter *events.Exporter) Option {
+	return func(o *options) {
+		o.events = exporter
+	}
+}
+
+// WithRecorder records a sample of update checks with their responses, to be replayed against new builds
+func WithRecorder(recorder *replay.Recorder) Option {
+	return func(o *options) {
+		o.recorder = recorder
+	}
+}
+
+// WithScrubber scrubs client IP addresses before requests are logged or reported,
+// and client IDs before update checks are exported
+func WithScrubber(scrubber *privacy.Scrubber) Option {
+	return func(o *options) {
+		o.scrubber = scrubber
+	}
+}
+
+// WithTrustedProxies sets the networks of the proxies whose X-Forwarded-For and X-Real-IP headers are believed,
+// the loopback and private ranges by default. Headers from any other address are ignored.
+func WithTrustedProxies(networks ...*net.IPNet) Option {
+	return func(o *options) {
+		o.trustedProxies = networks
+	}
+}
+
+// WithHTTPS sets the max-age of the Strict-Transport-Security header on HTTPS responses, a year by default or 0 not to send it,
+// and whether update checks over plain HTTP are redirected to HTTPS
+func WithHTTPS(hstsMaxAge time.Duration, redirect bool) Option {
+	return func(o *options) {
+		o.hstsMaxAge = hstsMaxAge
+		o.httpsRedirect = redirect
+	}
+}
+
+// WithTenants serves independent catalogs on /t/{name}/extensions and their hosts as well as the default catalog
+func WithTenants(tenants ...*controller.Tenant) Option {
+	return func(o *options) {
+		o.tenants = append(o.tenants, tenants...)
+	}
+}
+
+// WithReleaseChannels posts uploads to channels, once their webhook URLs are set with the SetReleaseChannelURL method of the handler's controller.Options
+func WithReleaseChannels(channels ...controller.ReleaseChannel) Option {
+	return func(o *options) {
+		o.releaseChannels = append(o.releaseChannels, channels...)
+	}
+}
+
+// WithResponder answers update checks for the extension with id with respond rather than from the catalog
+func WithResponder(id string, respond controller.Responder) Option {
+	return func(o *options) {
+		if o.responders == nil {
+			o.responders = map[string]controller.Responder{}
+		}
+		o.responders[id] = respond
+	}
+}
+
+// WithExtensionStatsSink flushes the update and download counts shown on /api/stats/extensions to sink on every interval
+func WithExtensionStatsSink(sink controller.StatsSink, interval time.Duration) Option {
+	return func(o *options) {
+		o.statsSink = sink
+		o.statsFlushInterval = interval
+	}
+}
+
+// WithAuditLog records changes made with the admin API to auditLog, which only keeps them in memory by default
+func WithAuditLog(auditLog controller.AuditLog) Option {
+	return func(o *options) {
+		o.audit = auditLog
+	}
+}
+
+// WithOIDC lets users sign in to the admin and stats APIs with JWTs verified by verifier
+func WithOIDC(verifier *controller.OIDCVerifier) Option {
+	return func(o *options) {
+		o.oidc = verifier
+	}
+}
+
+// WithAdminListener only serves the admin and stats APIs to requests through the admin listener, see newAdminServer
+func WithAdminListener() Option {
+	return func(o *options) {
+		o.adminListener = true
+	}
+}
+
+// WithCDNPurger purges the update checks cached by a CDN when the catalogs change
+func WithCDNPurger(purger controller.CDNPurger) Option {
+	return func(o *options) {
+		o.purger = purger
+	}
+}
+
+// WithCORS lets pages from origins call the admin, catalog and stats APIs with methods
+func WithCORS(origins []string, methods []string) Option {
+	return func(o *options) {
+		o.corsOrigins = origins
+		o.corsMethods = methods
+	}
+}
+
+// WithCompression compresses text and JSON responses of at least minSize bytes for clients accepting brotli or gzip,
+// see compressResponses
+func WithCompression(minSize int) Option {
+	return func(o *options) {
+		o.compressionMinSize = minSize
+	}
+}
+
+// WithOpsListener leaves /metrics to the ops listener, see newOpsServer
+func WithOpsListener() Option {
+	return func(o *options) {
+		o.opsListener = true
+	}
+}
+
+// WithConfig applies the settings in cfg which belong to the handler. The listen address, limits and log level
+// are used by the http.Server and logger rather than the handler, and the rest is shared by the process,
+// see ApplyConfig.
+func WithConfig(cfg config.Config) Option {
+	return func(o *options) {
+		settings := controller.DefaultSettings()
+		applyReloadableSettings(&settings, cfg)
+		o.settings = &settings
+		o.refreshInterval = cfg.RefreshInterval
+		o.trustedProxies = parseCIDRs(cfg.TrustedProxies)
+		o.hstsMaxAge = cfg.HSTSMaxAge
+		o.httpsRedirect = cfg.HTTPSRedirect
+		o.adminListener = len(cfg.AdminAddr) != 0
+		o.opsListener = len(cfg.OpsAddr) != 0
+		o.corsOrigins = cfg.CORSAllowedOrigins
+		o.corsMethods = cfg.CORSAllowedMethods
+		o.compressionMinSize = cfg.CompressionMinSize
+		o.frozenCatalog = cfg.FrozenCatalog
+		o.chaosMode = cfg.ChaosMode
+		if cfg.ChaosMode {
+			log.Printf("chaos mode is enabled, faults can be injected into update checks\n")
+		}
+		o.crxDirectory = cfg.CRXDirectory
+		o.crxBucket = cfg.CRXBucket
+		o.signedURLBucket = cfg.SignedURLBucket
+		o.releaseBucket = cfg.ReleaseBucket
+		o.awsRegion = cfg.AWSRegion
+		o.servingWindowsFile = cfg.ServingWindowsFile
+		o.forceInstallFile = cfg.ForceInstallFile
+		o.policyUpdateURL = cfg.PolicyUpdateURL
+		o.transparencyLogFile = cfg.TransparencyLogFile
+		o.store = newCatalogStore(cfg)
+		switch cfg.ShadowStore {
+		case "dynamodb":
+			shadow := controller.DynamoDBStore{
+				Table:        cfg.ShadowDynamoDBTable,
+				Endpoint:     cfg.ShadowDynamoDBEndpoint,
+				ScanSegments: cfg.DynamoDBScanSegments,
+			}
+			o.shadowStore = controller.NewRetryStore("shadow-dynamodb", shadow, controller.DefaultRetrySettings)
+		case "memory":
+			seeded := cfg
+			seeded.MemoryStoreSeed = cfg.ShadowMemoryStoreSeed
+			o.shadowStore = newMemoryStore(seeded)
+		}
+		for _, tenant := range cfg.Tenants {
+			o.tenants = append(o.tenants, newTenant(cfg, tenant))
+		}
+		for _, channel := range cfg.ReleaseChannels {
+			o.releaseChannels = append(o.releaseChannels, controller.ReleaseChannel{Name: channel.Name, Kind: channel.Kind, Tenant: channel.Tenant})
+		}
+		switch cfg.CDNPurge {
+		case "fastly":
+			o.purger = controller.FastlyPurger{ServiceID: cfg.FastlyServiceID, SoftPurge: cfg.FastlySoftPurge}
+		case "cloudfront":
+			o.purger = controller.CloudFrontPurger{DistributionID: cfg.CloudFrontDistributionID}
+		}
+		switch cfg.ExtensionStatsSink {
+		case "cloudwatch":
+			o.statsSink = controller.CloudWatchStatsSink{Namespace: cfg.ExtensionStatsNamespace, Region: cfg.AWSRegion}
+		case "dynamodb":
+			o.statsSink = controller.DynamoDBStatsSink{Table: cfg.ExtensionStatsTable, Region: cfg.AWSRegion, Endpoint: cfg.DynamoDBEndpoint}
+		}
+		o.statsFlushInterval = cfg.ExtensionStatsFlushInterval
+		if len(cfg.OIDCIssuer) != 0 {
+			o.oidc = &controller.OIDCVerifier{
+				Issuer:               cfg.OIDCIssuer,
+				Audience:             cfg.OIDCAudience,
+				GroupsClaim:          cfg.OIDCGroupsClaim,
+				ReleaseManagerGroups: cfg.OIDCReleaseManagerGroups,
+				ViewerGroups:         cfg.OIDCViewerGroups,
+			}
+		}
+		switch cfg.AuditSink {
+		case "file":
+			o.audit = &controller.FileAuditLog{Path: cfg.AuditLogFile}
+		case "dynamodb":
+			o.audit = controller.DynamoDBAuditLog{Table: cfg.AuditTable, Region: cfg.AWSRegion, Endpoint: cfg.DynamoDBEndpoint}
+		}
+		o.scrubber = privacy.NewScrubber(cfg.PrivacyMode, cfg.PrivacySalt)
+		for id, passthrough := range cfg.ComponentPassthrough {
+			if o.responders == nil {
+				o.responders = map[string]controller.Responder{}
+			}
+			o.responders[id] = controller.Passthrough{
+				Mode:        passthrough.Mode,
+				UpstreamURL: passthrough.UpstreamURL,
+				Platforms:   passthrough.Platforms,
+			}.Responder()
+		}
+	}
+}
+
+// ApplyConfig applies the settings in cfg which are kept in the extension package and so shared by every handler
+// in the process: the download URLs and protocol versions. StartServer applies them before creating the handler.
+// Everything else in cfg belongs to the handler, see WithConfig.
+func ApplyConfig(cfg config.Config) {
+	extension.CodebaseURLTemplate = cfg.CodebaseURLTemplate
+	extension.SupportedProtocols = cfg.ProtocolVersions
+}
+
+// loadPersistedLists loads the force install list, serving windows and transparency log of opts from their files
+func loadPersistedLists(opts *controller.Options) {
+	err := opts.LoadForceInstallList()
+	if err != nil {
+		// The file was checked by config.Validate, so this only happens if it changed since
+		log.Printf("error loading force install list, starting empty: %v\n", err)
+	}
+	err = opts.LoadServingWindows()
+	if err != nil {
+		log.Printf("error loading serving windows, serving every extension at any time: %v\n", err)
+	}
+	err = opts.LoadTransparencyLog()
+	if err != nil {
+		// The file is left alone, since appending to a log which can't be read would log its entries again
+		log.Printf("error loading transparency log, disabling it: %v\n", err)
+		opts.TransparencyLogFile = ""
+	}
+}
+
+// NewStore creates the store of the default catalog, or of the named tenant, as configured in cfg,
+// for tools which work on the catalog without running the server
+func NewStore(cfg config.Config, tenant string) (controller.Store, error) {
+	if len(tenant) == 0 {
+		return controller.NewValidatingStore(newCatalogStore(cfg)), nil
+	}
+	for _, configured := range cfg.Tenants {
+		if configured.Name == tenant {
+			return controller.NewValidatingStore(newTenant(cfg, configured).Store), nil
+		}
+	}
+	return nil, fmt.Errorf("tenant %s isn't configured", tenant)
+}
+
+// newCatalogStore creates the store of the default catalog
+func newCatalogStore(cfg config.Config) controller.Store {
+	switch {
+	case len(cfg.CatalogManifest) != 0:
+		return controller.ManifestStore{Path: cfg.CatalogManifest}
+	case cfg.Store == "memory":
+		return newMemoryStore(cfg)
+	default:
+		return newDynamoDBStore(cfg, "")
+	}
+}
+
+// newMemoryStore creates a memory store seeded from the configured file or the built in extensions
+func newMemoryStore(cfg config.Config) controller.Store {
+	if len(cfg.MemoryStoreSeed) == 0 {
+		return memstore.New(extension.OfferedExtensions)
+	}
+	store, err := memstore.NewFromFile(cfg.MemoryStoreSeed)
+	if err != nil {
+		// The seed was checked by config.Validate, so this only happens if it changed since
+		log.Printf("error loading memory store seed, starting empty: %v\n", err)
+		return memstore.New(nil)
+	}
+	return store
+}
+
+// newTenant creates a tenant with its own store of the configured kind
+func newTenant(cfg config.Config, tenant config.Tenant) *controller.Tenant {
+	var store controller.Store
+	switch {
+	case cfg.Store != "memory":
+		store = newDynamoDBStore(cfg, tenant.DynamoDBTable)
+	case len(tenant.MemoryStoreSeed) == 0:
+		// Unlike the default catalog tenants don't start with the built in extensions
+		store = memstore.New(nil)
+	default:
+		seeded := cfg
+		seeded.MemoryStoreSeed = tenant.MemoryStoreSeed
+		store = newMemoryStore(seeded)
+	}
+	return &controller.Tenant{
+		Name:                        tenant.Name,
+		Hosts:                       tenant.Hosts,
+		Store:                       store,
+		WebStoreFallbackURL:         tenant.WebStoreFallbackURL,
+		ComponentUpdaterFallbackURL: tenant.ComponentUpdaterFallbackURL,
+	}
+}
+
+// newDynamoDBStore creates the DynamoDB store of table, Extensions if empty, for each configured region,
+// each with its own retries and circuit breaker so a regional outage fails over quickly.
+func newDynamoDBStore(cfg config.Config, table string) controller.Store {
+	retrySettings := controller.DefaultRetrySettings
+	retrySettings.Attempts = cfg.StoreAttempts
+	retrySettings.Timeout = cfg.StoreTimeout
+	breakerSettings := controller.BreakerSettings{
+		ConsecutiveFailures: cfg.StoreBreakerFailures,
+		Timeout:             cfg.StoreBreakerTimeout,
+	}
+	regions := []controller.RegionStore{}
+	for _, region := range append([]string{cfg.AWSRegion}, cfg.DynamoDBFailoverRegions...) {
+		dynamoDB := controller.DynamoDBStore{
+			Table:        table,
+			Region:       region,
+			Endpoint:     cfg.DynamoDBEndpoint,
+			ScanSegments: cfg.DynamoDBScanSegments,
+		}
+		name := "dynamodb-" + region
+		if len(table) != 0 {
+			name += "-" + table
+		}
+		store := controller.NewBreakerStore(name, controller.NewRetryStore(name, dynamoDB, retrySettings), breakerSettings)
+		regions = append(regions, controller.RegionStore{Region: region, Store: store})
+	}
+	if len(regions) == 1 {
+		return regions[0].Store
+	}
+	return controller.NewFailoverStore(regions...)
+}
+
+// New returns the update server handler so it can be embedded in other programs.
+// Each handler serves its own default catalog and tenants with its own options, so several can be created
+// in a process. Only the download URLs and protocol versions applied by ApplyConfig are shared by all of them.
+func New(opts ...Option) http.Handler {
+	handler, _ := newHandler(opts...)
+	return handler
+}
+
+// newHandler returns the handler of New and the options its routers were given
+func newHandler(opts ...Option) (http.Handler, *controller.Options) {
+	o := options{
+		store:              controller.ExtensionStore,
+		trustedProxies:     parseCIDRs(config.Default().TrustedProxies),
+		hstsMaxAge:         config.Default().HSTSMaxAge,
+		compressionMinSize: config.Default().CompressionMinSize,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.shadowStore != nil {
+		o.store = controller.NewShadowStore(o.store, o.shadowStore)
+	}
+	for _, tenant := range o.tenants {
+		tenant.Store = controller.NewValidatingStore(tenant.Store)
+	}
+	// Each handler gets its own copy of the settings, so changing those of one doesn't change another's
+	settings := controller.DefaultSettings()
+	if o.settings != nil {
+		settings = *o.settings
+	}
+	if len(o.webStoreFallbackURL) != 0 {
+		settings.WebStoreFallbackURL = o.webStoreFallbackURL
+	}
+	if len(o.componentUpdaterFallbackURL) != 0 {
+		settings.ComponentUpdaterFallbackURL = o.componentUpdaterFallbackURL
+	}
+	o.routerOptions = &controller.Options{
+		Store:               controller.NewValidatingStore(o.store),
+		RefreshInterval:     o.refreshInterval,
+		Clock:               o.clock,
+		Settings:            &settings,
+		Stats:               o.stats,
+		Events:              o.events,
+		Scrubber:            o.scrubber,
+		Audit:               o.audit,
+		OIDC:                o.oidc,
+		Purger:              o.purger,
+		ReleaseChannels:     o.releaseChannels,
+		Responders:          o.responders,
+		Tenants:             o.tenants,
+		FrozenCatalog:       o.frozenCatalog,
+		ChaosMode:           o.chaosMode,
+		CRXDirectory:        o.crxDirectory,
+		CRXBucket:           o.crxBucket,
+		SignedURLBucket:     o.signedURLBucket,
+		ReleaseBucket:       o.releaseBucket,
+		AWSRegion:           o.awsRegion,
+		ServingWindowsFile:  o.servingWindowsFile,
+		ForceInstallFile:    o.forceInstallFile,
+		PolicyUpdateURL:     o.policyUpdateURL,
+		TransparencyLogFile: o.transparencyLogFile,
+	}
+	loadPersistedLists(o.routerOptions)
+	if o.statsSink != nil {
+		o.routerOptions.FlushExtensionStatsEvery(o.statsSink, o.statsFlushInterval)
+	}
+
+	// The handlers always need a logger in the context. It is added to the context of each request rather than
+	// replacing it, so requests are still cancelled when their client goes away, and values set by whoever sent them,
+	// like the marker of canary and warm-up checks, are kept.
+	logger := o.logger
+	if logger == nil {
+		logger = logrus.New()
+	}
+	router := setupRouter(o)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		router.ServeHTTP(w, r.WithContext(lg.WithLoggerContext(r.Context(), logger)))
+	}), o.routerOptions
+}
+
+// onRoute runs the middleware of route on requests for its paths, and passes other requests straight on
+func onRoute(route routeMiddleware) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		wrapped := chi.Chain(route.middleware...).Handler(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.URL.Path, route.prefix) {
+				wrapped.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func setupLogger() *logrus.Logger {
 	logger := logrus.New()
 	// Redirect output from the standard logging package "log"
 	lg.RedirectStdlogOutput(logger)
 	lg.DefaultLogger = logger
-	ctx = lg.WithLoggerContext(ctx, logger)
-	return ctx, logger
+	return logger
 }
 
-func setupRouter(ctx context.Context, logger *logrus.Logger) (context.Context, *chi.Mux) {
+func setupRouter(o options) *chi.Mux {
 	r := chi.NewRouter()
+	r.Use(o.outerMiddleware...)
 	r.Use(chiware.RequestID)
-	r.Use(chiware.RealIP)
+	// Before any middleware which looks up tenants or the catalog
+	r.Use(controller.ServeWith(o.routerOptions))
+	// Before realIP, which replaces the address of the proxy the request came through
+	r.Use(securityHeaders(o.trustedProxies, o.hstsMaxAge, o.httpsRedirect))
+	r.Use(realIP(o.trustedProxies))
+	r.Use(corsAPI(o.corsOrigins, o.corsMethods))
+	if o.scrubber != nil {
+		r.Use(o.scrubber.Middleware)
+	}
 	r.Use(chiware.Heartbeat("/"))
 	r.Use(chiware.Timeout(60 * time.Second))
 	r.Use(middleware.BearerToken)
-	if logger != nil {
-		// Also handles panic recovery
-		r.Use(middleware.RequestLogger(logger))
+	if o.logger != nil {
+		// Also handles panic recovery, but only with a plain text response
+		r.Use(middleware.RequestLogger(o.logger))
+	}
+	r.Use(recoverer)
+	if o.stats != nil {
+		r.Use(statsdMetrics(o.stats))
 	}
+	r.Use(o.recorder.Middleware)
+	r.Use(o.middleware...)
+	for _, route := range o.routeMiddleware {
+		r.Use(onRoute(route))
+	}
+	if o.tenantResolver != nil {
+		r.Use(controller.ResolveTenant(o.tenantResolver))
+	} else {
+		r.Use(controller.TenantFromHost)
+	}
+	r.Use(compressResponses(o.compressionMinSize))
+	r.Use(answerHead)
 	extensions := extension.OfferedExtensions
-	r.Mount("/extensions", controller.ExtensionsRouter(extensions))
-	r.Get("/metrics", middleware.Metrics())
-	return ctx, r
+	r.Mount("/extensions", controller.ExtensionsRouter(extensions, o.routerOptions))
+	r.Mount("/t/{tenant}", controller.TenantRouter(o.routerOptions))
+	if o.routerOptions.CRXProxyEnabled() {
+		r.Mount("/crx", controller.CRXRouter(o.routerOptions))
+	}
+	adminOnly := adminListenerOnly(o.adminListener)
+	r.With(adminOnly).Mount("/api/v1", controller.APIRouter(controller.APIVersion1, o.routerOptions))
+	r.With(adminOnly).Mount("/api/v2", controller.APIRouter(controller.APIVersion2, o.routerOptions))
+	// The unversioned routes are kept for existing tooling and behave like v1
+	r.With(adminOnly, controller.Deprecated("/api/", "/api/v1/")).Mount("/api/admin", controller.AdminRouter(o.routerOptions))
+	r.With(adminOnly, controller.Deprecated("/api/", "/api/v1/")).Mount("/api/stats", controller.StatsRouter(o.routerOptions))
+	r.With(adminOnly).Get("/openapi.json", controller.GetOpenAPI)
+	r.Mount("/policy", controller.PolicyRouter(o.routerOptions))
+	r.Get("/keys", controller.GetSigningKeys)
+	r.Mount("/tuf", controller.TUFRouter(o.routerOptions))
+	r.Mount("/transparency", controller.TransparencyRouter(o.routerOptions))
+	if !o.opsListener {
+		r.Get("/metrics", middleware.Metrics())
+	}
+	// Load balancers check the public listener, so readiness is served there too
+	r.Get("/readyz", controller.Readiness)
+	return r
 }
 
-// StartServer starts the component updater server on port 8192
+// StartServer starts the component updater server, on port 8192 unless configured otherwise
 func StartServer() {
-	serverCtx, logger := setupLogger(context.Background())
+	logger := setupLogger()
 	logger.WithFields(logrus.Fields{"prefix": "main"}).Info("Starting server")
-	serverCtx, r := setupRouter(serverCtx, logger)
-	port := ":8192"
-	fmt.Printf("Starting server: http://localhost%s", port)
-	srv := http.Server{Addr: port, Handler: chi.ServerBaseContext(serverCtx, r)}
-	err := srv.ListenAndServe()
+	if len(os.Getenv("SENTRY_DSN")) == 0 {
+		logger.WithFields(logrus.Fields{"prefix": "main"}).Warn("SENTRY_DSN is not set, errors will not be reported to Sentry")
+	}
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Panic(err)
+	}
+	level, err := logrus.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		log.Panic(err)
+	}
+	logger.SetLevel(level)
+	ctx := context.Background()
+	provider, err := newSecretsProvider(ctx, cfg)
+	if err != nil {
+		log.Panic(err)
+	}
+	var stats *statsd.Client
+	if len(cfg.StatsDAddr) != 0 {
+		stats, err = statsd.New(cfg.StatsDAddr, cfg.StatsDPrefix, cfg.StatsDTags)
+		if err != nil {
+			log.Panic(err)
+		}
+	}
+	exporter, err := newEventExporter(ctx, cfg)
+	if err != nil {
+		log.Panic(err)
+	}
+	if len(cfg.OpsAddr) != 0 {
+		if host, _, _ := net.SplitHostPort(cfg.OpsAddr); len(host) == 0 || net.ParseIP(host).IsUnspecified() {
+			logger.WithFields(logrus.Fields{"prefix": "ops"}).Warnf("ops_addr %s listens on every interface, bind it to an internal one", cfg.OpsAddr)
+		}
+		opsServer := newOpsServer(cfg.OpsAddr)
+		go func() {
+			err := opsServer.ListenAndServe()
+			if err != nil {
+				raven.CaptureError(err, map[string]string{"task": "ops"})
+				logger.WithFields(logrus.Fields{"prefix": "ops"}).Errorf("Ops server failed: %v", err)
+			}
+		}()
+	}
+	recorder, err := newRecorder(ctx, cfg)
+	if err != nil {
+		log.Panic(err)
+	}
+	ApplyConfig(cfg)
+	handler, routerOptions := newHandler(WithConfig(cfg), WithLogger(logger), WithStatsD(stats), WithEvents(exporter), WithRecorder(recorder))
+	reloader := &configReloader{args: os.Args[1:], logger: logger, config: cfg, options: routerOptions}
+	routerOptions.Reload = reloader.Reload
+	reloader.ReloadOnSIGHUP()
+	err = loadSecrets(ctx, cfg, provider, routerOptions)
+	if err != nil {
+		log.Panic(err)
+	}
+	controller.WarmUp(handler, routerOptions, cfg.WarmUpExtensions)
+	if cfg.CanaryInterval > 0 {
+		controller.StartCanary(handler, routerOptions, cfg.CanaryInterval)
+	}
+	if len(cfg.AdminAddr) != 0 {
+		adminServer, err := newAdminServer(cfg, handler)
+		if err != nil {
+			log.Panic(err)
+		}
+		go func() {
+			err := adminServer.ListenAndServeTLS(cfg.AdminTLSCert, cfg.AdminTLSKey)
+			if err != nil {
+				raven.CaptureError(err, map[string]string{"task": "admin"})
+				logger.WithFields(logrus.Fields{"prefix": "admin"}).Errorf("Admin server failed: %v", err)
+			}
+		}()
+	}
+	if len(cfg.GRPCAddr) != 0 {
+		grpcServer, err := newGRPCServer(cfg, logger, routerOptions)
+		if err != nil {
+			log.Panic(err)
+		}
+		listener, err := net.Listen("tcp", cfg.GRPCAddr)
+		if err != nil {
+			log.Panic(err)
+		}
+		go func() {
+			err := grpcServer.Serve(listener)
+			if err != nil {
+				raven.CaptureError(err, map[string]string{"task": "grpc"})
+				logger.WithFields(logrus.Fields{"prefix": "grpc"}).Errorf("gRPC server failed: %v", err)
+			}
+		}()
+	}
+	handler = LimitInFlight(handler, cfg.Limits)
+	if cfg.HTTP3 {
+		handler, err = listenAndServeHTTP3(cfg.Addr, handler, cfg.Limits, cfg.TLSCert, cfg.TLSKey, func(err error) {
+			raven.CaptureError(err, map[string]string{"task": "http3"})
+			logger.WithFields(logrus.Fields{"prefix": "http3"}).Errorf("HTTP/3 server failed: %v", err)
+		})
+		if err != nil {
+			log.Panic(err)
+		}
+	}
+	srv := NewHTTPServer(cfg.Addr, handler, cfg.Limits)
+	if len(cfg.TLSCert) != 0 {
+		fmt.Printf("Starting HTTPS server on %s", cfg.Addr)
+		err = ListenAndServeTLS(srv, cfg.Limits.MaxConnections, cfg.TLSCert, cfg.TLSKey)
+	} else {
+		fmt.Printf("Starting server on %s", cfg.Addr)
+		err = ListenAndServe(srv, cfg.Limits.MaxConnections)
+	}
 	if err != nil {
 		raven.CaptureErrorAndWait(err, nil)
 		log.Panic(err)
@@ -2,18 +2,46 @@ package server
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"github.com/brave-intl/bat-go/middleware"
+	"github.com/brave/go-update/config"
 	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/controller/clocktest"
+	"github.com/brave/go-update/events"
 	"github.com/brave/go-update/extension"
 	"github.com/brave/go-update/extension/extensiontest"
+	"github.com/brave/go-update/memstore"
+	"github.com/brave/go-update/privacy"
+	"github.com/brave/go-update/statsd"
 	"github.com/go-chi/chi"
+	"github.com/pressly/lg"
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/net/http2"
 	"io/ioutil"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -22,7 +50,18 @@ var newExtension1 = extension.Extension{}
 var newExtension2 = extension.Extension{}
 var handler http.Handler
 
+// handlerOptions are the options the routers of handler were given, with its catalog
+var handlerOptions *controller.Options
+
+// testClock is the clock of handler, which only moves when a test advances it
+var testClock *clocktest.Clock
+var crxDirectory string
+
 func init() {
+	// The shared AWS configs resolve their credentials when they are loaded, so every test uses these
+	os.Setenv("AWS_ACCESS_KEY_ID", "test")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+
 	newExtensionID1 := "newext1eplbcioakkpcpgfkobkghlhen"
 	newExtension1 = extension.Extension{
 		ID:          newExtensionID1,
@@ -44,17 +83,36 @@ func init() {
 	// We maintain a count to make sure the refresh function is called more than just
 	// the first time.
 	count := 0
-	controller.AllExtensionsMap = extension.LoadExtensionsIntoMap(&extension.OfferedExtensions)
-	controller.ExtensionUpdaterTimeout = time.Millisecond * 1
-	handler = chi.ServerBaseContext(setupRouter(setupLogger(context.Background())))
+	refreshed := make(chan bool)
+	offered := extension.LoadExtensionsIntoMap(&extension.OfferedExtensions)
+	controller.SetCatalog(offered)
+	controller.ExtensionStore = memstore.New(nil)
+	var err error
+	crxDirectory, err = ioutil.TempDir("", "go-update-crx")
+	if err != nil {
+		panic(err)
+	}
+	middleware.TokenList = []string{"test-token"}
+	testClock = clocktest.New(time.Now())
+	controller.DefaultClock = testClock
+	controller.ExtensionUpdaterTimeout = time.Minute
+	handler, handlerOptions = newHandler(WithLogger(setupLogger()), WithStore(memstore.New(nil)), WithRefreshInterval(time.Minute), WithClock(testClock), WithCRXDirectory(crxDirectory))
+	handlerOptions.SetCatalog(offered)
 	controller.RefreshExtensionsTicker(func() {
 		count++
 		if count == 1 {
-			controller.AllExtensionsMap[newExtensionID1] = newExtension1
+			handlerOptions.UpdateCatalog(func(catalog map[string]extension.Extension) {
+				catalog[newExtensionID1] = newExtension1
+			})
 		} else if count == 2 {
-			controller.AllExtensionsMap[newExtensionID2] = newExtension2
+			handlerOptions.UpdateCatalog(func(catalog map[string]extension.Extension) {
+				catalog[newExtensionID2] = newExtension2
+			})
+			close(refreshed)
 		}
 	})
+	testClock.Advance(time.Minute)
+	<-refreshed
 }
 
 func TestPing(t *testing.T) {
@@ -73,6 +131,25 @@ func TestPing(t *testing.T) {
 	}
 }
 
+func TestPingDuringMaintenance(t *testing.T) {
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	handlerOptions.UpdateSettings(func(settings *controller.Settings) {
+		settings.MaintenanceMode = true
+	})
+	defer handlerOptions.UpdateSettings(func(settings *controller.Settings) {
+		settings.MaintenanceMode = false
+	})
+
+	// Update checks are rejected, but the heartbeat still reports the instance as alive
+	resp, err := http.Post(server.URL+"/extensions", "application/xml", bytes.NewBufferString(extensiontest.ExtensionRequestFnFor("ldimlcelhnjgpjjemdjokpgeeikdinbm")("0.0.0")))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	resp, err = http.Get(server.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
 func testCall(t *testing.T, server *httptest.Server, method string, query string,
 	requestBody string, expectedResponseCode int, expectedResponse string, redirectLocation string) {
 	extensionsURL := fmt.Sprintf("%s/extensions%s", server.URL, query)
@@ -103,6 +180,28 @@ func testCall(t *testing.T, server *httptest.Server, method string, query string
 	assert.Equal(t, expectedResponse, strings.TrimSpace(string(actual)))
 }
 
+// postUpdateCheck sends an XML update check, which must succeed, and returns the response
+func postUpdateCheck(t *testing.T, server *httptest.Server, requestBody string) string {
+	resp, err := http.Post(server.URL+"/extensions", "application/xml", bytes.NewBufferString(requestBody))
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	actual, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	return string(actual)
+}
+
+// testRequestError checks that an update request fails with a bad request error of kind
+func testRequestError(t *testing.T, server *httptest.Server, requestBody string, kind error) {
+	resp, err := http.Post(server.URL+"/extensions", "application/xml", bytes.NewBufferString(requestBody))
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	actual, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Contains(t, string(actual), kind.Error())
+}
+
 func TestUpdateExtensions(t *testing.T) {
 	server := httptest.NewServer(handler)
 	defer server.Close()
@@ -125,28 +224,19 @@ func TestUpdateExtensions(t *testing.T) {
 				<updatecheck codebase="https://brave-core-ext.s3.brave.com/release/aomjjhallfgjeglblehebfpbcfeobpgk/extension_4_5_9_90.crx" version="4.5.9.90"/>
 			</app>
 		</request>`
-	expectedResponse = "Error reading body request version: 2.0 not supported"
-	testCall(t, server, http.MethodPost, "", requestBody, http.StatusBadRequest, expectedResponse, "")
+	testRequestError(t, server, requestBody, extension.ErrUnsupportedProtocol)
 
 	// Not XML
-	requestBody = "For the king!"
-	expectedResponse = "Error reading body EOF"
-	testCall(t, server, http.MethodPost, "", requestBody, http.StatusBadRequest, expectedResponse, "")
+	testRequestError(t, server, "For the king!", extension.ErrMalformedRequest)
 
 	// Malformed XML
-	requestBody = "<This way! No, that way!"
-	expectedResponse = "Error reading body XML syntax error on line 1: attribute name without = in element"
-	testCall(t, server, http.MethodPost, "", requestBody, http.StatusBadRequest, expectedResponse, "")
+	testRequestError(t, server, "<This way! No, that way!", extension.ErrMalformedRequest)
 
 	// Different XML schema
-	requestBody = "<text>For the alliance!</text>"
-	expectedResponse = "Error reading body expected element type <request> but have <text>"
-	testCall(t, server, http.MethodPost, "", requestBody, http.StatusBadRequest, expectedResponse, "")
+	testRequestError(t, server, "<text>For the alliance!</text>", extension.ErrMalformedRequest)
 
 	// Empty body request
-	requestBody = ""
-	expectedResponse = "Error reading body EOF"
-	testCall(t, server, http.MethodPost, "", requestBody, http.StatusBadRequest, expectedResponse, "")
+	testRequestError(t, server, "", extension.ErrMalformedRequest)
 
 	lightThemeExtension := extensiontest.ExtensionRequestFnFor("ldimlcelhnjgpjjemdjokpgeeikdinbm")
 
@@ -178,78 +268,29 @@ func TestUpdateExtensions(t *testing.T) {
 	expectedResponse = "<response protocol=\"3.1\" server=\"prod\"></response>"
 	testCall(t, server, http.MethodPost, "", requestBody, http.StatusOK, expectedResponse, "")
 
-	lightAndDarkThemeRequest := extensiontest.ExtensionRequestFnForTwo("ldimlcelhnjgpjjemdjokpgeeikdinbm", "bfdgpgibhagkpdlnjonhkabjoijopoge")
+	lightThemeID, lightThemeSHA256 := "ldimlcelhnjgpjjemdjokpgeeikdinbm", "1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618"
+	darkThemeID, darkThemeSHA256 := "bfdgpgibhagkpdlnjonhkabjoijopoge", "ae517d6273a4fc126961cb026e02946db4f9dbb58e3d9bc29f5e1270e3ce9834"
+	lightAndDarkThemeRequest := extensiontest.ExtensionRequestFnForTwo(lightThemeID, darkThemeID)
 
 	// Multiple components with none out of date
-	requestBody = lightAndDarkThemeRequest("70.0.0", "70.0.0")
-	expectedResponse = "<response protocol=\"3.1\" server=\"prod\"></response>"
-	testCall(t, server, http.MethodPost, "", requestBody, http.StatusOK, expectedResponse, "")
+	actual := postUpdateCheck(t, server, lightAndDarkThemeRequest("70.0.0", "70.0.0"))
+	extensiontest.AssertNoUpdate(t, actual, lightThemeID)
+	extensiontest.AssertNoUpdate(t, actual, darkThemeID)
 
 	// Only one components out of date
-	requestBody = lightAndDarkThemeRequest("0.0.0", "70.0.0")
-	expectedResponse = `<response protocol="3.1" server="prod">
-    <app appid="ldimlcelhnjgpjjemdjokpgeeikdinbm">
-        <updatecheck status="ok">
-            <urls>
-                <url codebase="https://brave-core-ext.s3.brave.com/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/extension_1_0_0.crx"></url>
-            </urls>
-            <manifest version="1.0.0">
-                <packages>
-                    <package name="extension_1_0_0.crx" hash_sha256="1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618" required="true"></package>
-                </packages>
-            </manifest>
-        </updatecheck>
-    </app>
-</response>`
-	testCall(t, server, http.MethodPost, "", requestBody, http.StatusOK, expectedResponse, "")
+	actual = postUpdateCheck(t, server, lightAndDarkThemeRequest("0.0.0", "70.0.0"))
+	extensiontest.AssertUpdateOffered(t, actual, lightThemeID, "1.0.0", lightThemeSHA256)
+	extensiontest.AssertNoUpdate(t, actual, darkThemeID)
 
 	// Other component of 2 out of date
-	requestBody = lightAndDarkThemeRequest("70.0.0", "0.0.0")
-	expectedResponse = `<response protocol="3.1" server="prod">
-    <app appid="bfdgpgibhagkpdlnjonhkabjoijopoge">
-        <updatecheck status="ok">
-            <urls>
-                <url codebase="https://brave-core-ext.s3.brave.com/release/bfdgpgibhagkpdlnjonhkabjoijopoge/extension_1_0_0.crx"></url>
-            </urls>
-            <manifest version="1.0.0">
-                <packages>
-                    <package name="extension_1_0_0.crx" hash_sha256="ae517d6273a4fc126961cb026e02946db4f9dbb58e3d9bc29f5e1270e3ce9834" required="true"></package>
-                </packages>
-            </manifest>
-        </updatecheck>
-    </app>
-</response>`
-	testCall(t, server, http.MethodPost, "", requestBody, http.StatusOK, expectedResponse, "")
+	actual = postUpdateCheck(t, server, lightAndDarkThemeRequest("70.0.0", "0.0.0"))
+	extensiontest.AssertNoUpdate(t, actual, lightThemeID)
+	extensiontest.AssertUpdateOffered(t, actual, darkThemeID, "1.0.0", darkThemeSHA256)
 
 	// Both components need updates
-	requestBody = lightAndDarkThemeRequest("0.0.0", "0.0.0")
-	expectedResponse = `<response protocol="3.1" server="prod">
-    <app appid="ldimlcelhnjgpjjemdjokpgeeikdinbm">
-        <updatecheck status="ok">
-            <urls>
-                <url codebase="https://brave-core-ext.s3.brave.com/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/extension_1_0_0.crx"></url>
-            </urls>
-            <manifest version="1.0.0">
-                <packages>
-                    <package name="extension_1_0_0.crx" hash_sha256="1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618" required="true"></package>
-                </packages>
-            </manifest>
-        </updatecheck>
-    </app>
-    <app appid="bfdgpgibhagkpdlnjonhkabjoijopoge">
-        <updatecheck status="ok">
-            <urls>
-                <url codebase="https://brave-core-ext.s3.brave.com/release/bfdgpgibhagkpdlnjonhkabjoijopoge/extension_1_0_0.crx"></url>
-            </urls>
-            <manifest version="1.0.0">
-                <packages>
-                    <package name="extension_1_0_0.crx" hash_sha256="ae517d6273a4fc126961cb026e02946db4f9dbb58e3d9bc29f5e1270e3ce9834" required="true"></package>
-                </packages>
-            </manifest>
-        </updatecheck>
-    </app>
-</response>`
-	testCall(t, server, http.MethodPost, "", requestBody, http.StatusOK, expectedResponse, "")
+	actual = postUpdateCheck(t, server, lightAndDarkThemeRequest("0.0.0", "0.0.0"))
+	extensiontest.AssertUpdateOffered(t, actual, lightThemeID, "1.0.0", lightThemeSHA256)
+	extensiontest.AssertUpdateOffered(t, actual, darkThemeID, "1.0.0", darkThemeSHA256)
 
 	// Unkonwn extension ID goes to Google server
 	requestBody = extensiontest.ExtensionRequestFnFor("aaaaaaaaaaaaaaaaaaaa")("0.0.0")
@@ -270,40 +311,12 @@ func TestUpdateExtensions(t *testing.T) {
 	testCall(t, server, http.MethodPost, "", requestBody, http.StatusBadRequest, expectedResponse, "")
 
 	// Single new extension out of date that was added in by the refresh timer
-	requestBody = extensiontest.ExtensionRequestFnFor("newext1eplbcioakkpcpgfkobkghlhen")("0.0.0")
-	expectedResponse = `<response protocol="3.1" server="prod">
-    <app appid="newext1eplbcioakkpcpgfkobkghlhen">
-        <updatecheck status="ok">
-            <urls>
-                <url codebase="https://brave-core-ext.s3.brave.com/release/newext1eplbcioakkpcpgfkobkghlhen/extension_1_0_0.crx"></url>
-            </urls>
-            <manifest version="1.0.0">
-                <packages>
-                    <package name="extension_1_0_0.crx" hash_sha256="4c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618" required="true"></package>
-                </packages>
-            </manifest>
-        </updatecheck>
-    </app>
-</response>`
-	testCall(t, server, http.MethodPost, "", requestBody, http.StatusOK, expectedResponse, "")
+	actual = postUpdateCheck(t, server, extensiontest.ExtensionRequestFnFor(newExtension1.ID)("0.0.0"))
+	extensiontest.AssertUpdateOffered(t, actual, newExtension1.ID, "1.0.0", newExtension1.SHA256)
 
 	// Single second new extension out of date that was added in by the refresh timer
-	requestBody = extensiontest.ExtensionRequestFnFor("newext2eplbcioakkpcpgfkobkghlhen")("0.0.0")
-	expectedResponse = `<response protocol="3.1" server="prod">
-    <app appid="newext2eplbcioakkpcpgfkobkghlhen">
-        <updatecheck status="ok">
-            <urls>
-                <url codebase="https://brave-core-ext.s3.brave.com/release/newext2eplbcioakkpcpgfkobkghlhen/extension_1_0_0.crx"></url>
-            </urls>
-            <manifest version="1.0.0">
-                <packages>
-                    <package name="extension_1_0_0.crx" hash_sha256="3c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618" required="true"></package>
-                </packages>
-            </manifest>
-        </updatecheck>
-    </app>
-</response>`
-	testCall(t, server, http.MethodPost, "", requestBody, http.StatusOK, expectedResponse, "")
+	actual = postUpdateCheck(t, server, extensiontest.ExtensionRequestFnFor(newExtension2.ID)("0.0.0"))
+	extensiontest.AssertUpdateOffered(t, actual, newExtension2.ID, "1.0.0", newExtension2.SHA256)
 }
 
 func getQueryParams(extension *extension.Extension) string {
@@ -377,6 +390,175 @@ func TestWebStoreUpdateExtension(t *testing.T) {
 	query = "?" + getQueryParams(&unknownExtension) + "&" + getQueryParams(&unknownExtension2)
 	expectedResponse = `<gupdate protocol="3.1" server="prod"></gupdate>`
 	testCall(t, server, http.MethodGet, query, requestBody, http.StatusOK, expectedResponse, "")
+
+	// JSON can be asked for with the format parameter or the Accept header
+	getWebStoreResponse := func(query string, accept string) (string, string) {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/extensions?"+query, nil)
+		assert.Nil(t, err)
+		req.Header.Set("Accept", accept)
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		actual, err := ioutil.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		return resp.Header.Get("Content-Type"), string(actual)
+	}
+	jsonPrefix := `{"gupdate":{"protocol":"3.1","server":"prod","app":[{"appid":"ldimlcelhnjgpjjemdjokpgeeikdinbm","status":"ok"`
+	contentType, actual := getWebStoreResponse(getQueryParams(&outdatedLightThemeExtension)+"&format=json", "")
+	assert.Equal(t, "application/json", contentType)
+	assert.True(t, strings.HasPrefix(actual, jsonPrefix), actual)
+	contentType, actual = getWebStoreResponse(getQueryParams(&outdatedLightThemeExtension), "application/json, application/xml;q=0.9")
+	assert.Equal(t, "application/json", contentType)
+	assert.True(t, strings.HasPrefix(actual, jsonPrefix), actual)
+	contentType, actual = getWebStoreResponse(getQueryParams(&outdatedLightThemeExtension), "text/xml, application/json")
+	assert.Equal(t, "application/xml", contentType)
+	assert.True(t, strings.HasPrefix(actual, `<gupdate protocol="3.1"`), actual)
+
+	// Legacy clients using protocol 2.0 get the update2 document, with the time of day of the clock
+	now := testClock.Now().UTC()
+	elapsed := now.Hour()*3600 + now.Minute()*60 + now.Second()
+	for _, legacyQuery := range []string{"&v=2", "&protocol=2.0"} {
+		resp, err := http.Get(server.URL + "/extensions?" + getQueryParams(&outdatedLightThemeExtension) + legacyQuery)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		actual, err := ioutil.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		assert.Regexp(t, `^<gupdate xmlns="http://www.google.com/update2/response" protocol="2.0" server="prod">\s*<daystart elapsed_seconds="`+strconv.Itoa(elapsed)+`"></daystart>\s*<app appid="ldimlcelhnjgpjjemdjokpgeeikdinbm" status="ok">`, string(actual))
+	}
+}
+
+func TestHeadAndOptions(t *testing.T) {
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	send := func(method string, path string, header http.Header) (*http.Response, string) {
+		req, err := http.NewRequest(method, server.URL+path, nil)
+		assert.Nil(t, err)
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		return resp, string(body)
+	}
+
+	// HEAD is answered like GET without the body
+	outdated := extension.Extension{ID: "ldimlcelhnjgpjjemdjokpgeeikdinbm", Version: "0.0.0"}
+	for _, path := range []string{"/extensions?" + getQueryParams(&outdated), "/keys", "/readyz"} {
+		get, body := send(http.MethodGet, path, nil)
+		head, headBody := send(http.MethodHead, path, nil)
+		assert.Equal(t, get.StatusCode, head.StatusCode, path)
+		assert.Equal(t, "", headBody, path)
+		assert.Equal(t, int64(len(body)), head.ContentLength, path)
+		assert.Equal(t, get.Header.Get("Content-Type"), head.Header.Get("Content-Type"), path)
+	}
+
+	resp, _ := send(http.MethodOptions, "/extensions", nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, "GET, HEAD, POST, OPTIONS", resp.Header.Get("Allow"))
+	assert.Equal(t, "", resp.Header.Get("Access-Control-Allow-Origin"))
+
+	// Pages from any origin can check for updates
+	resp, _ = send(http.MethodOptions, "/extensions", http.Header{
+		"Origin":                         {"https://webview.example.com"},
+		"Access-Control-Request-Method":  {"POST"},
+		"Access-Control-Request-Headers": {"content-type"},
+	})
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, "*", resp.Header.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, HEAD, POST, OPTIONS", resp.Header.Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "content-type", resp.Header.Get("Access-Control-Allow-Headers"))
+	resp, _ = send(http.MethodGet, "/extensions?"+getQueryParams(&outdated), http.Header{"Origin": {"https://webview.example.com"}})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "*", resp.Header.Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORS(t *testing.T) {
+	router := chi.ServerBaseContext(lg.WithLoggerContext(context.Background(), logrus.New()), setupRouter(options{
+		corsOrigins: []string{"https://dashboard.example.com"},
+		corsMethods: []string{"GET", "PUT"},
+	}))
+	send := func(method string, path string, origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Origin", origin)
+		if method == http.MethodOptions {
+			req.Header.Set("Access-Control-Request-Method", "PUT")
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Preflights are answered without a token
+	for _, path := range []string{"/api/v1/admin/catalog", "/api/stats/extensions", "/openapi.json", "/t/acme/api/admin/catalog"} {
+		rr := send(http.MethodOptions, path, "https://dashboard.example.com")
+		assert.Equal(t, http.StatusNoContent, rr.Code, path)
+		assert.Equal(t, "https://dashboard.example.com", rr.Header().Get("Access-Control-Allow-Origin"), path)
+		assert.Equal(t, "GET, PUT", rr.Header().Get("Access-Control-Allow-Methods"), path)
+		assert.Contains(t, rr.Header().Get("Access-Control-Allow-Headers"), "Authorization", path)
+	}
+	// Requests still need a token
+	rr := send(http.MethodGet, "/api/v1/admin/catalog", "https://dashboard.example.com")
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Equal(t, "https://dashboard.example.com", rr.Header().Get("Access-Control-Allow-Origin"))
+
+	// Other origins and paths aren't allowed
+	rr = send(http.MethodOptions, "/api/v1/admin/catalog", "https://evil.example.com")
+	assert.Equal(t, "", rr.Header().Get("Access-Control-Allow-Origin"))
+	assert.NotEqual(t, http.StatusNoContent, rr.Code)
+	rr = send(http.MethodGet, "/keys", "https://dashboard.example.com")
+	assert.Equal(t, "", rr.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCompression(t *testing.T) {
+	requestBody := `<?xml version="1.0" encoding="UTF-8"?><request protocol="3.0">`
+	for _, ext := range extension.OfferedExtensions {
+		requestBody += `<app appid="` + ext.ID + `" version="0.0.0"><updatecheck/></app>`
+	}
+	requestBody += `</request>`
+	send := func(body string, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/extensions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/xml")
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	plain := send(requestBody, "")
+	assert.Equal(t, http.StatusOK, plain.Code)
+	assert.Equal(t, "", plain.Header().Get("Content-Encoding"))
+	assert.True(t, plain.Body.Len() >= config.Default().CompressionMinSize)
+
+	// Large responses are compressed, and identical ones are only compressed once
+	for i := 0; i < 2; i++ {
+		rr := send(requestBody, "br;q=0, gzip;q=0.8, identity")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "gzip", rr.Header().Get("Content-Encoding"))
+		assert.Contains(t, rr.Header()["Vary"], "Accept-Encoding")
+		assert.Equal(t, strconv.Itoa(rr.Body.Len()), rr.Header().Get("Content-Length"))
+		reader, err := gzip.NewReader(rr.Body)
+		assert.Nil(t, err)
+		body, err := ioutil.ReadAll(reader)
+		assert.Nil(t, err)
+		assert.Equal(t, plain.Body.String(), string(body))
+	}
+	compressedMutex.Lock()
+	_, cached := compressedCache[compressedKey{encoding: "gzip", sum: sha256.Sum256(plain.Body.Bytes())}]
+	compressedMutex.Unlock()
+	assert.True(t, cached)
+
+	// Small responses aren't
+	rr := send(`<?xml version="1.0" encoding="UTF-8"?><request protocol="3.0"></request>`, "gzip")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "", rr.Header().Get("Content-Encoding"))
+	assert.Contains(t, rr.Body.String(), "<response")
+
+	assert.Equal(t, "gzip", acceptedEncoding(&http.Request{Header: http.Header{"Accept-Encoding": {"*"}}}))
+	assert.Equal(t, "", acceptedEncoding(&http.Request{Header: http.Header{"Accept-Encoding": {"gzip;q=0"}}}))
+	assert.Equal(t, "", acceptedEncoding(&http.Request{Header: http.Header{"Accept-Encoding": {"deflate"}}}))
 }
 
 func TestPrintExtensions(t *testing.T) {
@@ -399,7 +581,9 @@ func TestPrintExtensions(t *testing.T) {
 	assert.True(t, strings.Contains(string(actual), "ldimlcelhnjgpjjemdjokpgeeikdinbm"))
 
 	// Clear out the extensions map.
-	controller.AllExtensionsMap = map[string]extension.Extension{}
+	allExtensionsMap := handlerOptions.CurrentCatalog().Map()
+	defer handlerOptions.SetCatalog(allExtensionsMap)
+	handlerOptions.SetCatalog(map[string]extension.Extension{})
 	resp, err = client.Do(req)
 	assert.Nil(t, err)
 	assert.Equal(t, http.StatusOK, resp.StatusCode)
@@ -407,3 +591,821 @@ func TestPrintExtensions(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, string(actual), "No extensions found, do you have the AWS config correct for DynamoDB?")
 }
+
+func TestRecoverer(t *testing.T) {
+	ctx := lg.WithLoggerContext(context.Background(), setupLogger())
+	panicHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("For the horde!")
+	})
+	server := httptest.NewServer(chi.ServerBaseContext(ctx, recoverer(panicHandler)))
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/extensions", "application/xml", bytes.NewBufferString(""))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Equal(t, "application/xml", resp.Header.Get("Content-Type"))
+	actual, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, internalErrorXML, string(actual))
+
+	// Tenants' update checks get one too, in the JSON protocol 4 if that is what they were sent in
+	resp, err = http.Post(server.URL+"/t/beta/extensions", "application/xml", bytes.NewBufferString(""))
+	assert.Nil(t, err)
+	actual, err = ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, internalErrorXML, string(actual))
+	resp, err = http.Post(server.URL+"/extensions", "application/json", bytes.NewBufferString(""))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	actual, err = ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, internalErrorJSON, string(actual))
+	assert.True(t, json.Valid(bytes.TrimPrefix(actual, []byte(extension.Protocol4Prefix))))
+
+	resp, err = http.Get(server.URL + "/api/admin/health/packages")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	actual, err = ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, "Internal Server Error\n", string(actual))
+
+	// Aborted responses are left to the HTTP server
+	abort := recoverer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		abort.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/extensions", nil))
+	})
+}
+
+func TestNewHTTPServer(t *testing.T) {
+	limits := config.Default().Limits
+	limits.WriteTimeout = 5 * time.Second
+	srv := NewHTTPServer(":8192", handler, limits)
+	assert.Equal(t, 5*time.Second, srv.WriteTimeout)
+	assert.Equal(t, limits.ReadHeaderTimeout, srv.ReadHeaderTimeout)
+	assert.Equal(t, limits.MaxHeaderBytes, srv.MaxHeaderBytes)
+}
+
+func TestListen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-update-listen")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "go-update.sock")
+
+	// The socket of a previous process is replaced
+	stale, err := net.Listen("unix", path)
+	assert.Nil(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	assert.Nil(t, stale.Close())
+	listener, err := Listen("unix:" + path)
+	assert.Nil(t, err)
+	srv := NewHTTPServer("unix:"+path, handler, config.Default().Limits)
+	go func() {
+		_ = srv.Serve(listener)
+	}()
+	defer srv.Close()
+	client := &http.Client{Transport: &http.Transport{DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, "unix", path)
+	}}}
+	resp, err := client.Get("http://localhost/keys")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Nil(t, resp.Body.Close())
+
+	// Without sockets passed by systemd to this process
+	_, err = Listen("systemd")
+	assert.NotNil(t, err)
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	os.Setenv("LISTEN_FDS", "1")
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	_, err = Listen("systemd")
+	assert.NotNil(t, err)
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	os.Setenv("LISTEN_FDNAMES", "admin")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+	_, err = Listen("systemd:http")
+	assert.NotNil(t, err)
+}
+
+func TestListenAndServeTLS(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+	dir, err := ioutil.TempDir("", "go-update-tls")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	assert.Nil(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.Nil(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	srv := NewHTTPServer(listener.Addr().String(), handler, config.Default().Limits)
+	go func() {
+		_ = serveTLS(srv, listener, certFile, keyFile)
+	}()
+	defer srv.Close()
+	url := "https://" + listener.Addr().String() + "/keys"
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+
+	client := &http.Client{Transport: &http2.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	resp, err := client.Get(url)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 2, resp.ProtoMajor)
+	assert.Nil(t, resp.Body.Close())
+
+	// Clients without HTTP/2 are served HTTP/1.1, and TLS before 1.2 is refused
+	client = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	resp, err = client.Get(url)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 1, resp.ProtoMajor)
+	assert.Nil(t, resp.Body.Close())
+	client = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, MaxVersion: tls.VersionTLS11}}}
+	_, err = client.Get(url)
+	assert.NotNil(t, err)
+}
+
+func TestLimitInFlight(t *testing.T) {
+	limits := config.Default().Limits
+	_, ok := LimitInFlight(handler, limits).(*inFlightLimiter)
+	assert.False(t, ok)
+
+	started := make(chan bool, 3)
+	release := make(chan bool)
+	limits.MaxInFlight, limits.QueueSize, limits.QueueTimeout = 1, 1, 100*time.Millisecond
+	limited := LimitInFlight(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- true
+		<-release
+	}), limits)
+	serve := func() chan *httptest.ResponseRecorder {
+		done := make(chan *httptest.ResponseRecorder, 1)
+		go func() {
+			recorder := httptest.NewRecorder()
+			limited.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/extensions", nil))
+			done <- recorder
+		}()
+		return done
+	}
+
+	// The first request is handled, the second waits in the queue and the third is rejected
+	first := serve()
+	<-started
+	second := serve()
+	for i := 0; i < 100 && len(limited.(*inFlightLimiter).queue) != 1; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	third := <-serve()
+	assert.Equal(t, http.StatusServiceUnavailable, third.Code)
+	assert.Equal(t, "60", third.Header().Get("Retry-After"))
+	assert.Equal(t, "60", third.Header().Get("X-Retry-After"))
+
+	// Requests which wait too long are rejected too
+	timedOut := <-second
+	assert.Equal(t, http.StatusServiceUnavailable, timedOut.Code)
+
+	// Requests in the queue are handled once a request in flight finishes
+	fourth := serve()
+	for i := 0; i < 100 && len(limited.(*inFlightLimiter).queue) != 1; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	release <- true
+	assert.Equal(t, http.StatusOK, (<-first).Code)
+	<-started
+	release <- true
+	assert.Equal(t, http.StatusOK, (<-fourth).Code)
+}
+
+func TestLimitListener(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	limited := LimitListener(listener, 1)
+	defer limited.Close()
+
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for {
+			c, err := limited.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- c
+		}
+	}()
+
+	client1, err := net.Dial("tcp", listener.Addr().String())
+	assert.Nil(t, err)
+	defer client1.Close()
+	client2, err := net.Dial("tcp", listener.Addr().String())
+	assert.Nil(t, err)
+	defer client2.Close()
+
+	// Only the first connection is accepted until it is closed
+	conn1 := <-accepted
+	select {
+	case <-accepted:
+		t.Fatal("Accepted more connections than the limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.Nil(t, conn1.Close())
+	select {
+	case conn2 := <-accepted:
+		assert.Nil(t, conn2.Close())
+	case <-time.After(time.Second):
+		t.Fatal("Connection was not accepted after another closed")
+	}
+}
+
+func TestNew(t *testing.T) {
+	var called bool
+	handler := New(
+		WithStore(memstore.New(nil)),
+		WithFallbackURLs("https://webstore.example.com/crx", "https://update.example.com/update2"),
+		WithMiddleware(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				next.ServeHTTP(w, r)
+			})
+		}),
+	)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	query := "?x=id%3Daaaaaaaaaaaaaaaaaaaa%26v%3D0.0.0"
+	resp, err := client.Get(server.URL + "/extensions" + query)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+	assert.Equal(t, "https://webstore.example.com/crx?x=id%3Daaaaaaaaaaaaaaaaaaaa%26v%3D0.0.0&braveRedirect=true", resp.Header.Get("Location"))
+	assert.True(t, called)
+
+	requestBody := extensiontest.ExtensionRequestFnFor("aaaaaaaaaaaaaaaaaaaa")("0.0.0")
+	resp, err = client.Post(server.URL+"/extensions", "application/xml", bytes.NewBufferString(requestBody))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+	assert.Equal(t, "https://update.example.com/update2?braveRedirect=true", resp.Header.Get("Location"))
+}
+
+func TestSeveralHandlers(t *testing.T) {
+	embedded := newExtension1
+	embedded.ID = "embeddedplbcioakkpcpgfkobkghlhen"
+	first, firstOptions := newHandler(
+		WithStore(memstore.New(extension.Extensions{embedded})),
+		WithFallbackURLs("https://first.example.com/crx", "https://first.example.com/update2"),
+	)
+	second, secondOptions := newHandler(
+		WithStore(memstore.New(nil)),
+		WithFallbackURLs("https://second.example.com/crx", "https://second.example.com/update2"),
+	)
+
+	// Each handler serves its own catalog and redirects to its own fallback URL
+	check := func(handler http.Handler) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/extensions?x="+url.QueryEscape("id="+embedded.ID+"&v=0.0.0"), nil))
+		return rr
+	}
+	rr := check(first)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), embedded.SHA256)
+	rr = check(second)
+	assert.Equal(t, http.StatusTemporaryRedirect, rr.Code)
+	assert.True(t, strings.HasPrefix(rr.Header().Get("Location"), "https://second.example.com/crx?"))
+
+	_, ok := firstOptions.CurrentCatalog().Lookup(embedded.ID)
+	assert.True(t, ok)
+	for _, catalog := range []*controller.CatalogSnapshot{secondOptions.CurrentCatalog(), handlerOptions.CurrentCatalog(), controller.CurrentCatalog()} {
+		_, ok = catalog.Lookup(embedded.ID)
+		assert.False(t, ok)
+	}
+	// Neither changed the settings of the other handlers
+	assert.Equal(t, "https://clients2.google.com/service/update2/crx", handlerOptions.Settings.WebStoreFallbackURL)
+}
+
+func TestHandlersWithDifferentConfigs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-update-handlers")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	ext := newExtension1
+	ext.ID = "aaaaaaaaplbcioakkpcpgfkobkghlhen"
+
+	// The first handler keeps the extension out of the next hours with a serving window,
+	// and the second is in maintenance mode
+	start := time.Now().UTC().Add(2 * time.Hour)
+	windows := fmt.Sprintf(`[{"id":%q,"start":%q,"end":%q}]`, ext.ID, start.Format("15:04"), start.Add(time.Hour).Format("15:04"))
+	firstConfig := config.Default()
+	firstConfig.ServingWindowsFile = filepath.Join(dir, "windows.json")
+	assert.Nil(t, ioutil.WriteFile(firstConfig.ServingWindowsFile, []byte(windows), 0600))
+	secondConfig := config.Default()
+	secondConfig.MaintenanceMode = true
+	first, firstOptions := newHandler(WithConfig(firstConfig), WithStore(memstore.New(extension.Extensions{ext})))
+	second, secondOptions := newHandler(WithConfig(secondConfig), WithStore(memstore.New(extension.Extensions{ext})))
+
+	check := func(handler http.Handler) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/extensions", strings.NewReader(extensiontest.ExtensionRequestFnFor(ext.ID)("0.0.0"))))
+		return rr
+	}
+	checkBoth := func() (*httptest.ResponseRecorder, *httptest.ResponseRecorder) {
+		var wg sync.WaitGroup
+		var firstResponse, secondResponse *httptest.ResponseRecorder
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			firstResponse = check(first)
+		}()
+		go func() {
+			defer wg.Done()
+			secondResponse = check(second)
+		}()
+		wg.Wait()
+		return firstResponse, secondResponse
+	}
+
+	// Served side by side, each handler follows its own configuration
+	firstResponse, secondResponse := checkBoth()
+	assert.Equal(t, http.StatusOK, firstResponse.Code)
+	assert.NotContains(t, firstResponse.Body.String(), ext.SHA256)
+	assert.NotEmpty(t, firstResponse.Header().Get("X-Retry-After"))
+	assert.Equal(t, http.StatusServiceUnavailable, secondResponse.Code)
+
+	// Changing the settings of one handler leaves the other alone
+	secondOptions.UpdateSettings(func(settings *controller.Settings) {
+		settings.MaintenanceMode = false
+	})
+	firstOptions.UpdateSettings(func(settings *controller.Settings) {
+		settings.MaintenanceMode = true
+	})
+	firstResponse, secondResponse = checkBoth()
+	assert.Equal(t, http.StatusServiceUnavailable, firstResponse.Code)
+	assert.Equal(t, http.StatusOK, secondResponse.Code)
+	assert.Contains(t, secondResponse.Body.String(), ext.SHA256)
+	assert.Empty(t, secondResponse.Header().Get("X-Retry-After"))
+
+	// Neither touched the handler of the other tests, which doesn't have the extension
+	assert.Equal(t, http.StatusTemporaryRedirect, check(handler).Code)
+	assert.False(t, handlerOptions.Settings.MaintenanceMode)
+}
+
+func TestMiddlewareOptions(t *testing.T) {
+	order := []string{}
+	record := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	quota := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "Quota exceeded", http.StatusTooManyRequests)
+		})
+	}
+	tenant := &controller.Tenant{Name: "resolved", Store: memstore.New(nil)}
+	controller.RegisterTenants(tenant)
+	var resolved *controller.Tenant
+	router := chi.ServerBaseContext(lg.WithLoggerContext(context.Background(), logrus.New()), setupRouter(options{
+		outerMiddleware: []func(http.Handler) http.Handler{record("outer")},
+		middleware:      []func(http.Handler) http.Handler{record("inner")},
+		routeMiddleware: []routeMiddleware{{prefix: "/api/", middleware: []func(http.Handler) http.Handler{quota}}},
+		tenantResolver: func(r *http.Request) *controller.Tenant {
+			resolved = controller.TenantNamed(r.Header.Get("X-Tenant"))
+			return resolved
+		},
+	}))
+
+	// Outer middleware runs first, even for the heartbeat answered by the built in middleware
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, []string{"outer"}, order)
+
+	// Route middleware only runs on its routes
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v2/admin/catalog", nil))
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, []string{"outer", "outer", "inner"}, order)
+
+	// The tenant is chosen by the resolver
+	req := httptest.NewRequest(http.MethodGet, "/extensions?x="+url.QueryEscape("id=aomjjhallfgjeglblehebfpbcfeobpgk&v=0.0.0"), nil)
+	req.Header.Set("X-Tenant", "resolved")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, tenant, resolved)
+	// The tenant's catalog is empty, so the single unknown extension is redirected
+	assert.Equal(t, http.StatusTemporaryRedirect, rr.Code)
+}
+
+func TestReloadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-update-config")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yml")
+	err = ioutil.WriteFile(path, []byte("log_level: debug\nwebstore_fallback_url: https://webstore.example.com/crx\n"), 0644)
+	assert.Nil(t, err)
+
+	logger := logrus.New()
+	handler, opts := newHandler(WithStore(memstore.New(nil)))
+	reloader := &configReloader{args: []string{"-config", path}, logger: logger, config: config.Default(), options: opts}
+	opts.Reload = reloader.Reload
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	reload := func() int {
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/api/admin/reload", nil)
+		assert.Nil(t, err)
+		req.Header.Set("Authorization", "Bearer test-token")
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusNoContent, reload())
+	assert.Equal(t, logrus.DebugLevel, logger.Level)
+	assert.Equal(t, "https://webstore.example.com/crx", opts.Settings.WebStoreFallbackURL)
+	assert.Equal(t, "https://clients2.google.com/service/update2/crx", handlerOptions.Settings.WebStoreFallbackURL)
+
+	// An invalid config is rejected and the current settings are kept
+	err = ioutil.WriteFile(path, []byte("log_level: loud\nwebstore_fallback_url: https://other.example.com/crx\n"), 0644)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, reload())
+	assert.Equal(t, logrus.DebugLevel, logger.Level)
+	assert.Equal(t, "https://webstore.example.com/crx", opts.Settings.WebStoreFallbackURL)
+
+	opts.Reload = nil
+	assert.Equal(t, http.StatusNotImplemented, reload())
+}
+
+func TestRealIP(t *testing.T) {
+	trusted := parseCIDRs([]string{"10.0.0.0/8", "192.0.2.0/24"})
+	tests := []struct {
+		remoteAddr string
+		forwarded  []string
+		realIP     string
+		expected   string
+	}{
+		// Headers from untrusted addresses are ignored
+		{"203.0.113.7:1234", []string{"198.51.100.1"}, "", "203.0.113.7:1234"},
+		{"203.0.113.7:1234", nil, "198.51.100.1", "203.0.113.7:1234"},
+		{"10.0.0.1:1234", nil, "", "10.0.0.1:1234"},
+		{"10.0.0.1:1234", []string{"198.51.100.1"}, "", "198.51.100.1"},
+		// Addresses prepended by the client are skipped
+		{"10.0.0.1:1234", []string{"1.2.3.4, 198.51.100.1"}, "", "198.51.100.1"},
+		{"10.0.0.1:1234", []string{"1.2.3.4, 198.51.100.1, 192.0.2.10"}, "", "198.51.100.1"},
+		{"10.0.0.1:1234", []string{"1.2.3.4", "198.51.100.1"}, "", "198.51.100.1"},
+		{"10.0.0.1:1234", []string{"10.0.0.2, 192.0.2.10"}, "", "10.0.0.2"},
+		{"10.0.0.1:1234", []string{"1.2.3.4, not-an-ip, 192.0.2.10"}, "", "10.0.0.1:1234"},
+		{"10.0.0.1:1234", nil, "198.51.100.1", "198.51.100.1"},
+	}
+	for _, test := range tests {
+		var actual string
+		handler := realIP(trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			actual = r.RemoteAddr
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = test.remoteAddr
+		for _, forwarded := range test.forwarded {
+			req.Header.Add("X-Forwarded-For", forwarded)
+		}
+		if len(test.realIP) != 0 {
+			req.Header.Set("X-Real-IP", test.realIP)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		assert.Equal(t, test.expected, actual, "%s %v %s", test.remoteAddr, test.forwarded, test.realIP)
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	trusted := parseCIDRs([]string{"10.0.0.0/8"})
+	handler := securityHeaders(trusted, time.Hour, true)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	serve := func(method string, target string, remoteAddr string, proto string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req.RemoteAddr = remoteAddr
+		if len(proto) != 0 {
+			req.Header.Set("X-Forwarded-Proto", proto)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// HTTPS through a trusted proxy gets HSTS
+	w := serve(http.MethodPost, "http://updates.example.com/extensions", "10.0.0.1:1234", "https")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+	assert.Equal(t, "max-age=3600", w.Header().Get("Strict-Transport-Security"))
+
+	// Plain HTTP update checks are redirected, keeping the method of POST requests
+	w = serve(http.MethodGet, "http://updates.example.com/extensions?x=id%3Dabc", "10.0.0.1:1234", "http")
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "https://updates.example.com/extensions?x=id%3Dabc", w.Header().Get("Location"))
+	assert.Empty(t, w.Header().Get("Strict-Transport-Security"))
+	w = serve(http.MethodPost, "http://updates.example.com/t/beta/extensions", "10.0.0.1:1234", "")
+	assert.Equal(t, http.StatusPermanentRedirect, w.Code)
+	assert.Equal(t, "https://updates.example.com/t/beta/extensions", w.Header().Get("Location"))
+
+	// X-Forwarded-Proto is only believed from trusted proxies
+	w = serve(http.MethodPost, "http://updates.example.com/extensions", "203.0.113.7:1234", "https")
+	assert.Equal(t, http.StatusPermanentRedirect, w.Code)
+
+	// Other endpoints, like the heartbeat load balancers check, aren't redirected
+	w = serve(http.MethodGet, "http://updates.example.com/", "10.0.0.1:1234", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+	w = serve(http.MethodGet, "http://updates.example.com/t/beta/api/admin/catalog", "10.0.0.1:1234", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestAdminListener(t *testing.T) {
+	// A CA issuing the server's and a client's certificates
+	newCertificate := func(template *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, []byte) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		assert.Nil(t, err)
+		if parent == nil {
+			parent, parentKey = template, key
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+		assert.Nil(t, err)
+		cert, err := x509.ParseCertificate(der)
+		assert.Nil(t, err)
+		return cert, key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	}
+	ca, caKey, caPEM := newCertificate(&x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "admin CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, nil)
+	clientCert, clientKey, _ := newCertificate(&x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "release-bot"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey)
+	dir, err := ioutil.TempDir("", "go-update-admin")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	assert.Nil(t, ioutil.WriteFile(caFile, caPEM, 0600))
+
+	r := chi.NewRouter()
+	r.With(adminListenerOnly(true)).Get("/api/admin/catalog", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	r.Get("/extensions", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	// The public listener doesn't serve the admin API
+	public := httptest.NewServer(r)
+	defer public.Close()
+	resp, err := http.Get(public.URL + "/api/admin/catalog")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp, err = http.Get(public.URL + "/extensions")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// The admin listener only accepts clients with a certificate from the CA
+	tlsConfig, err := newAdminTLSConfig(caFile)
+	assert.Nil(t, err)
+	admin := httptest.NewUnstartedServer(viaAdminListener(r))
+	admin.TLS = tlsConfig
+	admin.StartTLS()
+	defer admin.Close()
+	serverCAs := x509.NewCertPool()
+	serverCAs.AddCert(admin.Certificate())
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		RootCAs:      serverCAs,
+		Certificates: []tls.Certificate{{Certificate: [][]byte{clientCert.Raw}, PrivateKey: clientKey}},
+	}}}
+	resp, err = client.Get(admin.URL + "/api/admin/catalog")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	anonymous := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: serverCAs}}}
+	_, err = anonymous.Get(admin.URL + "/api/admin/catalog")
+	assert.NotNil(t, err)
+
+	_, err = newAdminTLSConfig(filepath.Join(dir, "missing.pem"))
+	assert.NotNil(t, err)
+}
+
+func TestStatsD(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer conn.Close()
+	client, err := statsd.New(conn.LocalAddr().String(), "go_update.", nil)
+	assert.Nil(t, err)
+	defer client.Close()
+	r := chi.NewRouter()
+	r.Use(statsdMetrics(client))
+	r.Mount("/extensions", controller.ExtensionsRouter(extension.OfferedExtensions, &controller.Options{Stats: client}))
+	server := httptest.NewServer(chi.ServerBaseContext(lg.WithLoggerContext(context.Background(), logrus.New()), r))
+	defer server.Close()
+
+	requestBody := extensiontest.ExtensionRequestFnFor("ldimlcelhnjgpjjemdjokpgeeikdinbm")("0.0.0")
+	resp, err := http.Post(server.URL+"/extensions", "application/xml", bytes.NewBufferString(requestBody))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	metrics := []string{}
+	buf := make([]byte, 1024)
+	for len(metrics) < 3 {
+		assert.Nil(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+		n, _, err := conn.ReadFrom(buf)
+		if !assert.Nil(t, err) {
+			break
+		}
+		metrics = append(metrics, string(buf[:n]))
+	}
+	assert.Contains(t, metrics, "go_update.updates.served:1|c|#id:ldimlcelhnjgpjjemdjokpgeeikdinbm,version:1.0.0,protocol:omaha")
+	assert.Contains(t, metrics, "go_update.requests:1|c|#route:/extensions/,method:POST,status:200")
+	assert.True(t, strings.HasPrefix(metrics[2], "go_update.request.duration:"))
+}
+
+func TestOpsRouter(t *testing.T) {
+	server := httptest.NewServer(opsRouter())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/debug/vars")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	vars := map[string]interface{}{}
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(&vars))
+	assert.Contains(t, vars, "goroutines")
+	assert.Contains(t, vars, "extensions")
+	assert.Contains(t, vars, "memstats")
+
+	resp, err = http.Get(server.URL + "/debug/pprof/goroutine?debug=1")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	for _, path := range []string{"/healthz", "/readyz", "/metrics"} {
+		resp, err = http.Get(server.URL + path)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, path)
+	}
+
+	// None of the diagnostics are on the public router
+	public := httptest.NewServer(handler)
+	defer public.Close()
+	resp, err = http.Get(public.URL + "/debug/pprof/goroutine?debug=1")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// and metrics are only on the ops listener when it is enabled
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	router := chi.ServerBaseContext(lg.WithLoggerContext(context.Background(), logrus.New()), setupRouter(options{opsListener: true}))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestLoadSecrets(t *testing.T) {
+	assert.Nil(t, os.Setenv("GO_UPDATE_TEST_ADMIN_TOKENS", "rotated-token, other-token"))
+	defer os.Unsetenv("GO_UPDATE_TEST_ADMIN_TOKENS")
+	handler, opts := newHandler(WithStore(memstore.New(nil)))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	getCatalog := func(token string) int {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/api/admin/catalog", nil)
+		assert.Nil(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		return resp.StatusCode
+	}
+	assert.Equal(t, http.StatusOK, getCatalog("test-token"))
+
+	cfg := config.Default()
+	cfg.AdminTokensSecret = "GO_UPDATE_TEST_ADMIN_TOKENS"
+	provider, err := newSecretsProvider(context.Background(), cfg)
+	assert.Nil(t, err)
+	assert.Nil(t, loadSecrets(context.Background(), cfg, provider, opts))
+	assert.Equal(t, []string{"rotated-token", "other-token"}, opts.Settings.AdminTokens)
+
+	// The tokens from the secret replace TOKEN_LIST
+	assert.Equal(t, http.StatusForbidden, getCatalog("test-token"))
+	assert.Equal(t, http.StatusOK, getCatalog("rotated-token"))
+	assert.Equal(t, http.StatusOK, getCatalog("other-token"))
+	assert.Equal(t, http.StatusForbidden, getCatalog(""))
+
+	// The admin tokens of tenants are loaded too
+	assert.Nil(t, os.Setenv("GO_UPDATE_TEST_BETA_TOKENS", "beta-token"))
+	defer os.Unsetenv("GO_UPDATE_TEST_BETA_TOKENS")
+	cfg.Tenants = []config.Tenant{{Name: "beta", AdminTokensSecret: "GO_UPDATE_TEST_BETA_TOKENS"}}
+	assert.Nil(t, loadSecrets(context.Background(), cfg, provider, opts))
+	_, err = controller.AuthorizeAdmin(controller.WithOptionsContext(context.Background(), opts), &controller.Tenant{Name: "beta"}, "beta-token", true)
+	assert.Nil(t, err)
+
+	// So are the response signing keys
+	privateKey := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, ed25519.SeedSize))
+	assert.Nil(t, os.Setenv("GO_UPDATE_TEST_SIGNING_KEYS", `[{"id": "2024-01", "status": "active", "privateKey": "`+privateKey+`"}]`))
+	defer os.Unsetenv("GO_UPDATE_TEST_SIGNING_KEYS")
+	cfg.ResponseSigningKeysSecret = "GO_UPDATE_TEST_SIGNING_KEYS"
+	assert.Nil(t, loadSecrets(context.Background(), cfg, provider, opts))
+	resp, err := http.Get(server.URL + "/keys")
+	assert.Nil(t, err)
+	keys, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Contains(t, string(keys), `"id":"2024-01"`)
+
+	// And the viewer tokens
+	assert.Nil(t, os.Setenv("GO_UPDATE_TEST_VIEWER_TOKENS", "viewer-token"))
+	defer os.Unsetenv("GO_UPDATE_TEST_VIEWER_TOKENS")
+	cfg.ViewerTokensSecret = "GO_UPDATE_TEST_VIEWER_TOKENS"
+	assert.Nil(t, loadSecrets(context.Background(), cfg, provider, opts))
+	assert.Equal(t, []string{"viewer-token"}, opts.Settings.ViewerTokens)
+
+	cfg.AdminTokensSecret = "GO_UPDATE_TEST_MISSING"
+	assert.NotNil(t, loadSecrets(context.Background(), cfg, provider, opts))
+}
+
+// channelSink sends every exported record to a channel
+type channelSink chan events.Record
+
+func (sink channelSink) Send(ctx context.Context, records []events.Record) error {
+	for _, record := range records {
+		sink <- record
+	}
+	return nil
+}
+
+func TestEvents(t *testing.T) {
+	sink := make(channelSink, 10)
+	exporter := events.NewExporter(sink, events.Settings{QueueSize: 10, BatchSize: 1, FlushInterval: time.Hour, Timeout: time.Second})
+	defer exporter.Close()
+	handler, opts := newHandler(WithStore(memstore.New(nil)), WithEvents(exporter))
+	opts.SetCatalog(handlerOptions.CurrentCatalog().Map())
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	id := "ldimlcelhnjgpjjemdjokpgeeikdinbm"
+	resp, err := http.Post(server.URL+"/extensions", "application/xml", bytes.NewBufferString(extensiontest.ExtensionRequestFnFor(id)("0.0.0")))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	record := <-sink
+	assert.Equal(t, "{b4f77b70-af29-462b-a637-8a3e4be5ecd9}", record.Key)
+	event := extension.UpdateCheckEvent{}
+	assert.Nil(t, json.Unmarshal(record.Data, &event))
+	assert.Equal(t, "mac", event.OS)
+	assert.Equal(t, id, event.Apps[0].AppID)
+	assert.Equal(t, "-2", event.Apps[0].Ping.RollCallDays)
+
+	query := "?os=win&prodversion=69.0.54.0&x=" + url.QueryEscape("id="+id+"&v=0.0.0&uc&ping="+url.QueryEscape("r=-1"))
+	resp, err = http.Get(server.URL + "/extensions" + query)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	record = <-sink
+	event = extension.UpdateCheckEvent{}
+	assert.Nil(t, json.Unmarshal(record.Data, &event))
+	assert.Equal(t, "win", event.OS)
+	assert.Equal(t, "69.0.54.0", event.ProdVersion)
+	assert.Equal(t, id, event.Apps[0].AppID)
+	assert.Equal(t, "-1", event.Apps[0].Ping.RollCallAge)
+
+	// Client IDs are scrubbed before they are exported
+	scrubbed, opts := newHandler(WithStore(memstore.New(nil)), WithEvents(exporter), WithScrubber(privacy.NewScrubber(privacy.ModeGDPR, "")))
+	opts.SetCatalog(handlerOptions.CurrentCatalog().Map())
+	server = httptest.NewServer(scrubbed)
+	defer server.Close()
+	resp, err = http.Post(server.URL+"/extensions", "application/xml", bytes.NewBufferString(extensiontest.ExtensionRequestFnFor(id)("0.0.0")))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	record = <-sink
+	assert.NotContains(t, string(record.Data), "b4f77b70")
+}
@@ -0,0 +1,140 @@
+// Package servertest runs the update server in the test process, with an in-memory catalog and a clock which
+// only moves when the test advances it, so contract tests can check update responses without AWS:
+//
+//	srv := servertest.Start(t, servertest.WithExtensions(ext))
+//	defer srv.Close()
+//	body := srv.Check(t, extensiontest.NewRequest().App(ext.ID, "0.0.0"))
+//	extensiontest.AssertUpdateOffered(t, body, ext.ID, ext.Version, ext.SHA256)
+//
+// Each Server has its own catalog, settings, serving windows and force install list, so several can run at a time,
+// but they share the download URLs and protocol versions the extension package keeps in package state.
+package servertest
+
+import (
+	"bytes"
+	"github.com/brave/go-update/controller"
+	"github.com/brave/go-update/controller/clocktest"
+	"github.com/brave/go-update/extension"
+	"github.com/brave/go-update/extension/extensiontest"
+	"github.com/brave/go-update/memstore"
+	"github.com/brave/go-update/server"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// AdminToken is the bearer token accepted by the admin API of a Server
+const AdminToken = "servertest-admin-token"
+
+// Server is an update server listening on a local port
+type Server struct {
+	*httptest.Server
+	// Handler is the handler of the server, which can also be called without HTTP
+	Handler http.Handler
+	// Store is the catalog the server refreshes from and saves uploads to
+	Store *memstore.Store
+	// Clock is the clock of the server, which starts at the time given by WithTime
+	Clock *clocktest.Clock
+}
+
+// Option configures a Server
+type Option func(*options)
+
+type options struct {
+	extensions    extension.Extensions
+	now           time.Time
+	serverOptions []server.Option
+}
+
+// WithExtensions seeds the catalog with extensions, which is empty by default
+func WithExtensions(extensions ...extension.Extension) Option {
+	return func(o *options) {
+		o.extensions = append(o.extensions, extensions...)
+	}
+}
+
+// WithTime starts the clock of the server at now rather than the current time
+func WithTime(now time.Time) Option {
+	return func(o *options) {
+		o.now = now
+	}
+}
+
+// WithServerOptions passes options to server.New, like fallback URLs, tenants or middleware.
+// Settings given with server.WithSettings need AdminToken in their AdminTokens for Refresh to work.
+func WithServerOptions(opts ...server.Option) Option {
+	return func(o *options) {
+		o.serverOptions = append(o.serverOptions, opts...)
+	}
+}
+
+// Start starts a Server, which must be closed by the test. Extensions which aren't valid fail the test,
+// since the server would quarantine them rather than serve them.
+func Start(t testing.TB, opts ...Option) *Server {
+	t.Helper()
+	o := options{now: time.Now()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	for _, ext := range o.extensions {
+		if problems := controller.ValidateExtension(ext); len(problems) != 0 {
+			t.Fatalf("servertest: extension %s is invalid: %s", ext.ID, strings.Join(problems, ", "))
+		}
+	}
+
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	srv := &Server{Store: memstore.New(o.extensions), Clock: clocktest.New(o.now)}
+	settings := controller.DefaultSettings()
+	settings.AdminTokens = []string{AdminToken}
+	serverOptions := append([]server.Option{server.WithLogger(logger), server.WithStore(srv.Store), server.WithClock(srv.Clock), server.WithSettings(settings)}, o.serverOptions...)
+	srv.Handler = server.New(serverOptions...)
+	srv.Server = httptest.NewServer(srv.Handler)
+	return srv
+}
+
+// Check sends request to the server as an XML update check and returns the response, failing the test unless it succeeds
+func (srv *Server) Check(t testing.TB, request *extensiontest.Request) string {
+	t.Helper()
+	return srv.post(t, request.BuildXML(), "application/xml")
+}
+
+// CheckJSON sends request to the server as a JSON protocol 4 update check and returns the response,
+// failing the test unless it succeeds
+func (srv *Server) CheckJSON(t testing.TB, request *extensiontest.Request) string {
+	t.Helper()
+	return srv.post(t, request.BuildJSON(), "application/json")
+}
+
+func (srv *Server) post(t testing.TB, body string, contentType string) string {
+	t.Helper()
+	resp, err := http.Post(srv.URL+"/extensions", contentType, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatalf("servertest: update check failed: %v", err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("servertest: reading the update response failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("servertest: update check answered %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return string(data)
+}
+
+// Refresh reloads the catalog from Store now, like the admin API does, rather than at the next refresh interval
+func (srv *Server) Refresh(t testing.TB) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/refresh", nil)
+	req.Header.Set("Authorization", "Bearer "+AdminToken)
+	recorder := httptest.NewRecorder()
+	srv.Handler.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusNoContent {
+		t.Fatalf("servertest: refreshing the catalog answered %d: %s", recorder.Code, strings.TrimSpace(recorder.Body.String()))
+	}
+}
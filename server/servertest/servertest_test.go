@@ -0,0 +1,34 @@
+package servertest
+
+import (
+	"context"
+	"github.com/brave/go-update/extension"
+	"github.com/brave/go-update/extension/extensiontest"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestStart(t *testing.T) {
+	ext := extension.Extension{
+		ID:      "hkgkpgldcfgbgnhjdokckbpbenejbkhd",
+		SHA256:  "ac714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618",
+		Title:   "servertest",
+		Version: "2.0.0",
+	}
+	start := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	srv := Start(t, WithExtensions(ext), WithTime(start))
+	defer srv.Close()
+	assert.Equal(t, start, srv.Clock.Now())
+
+	request := extensiontest.NewRequest().App(ext.ID, "1.0.0").Ping()
+	extensiontest.AssertUpdateOffered(t, srv.Check(t, request), ext.ID, "2.0.0", ext.SHA256)
+	extensiontest.AssertUpdateOffered(t, srv.CheckJSON(t, request), ext.ID, "2.0.0", ext.SHA256)
+	extensiontest.AssertNoUpdate(t, srv.Check(t, extensiontest.NewRequest().App(ext.ID, "2.0.0")), ext.ID)
+
+	// Records saved to the store are served after a refresh
+	ext.Version = "3.0.0"
+	assert.Nil(t, srv.Store.SaveExtension(context.Background(), ext))
+	srv.Refresh(t)
+	extensiontest.AssertUpdateOffered(t, srv.Check(t, request), ext.ID, "3.0.0", ext.SHA256)
+}
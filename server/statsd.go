@@ -0,0 +1,34 @@
+package server
+
+import (
+	"github.com/brave/go-update/statsd"
+	"github.com/go-chi/chi"
+	chiware "github.com/go-chi/chi/middleware"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// statsdMetrics counts and times every request by route, method and status
+func statsdMetrics(client *statsd.Client) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			ww := chiware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r)
+
+			// The pattern keeps the number of distinct tags small, unlike the path which contains IDs
+			route := "unknown"
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && len(rctx.RoutePattern()) != 0 {
+				route = rctx.RoutePattern()
+			}
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			tags := []string{"route:" + route, "method:" + r.Method, "status:" + strconv.Itoa(status)}
+			client.Incr("requests", tags...)
+			client.Timing("request.duration", time.Since(start), tags...)
+		})
+	}
+}
@@ -0,0 +1,85 @@
+// Package statsd implements a minimal client for sending metrics to StatsD or the Datadog agent
+package statsd
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client sends metrics over UDP.
+// A nil *Client is valid and discards everything, so callers don't need to check whether StatsD is enabled.
+type Client struct {
+	conn   net.Conn
+	prefix string
+	tags   []string
+}
+
+// New creates a client sending to the StatsD server at addr, like "127.0.0.1:8125".
+// Every metric name is prefixed with prefix and tagged with tags, which use the DogStatsD "key:value" format.
+func New(addr string, prefix string, tags []string) (*Client, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn, prefix: prefix, tags: tags}, nil
+}
+
+// Count adds value to the counter name
+func (client *Client) Count(name string, value int64, tags ...string) {
+	client.send(name, strconv.FormatInt(value, 10), "c", tags)
+}
+
+// Incr adds 1 to the counter name
+func (client *Client) Incr(name string, tags ...string) {
+	client.Count(name, 1, tags...)
+}
+
+// Timing records a duration in milliseconds for the timer name
+func (client *Client) Timing(name string, duration time.Duration, tags ...string) {
+	client.send(name, strconv.FormatFloat(duration.Seconds()*1000, 'f', -1, 64), "ms", tags)
+}
+
+// Gauge sets the gauge name to value
+func (client *Client) Gauge(name string, value float64, tags ...string) {
+	client.send(name, strconv.FormatFloat(value, 'f', -1, 64), "g", tags)
+}
+
+// Close closes the connection to the StatsD server
+func (client *Client) Close() error {
+	if client == nil {
+		return nil
+	}
+	return client.conn.Close()
+}
+
+// send writes a single metric. Metrics are best effort, so write errors are ignored
+// rather than slowing down or failing the request being measured.
+func (client *Client) send(name string, value string, metricType string, tags []string) {
+	if client == nil {
+		return
+	}
+	var b strings.Builder
+	b.WriteString(client.prefix)
+	b.WriteString(sanitize(name))
+	b.WriteByte(':')
+	b.WriteString(value)
+	b.WriteByte('|')
+	b.WriteString(metricType)
+	if len(client.tags)+len(tags) != 0 {
+		b.WriteString("|#")
+		for i, tag := range append(append([]string{}, client.tags...), tags...) {
+			if i != 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(sanitize(tag))
+		}
+	}
+	_, _ = client.conn.Write([]byte(b.String()))
+}
+
+// sanitize replaces the characters which are part of the StatsD line format
+func sanitize(s string) string {
+	return strings.NewReplacer("|", "_", "\n", "_", ",", "_", "#", "_").Replace(s)
+}
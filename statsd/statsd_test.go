@@ -0,0 +1,39 @@
+package statsd
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestClient(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer conn.Close()
+	read := func() string {
+		buf := make([]byte, 1024)
+		assert.Nil(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+		n, _, err := conn.ReadFrom(buf)
+		assert.Nil(t, err)
+		return string(buf[:n])
+	}
+
+	client, err := New(conn.LocalAddr().String(), "go_update.", []string{"env:test"})
+	assert.Nil(t, err)
+	defer client.Close()
+
+	client.Incr("requests", "route:/extensions/", "status:200")
+	assert.Equal(t, "go_update.requests:1|c|#env:test,route:/extensions/,status:200", read())
+	client.Timing("request.duration", 1500*time.Microsecond)
+	assert.Equal(t, "go_update.request.duration:1.5|ms|#env:test", read())
+	client.Gauge("extensions", 12)
+	assert.Equal(t, "go_update.extensions:12|g|#env:test", read())
+	client.Count("updates|served", 2, "id:a,b")
+	assert.Equal(t, "go_update.updates_served:2|c|#env:test,id:a_b", read())
+
+	// A nil client does nothing
+	var disabled *Client
+	disabled.Incr("requests")
+	assert.Nil(t, disabled.Close())
+}